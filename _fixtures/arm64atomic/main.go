@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+// Each function in main_arm64.s increments *p with a sequence of exclusive
+// loads and stores, which can not be single stepped because the exclusive
+// monitor is cleared when the thread stops, see
+// TestStepAtomicSequenceARM64.
+
+func add(p *uint32)
+func addWithBranch(p *uint32)
+func addPair(p *[2]uint64)
+
+func main() {
+	var x uint32
+	var pair [2]uint64
+	add(&x)
+	addWithBranch(&x)
+	addPair(&pair)
+	fmt.Println(x, pair)
+}
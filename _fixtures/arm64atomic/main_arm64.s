@@ -0,0 +1,34 @@
+#include "textflag.h"
+
+// The instruction tested is always the first exclusive load.
+
+TEXT ·add(SB),NOSPLIT,$0-8
+	MOVD	p+0(FP), R0
+loop:
+	LDAXRW	(R0), R1
+	ADDW	$1, R1, R1
+	STLXRW	R1, (R0), R2
+	CBNZW	R2, loop
+	RET
+
+TEXT ·addWithBranch(SB),NOSPLIT,$0-8
+	MOVD	p+0(FP), R0
+loop:
+	LDAXRW	(R0), R1
+	CMPW	$100, R1
+	BHS	done
+	ADDW	$1, R1, R1
+	STLXRW	R1, (R0), R2
+	CBNZW	R2, loop
+done:
+	RET
+
+TEXT ·addPair(SB),NOSPLIT,$0-8
+	MOVD	p+0(FP), R0
+loop:
+	LDXP	(R0), (R1, R2)
+	ADD	$1, R1, R1
+	ADD	$1, R2, R2
+	STXP	(R1, R2), (R0), R3
+	CBNZ	R3, loop
+	RET
@@ -0,0 +1,51 @@
+package main
+
+// Each function in main_arm.s executes one control flow instruction, the
+// one tested by TestSoftwareSingleStepARM, which jumps to target or falls
+// through to the next instruction. All functions return with B (R7).
+
+func target()
+
+func branch()
+func branchLink()
+func branchReg()
+func branchLinkReg()
+func movPC()
+func addPC()
+func addPCReg()
+func ldrPC()
+func ldrPCOffset()
+func ldrPCIndex()
+func ldrPCPostIndex()
+func popPC()
+func branchCondTaken()
+func branchCondNotTaken()
+func movPCCond()
+func subPC()
+func addPCShift()
+func ldmPC()
+func atomicAdd()
+func atomicCas()
+
+func main() {
+	branch()
+	branchLink()
+	branchReg()
+	branchLinkReg()
+	movPC()
+	addPC()
+	addPCReg()
+	ldrPC()
+	ldrPCOffset()
+	ldrPCIndex()
+	ldrPCPostIndex()
+	popPC()
+	branchCondTaken()
+	branchCondNotTaken()
+	movPCCond()
+	subPC()
+	addPCShift()
+	ldmPC()
+	atomicAdd()
+	atomicCas()
+}
@@ -0,0 +1,165 @@
+#include "textflag.h"
+
+// counter is incremented by atomicAdd and atomicCas.
+GLOBL ·counter(SB), NOPTR, $4
+
+// targets holds the address of target twice, for the loads with an offset.
+DATA ·targets+0(SB)/4, $·target(SB)
+DATA ·targets+4(SB)/4, $·target(SB)
+GLOBL ·targets(SB), RODATA, $8
+
+TEXT ·target(SB),NOSPLIT|NOFRAME,$0-0
+	B	(R7)
+
+// The instruction tested is always the last one before the first B (R7).
+
+TEXT ·branch(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	B	·target(SB)
+	B	(R7)
+
+TEXT ·branchLink(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	BL	·target(SB)
+	B	(R7)
+
+TEXT ·branchReg(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·target(SB), R5
+	B	(R5)
+	B	(R7)
+
+TEXT ·branchLinkReg(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·target(SB), R5
+	BL	(R5)
+	B	(R7)
+
+TEXT ·movPC(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·target(SB), R5
+	MOVW	R5, R15
+	B	(R7)
+
+TEXT ·addPC(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	ADD	$4, R15, R15
+	B	(R7)
+	B	(R7)
+	B	·target(SB)
+
+TEXT ·addPCReg(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·target(SB), R5
+	MOVW	$4, R6
+	SUB	R6, R5
+	ADD	R6, R5, R15
+	B	(R7)
+
+TEXT ·ldrPC(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·targets(SB), R5
+	MOVW	(R5), R15
+	B	(R7)
+
+TEXT ·ldrPCOffset(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·targets(SB), R5
+	MOVW	4(R5), R15
+	B	(R7)
+
+TEXT ·ldrPCIndex(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·targets(SB), R5
+	MOVW	$1, R6
+	MOVW	R6<<2(R5), R15
+	B	(R7)
+
+TEXT ·ldrPCPostIndex(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·target(SB), R5
+	MOVW.W	R5, -4(R13)
+	MOVW.P	4(R13), R15
+	B	(R7)
+
+TEXT ·popPC(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·target(SB), R14
+	MOVM.DB.W	[R4, R14], (R13)
+	MOVM.IA.W	(R13), [R4, R15]
+	B	(R7)
+
+TEXT ·branchCondTaken(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	CMP	R0, R0
+	BEQ	taken
+	B	(R7)
+taken:
+	B	·target(SB)
+
+TEXT ·branchCondNotTaken(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	CMP	R0, R0
+	BNE	taken
+	B	(R7)
+taken:
+	B	·target(SB)
+
+TEXT ·movPCCond(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·target(SB), R5
+	CMP	R0, R0
+	MOVW.EQ	R5, R15
+	B	(R7)
+
+TEXT ·subPC(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·target(SB), R5
+	ADD	$4, R5
+	SUB	$4, R5, R15
+	B	(R7)
+
+TEXT ·addPCShift(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·targets(SB), R5
+	MOVW	(R5), R5
+	MOVW	$1, R6
+	SUB	R6<<2, R5
+	ADD	R6<<2, R5, R15
+	B	(R7)
+
+TEXT ·ldmPC(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·targets(SB), R5
+	MOVM.IA	(R5), [R4, R15]
+	B	(R7)
+
+// The instruction tested by the atomic sequences is the exclusive load,
+// stepping over it executes the whole sequence.
+
+TEXT ·atomicAdd(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·counter(SB), R1
+loop:
+	LDREX	(R1), R0
+	ADD	$1, R0
+	STREX	R0, (R1), R2
+	CMP	$0, R2
+	BNE	loop
+	B	(R7)
+
+TEXT ·atomicCas(SB),NOSPLIT|NOFRAME,$0-0
+	MOVW	R14, R7
+	MOVW	$·counter(SB), R1
+	MOVW	$1, R2
+	MOVW	$2, R3
+loop:
+	LDREX	(R1), R0
+	CMP	R0, R2
+	BNE	fail
+	STREX	R3, (R1), R0
+	CMP	$0, R0
+	BNE	loop
+	B	(R7)
+fail:
+	B	(R7)
@@ -0,0 +1,40 @@
+package main
+
+import "fmt"
+
+func sign(n int) (r string) {
+	defer func() { r = "<" + r + ">" }()
+	if n < 0 {
+		return "negative"
+	}
+	if n == 0 {
+		return "zero"
+	}
+	return "positive"
+}
+
+func fact(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return n * fact(n-1)
+}
+
+func explode() int {
+	panic("explode")
+}
+
+func recovering() (r int) {
+	defer func() {
+		if recover() != nil {
+			r = -1
+		}
+	}()
+	return explode()
+}
+
+func main() {
+	fmt.Println(sign(-2), sign(0), sign(2))
+	fmt.Println(fact(3))
+	fmt.Println(recovering())
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func main() {
+	total := 0
+	for i := 0; i < 20; i++ {
+		total += i
+		if i%3 == 0 {
+			total *= 2
+		}
+	}
+	fmt.Println(total)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+)
+
+func main() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	send := func(method, path string, debug bool) {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if debug {
+			req.Header.Set("X-Debug", "1")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		resp.Body.Close()
+	}
+	send("GET", "/api/v1/users/1", true)
+	send("POST", "/api/v2/users/2", true)
+	send("POST", "/api/v1/users/3", false)
+	send("POST", "/api/v1/users/4", true)
+	fmt.Println("done")
+}
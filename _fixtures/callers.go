@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+var total int
+
+func record(n int) {
+	total += n
+}
+
+type recorder interface {
+	add(n int)
+}
+
+type single struct{}
+
+func (single) add(n int) {
+	record(n)
+}
+
+type double struct{}
+
+func (double) add(n int) {
+	record(n)
+	record(n)
+}
+
+func main() {
+	rs := []recorder{single{}, double{}, single{}}
+	for i, r := range rs {
+		r.add(i)
+	}
+	record(10)
+	fmt.Println(total)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+)
+
+func main() {
+	os.Open("/nonexistent/other")
+	os.Open("/nonexistent/catchpoints")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	if conn, err := net.Dial("tcp", srv.Listener.Addr().String()); err == nil {
+		conn.Close()
+	}
+
+	resp, err := http.Get(srv.URL + "/catchpoints/get?q=1")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	resp.Body.Close()
+	fmt.Println("done")
+}
@@ -0,0 +1,32 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <string.h>
+
+char *leak(size_t n) {
+	char *p = malloc(n);
+	memset(p, 1, n);
+	return p;
+}
+
+void scratch(size_t n) {
+	char *p = calloc(n, 1);
+	p = realloc(p, 2*n);
+	free(p);
+}
+*/
+import "C"
+
+import "runtime"
+
+var leaked []*C.char
+
+func main() {
+	runtime.Breakpoint()
+	for i := 0; i < 10; i++ {
+		leaked = append(leaked, C.leak(100))
+		C.scratch(50)
+	}
+	runtime.Breakpoint()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+type userKey struct{}
+
+type requestID string
+
+func waitDone(ctx context.Context, started chan<- struct{}) {
+	done := ctx.Done()
+	close(started)
+	<-done
+}
+
+func main() {
+	ctx := context.WithValue(context.Background(), userKey{}, "gopher")
+	ctx = context.WithValue(ctx, requestID("id"), 42)
+	ctx, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+	ctx, cancel2 := context.WithCancel(ctx)
+	defer cancel2()
+
+	started := make(chan struct{})
+	go waitDone(ctx, started)
+	<-started
+	time.Sleep(100 * time.Millisecond)
+
+	canceled, cancel3 := context.WithCancel(context.Background())
+	cancel3()
+
+	n := 1
+	runtime.Breakpoint()
+	fmt.Println(ctx, canceled, n)
+}
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+func check(n int) error {
+	if n%3 == 2 {
+		return fmt.Errorf("bad value %d", n)
+	}
+	return nil
+}
+
+func main() {
+	for i := 0; i < 6; i++ {
+		if err := check(i); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "fmt"
+
+type point struct {
+	x, y int
+}
+
+func move(p *point, i int) {
+	if i%3 == 0 {
+		p.x++
+	} else {
+		p.x++
+		p.y--
+	}
+}
+
+func main() {
+	p := &point{}
+	for i := 1; i <= 9; i++ {
+		move(p, i)
+		fmt.Println(p.x, p.y)
+	}
+}
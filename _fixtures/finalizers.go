@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"time"
+)
+
+type resource struct {
+	name string
+}
+
+func release(r *resource) {
+	println("release", r.name)
+}
+
+var kept []*resource
+
+func main() {
+	for i := 0; i < 3; i++ {
+		r := &resource{name: "kept"}
+		runtime.SetFinalizer(r, release)
+		kept = append(kept, r)
+	}
+	f, _ := os.Open(os.Args[0])
+	defer f.Close()
+	// let the finalizer goroutine start.
+	time.Sleep(100 * time.Millisecond)
+	runtime.Breakpoint()
+
+	// the finalizer of the dropped resource runs after the collection.
+	dropped := &resource{name: "dropped"}
+	runtime.SetFinalizer(dropped, release)
+	dropped = nil
+	runtime.GC()
+	time.Sleep(time.Second)
+	runtime.KeepAlive(kept)
+}
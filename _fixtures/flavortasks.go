@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+)
+
+type task struct {
+	id   int
+	name [8]byte
+	sp   uintptr
+	pc   uintptr
+	next *task
+}
+
+var tasks struct {
+	head    *task
+	current *task
+}
+
+func taskEntry() {
+	fmt.Println("task")
+}
+
+func newTask(id int, name string, next *task) *task {
+	t := &task{id: id, next: next, pc: reflect.ValueOf(taskEntry).Pointer()}
+	copy(t.name[:], name)
+	return t
+}
+
+func main() {
+	idle := newTask(3, "idle", nil)
+	worker := newTask(2, "worker", idle)
+	tasks.head = newTask(1, "main", worker)
+	tasks.current = tasks.head
+	runtime.Breakpoint()
+	fmt.Println(tasks.head, tasks.current)
+}
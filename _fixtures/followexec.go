@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+func child(n int) {
+	fmt.Println("child", n)
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		n, _ := strconv.Atoi(os.Args[1])
+		child(n)
+		return
+	}
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command(os.Args[0], strconv.Itoa(i))
+		cmd.Stdout = os.Stdout
+		if err := cmd.Run(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	fmt.Println("done")
+}
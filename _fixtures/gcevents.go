@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func main() {
+	done := make(chan bool)
+	go func() {
+		done <- true
+	}()
+	<-done
+	runtime.GC()
+	fmt.Println("done")
+}
@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+func classify(n int) string {
+	if n < 0 {
+		return "negative"
+	}
+	if n > 100 {
+		return "huge"
+	}
+	return "positive"
+}
+
+func unused() {
+	fmt.Println("never")
+}
+
+func main() {
+	for i := -1; i < 3; i++ {
+		fmt.Println(classify(i))
+	}
+	if len(fmt.Sprint()) > 0 {
+		unused()
+	}
+}
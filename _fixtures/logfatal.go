@@ -0,0 +1,14 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		log.Fatalln("fatal")
+	}
+	l := log.New(os.Stderr, "logfatal: ", 0)
+	l.Fatalf("exiting with %d", 1)
+}
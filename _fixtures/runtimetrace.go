@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/trace"
+)
+
+func work(i int) int {
+	return i * i
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		// links the functions of runtime/trace called by the debugger.
+		f, err := os.OpenFile(os.Args[1], os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			panic(err)
+		}
+		trace.Start(f)
+		trace.Log(context.Background(), "main", "started")
+		trace.Stop()
+		f.Close()
+	}
+	s := 0
+	for i := 0; i < 5; i++ {
+		s += work(i)
+	}
+	fmt.Println(s)
+}
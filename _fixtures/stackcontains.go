@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+func lookup(key string) int {
+	return len(key)
+}
+
+func helper(key string) int {
+	return lookup(key)
+}
+
+func handleRequest(key string) int {
+	return helper(key)
+}
+
+func background(key string) int {
+	return lookup(key)
+}
+
+func main() {
+	fmt.Println(background("a"), handleRequest("bb"), background("ccc"), handleRequest("dddd"))
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestFoo(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		n    int
+	}{{"one", 1}, {"two", 2}, {"three", 3}} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.n == 0 {
+				t.Fatal("zero")
+			}
+		})
+	}
+}
+
+func main() {
+	testing.Main(func(pat, str string) (bool, error) { return true, nil }, []testing.InternalTest{{Name: "TestFoo", F: TestFoo}}, nil, nil)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+func onTimeout() {
+	println("timeout")
+}
+
+func main() {
+	timer := time.NewTimer(time.Hour)
+	ticker := time.NewTicker(time.Minute)
+	started := make(chan struct{}, 3)
+	go func() {
+		started <- struct{}{}
+		<-timer.C
+	}()
+	go func() {
+		started <- struct{}{}
+		<-ticker.C
+	}()
+	go func() {
+		started <- struct{}{}
+		time.Sleep(2 * time.Hour)
+	}()
+	time.AfterFunc(3*time.Hour, onTimeout)
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+	time.Sleep(100 * time.Millisecond)
+	runtime.Breakpoint()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+func worker(jobs <-chan int, results chan<- int) {
+	for j := range jobs {
+		results <- j * 2
+	}
+}
+
+func producer(results chan<- int) {
+	results <- 1
+}
+
+func main() {
+	jobs := make(chan int, 2)
+	results := make(chan int)
+	for i := 0; i < 3; i++ {
+		go worker(jobs, results)
+	}
+	for i := 0; i < 2; i++ {
+		go producer(results)
+	}
+	time.Sleep(100 * time.Millisecond)
+	n := 1
+	runtime.Breakpoint()
+	fmt.Println(n, <-results)
+}
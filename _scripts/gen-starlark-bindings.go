@@ -26,7 +26,7 @@ func getSuitableMethods(pkg *types.Package, typename string) []*types.Func {
 			continue
 		}
 
-		if fn.Name() == "Command" || fn.Name() == "Restart" || fn.Name() == "State" {
+		if asyncMethods[fn.Name()] {
 			r = append(r, fn)
 			continue
 		}
@@ -97,6 +97,20 @@ type binding struct {
 	argTypes []string
 }
 
+// asyncMethods are the methods of RPCServer that reply using a
+// service.RPCCallback, their reply type is the method name followed by Out.
+var asyncMethods = map[string]bool{
+	"Command":          true,
+	"Restart":          true,
+	"State":            true,
+	"Stacktrace":       true,
+	"ListPackageVars":  true,
+	"ListLocalVars":    true,
+	"ListFunctionArgs": true,
+	"Eval":             true,
+	"GetOutput":        true,
+}
+
 func processServerMethods(serverMethods []*types.Func) []binding {
 	bindings := make([]binding, len(serverMethods))
 	for i, fn := range serverMethods {
@@ -120,13 +134,8 @@ func processServerMethods(serverMethods []*types.Func) []binding {
 		}
 
 		retType := sig.Params().At(1).Type().String()
-		switch fn.Name() {
-		case "Command":
-			retType = "rpc2.CommandOut"
-		case "Restart":
-			retType = "rpc2.RestartOut"
-		case "State":
-			retType = "rpc2.StateOut"
+		if asyncMethods[fn.Name()] {
+			retType = "rpc2." + fn.Name() + "Out"
 		}
 
 		bindings[i] = binding{
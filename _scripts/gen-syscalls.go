@@ -0,0 +1,97 @@
+// This script generates pkg/proc/linutil/syscalls_table.go from the
+// zsysnum_linux_*.go files of golang.org/x/sys/unix
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// archs are the architectures supported by the linux backends.
+var archs = []string{"386", "amd64", "arm", "arm64"}
+
+var sysnumRx = regexp.MustCompile(`^\s*SYS_([A-Z0-9_]+)\s*=\s*(\d+)`)
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatalf("usage: %s <path to golang.org/x/sys/unix> <output file>", os.Args[0])
+	}
+
+	outfh := os.Stdout
+	if os.Args[2] != "-" {
+		var err error
+		outfh, err = os.Create(os.Args[2])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer outfh.Close()
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, `// THIS FILE IS AUTOGENERATED, EDIT _scripts/gen-syscalls.go INSTEAD
+
+package linutil
+
+// syscallNames maps the numbers of the system calls of each architecture
+// to their names.
+var syscallNames = map[string]map[int]string{
+`)
+
+	for _, arch := range archs {
+		names := readSysnum(filepath.Join(os.Args[1], "zsysnum_linux_"+arch+".go"))
+		nums := make([]int, 0, len(names))
+		for num := range names {
+			nums = append(nums, num)
+		}
+		sort.Ints(nums)
+		fmt.Fprintf(&buf, "%q: {\n", arch)
+		for _, num := range nums {
+			fmt.Fprintf(&buf, "%d: %q,\n", num, names[num])
+		}
+		fmt.Fprintf(&buf, "},\n")
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	outfh.Write(src)
+}
+
+func readSysnum(path string) map[int]string {
+	fh, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fh.Close()
+
+	names := make(map[int]string)
+	s := bufio.NewScanner(fh)
+	for s.Scan() {
+		m := sysnumRx.FindStringSubmatch(s.Text())
+		if m == nil {
+			continue
+		}
+		num, err := strconv.Atoi(m[2])
+		if err != nil {
+			log.Fatal(err)
+		}
+		names[num] = strings.ToLower(m[1])
+	}
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return names
+}
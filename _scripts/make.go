@@ -195,8 +195,11 @@ func getoutput(cmd string, args ...interface{}) string {
 	return string(out)
 }
 
+// codesign signs the dlv executable at path with the certificate
+// specified by $CERT and the entitlements required by the native backend,
+// see 'dlv codesign'.
 func codesign(path string) {
-	execute("codesign", "-s", os.Getenv("CERT"), path)
+	execute(path, "codesign", "--identity", os.Getenv("CERT"))
 }
 
 func installedExecutablePath() string {
@@ -219,13 +222,20 @@ func canMacnative() bool {
 	}
 
 	macOSVersion := strings.Split(strings.TrimSpace(getoutput("/usr/bin/sw_vers", "-productVersion")), ".")
+	if len(macOSVersion) < 2 {
+		macOSVersion = append(macOSVersion, "0")
+	}
+	major, err := strconv.ParseInt(macOSVersion[0], 10, 64)
+	if err != nil {
+		return false
+	}
 	minor, err := strconv.ParseInt(macOSVersion[1], 10, 64)
 	if err != nil {
 		return false
 	}
 
 	typesHeader := "/usr/include/sys/types.h"
-	if minor >= 15 {
+	if major > 10 || minor >= 15 {
 		typesHeader = "/Library/Developer/CommandLineTools/SDKs/MacOSX.sdk/usr/include/sys/types.h"
 	}
 	_, err = os.Stat(typesHeader)
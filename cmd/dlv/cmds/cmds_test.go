@@ -1,6 +1,9 @@
 package cmds
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -57,3 +60,99 @@ func TestParseRedirects(t *testing.T) {
 		}
 	}
 }
+
+func TestIsLineTraceSpec(t *testing.T) {
+	testCases := []struct {
+		in  string
+		tgt bool
+	}{
+		{"foo", false},
+		{"main.foo", false},
+		{"runtime.*", false},
+		{"^main\\..*$", false},
+		{"issue573.go:19", true},
+		{"main.foo:2", true},
+		{"/foo/", false},
+	}
+
+	for _, tc := range testCases {
+		if out := isLineTraceSpec(tc.in); out != tc.tgt {
+			t.Errorf("isLineTraceSpec(%q): expected %v got %v", tc.in, tc.tgt, out)
+		}
+	}
+}
+
+func TestSubtestPattern(t *testing.T) {
+	testCases := []struct {
+		in, name, pattern string
+	}{
+		{"TestFoo", "TestFoo", "^TestFoo$"},
+		{"TestFoo/bar/baz", "TestFoo/bar/baz", "^TestFoo$/^bar$/^baz$"},
+		{"TestFoo/a case (1+1)", "TestFoo/a_case_(1+1)", `^TestFoo$/^a_case_\(1\+1\)$`},
+		{"TestFoo/#01", "TestFoo/#01", "^TestFoo$/^#01$"},
+	}
+	for _, tc := range testCases {
+		name := subtestName(tc.in)
+		if name != tc.name {
+			t.Errorf("subtestName(%q) = %q, expected %q", tc.in, name, tc.name)
+		}
+		if pattern := subtestPattern(name); pattern != tc.pattern {
+			t.Errorf("subtestPattern(%q) = %q, expected %q", name, pattern, tc.pattern)
+		}
+	}
+}
+
+func TestFuzzCorpusEntry(t *testing.T) {
+	pkgDir, err := ioutil.TempDir("", "dlv-fuzz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pkgDir)
+
+	// an input in the corpus of the fuzz test
+	corpus := filepath.Join(pkgDir, "testdata", "fuzz", "FuzzFoo")
+	if err := os.MkdirAll(corpus, 0755); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(corpus, "582528ddfad69eb5")
+	if err := ioutil.WriteFile(input, []byte("go test fuzz v1\n[]byte(\"a\")\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entry, cleanup, err := fuzzCorpusEntry(pkgDir, input, "")
+	if err != nil || entry != "FuzzFoo/582528ddfad69eb5" {
+		t.Fatalf("wrong entry %q %v", entry, err)
+	}
+	cleanup()
+	if _, err := os.Stat(input); err != nil {
+		t.Fatalf("input removed: %v", err)
+	}
+
+	// an input outside of the corpus is copied into it
+	other := filepath.Join(pkgDir, "crasher")
+	if err := ioutil.WriteFile(other, []byte("go test fuzz v1\n[]byte(\"b\")\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fuzzCorpusEntry(pkgDir, other, ""); err == nil {
+		t.Fatal("no error without the name of the fuzz test")
+	}
+	entry, cleanup, err = fuzzCorpusEntry(pkgDir, other, "FuzzBar")
+	if err != nil || entry != "FuzzBar/crasher" {
+		t.Fatalf("wrong entry %q %v", entry, err)
+	}
+	copied := filepath.Join(pkgDir, "testdata", "fuzz", "FuzzBar", "crasher")
+	if _, err := os.Stat(copied); err != nil {
+		t.Fatalf("input not copied: %v", err)
+	}
+	cleanup()
+	if _, err := os.Stat(filepath.Dir(copied)); !os.IsNotExist(err) {
+		t.Fatalf("copy not removed: %v", err)
+	}
+
+	// inputs do not replace different entries of the corpus
+	if err := ioutil.WriteFile(filepath.Join(corpus, "crasher"), []byte("go test fuzz v1\n[]byte(\"c\")\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fuzzCorpusEntry(pkgDir, other, "FuzzFoo"); err == nil {
+		t.Fatal("entry of the corpus replaced")
+	}
+}
@@ -1,27 +1,43 @@
 package cmds
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"plugin"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
+	"unicode"
 
 	"github.com/go-delve/delve/pkg/config"
+	"github.com/go-delve/delve/pkg/doctor"
+	"github.com/go-delve/delve/pkg/findproc"
 	"github.com/go-delve/delve/pkg/gobuild"
 	"github.com/go-delve/delve/pkg/goversion"
+	"github.com/go-delve/delve/pkg/k8s"
+	"github.com/go-delve/delve/pkg/locspec"
 	"github.com/go-delve/delve/pkg/logflags"
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/pkg/proc/gdbserial"
+	"github.com/go-delve/delve/pkg/symbolize"
 	"github.com/go-delve/delve/pkg/terminal"
 	"github.com/go-delve/delve/pkg/version"
+	"github.com/go-delve/delve/pkg/wsl"
 	"github.com/go-delve/delve/service"
 	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/audit"
+	"github.com/go-delve/delve/service/corediff"
 	"github.com/go-delve/delve/service/dap"
 	"github.com/go-delve/delve/service/debugger"
 	"github.com/go-delve/delve/service/rpc2"
@@ -37,6 +53,8 @@ var (
 	logOutput string
 	// logDest is the file path or file descriptor where logs should go.
 	logDest string
+	// logFormat is the format of logs, text or json.
+	logFormat string
 	// headless is whether to run without terminal.
 	headless bool
 	// continueOnStart is whether to continue the process on startup
@@ -45,8 +63,50 @@ var (
 	apiVersion int
 	// acceptMulti allows multiple clients to connect to the same server
 	acceptMulti bool
+	// onDisconnect is what happens to the target when the connection to
+	// the client is lost.
+	onDisconnect string
+	// metricsAddr is the listen address of the health and metrics endpoint.
+	metricsAddr string
+	// auditLogPath is the path of the audit log.
+	auditLogPath string
+	// readOnly rejects the operations that change the state of the target.
+	readOnly bool
+	// allowTracepoints allows tracepoints when readOnly is set.
+	allowTracepoints bool
+	// coreDiffVars selects the package variables compared by core-diff.
+	coreDiffVars string
+	// symbolizeCore is the core file used by symbolize to relocate the executable.
+	symbolizeCore string
+	// k8sOpts are the options of 'k8s attach'.
+	k8sOpts k8s.Options
+	// attachDocker is the container whose main process is attached to.
+	attachDocker string
+	// attachName is the name of the executable of the process attached to.
+	attachName string
+	// attachWait waits for the process called attachName to start.
+	attachWait bool
+	// attachReattach attaches to the new process called attachName when
+	// the target exits.
+	attachReattach bool
+	// sourceRoot is the directory where the terminal searches the source
+	// files that do not exist locally.
+	sourceRoot string
 	// addr is the debugging server listen address.
 	addr string
+	// connectAddr is the address of the client a headless server connects
+	// to, instead of listening at addr.
+	connectAddr string
+	// connectToken authenticates the connections between a headless server
+	// started with --connect and 'dlv connect --reverse'.
+	connectToken string
+	// connectReverse makes 'dlv connect' wait for a headless server to
+	// connect to it.
+	connectReverse bool
+	// wireEncoding and wireCompression are the encoding and the
+	// compression of the messages sent by 'dlv connect'.
+	wireEncoding    string
+	wireCompression string
 	// initFile is the path to initialization file.
 	initFile string
 	// buildFlags is the flags passed during compiler invocation.
@@ -58,6 +118,10 @@ var (
 	checkLocalConnUser bool
 	// tty is used to provide an alternate TTY for the program you wish to debug.
 	tty string
+	// allocatePTY and streamOutput stream the output of the launched
+	// process to clients, see addOutputFlags.
+	allocatePTY  bool
+	streamOutput bool
 
 	// backend selection
 	backend string
@@ -70,6 +134,18 @@ var (
 	// rootCommand is the root of the command tree.
 	rootCommand *cobra.Command
 
+	// testSubtest is the test or subtest run by dlv test, see subtestPattern.
+	testSubtest string
+	// fuzzInput and fuzzTarget are the input replayed by dlv fuzz and the
+	// fuzz test it is passed to.
+	fuzzInput  string
+	fuzzTarget string
+
+	// watchSources and watchDebounce rebuild and restart the target of dlv
+	// debug and dlv test when its source files change, see addWatchFlags.
+	watchSources  bool
+	watchDebounce time.Duration
+
 	traceAttachPid  int
 	traceExecFile   string
 	traceTestBinary bool
@@ -78,8 +154,41 @@ var (
 	// redirect specifications for target process
 	redirects []string
 
+	// sandbox options of the launched processes, see addSandboxFlags.
+	sandboxEnv      []string
+	sandboxEnvMode  string
+	sandboxEnvAllow []string
+	sandboxRlimits  []string
+	sandboxUser     string
+	sandboxGroup    string
+	sandboxUnshare  []string
+
 	allowNonTerminalInteractive bool
 
+	// stopOnExit is true if the target should be stopped when it calls
+	// os.Exit or log.Fatal.
+	stopOnExit bool
+	// crashReport is the path of the file where the crash reports are written.
+	crashReport string
+	// stopTimeAlarm is how long the target can stay stopped before a
+	// warning is logged.
+	stopTimeAlarm time.Duration
+	// compileConditions enables the compilation of breakpoint conditions.
+	compileConditions bool
+	// followExec is true if the child processes of the target are debugged.
+	followExec bool
+	// codesignIdentity is the identity used by dlv codesign.
+	codesignIdentity string
+	// wslOpts are the options of the headless instance of Delve started
+	// on the other side of WSL, see wslExec.
+	wslOpts wsl.Options
+	// stubAddr is the address of the stub used by the gdbstub backend.
+	stubAddr string
+	// flavor is the name of the flavor of the target.
+	flavor string
+	// flavorPlugins are the Go plugins that register flavors.
+	flavorPlugins []string
+
 	conf *config.Config
 )
 
@@ -98,6 +207,24 @@ Pass flags to the program you are debugging using ` + "`--`" + `, for example:
 func New(docCall bool) *cobra.Command {
 	// Config setup and load.
 	conf = config.LoadConfig()
+	for _, path := range conf.RuntimeDescriptors {
+		if err := proc.LoadRuntimeDescriptors(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not load runtime descriptors: %v\n", err)
+		}
+	}
+	for _, fc := range conf.Flavors {
+		proc.RegisterFlavor(fc.Name, &proc.ListFlavor{
+			Head:     fc.Head,
+			Current:  fc.Current,
+			Next:     fc.Next,
+			ID:       fc.ID,
+			Name:     fc.ThreadName,
+			PC:       fc.PC,
+			SP:       fc.SP,
+			BP:       fc.BP,
+			PCOffset: fc.PCOffset,
+		})
+	}
 	buildFlagsDefault := ""
 	if runtime.GOOS == "windows" {
 		ver, _ := goversion.Installed()
@@ -119,10 +246,18 @@ func New(docCall bool) *cobra.Command {
 	rootCommand.PersistentFlags().BoolVarP(&log, "log", "", false, "Enable debugging server logging.")
 	rootCommand.PersistentFlags().StringVarP(&logOutput, "log-output", "", "", `Comma separated list of components that should produce debug output (see 'dlv help log')`)
 	rootCommand.PersistentFlags().StringVarP(&logDest, "log-dest", "", "", "Writes logs to the specified file or file descriptor (see 'dlv help log').")
+	rootCommand.PersistentFlags().StringVarP(&logFormat, "log-format", "", "text", "Format of logs, text or json (see 'dlv help log').")
 
 	rootCommand.PersistentFlags().BoolVarP(&headless, "headless", "", false, "Run debug server only, in headless mode.")
 	rootCommand.PersistentFlags().BoolVarP(&acceptMulti, "accept-multiclient", "", false, "Allows a headless server to accept multiple client connections.")
-	rootCommand.PersistentFlags().IntVar(&apiVersion, "api-version", 1, "Selects API version when headless. New clients should use v2. Can be reset via RPCServer.SetApiVersion. See Documentation/api/json-rpc/README.md.")
+	rootCommand.PersistentFlags().StringVar(&onDisconnect, "on-disconnect", "", `Keeps a headless server running when the connection to its client is lost, because of a network error, halting the target with "stop" or resuming it with "continue", so that a new client can connect and resume the session with the same breakpoints. Implies --accept-multiclient.`)
+	rootCommand.PersistentFlags().StringVar(&connectAddr, "connect", "", "Connects a headless server to a client started with 'dlv connect --reverse' at the specified address, instead of listening, for targets that can not accept incoming connections (see 'dlv help connect').")
+	rootCommand.PersistentFlags().StringVar(&connectToken, "connect-token", "", "Token authenticating the connection between --connect and 'dlv connect --reverse', defaults to the value of $DELVE_CONNECT_TOKEN.")
+	rootCommand.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", "", "Serves the health, the status and Prometheus metrics of a headless server over HTTP at the specified address (/healthz, /status and /metrics). Like the API, /status is only served locally to the user that started Delve, unless --only-same-user=false.")
+	rootCommand.PersistentFlags().StringVar(&auditLogPath, "audit-log", "", "Appends a JSON line to the specified file for every operation that changes the state of the target (resuming it, setting variables or breakpoints, writing memory...), with the client that requested it.")
+	rootCommand.PersistentFlags().BoolVar(&readOnly, "read-only", false, "Rejects the operations that change the state of the target: setting variables, calling functions, writing memory, restarting or killing it and creating breakpoints.")
+	rootCommand.PersistentFlags().BoolVar(&allowTracepoints, "allow-tracepoints", false, "Allows creating tracepoints with --read-only.")
+	rootCommand.PersistentFlags().IntVar(&apiVersion, "api-version", 1, "Selects API version when headless. New clients should use v2, v3 is a draft. Can be reset via RPCServer.SetApiVersion. See Documentation/api/json-rpc/README.md.")
 	rootCommand.PersistentFlags().StringVar(&initFile, "init", "", "Init file, executed by the terminal client.")
 	rootCommand.PersistentFlags().StringVar(&buildFlags, "build-flags", buildFlagsDefault, "Build flags, to be passed to the compiler.")
 	rootCommand.PersistentFlags().StringVar(&workingDir, "wd", "", "Working directory for running the program.")
@@ -131,6 +266,14 @@ func New(docCall bool) *cobra.Command {
 	rootCommand.PersistentFlags().StringVar(&backend, "backend", "default", `Backend selection (see 'dlv help backend').`)
 	rootCommand.PersistentFlags().StringArrayVarP(&redirects, "redirect", "r", []string{}, "Specifies redirect rules for target process (see 'dlv help redirect')")
 	rootCommand.PersistentFlags().BoolVar(&allowNonTerminalInteractive, "allow-non-terminal-interactive", false, "Allows interactive sessions of Delve that don't have a terminal as stdin, stdout and stderr")
+	rootCommand.PersistentFlags().BoolVar(&stopOnExit, "stop-on-exit", false, "Stops the target when it calls os.Exit or log.Fatal.")
+	rootCommand.PersistentFlags().StringVar(&stubAddr, "gdbstub-addr", gdbserial.DefaultStubAddr, "Address of the gdb remote protocol stub used by the gdbstub backend.")
+	rootCommand.PersistentFlags().StringVar(&flavor, "flavor", "", `Lists the threads of interest of the target as goroutines, using the specified flavor (see 'dlv help flavor').`)
+	rootCommand.PersistentFlags().StringArrayVar(&flavorPlugins, "flavor-plugin", nil, "Loads a Go plugin registering flavors.")
+	rootCommand.PersistentFlags().StringVar(&crashReport, "crash-report", "", "Appends the stacks of all goroutines and the values of active panics to the specified file every time the target stops because of an unrecovered panic, a fatal runtime error, os.Exit or log.Fatal.")
+	rootCommand.PersistentFlags().DurationVar(&stopTimeAlarm, "stop-time-alarm", 0, "Logs a warning when the target stays stopped by the debugger longer than the specified duration, for example 5s (see the stoptime command).")
+	rootCommand.PersistentFlags().BoolVar(&compileConditions, "compile-conditions", false, `Evaluates simple breakpoint conditions in the target without stopping it, with the native backend on linux/amd64 (see 'help condition' in the terminal).`)
+	rootCommand.PersistentFlags().BoolVar(&followExec, "follow-exec", false, `Debugs the child processes of the target that run Go executables, for example the servers started by a test, each one with a new headless instance of Delve (see 'help targets' in the terminal), only with the native backend on linux.`)
 
 	// 'attach' subcommand.
 	attachCommand := &cobra.Command{
@@ -141,15 +284,41 @@ func New(docCall bool) *cobra.Command {
 This command will cause Delve to take control of an already running process, and
 begin a new debug session.  When exiting the debug session you will have the
 option to let the process continue or kill it.
+
+With --docker the main process of the specified container is attached to,
+instead of the process with the specified PID, and no PID must be provided:
+the PID of the process is obtained with 'docker inspect', or 'nerdctl
+inspect' for containerd. Delve must run on the host of the container, with
+the privileges needed to debug processes of other users, for example as
+root.
+
+With --name the newest process whose executable has the specified name is
+attached to, and no PID must be provided, --wait waits for the process to
+start if it is not running. With --reattach, every time the process exits
+while it is continued Delve waits for a new process with the same name, for
+example restarted by a supervisor, and attaches to it, keeping the
+breakpoints: this can be used to debug processes that crash repeatedly.
+
+The executable, the shared libraries and the source files of processes
+running in a different mount namespace than Delve, like the processes of
+containers, are read from their root directory (/proc/<pid>/root), unless
+the source files also exist on the machine running Delve.
 `,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) == 0 {
+			if (attachWait || attachReattach) && attachName == "" {
+				return errors.New("--wait and --reattach require --name")
+			}
+			if len(args) == 0 && attachDocker == "" && attachName == "" {
 				return errors.New("you must provide a PID")
 			}
 			return nil
 		},
 		Run: attachCmd,
 	}
+	attachCommand.Flags().StringVar(&attachDocker, "docker", "", "Attaches to the main process of the specified Docker or containerd container.")
+	attachCommand.Flags().StringVar(&attachName, "name", "", "Attaches to the newest process whose executable has the specified name.")
+	attachCommand.Flags().BoolVar(&attachWait, "wait", false, "Waits for the process specified with --name to start.")
+	attachCommand.Flags().BoolVar(&attachReattach, "reattach", false, "Attaches to the new process with the name specified with --name, keeping the breakpoints, when the process exits.")
 	attachCommand.Flags().BoolVar(&continueOnStart, "continue", false, "Continue the debugged process on start.")
 	rootCommand.AddCommand(attachCommand)
 
@@ -157,7 +326,21 @@ option to let the process continue or kill it.
 	connectCommand := &cobra.Command{
 		Use:   "connect addr",
 		Short: "Connect to a headless debug server.",
-		Long:  "Connect to a running headless debug server.",
+		Long: `Connect to a running headless debug server.
+
+With --reverse the client listens at addr and waits for a headless server
+started with --connect to connect to it, which lets targets behind a NAT or
+a firewall, where inbound ports can not be opened, be debugged:
+
+	dlv connect --reverse --connect-token=secret :4040
+	dlv exec --headless --connect=client.example.com:4040 --connect-token=secret ./hello
+
+The server retries with an exponential backoff, up to 30 seconds between
+attempts, until it reaches the client and, with --accept-multiclient, it
+connects again after each client disconnects. Both ends authenticate each
+other with the token, passed with --connect-token or the DELVE_CONNECT_TOKEN
+environment variable, which is required. The token is not used to encrypt
+the connection, use an SSH tunnel or a VPN on untrusted networks.`,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
 				return errors.New("you must provide an address as the first argument")
@@ -166,6 +349,9 @@ option to let the process continue or kill it.
 		},
 		Run: connectCmd,
 	}
+	connectCommand.Flags().BoolVar(&connectReverse, "reverse", false, "Waits for a headless server started with --connect to connect to addr.")
+	connectCommand.Flags().StringVar(&wireEncoding, "encoding", "", `Encoding of the messages exchanged with the server, "json" (default) or "gob", which is more compact and faster to decode.`)
+	connectCommand.Flags().StringVar(&wireCompression, "compression", "", `Compresses the messages exchanged with the server with "flate", useful on slow links.`)
 	rootCommand.AddCommand(connectCommand)
 
 	// 'dap' subcommand.
@@ -199,6 +385,9 @@ session.`,
 	debugCommand.Flags().String("output", "./__debug_bin", "Output path for the binary.")
 	debugCommand.Flags().BoolVar(&continueOnStart, "continue", false, "Continue the debugged process on start.")
 	debugCommand.Flags().StringVar(&tty, "tty", "", "TTY to use for the target program")
+	addOutputFlags(debugCommand)
+	addWatchFlags(debugCommand)
+	addSandboxFlags(debugCommand)
 	rootCommand.AddCommand(debugCommand)
 
 	// 'exec' subcommand.
@@ -211,7 +400,13 @@ This command will cause Delve to exec the binary and immediately attach to it to
 begin a new debug session. Please note that if the binary was not compiled with
 optimizations disabled, it may be difficult to properly debug it. Please
 consider compiling debugging binaries with -gcflags="all=-N -l" on Go 1.10
-or later, -gcflags="-N -l" on earlier versions of Go.`,
+or later, -gcflags="-N -l" on earlier versions of Go.
+
+With the default backend windows executables are debugged from a WSL
+distribution, and linux executables from windows, by a headless instance of
+Delve started on the other side of WSL (dlv.exe or dlv in the PATH of the
+other side, or the executable specified with --wsl-dlv). The paths of the
+executable and of the source files are translated between the two sides.`,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
 				return errors.New("you must provide a path to a binary")
@@ -219,11 +414,18 @@ or later, -gcflags="-N -l" on earlier versions of Go.`,
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
+			if backend == "default" && wslOtherSide(args[0]) {
+				os.Exit(wslExec(args))
+			}
 			os.Exit(execute(0, args, conf, "", debugger.ExecutingExistingFile, args, buildFlags))
 		},
 	}
 	execCommand.Flags().StringVar(&tty, "tty", "", "TTY to use for the target program")
 	execCommand.Flags().BoolVar(&continueOnStart, "continue", false, "Continue the debugged process on start.")
+	execCommand.Flags().StringVar(&wslOpts.Dlv, "wsl-dlv", "", "Executable of Delve on the other side of WSL.")
+	execCommand.Flags().StringVar(&wslOpts.Distro, "wsl-distro", "", "WSL distribution debugging linux executables from windows, the default distribution if empty.")
+	addOutputFlags(execCommand)
+	addSandboxFlags(execCommand)
 	rootCommand.AddCommand(execCommand)
 
 	// Deprecated 'run' subcommand.
@@ -250,11 +452,33 @@ that package instead.`,
 		Run: testCmd,
 	}
 	testCommand.Flags().String("output", "debug.test", "Output path for the binary.")
+	testCommand.Flags().StringVar(&testSubtest, "run-subtest", "", `Only runs the specified test or subtest, for example TestFoo/bar/baz, and stops at the first line of its function, the closure passed to t.Run for subtests, when continued.`)
+	addOutputFlags(testCommand)
+	addWatchFlags(testCommand)
+	addSandboxFlags(testCommand)
 	rootCommand.AddCommand(testCommand)
 
+	// 'fuzz' subcommand.
+	fuzzCommand := &cobra.Command{
+		Use:   "fuzz [package] --input <file>",
+		Short: "Compile test binary and debug a fuzz test with one input.",
+		Long: `Compiles a test binary with optimizations disabled and begins a new debug session running a fuzz test with one input, usually a crasher found by go test -fuzz, and nothing else.
+
+When continued the program stops at the first line of the fuzz function, the function passed to f.Fuzz, with its arguments decoded from the input.
+
+The fuzz test is the one whose corpus contains the input, for example FuzzParse for testdata/fuzz/FuzzParse/582528ddfad69eb5, or the one specified with --func. Inputs outside of the corpus of the fuzz test are copied into it, in the testdata/fuzz directory of the package, for the duration of the session.`,
+		Run: fuzzCmd,
+	}
+	fuzzCommand.Flags().String("output", "debug.test", "Output path for the binary.")
+	fuzzCommand.Flags().StringVar(&fuzzInput, "input", "", "Input file in the format of the corpus of fuzz tests, written by go test -fuzz.")
+	fuzzCommand.Flags().StringVar(&fuzzTarget, "func", "", "Name of the fuzz test, by default the name of the directory containing the input.")
+	addOutputFlags(fuzzCommand)
+	addSandboxFlags(fuzzCommand)
+	rootCommand.AddCommand(fuzzCommand)
+
 	// 'trace' subcommand.
 	traceCommand := &cobra.Command{
-		Use:   "trace [package] regexp",
+		Use:   "trace [package] regexp|linespec",
 		Short: "Compile and begin tracing program.",
 		Long: `Trace program execution.
 
@@ -263,6 +487,11 @@ provided regular expression and output information when tracepoint is hit.  This
 is useful if you do not want to begin an entire debug session, but merely want
 to know what functions your process is executing.
 
+If the argument specifies a line, either as <file>:<line> or as
+<function>:<line>, a single tracepoint is set on that line instead and the
+arguments and local variables of the enclosing function are printed every time
+it is reached.
+
 The output of the trace sub command is printed to stderr, so if you would like to
 only see the output of the trace operations you can redirect stdout.`,
 		Run: traceCmd,
@@ -283,7 +512,9 @@ The core command will open the specified core file and the associated
 executable and let you examine the state of the process when the
 core dump was taken.
 
-Currently supports linux/amd64 and linux/arm64 core files and windows/amd64 minidumps.`,
+Currently supports linux/amd64, linux/arm64 and linux/arm core files and
+windows/amd64 minidumps. Core files can be examined on any host, for example
+a core file collected from a linux/arm64 machine can be opened on macOS.`,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) != 2 {
 				return errors.New("you must provide a core file and an executable")
@@ -294,6 +525,169 @@ Currently supports linux/amd64 and linux/arm64 core files and windows/amd64 mini
 	}
 	rootCommand.AddCommand(coreCommand)
 
+	// 'core-diff' subcommand.
+	coreDiffCommand := &cobra.Command{
+		Use:   "core-diff <executable> <core1> <core2>",
+		Short: "Compares two core dumps of the same executable.",
+		Long: `Compares two core dumps of the same executable.
+
+The core-diff command opens both core files with the executable and reports
+the differences between them:
+
+* the change in the number of goroutines, by state and by the go statement
+  that created them
+* the package variables whose value changed, all variables outside of the
+  runtime unless --vars is specified
+* the change in the number of live heap objects of each size class, when the
+  runtime records allocation statistics (Go 1.15 and earlier)
+
+This can be used to analyze a leaking service, with a core dump taken
+before the leak and one taken after.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 3 {
+				return errors.New("you must provide an executable and two core files")
+			}
+			return nil
+		},
+		Run: coreDiffCmd,
+	}
+	coreDiffCommand.Flags().StringVar(&coreDiffVars, "vars", "", "Only compares the package variables whose name matches the specified regular expression.")
+	rootCommand.AddCommand(coreDiffCommand)
+
+	symbolizeCommand := &cobra.Command{
+		Use:   "symbolize <executable> [address...]",
+		Short: "Translates addresses into functions and source positions.",
+		Long: `Translates addresses into functions and source positions.
+
+The symbolize command reads the debug information of the executable and
+prints the function, file and line of each address, including the calls of
+inlined functions, in the format used by Go tracebacks.
+
+If no addresses are specified the text to symbolize is read from standard
+input, it can be a list of addresses, one per line, or a Go traceback, for
+example copied from the logs of a crashed program. The positions of the
+frames of tracebacks are recomputed from the function name and the PC
+offset, so that tracebacks whose file names were removed or altered can be
+decoded, and the PCs of signals are symbolized. Other lines are copied
+unmodified.
+
+Position independent executables can only be symbolized with a core file
+of the process, specified with --core.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("you must provide an executable")
+			}
+			return nil
+		},
+		Run: symbolizeCmd,
+	}
+	symbolizeCommand.Flags().StringVar(&symbolizeCore, "core", "", "Core file of the process, used to determine where the executable was loaded.")
+	rootCommand.AddCommand(symbolizeCommand)
+
+	// 'k8s' subcommand.
+	k8sCommand := &cobra.Command{
+		Use:   "k8s",
+		Short: "Debugs processes running in Kubernetes pods.",
+	}
+	k8sAttachCommand := &cobra.Command{
+		Use:   "attach pod[/container]",
+		Short: "Attaches to a process running in a container of a Kubernetes pod.",
+		Long: `Attaches to a process running in a container of a Kubernetes pod.
+
+The k8s attach command uses kubectl to start a headless instance of Delve
+attached to the process, forwards its port to the local machine and
+connects to it. By default the process with PID 1 of the default container
+of the pod is debugged.
+
+The dlv executable started in the pod is either:
+
+* a copy of the local dlv executable, or of the executable specified with
+  --dlv-binary, copied into the container with kubectl cp. The executable
+  must be statically linked (built with CGO_ENABLED=0) for the OS and the
+  architecture of the node and the container must contain tar.
+* the dlv executable of the image specified with --image, run as an
+  ephemeral container of the pod (Kubernetes 1.23 or later).
+
+The container must be allowed to use ptrace, which usually requires the
+SYS_PTRACE capability.
+
+With --headless the address of the headless instance of Delve is printed
+and the port forwarding is kept until dlv is interrupted, instead of
+connecting to it.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("you must provide a pod")
+			}
+			return nil
+		},
+		Run: k8sAttachCmd,
+	}
+	k8sAttachCommand.Flags().StringVarP(&k8sOpts.Namespace, "namespace", "n", "", "Namespace of the pod.")
+	k8sAttachCommand.Flags().StringVar(&k8sOpts.Context, "context", "", "Context of kubectl.")
+	k8sAttachCommand.Flags().StringVarP(&k8sOpts.Container, "container", "c", "", "Container of the process.")
+	k8sAttachCommand.Flags().IntVarP(&k8sOpts.PID, "pid", "p", 1, "PID of the process, in the container.")
+	k8sAttachCommand.Flags().StringVar(&k8sOpts.Image, "image", "", "Runs the dlv executable of the specified image in an ephemeral container.")
+	k8sAttachCommand.Flags().StringVar(&k8sOpts.Dlv, "dlv-binary", "", "Executable copied into the container, the current dlv executable if empty.")
+	k8sAttachCommand.Flags().IntVar(&k8sOpts.Port, "port", k8s.DefaultPort, "Port of the headless instance of Delve, in the pod.")
+	k8sAttachCommand.Flags().BoolVar(&continueOnStart, "continue", false, "Continue the debugged process on start.")
+	k8sCommand.AddCommand(k8sAttachCommand)
+	rootCommand.AddCommand(k8sCommand)
+
+	// 'cache' subcommand.
+	cacheCommand := &cobra.Command{
+		Use:   "cache",
+		Short: "Manages the cache of debug information indexes.",
+		Long: `Manages the cache of debug information indexes.
+
+When an executable with a build ID and a lot of debug information is opened
+the index of its functions, types and variables is saved in a cache, so that
+the next debug session of the same executable starts faster: the debug
+information is not read again and line tables are only parsed when they are
+used.
+
+The cache is stored in the 'index' directory of the configuration directory
+of delve, the DELVE_INDEX_CACHE environment variable can be set to use a
+different directory, or to 'off' to disable the cache. The indexes of the
+least recently used executables are deleted automatically.`,
+	}
+	cacheCommand.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the executables whose index is cached.",
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(cacheList())
+		},
+	})
+	cacheCommand.AddCommand(&cobra.Command{
+		Use:   "clean [build-id...]",
+		Short: "Deletes the cached indexes of the specified executables, or all of them.",
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(cacheClean(args))
+		},
+	})
+	rootCommand.AddCommand(cacheCommand)
+
+	// 'doctor' subcommand.
+	rootCommand.AddCommand(&cobra.Command{
+		Use:   "doctor",
+		Short: "Checks the system for common problems preventing debugging.",
+		Long: `Checks the system for common problems preventing debugging.
+
+The doctor command checks the settings of the system that most often cause
+failures to launch or attach to processes and prints how to fix them:
+
+* on Linux the Yama security module (kernel.yama.ptrace_scope), seccomp
+  filters, the SYS_PTRACE capability of containers and SELinux.
+* on macOS the installation of debugserver, developer mode and System
+  Integrity Protection.
+* on Windows the real-time protection of Windows Defender.
+* the version of the installed Go toolchain.
+
+The exit status is 1 if a problem preventing debugging was found.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(doctorCmd())
+		},
+	})
+
 	// 'version' subcommand.
 	versionCommand := &cobra.Command{
 		Use:   "version",
@@ -304,6 +698,37 @@ Currently supports linux/amd64 and linux/arm64 core files and windows/amd64 mini
 	}
 	rootCommand.AddCommand(versionCommand)
 
+	if runtime.GOOS == "darwin" || docCall {
+		// 'codesign' subcommand.
+		codesignCommand := &cobra.Command{
+			Use:   "codesign",
+			Short: "Signs dlv to use the native backend on macOS.",
+			Long: `Signs dlv to use the native backend on macOS.
+
+The native backend, used when dlv is built with -tags=macnative, acquires
+the mach task of the target with task_for_pid, which requires dlv to be
+signed with the com.apple.security.cs.debugger entitlement. The codesign
+command signs the dlv executable being run with this entitlement, using the
+identity specified by --identity or an ad-hoc signature, and must be run
+again every time dlv is rebuilt.
+
+Additionally developer mode should be enabled, otherwise you will be asked
+to authorize dlv every time it is used:
+
+	sudo DevToolsSecurity -enable
+
+Executables protected by System Integrity Protection, like the ones in
+/usr/bin and /System, and executables signed with the hardened runtime
+without the com.apple.security.get-task-allow entitlement can not be
+debugged.`,
+			Run: func(cmd *cobra.Command, args []string) {
+				os.Exit(codesign(codesignIdentity))
+			},
+		}
+		codesignCommand.Flags().StringVar(&codesignIdentity, "identity", "-", "Identity used to sign dlv, '-' for an ad-hoc signature.")
+		rootCommand.AddCommand(codesignCommand)
+	}
+
 	if path, _ := exec.LookPath("rr"); path != "" || docCall {
 		replayCommand := &cobra.Command{
 			Use:   "replay [trace directory]",
@@ -337,7 +762,52 @@ are:
 	native		Native backend.
 	lldb		Uses lldb-server or debugserver.
 	rr		Uses mozilla rr (https://github.com/mozilla/rr).
+	wine		Runs windows executables under WINE, using the gdb stub of
+			winedbg (set DELVE_WINEDBG to use a different winedbg, for
+			example the one shipped with proton).
+	gdbstub		Connects to the gdb remote protocol stub at the address
+			specified by --gdbstub-addr, for example the one of qemu,
+			running the executable.
+	ios		Launches an app installed on an iOS device under debugserver,
+			the executable is the one of the app on the host. Requires
+			libimobiledevice and ideviceinstaller, the device is
+			selected by setting DELVE_IOS_DEVICE to its UDID and the
+			developer disk image is mounted from Xcode, or from the
+			directory specified by DELVE_IOS_DDI.
+
+The default backend uses wine to run windows executables on linux, macOS
+and FreeBSD, except in WSL distributions where they are debugged on windows
+(see 'dlv help exec').
 
+`})
+
+	rootCommand.AddCommand(&cobra.Command{
+		Use:   "flavor",
+		Short: "Help about the --flavor flag.",
+		Long: `Flavors teach Delve about the threads of interest of targets that do not
+use the goroutines of the Go runtime, for example the tasks of an RTOS or
+of a unikernel running under qemu, debugged with --backend=gdbstub. The
+threads of interest of the flavor specified by --flavor replace the
+goroutines of the target.
+
+Flavors are registered by Go plugins, loaded with --flavor-plugin, that
+call proc.RegisterFlavor in their init function, or described in the
+configuration file (config.yml). The flavors of the configuration file read
+the threads of interest from a linked list:
+
+	flavors:
+	  - name: rtos
+	    head: "tasks.head"        # expression, pointer to the first element
+	    current: "tasks.current"  # expression, pointer to the running element
+	    next: "next"              # field pointing to the next element
+	    id: "id"                  # field containing the ID
+	    thread-name: "name"       # field containing the name
+	    sp: "savedSP"             # field containing the saved stack pointer
+	    pc: "savedPC"              # field containing the saved program counter
+	    bp: "savedBP"              # field containing the saved frame pointer
+
+The saved program counter can also be read from the stack, at the offset
+specified by pc-offset from the saved stack pointer.
 `})
 
 	rootCommand.AddCommand(&cobra.Command{
@@ -359,6 +829,13 @@ names selected from this list:
 	fncall		Log function call protocol
 	minidump	Log minidump loading
 
+Each component name can be followed by a colon and a log level: panic,
+fatal, error, warning, info, debug or trace, for example 'rpc:info'. The
+level is debug if omitted, components that are not specified log errors
+only. The levels can also be changed while Delve runs, with the 'log'
+command of the terminal client or the SetLogLevel API call, without
+restarting the session.
+
 Additionally --log-dest can be used to specify where the logs should be
 written. 
 If the argument is a number it will be interpreted as a file descriptor,
@@ -366,6 +843,15 @@ otherwise as a file path.
 This option will also redirect the "server listening at" message in headless
 and dap modes.
 
+The --log-format flag selects the format of logs: text, the default, or
+json, one JSON object per line with the time, level, message and the
+fields of each entry.
+
+The last 1000 entries logged are also kept in memory, regardless of
+--log-dest, and can be printed with 'log dump' in the terminal client or
+retrieved with the DumpLog API call. They are included in the report Delve
+writes when it fails because of an internal error.
+
 `,
 	})
 
@@ -376,6 +862,10 @@ and dap modes.
 
 The --tty argument allows redirecting all standard descriptors to a terminal, specified as an argument to --tty.
 
+The --pty argument allocates a new pseudo-terminal for the target process, used for all standard descriptors, whose output is sent to the clients of Delve.
+
+The --stream-output argument sends the standard output and error of the target process that are not redirected to files to the clients of Delve instead of writing them to the output of Delve, which is useful with --headless. Each client receives the output written since it connected, tagged with its stream, the terminal client prints it.
+
 The syntax for '-r' argument is:
 
 		-r [source:]destination
@@ -393,7 +883,7 @@ File redirects can also be changed using the 'restart' command.
 
 func dapCmd(cmd *cobra.Command, args []string) {
 	status := func() int {
-		if err := logflags.Setup(log, logOutput, logDest); err != nil {
+		if err := logflags.Setup(log, logOutput, logDest, logFormat); err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 			return 1
 		}
@@ -425,21 +915,38 @@ func dapCmd(cmd *cobra.Command, args []string) {
 			fmt.Fprintf(os.Stderr, "Warning: program flags ignored with dap; specify via launch/attach request instead\n")
 		}
 
+		if err := loadFlavorPlugins(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+
 		listener, err := net.Listen("tcp", addr)
 		if err != nil {
 			fmt.Printf("couldn't start listener: %s\n", err)
 			return 1
 		}
+		auditLog, err := openAuditLog()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		defer auditLog.Close()
 		disconnectChan := make(chan struct{})
 		server := dap.NewServer(&service.Config{
 			Listener:       listener,
 			DisconnectChan: disconnectChan,
+			AuditLog:       auditLog,
 			Debugger: debugger.Config{
 				Backend:              backend,
 				Foreground:           headless && tty == "",
 				DebugInfoDirectories: conf.DebugInfoDirectories,
+				FrameFilters:         conf.FrameFilters,
 				CheckGoVersion:       checkGoVersion,
 				TTY:                  tty,
+				ReadOnly:             readOnly,
+				AllowTracepoints:     allowTracepoints,
+				StubAddr:             stubAddr,
+				Flavor:               flavor,
 			},
 		})
 		defer server.Stop()
@@ -474,7 +981,7 @@ func debugCmd(cmd *cobra.Command, args []string) {
 
 func traceCmd(cmd *cobra.Command, args []string) {
 	status := func() int {
-		err := logflags.Setup(log, logOutput, logDest)
+		err := logflags.Setup(log, logOutput, logDest, logFormat)
 		defer logflags.Close()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -556,42 +1063,15 @@ func traceCmd(cmd *cobra.Command, args []string) {
 			return 1
 		}
 		client := rpc2.NewClientFromConn(clientConn)
-		funcs, err := client.ListFunctions(regexp)
+		if isLineTraceSpec(regexp) {
+			err = setLineTracepoints(client, regexp)
+		} else {
+			err = setFunctionTracepoints(client, regexp)
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return 1
 		}
-		for i := range funcs {
-			_, err = client.CreateBreakpoint(&api.Breakpoint{
-				FunctionName: funcs[i],
-				Tracepoint:   true,
-				Line:         -1,
-				Stacktrace:   traceStackDepth,
-				LoadArgs:     &terminal.ShortLoadConfig,
-			})
-			if err != nil && !isBreakpointExistsErr(err) {
-				fmt.Fprintln(os.Stderr, err)
-				return 1
-			}
-			addrs, err := client.FunctionReturnLocations(funcs[i])
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				return 1
-			}
-			for i := range addrs {
-				_, err = client.CreateBreakpoint(&api.Breakpoint{
-					Addr:        addrs[i],
-					TraceReturn: true,
-					Stacktrace:  traceStackDepth,
-					Line:        -1,
-					LoadArgs:    &terminal.ShortLoadConfig,
-				})
-				if err != nil && !isBreakpointExistsErr(err) {
-					fmt.Fprintln(os.Stderr, err)
-					return 1
-				}
-			}
-		}
 		cmds := terminal.DebugCommands(client)
 		t := terminal.New(client, nil)
 		defer t.Close()
@@ -601,8 +1081,81 @@ func traceCmd(cmd *cobra.Command, args []string) {
 	os.Exit(status)
 }
 
+// setFunctionTracepoints sets a tracepoint on the entry point and on every
+// return instruction of each function matching the regular expression re.
+func setFunctionTracepoints(client *rpc2.RPCClient, re string) error {
+	funcs, err := client.ListFunctions(re)
+	if err != nil {
+		return err
+	}
+	for i := range funcs {
+		_, err = client.CreateBreakpoint(&api.Breakpoint{
+			FunctionName: funcs[i],
+			Tracepoint:   true,
+			Line:         -1,
+			Stacktrace:   traceStackDepth,
+			LoadArgs:     &terminal.ShortLoadConfig,
+		})
+		if err != nil && !isBreakpointExistsErr(err) {
+			return err
+		}
+		addrs, err := client.FunctionReturnLocations(funcs[i])
+		if err != nil {
+			return err
+		}
+		for i := range addrs {
+			_, err = client.CreateBreakpoint(&api.Breakpoint{
+				Addr:        addrs[i],
+				TraceReturn: true,
+				Stacktrace:  traceStackDepth,
+				Line:        -1,
+				LoadArgs:    &terminal.ShortLoadConfig,
+			})
+			if err != nil && !isBreakpointExistsErr(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isLineTraceSpec returns true if spec is a location spec that specifies
+// a line (either <file>:<line> or <function>:<line>) rather than a regular
+// expression matching function names.
+func isLineTraceSpec(spec string) bool {
+	loc, err := locspec.Parse(spec)
+	if err != nil {
+		return false
+	}
+	nloc, ok := loc.(*locspec.NormalLocationSpec)
+	return ok && nloc.LineOffset >= 0
+}
+
+// setLineTracepoints sets a tracepoint on every location matching spec,
+// loading function arguments and local variables when it is hit.
+func setLineTracepoints(client *rpc2.RPCClient, spec string) error {
+	locs, err := client.FindLocation(api.EvalScope{GoroutineID: -1}, spec, true)
+	if err != nil {
+		return err
+	}
+	for _, loc := range locs {
+		_, err = client.CreateBreakpoint(&api.Breakpoint{
+			Addr:       loc.PC,
+			Addrs:      loc.PCs,
+			Tracepoint: true,
+			Stacktrace: traceStackDepth,
+			LoadArgs:   &terminal.ShortLoadConfig,
+			LoadLocals: &terminal.ShortLoadConfig,
+		})
+		if err != nil && !isBreakpointExistsErr(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 func isBreakpointExistsErr(err error) bool {
-	return strings.Contains(err.Error(), "Breakpoint exists")
+	return api.ErrorCodeOf(err) == api.ErrCodeBreakpointExists
 }
 
 func testCmd(cmd *cobra.Command, args []string) {
@@ -620,7 +1173,12 @@ func testCmd(cmd *cobra.Command, args []string) {
 			return 1
 		}
 		defer gobuild.Remove(debugname)
-		processArgs := append([]string{debugname}, targetArgs...)
+		processArgs := []string{debugname}
+		if testSubtest != "" {
+			testSubtest = subtestName(testSubtest)
+			processArgs = append(processArgs, "-test.run", subtestPattern(testSubtest))
+		}
+		processArgs = append(processArgs, targetArgs...)
 
 		if workingDir == "" {
 			if len(dlvArgs) == 1 {
@@ -635,6 +1193,136 @@ func testCmd(cmd *cobra.Command, args []string) {
 	os.Exit(status)
 }
 
+func fuzzCmd(cmd *cobra.Command, args []string) {
+	status := func() int {
+		if fuzzInput == "" {
+			fmt.Fprintln(os.Stderr, "you must specify an input with --input")
+			return 1
+		}
+		debugname, err := filepath.Abs(cmd.Flag("output").Value.String())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		dlvArgs, targetArgs := splitArgs(cmd, args)
+		if len(dlvArgs) > 1 {
+			fmt.Fprintln(os.Stderr, "you can only debug the fuzz tests of one package")
+			return 1
+		}
+		pkgDir := "."
+		if len(dlvArgs) == 1 {
+			pkgDir = getPackageDir(dlvArgs[0])
+		}
+		entry, cleanup, err := fuzzCorpusEntry(pkgDir, fuzzInput, fuzzTarget)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		defer cleanup()
+		fuzzTarget = strings.SplitN(entry, "/", 2)[0]
+
+		err = gobuild.GoTestBuild(debugname, dlvArgs, buildFlags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		defer gobuild.Remove(debugname)
+		processArgs := append([]string{debugname, "-test.run", subtestPattern(entry)}, targetArgs...)
+
+		if workingDir == "" {
+			// the corpus is read from testdata/fuzz in the working directory
+			workingDir = pkgDir
+		}
+
+		return execute(0, processArgs, conf, "", debugger.ExecutingGeneratedTest, dlvArgs, buildFlags)
+	}()
+	os.Exit(status)
+}
+
+// fuzzCorpusEntry returns the name of the corpus entry, as FuzzTest/name,
+// replaying input with the fuzz test target, by default the one whose
+// corpus contains input. Inputs outside of the corpus of the fuzz test, in
+// the testdata/fuzz directory of the package in pkgDir, are copied into it
+// until cleanup is called.
+func fuzzCorpusEntry(pkgDir, input, target string) (entry string, cleanup func(), err error) {
+	input, err = filepath.Abs(input)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := ioutil.ReadFile(input)
+	if err != nil {
+		return "", nil, err
+	}
+	dir := filepath.Dir(input)
+	if target == "" {
+		if filepath.Base(filepath.Dir(dir)) != "fuzz" || filepath.Base(filepath.Dir(filepath.Dir(dir))) != "testdata" {
+			return "", nil, fmt.Errorf("%s is not in the corpus of a fuzz test, specify the fuzz test with --func", input)
+		}
+		target = filepath.Base(dir)
+	}
+	name := filepath.Base(input)
+	corpus, err := filepath.Abs(filepath.Join(pkgDir, "testdata", "fuzz", target))
+	if err != nil {
+		return "", nil, err
+	}
+	entry = target + "/" + name
+	path := filepath.Join(corpus, name)
+	if dir == corpus {
+		return entry, func() {}, nil
+	}
+	if old, err := ioutil.ReadFile(path); err == nil {
+		if !bytes.Equal(old, data) {
+			return "", nil, fmt.Errorf("the corpus of %s already contains a different %s", target, name)
+		}
+		return entry, func() {}, nil
+	}
+
+	// Remember the directories created for the copy, innermost first.
+	var created []string
+	for d := corpus; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || d == filepath.Dir(d) {
+			break
+		}
+		created = append(created, d)
+	}
+	cleanup = func() {
+		os.Remove(path)
+		for _, d := range created {
+			os.Remove(d)
+		}
+	}
+	if err := os.MkdirAll(corpus, 0755); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return entry, cleanup, nil
+}
+
+// subtestName returns the name of the subtest called name as reported by
+// go test -v, which replaces spaces with underscores.
+func subtestName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// subtestPattern returns the argument of -test.run that only runs the test
+// or subtest called name, and the tests containing it.
+func subtestPattern(name string) string {
+	elems := strings.Split(name, "/")
+	for i := range elems {
+		elems[i] = "^" + regexp.QuoteMeta(elems[i]) + "$"
+	}
+	return strings.Join(elems, "/")
+}
+
 func getPackageDir(pkg string) string {
 	out, err := exec.Command("go", "list", "--json", pkg).CombinedOutput()
 	if err != nil {
@@ -652,6 +1340,30 @@ func getPackageDir(pkg string) string {
 }
 
 func attachCmd(cmd *cobra.Command, args []string) {
+	if attachName != "" {
+		var pid int
+		var err error
+		if attachWait {
+			fmt.Fprintf(os.Stderr, "Waiting for a process called %s\n", attachName)
+			pid, err = findproc.Wait(attachName, nil)
+		} else {
+			pid, err = findproc.ByName(attachName)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(execute(pid, args, conf, "", debugger.ExecutingOther, args, buildFlags))
+	}
+	if attachDocker != "" {
+		pid, err := containerPID(attachDocker)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		sourceRoot = fmt.Sprintf("/proc/%d/root", pid)
+		os.Exit(execute(pid, args, conf, "", debugger.ExecutingOther, args, buildFlags))
+	}
 	pid, err := strconv.Atoi(args[0])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Invalid pid: %s\n", args[0])
@@ -660,19 +1372,367 @@ func attachCmd(cmd *cobra.Command, args []string) {
 	os.Exit(execute(pid, args[1:], conf, "", debugger.ExecutingOther, args, buildFlags))
 }
 
+// containerPID returns the PID of the main process of container, using
+// the docker CLI or, for containerd, the nerdctl CLI.
+func containerPID(container string) (int, error) {
+	var lastErr error
+	for _, cli := range []string{"docker", "nerdctl"} {
+		path, err := exec.LookPath(cli)
+		if err != nil {
+			continue
+		}
+		out, err := exec.Command(path, "inspect", "--format", "{{.State.Pid}}", container).Output()
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+				err = errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			lastErr = fmt.Errorf("could not inspect container %s with %s: %v", container, cli, err)
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+		if err != nil {
+			return 0, fmt.Errorf("could not parse the PID of container %s: %q", container, out)
+		}
+		if pid == 0 {
+			return 0, fmt.Errorf("container %s is not running", container)
+		}
+		return pid, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("could not find docker or nerdctl")
+	}
+	return 0, lastErr
+}
+
 func coreCmd(cmd *cobra.Command, args []string) {
 	os.Exit(execute(0, []string{args[0]}, conf, args[1], debugger.ExecutingOther, args, buildFlags))
 }
 
+func coreDiffCmd(cmd *cobra.Command, args []string) {
+	os.Exit(coreDiff(args[0], args[1], args[2]))
+}
+
+func coreDiff(exe, core1, core2 string) int {
+	if err := logflags.Setup(log, logOutput, logDest, logFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer logflags.Close()
+	if err := corediff.ValidateVars(coreDiffVars); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --vars: %v\n", err)
+		return 1
+	}
+
+	var ds [2]*debugger.Debugger
+	for i, core := range []string{core1, core2} {
+		d, err := debugger.New(&debugger.Config{
+			CoreFile:             core,
+			Backend:              backend,
+			ExecuteKind:          debugger.ExecutingOther,
+			DebugInfoDirectories: conf.DebugInfoDirectories,
+		}, []string{exe})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open %s: %v\n", core, err)
+			return 1
+		}
+		defer d.Detach(false)
+		ds[i] = d
+	}
+
+	report, err := corediff.Diff(ds[0], ds[1], corediff.Config{
+		Vars:       coreDiffVars,
+		LoadConfig: proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	report.Print(os.Stdout)
+	return 0
+}
+
+func cacheList() int {
+	dir, ok := proc.IndexCacheDir()
+	if !ok {
+		fmt.Println("The index cache is disabled.")
+		return 0
+	}
+	entries, err := proc.IndexCacheEntries()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Printf("Index cache directory: %s\n", dir)
+	var size int64
+	for _, e := range entries {
+		fmt.Printf("%s %s %6dkB %s\n", e.BuildID, e.LastUsed.Format("2006-01-02 15:04"), e.Size/1024, e.Path)
+		size += e.Size
+	}
+	fmt.Printf("%d executables, %dkB\n", len(entries), size/1024)
+	return 0
+}
+
+func doctorCmd() int {
+	status := 0
+	for _, r := range doctor.Check() {
+		fmt.Printf("%-10s%s: %s\n", "["+r.Status.String()+"]", r.Name, r.Detail)
+		if r.Fix != "" {
+			for _, line := range strings.Split(r.Fix, "\n") {
+				fmt.Printf("          %s\n", line)
+			}
+		}
+		if r.Status == doctor.StatusProblem {
+			status = 1
+		}
+	}
+	return status
+}
+
+// debuggerEntitlements is the property list of the entitlements required
+// by the native backend on macOS.
+const debuggerEntitlements = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>com.apple.security.cs.debugger</key>
+	<true/>
+</dict>
+</plist>
+`
+
+func codesign(identity string) int {
+	if runtime.GOOS != "darwin" {
+		fmt.Fprintf(os.Stderr, "codesign is only supported on macOS\n")
+		return 1
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not find the dlv executable: %v\n", err)
+		return 1
+	}
+	f, err := ioutil.TempFile("", "dlv-entitlements")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(debuggerEntitlements)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	cmd := exec.Command("codesign", "--force", "--sign", identity, "--entitlements", f.Name(), exe)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not sign %s: %v\n", exe, err)
+		return 1
+	}
+	fmt.Printf("Signed %s.\n", exe)
+
+	if out, err := exec.Command("DevToolsSecurity", "-status").Output(); err == nil && bytes.Contains(out, []byte("disabled")) {
+		fmt.Printf("Developer mode is disabled, you will be asked to authorize dlv every time it is used. To enable it run:\n\tsudo DevToolsSecurity -enable\n")
+	}
+	return 0
+}
+
+func cacheClean(buildIDs []string) int {
+	n, err := proc.RemoveIndexCache(buildIDs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Printf("Deleted the index of %d executables.\n", n)
+	return 0
+}
+
+func symbolizeCmd(cmd *cobra.Command, args []string) {
+	os.Exit(symbolizeAddrs(args[0], args[1:]))
+}
+
+func symbolizeAddrs(exe string, addrs []string) int {
+	if err := logflags.Setup(log, logOutput, logDest, logFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer logflags.Close()
+
+	pcs := make([]uint64, len(addrs))
+	for i, addr := range addrs {
+		pc, err := strconv.ParseUint(addr, 0, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid address %q\n", addr)
+			return 1
+		}
+		pcs[i] = pc
+	}
+
+	bi, closefn, err := symbolize.Open(exe, symbolizeCore, conf.DebugInfoDirectories)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open %s: %v\n", exe, err)
+		return 1
+	}
+	defer closefn()
+
+	if len(pcs) == 0 {
+		if err := symbolize.Text(bi, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		return 0
+	}
+	for _, pc := range pcs {
+		symbolize.WriteAddress(os.Stdout, bi, pc)
+	}
+	return 0
+}
+
 func connectCmd(cmd *cobra.Command, args []string) {
 	addr := args[0]
 	if addr == "" {
 		fmt.Fprint(os.Stderr, "An empty address was provided. You must provide an address as the first argument.\n")
 		os.Exit(1)
 	}
+	if connectReverse {
+		os.Exit(reverseConnect(addr))
+	}
 	os.Exit(connect(addr, nil, conf, debugger.ExecutingOther))
 }
 
+// reverseConnect waits for a headless server started with --connect to
+// connect to addr and connects the terminal client to it.
+func reverseConnect(addr string) int {
+	token := dialToken()
+	if token == "" {
+		fmt.Fprint(os.Stderr, "Error: --reverse requires a token, set with --connect-token or DELVE_CONNECT_TOKEN\n")
+		return 1
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't start listener: %s\n", err)
+		return 1
+	}
+	fmt.Printf("Waiting for a headless server to connect at %s\n", listener.Addr())
+	conn, err := service.AcceptDialer(listener, token)
+	listener.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return connect(addr, conn, conf, debugger.ExecutingOther)
+}
+
+// dialToken returns the token of --connect and 'dlv connect --reverse'.
+func dialToken() string {
+	if connectToken != "" {
+		return connectToken
+	}
+	return os.Getenv("DELVE_CONNECT_TOKEN")
+}
+
+func k8sAttachCmd(cmd *cobra.Command, args []string) {
+	os.Exit(k8sAttach(args[0]))
+}
+
+func k8sAttach(target string) int {
+	pod, container, err := k8s.ParseTarget(target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	opts := k8sOpts
+	opts.Pod = pod
+	if container != "" {
+		opts.Container = container
+	}
+	if opts.Image == "" && opts.Dlv == "" {
+		if opts.Dlv, err = os.Executable(); err != nil {
+			fmt.Fprintf(os.Stderr, "could not find the dlv executable: %v\n", err)
+			return 1
+		}
+	}
+	if continueOnStart {
+		opts.Args = append(opts.Args, "--continue")
+	}
+
+	s, err := k8s.Attach(&opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer s.Close()
+
+	if headless {
+		logflags.WriteAPIListeningMessage(s.Addr)
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+		<-ch
+		return 0
+	}
+	conn, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not connect to %s: %v\n", s.Addr, err)
+		return 1
+	}
+	return connect(s.Addr, conn, conf, debugger.ExecutingOther)
+}
+
+// wslOtherSide returns true if the executable at path must be debugged on
+// the other side of WSL: it is a windows executable and dlv is running in a
+// WSL distribution, or it is a linux executable and dlv is running on
+// windows.
+func wslOtherSide(path string) bool {
+	goos, _ := proc.ExecutableOS(path)
+	switch runtime.GOOS {
+	case "linux":
+		return goos == "windows" && wsl.Inside()
+	case "windows":
+		return goos == "linux"
+	}
+	return false
+}
+
+func wslExec(args []string) int {
+	if err := logflags.Setup(log, logOutput, logDest, logFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer logflags.Close()
+
+	opts := wslOpts
+	opts.Exe = args[0]
+	opts.Args = args[1:]
+	opts.WorkingDir = workingDir
+	if continueOnStart {
+		opts.DlvArgs = append(opts.DlvArgs, "--continue")
+	}
+
+	s, err := wsl.Launch(&opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer s.Close()
+
+	if headless {
+		logflags.WriteAPIListeningMessage(s.Addr)
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+		<-ch
+		return 0
+	}
+	conn, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not connect to %s: %v\n", s.Addr, err)
+		return 1
+	}
+	wslConf := *conf
+	wslConf.SubstitutePath = append(append(config.SubstitutePathRules{}, conf.SubstitutePath...), s.SubstitutePath...)
+	return connect(s.Addr, conn, &wslConf, debugger.ExecutingExistingFile)
+}
+
 // waitForDisconnectSignal is a blocking function that waits for either
 // a SIGINT (Ctrl-C) signal from the OS or for disconnectChan to be closed
 // by the server when the client disconnects.
@@ -714,7 +1774,19 @@ func splitArgs(cmd *cobra.Command, args []string) ([]string, []string) {
 func connect(addr string, clientConn net.Conn, conf *config.Config, kind debugger.ExecuteKind) int {
 	// Create and start a terminal - attach to running instance
 	var client *rpc2.RPCClient
-	if clientConn != nil {
+	if wireEncoding != "" || wireCompression != "" {
+		var err error
+		if clientConn == nil {
+			clientConn, err = net.Dial("tcp", addr)
+		}
+		if err == nil {
+			client, err = rpc2.NewClientFromConnEncoding(clientConn, wireEncoding, wireCompression)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not connect to %s: %v\n", addr, err)
+			return 1
+		}
+	} else if clientConn != nil {
 		client = rpc2.NewClientFromConn(clientConn)
 	} else {
 		client = rpc2.NewClient(addr)
@@ -735,6 +1807,7 @@ func connect(addr string, clientConn net.Conn, conf *config.Config, kind debugge
 	}
 	term := terminal.New(client, conf)
 	term.InitFile = initFile
+	term.SourceRoot = sourceRoot
 	status, err := term.Run()
 	if err != nil {
 		fmt.Println(err)
@@ -743,15 +1816,34 @@ func connect(addr string, clientConn net.Conn, conf *config.Config, kind debugge
 }
 
 func execute(attachPid int, processArgs []string, conf *config.Config, coreFile string, kind debugger.ExecuteKind, dlvArgs []string, buildFlags string) int {
-	if err := logflags.Setup(log, logOutput, logDest); err != nil {
+	if err := logflags.Setup(log, logOutput, logDest, logFormat); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return 1
 	}
 	defer logflags.Close()
 
+	if err := loadFlavorPlugins(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
 	if headless && (initFile != "") {
 		fmt.Fprint(os.Stderr, "Warning: init file ignored with --headless\n")
 	}
+
+	switch onDisconnect {
+	case "":
+	case "stop", "continue":
+		if !headless {
+			fmt.Fprint(os.Stderr, "Error: --on-disconnect only works with --headless\n")
+			return 1
+		}
+		acceptMulti = true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown --on-disconnect value %q, must be \"stop\" or \"continue\"\n", onDisconnect)
+		return 1
+	}
+
 	if continueOnStart {
 		if !headless {
 			fmt.Fprint(os.Stderr, "Error: --continue only works with --headless; use an init file\n")
@@ -763,6 +1855,26 @@ func execute(attachPid int, processArgs []string, conf *config.Config, coreFile
 		}
 	}
 
+	if connectAddr != "" {
+		if !headless {
+			fmt.Fprint(os.Stderr, "Error: --connect only works with --headless\n")
+			return 1
+		}
+		if continueOnStart {
+			fmt.Fprint(os.Stderr, "Error: --continue can not be used with --connect\n")
+			return 1
+		}
+		if dialToken() == "" {
+			fmt.Fprint(os.Stderr, "Error: --connect requires a token, set with --connect-token or DELVE_CONNECT_TOKEN\n")
+			return 1
+		}
+	}
+
+	if !headless && metricsAddr != "" {
+		fmt.Fprint(os.Stderr, "Error: --metrics-addr only works with --headless\n")
+		return 1
+	}
+
 	if !headless && acceptMulti {
 		fmt.Fprint(os.Stderr, "Warning accept-multi: ignored\n")
 		// acceptMulti won't work in normal (non-headless) mode because we always
@@ -789,18 +1901,33 @@ func execute(attachPid int, processArgs []string, conf *config.Config, coreFile
 		fmt.Fprintf(os.Stderr, "Can not use -r and --tty together\n")
 		return 1
 	}
+	if allocatePTY && (len(redirects) > 0 || tty != "") {
+		fmt.Fprintf(os.Stderr, "Can not use --pty with -r or --tty\n")
+		return 1
+	}
 
 	redirects, err := parseRedirects(redirects)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return 1
 	}
+	sandbox, err := parseSandbox()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	var watch []string
+	if watchSources {
+		watch = watchDirs(dlvArgs)
+	}
 
 	var listener net.Listener
 	var clientConn net.Conn
 
 	// Make a TCP listener
-	if headless {
+	if headless && connectAddr != "" {
+		listener = service.DialListener(connectAddr, dialToken())
+	} else if headless {
 		listener, err = net.Listen("tcp", addr)
 	} else {
 		listener, clientConn = service.ListenerPipe()
@@ -819,29 +1946,63 @@ func execute(attachPid int, processArgs []string, conf *config.Config, coreFile
 		workingDir = "."
 	}
 
+	auditLog, err := openAuditLog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer auditLog.Close()
+
+	if allowTracepoints && !readOnly {
+		fmt.Fprint(os.Stderr, "Error: --allow-tracepoints requires --read-only\n")
+		return 1
+	}
+
 	// Create and start a debugger server
 	switch apiVersion {
-	case 1, 2:
+	case 1, 2, 3:
 		server = rpccommon.NewServer(&service.Config{
 			Listener:           listener,
 			ProcessArgs:        processArgs,
 			AcceptMulti:        acceptMulti,
+			OnDisconnect:       onDisconnect,
 			APIVersion:         apiVersion,
 			CheckLocalConnUser: checkLocalConnUser,
 			DisconnectChan:     disconnectChan,
+			MetricsAddr:        metricsAddr,
+			AuditLog:           auditLog,
 			Debugger: debugger.Config{
 				AttachPid:            attachPid,
+				AttachName:           attachName,
+				Reattach:             attachReattach,
 				WorkingDir:           workingDir,
 				Backend:              backend,
 				CoreFile:             coreFile,
-				Foreground:           headless && tty == "",
+				Foreground:           headless && tty == "" && !allocatePTY,
 				Packages:             dlvArgs,
 				BuildFlags:           buildFlags,
 				ExecuteKind:          kind,
 				DebugInfoDirectories: conf.DebugInfoDirectories,
+				FrameFilters:         conf.FrameFilters,
 				CheckGoVersion:       checkGoVersion,
 				TTY:                  tty,
 				Redirects:            redirects,
+				PTY:                  allocatePTY,
+				StreamOutput:         streamOutput,
+				Sandbox:              sandbox,
+				StopOnExit:           stopOnExit,
+				CrashReport:          crashReport,
+				ReadOnly:             readOnly,
+				AllowTracepoints:     allowTracepoints,
+				StubAddr:             stubAddr,
+				Flavor:               flavor,
+				Subtest:              testSubtest,
+				Fuzz:                 fuzzTarget,
+				Watch:                watch,
+				WatchDebounce:        watchDebounce,
+				StopTimeAlarm:        stopTimeAlarm,
+				CompileConditions:    compileConditions,
+				FollowExec:           followExec,
 			},
 		})
 	default:
@@ -884,6 +2045,77 @@ func execute(attachPid int, processArgs []string, conf *config.Config, coreFile
 	return connect(listener.Addr().String(), clientConn, conf, kind)
 }
 
+// addOutputFlags adds the flags streaming the output of the launched
+// process to clients to cmd.
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&allocatePTY, "pty", false, "Allocates a pseudo-terminal for the target program and sends its output to clients (see 'dlv help redirect').")
+	cmd.Flags().BoolVar(&streamOutput, "stream-output", false, "Sends the standard output and error of the target program to clients instead of writing them to the output of Delve (see 'dlv help redirect').")
+}
+
+// addWatchFlags adds the flags rebuilding and restarting the target when
+// its source files change to cmd.
+func addWatchFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&watchSources, "watch", false, "Rebuilds and restarts the target program, keeping the breakpoints, when the source files of its packages change. If the program is running the new one is continued.")
+	cmd.Flags().DurationVar(&watchDebounce, "watch-debounce", debugger.DefaultWatchDebounce, "With --watch, how long the source files must stay unchanged before the program is rebuilt.")
+}
+
+// watchDirs returns the directories of the source files of pkgs, the
+// current directory if there are none.
+func watchDirs(pkgs []string) []string {
+	if len(pkgs) == 0 {
+		pkgs = []string{"."}
+	}
+	dirs := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		dirs = append(dirs, getPackageDir(pkg))
+	}
+	return dirs
+}
+
+// addSandboxFlags adds the flags restricting the environment, the resources
+// and the privileges of the launched process to cmd.
+func addSandboxFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&sandboxEnv, "env", nil, "Adds a variable, as NAME=VALUE, to the environment of the target program, overriding the inherited one.")
+	cmd.Flags().StringVar(&sandboxEnvMode, "env-mode", string(proc.EnvInherit), "Variables of the environment of Delve inherited by the target program: inherit (all of them), clear (none) or allowlist (the ones specified with --env-allow).")
+	cmd.Flags().StringArrayVar(&sandboxEnvAllow, "env-allow", nil, "Name of a variable inherited by the target program with --env-mode=allowlist.")
+	cmd.Flags().StringArrayVar(&sandboxRlimits, "rlimit", nil, "Resource limit of the target program, as resource=soft[:hard], for example nofile=1024 or core=unlimited (Linux only).")
+	cmd.Flags().StringVar(&sandboxUser, "user", "", "User, name or ID, the target program runs as (Linux only, requires the privileges to change user).")
+	cmd.Flags().StringVar(&sandboxGroup, "group", "", "Group, name or ID, the target program runs as, the primary group of --user by default (Linux only).")
+	cmd.Flags().StringSliceVar(&sandboxUnshare, "unshare", nil, "Comma separated list of namespaces created for the target program: cgroup, ipc, mount, net, pid, user or uts (Linux only).")
+}
+
+// parseSandbox returns the sandbox specified by the flags added by
+// addSandboxFlags, nil if it is empty.
+func parseSandbox() (*proc.Sandbox, error) {
+	sandbox := &proc.Sandbox{
+		EnvMode:    proc.EnvMode(sandboxEnvMode),
+		EnvAllow:   sandboxEnvAllow,
+		Env:        sandboxEnv,
+		User:       sandboxUser,
+		Group:      sandboxGroup,
+		Namespaces: sandboxUnshare,
+	}
+	switch sandbox.EnvMode {
+	case "", proc.EnvInherit, proc.EnvClear, proc.EnvAllowlist:
+	default:
+		return nil, fmt.Errorf("invalid --env-mode %q", sandboxEnvMode)
+	}
+	if len(sandboxEnvAllow) > 0 && sandbox.EnvMode != proc.EnvAllowlist {
+		return nil, errors.New("--env-allow requires --env-mode=allowlist")
+	}
+	for _, s := range sandboxRlimits {
+		r, err := proc.ParseRlimit(s)
+		if err != nil {
+			return nil, err
+		}
+		sandbox.Rlimits = append(sandbox.Rlimits, r)
+	}
+	if sandbox.Empty() {
+		return nil, nil
+	}
+	return sandbox, nil
+}
+
 func parseRedirects(redirects []string) ([3]string, error) {
 	r := [3]string{}
 	names := [3]string{"stdin", "stdout", "stderr"}
@@ -904,3 +2136,27 @@ func parseRedirects(redirects []string) ([3]string, error) {
 	}
 	return r, nil
 }
+
+// loadFlavorPlugins loads the Go plugins requested with --flavor-plugin,
+// which register their flavors when they are initialized.
+func loadFlavorPlugins() error {
+	for _, path := range flavorPlugins {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("could not load flavor plugin %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// openAuditLog opens the audit log requested with --audit-log, it returns
+// nil if there is none.
+func openAuditLog() (*audit.Log, error) {
+	if auditLogPath == "" {
+		return nil, nil
+	}
+	l, err := audit.Open(auditLogPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log: %v", err)
+	}
+	return l, nil
+}
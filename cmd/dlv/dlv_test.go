@@ -21,6 +21,7 @@ import (
 
 	protest "github.com/go-delve/delve/pkg/proc/test"
 	"github.com/go-delve/delve/pkg/terminal"
+	"github.com/go-delve/delve/service/api"
 	"github.com/go-delve/delve/service/dap/daptest"
 	"github.com/go-delve/delve/service/rpc2"
 	"golang.org/x/tools/go/packages"
@@ -489,7 +490,7 @@ func TestTypecheckRPC(t *testing.T) {
 		case "Continue", "Rewind":
 			// wrappers over continueDir
 			continue
-		case "SetReturnValuesLoadConfig", "Disconnect":
+		case "SetReturnValuesLoadConfig", "SetStepSkipPackages", "Disconnect":
 			// support functions
 			continue
 		}
@@ -628,6 +629,34 @@ func TestTrace(t *testing.T) {
 	cmd.Wait()
 }
 
+func TestTraceLine(t *testing.T) {
+	dlvbin, tmpdir := getDlvBin(t)
+	defer os.RemoveAll(tmpdir)
+
+	fixtures := protest.FindFixturesDir()
+	cmd := exec.Command(dlvbin, "trace", "--output", filepath.Join(tmpdir, "__debug"), filepath.Join(fixtures, "issue573.go"), "issue573.go:19")
+	rdr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Dir = filepath.Join(fixtures, "buildtest")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("error running trace: %v", err)
+	}
+	output, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(output, []byte("> goroutine(1): main.foo(99, 9801) ")) || !bytes.Contains(output, []byte("issue573.go:19")) {
+		t.Fatalf("wrong output for line tracepoint:\n%s", string(output))
+	}
+	if bytes.Contains(output, []byte("=> (9900)")) {
+		t.Fatalf("line tracepoint should not report return values:\n%s", string(output))
+	}
+	cmd.Wait()
+}
+
 func TestTracePid(t *testing.T) {
 	if runtime.GOOS == "linux" {
 		bs, _ := ioutil.ReadFile("/proc/sys/kernel/yama/ptrace_scope")
@@ -748,3 +777,70 @@ func TestDlvTestChdir(t *testing.T) {
 		t.Errorf("output did not contain expected string %q", tgt)
 	}
 }
+
+func TestFollowExec(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only supported on linux")
+	}
+	const listenAddr = "127.0.0.1:40574"
+
+	dlvbin, tmpdir := getDlvBin(t)
+	defer os.RemoveAll(tmpdir)
+
+	fixture := protest.BuildFixture("followexec", 0)
+	cmd := exec.Command(dlvbin, "exec", fixture.Path, "--headless", "--accept-multiclient", "--api-version=2", "--listen", listenAddr, "--follow-exec")
+	stdout, err := cmd.StdoutPipe()
+	assertNoError(err, t, "stdout pipe")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("could not start headless instance: %v", err)
+	}
+	scan := bufio.NewScanner(stdout)
+	for scan.Scan() {
+		t.Log(scan.Text())
+		if strings.HasPrefix(scan.Text(), "API server listening at:") {
+			break
+		}
+	}
+	go io.Copy(ioutil.Discard, stdout)
+
+	client := rpc2.NewClient(listenAddr)
+	defer cmd.Wait()
+	defer func() {
+		client.Halt()
+		client.Detach(true)
+	}()
+	_, err = client.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.child", Line: 1})
+	assertNoError(err, t, "CreateBreakpoint()")
+	// the target waits for the child, stopped at the breakpoint
+	client.Continue()
+
+	var child api.Target
+	for start := time.Now(); child.Addr == "" || child.Running; {
+		if time.Since(start) > 30*time.Second {
+			t.Fatalf("the child process did not stop: %#v", child)
+		}
+		time.Sleep(100 * time.Millisecond)
+		tgts, err := client.ListTargets()
+		assertNoError(err, t, "ListTargets()")
+		if !tgts[0].Running {
+			t.Fatalf("the target is not running: %#v", tgts[0])
+		}
+		if len(tgts) > 1 {
+			child = tgts[1]
+		}
+		if child.Err != "" || child.Exited {
+			t.Fatalf("the child process can not be debugged: %#v", child)
+		}
+	}
+	if child.Path != fixture.Path {
+		t.Errorf("wrong executable of the child process: %s", child.Path)
+	}
+
+	childClient := rpc2.NewClient(child.Addr)
+	state, err := childClient.GetState()
+	assertNoError(err, t, "GetState()")
+	if state.CurrentThread == nil || state.CurrentThread.Function == nil || state.CurrentThread.Function.Name() != "main.child" {
+		t.Fatalf("the child process is not stopped in main.child: %#v", state.CurrentThread)
+	}
+	assertNoError(childClient.Disconnect(false), t, "Disconnect()")
+}
@@ -0,0 +1,300 @@
+// Package agent starts, on demand, a headless instance of Delve attached to
+// the current process, so that a service can be debugged without attaching
+// Delve to it by hand (for example without access to the machine or to the
+// container running it).
+//
+// The package is typically imported only for its side effect of
+// registering its HTTP handlers, like net/http/pprof:
+//
+//	import _ "github.com/go-delve/delve/pkg/agent"
+//
+// The handlers, served at /debug/delve/ by http.DefaultServeMux, start the
+// headless instance of Delve with a POST request and stop it with a DELETE
+// request, a GET request returns its address:
+//
+//	curl -X POST http://localhost:6060/debug/delve/
+//	dlv connect 127.0.0.1:38123
+//
+// Alternatively Notify starts it when the process receives a signal.
+//
+// A process cannot debug itself, the headless instance of Delve is a child
+// process, running the dlv executable found in PATH, that attaches to the
+// current process and resumes it. It accepts multiple clients, one after
+// the other, until it is stopped: stopping it detaches it from the process,
+// which keeps running.
+//
+// Anybody who can connect to the headless instance of Delve can read and
+// change the memory of the process, and execute arbitrary code in it: the
+// handlers must not be reachable by untrusted clients and the headless
+// instance of Delve listens on the loopback interface by default.
+package agent
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-delve/delve/service/rpc2"
+)
+
+func init() {
+	http.HandleFunc("/debug/delve/", Handler)
+}
+
+// Options configures the headless instance of Delve.
+type Options struct {
+	// Dlv is the path of the dlv executable, the one found in PATH if empty.
+	Dlv string
+	// Addr is the address the headless instance of Delve listens at,
+	// 127.0.0.1:0 if empty.
+	Addr string
+	// Args are additional arguments of dlv attach, for example "--log".
+	Args []string
+	// Output receives the output of the headless instance of Delve,
+	// os.Stderr if nil.
+	Output io.Writer
+}
+
+// DefaultOptions are the options used by Handler and Notify.
+var DefaultOptions Options
+
+// startTimeout is how long Start waits for the headless instance of Delve
+// to start listening.
+var startTimeout = 30 * time.Second
+
+// ErrNotRunning is returned by Stop when the headless instance of Delve is
+// not running.
+var ErrNotRunning = errors.New("delve is not running")
+
+var (
+	mu      sync.Mutex
+	running *server
+)
+
+type server struct {
+	cmd  *exec.Cmd
+	addr string
+	// done is closed when the headless instance of Delve exits.
+	done chan struct{}
+}
+
+// exited returns true if the headless instance of Delve exited.
+func (s *server) exited() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// current returns the headless instance of Delve that is running, or nil.
+// Must be called with mu held.
+func current() *server {
+	if running != nil && running.exited() {
+		running = nil
+	}
+	return running
+}
+
+// Addr returns the address of the headless instance of Delve, or the empty
+// string if it is not running.
+func Addr() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if s := current(); s != nil {
+		return s.addr
+	}
+	return ""
+}
+
+// Start starts a headless instance of Delve attached to the current process
+// and returns its address, once it is listening. If it is already running
+// Start returns its address.
+func Start(opts *Options) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if s := current(); s != nil {
+		return s.addr, nil
+	}
+	if opts == nil {
+		opts = &DefaultOptions
+	}
+
+	dlv := opts.Dlv
+	if dlv == "" {
+		var err error
+		if dlv, err = exec.LookPath("dlv"); err != nil {
+			return "", err
+		}
+	}
+	addr := opts.Addr
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	var output io.Writer = &lockedWriter{w: opts.Output}
+	if opts.Output == nil {
+		output = os.Stderr
+	}
+
+	args := []string{"attach", strconv.Itoa(os.Getpid())}
+	if exe, err := os.Executable(); err == nil {
+		args = append(args, exe)
+	}
+	args = append(args, "--headless", "--accept-multiclient", "--api-version=2", "--continue", "--listen="+addr)
+	args = append(args, opts.Args...)
+
+	cmd := exec.Command(dlv, args...)
+	cmd.Stderr = output
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	// Removes the restrictions that would prevent the child process from
+	// attaching to its parent.
+	if err := allowPtrace(cmd.Process.Pid); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return "", fmt.Errorf("could not allow delve to attach: %v", err)
+	}
+
+	s := &server{cmd: cmd, done: make(chan struct{})}
+	addrch := make(chan string, 1)
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		const prefix = "API server listening at: "
+		scan := bufio.NewScanner(stdout)
+		for scan.Scan() {
+			line := scan.Text()
+			if strings.HasPrefix(line, prefix) {
+				addrch <- strings.TrimSpace(line[len(prefix):])
+				break
+			}
+			fmt.Fprintln(output, line)
+		}
+		close(addrch)
+		// The output is copied by a goroutine of the debugged process, which
+		// is stopped with it: a headless instance of Delve only writes the
+		// message above to its standard output, the rest is discarded.
+		io.Copy(ioutil.Discard, stdout)
+	}()
+	go func() {
+		// Wait closes stdout, it must not be called before the output is
+		// read. It does not take mu: Start waits for done holding it.
+		<-copied
+		cmd.Wait()
+		close(s.done)
+	}()
+
+	select {
+	case addr, ok := <-addrch:
+		if !ok {
+			<-s.done
+			return "", errors.New("delve exited before listening")
+		}
+		s.addr = addr
+	case <-time.After(startTimeout):
+		cmd.Process.Kill()
+		<-s.done
+		return "", errors.New("timed out waiting for delve to listen")
+	}
+	running = s
+	return s.addr, nil
+}
+
+// lockedWriter serializes the writes of the standard output and standard
+// error of the headless instance of Delve, copied by different goroutines.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// Stop detaches the headless instance of Delve from the current process and
+// waits for it to exit. The connected clients are disconnected.
+func Stop() error {
+	mu.Lock()
+	s := current()
+	mu.Unlock()
+	if s == nil {
+		return ErrNotRunning
+	}
+	conn, err := net.Dial("tcp", s.addr)
+	if err != nil {
+		s.cmd.Process.Kill()
+		<-s.done
+		return err
+	}
+	client := rpc2.NewClientFromConn(conn)
+	// The process is running, it must be stopped before detaching.
+	client.Halt()
+	err = client.Detach(false)
+	<-s.done
+	return err
+}
+
+// Notify starts the headless instance of Delve, with DefaultOptions, every
+// time the current process receives one of the specified signals (for
+// example syscall.SIGUSR1) and writes its address to standard error.
+func Notify(sig ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	go func() {
+		for range ch {
+			addr, err := Start(nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not start delve: %v\n", err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "delve listening at: %s\n", addr)
+		}
+	}()
+}
+
+// Handler serves the requests starting (POST), stopping (DELETE) and
+// returning the address (GET) of the headless instance of Delve, started
+// with DefaultOptions. The address is returned as plain text, the body of
+// the response is empty if it is not running.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if addr := Addr(); addr != "" {
+			fmt.Fprintln(w, addr)
+		}
+	case http.MethodPost:
+		addr, err := Start(nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, addr)
+	case http.MethodDelete:
+		if err := Stop(); err != nil && err != ErrNotRunning {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,15 @@
+package agent
+
+import "golang.org/x/sys/unix"
+
+// allowPtrace allows the process pid to attach to the current process when
+// the Yama security module only allows processes to attach to their
+// descendants (kernel.yama.ptrace_scope = 1).
+func allowPtrace(pid int) error {
+	err := unix.Prctl(unix.PR_SET_PTRACER, uintptr(pid), 0, 0, 0)
+	if err == unix.EINVAL {
+		// Yama is not enabled.
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDlvEnv is the environment variable telling the test binary to behave
+// like a fake dlv executable, see TestMain.
+const fakeDlvEnv = "DELVE_AGENT_FAKE_DLV"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(fakeDlvEnv) {
+	case "":
+		os.Exit(m.Run())
+	case "exit":
+		fmt.Println("could not attach")
+		os.Exit(1)
+	case "hang":
+		time.Sleep(time.Hour)
+	case "listen":
+		fmt.Println("API server listening at: 127.0.0.1:1")
+		time.Sleep(time.Hour)
+	}
+	os.Exit(2)
+}
+
+// fakeDlv returns the options running the test binary as a fake dlv
+// executable with the specified behavior.
+func fakeDlv(behavior string) *Options {
+	os.Setenv(fakeDlvEnv, behavior)
+	return &Options{Dlv: os.Args[0], Output: new(bytes.Buffer)}
+}
+
+// start calls Start failing the test if it does not return in time.
+func start(t *testing.T, opts *Options) (string, error) {
+	type result struct {
+		addr string
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		addr, err := Start(opts)
+		ch <- result{addr, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.addr, r.err
+	case <-time.After(10 * time.Second):
+		t.Fatal("Start did not return")
+		return "", nil
+	}
+}
+
+func TestStartExited(t *testing.T) {
+	opts := fakeDlv("exit")
+	defer os.Unsetenv(fakeDlvEnv)
+	_, err := start(t, opts)
+	if err == nil || err.Error() != "delve exited before listening" {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if out := opts.Output.(*bytes.Buffer).String(); !strings.Contains(out, "could not attach") {
+		t.Errorf("output of delve not copied: %q", out)
+	}
+	if addr := Addr(); addr != "" {
+		t.Errorf("delve running at %q", addr)
+	}
+	// The failure must not leave the lock held.
+	if err := Stop(); err != ErrNotRunning {
+		t.Errorf("wrong error stopping delve: %v", err)
+	}
+}
+
+func TestStartTimeout(t *testing.T) {
+	old := startTimeout
+	startTimeout = 100 * time.Millisecond
+	defer func() { startTimeout = old }()
+
+	defer os.Unsetenv(fakeDlvEnv)
+	_, err := start(t, fakeDlv("hang"))
+	if err == nil || err.Error() != "timed out waiting for delve to listen" {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if addr := Addr(); addr != "" {
+		t.Errorf("delve running at %q", addr)
+	}
+}
+
+func TestStartListening(t *testing.T) {
+	opts := fakeDlv("listen")
+	defer os.Unsetenv(fakeDlvEnv)
+	addr, err := start(t, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "127.0.0.1:1" {
+		t.Fatalf("wrong address %q", addr)
+	}
+	if addr2, err := start(t, opts); err != nil || addr2 != addr {
+		t.Errorf("Start of a running delve returned %q, %v", addr2, err)
+	}
+	if got := Addr(); got != addr {
+		t.Errorf("Addr returned %q", got)
+	}
+	// Nothing listens at the address, Stop kills the fake delve.
+	if err := Stop(); err == nil {
+		t.Error("no error stopping delve")
+	}
+	if got := Addr(); got != "" {
+		t.Errorf("delve running at %q after Stop", got)
+	}
+}
@@ -24,6 +24,10 @@ type SubstitutePathRule struct {
 	From string
 	// Path to which substitution is performed.
 	To string
+	// If Regex is true `From` is a regular expression, the first match is
+	// replaced with `To`, which can refer to the submatches of `From` as
+	// $1, $2, etc.
+	Regex bool `yaml:"regex,omitempty"`
 }
 
 // SubstitutePathRules is a slice of source code path substitution rules.
@@ -64,6 +68,45 @@ type Config struct {
 	// DebugFileDirectories is the list of directories Delve will use
 	// in order to resolve external debug info files.
 	DebugInfoDirectories []string `yaml:"debug-info-directories"`
+
+	// RuntimeDescriptors is the list of JSON files describing the
+	// structures of the runtime of versions of Go that Delve does not know
+	// about, see proc.RuntimeDescriptor.
+	RuntimeDescriptors []string `yaml:"runtime-descriptors,omitempty"`
+
+	// Flavors are the flavors, selected with --flavor, that read the
+	// threads of interest of the target from a linked list.
+	Flavors []FlavorConfig `yaml:"flavors,omitempty"`
+
+	// If StepSkipRuntime is true step will not stop inside the runtime and
+	// reflect packages, see StepSkipPackages.
+	StepSkipRuntime bool `yaml:"step-instructions-skip-runtime"`
+	// StepSkipPackages is the list of packages that step will not stop in,
+	// step will continue to the first frame that doesn't belong to them.
+	StepSkipPackages []string `yaml:"step-skip-packages,omitempty"`
+
+	// FrameFilters are patterns of packages and files whose frames are hidden
+	// from stacktraces, see debugger.Config.FrameFilters.
+	FrameFilters []string `yaml:"frame-filters,omitempty"`
+}
+
+// RuntimePackages are the packages skipped by step when StepSkipRuntime
+// is set.
+var RuntimePackages = []string{"runtime", "reflect"}
+
+// FlavorConfig describes a flavor that reads the threads of interest of
+// the target from a linked list, see proc.ListFlavor.
+type FlavorConfig struct {
+	Name       string `yaml:"name"`
+	Head       string `yaml:"head"`
+	Current    string `yaml:"current"`
+	Next       string `yaml:"next"`
+	ID         string `yaml:"id"`
+	ThreadName string `yaml:"thread-name"`
+	PC         string `yaml:"pc"`
+	SP         string `yaml:"sp"`
+	BP         string `yaml:"bp"`
+	PCOffset   int64  `yaml:"pc-offset"`
 }
 
 func (c *Config) GetSourceListLineCount() int {
@@ -75,6 +118,14 @@ func (c *Config) GetSourceListLineCount() int {
 	return n
 }
 
+// GetStepSkipPackages returns the packages that step should not stop in.
+func (c *Config) GetStepSkipPackages() []string {
+	if !c.StepSkipRuntime {
+		return c.StepSkipPackages
+	}
+	return append(append([]string{}, RuntimePackages...), c.StepSkipPackages...)
+}
+
 // LoadConfig attempts to populate a Config object from the config.yml file.
 func LoadConfig() *Config {
 	err := createConfigPath()
@@ -230,8 +281,12 @@ aliases:
 # between compilation and debugging.
 # Note that substitution rules will not be used for paths passed to "break" and "trace"
 # commands.
+# With regex: true, from is a regular expression and to can refer to its submatches.
+# Paths inside the module cache or GOPATH of the build machine are mapped to the local
+# module cache or GOPATH automatically.
 substitute-path:
   # - {from: path, to: path}
+  # - {from: "^/build/([^/]+)/", to: "/home/me/src/$1/", regex: true}
   
 # Maximum number of elements loaded from an array.
 # max-array-values: 64
@@ -250,6 +305,34 @@ substitute-path:
 
 # List of directories to use when searching for separate debug info files.
 debug-info-directories: ["/usr/lib/debug/.build-id"]
+
+# List of JSON files describing the fields of the structures of the runtime
+# read by Delve, for versions of Go that rename them.
+# runtime-descriptors: ["/path/to/go1.99.json"]
+
+# Flavors read the threads of interest of targets that do not use
+# goroutines from a linked list, select one with --flavor.
+# flavors:
+#   - name: rtos
+#     head: "tasks.head"
+#     current: "tasks.current"
+#     next: "next"
+#     id: "id"
+#     thread-name: "name"
+#     sp: "savedSP"
+#     pc-offset: 0
+
+# Uncomment the following line to make step never stop inside the runtime and
+# reflect packages.
+# step-instructions-skip-runtime: true
+
+# List of additional packages that step should not stop in.
+# step-skip-packages: ["sort", "github.com/sirupsen/logrus"]
+
+# Frames of the packages and files matching these patterns are hidden from
+# stack traces, use stack -hidden to show them. Patterns containing *, ? or [
+# match file names, the others match import paths where ... matches any string.
+# frame-filters: [".../vendor/...", "*.pb.go"]
 `)
 	return err
 }
@@ -0,0 +1,422 @@
+// Package debugger is the supported API to use Delve as a library.
+//
+// A Session debugs one target: a process started with Launch, a process
+// attached with Attach or a core file opened with OpenCore. Its methods
+// set breakpoints, resume the target, evaluate expressions and read the
+// stacks of its goroutines, and Subscribe reports the changes of the
+// state of the target.
+//
+// # Compatibility
+//
+// Unlike the other packages of Delve, which change whenever Delve needs
+// them to, this package follows semantic versioning: once a function, a
+// type, a method or a field is part of a release of Delve it is neither
+// removed nor changed incompatibly until the next major version. New
+// functions, types, methods and fields can be added by any release, use
+// keyed struct literals for the types of the package so that they keep
+// compiling when fields are added.
+//
+// The types of the package are its own, converted from the ones of the
+// JSON-RPC API of Delve (package github.com/go-delve/delve/service/api),
+// so that changes to the API do not break programs using this package.
+//
+// A Session is safe for concurrent use, but the methods that resume the
+// target block until it stops again: Halt can be called from a different
+// goroutine to stop it.
+package debugger
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/debugger"
+)
+
+// DefaultLoadConfig is the LoadConfig used when none is specified: it
+// follows pointers and reads strings of up to 64 bytes, 64 elements of
+// arrays, slices and maps and every field of structs.
+var DefaultLoadConfig = LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1}
+
+// ErrSessionClosed is returned by the methods of a Session after Detach.
+var ErrSessionClosed = errors.New("the debugging session is closed")
+
+// Config configures a Session.
+type Config struct {
+	// WorkingDir is the working directory of the processes started by
+	// Launch, the current directory if empty.
+	WorkingDir string
+	// Backend is the backend used to start or attach processes, see 'dlv
+	// help backend'. The empty string selects the default backend.
+	Backend string
+	// DebugInfoDirectories are the directories searched for separate debug
+	// information files.
+	DebugInfoDirectories []string
+	// CheckGoVersion rejects the programs built with versions of Go that
+	// this version of Delve does not support.
+	CheckGoVersion bool
+	// Redirects are the files used as standard input, output and error by
+	// the processes started by Launch, empty strings keep the ones of the
+	// current process.
+	Redirects [3]string
+}
+
+// EventKind is the kind of an Event.
+type EventKind string
+
+const (
+	// EventRunning is reported when the target is resumed.
+	EventRunning EventKind = "running"
+	// EventStopped is reported when the target stops.
+	EventStopped EventKind = "stopped"
+	// EventExited is reported when the target exits.
+	EventExited EventKind = "exited"
+)
+
+// Event is a change of the state of the target.
+type Event struct {
+	Kind EventKind
+	// Command is the command that resumed the target, for example
+	// "continue" or "next".
+	Command string
+	// State is the state of the target after a stopped or exited event.
+	State *State
+	// Err is the error returned by the command, if any.
+	Err error
+}
+
+// Session is a debugging session of a target.
+type Session struct {
+	d *debugger.Debugger
+
+	mu          sync.Mutex
+	closed      bool
+	subscribers map[int]func(Event)
+	nextSubID   int
+}
+
+// Launch starts the executable at path, with the specified arguments, and
+// returns a session debugging it. The process is stopped before executing
+// any instruction of the program.
+func Launch(cfg *Config, path string, args ...string) (*Session, error) {
+	return newSession(cfg, func(dcfg *debugger.Config) {}, append([]string{path}, args...))
+}
+
+// Attach attaches to the process pid, whose executable is at path (which
+// can be empty for most backends), and returns a session debugging it.
+func Attach(cfg *Config, pid int, path string) (*Session, error) {
+	var args []string
+	if path != "" {
+		args = []string{path}
+	}
+	return newSession(cfg, func(dcfg *debugger.Config) { dcfg.AttachPid = pid }, args)
+}
+
+// OpenCore opens the core file at core, of the executable at path, and
+// returns a session debugging it.
+func OpenCore(cfg *Config, path, core string) (*Session, error) {
+	return newSession(cfg, func(dcfg *debugger.Config) { dcfg.CoreFile = core }, []string{path})
+}
+
+func newSession(cfg *Config, setup func(*debugger.Config), args []string) (*Session, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	dcfg := &debugger.Config{
+		WorkingDir:           cfg.WorkingDir,
+		Backend:              cfg.Backend,
+		DebugInfoDirectories: cfg.DebugInfoDirectories,
+		CheckGoVersion:       cfg.CheckGoVersion,
+		Redirects:            cfg.Redirects,
+		ExecuteKind:          debugger.ExecutingExistingFile,
+	}
+	if dcfg.Backend == "" {
+		dcfg.Backend = "default"
+	}
+	setup(dcfg)
+	d, err := debugger.New(dcfg, args)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{d: d, subscribers: make(map[int]func(Event))}, nil
+}
+
+// Subscribe calls fn for every change of the state of the target, until
+// the returned function is called. Fn is called synchronously by the
+// goroutine that resumed the target and must not call the methods of the
+// session that resume it.
+func (s *Session) Subscribe(fn func(Event)) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextSubID
+	s.nextSubID++
+	s.subscribers[id] = fn
+	return func() {
+		s.mu.Lock()
+		delete(s.subscribers, id)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Session) publish(e Event) {
+	s.mu.Lock()
+	fns := make([]func(Event), 0, len(s.subscribers))
+	for _, fn := range s.subscribers {
+		fns = append(fns, fn)
+	}
+	s.mu.Unlock()
+	for _, fn := range fns {
+		fn(e)
+	}
+}
+
+func (s *Session) check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSessionClosed
+	}
+	return nil
+}
+
+// State returns the state of the target, without waiting for it to stop
+// if it is running.
+func (s *Session) State() (*State, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	state, err := s.d.State(true)
+	return convertState(state), err
+}
+
+// command executes cmd, which resumes the target, and returns the state of
+// the target once it stops.
+func (s *Session) command(cmd *api.DebuggerCommand) (*State, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	s.publish(Event{Kind: EventRunning, Command: cmd.Name})
+	apiState, err := s.d.Command(cmd)
+	state := convertState(apiState)
+	e := Event{Kind: EventStopped, Command: cmd.Name, State: state, Err: err}
+	if state != nil && state.Exited {
+		e.Kind = EventExited
+	}
+	s.publish(e)
+	return state, err
+}
+
+// Continue resumes the target until it stops at a breakpoint, exits or is
+// stopped by Halt.
+func (s *Session) Continue() (*State, error) {
+	return s.command(&api.DebuggerCommand{Name: api.Continue})
+}
+
+// Next resumes the selected goroutine until the next source line of the
+// current function.
+func (s *Session) Next() (*State, error) {
+	return s.command(&api.DebuggerCommand{Name: api.Next})
+}
+
+// Step resumes the selected goroutine until the next source line, entering
+// function calls.
+func (s *Session) Step() (*State, error) {
+	return s.command(&api.DebuggerCommand{Name: api.Step})
+}
+
+// StepOut resumes the selected goroutine until the current function
+// returns.
+func (s *Session) StepOut() (*State, error) {
+	return s.command(&api.DebuggerCommand{Name: api.StepOut})
+}
+
+// Halt stops the target if it is running, the method that resumed it then
+// returns.
+func (s *Session) Halt() (*State, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	state, err := s.d.Command(&api.DebuggerCommand{Name: api.Halt})
+	return convertState(state), err
+}
+
+// SwitchGoroutine selects the goroutine with the specified ID, used by
+// Next, Step and StepOut.
+func (s *Session) SwitchGoroutine(goroutineID int) (*State, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	state, err := s.d.Command(&api.DebuggerCommand{Name: api.SwitchGoroutine, GoroutineID: goroutineID})
+	return convertState(state), err
+}
+
+// SetBreakpoint sets a breakpoint at location, a location specifier as
+// accepted by the break command of the terminal (see 'help break'), for
+// example "main.main", "file.go:42" or "*0x4a1b2c".
+func (s *Session) SetBreakpoint(location string) (*Breakpoint, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	locs, err := s.d.FindLocation(api.EvalScope{GoroutineID: -1}, location, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(locs) != 1 {
+		return nil, errors.New("the location specifier matches more than one location")
+	}
+	bp, err := s.d.CreateBreakpoint(&api.Breakpoint{Addr: locs[0].PC, Addrs: locs[0].PCs})
+	return convertBreakpoint(bp), err
+}
+
+// CreateBreakpoint creates the breakpoint described by bp, which must
+// specify one of FunctionName, File and Line or Addr, and can specify a
+// condition, a name and the expressions evaluated when it is hit.
+func (s *Session) CreateBreakpoint(bp *Breakpoint) (*Breakpoint, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	created, err := s.d.CreateBreakpoint(bp.toAPI())
+	return convertBreakpoint(created), err
+}
+
+// ClearBreakpoint deletes the breakpoint with the specified ID.
+func (s *Session) ClearBreakpoint(id int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	bp := s.d.FindBreakpoint(id)
+	if bp == nil {
+		return errors.New("no such breakpoint")
+	}
+	_, err := s.d.ClearBreakpoint(bp)
+	return err
+}
+
+// Breakpoints returns the breakpoints of the target.
+func (s *Session) Breakpoints() ([]*Breakpoint, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	bps := s.d.Breakpoints()
+	r := make([]*Breakpoint, len(bps))
+	for i := range bps {
+		r[i] = convertBreakpoint(bps[i])
+	}
+	return r, nil
+}
+
+// Threads returns the threads of the target.
+func (s *Session) Threads() ([]*Thread, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	threads, err := s.d.Threads()
+	if err != nil {
+		return nil, err
+	}
+	r := make([]*Thread, len(threads))
+	for i := range threads {
+		r[i] = convertThread(threads[i])
+	}
+	return r, nil
+}
+
+// Goroutines returns the goroutines of the target.
+func (s *Session) Goroutines() ([]*Goroutine, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	gs, _, err := s.d.Goroutines(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	r := make([]*Goroutine, len(gs))
+	for i := range gs {
+		r[i] = convertGoroutine(gs[i])
+	}
+	return r, nil
+}
+
+// Stacktrace returns up to depth frames of the stack of the goroutine
+// with the specified ID, -1 for the selected goroutine, with the local
+// variables and the arguments of each frame if cfg is not nil.
+func (s *Session) Stacktrace(goroutineID, depth int, cfg *LoadConfig) ([]Stackframe, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	frames, err := s.d.Stacktrace(goroutineID, depth, 0, api.LoadConfigToProc(cfg.toAPI()))
+	if err != nil {
+		return nil, err
+	}
+	r := make([]Stackframe, len(frames))
+	for i := range frames {
+		r[i] = convertStackframe(&frames[i])
+	}
+	return r, nil
+}
+
+// Eval evaluates expr in the frame of the stack of the goroutine with the
+// specified ID, -1 for the selected goroutine. The frames are numbered
+// from 0, the innermost one. A nil cfg uses DefaultLoadConfig.
+func (s *Session) Eval(goroutineID, frame int, expr string, cfg *LoadConfig) (*Variable, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		cfg = &DefaultLoadConfig
+	}
+	v, err := s.d.EvalVariableInScope(api.EvalScope{GoroutineID: goroutineID, Frame: frame}, expr, *api.LoadConfigToProc(cfg.toAPI()))
+	if err != nil {
+		return nil, err
+	}
+	return convertVariable(v), nil
+}
+
+// Locals returns the local variables of the frame of the stack of the
+// goroutine with the specified ID, see Eval.
+func (s *Session) Locals(goroutineID, frame int, cfg *LoadConfig) ([]Variable, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		cfg = &DefaultLoadConfig
+	}
+	vars, err := s.d.LocalVariables(api.EvalScope{GoroutineID: goroutineID, Frame: frame}, *api.LoadConfigToProc(cfg.toAPI()))
+	return convertVariables(vars), err
+}
+
+// Args returns the arguments of the function of the frame of the stack of
+// the goroutine with the specified ID, see Eval.
+func (s *Session) Args(goroutineID, frame int, cfg *LoadConfig) ([]Variable, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		cfg = &DefaultLoadConfig
+	}
+	vars, err := s.d.FunctionArguments(api.EvalScope{GoroutineID: goroutineID, Frame: frame}, *api.LoadConfigToProc(cfg.toAPI()))
+	return convertVariables(vars), err
+}
+
+// Restart restarts a process started by Launch, keeping its breakpoints.
+func (s *Session) Restart() error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	_, err := s.d.Restart(false, "", false, nil, [3]string{}, false)
+	return err
+}
+
+// Detach detaches from the target and closes the session. Processes
+// started by Launch are always killed, processes attached by Attach are
+// killed if kill is true.
+func (s *Session) Detach(kill bool) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrSessionClosed
+	}
+	s.closed = true
+	s.mu.Unlock()
+	return s.d.Detach(kill)
+}
@@ -0,0 +1,72 @@
+package debugger_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/go-delve/delve/pkg/debugger"
+)
+
+func Example() {
+	s, err := debugger.Launch(&debugger.Config{}, "./myprogram", "-v")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Detach(true)
+
+	if _, err := s.SetBreakpoint("main.main"); err != nil {
+		log.Fatal(err)
+	}
+	state, err := s.Continue()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if state.Exited {
+		return
+	}
+	frames, err := s.Stacktrace(-1, 10, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, frame := range frames {
+		fmt.Printf("%s:%d %s\n", frame.File, frame.Line, frame.Function)
+	}
+}
+
+func ExampleSession_Eval() {
+	s, err := debugger.Attach(&debugger.Config{}, 1234, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Detach(false)
+
+	v, err := s.Eval(-1, 0, "len(os.Args)", nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(v.SinglelineString())
+}
+
+func ExampleSession_Subscribe() {
+	s, err := debugger.OpenCore(&debugger.Config{}, "./myprogram", "./core")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Detach(false)
+
+	unsubscribe := s.Subscribe(func(e debugger.Event) {
+		switch e.Kind {
+		case debugger.EventStopped:
+			fmt.Println("stopped at", e.State.CurrentThread.File, e.State.CurrentThread.Line)
+		case debugger.EventExited:
+			fmt.Println("exited with status", e.State.ExitStatus)
+		}
+	})
+	defer unsubscribe()
+
+	goroutines, err := s.Goroutines()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(len(goroutines), "goroutines")
+}
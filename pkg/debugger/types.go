@@ -0,0 +1,345 @@
+package debugger
+
+import (
+	"reflect"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// State is the state of the debugger and of the target.
+type State struct {
+	// Running is true if the target is running.
+	Running bool
+	// CurrentThread is the thread the target stopped on, nil if the
+	// target is running.
+	CurrentThread *Thread
+	// SelectedGoroutine is the goroutine used by Next, Step, StepOut and
+	// by the methods that take -1 as a goroutine ID.
+	SelectedGoroutine *Goroutine
+	// Threads are the threads of the target.
+	Threads []*Thread
+	// Exited is true if the target exited, with status ExitStatus.
+	Exited     bool
+	ExitStatus int
+}
+
+// Breakpoint is a breakpoint of the target.
+type Breakpoint struct {
+	// ID is the ID of the breakpoint, assigned by CreateBreakpoint.
+	ID int
+	// Name is an optional name of the breakpoint.
+	Name string
+	// Addr is the address of the breakpoint, Addrs all its addresses if
+	// the location it was created for maps to more than one address.
+	Addr  uint64
+	Addrs []uint64
+	// File and Line are the source location of the breakpoint.
+	File string
+	Line int
+	// FunctionName is the name of the function of the breakpoint.
+	FunctionName string
+	// Cond is an expression, the breakpoint is only hit if it is true.
+	Cond string
+	// Tracepoint is true if the breakpoint does not stop the target.
+	Tracepoint bool
+	// Goroutine is true to read the goroutine that hit the breakpoint.
+	Goroutine bool
+	// Stacktrace is the number of frames of the stack read when the
+	// breakpoint is hit.
+	Stacktrace int
+	// Variables are the expressions evaluated when the breakpoint is hit.
+	Variables []string
+	// LoadArgs and LoadLocals, if not nil, read the arguments and the
+	// local variables of the function when the breakpoint is hit.
+	LoadArgs   *LoadConfig
+	LoadLocals *LoadConfig
+	// HitCount is the number of times the breakpoint was hit by each
+	// goroutine, by goroutine ID, TotalHitCount the total.
+	HitCount      map[string]uint64
+	TotalHitCount uint64
+}
+
+// Location is a location in the target program.
+type Location struct {
+	PC   uint64
+	File string
+	Line int
+	// Function is the name of the function containing PC, empty if it is
+	// not known.
+	Function string
+}
+
+// Thread is a thread of the target.
+type Thread struct {
+	ID int
+	// Location is the location the thread is stopped at.
+	Location
+	// GoroutineID is the ID of the goroutine executed by the thread, 0 if
+	// there is none.
+	GoroutineID int
+	// Breakpoint is the breakpoint the thread is stopped at, if any.
+	Breakpoint *Breakpoint
+	// ReturnValues are the values returned by the function StepOut
+	// stepped out of.
+	ReturnValues []Variable
+}
+
+// Goroutine is a goroutine of the target.
+type Goroutine struct {
+	ID int
+	// CurrentLoc is the location the goroutine is stopped at,
+	// UserCurrentLoc the innermost location outside of the runtime.
+	CurrentLoc     Location
+	UserCurrentLoc Location
+	// GoStatementLoc is the location of the go statement that started
+	// the goroutine, StartLoc the location it started at.
+	GoStatementLoc Location
+	StartLoc       Location
+	// ThreadID is the ID of the thread executing the goroutine, 0 if
+	// there is none.
+	ThreadID int
+	// Labels are the pprof labels of the goroutine.
+	Labels map[string]string
+}
+
+// Stackframe is a frame of the stack of a goroutine.
+type Stackframe struct {
+	Location
+	// Locals and Arguments are the local variables and the arguments of
+	// the function of the frame, if they were requested.
+	Locals    []Variable
+	Arguments []Variable
+	// FrameOffset is the offset of the frame from the base of the stack.
+	FrameOffset int64
+	// Err is the error that stopped reading the stack at this frame, if
+	// any.
+	Err string
+}
+
+// Variable is the value of a variable or of an expression.
+type Variable struct {
+	Name string
+	// Addr is the address of the value, 0 if it is not in memory.
+	Addr uint64
+	// Type is the name of the type of the value, RealType the name of the
+	// type it resolves to.
+	Type     string
+	RealType string
+	Kind     reflect.Kind
+	// Value is the value of strings, numbers and booleans, empty for the
+	// other kinds.
+	Value string
+	// Len and Cap are the length and the capacity of strings, arrays,
+	// slices, maps and channels.
+	Len int64
+	Cap int64
+	// Children are the fields of structs, the elements of arrays, slices
+	// and maps (keys and values alternate), the value pointed by pointers
+	// and the concrete value of interfaces.
+	Children []Variable
+	// Unreadable is the error that prevented reading the value, if any.
+	Unreadable string
+
+	v *api.Variable
+}
+
+// SinglelineString returns the value formatted on a single line, as
+// printed by the print command of the terminal. Changes to the fields of
+// v are not reflected.
+func (v *Variable) SinglelineString() string {
+	if v.v == nil {
+		return v.Value
+	}
+	return v.v.SinglelineString()
+}
+
+// MultilineString returns the value formatted on multiple lines, the
+// lines after the first one are prefixed by indent. Changes to the fields
+// of v are not reflected.
+func (v *Variable) MultilineString(indent string) string {
+	if v.v == nil {
+		return v.Value
+	}
+	return v.v.MultilineString(indent)
+}
+
+// LoadConfig describes how much of a value is read from the target.
+type LoadConfig struct {
+	// FollowPointers reads the values pointed by pointers.
+	FollowPointers bool
+	// MaxVariableRecurse is how far to recurse into nested values.
+	MaxVariableRecurse int
+	// MaxStringLen is the maximum number of bytes read from strings.
+	MaxStringLen int
+	// MaxArrayValues is the maximum number of elements read from arrays,
+	// slices and maps.
+	MaxArrayValues int
+	// MaxStructFields is the maximum number of fields read from structs,
+	// -1 for all of them.
+	MaxStructFields int
+}
+
+// The functions below convert the types of service/api, which change
+// whenever Delve needs them to, to the types of this package.
+
+func convertState(s *api.DebuggerState) *State {
+	if s == nil {
+		return nil
+	}
+	r := &State{
+		Running:           s.Running,
+		CurrentThread:     convertThread(s.CurrentThread),
+		SelectedGoroutine: convertGoroutine(s.SelectedGoroutine),
+		Exited:            s.Exited,
+		ExitStatus:        s.ExitStatus,
+	}
+	for _, th := range s.Threads {
+		r.Threads = append(r.Threads, convertThread(th))
+	}
+	return r
+}
+
+func convertBreakpoint(bp *api.Breakpoint) *Breakpoint {
+	if bp == nil {
+		return nil
+	}
+	return &Breakpoint{
+		ID:            bp.ID,
+		Name:          bp.Name,
+		Addr:          bp.Addr,
+		Addrs:         bp.Addrs,
+		File:          bp.File,
+		Line:          bp.Line,
+		FunctionName:  bp.FunctionName,
+		Cond:          bp.Cond,
+		Tracepoint:    bp.Tracepoint,
+		Goroutine:     bp.Goroutine,
+		Stacktrace:    bp.Stacktrace,
+		Variables:     bp.Variables,
+		LoadArgs:      convertLoadConfig(bp.LoadArgs),
+		LoadLocals:    convertLoadConfig(bp.LoadLocals),
+		HitCount:      bp.HitCount,
+		TotalHitCount: bp.TotalHitCount,
+	}
+}
+
+func (bp *Breakpoint) toAPI() *api.Breakpoint {
+	return &api.Breakpoint{
+		ID:           bp.ID,
+		Name:         bp.Name,
+		Addr:         bp.Addr,
+		Addrs:        bp.Addrs,
+		File:         bp.File,
+		Line:         bp.Line,
+		FunctionName: bp.FunctionName,
+		Cond:         bp.Cond,
+		Tracepoint:   bp.Tracepoint,
+		Goroutine:    bp.Goroutine,
+		Stacktrace:   bp.Stacktrace,
+		Variables:    bp.Variables,
+		LoadArgs:     bp.LoadArgs.toAPI(),
+		LoadLocals:   bp.LoadLocals.toAPI(),
+	}
+}
+
+func convertLocation(loc api.Location) Location {
+	return Location{PC: loc.PC, File: loc.File, Line: loc.Line, Function: functionName(loc.Function)}
+}
+
+func functionName(fn *api.Function) string {
+	if fn == nil {
+		return ""
+	}
+	return fn.Name()
+}
+
+func convertThread(th *api.Thread) *Thread {
+	if th == nil {
+		return nil
+	}
+	return &Thread{
+		ID:           th.ID,
+		Location:     Location{PC: th.PC, File: th.File, Line: th.Line, Function: functionName(th.Function)},
+		GoroutineID:  th.GoroutineID,
+		Breakpoint:   convertBreakpoint(th.Breakpoint),
+		ReturnValues: convertVariables(th.ReturnValues),
+	}
+}
+
+func convertGoroutine(g *api.Goroutine) *Goroutine {
+	if g == nil {
+		return nil
+	}
+	return &Goroutine{
+		ID:             g.ID,
+		CurrentLoc:     convertLocation(g.CurrentLoc),
+		UserCurrentLoc: convertLocation(g.UserCurrentLoc),
+		GoStatementLoc: convertLocation(g.GoStatementLoc),
+		StartLoc:       convertLocation(g.StartLoc),
+		ThreadID:       g.ThreadID,
+		Labels:         g.Labels,
+	}
+}
+
+func convertStackframe(frame *api.Stackframe) Stackframe {
+	return Stackframe{
+		Location:    convertLocation(frame.Location),
+		Locals:      convertVariables(frame.Locals),
+		Arguments:   convertVariables(frame.Arguments),
+		FrameOffset: frame.FrameOffset,
+		Err:         frame.Err,
+	}
+}
+
+func convertVariable(v *api.Variable) *Variable {
+	return &Variable{
+		Name:       v.Name,
+		Addr:       uint64(v.Addr),
+		Type:       v.Type,
+		RealType:   v.RealType,
+		Kind:       v.Kind,
+		Value:      v.Value,
+		Len:        v.Len,
+		Cap:        v.Cap,
+		Children:   convertVariables(v.Children),
+		Unreadable: v.Unreadable,
+		v:          v,
+	}
+}
+
+func convertVariables(vs []api.Variable) []Variable {
+	if vs == nil {
+		return nil
+	}
+	r := make([]Variable, len(vs))
+	for i := range vs {
+		r[i] = *convertVariable(&vs[i])
+	}
+	return r
+}
+
+func convertLoadConfig(cfg *api.LoadConfig) *LoadConfig {
+	if cfg == nil {
+		return nil
+	}
+	return &LoadConfig{
+		FollowPointers:     cfg.FollowPointers,
+		MaxVariableRecurse: cfg.MaxVariableRecurse,
+		MaxStringLen:       cfg.MaxStringLen,
+		MaxArrayValues:     cfg.MaxArrayValues,
+		MaxStructFields:    cfg.MaxStructFields,
+	}
+}
+
+func (cfg *LoadConfig) toAPI() *api.LoadConfig {
+	if cfg == nil {
+		return nil
+	}
+	return &api.LoadConfig{
+		FollowPointers:     cfg.FollowPointers,
+		MaxVariableRecurse: cfg.MaxVariableRecurse,
+		MaxStringLen:       cfg.MaxStringLen,
+		MaxArrayValues:     cfg.MaxArrayValues,
+		MaxStructFields:    cfg.MaxStructFields,
+	}
+}
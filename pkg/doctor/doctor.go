@@ -0,0 +1,90 @@
+// Package doctor checks the host for the common causes of failures to
+// launch or attach to processes, like the security settings of the kernel
+// or of the container running Delve, and suggests how to fix them.
+package doctor
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/go-delve/delve/pkg/goversion"
+)
+
+// Status is the outcome of a check.
+type Status int
+
+const (
+	// StatusOK means that no problem was found.
+	StatusOK Status = iota
+	// StatusWarning means that some operations, for example attaching to
+	// processes, could fail.
+	StatusWarning
+	// StatusProblem means that debugging is not possible.
+	StatusProblem
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusWarning:
+		return "warning"
+	case StatusProblem:
+		return "problem"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// Result is the result of a check.
+type Result struct {
+	// Name is what was checked.
+	Name   string
+	Status Status
+	// Detail describes what was found.
+	Detail string
+	// Fix describes how to fix the problem, it can span multiple lines.
+	Fix string
+}
+
+// Check runs the checks of the current operating system and returns their
+// results.
+func Check() []Result {
+	return append(osChecks(), checkGo())
+}
+
+// checkGo checks that the installed version of Go, used by dlv debug and
+// dlv test, is supported.
+func checkGo() Result {
+	r := Result{Name: "Go toolchain"}
+	if _, err := exec.LookPath("go"); err != nil {
+		r.Status = StatusWarning
+		r.Detail = "the go command was not found, dlv debug and dlv test will not work"
+		r.Fix = "Install Go and add the directory of the go command to PATH."
+		return r
+	}
+	ver, ok := goversion.Installed()
+	if !ok {
+		r.Status = StatusWarning
+		r.Detail = "could not determine the version of Go from the output of go version"
+		return r
+	}
+	r.Detail = fmt.Sprintf("go%d.%d", ver.Major, ver.Minor)
+	if ver.IsDevel() {
+		r.Detail = "development version of Go"
+		return r
+	}
+	min := goversion.GoVersion{Major: goversion.MinSupportedVersionOfGoMajor, Minor: goversion.MinSupportedVersionOfGoMinor, Rev: -1}
+	max := goversion.GoVersion{Major: goversion.MaxSupportedVersionOfGoMajor, Minor: goversion.MaxSupportedVersionOfGoMinor + 1, Rev: -1}
+	switch {
+	case !ver.AfterOrEqual(min):
+		r.Status = StatusWarning
+		r.Detail += fmt.Sprintf(" is older than the minimum supported version, go%d.%d", min.Major, min.Minor)
+		r.Fix = "Upgrade Go."
+	case ver.AfterOrEqual(max):
+		r.Status = StatusWarning
+		r.Detail += fmt.Sprintf(" is newer than the maximum supported version, go%d.%d", max.Major, max.Minor-1)
+		r.Fix = "Upgrade Delve, or use --check-go-version=false at your own risk."
+	}
+	return r
+}
@@ -0,0 +1,68 @@
+package doctor
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/proc/gdbserial"
+)
+
+func osChecks() []Result {
+	return []Result{
+		checkDebugserver(),
+		checkDeveloperMode(),
+		checkSIP(),
+	}
+}
+
+// checkDebugserver checks that the debugserver executable, used by the
+// default backend, is installed.
+func checkDebugserver() Result {
+	r := Result{Name: "debugserver"}
+	if path := gdbserial.DebugServerPath(); path != "" {
+		r.Status = StatusOK
+		r.Detail = path
+		return r
+	}
+	r.Status = StatusProblem
+	r.Detail = "debugserver was not found, it is needed by the default backend"
+	r.Fix = "Install the command line developer tools with:\n\txcode-select --install"
+	return r
+}
+
+func checkDeveloperMode() Result {
+	r := Result{Name: "Developer mode"}
+	out, err := exec.Command("DevToolsSecurity", "-status").CombinedOutput()
+	if err != nil {
+		r.Status = StatusWarning
+		r.Detail = "could not run DevToolsSecurity: " + err.Error()
+		return r
+	}
+	if strings.Contains(string(out), "enabled") {
+		r.Status = StatusOK
+		r.Detail = "enabled"
+		return r
+	}
+	r.Status = StatusWarning
+	r.Detail = "disabled, you will be asked to authorize dlv every time it is used"
+	r.Fix = "Enable developer mode with:\n\tsudo DevToolsSecurity -enable\n" +
+		"and, if your user is not an administrator, add it to the _developer group with:\n" +
+		"\tsudo dscl . append /Groups/_developer GroupMembership $USER"
+	return r
+}
+
+// checkSIP reports whether System Integrity Protection is enabled, the
+// executables it protects can not be debugged.
+func checkSIP() Result {
+	r := Result{Name: "System Integrity Protection", Status: StatusOK}
+	out, err := exec.Command("csrutil", "status").CombinedOutput()
+	switch {
+	case err != nil:
+		r.Detail = "could not run csrutil: " + err.Error()
+	case strings.Contains(string(out), "enabled"):
+		r.Detail = "enabled, the executables in /usr/bin, /bin, /sbin and /System can not be debugged, copy them elsewhere to debug them"
+	default:
+		r.Detail = "disabled"
+	}
+	return r
+}
@@ -0,0 +1,167 @@
+package doctor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// capSysPtrace is the number of the CAP_SYS_PTRACE capability.
+const capSysPtrace = 19
+
+func osChecks() []Result {
+	status := readProcStatus()
+	container := inContainer()
+	return []Result{
+		checkYama(),
+		checkPtrace(status, container),
+		checkCapabilities(status, container),
+	}
+}
+
+// readProcStatus returns the fields of /proc/self/status.
+func readProcStatus() map[string]string {
+	buf, _ := ioutil.ReadFile("/proc/self/status")
+	return parseProcStatus(buf)
+}
+
+func parseProcStatus(buf []byte) map[string]string {
+	status := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(buf))
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), ":", 2)
+		if len(fields) == 2 {
+			status[fields[0]] = strings.TrimSpace(fields[1])
+		}
+	}
+	return status
+}
+
+// inContainer returns true if dlv seems to be running in a container.
+func inContainer() bool {
+	for _, path := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	buf, _ := ioutil.ReadFile("/proc/1/cgroup")
+	for _, s := range []string{"docker", "kubepods", "containerd", "lxc"} {
+		if bytes.Contains(buf, []byte(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkYama() Result {
+	buf, err := ioutil.ReadFile("/proc/sys/kernel/yama/ptrace_scope")
+	if err != nil {
+		return Result{Name: "Yama", Status: StatusOK, Detail: "the Yama security module is not enabled"}
+	}
+	return yamaResult(strings.TrimSpace(string(buf)))
+}
+
+func yamaResult(scope string) Result {
+	r := Result{Name: "Yama", Detail: "kernel.yama.ptrace_scope is " + scope}
+	switch scope {
+	case "0":
+		r.Status = StatusOK
+	case "1":
+		r.Status = StatusWarning
+		r.Detail += ", processes can only be traced by their ancestors: dlv attach needs CAP_SYS_PTRACE"
+		r.Fix = "Run dlv attach as root, or allow attaching to all the processes of the same user with:\n\tsudo sysctl kernel.yama.ptrace_scope=0"
+	case "2":
+		r.Status = StatusProblem
+		r.Detail += ", only processes with CAP_SYS_PTRACE can trace other processes"
+		r.Fix = "Run dlv as root, or allow tracing child processes with:\n\tsudo sysctl kernel.yama.ptrace_scope=1"
+	case "3":
+		r.Status = StatusProblem
+		r.Detail += ", tracing processes is disabled until the next reboot"
+		r.Fix = "Set kernel.yama.ptrace_scope to 0 or 1 in /etc/sysctl.d and reboot."
+	default:
+		r.Status = StatusWarning
+		r.Detail += ", an unknown value"
+	}
+	return r
+}
+
+// checkPtrace starts a traced process, like dlv debug and dlv exec do.
+func checkPtrace(status map[string]string, container bool) Result {
+	r := Result{Name: "ptrace", Status: StatusOK, Detail: "child processes can be traced"}
+	exe, err := os.Executable()
+	if err != nil {
+		r.Status = StatusWarning
+		r.Detail = fmt.Sprintf("could not check: %v", err)
+		return r
+	}
+
+	// the thread starting a traced process is its tracer
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	cmd := exec.Command(exe, "version")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+	err = cmd.Start()
+	if err == nil {
+		// the process is stopped before executing anything
+		cmd.Process.Kill()
+		cmd.Wait()
+		return r
+	}
+
+	r.Status = StatusProblem
+	r.Detail = fmt.Sprintf("could not start a traced process: %v", err)
+	switch {
+	case status["Seccomp"] == "2":
+		r.Detail += ", a seccomp filter is applied to dlv"
+		r.Fix = "If dlv is running in a container allow ptrace in its seccomp profile, for example\n" +
+			"with Docker 19.03 or later:\n\tdocker run --cap-add=SYS_PTRACE ...\n" +
+			"or disable the seccomp profile with:\n\tdocker run --security-opt seccomp=unconfined ..."
+	case container:
+		r.Fix = "Give the SYS_PTRACE capability to the container, for example:\n\tdocker run --cap-add=SYS_PTRACE ..."
+	case selinuxDenyPtrace():
+		r.Detail += ", the deny_ptrace SELinux boolean is set"
+		r.Fix = "Allow tracing processes with:\n\tsudo setsebool deny_ptrace 0"
+	default:
+		r.Fix = "Check the configuration of the security modules of the kernel (AppArmor, SELinux)."
+	}
+	return r
+}
+
+func selinuxDenyPtrace() bool {
+	buf, err := ioutil.ReadFile("/sys/fs/selinux/booleans/deny_ptrace")
+	return err == nil && strings.HasPrefix(string(buf), "1")
+}
+
+// checkCapabilities checks for CAP_SYS_PTRACE, needed to attach to the
+// processes of other users and, with Yama, to processes that are not
+// children of dlv.
+func checkCapabilities(status map[string]string, container bool) Result {
+	r := Result{Name: "CAP_SYS_PTRACE", Status: StatusOK}
+	if hasCapability(status["CapEff"], capSysPtrace) {
+		r.Detail = "dlv can attach to any process"
+		return r
+	}
+	r.Detail = "dlv can only attach to the processes of the same user"
+	if container {
+		r.Status = StatusWarning
+		r.Detail = "dlv is running in a container without the SYS_PTRACE capability, attaching to processes can fail"
+		r.Fix = "Add the capability to the container, for example:\n" +
+			"\tdocker run --cap-add=SYS_PTRACE ...\n" +
+			"or, in Kubernetes, add SYS_PTRACE to securityContext.capabilities.add of the container."
+	}
+	return r
+}
+
+// hasCapability returns true if the capability set capset, in the format
+// of /proc/self/status, contains capability.
+func hasCapability(capset string, capability uint) bool {
+	caps, err := strconv.ParseUint(capset, 16, 64)
+	return err == nil && caps&(1<<capability) != 0
+}
@@ -0,0 +1,34 @@
+package doctor
+
+import "testing"
+
+func TestYamaResult(t *testing.T) {
+	for scope, status := range map[string]Status{"0": StatusOK, "1": StatusWarning, "2": StatusProblem, "3": StatusProblem} {
+		r := yamaResult(scope)
+		if r.Status != status || (status != StatusOK && r.Fix == "") {
+			t.Errorf("wrong result for scope %s: %#v", scope, r)
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	status := parseProcStatus([]byte("Name:\tdlv\nSeccomp:\t2\nCapEff:\t00000000a80c25fb\n"))
+	if status["Name"] != "dlv" || status["Seccomp"] != "2" {
+		t.Errorf("wrong status %v", status)
+	}
+	if !hasCapability(status["CapEff"], capSysPtrace) {
+		t.Errorf("CAP_SYS_PTRACE not found in %s", status["CapEff"])
+	}
+	if hasCapability("00000000a8040000", capSysPtrace) || hasCapability("", capSysPtrace) {
+		t.Error("CAP_SYS_PTRACE found in a set without it")
+	}
+
+	r := checkCapabilities(map[string]string{"CapEff": "0000000000000000"}, true)
+	if r.Status != StatusWarning || r.Fix == "" {
+		t.Errorf("wrong result in a container without CAP_SYS_PTRACE: %#v", r)
+	}
+	r = checkCapabilities(map[string]string{"CapEff": "0000000000000000"}, false)
+	if r.Status != StatusOK {
+		t.Errorf("wrong result without CAP_SYS_PTRACE: %#v", r)
+	}
+}
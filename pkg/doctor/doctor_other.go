@@ -0,0 +1,7 @@
+// +build !linux,!darwin,!windows
+
+package doctor
+
+func osChecks() []Result {
+	return nil
+}
@@ -0,0 +1,37 @@
+package doctor
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func osChecks() []Result {
+	return []Result{checkDefender()}
+}
+
+// checkDefender checks the real-time protection of Windows Defender,
+// which scans the executables built by dlv debug and dlv test before they
+// can be started and can block the debugger from accessing the memory of
+// processes.
+func checkDefender() Result {
+	r := Result{Name: "Windows Defender", Status: StatusOK}
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", "(Get-MpComputerStatus).RealTimeProtectionEnabled").Output()
+	if err != nil {
+		r.Detail = "could not query the status of Windows Defender: " + err.Error()
+		return r
+	}
+	if strings.TrimSpace(string(out)) != "True" {
+		r.Detail = "real-time protection is disabled"
+		return r
+	}
+	r.Status = StatusWarning
+	r.Detail = "real-time protection is enabled, it can slow down or block debugging"
+	dir, _ := os.Getwd()
+	r.Fix = "Exclude dlv and the directories of the programs you debug from the scans, from an\n" +
+		"elevated PowerShell:\n" +
+		"\tAdd-MpPreference -ExclusionProcess dlv.exe\n" +
+		"\tAdd-MpPreference -ExclusionPath \"" + dir + "\"\n" +
+		"The same applies to other antivirus programs."
+	return r
+}
@@ -6,6 +6,9 @@ package frame
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/go-delve/delve/pkg/dwarf/util"
 )
@@ -137,3 +140,183 @@ func DwarfEndian(infoSec []byte) binary.ByteOrder {
 		return binary.BigEndian
 	}
 }
+
+// Pointer encodings used by .eh_frame, see the Linux Standard Base Core
+// Specification, section 10.5.
+const (
+	ehPeAbsptr  = 0x00
+	ehPeUleb128 = 0x01
+	ehPeUdata2  = 0x02
+	ehPeUdata4  = 0x03
+	ehPeUdata8  = 0x04
+	ehPeSleb128 = 0x09
+	ehPeSdata2  = 0x0a
+	ehPeSdata4  = 0x0b
+	ehPeSdata8  = 0x0c
+
+	ehPePcrel    = 0x10
+	ehPeIndirect = 0x80
+	ehPeOmit     = 0xff
+)
+
+// ParseEhFrame parses the contents of a .eh_frame section, used for
+// executables that do not have a .debug_frame section (for example the
+// ones produced by LLVM based compilers). The format of .eh_frame is like
+// the one of .debug_frame, except that CIE IDs are 0, CIE pointers are
+// relative to the FDE and the addresses of the FDEs are encoded as
+// specified by the augmentation of their CIE, possibly relative to their
+// own address. ehFrameAddr is the address of the section.
+func ParseEhFrame(data []byte, order binary.ByteOrder, staticBase uint64, ptrSize int, ehFrameAddr uint64) (FrameDescriptionEntries, error) {
+	type ehCIE struct {
+		*CommonInformationEntry
+		ptrEnc byte
+		hasAug bool // the augmentation starts with 'z'
+	}
+	var (
+		entries = newFrameIndex()
+		cies    = make(map[int]*ehCIE)
+	)
+
+	for off := 0; off+4 <= len(data); {
+		start := off
+		length := order.Uint32(data[off:])
+		off += 4
+		if length == 0 {
+			// zero terminator
+			break
+		}
+		if length == 0xffffffff {
+			return entries, fmt.Errorf("64bit .eh_frame entry at %#x not supported", start)
+		}
+		end := off + int(length)
+		if length < 4 || end > len(data) {
+			return entries, fmt.Errorf("malformed .eh_frame entry at %#x", start)
+		}
+		id := order.Uint32(data[off:])
+		idOff := off
+		off += 4
+		buf := bytes.NewBuffer(data[off:end])
+
+		if id == 0 {
+			cie := &ehCIE{CommonInformationEntry: &CommonInformationEntry{Length: length - 4, staticBase: staticBase}, ptrEnc: ehPeAbsptr}
+			cie.Version, _ = buf.ReadByte()
+			cie.Augmentation, _ = util.ParseString(buf)
+			if strings.Contains(cie.Augmentation, "eh") {
+				buf.Next(ptrSize)
+			}
+			cie.CodeAlignmentFactor, _ = util.DecodeULEB128(buf)
+			cie.DataAlignmentFactor, _ = util.DecodeSLEB128(buf)
+			if cie.Version == 1 {
+				ra, _ := buf.ReadByte()
+				cie.ReturnAddressRegister = uint64(ra)
+			} else {
+				cie.ReturnAddressRegister, _ = util.DecodeULEB128(buf)
+			}
+			if strings.HasPrefix(cie.Augmentation, "z") {
+				cie.hasAug = true
+				augLen, _ := util.DecodeULEB128(buf)
+				aug := bytes.NewBuffer(buf.Next(int(augLen)))
+				for _, c := range cie.Augmentation[1:] {
+					switch c {
+					case 'L':
+						aug.ReadByte()
+					case 'P':
+						enc, _ := aug.ReadByte()
+						if _, err := readEncodedPtr(aug, enc, 0, order, ptrSize); err != nil {
+							return entries, fmt.Errorf(".eh_frame CIE at %#x: %v", start, err)
+						}
+					case 'R':
+						cie.ptrEnc, _ = aug.ReadByte()
+					}
+				}
+			}
+			cie.InitialInstructions = buf.Bytes()
+			cies[start] = cie
+			off = end
+			continue
+		}
+
+		cie := cies[idOff-int(id)]
+		if cie == nil {
+			return entries, fmt.Errorf(".eh_frame FDE at %#x: CIE not found", start)
+		}
+		begin, err := readEncodedPtr(buf, cie.ptrEnc, ehFrameAddr+uint64(off), order, ptrSize)
+		if err != nil {
+			return entries, fmt.Errorf(".eh_frame FDE at %#x: %v", start, err)
+		}
+		size, err := readEncodedPtr(buf, cie.ptrEnc&0x0f, 0, order, ptrSize)
+		if err != nil {
+			return entries, fmt.Errorf(".eh_frame FDE at %#x: %v", start, err)
+		}
+		if cie.hasAug {
+			augLen, _ := util.DecodeULEB128(buf)
+			buf.Next(int(augLen))
+		}
+		entries = append(entries, &FrameDescriptionEntry{
+			Length:       length,
+			CIE:          cie.CommonInformationEntry,
+			Instructions: buf.Bytes(),
+			begin:        begin + staticBase,
+			size:         size,
+			order:        order,
+		})
+		off = end
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Begin() < entries[j].Begin()
+	})
+	return entries, nil
+}
+
+// readEncodedPtr reads a pointer encoded with the .eh_frame encoding enc
+// from buf. The address of the pointer, pcrel, is used for pc relative
+// pointers.
+func readEncodedPtr(buf *bytes.Buffer, enc byte, pcrel uint64, order binary.ByteOrder, ptrSize int) (uint64, error) {
+	if enc == ehPeOmit {
+		return 0, nil
+	}
+	var (
+		v   uint64
+		err error
+	)
+	switch enc & 0x0f {
+	case ehPeAbsptr:
+		v, err = util.ReadUintRaw(buf, order, ptrSize)
+	case ehPeUleb128:
+		v, _ = util.DecodeULEB128(buf)
+	case ehPeSleb128:
+		n, _ := util.DecodeSLEB128(buf)
+		v = uint64(n)
+	case ehPeUdata2, ehPeSdata2:
+		var n uint16
+		err = binary.Read(buf, order, &n)
+		v = uint64(n)
+		if enc&0x0f == ehPeSdata2 {
+			v = uint64(int16(n))
+		}
+	case ehPeUdata4, ehPeSdata4:
+		v, err = util.ReadUintRaw(buf, order, 4)
+		if enc&0x0f == ehPeSdata4 {
+			v = uint64(int32(v))
+		}
+	case ehPeUdata8, ehPeSdata8:
+		v, err = util.ReadUintRaw(buf, order, 8)
+	default:
+		return 0, fmt.Errorf("unsupported pointer encoding %#x", enc)
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch enc & 0x70 {
+	case 0:
+	case ehPePcrel:
+		v += pcrel
+	default:
+		return 0, fmt.Errorf("unsupported pointer encoding %#x", enc)
+	}
+	if enc&ehPeIndirect != 0 {
+		return 0, fmt.Errorf("unsupported pointer encoding %#x", enc)
+	}
+	return v, nil
+}
@@ -39,6 +39,63 @@ func TestParseCIE(t *testing.T) {
 	}
 }
 
+func TestParseEhFrame(t *testing.T) {
+	data := []byte{
+		// CIE at 0x0
+		18, 0, 0, 0, // length
+		0, 0, 0, 0, // CIE id
+		1,           // version
+		'z', 'R', 0, // augmentation
+		1,          // code alignment factor
+		0x78,       // data alignment factor (-8)
+		16,         // return address register
+		1,          // augmentation data length
+		0x1b,       // FDE pointer encoding: pcrel sdata4
+		0x0c, 7, 8, // DW_CFA_def_cfa rsp+8
+		0x90, 1, // DW_CFA_offset r16 cfa-8
+
+		// FDE at 0x16
+		17, 0, 0, 0, // length
+		26, 0, 0, 0, // CIE pointer
+		0xe2, 0xf3, 0xff, 0xff, // begin, relative to 0x101e
+		0x00, 0x01, 0, 0, // size
+		0,          // augmentation data length
+		0x41,       // DW_CFA_advance_loc 1
+		0x0e, 0x10, // DW_CFA_def_cfa_offset 16
+		0, // DW_CFA_nop
+
+		0, 0, 0, 0, // terminator
+	}
+
+	fdes, err := ParseEhFrame(data, binary.LittleEndian, 0x10000, 8, 0x1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fdes) != 1 {
+		t.Fatalf("expected 1 FDE, got %d", len(fdes))
+	}
+	fde, err := fdes.FDEForPC(0x10450)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fde.Begin() != 0x10400 || fde.End() != 0x10500 {
+		t.Fatalf("wrong FDE range %#x-%#x", fde.Begin(), fde.End())
+	}
+	if fde.CIE.Augmentation != "zR" || fde.CIE.DataAlignmentFactor != -8 || fde.CIE.ReturnAddressRegister != 16 {
+		t.Fatalf("wrong CIE %#v", fde.CIE)
+	}
+	if ctx := fde.EstablishFrame(0x10400); ctx.CFA.Offset != 8 {
+		t.Errorf("wrong CFA offset at function entry %d", ctx.CFA.Offset)
+	}
+	if ctx := fde.EstablishFrame(0x10401); ctx.CFA.Offset != 16 {
+		t.Errorf("wrong CFA offset after the first instruction %d", ctx.CFA.Offset)
+	}
+
+	if _, err := ParseEhFrame(data[:30], binary.LittleEndian, 0, 8, 0x1000); err == nil {
+		t.Error("no error for truncated section")
+	}
+}
+
 func BenchmarkParse(b *testing.B) {
 	f, err := os.Open("testdata/frame")
 	if err != nil {
@@ -58,3 +58,13 @@ func (addr *DebugAddr) Get(idx uint64) (uint64, error) {
 	off := idx*uint64(addr.ptrSz) + addr.addrBase
 	return util.ReadUintRaw(bytes.NewReader(addr.data[off:]), addr.byteOrder, addr.ptrSz)
 }
+
+// Bytes returns the contents of the debug_addr section starting at
+// addrBase, used for the split compile units of DWARFv5, which refer to
+// the addresses of their skeleton unit.
+func (addr *DebugAddrSection) Bytes(addrBase uint64) []byte {
+	if addr == nil || addrBase > uint64(len(addr.data)) {
+		return nil
+	}
+	return addr.data[addrBase:]
+}
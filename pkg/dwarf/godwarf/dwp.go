@@ -0,0 +1,111 @@
+package godwarf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Identifiers of the sections of a DWARF package file in its unit index.
+// See DWARFv5 section 7.3.5.3 page 190 and table 7.1.
+const (
+	DwpSectInfo       = 1
+	DwpSectAbbrev     = 3
+	DwpSectLine       = 4
+	DwpSectLoclists   = 5
+	DwpSectStrOffsets = 6
+	DwpSectMacro      = 7
+	DwpSectRnglists   = 8
+)
+
+// DwpIndex is the compilation unit index of a DWARF package file (the
+// .debug_cu_index section of a .dwp file), which maps the ID of split
+// compilation units to their contributions to the sections of the
+// package.
+// See DWARFv5 section 7.3.5 page 187 and following.
+type DwpIndex struct {
+	byteOrder binary.ByteOrder
+
+	sections []uint32 // section identifier of each column
+	nunits   int
+	ids      []byte // hash table of unit IDs, slot_count 8 byte entries
+	rows     []byte // hash table of row indexes, slot_count 4 byte entries
+	offsets  []byte // table of offsets, unit_count rows of 4 byte entries
+	sizes    []byte // table of sizes, unit_count rows of 4 byte entries
+}
+
+// ParseDwpIndex parses data, the contents of the .debug_cu_index section
+// of a DWARF package file.
+func ParseDwpIndex(data []byte, byteOrder binary.ByteOrder) (*DwpIndex, error) {
+	if len(data) < 16 {
+		return nil, errors.New("malformed .debug_cu_index header")
+	}
+	if version := byteOrder.Uint16(data); version != 5 {
+		return nil, fmt.Errorf("unsupported .debug_cu_index version %d", version)
+	}
+	ncols := int(byteOrder.Uint32(data[4:]))
+	nunits := int(byteOrder.Uint32(data[8:]))
+	nslots := int(byteOrder.Uint32(data[12:]))
+	data = data[16:]
+
+	if ncols < 0 || nunits < 0 || nslots < 0 || len(data) < nslots*12+ncols*4+2*nunits*ncols*4 {
+		return nil, errors.New("malformed .debug_cu_index")
+	}
+
+	idx := &DwpIndex{byteOrder: byteOrder, nunits: nunits}
+	idx.ids, data = data[:nslots*8], data[nslots*8:]
+	idx.rows, data = data[:nslots*4], data[nslots*4:]
+	for i := 0; i < ncols; i++ {
+		idx.sections = append(idx.sections, byteOrder.Uint32(data[i*4:]))
+	}
+	data = data[ncols*4:]
+	idx.offsets, data = data[:nunits*ncols*4], data[nunits*ncols*4:]
+	idx.sizes = data[:nunits*ncols*4]
+	return idx, nil
+}
+
+// Contribution returns the offset and size of the contribution of the
+// split compilation unit with the given ID to section sect (one of the
+// DwpSect constants). Returns false if the package does not contain the
+// unit or the unit has no contribution to the section.
+func (idx *DwpIndex) Contribution(id uint64, sect uint32) (off, size uint32, ok bool) {
+	row := idx.findRow(id)
+	if row < 0 {
+		return 0, 0, false
+	}
+	for col, s := range idx.sections {
+		if s == sect {
+			pos := (row*len(idx.sections) + col) * 4
+			return idx.byteOrder.Uint32(idx.offsets[pos:]), idx.byteOrder.Uint32(idx.sizes[pos:]), true
+		}
+	}
+	return 0, 0, false
+}
+
+// findRow returns the row of the offsets and sizes tables for the unit
+// with the given ID, or -1.
+// See DWARFv5 section 7.3.5.3 page 189 for a description of the hash
+// table.
+func (idx *DwpIndex) findRow(id uint64) int {
+	nslots := uint64(len(idx.rows) / 4)
+	if nslots == 0 {
+		return -1
+	}
+	mask := nslots - 1
+	h := id & mask
+	h2 := ((id >> 32) & mask) | 1
+	for i := uint64(0); i < nslots; i++ {
+		row := idx.byteOrder.Uint32(idx.rows[h*4:])
+		if row == 0 {
+			return -1
+		}
+		if idx.byteOrder.Uint64(idx.ids[h*8:]) == id {
+			if int(row) > idx.nunits {
+				return -1
+			}
+			return int(row) - 1
+		}
+		h = (h + h2) & mask
+	}
+	return -1
+}
@@ -0,0 +1,367 @@
+package godwarf
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-delve/delve/pkg/dwarf/util"
+)
+
+// Index attributes of the entries of .debug_names.
+// See DWARFv5 section 6.1.1.2 page 141 and table 6.1.
+const (
+	idxCompileUnit = 0x1
+	idxTypeUnit    = 0x2
+	idxDieOffset   = 0x3
+	idxParent      = 0x4
+	idxTypeHash    = 0x5
+)
+
+// Forms used by the index attributes of the entries of .debug_names.
+const (
+	formData1       = 0x0b
+	formData2       = 0x05
+	formData4       = 0x06
+	formData8       = 0x07
+	formUdata       = 0x0f
+	formSdata       = 0x0d
+	formRef1        = 0x11
+	formRef2        = 0x12
+	formRef4        = 0x13
+	formRef8        = 0x14
+	formRefUdata    = 0x15
+	formFlagPresent = 0x19
+)
+
+// NameEntry is an entry of the .debug_names accelerated lookup table.
+type NameEntry struct {
+	Tag dwarf.Tag
+	// CU is the offset of the compile unit containing the DIE.
+	CU dwarf.Offset
+	// Offset is the offset of the DIE in debug_info.
+	Offset dwarf.Offset
+}
+
+// DebugNames is the .debug_names section of DWARFv5, containing an index
+// of the names of the debugging information entries. The section is
+// decoded lazily, for each lookup.
+// See DWARFv5 section 6.1.1 page 137 and following.
+type DebugNames struct {
+	indexes []*nameIndex
+	str     []byte
+}
+
+// nameIndex is one of the name indexes of .debug_names, normally there is
+// one for each linked object.
+type nameIndex struct {
+	byteOrder binary.ByteOrder
+	offsz     int
+
+	cus        []dwarf.Offset
+	nameCount  int
+	buckets    []byte
+	hashes     []byte
+	strOffsets []byte
+	entryOffs  []byte
+	abbrevs    map[uint64]nameAbbrev
+	entryPool  []byte
+}
+
+type nameAbbrev struct {
+	tag   dwarf.Tag
+	attrs []nameAttr
+}
+
+type nameAttr struct {
+	idx, form uint64
+}
+
+// ParseDebugNames parses the headers of the .debug_names section data,
+// str is the contents of .debug_str. Returns nil if data is empty.
+func ParseDebugNames(data, str []byte) (*DebugNames, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	r := &DebugNames{str: str}
+	for len(data) > 0 {
+		idx, rest, err := parseNameIndex(data)
+		if err != nil {
+			return nil, err
+		}
+		r.indexes = append(r.indexes, idx)
+		data = rest
+	}
+	return r, nil
+}
+
+func parseNameIndex(data []byte) (*nameIndex, []byte, error) {
+	length, dwarf64, _, byteOrder := util.ReadDwarfLengthVersion(data)
+	idx := &nameIndex{byteOrder: byteOrder, offsz: 4}
+	hdrsz := 4
+	if dwarf64 {
+		idx.offsz = 8
+		hdrsz = 12
+	}
+	if length == 0 || uint64(len(data)-hdrsz) < length {
+		return nil, nil, errors.New("malformed .debug_names header")
+	}
+	rest := data[hdrsz+int(length):]
+	data = data[hdrsz:][:length]
+
+	if len(data) < 2+2+7*4 {
+		return nil, nil, errors.New("malformed .debug_names header")
+	}
+	if version := byteOrder.Uint16(data); version != 5 {
+		return nil, nil, fmt.Errorf("unsupported .debug_names version %d", version)
+	}
+	data = data[4:] // version and padding
+	var hdr [7]uint32
+	for i := range hdr {
+		hdr[i] = byteOrder.Uint32(data[4*i:])
+	}
+	data = data[len(hdr)*4:]
+	cuCount, localTUCount, foreignTUCount, bucketCount, nameCount, abbrevSize, augSize := int(hdr[0]), int(hdr[1]), int(hdr[2]), int(hdr[3]), int(hdr[4]), int(hdr[5]), int(hdr[6])
+	idx.nameCount = nameCount
+
+	malformed := false
+	next := func(n int) []byte {
+		if malformed || n < 0 || n > len(data) {
+			malformed = true
+			return nil
+		}
+		r := data[:n]
+		data = data[n:]
+		return r
+	}
+
+	next(augSize)
+	cus := next(cuCount * idx.offsz)
+	next(localTUCount*idx.offsz + foreignTUCount*8)
+	idx.buckets = next(bucketCount * 4)
+	if bucketCount > 0 {
+		idx.hashes = next(nameCount * 4)
+	}
+	idx.strOffsets = next(nameCount * idx.offsz)
+	idx.entryOffs = next(nameCount * idx.offsz)
+	abbrevData := next(abbrevSize)
+	if malformed {
+		return nil, nil, errors.New("malformed .debug_names header")
+	}
+	for i := 0; i < cuCount; i++ {
+		idx.cus = append(idx.cus, dwarf.Offset(idx.offset(cus, i)))
+	}
+
+	idx.abbrevs = map[uint64]nameAbbrev{}
+	buf := bytes.NewBuffer(abbrevData)
+	for buf.Len() > 0 {
+		code, _ := util.DecodeULEB128(buf)
+		if code == 0 {
+			break
+		}
+		tag, _ := util.DecodeULEB128(buf)
+		abbrev := nameAbbrev{tag: dwarf.Tag(tag)}
+		for buf.Len() > 0 {
+			idxattr, _ := util.DecodeULEB128(buf)
+			form, _ := util.DecodeULEB128(buf)
+			if idxattr == 0 && form == 0 {
+				break
+			}
+			abbrev.attrs = append(abbrev.attrs, nameAttr{idxattr, form})
+		}
+		idx.abbrevs[code] = abbrev
+	}
+	idx.entryPool = data
+	return idx, rest, nil
+}
+
+// offset returns the i-th offset of the table buf.
+func (idx *nameIndex) offset(buf []byte, i int) uint64 {
+	if idx.offsz == 8 {
+		return idx.byteOrder.Uint64(buf[8*i:])
+	}
+	return uint64(idx.byteOrder.Uint32(buf[4*i:]))
+}
+
+// CoversUnit returns true if the compile unit at offset off is indexed.
+func (names *DebugNames) CoversUnit(off dwarf.Offset) bool {
+	if names == nil {
+		return false
+	}
+	for _, idx := range names.indexes {
+		for _, cu := range idx.cus {
+			if cu == off {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Lookup returns the entries with the given name.
+func (names *DebugNames) Lookup(name string) []NameEntry {
+	if names == nil {
+		return nil
+	}
+	hash := nameHash(name)
+	var r []NameEntry
+	for _, idx := range names.indexes {
+		if len(idx.buckets) == 0 {
+			// No hash table, the names have to be scanned.
+			for i := 0; i < idx.nameCount; i++ {
+				if names.name(idx, i) == name {
+					r = idx.entries(i, r)
+				}
+			}
+			continue
+		}
+		nbuckets := uint32(len(idx.buckets) / 4)
+		i := int(idx.byteOrder.Uint32(idx.buckets[4*(hash%nbuckets):]))
+		if i == 0 {
+			continue
+		}
+		// Names are numbered starting at 1, the names of a bucket are
+		// contiguous.
+		for i--; i < idx.nameCount; i++ {
+			h := idx.byteOrder.Uint32(idx.hashes[4*i:])
+			if h%nbuckets != hash%nbuckets {
+				break
+			}
+			if h == hash && names.name(idx, i) == name {
+				r = idx.entries(i, r)
+			}
+		}
+	}
+	return r
+}
+
+// ForEach calls fn for each name in the index.
+func (names *DebugNames) ForEach(fn func(name string, entries []NameEntry)) {
+	if names == nil {
+		return
+	}
+	for _, idx := range names.indexes {
+		for i := 0; i < idx.nameCount; i++ {
+			fn(names.name(idx, i), idx.entries(i, nil))
+		}
+	}
+}
+
+// name returns the i-th name of idx.
+func (names *DebugNames) name(idx *nameIndex, i int) string {
+	off := idx.offset(idx.strOffsets, i)
+	if off >= uint64(len(names.str)) {
+		return ""
+	}
+	str := names.str[off:]
+	if end := bytes.IndexByte(str, 0); end >= 0 {
+		str = str[:end]
+	}
+	return string(str)
+}
+
+// entries appends the entries of the i-th name of idx to r.
+func (idx *nameIndex) entries(i int, r []NameEntry) []NameEntry {
+	off := idx.offset(idx.entryOffs, i)
+	if off >= uint64(len(idx.entryPool)) {
+		return r
+	}
+	buf := bytes.NewBuffer(idx.entryPool[off:])
+	for buf.Len() > 0 {
+		code, _ := util.DecodeULEB128(buf)
+		if code == 0 {
+			break
+		}
+		abbrev, ok := idx.abbrevs[code]
+		if !ok {
+			break
+		}
+		cuidx := uint64(0)
+		var dieOff uint64
+		hasDie, typeUnit := false, false
+		for _, attr := range abbrev.attrs {
+			v, ok := idx.readForm(buf, attr.form)
+			if !ok {
+				return r
+			}
+			switch attr.idx {
+			case idxCompileUnit:
+				cuidx = v
+			case idxTypeUnit:
+				typeUnit = true
+			case idxDieOffset:
+				dieOff, hasDie = v, true
+			case idxParent, idxTypeHash:
+			}
+		}
+		if !hasDie || typeUnit || cuidx >= uint64(len(idx.cus)) {
+			continue
+		}
+		cu := idx.cus[cuidx]
+		r = append(r, NameEntry{Tag: abbrev.tag, CU: cu, Offset: cu + dwarf.Offset(dieOff)})
+	}
+	return r
+}
+
+func (idx *nameIndex) readForm(buf *bytes.Buffer, form uint64) (uint64, bool) {
+	fixed := func(n int) (uint64, bool) {
+		if buf.Len() < n {
+			return 0, false
+		}
+		b := buf.Next(n)
+		switch n {
+		case 1:
+			return uint64(b[0]), true
+		case 2:
+			return uint64(idx.byteOrder.Uint16(b)), true
+		case 4:
+			return uint64(idx.byteOrder.Uint32(b)), true
+		}
+		return idx.byteOrder.Uint64(b), true
+	}
+	switch form {
+	case formData1, formRef1:
+		return fixed(1)
+	case formData2, formRef2:
+		return fixed(2)
+	case formData4, formRef4:
+		return fixed(4)
+	case formData8, formRef8:
+		return fixed(8)
+	case formUdata, formRefUdata:
+		v, _ := util.DecodeULEB128(buf)
+		return v, true
+	case formSdata:
+		v, _ := util.DecodeSLEB128(buf)
+		return uint64(v), true
+	case formFlagPresent:
+		return 1, true
+	}
+	return 0, false
+}
+
+// nameHash is the hash function of .debug_names, the DJB hash of the case
+// folded name.
+// See DWARFv5 section 6.1.1.4.5 page 150.
+func nameHash(name string) uint32 {
+	h := uint32(5381)
+	var buf [utf8.UTFMax]byte
+	for _, r := range name {
+		if r < utf8.RuneSelf {
+			if 'A' <= r && r <= 'Z' {
+				r += 'a' - 'A'
+			}
+			h = h*33 + uint32(r)
+			continue
+		}
+		n := utf8.EncodeRune(buf[:], unicode.ToLower(r))
+		for _, c := range buf[:n] {
+			h = h*33 + uint32(c)
+		}
+	}
+	return h
+}
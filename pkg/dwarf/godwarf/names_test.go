@@ -0,0 +1,153 @@
+package godwarf
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"sort"
+	"testing"
+)
+
+type testName struct {
+	name   string
+	tag    dwarf.Tag
+	cu     int
+	dieOff uint32
+}
+
+// buildDebugNames returns the contents of a .debug_names section, and of
+// the corresponding .debug_str section, indexing names in two compile
+// units at offsets 0 and 0x100. If nbuckets is 0 the index has no hash
+// table.
+func buildDebugNames(names []testName, nbuckets uint32) ([]byte, []byte) {
+	var str bytes.Buffer
+	str.WriteByte(0)
+
+	if nbuckets > 0 {
+		sort.SliceStable(names, func(i, j int) bool {
+			return nameHash(names[i].name)%nbuckets < nameHash(names[j].name)%nbuckets
+		})
+	}
+
+	// One abbreviation for each tag, with DW_IDX_compile_unit (data1) and
+	// DW_IDX_die_offset (ref4).
+	var abbrevs bytes.Buffer
+	tags := map[dwarf.Tag]byte{}
+	code := byte(1)
+	for _, n := range names {
+		if _, ok := tags[n.tag]; ok {
+			continue
+		}
+		tags[n.tag] = code
+		abbrevs.Write([]byte{code, byte(n.tag), idxCompileUnit, formData1, idxDieOffset, formRef4, 0, 0})
+		code++
+	}
+	abbrevs.WriteByte(0)
+
+	var pool bytes.Buffer
+	var strOffs, entryOffs, hashes bytes.Buffer
+	buckets := make([]uint32, nbuckets)
+	for i, n := range names {
+		binary.Write(&strOffs, binary.LittleEndian, uint32(str.Len()))
+		str.WriteString(n.name)
+		str.WriteByte(0)
+		binary.Write(&entryOffs, binary.LittleEndian, uint32(pool.Len()))
+		pool.Write([]byte{tags[n.tag], byte(n.cu)})
+		binary.Write(&pool, binary.LittleEndian, n.dieOff)
+		pool.WriteByte(0)
+		if nbuckets > 0 {
+			h := nameHash(n.name)
+			binary.Write(&hashes, binary.LittleEndian, h)
+			if buckets[h%nbuckets] == 0 {
+				buckets[h%nbuckets] = uint32(i + 1)
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint16(5))
+	binary.Write(&body, binary.LittleEndian, uint16(0))
+	for _, v := range []uint32{2, 0, 0, nbuckets, uint32(len(names)), uint32(abbrevs.Len()), 0} {
+		binary.Write(&body, binary.LittleEndian, v)
+	}
+	binary.Write(&body, binary.LittleEndian, []uint32{0, 0x100})
+	binary.Write(&body, binary.LittleEndian, buckets)
+	body.Write(hashes.Bytes())
+	body.Write(strOffs.Bytes())
+	body.Write(entryOffs.Bytes())
+	body.Write(abbrevs.Bytes())
+	body.Write(pool.Bytes())
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes(), str.Bytes()
+}
+
+func TestDebugNames(t *testing.T) {
+	for _, nbuckets := range []uint32{0, 1, 3} {
+		names := []testName{
+			{"main.T", dwarf.TagStructType, 0, 0x20},
+			{"int", dwarf.TagBaseType, 0, 0x40},
+			{"main.f", dwarf.TagSubprogram, 1, 0x10},
+			{"int", dwarf.TagBaseType, 1, 0x30},
+		}
+		data, str := buildDebugNames(names, nbuckets)
+		dn, err := ParseDebugNames(data, str)
+		if err != nil {
+			t.Fatalf("nbuckets=%d: %v", nbuckets, err)
+		}
+
+		if !dn.CoversUnit(0) || !dn.CoversUnit(0x100) || dn.CoversUnit(0x200) {
+			t.Errorf("nbuckets=%d: wrong compile units", nbuckets)
+		}
+
+		entries := dn.Lookup("main.T")
+		if len(entries) != 1 || entries[0] != (NameEntry{dwarf.TagStructType, 0, 0x20}) {
+			t.Errorf("nbuckets=%d: Lookup(main.T) = %v", nbuckets, entries)
+		}
+		entries = dn.Lookup("main.f")
+		if len(entries) != 1 || entries[0] != (NameEntry{dwarf.TagSubprogram, 0x100, 0x110}) {
+			t.Errorf("nbuckets=%d: Lookup(main.f) = %v", nbuckets, entries)
+		}
+		if entries = dn.Lookup("int"); len(entries) != 2 {
+			t.Errorf("nbuckets=%d: Lookup(int) = %v", nbuckets, entries)
+		}
+		if entries = dn.Lookup("main.t"); len(entries) != 0 {
+			t.Errorf("nbuckets=%d: Lookup(main.t) = %v", nbuckets, entries)
+		}
+
+		n := 0
+		dn.ForEach(func(name string, entries []NameEntry) { n += len(entries) })
+		if n != len(names) {
+			t.Errorf("nbuckets=%d: ForEach visited %d entries", nbuckets, n)
+		}
+	}
+}
+
+func TestDebugNamesNil(t *testing.T) {
+	dn, err := ParseDebugNames(nil, nil)
+	if dn != nil || err != nil {
+		t.Fatalf("ParseDebugNames(nil) = %v, %v", dn, err)
+	}
+	if dn.CoversUnit(0) || dn.Lookup("int") != nil {
+		t.Error("nil index not empty")
+	}
+	if _, err := ParseDebugNames([]byte{8, 0, 0, 0, 5, 0}, nil); err == nil {
+		t.Error("truncated index parsed")
+	}
+}
+
+func TestNameHash(t *testing.T) {
+	// Case folding, the hash of a name is the DJB hash of its lower case
+	// version.
+	if nameHash("") != 5381 {
+		t.Errorf("wrong hash of the empty string %d", nameHash(""))
+	}
+	if nameHash("a") != 5381*33+'a' {
+		t.Errorf("wrong hash of \"a\" %d", nameHash("a"))
+	}
+	if nameHash("Main.T") != nameHash("main.t") {
+		t.Error("hash is not case insensitive")
+	}
+}
@@ -16,10 +16,12 @@ import (
 // For example GetDebugSectionElf("line") will return the contents of
 // .debug_line, if .debug_line doesn't exist it will try to return the
 // decompressed contents of .zdebug_line.
+// The sections of split DWARF files can be read by adding the suffix, for
+// example GetDebugSectionElf("info.dwo").
 func GetDebugSectionElf(f *elf.File, name string) ([]byte, error) {
 	sec := f.Section(".debug_" + name)
 	if sec != nil {
-		return sec.Data()
+		return elfSectionData(sec)
 	}
 	sec = f.Section(".zdebug_" + name)
 	if sec == nil {
@@ -32,6 +34,17 @@ func GetDebugSectionElf(f *elf.File, name string) ([]byte, error) {
 	return decompressMaybe(b)
 }
 
+// elfSectionData returns the contents of sec. Sections with the
+// SHF_COMPRESSED flag are decompressed by debug/elf, which supports zlib
+// and, since Go 1.21, zstd.
+func elfSectionData(sec *elf.Section) ([]byte, error) {
+	b, err := sec.Data()
+	if err != nil && sec.Flags&elf.SHF_COMPRESSED != 0 {
+		return nil, fmt.Errorf("could not decompress section %s (zstd compression requires Delve to be built with Go 1.21 or later): %v", sec.Name, err)
+	}
+	return b, err
+}
+
 // GetDebugSectionPE returns the data contents of the specified debug
 // section, decompressing it if it is compressed.
 // For example GetDebugSectionPE("line") will return the contents of
@@ -27,6 +27,7 @@ const (
 	AttrGoEmbeddedField dwarf.Attr = 0x2903
 	AttrGoRuntimeType   dwarf.Attr = 0x2904
 	AttrGoPackageName   dwarf.Attr = 0x2905
+	AttrGoClosureOffset dwarf.Attr = 0x2907
 )
 
 // Basic type encodings -- the value for AttrEncoding in a TagBaseType Entry.
@@ -876,6 +877,12 @@ func readType(d *dwarf.Data, name string, r *dwarf.Reader, off dwarf.Offset, typ
 				zeroArray(lastFieldType)
 			}
 		}
+		if t.ReflectKind == reflect.Invalid && t.Kind == "struct" {
+			if gotyp := gccgoStructType(t); gotyp != nil {
+				typ = gotyp
+				typeCache[off] = typ
+			}
+		}
 
 	case dwarf.TagConstType, dwarf.TagVolatileType, dwarf.TagRestrictType:
 		// Type modifier (DWARF v2 §5.2)
@@ -1074,6 +1081,50 @@ Error:
 	return nil, err
 }
 
+// gccgoStructType returns the string or slice type described by t, if t
+// is the runtime representation of a string or a slice emitted by gccgo,
+// which does not emit DW_AT_go_kind.
+func gccgoStructType(t *StructType) Type {
+	hasFields := func(names ...string) bool {
+		if len(t.Field) != len(names) {
+			return false
+		}
+		for i := range names {
+			if t.Field[i].Name != names[i] {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case hasFields("__data", "__length"):
+		str := &StringType{StructType: *t}
+		str.ReflectKind = reflect.String
+		if str.Name == "" {
+			str.Name = "string"
+		}
+		return str
+	case hasFields("__values", "__count", "__capacity"):
+		ptr, ok := t.Field[0].Type.(*PtrType)
+		if !ok {
+			return nil
+		}
+		slice := &SliceType{StructType: *t, ElemType: ptr.Type}
+		slice.ReflectKind = reflect.Slice
+		slice.Field = []*StructField{}
+		for i, name := range []string{"array", "len", "cap"} {
+			f := *t.Field[i]
+			f.Name = name
+			slice.Field = append(slice.Field, &f)
+		}
+		if slice.Name == "" {
+			slice.Name = "[]" + slice.ElemType.String()
+		}
+		return slice
+	}
+	return nil
+}
+
 func zeroArray(t Type) {
 	for {
 		at, ok := t.(*ArrayType)
@@ -3,7 +3,6 @@ package line
 import (
 	"bytes"
 	"encoding/binary"
-	"path/filepath"
 	"strings"
 
 	"github.com/go-delve/delve/pkg/dwarf/util"
@@ -43,6 +42,10 @@ type DebugLineInfo struct {
 	// if normalizeBackslash is true all backslashes (\) will be converted into forward slashes (/)
 	normalizeBackslash bool
 	ptrSize            int
+
+	// debugLineStr is the contents of the .debug_line_str section, used by
+	// DWARFv5 line tables for the DW_FORM_line_strp form.
+	debugLineStr []byte
 }
 
 type FileEntry struct {
@@ -54,8 +57,9 @@ type FileEntry struct {
 
 type DebugLines []*DebugLineInfo
 
-// ParseAll parses all debug_line segments found in data
-func ParseAll(data []byte, logfn func(string, ...interface{}), staticBase uint64, normalizeBackslash bool, ptrSize int) DebugLines {
+// ParseAll parses all debug_line segments found in data, debugLineStr is
+// the contents of the .debug_line_str section, if there is one.
+func ParseAll(data, debugLineStr []byte, logfn func(string, ...interface{}), staticBase uint64, normalizeBackslash bool, ptrSize int) DebugLines {
 	var (
 		lines = make(DebugLines, 0)
 		buf   = bytes.NewBuffer(data)
@@ -63,42 +67,71 @@ func ParseAll(data []byte, logfn func(string, ...interface{}), staticBase uint64
 
 	// We have to parse multiple file name tables here.
 	for buf.Len() > 0 {
-		lines = append(lines, Parse("", buf, logfn, staticBase, normalizeBackslash, ptrSize))
+		lines = append(lines, Parse("", buf, debugLineStr, logfn, staticBase, normalizeBackslash, ptrSize))
 	}
 
 	return lines
 }
 
 // Parse parses a single debug_line segment from buf. Compdir is the
-// DW_AT_comp_dir attribute of the associated compile unit.
-func Parse(compdir string, buf *bytes.Buffer, logfn func(string, ...interface{}), staticBase uint64, normalizeBackslash bool, ptrSize int) *DebugLineInfo {
+// DW_AT_comp_dir attribute of the associated compile unit, debugLineStr is
+// the contents of the .debug_line_str section, if there is one.
+func Parse(compdir string, buf *bytes.Buffer, debugLineStr []byte, logfn func(string, ...interface{}), staticBase uint64, normalizeBackslash bool, ptrSize int) *DebugLineInfo {
 	dbl := new(DebugLineInfo)
 	dbl.Logf = logfn
+	if dbl.Logf == nil {
+		dbl.Logf = func(string, ...interface{}) {}
+	}
+	dbl.debugLineStr = debugLineStr
 	dbl.staticBase = staticBase
 	dbl.ptrSize = ptrSize
 	dbl.Lookup = make(map[string]*FileEntry)
-	dbl.IncludeDirs = append(dbl.IncludeDirs, compdir)
 
 	dbl.stateMachineCache = make(map[uint64]*StateMachine)
 	dbl.lastMachineCache = make(map[uint64]*StateMachine)
 	dbl.normalizeBackslash = normalizeBackslash
 
+	parseHeader(dbl, compdir, buf)
+
+	// Instructions size calculation breakdown:
+	//   - dbl.Prologue.UnitLength is the length of the entire unit, not including the 4 bytes to represent that length.
+	//   - dbl.Prologue.Length is the length of the prologue not including unit length, version or prologue length itself.
+	//   - So you have UnitLength - PrologueLength - (version_length_bytes(2) + prologue_length_bytes(4)).
+	//   - DWARFv5 adds address_size and segment_selector_size, one byte each, before the prologue length.
+	hdrsz := uint32(6)
+	if dbl.Prologue.Version >= 5 {
+		hdrsz += 2
+	}
+	dbl.Instructions = buf.Next(int(dbl.Prologue.UnitLength - dbl.Prologue.Length - hdrsz))
+
+	return dbl
+}
+
+// ParseFileTable parses the header of a single debug_line segment from
+// buf, like Parse, and returns the version of the segment and the entries
+// of its file table, without building the DebugLineInfo of the segment.
+// The rest of the segment is not read.
+func ParseFileTable(compdir string, buf *bytes.Buffer, debugLineStr []byte, normalizeBackslash bool) (version uint16, files []*FileEntry) {
+	dbl := &DebugLineInfo{Logf: func(string, ...interface{}) {}, debugLineStr: debugLineStr, normalizeBackslash: normalizeBackslash}
+	parseHeader(dbl, compdir, buf)
+	return dbl.Prologue.Version, dbl.FileNames
+}
+
+// parseHeader parses the prologue, the directory table and the file table
+// of a debug_line segment. The entries of the file table are added to
+// dbl.Lookup if it is not nil.
+func parseHeader(dbl *DebugLineInfo, compdir string, buf *bytes.Buffer) {
 	parseDebugLinePrologue(dbl, buf)
 	if dbl.Prologue.Version >= 5 {
+		// In DWARFv5 the compilation directory is the first entry of the
+		// directory table.
 		parseIncludeDirs5(dbl, buf)
 		parseFileEntries5(dbl, buf)
 	} else {
+		dbl.IncludeDirs = append(dbl.IncludeDirs, compdir)
 		parseIncludeDirs2(dbl, buf)
 		parseFileEntries2(dbl, buf)
 	}
-
-	// Instructions size calculation breakdown:
-	//   - dbl.Prologue.UnitLength is the length of the entire unit, not including the 4 bytes to represent that length.
-	//   - dbl.Prologue.Length is the length of the prologue not including unit length, version or prologue length itself.
-	//   - So you have UnitLength - PrologueLength - (version_length_bytes(2) + prologue_length_bytes(4)).
-	dbl.Instructions = buf.Next(int(dbl.Prologue.UnitLength - dbl.Prologue.Length - 6))
-
-	return dbl
 }
 
 func parseDebugLinePrologue(dbl *DebugLineInfo, buf *bytes.Buffer) {
@@ -107,14 +140,13 @@ func parseDebugLinePrologue(dbl *DebugLineInfo, buf *bytes.Buffer) {
 	p.UnitLength = binary.LittleEndian.Uint32(buf.Next(4))
 	p.Version = binary.LittleEndian.Uint16(buf.Next(2))
 	if p.Version >= 5 {
-		dbl.ptrSize = int(buf.Next(1)[0])  // address_size
-		dbl.ptrSize += int(buf.Next(1)[0]) // segment_selector_size
+		dbl.ptrSize = int(buf.Next(1)[0]) // address_size
+		buf.Next(1)                       // segment_selector_size
 	}
 
-	// Version 4 or earlier
 	p.Length = binary.LittleEndian.Uint32(buf.Next(4))
 	p.MinInstrLength = uint8(buf.Next(1)[0])
-	if p.Version == 4 {
+	if p.Version >= 4 {
 		p.MaxOpPerInstr = uint8(buf.Next(1)[0])
 	} else {
 		p.MaxOpPerInstr = 1
@@ -148,23 +180,44 @@ func parseIncludeDirs5(info *DebugLineInfo, buf *bytes.Buffer) {
 	dirCount, _ := util.DecodeULEB128(buf)
 	info.IncludeDirs = make([]string, 0, dirCount)
 	for i := uint64(0); i < dirCount; i++ {
+		var dir string
 		dirEntryFormReader.reset()
 		for dirEntryFormReader.next(buf) {
 			switch dirEntryFormReader.contentType {
 			case _DW_LNCT_path:
-				if dirEntryFormReader.formCode != _DW_FORM_string {
-					info.IncludeDirs = append(info.IncludeDirs, dirEntryFormReader.str)
-				} else {
-					//TODO(aarzilli): support debug_string, debug_line_str
-					info.Logf("unsupported string form %#x", dirEntryFormReader.formCode)
-				}
+				dir = info.formString(dirEntryFormReader)
 			case _DW_LNCT_directory_index:
 			case _DW_LNCT_timestamp:
 			case _DW_LNCT_size:
 			case _DW_LNCT_MD5:
 			}
 		}
+		if info.normalizeBackslash {
+			dir = strings.Replace(dir, "\\", "/", -1)
+		}
+		info.IncludeDirs = append(info.IncludeDirs, dir)
+	}
+}
+
+// formString returns the value of a string attribute of an entry of the
+// directory or file tables of DWARFv5.
+func (info *DebugLineInfo) formString(rdr *formReader) string {
+	switch rdr.formCode {
+	case _DW_FORM_string:
+		return rdr.str
+	case _DW_FORM_line_strp:
+		if rdr.u64 < uint64(len(info.debugLineStr)) {
+			if end := bytes.IndexByte(info.debugLineStr[rdr.u64:], 0); end >= 0 {
+				return string(info.debugLineStr[rdr.u64 : rdr.u64+uint64(end)])
+			}
+		}
+		info.Logf("invalid .debug_line_str offset %#x", rdr.u64)
+	case ^uint64(0):
+		// unknown form, already reported
+	default:
+		info.Logf("unsupported string form %#x", rdr.formCode)
 	}
+	return ""
 }
 
 // parseFileEntries2 parses the file table for DWARF 2 through 4
@@ -176,7 +229,9 @@ func parseFileEntries2(info *DebugLineInfo, buf *bytes.Buffer) {
 		}
 
 		info.FileNames = append(info.FileNames, entry)
-		info.Lookup[entry.Path] = entry
+		if info.Lookup != nil {
+			info.Lookup[entry.Path] = entry
+		}
 	}
 }
 
@@ -195,9 +250,9 @@ func readFileEntry(info *DebugLineInfo, buf *bytes.Buffer, exitOnEmptyPath bool)
 	entry.DirIdx, _ = util.DecodeULEB128(buf)
 	entry.LastModTime, _ = util.DecodeULEB128(buf)
 	entry.Length, _ = util.DecodeULEB128(buf)
-	if !filepath.IsAbs(entry.Path) {
+	if !TargetIsAbs(entry.Path, info.normalizeBackslash) {
 		if entry.DirIdx >= 0 && entry.DirIdx < uint64(len(info.IncludeDirs)) {
-			entry.Path = filepath.Join(info.IncludeDirs[entry.DirIdx], entry.Path)
+			entry.Path = TargetJoin(info.IncludeDirs[entry.DirIdx], entry.Path, info.normalizeBackslash)
 		}
 	}
 
@@ -210,20 +265,15 @@ func parseFileEntries5(info *DebugLineInfo, buf *bytes.Buffer) {
 	fileCount, _ := util.DecodeULEB128(buf)
 	info.FileNames = make([]*FileEntry, 0, fileCount)
 	for i := 0; i < int(fileCount); i++ {
+		entry := new(FileEntry)
+		var path string
+		diridx := 0
+
 		fileEntryFormReader.reset()
 		for fileEntryFormReader.next(buf) {
-			entry := new(FileEntry)
-			var path string
-			var diridx int = -1
-
 			switch fileEntryFormReader.contentType {
 			case _DW_LNCT_path:
-				if fileEntryFormReader.formCode != _DW_FORM_string {
-					path = fileEntryFormReader.str
-				} else {
-					//TODO(aarzilli): support debug_string, debug_line_str
-					info.Logf("unsupported string form %#x", fileEntryFormReader.formCode)
-				}
+				path = info.formString(fileEntryFormReader)
 			case _DW_LNCT_directory_index:
 				diridx = int(fileEntryFormReader.u64)
 			case _DW_LNCT_timestamp:
@@ -233,13 +283,42 @@ func parseFileEntries5(info *DebugLineInfo, buf *bytes.Buffer) {
 			case _DW_LNCT_MD5:
 				// not implemented
 			}
+		}
 
-			if diridx >= 0 && !filepath.IsAbs(path) && diridx < len(info.IncludeDirs) {
-				path = filepath.Join(info.IncludeDirs[diridx], path)
-			}
-			entry.Path = path
-			info.FileNames = append(info.FileNames, entry)
+		if info.normalizeBackslash {
+			path = strings.Replace(path, "\\", "/", -1)
+		}
+		if !TargetIsAbs(path, info.normalizeBackslash) && diridx < len(info.IncludeDirs) {
+			path = TargetJoin(info.IncludeDirs[diridx], path, info.normalizeBackslash)
+		}
+		entry.Path = path
+		entry.DirIdx = uint64(diridx)
+		info.FileNames = append(info.FileNames, entry)
+		if info.Lookup != nil {
 			info.Lookup[entry.Path] = entry
 		}
 	}
 }
+
+// initialFile returns the initial value of the file register of the line
+// number state machine, which is file 1.
+func (info *DebugLineInfo) initialFile() string {
+	if entry := info.FileIndex(1); entry != nil {
+		return entry.Path
+	}
+	return ""
+}
+
+// FileIndex returns the entry of the file table with the given index, as
+// used by the DW_AT_decl_file and DW_AT_call_file attributes, which start
+// at 1 before DWARFv5 and at 0 in DWARFv5. Returns nil if there is no such
+// entry.
+func (info *DebugLineInfo) FileIndex(idx int64) *FileEntry {
+	if info.Prologue.Version < 5 {
+		idx--
+	}
+	if idx < 0 || idx >= int64(len(info.FileNames)) {
+		return nil
+	}
+	return info.FileNames[idx]
+}
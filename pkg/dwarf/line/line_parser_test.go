@@ -27,7 +27,7 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
-func grabDebugLineSection(p string, t *testing.T) []byte {
+func grabDebugLineSection(p string, t *testing.T) ([]byte, []byte) {
 	f, err := os.Open(p)
 	if err != nil {
 		t.Fatal(err)
@@ -37,22 +37,25 @@ func grabDebugLineSection(p string, t *testing.T) []byte {
 	ef, err := elf.NewFile(f)
 	if err == nil {
 		data, _ := godwarf.GetDebugSectionElf(ef, "line")
-		return data
+		lineStr, _ := godwarf.GetDebugSectionElf(ef, "line_str")
+		return data, lineStr
 	}
 
 	pf, err := pe.NewFile(f)
 	if err == nil {
 		data, _ := godwarf.GetDebugSectionPE(pf, "line")
-		return data
+		lineStr, _ := godwarf.GetDebugSectionPE(pf, "line_str")
+		return data, lineStr
 	}
 
 	mf, err := macho.NewFile(f)
 	if err == nil {
 		data, _ := godwarf.GetDebugSectionMacho(mf, "line")
-		return data
+		lineStr, _ := godwarf.GetDebugSectionMacho(mf, "line_str")
+		return data, lineStr
 	}
 
-	return nil
+	return nil, nil
 }
 
 const (
@@ -62,6 +65,7 @@ const (
 	lineRangeGo18   uint8  = 10
 	versionGo14     uint16 = 2
 	versionGo111    uint16 = 3
+	versionGo124    uint16 = 5
 	opcodeBaseGo14  uint8  = 10
 	opcodeBaseGo111 uint8  = 11
 )
@@ -71,14 +75,14 @@ func ptrSizeByRuntimeArch() int {
 }
 
 func testDebugLinePrologueParser(p string, t *testing.T) {
-	data := grabDebugLineSection(p, t)
-	debugLines := ParseAll(data, nil, 0, true, ptrSizeByRuntimeArch())
+	data, lineStr := grabDebugLineSection(p, t)
+	debugLines := ParseAll(data, lineStr, nil, 0, true, ptrSizeByRuntimeArch())
 	mainFileFound := false
 
 	for _, dbl := range debugLines {
 		prologue := dbl.Prologue
 
-		if prologue.Version != versionGo14 && prologue.Version != versionGo111 {
+		if prologue.Version != versionGo14 && prologue.Version != versionGo111 && prologue.Version != versionGo124 {
 			t.Fatal("Version not parsed correctly", prologue.Version)
 		}
 
@@ -113,12 +117,20 @@ func testDebugLinePrologueParser(p string, t *testing.T) {
 			}
 		}
 
-		if len(dbl.IncludeDirs) != 1 {
+		if prologue.Version >= 5 {
+			// DWARFv5 lists the compilation directory as the first include
+			// directory.
+			if len(dbl.IncludeDirs) == 0 || dbl.IncludeDirs[0] == "" {
+				t.Fatal("Include dirs not parsed correctly")
+			}
+		} else if len(dbl.IncludeDirs) != 1 {
 			t.Fatal("Include dirs not parsed correctly")
 		}
 
 		for _, ln := range dbl.Lookup {
-			if ln.Path == "<autogenerated>" || strings.HasPrefix(ln.Path, "<missing>_") || ln.Path == "_gomod_.go" {
+			if ln.Path == "<autogenerated>" || strings.HasPrefix(ln.Path, "<missing>_") || ln.Path == "_gomod_.go" || ln.Path == "?" {
+				// "?" is the placeholder used by the Go linker for file 0
+				// of DWARFv5 file tables.
 				continue
 			}
 			if _, err := os.Stat(ln.Path); err != nil {
@@ -172,11 +184,11 @@ func BenchmarkLineParser(b *testing.B) {
 	}
 	defer os.Remove(p)
 
-	data := grabDebugLineSection(p, nil)
+	data, lineStr := grabDebugLineSection(p, nil)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = ParseAll(data, nil, 0, true, ptrSizeByRuntimeArch())
+		_ = ParseAll(data, lineStr, nil, 0, true, ptrSizeByRuntimeArch())
 	}
 }
 
@@ -191,7 +203,7 @@ func loadBenchmarkData(tb testing.TB) DebugLines {
 		tb.Fatal("Could not read test data", err)
 	}
 
-	return ParseAll(data, nil, 0, true, ptrSizeByRuntimeArch())
+	return ParseAll(data, nil, nil, 0, true, ptrSizeByRuntimeArch())
 }
 
 func BenchmarkStateMachine(b *testing.B) {
@@ -311,7 +323,7 @@ func TestDebugLineC(t *testing.T) {
 		t.Fatal("Could not read test data", err)
 	}
 
-	parsed := ParseAll(data, nil, 0, true, ptrSizeByRuntimeArch())
+	parsed := ParseAll(data, nil, nil, 0, true, ptrSizeByRuntimeArch())
 
 	if len(parsed) == 0 {
 		t.Fatal("Parser result is empty")
@@ -360,7 +372,7 @@ func TestDebugLineDwarf4(t *testing.T) {
 		t.Fatal("Could not read test data", err)
 	}
 
-	debugLines := ParseAll(data, nil, 0, true, 8)
+	debugLines := ParseAll(data, nil, nil, 0, true, 8)
 
 	for _, dbl := range debugLines {
 		if dbl.Prologue.Version == 4 {
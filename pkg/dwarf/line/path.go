@@ -0,0 +1,40 @@
+package line
+
+import (
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// The paths recorded in the debug info follow the conventions of the
+// operating system the program was built for, which is not necessarily
+// the host: a core file collected on linux could be opened on windows.
+// TargetIsAbs and TargetJoin handle the paths of windows programs if
+// windows is true and the paths of unix programs otherwise.
+
+// TargetIsAbs reports whether p, a path of the target program, is absolute.
+func TargetIsAbs(p string, windows bool) bool {
+	if !windows {
+		return strings.HasPrefix(p, "/")
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.IsAbs(p)
+	}
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") {
+		return true
+	}
+	return len(p) >= 3 && p[1] == ':' && (p[2] == '/' || p[2] == '\\')
+}
+
+// TargetJoin joins dir and p, paths of the target program.
+func TargetJoin(dir, p string, windows bool) string {
+	if windows {
+		if runtime.GOOS == "windows" {
+			return filepath.Join(dir, p)
+		}
+		dir = strings.Replace(dir, "\\", "/", -1)
+		p = strings.Replace(p, "\\", "/", -1)
+	}
+	return path.Join(dir, p)
+}
@@ -0,0 +1,36 @@
+package line
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestTargetPaths(t *testing.T) {
+	for _, tc := range []struct {
+		dir, p  string
+		windows bool
+		abs     bool
+		join    string
+	}{
+		{"/go/src/app", "main.go", false, false, "/go/src/app/main.go"},
+		{"/go/src/app", "/usr/include/stdio.h", false, true, ""},
+		{"/go/src/app", "C:/include/stdio.h", false, false, "/go/src/app/C:/include/stdio.h"},
+		{"C:/src/app", "/usr/include/stdio.h", true, true, ""},
+		{"C:/src/app", "C:/include/stdio.h", true, true, ""},
+	} {
+		if got := TargetIsAbs(tc.p, tc.windows); got != tc.abs {
+			t.Errorf("TargetIsAbs(%q, %v) = %v, want %v", tc.p, tc.windows, got, tc.abs)
+		}
+		if tc.join == "" {
+			continue
+		}
+		if got := TargetJoin(tc.dir, tc.p, tc.windows); got != tc.join {
+			t.Errorf("TargetJoin(%q, %q, %v) = %q, want %q", tc.dir, tc.p, tc.windows, got, tc.join)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if got := TargetJoin("C:\\src\\app", "main.go", true); got != "C:/src/app/main.go" {
+			t.Errorf("TargetJoin of windows paths = %q", got)
+		}
+	}
+}
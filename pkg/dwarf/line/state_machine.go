@@ -113,7 +113,7 @@ func newStateMachine(dbl *DebugLineInfo, instructions []byte, ptrSize int) *Stat
 	}
 	sm := &StateMachine{
 		dbl:         dbl,
-		file:        dbl.FileNames[0].Path,
+		file:        dbl.initialFile(),
 		line:        1,
 		buf:         bytes.NewBuffer(instructions),
 		opcodes:     opcodes,
@@ -381,6 +381,9 @@ func (lineInfo *DebugLineInfo) PrologueEndPC(start, end uint64) (pc uint64, file
 // FirstStmtForLine looks in the half open interval [start, end) for the
 // first PC address marked as stmt for the line at address 'start'.
 func (lineInfo *DebugLineInfo) FirstStmtForLine(start, end uint64) (pc uint64, file string, line int, ok bool) {
+	if lineInfo == nil {
+		return 0, "", 0, false
+	}
 	first := true
 	sm := lineInfo.stateMachineForEntry(start)
 	for {
@@ -433,7 +436,7 @@ func (sm *StateMachine) next() error {
 	}
 	if sm.endSeq {
 		sm.endSeq = false
-		sm.file = sm.dbl.FileNames[0].Path
+		sm.file = sm.dbl.initialFile()
 		sm.line = 1
 		sm.column = 0
 		sm.isa = 0
@@ -235,7 +235,7 @@ func ReadUnitVersions(data []byte) map[dwarf.Offset]uint8 {
 
 			switch unitType {
 			case _DW_UT_compile, _DW_UT_partial:
-				headerSize = 5 + secoffsz
+				headerSize = 4 + secoffsz
 
 			case _DW_UT_skeleton, _DW_UT_split_compile:
 				headerSize = 4 + secoffsz + 8
@@ -252,3 +252,35 @@ func ReadUnitVersions(data []byte) map[dwarf.Offset]uint8 {
 	}
 	return r
 }
+
+// ReadUnitIDs reads the unit ID (also called DWO ID) of the skeleton and
+// split compile units of DWARFv5 in a debug_info section and returns
+// them as a map, indexed by the offset of the first entry of the unit like
+// ReadUnitVersions.
+func ReadUnitIDs(data []byte) map[dwarf.Offset]uint64 {
+	r := make(map[dwarf.Offset]uint64)
+	off := dwarf.Offset(0)
+	for len(data) > 0 {
+		length, dwarf64, version, byteOrder := ReadDwarfLengthVersion(data)
+
+		hdrsz, secoffsz := 4, 4
+		if dwarf64 {
+			hdrsz, secoffsz = 12, 8
+		}
+		if length == 0 || uint64(len(data)-hdrsz) < length {
+			break
+		}
+		unit := data[hdrsz:][:length]
+
+		if version >= 5 && len(unit) >= 4+secoffsz+8 {
+			switch unit[2] {
+			case _DW_UT_skeleton, _DW_UT_split_compile:
+				r[off+dwarf.Offset(hdrsz+4+secoffsz+8)] = byteOrder.Uint64(unit[4+secoffsz:])
+			}
+		}
+
+		data = data[hdrsz+int(length):]
+		off += dwarf.Offset(hdrsz) + dwarf.Offset(length)
+	}
+	return r
+}
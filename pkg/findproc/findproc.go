@@ -0,0 +1,60 @@
+// Package findproc finds processes by the name of their executable.
+package findproc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// pollInterval is how often Wait looks for the process.
+const pollInterval = 100 * time.Millisecond
+
+// ErrCanceled is returned by Wait when it is canceled.
+var ErrCanceled = errors.New("canceled while waiting for the process")
+
+// ErrNotFound is returned by ByName when no process has the specified
+// name.
+type ErrNotFound struct {
+	Name string
+}
+
+func (err *ErrNotFound) Error() string {
+	return fmt.Sprintf("no process called %s", err.Name)
+}
+
+// ByName returns the PID of the newest process, other than the current
+// process, whose executable is called name, matching the base name of the
+// executable.
+func ByName(name string) (int, error) {
+	pid, err := findNewest(name)
+	if err != nil {
+		return 0, err
+	}
+	if pid == 0 {
+		return 0, &ErrNotFound{Name: name}
+	}
+	return pid, nil
+}
+
+// Wait waits until a process whose executable is called name exists, see
+// ByName, and returns its PID. It returns ErrCanceled if cancel is closed
+// first.
+func Wait(name string, cancel <-chan struct{}) (int, error) {
+	for {
+		pid, err := ByName(name)
+		if _, notFound := err.(*ErrNotFound); !notFound {
+			return pid, err
+		}
+		select {
+		case <-cancel:
+			return 0, ErrCanceled
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func isSelf(pid int) bool {
+	return pid == os.Getpid()
+}
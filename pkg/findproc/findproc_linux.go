@@ -0,0 +1,84 @@
+package findproc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// findNewest returns the process called name with the latest start time,
+// or 0 if there are none.
+func findNewest(name string) (int, error) {
+	dir, err := os.Open("/proc")
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+
+	newest, newestStart := 0, uint64(0)
+	for _, entry := range names {
+		pid, err := strconv.Atoi(entry)
+		if err != nil || isSelf(pid) {
+			continue
+		}
+		comm, start, ok := readStat(pid)
+		if !ok {
+			continue
+		}
+		if !matches(pid, comm, name) {
+			continue
+		}
+		if newest == 0 || start > newestStart || (start == newestStart && pid > newest) {
+			newest, newestStart = pid, start
+		}
+	}
+	return newest, nil
+}
+
+// readStat returns the command name and the start time of the process pid,
+// read from /proc/pid/stat. Returns false for processes that have exited.
+func readStat(pid int) (comm string, start uint64, ok bool) {
+	buf, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "", 0, false
+	}
+	// The command name is enclosed in parenthesis and can contain spaces and
+	// parenthesis, the other fields follow the last closing parenthesis.
+	lparen, rparen := bytes.IndexByte(buf, '('), bytes.LastIndexByte(buf, ')')
+	if lparen < 0 || rparen < lparen {
+		return "", 0, false
+	}
+	fields := strings.Fields(string(buf[rparen+1:]))
+	// fields[0] is the state (field 3), fields[19] the start time (field 22).
+	if len(fields) < 20 || fields[0] == "Z" || fields[0] == "X" {
+		return "", 0, false
+	}
+	start, err = strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return string(buf[lparen+1 : rparen]), start, true
+}
+
+// commLen is the maximum length of the command name of a process.
+const commLen = 15
+
+func matches(pid int, comm, name string) bool {
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		return filepath.Base(strings.TrimSuffix(exe, " (deleted)")) == name
+	}
+	// The executable of processes of other users can not be read, the
+	// command name is the base name of the executable truncated.
+	if len(name) > commLen {
+		return false
+	}
+	return comm == name
+}
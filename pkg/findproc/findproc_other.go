@@ -0,0 +1,27 @@
+// +build !linux,!windows
+
+package findproc
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// findNewest returns the process called name with the latest start time,
+// or 0 if there are none.
+func findNewest(name string) (int, error) {
+	out, err := exec.Command("pgrep", "-n", "-x", name).Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok && len(out) == 0 {
+			// No processes matched.
+			return 0, nil
+		}
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil || isSelf(pid) {
+		return 0, err
+	}
+	return pid, nil
+}
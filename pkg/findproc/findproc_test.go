@@ -0,0 +1,74 @@
+package findproc
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func startSleep(t *testing.T, path string) *exec.Cmd {
+	cmd := exec.Command(path, "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestByName(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("not supported")
+	}
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not found")
+	}
+	dir, err := ioutil.TempDir("", "findproc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Uses a copy of sleep with a unique name.
+	buf, err := ioutil.ReadFile(sleep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "findproc-test-sleep"
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, buf, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ByName(name); err == nil {
+		t.Fatal("found a process before starting it")
+	} else if _, notFound := err.(*ErrNotFound); !notFound {
+		t.Fatal(err)
+	}
+
+	first := startSleep(t, path)
+	defer first.Process.Kill()
+	pid, err := ByName(name)
+	if err != nil || pid != first.Process.Pid {
+		t.Fatalf("got %d %v, expected %d", pid, err, first.Process.Pid)
+	}
+
+	second := startSleep(t, path)
+	defer second.Process.Kill()
+	pid, err = Wait(name, nil)
+	if err != nil || pid != second.Process.Pid {
+		t.Fatalf("got %d %v, expected the newest process %d", pid, err, second.Process.Pid)
+	}
+}
+
+func TestWaitCanceled(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("not supported")
+	}
+	cancel := make(chan struct{})
+	close(cancel)
+	if _, err := Wait("findproc-test-does-not-exist", cancel); err != ErrCanceled {
+		t.Fatalf("got %v, expected %v", err, ErrCanceled)
+	}
+}
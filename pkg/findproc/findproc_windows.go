@@ -0,0 +1,7 @@
+package findproc
+
+import "errors"
+
+func findNewest(name string) (int, error) {
+	return 0, errors.New("finding processes by name is not supported on windows")
+}
@@ -0,0 +1,212 @@
+// Package fuzzy implements the ranking of symbol names used by symbol
+// search, which matches a query against the names like the symbol pickers
+// of editors do: the characters of the query must appear in the name in
+// the same order, case insensitively, and matches at the start of the
+// components of the name are preferred.
+package fuzzy
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kinds of match, in order of increasing quality. The kind is the most
+// significant part of the score.
+const (
+	matchSubsequence = 1 + iota
+	matchSubstring
+	matchBoundarySubstring
+	matchShortPrefix
+	matchShort
+	matchFoldedExact
+	matchExact
+)
+
+// Score returns how well name matches query, higher is better. Returns 0
+// if name does not match. Every name matches the empty query.
+func Score(query, name string) int {
+	if query == "" {
+		return 1
+	}
+	lquery, lname := strings.ToLower(query), strings.ToLower(name)
+	short := shortName(lname)
+
+	kind, bonus := 0, 0
+	switch {
+	case name == query:
+		kind = matchExact
+	case lname == lquery:
+		kind = matchFoldedExact
+	case short == lquery:
+		kind = matchShort
+	case strings.HasPrefix(short, lquery):
+		kind = matchShortPrefix
+	default:
+		if substringAtBoundary(name, lname, lquery) >= 0 {
+			kind = matchBoundarySubstring
+		} else if strings.Contains(lname, lquery) {
+			kind = matchSubstring
+		}
+		if kind != 0 {
+			break
+		}
+		var ok bool
+		bonus, ok = subsequence(name, lname, lquery)
+		if !ok {
+			return 0
+		}
+		kind = matchSubsequence
+	}
+	if kind != matchSubsequence && strings.Contains(name, query) {
+		// the case matches too
+		bonus = 512
+	}
+
+	// Between matches of the same quality shorter names are better.
+	n := len(name)
+	if n > 1023 {
+		n = 1023
+	}
+	if bonus > 1023 {
+		bonus = 1023
+	}
+	return kind<<20 | bonus<<10 | (1023 - n)
+}
+
+// shortName returns the last component of the symbol name name, which is
+// the function name, method name, type name or variable name without its
+// package path or receiver.
+func shortName(name string) string {
+	if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		name = name[slash+1:]
+	}
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+	return name
+}
+
+// isBoundary returns true if the i-th byte of name is the start of a
+// component of the name.
+func isBoundary(name string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev, _ := utf8.DecodeLastRuneInString(name[:i])
+	cur, _ := utf8.DecodeRuneInString(name[i:])
+	switch prev {
+	case '.', '/', '_', '(', ')', '*', '[', ']', ' ':
+		return true
+	}
+	return unicode.IsLower(prev) && unicode.IsUpper(cur)
+}
+
+// substringAtBoundary returns the index of the first occurrence of lquery
+// in lname that starts at a boundary of name, or -1.
+func substringAtBoundary(name, lname, lquery string) int {
+	if len(lname) != len(name) {
+		// case folding changed the length of the name, boundaries can not
+		// be mapped back.
+		return -1
+	}
+	for off := 0; off < len(lname); {
+		i := strings.Index(lname[off:], lquery)
+		if i < 0 {
+			return -1
+		}
+		if isBoundary(name, off+i) {
+			return off + i
+		}
+		off += i + 1
+	}
+	return -1
+}
+
+// subsequence returns true if the characters of lquery appear in lname in
+// order, and a bonus for the characters matched at boundaries or
+// following the previous match.
+func subsequence(name, lname, lquery string) (int, bool) {
+	checkBoundary := len(lname) == len(name)
+	bonus := 0
+	i, last := 0, -2
+	for _, c := range lquery {
+		j := strings.IndexRune(lname[i:], c)
+		if j < 0 {
+			return 0, false
+		}
+		j += i
+		if checkBoundary && isBoundary(name, j) {
+			bonus += 8
+		}
+		if j == last+1 {
+			bonus += 4
+		}
+		last = j
+		i = j + utf8.RuneLen(c)
+		if i > len(lname) {
+			i = len(lname)
+		}
+	}
+	return bonus, true
+}
+
+// Match is a name matching a query.
+type Match struct {
+	Index int // index of the name
+	Score int
+}
+
+// Rank returns the names matching query, the best matches first. Matches
+// with the same score are sorted by name. If limit is greater than zero
+// at most limit matches are returned.
+func Rank(query string, names []string, limit int) []Match {
+	worse := func(a, b Match) bool {
+		if a.Score != b.Score {
+			return a.Score < b.Score
+		}
+		if names[a.Index] != names[b.Index] {
+			return names[a.Index] > names[b.Index]
+		}
+		return a.Index > b.Index
+	}
+
+	h := &matchHeap{worse: worse}
+	for i, name := range names {
+		score := Score(query, name)
+		if score == 0 {
+			continue
+		}
+		m := Match{Index: i, Score: score}
+		if limit <= 0 || len(h.matches) < limit {
+			heap.Push(h, m)
+		} else if worse(h.matches[0], m) {
+			h.matches[0] = m
+			heap.Fix(h, 0)
+		}
+	}
+
+	r := h.matches
+	sort.Slice(r, func(i, j int) bool { return worse(r[j], r[i]) })
+	return r
+}
+
+// matchHeap is a heap of matches with the worst match at the top, used to
+// keep the best matches seen so far.
+type matchHeap struct {
+	matches []Match
+	worse   func(a, b Match) bool
+}
+
+func (h *matchHeap) Len() int           { return len(h.matches) }
+func (h *matchHeap) Less(i, j int) bool { return h.worse(h.matches[i], h.matches[j]) }
+func (h *matchHeap) Swap(i, j int)      { h.matches[i], h.matches[j] = h.matches[j], h.matches[i] }
+func (h *matchHeap) Push(x interface{}) { h.matches = append(h.matches, x.(Match)) }
+
+func (h *matchHeap) Pop() interface{} {
+	m := h.matches[len(h.matches)-1]
+	h.matches = h.matches[:len(h.matches)-1]
+	return m
+}
@@ -0,0 +1,72 @@
+package fuzzy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	for _, tc := range []struct {
+		query, name string
+		kind        int
+	}{
+		{"main.main", "main.main", matchExact},
+		{"MAIN.main", "main.main", matchFoldedExact},
+		{"printf", "fmt.Printf", matchShort},
+		{"Print", "fmt.Println", matchShortPrefix},
+		{"ServeHTTP", "net/http.(*ServeMux).ServeHTTP", matchShort},
+		{"mux", "net/http.(*ServeMux).ServeHTTP", matchBoundarySubstring},
+		{"http.get", "net/http.Get", matchBoundarySubstring},
+		{"http.serve", "net/http.(*conn).serve", matchSubsequence},
+		{"ttp", "net/http.Get", matchSubstring},
+		{"nhg", "net/http.Get", matchSubsequence},
+		{"smsh", "net/http.(*ServeMux).ServeHTTP", matchSubsequence},
+		{"xyz", "net/http.Get", 0},
+		{"getx", "net/http.Get", 0},
+	} {
+		score := Score(tc.query, tc.name)
+		if kind := score >> 20; kind != tc.kind {
+			t.Errorf("Score(%q, %q): kind %d, expected %d", tc.query, tc.name, kind, tc.kind)
+		}
+	}
+	if Score("", "main.main") == 0 {
+		t.Error("empty query does not match")
+	}
+}
+
+func TestRank(t *testing.T) {
+	names := []string{
+		"runtime.printlock",
+		"fmt.Fprintf",
+		"fmt.Printf",
+		"main.printf",
+		"fmt.(*pp).printArg",
+		"main.main",
+		"fmt.Sprintf",
+	}
+	rank := func(query string, limit int) []string {
+		var r []string
+		for _, m := range Rank(query, names, limit) {
+			r = append(r, names[m.Index])
+		}
+		return r
+	}
+
+	// Exact short names first, the one with matching case first, then the
+	// substrings.
+	if r, exp := rank("printf", 0), []string{"main.printf", "fmt.Printf", "fmt.Fprintf", "fmt.Sprintf"}; !reflect.DeepEqual(r, exp) {
+		t.Errorf("rank(printf) = %v, expected %v", r, exp)
+	}
+	if r, exp := rank("print", 0), []string{"main.printf", "runtime.printlock", "fmt.(*pp).printArg", "fmt.Printf", "fmt.Fprintf", "fmt.Sprintf"}; !reflect.DeepEqual(r, exp) {
+		t.Errorf("rank(print) = %v, expected %v", r, exp)
+	}
+	if r := rank("printf", 2); !reflect.DeepEqual(r, []string{"main.printf", "fmt.Printf"}) {
+		t.Errorf("rank(printf, 2) = %v", r)
+	}
+	if r := rank("zzz", 0); len(r) != 0 {
+		t.Errorf("rank(zzz) = %v", r)
+	}
+	if r := rank("", 3); !reflect.DeepEqual(r, []string{"fmt.(*pp).printArg", "fmt.Fprintf", "fmt.Printf"}) {
+		t.Errorf("rank(\"\", 3) = %v", r)
+	}
+}
@@ -0,0 +1,280 @@
+// Package k8s attaches a headless instance of Delve to a process running in
+// a container of a Kubernetes pod, using kubectl, and forwards its port to
+// the local machine.
+package k8s
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the port the headless instance of Delve listens at, in the
+// network namespace of the pod.
+const DefaultPort = 2345
+
+// DefaultRemotePath is the path of the copy of dlv in the container.
+const DefaultRemotePath = "/tmp/dlv"
+
+// startTimeout is how long Attach waits for the headless instance of Delve
+// and for the port forwarding to start.
+const startTimeout = 2 * time.Minute
+
+// Options describes the process to attach to and how.
+type Options struct {
+	// Kubectl is the path of kubectl, the one found in PATH if empty.
+	Kubectl string
+	// Context and Namespace are the context and the namespace passed to
+	// kubectl, the defaults of kubectl if empty.
+	Context, Namespace string
+	// Pod is the name of the pod.
+	Pod string
+	// Container is the name of the container, the default container of the
+	// pod if empty.
+	Container string
+	// PID is the ID of the process to attach to, in the PID namespace of the
+	// container, 1 if zero.
+	PID int
+
+	// Image, if set, is an image containing dlv in its PATH: it is run as
+	// an ephemeral container of the pod, targeting Container, instead of
+	// copying dlv into Container. Needed by containers without tar, which
+	// is used by kubectl cp.
+	Image string
+	// Dlv is the local executable copied into the container when Image is
+	// not set. It must be built for the OS and the architecture of the
+	// node, and statically linked (with CGO_ENABLED=0).
+	Dlv string
+	// RemotePath is the path of the copy of dlv in the container,
+	// DefaultRemotePath if empty.
+	RemotePath string
+
+	// Port is the port the headless instance of Delve listens at, in the
+	// pod, DefaultPort if zero.
+	Port int
+	// LocalPort is the local port forwarded to the headless instance of
+	// Delve, a random port if zero.
+	LocalPort int
+	// Args are additional arguments of dlv attach, for example "--continue".
+	Args []string
+	// Output receives the output of kubectl and of the headless instance
+	// of Delve, os.Stderr if nil.
+	Output io.Writer
+}
+
+// Session is a headless instance of Delve attached to a process of a pod,
+// whose port is forwarded to the local machine.
+type Session struct {
+	// Addr is the local address of the headless instance of Delve.
+	Addr string
+
+	dlv         *exec.Cmd
+	portForward *exec.Cmd
+}
+
+// ParseTarget parses a target of the form pod/container, or pod, with an
+// optional "pod/" prefix as accepted by kubectl: pod/name is the pod called
+// name, not the container called name of the pod called pod.
+func ParseTarget(target string) (pod, container string, err error) {
+	fields := strings.Split(target, "/")
+	if len(fields) > 1 && (fields[0] == "pod" || fields[0] == "pods" || fields[0] == "po") {
+		fields = fields[1:]
+	}
+	for _, field := range fields {
+		if field == "" {
+			return "", "", fmt.Errorf("malformed target %q", target)
+		}
+	}
+	switch len(fields) {
+	case 1:
+		return fields[0], "", nil
+	case 2:
+		return fields[0], fields[1], nil
+	}
+	return "", "", fmt.Errorf("malformed target %q, expected pod/container", target)
+}
+
+func (opts *Options) kubectlArgs(args ...string) []string {
+	var r []string
+	if opts.Context != "" {
+		r = append(r, "--context", opts.Context)
+	}
+	if opts.Namespace != "" {
+		r = append(r, "--namespace", opts.Namespace)
+	}
+	return append(r, args...)
+}
+
+// dlvArgs returns the arguments of the headless instance of Delve.
+func (opts *Options) dlvArgs() []string {
+	pid := opts.PID
+	if pid == 0 {
+		pid = 1
+	}
+	args := []string{"attach", strconv.Itoa(pid), "--headless", "--accept-multiclient", "--api-version=2", fmt.Sprintf("--listen=127.0.0.1:%d", opts.port())}
+	return append(args, opts.Args...)
+}
+
+func (opts *Options) port() int {
+	if opts.Port == 0 {
+		return DefaultPort
+	}
+	return opts.Port
+}
+
+func (opts *Options) remotePath() string {
+	if opts.RemotePath == "" {
+		return DefaultRemotePath
+	}
+	return opts.RemotePath
+}
+
+// copyArgs returns the arguments of kubectl copying dlv into the container.
+func (opts *Options) copyArgs() []string {
+	args := []string{"cp", opts.Dlv, opts.Pod + ":" + opts.remotePath()}
+	if opts.Container != "" {
+		args = append(args, "--container", opts.Container)
+	}
+	return opts.kubectlArgs(args...)
+}
+
+// startArgs returns the arguments of kubectl starting the headless instance
+// of Delve, in the container or in an ephemeral container called name.
+func (opts *Options) startArgs(name string) []string {
+	var args []string
+	if opts.Image != "" {
+		args = []string{"debug", opts.Pod, "--image", opts.Image, "--container", name, "--stdin"}
+		if opts.Container != "" {
+			args = append(args, "--target", opts.Container)
+		}
+		args = append(args, "--", "dlv")
+	} else {
+		args = []string{"exec", opts.Pod}
+		if opts.Container != "" {
+			args = append(args, "--container", opts.Container)
+		}
+		args = append(args, "--", opts.remotePath())
+	}
+	return opts.kubectlArgs(append(args, opts.dlvArgs()...)...)
+}
+
+// portForwardArgs returns the arguments of kubectl forwarding the port of
+// the headless instance of Delve.
+func (opts *Options) portForwardArgs() []string {
+	local := ""
+	if opts.LocalPort != 0 {
+		local = strconv.Itoa(opts.LocalPort)
+	}
+	return opts.kubectlArgs("port-forward", "pod/"+opts.Pod, fmt.Sprintf("%s:%d", local, opts.port()))
+}
+
+// Attach starts a headless instance of Delve attached to the process
+// described by opts and forwards its port to the local machine.
+func Attach(opts *Options) (*Session, error) {
+	if opts.Pod == "" {
+		return nil, errors.New("no pod specified")
+	}
+	if opts.Image == "" && opts.Dlv == "" {
+		return nil, errors.New("either an image or a dlv executable must be specified")
+	}
+	kubectl := opts.Kubectl
+	if kubectl == "" {
+		var err error
+		if kubectl, err = exec.LookPath("kubectl"); err != nil {
+			return nil, err
+		}
+	}
+	output := opts.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	if opts.Image == "" {
+		cmd := exec.Command(kubectl, opts.copyArgs()...)
+		cmd.Stdout, cmd.Stderr = output, output
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("could not copy %s to the container: %v", opts.Dlv, err)
+		}
+	}
+
+	s := &Session{}
+	name := fmt.Sprintf("dlv-%d", time.Now().Unix())
+	s.dlv = exec.Command(kubectl, opts.startArgs(name)...)
+	if _, err := start(s.dlv, output, regexp.MustCompile(`^API server listening at: `)); err != nil {
+		return nil, fmt.Errorf("could not start delve: %v", err)
+	}
+
+	s.portForward = exec.Command(kubectl, opts.portForwardArgs()...)
+	m, err := start(s.portForward, output, regexp.MustCompile(`^Forwarding from (127\.0\.0\.1:\d+) -> `))
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("could not forward port %d: %v", opts.port(), err)
+	}
+	s.Addr = m[1]
+	return s, nil
+}
+
+// start starts cmd and waits for it to write a line matching rx to its
+// standard output, returning the submatches. The other lines are copied to
+// output, along with the standard error of cmd.
+func start(cmd *exec.Cmd, output io.Writer, rx *regexp.Regexp) ([]string, error) {
+	cmd.Stderr = output
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	found := make(chan []string, 1)
+	go func() {
+		defer io.Copy(ioutil.Discard, stdout)
+		scan := bufio.NewScanner(stdout)
+		matched := false
+		for scan.Scan() {
+			line := scan.Text()
+			if m := rx.FindStringSubmatch(line); m != nil && !matched {
+				matched = true
+				found <- m
+				continue
+			}
+			fmt.Fprintln(output, line)
+		}
+		if !matched {
+			close(found)
+		}
+	}()
+	select {
+	case m, ok := <-found:
+		if !ok {
+			cmd.Wait()
+			return nil, errors.New("kubectl exited")
+		}
+		return m, nil
+	case <-time.After(startTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, errors.New("timed out")
+	}
+}
+
+// Close stops the port forwarding and kubectl, the headless instance of
+// Delve keeps running in the pod until it is killed by a client.
+func (s *Session) Close() error {
+	for _, cmd := range []*exec.Cmd{s.portForward, s.dlv} {
+		if cmd == nil || cmd.Process == nil {
+			continue
+		}
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	return nil
+}
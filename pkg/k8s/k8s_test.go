@@ -0,0 +1,58 @@
+package k8s
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	for _, tc := range []struct {
+		target, pod, container string
+	}{
+		{"web-1", "web-1", ""},
+		{"web-1/app", "web-1", "app"},
+		{"pod/web-1", "web-1", ""},
+		{"pods/web-1/app", "web-1", "app"},
+		{"pod/app", "app", ""},
+		{"", "", ""},
+		{"web-1/", "", ""},
+		{"a/b/c", "", ""},
+	} {
+		pod, container, err := ParseTarget(tc.target)
+		if tc.pod == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q %q", tc.target, pod, container)
+			}
+			continue
+		}
+		if err != nil || pod != tc.pod || container != tc.container {
+			t.Errorf("%q: got %q %q %v, expected %q %q", tc.target, pod, container, err, tc.pod, tc.container)
+		}
+	}
+}
+
+func TestKubectlArgs(t *testing.T) {
+	opts := &Options{Namespace: "prod", Pod: "web-1", Container: "app", PID: 7, Dlv: "/usr/bin/dlv", Args: []string{"--continue"}}
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{opts.copyArgs(), "--namespace prod cp /usr/bin/dlv web-1:/tmp/dlv --container app"},
+		{opts.startArgs("dlv-1"), "--namespace prod exec web-1 --container app -- /tmp/dlv attach 7 --headless --accept-multiclient --api-version=2 --listen=127.0.0.1:2345 --continue"},
+		{opts.portForwardArgs(), "--namespace prod port-forward pod/web-1 :2345"},
+	} {
+		if got := strings.Join(tc.args, " "); got != tc.expected {
+			t.Errorf("got %q, expected %q", got, tc.expected)
+		}
+	}
+
+	opts = &Options{Context: "staging", Pod: "web-1", Container: "app", Image: "example.com/dlv", Port: 4040, LocalPort: 4041}
+	expected := []string{"--context", "staging", "debug", "web-1", "--image", "example.com/dlv", "--container", "dlv-1", "--stdin", "--target", "app", "--", "dlv", "attach", "1", "--headless", "--accept-multiclient", "--api-version=2", "--listen=127.0.0.1:4040"}
+	if got := opts.startArgs("dlv-1"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+	if got := strings.Join(opts.portForwardArgs(), " "); got != "--context staging port-forward pod/web-1 4041:4040" {
+		t.Errorf("got %q", got)
+	}
+}
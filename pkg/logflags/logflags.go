@@ -11,104 +11,184 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-var debugger = false
-var gdbWire = false
-var lldbServerOutput = false
-var debugLineErrors = false
-var rpc = false
-var dap = false
-var fnCall = false
-var minidump = false
+// subsystem is a component of Delve that produces logs, its level can be
+// changed at any time with SetLevel.
+type subsystem struct {
+	name        string
+	description string
+	fields      logrus.Fields
+	logger      *logrus.Logger
+}
+
+var subsystems = []*subsystem{
+	{name: "debugger", description: "Log debugger commands", fields: logrus.Fields{"layer": "debugger"}},
+	{name: "gdbwire", description: "Log connection to gdbserial backend", fields: logrus.Fields{"layer": "gdbconn"}},
+	{name: "lldbout", description: "Copy output from debugserver/lldb to standard output"},
+	{name: "debuglineerr", description: "Log recoverable errors reading .debug_line"},
+	{name: "rpc", description: "Log all RPC messages", fields: logrus.Fields{"layer": "rpc"}},
+	{name: "dap", description: "Log all DAP messages", fields: logrus.Fields{"layer": "dap"}},
+	{name: "fncall", description: "Log function call protocol", fields: logrus.Fields{"layer": "proc", "kind": "fncall"}},
+	{name: "minidump", description: "Log minidump loading", fields: logrus.Fields{"layer": "core", "kind": "minidump"}},
+}
+
+var (
+	debugger         = subsystems[0]
+	gdbWire          = subsystems[1]
+	lldbServerOutput = subsystems[2]
+	debugLineErrors  = subsystems[3]
+	rpc              = subsystems[4]
+	dap              = subsystems[5]
+	fnCall           = subsystems[6]
+	minidump         = subsystems[7]
+)
 
 var logOut io.WriteCloser
 
-func makeLogger(flag bool, fields logrus.Fields) *logrus.Entry {
-	logger := logrus.New().WithFields(fields)
-	logger.Logger.Formatter = &textFormatter{}
-	if logOut != nil {
-		logger.Logger.Out = logOut
+// logBuffer holds the last entries logged by all subsystems.
+var logBuffer entryBuffer
+
+func init() {
+	for _, s := range subsystems {
+		s.logger = logrus.New()
+		s.logger.Formatter = &textFormatter{}
+		s.logger.Level = logrus.ErrorLevel
+		s.logger.AddHook(&logBuffer)
 	}
-	logger.Logger.Level = logrus.DebugLevel
-	if !flag {
-		logger.Logger.Level = logrus.ErrorLevel
+}
+
+// enabled returns true if the subsystem logs debug messages.
+func (s *subsystem) enabled() bool {
+	return s.logger.IsLevelEnabled(logrus.DebugLevel)
+}
+
+func (s *subsystem) entry() *logrus.Entry {
+	return s.logger.WithFields(s.fields)
+}
+
+func findSubsystem(name string) *subsystem {
+	for _, s := range subsystems {
+		if s.name == name {
+			return s
+		}
 	}
-	return logger
+	return nil
 }
 
 // GdbWire returns true if the gdbserial package should log all the packets
 // exchanged with the stub.
 func GdbWire() bool {
-	return gdbWire
+	return gdbWire.enabled()
 }
 
 // GdbWireLogger returns a configured logger for the gdbserial wire protocol.
 func GdbWireLogger() *logrus.Entry {
-	return makeLogger(gdbWire, logrus.Fields{"layer": "gdbconn"})
+	return gdbWire.entry()
 }
 
 // Debugger returns true if the debugger package should log.
 func Debugger() bool {
-	return debugger
+	return debugger.enabled()
 }
 
 // DebuggerLogger returns a logger for the debugger package.
 func DebuggerLogger() *logrus.Entry {
-	return makeLogger(debugger, logrus.Fields{"layer": "debugger"})
+	return debugger.entry()
 }
 
 // LLDBServerOutput returns true if the output of the LLDB server should be
 // redirected to standard output instead of suppressed.
 func LLDBServerOutput() bool {
-	return lldbServerOutput
+	return lldbServerOutput.enabled()
 }
 
 // DebugLineErrors returns true if pkg/dwarf/line should log its recoverable
 // errors.
 func DebugLineErrors() bool {
-	return debugLineErrors
+	return debugLineErrors.enabled()
 }
 
 // RPC returns true if RPC messages should be logged.
 func RPC() bool {
-	return rpc
+	return rpc.enabled()
 }
 
 // RPCLogger returns a logger for RPC messages.
 func RPCLogger() *logrus.Entry {
-	return makeLogger(rpc, logrus.Fields{"layer": "rpc"})
+	return rpc.entry()
 }
 
 // DAP returns true if dap package should log.
 func DAP() bool {
-	return dap
+	return dap.enabled()
 }
 
 // DAPLogger returns a logger for dap package.
 func DAPLogger() *logrus.Entry {
-	return makeLogger(dap, logrus.Fields{"layer": "dap"})
+	return dap.entry()
 }
 
 // FnCall returns true if the function call protocol should be logged.
 func FnCall() bool {
-	return fnCall
+	return fnCall.enabled()
 }
 
 func FnCallLogger() *logrus.Entry {
-	return makeLogger(fnCall, logrus.Fields{"layer": "proc", "kind": "fncall"})
+	return fnCall.entry()
 }
 
 // Minidump returns true if the minidump loader should be logged.
 func Minidump() bool {
-	return minidump
+	return minidump.enabled()
 }
 
 func MinidumpLogger() *logrus.Entry {
-	return makeLogger(minidump, logrus.Fields{"layer": "core", "kind": "minidump"})
+	return minidump.entry()
+}
+
+// Level is the log level of a subsystem.
+type Level struct {
+	Subsystem   string
+	Description string
+	Level       string
+}
+
+// Levels returns the log levels of all subsystems.
+func Levels() []Level {
+	r := make([]Level, len(subsystems))
+	for i, s := range subsystems {
+		r[i] = Level{Subsystem: s.name, Description: s.description, Level: s.logger.GetLevel().String()}
+	}
+	return r
+}
+
+// SetLevel changes the log level of the specified subsystem to level, one
+// of panic, fatal, error, warning, info, debug or trace. Subsystems log
+// debug messages, lldbout and debuglineerr are only enabled or disabled,
+// by the debug and trace levels, and lldbout is only read when a process
+// is started.
+func SetLevel(name, level string) error {
+	s := findSubsystem(name)
+	if s == nil {
+		return fmt.Errorf("unknown log subsystem %q", name)
+	}
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	s.logger.SetLevel(lvl)
+	return nil
+}
+
+// Buffered returns the last entries logged by all subsystems, oldest
+// first, formatted like the log output.
+func Buffered() []string {
+	return logBuffer.get()
 }
 
 // WriteDAPListeningMessage writes the "DAP server listening" message in dap mode.
@@ -132,10 +212,23 @@ func writeListeningMessage(server string, addr string) {
 
 var errLogstrWithoutLog = errors.New("--log-output specified without --log")
 
-// Setup sets debugger flags based on the contents of logstr.
+// Setup sets debugger flags based on the contents of logstr, a comma
+// separated list of subsystems, each one optionally followed by a colon
+// and its level, debug if omitted.
 // If logDest is not empty logs will be redirected to the file descriptor or
 // file path specified by logDest.
-func Setup(logFlag bool, logstr string, logDest string) error {
+// If logFormat is "json" logs are written as JSON objects, one per line,
+// otherwise as text.
+func Setup(logFlag bool, logstr string, logDest string, logFormat string) error {
+	var formatter logrus.Formatter
+	switch logFormat {
+	case "", "text":
+		formatter = &textFormatter{}
+	case "json":
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return fmt.Errorf("unknown log format %q", logFormat)
+	}
 	if logDest != "" {
 		n, err := strconv.Atoi(logDest)
 		if err == nil {
@@ -148,6 +241,12 @@ func Setup(logFlag bool, logstr string, logDest string) error {
 			logOut = fh
 		}
 	}
+	for _, s := range subsystems {
+		s.logger.Formatter = formatter
+		if logOut != nil {
+			s.logger.Out = logOut
+		}
+	}
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 	if !logFlag {
 		log.SetOutput(ioutil.Discard)
@@ -161,27 +260,18 @@ func Setup(logFlag bool, logstr string, logDest string) error {
 	}
 	v := strings.Split(logstr, ",")
 	for _, logcmd := range v {
-		// If adding another value, do make sure to
+		// If adding another subsystem, do make sure to
 		// update "Help about logging flags" in commands.go.
-		switch logcmd {
-		case "debugger":
-			debugger = true
-		case "gdbwire":
-			gdbWire = true
-		case "lldbout":
-			lldbServerOutput = true
-		case "debuglineerr":
-			debugLineErrors = true
-		case "rpc":
-			rpc = true
-		case "dap":
-			dap = true
-		case "fncall":
-			fnCall = true
-		case "minidump":
-			minidump = true
-		default:
+		level := "debug"
+		if i := strings.Index(logcmd, ":"); i >= 0 {
+			logcmd, level = logcmd[:i], logcmd[i+1:]
+		}
+		if findSubsystem(logcmd) == nil {
 			fmt.Fprintf(os.Stderr, "Warning: unknown log output value %q, run 'dlv help log' for usage.\n", logcmd)
+			continue
+		}
+		if err := SetLevel(logcmd, level); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -252,3 +342,52 @@ func (f *textFormatter) needsQuoting(text string) bool {
 	}
 	return false
 }
+
+// logBufferSize is the number of entries kept by the log buffer.
+const logBufferSize = 1000
+
+// maxBufferedEntryLen is the maximum length of an entry kept by the log
+// buffer, longer entries, for example the packets of gdbwire reading
+// memory, are truncated.
+const maxBufferedEntryLen = 1024
+
+// entryBuffer is a logrus hook that keeps the last logBufferSize entries
+// logged, so that they can be retrieved when something goes wrong even if
+// the logs are not written anywhere.
+type entryBuffer struct {
+	mu      sync.Mutex
+	entries []string
+	next    int
+}
+
+func (b *entryBuffer) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (b *entryBuffer) Fire(entry *logrus.Entry) error {
+	buf, err := entry.Logger.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	s := strings.TrimSuffix(string(buf), "\n")
+	if len(s) > maxBufferedEntryLen {
+		s = s[:maxBufferedEntryLen] + "..."
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) < logBufferSize {
+		b.entries = append(b.entries, s)
+		return nil
+	}
+	b.entries[b.next] = s
+	b.next = (b.next + 1) % logBufferSize
+	return nil
+}
+
+func (b *entryBuffer) get() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := make([]string, 0, len(b.entries))
+	r = append(r, b.entries[b.next:]...)
+	return append(r, b.entries[:b.next]...)
+}
@@ -0,0 +1,69 @@
+package logflags
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSetLevel(t *testing.T) {
+	if err := Setup(true, "rpc:info,gdbwire", "", "json"); err != nil {
+		t.Fatal(err)
+	}
+	if RPC() || !GdbWire() || Debugger() {
+		t.Errorf("wrong subsystems enabled: rpc %v gdbwire %v debugger %v", RPC(), GdbWire(), Debugger())
+	}
+	levels := map[string]string{}
+	for _, lvl := range Levels() {
+		levels[lvl.Subsystem] = lvl.Level
+	}
+	if levels["rpc"] != "info" || levels["gdbwire"] != "debug" || levels["debugger"] != "error" {
+		t.Errorf("wrong levels %v", levels)
+	}
+
+	if err := SetLevel("rpc", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	if !RPC() {
+		t.Error("rpc not enabled after SetLevel")
+	}
+	if err := SetLevel("rpc", "loud"); err == nil {
+		t.Error("no error for an unknown level")
+	}
+	if err := SetLevel("nothing", "debug"); err == nil {
+		t.Error("no error for an unknown subsystem")
+	}
+	if err := Setup(true, "rpc:loud", "", ""); err == nil {
+		t.Error("no error for an unknown level in --log-output")
+	}
+	if err := Setup(true, "", "", "xml"); err == nil {
+		t.Error("no error for an unknown log format")
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	if err := Setup(true, "minidump", "", "json"); err != nil {
+		t.Fatal(err)
+	}
+	minidump.logger.Out = ioutil.Discard
+	for i := 0; i < logBufferSize+10; i++ {
+		MinidumpLogger().Debugf("entry %d", i)
+	}
+	MinidumpLogger().Debug(strings.Repeat("x", 2*maxBufferedEntryLen))
+	entries := Buffered()
+	if len(entries) != logBufferSize {
+		t.Fatalf("wrong number of entries %d", len(entries))
+	}
+	var first map[string]interface{}
+	if err := json.Unmarshal([]byte(entries[0]), &first); err != nil {
+		t.Fatalf("entry not in JSON format: %v", err)
+	}
+	if first["msg"] != fmt.Sprintf("entry %d", 11) || first["layer"] != "core" || first["level"] != "debug" {
+		t.Errorf("wrong first entry %v", first)
+	}
+	if last := entries[len(entries)-1]; len(last) > maxBufferedEntryLen+3 || !strings.HasSuffix(last, "...") {
+		t.Errorf("long entry not truncated: %d bytes", len(last))
+	}
+}
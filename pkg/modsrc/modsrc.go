@@ -0,0 +1,511 @@
+// Package modsrc fetches the sources of module versions that are not in
+// the local module cache, from the module proxies listed in GOPROXY or
+// directly from their version control system, so that the sources of
+// dependencies can be shown when the program was built on another
+// machine.
+//
+// Downloaded modules are verified, like the go command does, against the
+// go.sum file of the main module of the current directory or, when it
+// does not list them, against the checksum database (GOSUMDB), unless they
+// match GONOSUMDB (or GOPRIVATE) or GOSUMDB is off.
+package modsrc
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrDisabled is returned by Fetch when GOPROXY is set to off.
+var ErrDisabled = errors.New("module downloads disabled by GOPROXY=off")
+
+const defaultProxy = "https://proxy.golang.org,direct"
+
+// maxZipSize is the maximum size of a module zip, as enforced by the go
+// command.
+const maxZipSize = 500 << 20
+
+// fetchTimeout is how long downloading a module can take.
+const fetchTimeout = 2 * time.Minute
+
+var httpClient = &http.Client{Timeout: fetchTimeout}
+
+// SplitCachePath splits path, a file inside the module cache of some
+// machine like "/root/go/pkg/mod/github.com/!foo/bar@v1.2.3/bar.go", into
+// the escaped module path, the escaped version and the path of the file
+// inside the module. Returns false if path is not inside a module cache.
+func SplitCachePath(p string) (mod, version, file string, ok bool) {
+	p = strings.Replace(p, "\\", "/", -1)
+	idx := strings.Index(p, "/pkg/mod/")
+	if idx < 0 {
+		return "", "", "", false
+	}
+	rest := p[idx+len("/pkg/mod/"):]
+	if strings.HasPrefix(rest, "cache/") {
+		return "", "", "", false
+	}
+	at := strings.Index(rest, "@")
+	if at <= 0 {
+		return "", "", "", false
+	}
+	slash := strings.Index(rest[at:], "/")
+	if slash < 0 {
+		return "", "", "", false
+	}
+	mod, version, file = rest[:at], rest[at+1:at+slash], rest[at+slash+1:]
+	if version == "" || file == "" {
+		return "", "", "", false
+	}
+	return mod, version, file, true
+}
+
+var (
+	mu     sync.Mutex
+	failed = map[string]error{}
+)
+
+// CacheDir returns the directory where fetched modules are stored, which
+// can be changed with the DELVE_MODSRC_CACHE environment variable.
+func CacheDir() (string, error) {
+	if dir := os.Getenv("DELVE_MODSRC_CACHE"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dlv", "modsrc"), nil
+}
+
+// Find returns the local path of the file at p, which is a path inside
+// the module cache of some machine (see SplitCachePath), fetching its
+// module if necessary.
+func Find(p string) (string, error) {
+	mod, version, file, ok := SplitCachePath(p)
+	if !ok {
+		return "", fmt.Errorf("%s is not inside a module cache", p)
+	}
+	dir, err := Fetch(mod, version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.FromSlash(file)), nil
+}
+
+// Fetch returns the directory containing the sources of module mod at
+// version, both escaped as in the module cache, downloading them if they
+// are not already in the cache of fetched modules. The sources are
+// downloaded from the proxies listed in GOPROXY, and from the version
+// control system of the module when GOPROXY lists "direct" or when the
+// module matches GOPRIVATE or GONOPROXY, and verified (see the package
+// documentation). Downloads time out after two minutes. Failures are
+// remembered and not retried.
+func Fetch(mod, version string) (string, error) {
+	cache, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	key := mod + "@" + version
+	dir := filepath.Join(cache, filepath.FromSlash(key))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := failed[key]; err != nil {
+		return "", err
+	}
+	if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+		return dir, nil
+	}
+	err = fetch(mod, version, dir)
+	if err != nil {
+		err = fmt.Errorf("could not fetch %s: %v", key, err)
+		failed[key] = err
+		return "", err
+	}
+	return dir, nil
+}
+
+func fetch(mod, version, dir string) error {
+	proxies := os.Getenv("GOPROXY")
+	if proxies == "" {
+		proxies = defaultProxy
+	}
+	umod, err := unescape(mod)
+	if err != nil {
+		return err
+	}
+	uversion, err := unescape(version)
+	if err != nil {
+		return err
+	}
+	if matchPatterns(os.Getenv("GONOPROXY"), umod) || (os.Getenv("GONOPROXY") == "" && matchPatterns(os.Getenv("GOPRIVATE"), umod)) {
+		proxies = "direct"
+	}
+	list := strings.FieldsFunc(proxies, func(r rune) bool { return r == ',' || r == '|' })
+	if len(list) > 0 && list[0] == "off" {
+		return ErrDisabled
+	}
+
+	want, err := goSumHash(umod, uversion)
+	if err != nil {
+		return err
+	}
+	if want == "" && useSumDB(umod) {
+		// Only the go command can check the module against the checksum
+		// database.
+		return fetchGo(umod, uversion, proxies, "", dir)
+	}
+
+	var errs []string
+	for _, proxy := range list {
+		if proxy == "off" {
+			break
+		}
+		if proxy == "direct" {
+			err = fetchGo(umod, uversion, "direct", want, dir)
+		} else {
+			err = fetchProxy(strings.TrimSuffix(proxy, "/"), mod, version, umod+"@"+uversion+"/", want, dir)
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", proxy, err))
+	}
+	if len(errs) == 0 {
+		return errors.New("no module proxy configured")
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// fetchProxy downloads the zip of module mod at version, both escaped,
+// from the module proxy at url and extracts it into dir. The names of the
+// files in the zip start with prefix. The hash of the zip must be want,
+// unless want is empty.
+func fetchProxy(url, mod, version, prefix, want, dir string) error {
+	resp, err := httpClient.Get(fmt.Sprintf("%s/%s/@v/%s.zip", url, mod, version))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxZipSize+1))
+	if err != nil {
+		return err
+	}
+	if len(buf) > maxZipSize {
+		return errors.New("module zip too large")
+	}
+	if want != "" {
+		if err := checkHash(buf, want); err != nil {
+			return err
+		}
+	}
+	return extractZip(buf, prefix, dir)
+}
+
+// fetchGo downloads module mod at version with the go command, using
+// goproxy as GOPROXY, and copies it into dir. The go command checks the
+// module against the checksum database, the hash of the module must also
+// be want, unless want is empty.
+func fetchGo(mod, version, goproxy, want, dir string) error {
+	tmp, err := ioutil.TempDir("", "dlv-modsrc")
+	if err != nil {
+		return err
+	}
+	defer removeModCache(tmp)
+	// Use a temporary module cache, instead of adding the module to the
+	// module cache of the user. GOMODCACHE is ignored before Go 1.15, which
+	// uses the module cache of the first directory of GOPATH.
+	env := append(os.Environ(), "GOPROXY="+goproxy, "GOFLAGS=-mod=mod", "GOPATH="+tmp, "GOMODCACHE="+filepath.Join(tmp, "pkg", "mod"), "GO111MODULE=on")
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", "mod", "download", "-json", mod+"@"+version)
+	cmd.Dir, cmd.Env = tmp, env
+	out, err := cmd.Output()
+	var info struct {
+		Zip   string
+		Sum   string
+		Error string
+	}
+	json.Unmarshal(out, &info)
+	if info.Error != "" {
+		return errors.New(info.Error)
+	}
+	if err != nil {
+		return err
+	}
+	if want != "" && info.Sum != want {
+		return fmt.Errorf("checksum mismatch: downloaded %s, go.sum %s", info.Sum, want)
+	}
+	buf, err := ioutil.ReadFile(info.Zip)
+	if err != nil {
+		return err
+	}
+	return extractZip(buf, mod+"@"+version+"/", dir)
+}
+
+// removeModCache removes dir, containing a module cache whose directories
+// are made read-only by the go command.
+func removeModCache(dir string) error {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			os.Chmod(path, 0700)
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
+
+// useSumDB returns true if module mod must be checked against the checksum
+// database, which is disabled by GOSUMDB=off and for the modules matching
+// GONOSUMDB, or GOPRIVATE if GONOSUMDB is not set.
+func useSumDB(mod string) bool {
+	if os.Getenv("GOSUMDB") == "off" {
+		return false
+	}
+	if nosumdb := os.Getenv("GONOSUMDB"); nosumdb != "" {
+		return !matchPatterns(nosumdb, mod)
+	}
+	return !matchPatterns(os.Getenv("GOPRIVATE"), mod)
+}
+
+// goSumHash returns the hash of module mod at version listed in the go.sum
+// file of the main module of the current directory, or the empty string
+// if it is not listed or there is no main module.
+func goSumHash(mod, version string) (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", nil
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+	f, err := os.Open(filepath.Join(dir, "go.sum"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		if len(fields) == 3 && fields[0] == mod && fields[1] == version {
+			return fields[2], nil
+		}
+	}
+	return "", scan.Err()
+}
+
+// checkHash returns an error if the hash of the module zip buf, as listed
+// in go.sum files, is not want.
+func checkHash(buf []byte, want string) error {
+	got, err := hashZip(buf)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("checksum mismatch: downloaded %s, go.sum %s", got, want)
+	}
+	return nil
+}
+
+// hashZip returns the "h1:" hash of the module zip buf, computed like the
+// go command does: the SHA-256 of the list of the SHA-256 of every file,
+// followed by its name, sorted by name.
+func hashZip(buf []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		return "", err
+	}
+	files := make([]*zip.File, len(zr.File))
+	copy(files, zr.File)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	summary := sha256.New()
+	for _, f := range files {
+		if strings.Contains(f.Name, "\n") {
+			return "", fmt.Errorf("unexpected file %q in module zip", f.Name)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", h.Sum(nil), f.Name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
+
+// extractZip extracts the files of a module zip, whose names all start
+// with prefix, into dir.
+func extractZip(buf []byte, prefix, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		return err
+	}
+	tmp := dir + ".tmp"
+	os.RemoveAll(tmp)
+	for _, f := range zr.File {
+		name, err := zipFileName(f.Name, prefix)
+		if err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		dst := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := extractFile(f, dst); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// zipFileName returns the name of a file of a module zip relative to
+// the root of the module, rejecting names outside of it.
+func zipFileName(name, prefix string) (string, error) {
+	if !strings.HasPrefix(name, prefix) {
+		return "", fmt.Errorf("unexpected file %q in module zip", name)
+	}
+	name = name[len(prefix):]
+	if name == "" || path.IsAbs(name) || strings.Contains(name, "\\") {
+		return "", fmt.Errorf("unexpected file %q in module zip", name)
+	}
+	for _, elem := range strings.Split(strings.TrimSuffix(name, "/"), "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return "", fmt.Errorf("unexpected file %q in module zip", name)
+		}
+	}
+	return name, nil
+}
+
+func extractFile(f *zip.File, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0444)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if err1 := w.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	// Keep the modification time of the zip, otherwise every file looks
+	// newer than the executable.
+	return os.Chtimes(dst, f.Modified, f.Modified)
+}
+
+// Escape escapes a module path or version as done by the module cache and
+// by module proxies, replacing upper case letters with '!' followed by the
+// lower case letter.
+func Escape(s string) string {
+	var buf strings.Builder
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			buf.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// unescape reverses the escaping of module paths and versions used by the
+// module cache and by module proxies, where upper case letters are
+// replaced by '!' followed by the lower case letter.
+func unescape(s string) (string, error) {
+	var buf strings.Builder
+	bang := false
+	for _, r := range s {
+		if r >= utf8.RuneSelf {
+			return "", fmt.Errorf("invalid escaped path %q", s)
+		}
+		switch {
+		case bang:
+			if r < 'a' || r > 'z' {
+				return "", fmt.Errorf("invalid escaped path %q", s)
+			}
+			buf.WriteRune(r - 'a' + 'A')
+			bang = false
+		case r == '!':
+			bang = true
+		case r >= 'A' && r <= 'Z':
+			return "", fmt.Errorf("invalid escaped path %q", s)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	if bang {
+		return "", fmt.Errorf("invalid escaped path %q", s)
+	}
+	return buf.String(), nil
+}
+
+// matchPatterns reports whether a prefix of mod matches one of the comma
+// separated glob patterns in patterns, like GOPRIVATE.
+func matchPatterns(patterns, mod string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		n := strings.Count(pattern, "/") + 1
+		elems := strings.SplitN(mod, "/", n+1)
+		if len(elems) < n {
+			continue
+		}
+		prefix := strings.Join(elems[:n], "/")
+		if ok, _ := path.Match(pattern, prefix); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package modsrc
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitCachePath(t *testing.T) {
+	testCases := []struct {
+		path, mod, version, file string
+		ok                       bool
+	}{
+		{"/root/go/pkg/mod/github.com/!foo/bar@v1.2.3/baz/baz.go", "github.com/!foo/bar", "v1.2.3", "baz/baz.go", true},
+		{`C:\Users\me\go\pkg\mod\example.com\m@v0.0.0-20200101000000-abcdef123456\m.go`, "example.com/m", "v0.0.0-20200101000000-abcdef123456", "m.go", true},
+		{"/root/go/pkg/mod/cache/download/example.com/m/@v/v1.0.0.zip", "", "", "", false},
+		{"/root/go/src/example.com/m/m.go", "", "", "", false},
+		{"/root/go/pkg/mod/example.com/m@v1.0.0", "", "", "", false},
+	}
+	for _, tc := range testCases {
+		mod, version, file, ok := SplitCachePath(tc.path)
+		if mod != tc.mod || version != tc.version || file != tc.file || ok != tc.ok {
+			t.Errorf("SplitCachePath(%q) = %q %q %q %v, expected %q %q %q %v", tc.path, mod, version, file, ok, tc.mod, tc.version, tc.file, tc.ok)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	for in, out := range map[string]string{
+		"github.com/!burnt!sushi/toml": "github.com/BurntSushi/toml",
+		"v1.0.0":                       "v1.0.0",
+		"github.com/Foo":               "",
+		"github.com/!":                 "",
+	} {
+		got, err := unescape(in)
+		if (err != nil) != (out == "") || got != out {
+			t.Errorf("unescape(%q) = %q %v, expected %q", in, got, err, out)
+		}
+		if out != "" && Escape(out) != in {
+			t.Errorf("Escape(%q) = %q, expected %q", out, Escape(out), in)
+		}
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	if !matchPatterns("*.corp.example.com,github.com/org", "git.corp.example.com/x/y") {
+		t.Error("glob pattern did not match")
+	}
+	if !matchPatterns("*.corp.example.com,github.com/org", "github.com/org/repo") {
+		t.Error("prefix pattern did not match")
+	}
+	if matchPatterns("github.com/org", "github.com/organization/repo") {
+		t.Error("pattern matched a different path element")
+	}
+}
+
+func TestUseSumDB(t *testing.T) {
+	for k := range map[string]bool{"GOSUMDB": true, "GONOSUMDB": true, "GOPRIVATE": true} {
+		defer os.Setenv(k, os.Getenv(k))
+	}
+	testCases := []struct {
+		gosumdb, gonosumdb, goprivate string
+		use                           bool
+	}{
+		{"", "", "", true},
+		{"off", "", "", false},
+		{"", "example.com", "", false},
+		{"", "", "example.com", false},
+		{"", "other.com", "example.com", true},
+	}
+	for _, tc := range testCases {
+		os.Setenv("GOSUMDB", tc.gosumdb)
+		os.Setenv("GONOSUMDB", tc.gonosumdb)
+		os.Setenv("GOPRIVATE", tc.goprivate)
+		if use := useSumDB("example.com/m"); use != tc.use {
+			t.Errorf("useSumDB with GOSUMDB=%q GONOSUMDB=%q GOPRIVATE=%q = %v", tc.gosumdb, tc.gonosumdb, tc.goprivate, use)
+		}
+	}
+}
+
+func moduleZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// goodHash is the hash of the zip of example.com/Mod@v1.0.0 served by the
+// test proxy, computed by the go command.
+const goodHash = "h1:j5a9tvWTghRURKDugEd/XWQMdmhnhAkU8ZrqHW1i4uo="
+
+func TestFetchProxy(t *testing.T) {
+	good := moduleZip(t, map[string]string{"example.com/Mod@v1.0.0/mod.go": "package mod\n"})
+	bad := moduleZip(t, map[string]string{"example.com/bad@v1.0.0/../../evil.go": "package evil\n"})
+	tampered := moduleZip(t, map[string]string{"example.com/tampered@v1.0.0/mod.go": "package evil\n"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/example.com/!mod/@v/v1.0.0.zip":
+			w.Write(good)
+		case "/example.com/bad/@v/v1.0.0.zip":
+			w.Write(bad)
+		case "/example.com/tampered/@v/v1.0.0.zip":
+			w.Write(tampered)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	if h, err := hashZip(good); err != nil || h != goodHash {
+		t.Fatalf("wrong hash %q %v", h, err)
+	}
+
+	cache, err := ioutil.TempDir("", "modsrc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+	for k, v := range map[string]string{"DELVE_MODSRC_CACHE": cache, "GOPROXY": srv.URL + ",off", "GOPRIVATE": "", "GONOPROXY": "", "GOSUMDB": "", "GONOSUMDB": "example.com/bad,example.com/missing"} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	// The modules are verified against the go.sum of the main module of
+	// the current directory.
+	mainmod := filepath.Join(cache, "main")
+	os.Mkdir(mainmod, 0755)
+	ioutil.WriteFile(filepath.Join(mainmod, "go.mod"), []byte("module main\n"), 0644)
+	gosum := "example.com/Mod v1.0.0 " + goodHash + "\nexample.com/tampered v1.0.0 " + goodHash + "\n"
+	ioutil.WriteFile(filepath.Join(mainmod, "go.sum"), []byte(gosum), 0644)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(mainmod); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := Find("/root/go/pkg/mod/example.com/!mod@v1.0.0/mod.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(cache, "example.com", "!mod@v1.0.0", "mod.go") {
+		t.Errorf("wrong path %q", path)
+	}
+	if buf, err := ioutil.ReadFile(path); err != nil || string(buf) != "package mod\n" {
+		t.Errorf("wrong contents %q %v", buf, err)
+	}
+
+	if _, err := Fetch("example.com/bad", "v1.0.0"); err == nil {
+		t.Error("zip with files outside of the module extracted")
+	}
+	if _, err := Fetch("example.com/missing", "v1.0.0"); err == nil {
+		t.Error("missing module fetched")
+	}
+	if _, err := Fetch("example.com/tampered", "v1.0.0"); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("module not matching go.sum fetched: %v", err)
+	}
+}
+
+func TestFetchGo(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	good := moduleZip(t, map[string]string{"example.com/Mod@v1.0.0/mod.go": "package mod\n"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/example.com/!mod/@v/v1.0.0.info":
+			w.Write([]byte(`{"Version":"v1.0.0"}`))
+		case "/example.com/!mod/@v/v1.0.0.mod":
+			w.Write([]byte("module example.com/Mod\n"))
+		case "/example.com/!mod/@v/v1.0.0.zip":
+			w.Write(good)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	root, err := ioutil.TempDir("", "modsrc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	gopath, tmpdir, dir := filepath.Join(root, "gopath"), filepath.Join(root, "tmp"), filepath.Join(root, "src")
+	os.Mkdir(tmpdir, 0755)
+	for k, v := range map[string]string{"GOPATH": gopath, "TMPDIR": tmpdir, "GOSUMDB": "off", "GOFLAGS": "", "GOTOOLCHAIN": "local"} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+	// Without GOMODCACHE the module cache of the user is in GOPATH.
+	if v, ok := os.LookupEnv("GOMODCACHE"); ok {
+		defer os.Setenv("GOMODCACHE", v)
+		os.Unsetenv("GOMODCACHE")
+	}
+
+	if err := fetchGo("example.com/Mod", "v1.0.0", srv.URL, goodHash, dir); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadFile(filepath.Join(dir, "mod.go")); err != nil || string(buf) != "package mod\n" {
+		t.Errorf("wrong contents %q %v", buf, err)
+	}
+	if _, err := os.Stat(filepath.Join(gopath, "pkg", "mod")); !os.IsNotExist(err) {
+		t.Errorf("module cache of GOPATH modified: %v", err)
+	}
+	if fis, _ := ioutil.ReadDir(tmpdir); len(fis) != 0 {
+		t.Errorf("temporary module cache not removed: %s", fis[0].Name())
+	}
+}
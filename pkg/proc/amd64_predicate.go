@@ -0,0 +1,390 @@
+package proc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/token"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// amd64PredicateJumpLen is the length of the jmp rel32 instruction that
+// replaces the code at the address of a predicate.
+const amd64PredicateJumpLen = 5
+
+// amd64PredicateStack is how far the code of a predicate moves the stack
+// pointer before reading variables: it skips the red zone and saves RFLAGS,
+// RAX and RCX, see amd64PredicateEnter.
+const amd64PredicateStack = 128 + 3*8
+
+var (
+	amd64PredicateEnter = []byte{
+		0x48, 0x8d, 0x64, 0x24, 0x80, // lea rsp, [rsp-128]
+		0x9c, // pushfq
+		0x50, // push rax
+		0x51, // push rcx
+	}
+	amd64PredicateLeave = []byte{
+		0x59,                                           // pop rcx
+		0x58,                                           // pop rax
+		0x9d,                                           // popfq
+		0x48, 0x8d, 0xa4, 0x24, 0x80, 0x00, 0x00, 0x00, // lea rsp, [rsp+128]
+	}
+)
+
+// amd64DwarfToX86 maps DWARF register numbers to the numbers used to
+// encode them in instructions.
+var amd64DwarfToX86 = []int{0, 2, 1, 3, 6, 7, 5, 4, 8, 9, 10, 11, 12, 13, 14, 15}
+
+const (
+	x86RAX = 0
+	x86RCX = 1
+	x86RSP = 4
+)
+
+// amd64PredicateRelocate returns the instructions starting at addr, at
+// least amd64PredicateJumpLen bytes long, that a predicate executes in
+// place of the code replaced by its jump. Returns an error if they can not
+// be moved, because they refer to the PC or transfer control, or if other
+// instructions of fn jump in the middle of them.
+func amd64PredicateRelocate(mem MemoryReader, bpmap *BreakpointMap, fn *Function, addr uint64) ([]byte, error) {
+	if addr < fn.Entry || addr >= fn.End {
+		return nil, fmt.Errorf("%#x is not in %s", addr, fn.Name)
+	}
+	text := make([]byte, fn.End-fn.Entry)
+	if _, err := mem.ReadMemory(text, uintptr(fn.Entry)); err != nil {
+		return nil, err
+	}
+	for _, bp := range bpmap.M {
+		if bp.Addr >= fn.Entry && bp.Addr < fn.End {
+			copy(text[bp.Addr-fn.Entry:], bp.OriginalData)
+		}
+	}
+
+	found := false
+	end := addr
+	var targets []uint64
+	for pc := fn.Entry; pc < fn.End; {
+		inst, err := x86asm.Decode(text[pc-fn.Entry:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode instruction at %#x: %v", pc, err)
+		}
+		next := pc + uint64(inst.Len)
+		if (inst.Op == x86asm.JMP || inst.Op == x86asm.LJMP) && !isRelArg(inst.Args[0]) {
+			// Jump tables could jump anywhere.
+			return nil, fmt.Errorf("indirect jump at %#x", pc)
+		}
+		for _, arg := range inst.Args {
+			if rel, isrel := arg.(x86asm.Rel); isrel {
+				targets = append(targets, uint64(int64(next)+int64(rel)))
+			}
+		}
+		if pc == addr {
+			found = true
+		}
+		if found && pc < addr+amd64PredicateJumpLen {
+			if !amd64Relocatable(inst) {
+				return nil, fmt.Errorf("instruction %s at %#x can not be moved", inst.Op, pc)
+			}
+			end = next
+		}
+		pc = next
+	}
+	if !found {
+		return nil, fmt.Errorf("no instruction at %#x", addr)
+	}
+	if end < addr+amd64PredicateJumpLen {
+		return nil, fmt.Errorf("not enough space at %#x", addr)
+	}
+	for _, target := range targets {
+		if target > addr && target < end {
+			return nil, fmt.Errorf("jump to %#x", target)
+		}
+	}
+	return text[addr-fn.Entry : end-fn.Entry], nil
+}
+
+// DisplacedInstruction returns the instruction replaced by bp, modified
+// to have the same effect when executed at addr, so that a thread stopped
+// at bp can step over it without removing bp.
+func DisplacedInstruction(bi *BinaryInfo, mem MemoryReader, bp *Breakpoint, addr uint64) ([]byte, error) {
+	if bi.Arch.Name != "amd64" {
+		return nil, &ErrUnsupportedOnArch{Operation: "displaced instructions", Arch: bi.Arch.Name}
+	}
+	buf := make([]byte, 15) // maximum length of an instruction
+	n, _ := mem.ReadMemory(buf, uintptr(bp.Addr))
+	if n < len(bp.OriginalData) {
+		return nil, fmt.Errorf("could not read instruction at %#x", bp.Addr)
+	}
+	buf = buf[:n]
+	copy(buf, bp.OriginalData)
+	inst, err := x86asm.Decode(buf, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode instruction at %#x: %v", bp.Addr, err)
+	}
+	buf = buf[:inst.Len]
+	switch {
+	case amd64Relocatable(inst):
+	case amd64RIPRelative(inst):
+		disp := int64(int32(binary.LittleEndian.Uint32(buf[inst.PCRelOff:]))) + int64(bp.Addr) - int64(addr)
+		if int64(int32(disp)) != disp {
+			return nil, fmt.Errorf("instruction at %#x can not be moved to %#x", bp.Addr, addr)
+		}
+		binary.LittleEndian.PutUint32(buf[inst.PCRelOff:], uint32(int32(disp)))
+	default:
+		return nil, fmt.Errorf("instruction %s at %#x can not be moved", inst.Op, bp.Addr)
+	}
+	return buf, nil
+}
+
+func isRelArg(arg x86asm.Arg) bool {
+	_, isrel := arg.(x86asm.Rel)
+	return isrel
+}
+
+// amd64Relocatable returns true if inst has the same effect when executed
+// at a different address.
+func amd64Relocatable(inst x86asm.Inst) bool {
+	switch inst.Op {
+	case x86asm.CALL, x86asm.LCALL, x86asm.RET, x86asm.LRET, x86asm.JMP, x86asm.LJMP,
+		x86asm.IRET, x86asm.IRETD, x86asm.IRETQ, x86asm.INT, x86asm.INTO, x86asm.UD1, x86asm.UD2, x86asm.HLT:
+		return false
+	}
+	if inst.PCRel != 0 {
+		return false
+	}
+	for _, arg := range inst.Args {
+		switch arg := arg.(type) {
+		case x86asm.Rel:
+			return false
+		case x86asm.Mem:
+			if arg.Base == x86asm.RIP {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// amd64RIPRelative returns true if inst addresses memory relative to the
+// PC with a 32 bits displacement and would otherwise have the same effect
+// when executed at a different address.
+func amd64RIPRelative(inst x86asm.Inst) bool {
+	if inst.PCRel != 4 {
+		return false
+	}
+	found := false
+	for i, arg := range inst.Args {
+		if arg, ismem := arg.(x86asm.Mem); ismem && arg.Base == x86asm.RIP {
+			inst.Args[i] = nil
+			found = true
+		}
+	}
+	inst.PCRel = 0
+	return found && amd64Relocatable(inst)
+}
+
+// Code returns the code of the predicate, which can be loaded at any
+// address, and the offset in it of the breakpoint instruction executed
+// when the condition is true.
+// The code saves the registers it uses, evaluates the condition and
+// either executes the breakpoint instruction or the instructions replaced
+// by the jump before jumping back after them. The breakpoint instruction
+// is followed by the same instructions, but a thread that executes it
+// should be moved to the address of the breakpoint instead.
+func (p *Predicate) Code() (code []byte, trap int, err error) {
+	code = append(code, amd64PredicateEnter...)
+	var falseJumps []int // offsets of the rel32 of the jumps to the false branch
+	for _, term := range p.terms {
+		code, err = amd64PredicateLoad(code, term)
+		if err != nil {
+			return nil, 0, err
+		}
+		code = append(code, 0x48, 0xb9) // mov rcx, imm64
+		code = appendUint64(code, term.value)
+		code = append(code, 0x48, 0x39, 0xc8) // cmp rax, rcx
+		code = append(code, 0x0f, amd64PredicateJumpIfFalse(term.op, term.signed), 0, 0, 0, 0)
+		falseJumps = append(falseJumps, len(code)-4)
+	}
+
+	code = append(code, amd64PredicateLeave...)
+	trap = len(code)
+	code = append(code, 0xcc) // int3
+	code = p.appendResume(code)
+
+	for _, off := range falseJumps {
+		binary.LittleEndian.PutUint32(code[off:], uint32(int32(len(code)-(off+4))))
+	}
+	code = append(code, amd64PredicateLeave...)
+	code = p.appendResume(code)
+	return code, trap, nil
+}
+
+// appendResume appends the instructions replaced by the jump to the
+// predicate and a jump back to the instruction following them.
+func (p *Predicate) appendResume(code []byte) []byte {
+	code = append(code, p.code...)
+	code = append(code, 0xff, 0x25, 0, 0, 0, 0) // jmp [rip+0]
+	return appendUint64(code, p.Addr+uint64(p.Len))
+}
+
+// Jump returns the instruction that replaces the code at p.Addr to jump to
+// the code of the predicate loaded at address code.
+func (p *Predicate) Jump(code uint64) ([]byte, error) {
+	rel := int64(code) - int64(p.Addr+amd64PredicateJumpLen)
+	if int64(int32(rel)) != rel {
+		return nil, fmt.Errorf("predicate at %#x too far from %#x", code, p.Addr)
+	}
+	jmp := []byte{0xe9, 0, 0, 0, 0} // jmp rel32
+	binary.LittleEndian.PutUint32(jmp[1:], uint32(int32(rel)))
+	return jmp, nil
+}
+
+// amd64PredicateLoad appends the instructions loading the variable of term
+// in RAX, extended to 64 bits.
+func amd64PredicateLoad(code []byte, term predicateTerm) ([]byte, error) {
+	loc := term.loc
+	base := -1
+	if loc.reg >= 0 {
+		if loc.reg >= len(amd64DwarfToX86) {
+			return nil, fmt.Errorf("unsupported register %d", loc.reg)
+		}
+		base = amd64DwarfToX86[loc.reg]
+	}
+	disp := loc.off
+
+	if !loc.mem {
+		switch base {
+		case x86RAX:
+			// saved by amd64PredicateEnter
+			return appendAMD64Load(code, term.size, term.signed, x86RSP, 8)
+		case x86RCX:
+			return appendAMD64Load(code, term.size, term.signed, x86RSP, 0)
+		case x86RSP:
+			return nil, errors.New("unsupported variable in the stack pointer")
+		}
+		rex := byte(0x48)
+		if base >= 8 {
+			rex |= 0x44
+		}
+		code = append(code, rex, 0x89, 0xc0|byte(base&7)<<3) // mov rax, reg
+		return appendAMD64Load(code, term.size, term.signed, -1, 0)
+	}
+
+	switch base {
+	case -1:
+		code = append(code, 0x48, 0xb8) // mov rax, imm64
+		code = appendUint64(code, uint64(disp))
+		base, disp = x86RAX, 0
+	case x86RSP:
+		disp += amd64PredicateStack
+	case x86RAX, x86RCX:
+		// saved by amd64PredicateEnter
+		saved := int64(8)
+		if base == x86RCX {
+			saved = 0
+		}
+		var err error
+		code, err = appendAMD64Load(code, 8, false, x86RSP, saved)
+		if err != nil {
+			return nil, err
+		}
+		base = x86RAX
+	}
+	return appendAMD64Load(code, term.size, term.signed, base, disp)
+}
+
+// appendAMD64Load appends a load of size bytes from [base+disp] into RAX,
+// sign or zero extended to 64 bits. If base is negative the value is
+// already in RAX and is only extended.
+func appendAMD64Load(code []byte, size int, signed bool, base int, disp int64) ([]byte, error) {
+	var rex byte
+	var opcode []byte
+	switch {
+	case size == 8:
+		rex, opcode = 0x48, []byte{0x8b} // mov
+	case size == 4 && signed:
+		rex, opcode = 0x48, []byte{0x63} // movsxd
+	case size == 4:
+		opcode = []byte{0x8b} // mov r32 zero extends
+	case size == 2 && signed:
+		rex, opcode = 0x48, []byte{0x0f, 0xbf} // movsx
+	case size == 2:
+		opcode = []byte{0x0f, 0xb7} // movzx
+	case size == 1 && signed:
+		rex, opcode = 0x48, []byte{0x0f, 0xbe} // movsx
+	case size == 1:
+		opcode = []byte{0x0f, 0xb6} // movzx
+	default:
+		return nil, fmt.Errorf("unsupported size %d", size)
+	}
+
+	if base < 0 {
+		if size == 8 {
+			return code, nil
+		}
+		if rex != 0 {
+			code = append(code, rex)
+		}
+		code = append(code, opcode...)
+		return append(code, 0xc0), nil // rax, rax
+	}
+
+	if int64(int32(disp)) != disp {
+		return nil, fmt.Errorf("offset %#x too large", disp)
+	}
+	if base >= 8 {
+		rex |= 0x41
+	}
+	if rex != 0 {
+		code = append(code, rex)
+	}
+	code = append(code, opcode...)
+	code = append(code, 0x80|byte(base&7)) // rax, [base+disp32]
+	if base&7 == x86RSP {
+		code = append(code, 0x24) // SIB without index
+	}
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(int32(disp)))
+	return append(code, buf[:]...), nil
+}
+
+// amd64PredicateJumpIfFalse returns the second byte of the jcc rel32
+// instruction jumping when the comparison with op of RAX and RCX is false.
+func amd64PredicateJumpIfFalse(op token.Token, signed bool) byte {
+	switch op {
+	case token.EQL:
+		return 0x85 // jne
+	case token.NEQ:
+		return 0x84 // je
+	}
+	if signed {
+		switch op {
+		case token.LSS:
+			return 0x8d // jge
+		case token.LEQ:
+			return 0x8f // jg
+		case token.GTR:
+			return 0x8e // jle
+		default:
+			return 0x8c // jl
+		}
+	}
+	switch op {
+	case token.LSS:
+		return 0x83 // jae
+	case token.LEQ:
+		return 0x87 // ja
+	case token.GTR:
+		return 0x86 // jbe
+	default:
+		return 0x82 // jb
+	}
+}
+
+func appendUint64(code []byte, n uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], n)
+	return append(code, buf[:]...)
+}
@@ -0,0 +1,484 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"reflect"
+	"strconv"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+)
+
+var errFuncCallNotAllowedLitAlloc = errors.New("literal can not be allocated because function calls are not allowed without using 'call'")
+
+// elidedLitType is the type used to parse composite literals without a
+// type (for example "{A: 1, B: 2}"), their type is the type of the
+// variable being assigned.
+const elidedLitType = "_"
+
+// assign writes the value of expr to dstv. Composite literals (and
+// pointers to composite literals) are assigned element by element, all
+// other expressions are evaluated and written with setValue.
+func (scope *EvalScope) assign(dstv *Variable, expr ast.Expr) error {
+	switch expr := expr.(type) {
+	case *ast.CompositeLit:
+		return scope.assignCompositeLit(dstv, expr)
+	case *ast.UnaryExpr:
+		if lit, ok := expr.X.(*ast.CompositeLit); ok && expr.Op == token.AND {
+			return scope.assignPtrToCompositeLit(dstv, lit)
+		}
+	case *ast.ParenExpr:
+		return scope.assign(dstv, expr.X)
+	}
+	srcv, err := scope.evalAST(expr)
+	if err != nil {
+		return err
+	}
+	return scope.setValue(dstv, srcv, exprToString(expr))
+}
+
+// assignCompositeLit assigns the composite literal lit to dstv. If the
+// literal has a type it must be the type of dstv, unless dstv is an
+// interface, in which case the literal is allocated and the interface is
+// set to it.
+func (scope *EvalScope) assignCompositeLit(dstv *Variable, lit *ast.CompositeLit) error {
+	if ident, ok := lit.Type.(*ast.Ident); lit.Type != nil && !(ok && ident.Name == elidedLitType) {
+		typ, err := scope.BinInfo.findTypeExpr(lit.Type)
+		if err != nil {
+			return err
+		}
+		if dstv.Kind == reflect.Interface {
+			tmp, err := scope.allocValue(typ)
+			if err != nil {
+				return err
+			}
+			if err := scope.assignCompositeLit(tmp, &ast.CompositeLit{Elts: lit.Elts}); err != nil {
+				return err
+			}
+			return scope.convertToInterface(tmp, dstv, true)
+		}
+		if !sameType(resolveTypedef(typ), dstv.RealType) {
+			return fmt.Errorf("can not use %s (type %s) as type %s in assignment", exprToString(lit), typ.String(), dstv.TypeString())
+		}
+	}
+
+	switch dstv.Kind {
+	case reflect.Struct:
+		return scope.assignStructLit(dstv, lit)
+	case reflect.Array:
+		t := dstv.RealType.(*godwarf.ArrayType)
+		elts, err := scope.compositeLitElements(lit, t.Count)
+		if err != nil {
+			return err
+		}
+		return scope.assignElements(uint64(dstv.Addr), t.Type, t.Count, elts)
+	case reflect.Slice:
+		return scope.assignSliceLit(dstv, lit)
+	case reflect.Map:
+		return scope.assignMapLit(dstv, lit)
+	case reflect.Interface:
+		return errors.New("the type of a composite literal assigned to an interface must be specified")
+	default:
+		return fmt.Errorf("can not assign a composite literal to a variable of type %s", dstv.TypeString())
+	}
+}
+
+// assignPtrToCompositeLit allocates the composite literal lit and sets
+// the pointer dstv to it.
+func (scope *EvalScope) assignPtrToCompositeLit(dstv *Variable, lit *ast.CompositeLit) error {
+	var typ godwarf.Type
+	if ident, ok := lit.Type.(*ast.Ident); lit.Type != nil && !(ok && ident.Name == elidedLitType) {
+		var err error
+		typ, err = scope.BinInfo.findTypeExpr(lit.Type)
+		if err != nil {
+			return err
+		}
+	} else if ptrtyp, ok := dstv.RealType.(*godwarf.PtrType); ok {
+		typ = ptrtyp.Type
+	} else {
+		return fmt.Errorf("can not assign &%s to a variable of type %s", exprToString(lit), dstv.TypeString())
+	}
+	tmp, err := scope.allocValue(typ)
+	if err != nil {
+		return err
+	}
+	if err := scope.assignCompositeLit(tmp, &ast.CompositeLit{Elts: lit.Elts}); err != nil {
+		return err
+	}
+	ptrtyp, err := scope.BinInfo.findType("*" + typ.String())
+	if err != nil {
+		ptrtyp = pointerTo(typ, scope.BinInfo.Arch)
+	}
+	ptrv := newVariable("", 0, ptrtyp, scope.BinInfo, scope.Mem)
+	ptrv.Children = []Variable{*tmp}
+	ptrv.loaded = true
+	return scope.setValue(dstv, ptrv, "&"+exprToString(lit))
+}
+
+// assignStructLit assigns the struct literal lit to the struct variable
+// dstv, fields that do not appear in the literal are zeroed.
+func (scope *EvalScope) assignStructLit(dstv *Variable, lit *ast.CompositeLit) error {
+	t := dstv.RealType.(*godwarf.StructType)
+	vals := make([]ast.Expr, len(t.Field))
+	keyed := false
+	if len(lit.Elts) > 0 {
+		_, keyed = lit.Elts[0].(*ast.KeyValueExpr)
+	}
+	if !keyed && len(lit.Elts) > 0 && len(lit.Elts) != len(t.Field) {
+		if len(lit.Elts) < len(t.Field) {
+			return fmt.Errorf("too few values in %s literal", dstv.TypeString())
+		}
+		return fmt.Errorf("too many values in %s literal", dstv.TypeString())
+	}
+	for i, elt := range lit.Elts {
+		kv, iskv := elt.(*ast.KeyValueExpr)
+		if iskv != keyed {
+			return errors.New("mixture of field:value and value elements in struct literal")
+		}
+		if !keyed {
+			vals[i] = elt
+			continue
+		}
+		ident, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			return fmt.Errorf("invalid field name %s in struct literal", exprToString(kv.Key))
+		}
+		idx := -1
+		for j, field := range t.Field {
+			if field.Name == ident.Name {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("unknown field %s in struct literal of type %s", ident.Name, dstv.TypeString())
+		}
+		if vals[idx] != nil {
+			return fmt.Errorf("duplicate field name %s in struct literal", ident.Name)
+		}
+		vals[idx] = kv.Value
+	}
+	for i, field := range t.Field {
+		fv, err := dstv.toField(field)
+		if err != nil {
+			return err
+		}
+		if vals[i] == nil {
+			err = fv.writeZero()
+		} else {
+			err = scope.assign(fv, vals[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compositeLitElements returns the elements of the array or slice literal
+// lit indexed by their position, positions not specified by the literal
+// are nil. If maxLen is not negative it is the length of the array type
+// of the literal.
+func (scope *EvalScope) compositeLitElements(lit *ast.CompositeLit, maxLen int64) ([]ast.Expr, error) {
+	var elts []ast.Expr
+	idx := int64(0)
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			keyv, err := scope.evalAST(kv.Key)
+			if err != nil {
+				return nil, err
+			}
+			if keyv.Value == nil || keyv.Value.Kind() != constant.Int {
+				return nil, fmt.Errorf("index %s must be an integer constant", exprToString(kv.Key))
+			}
+			idx, _ = constant.Int64Val(keyv.Value)
+			if idx < 0 {
+				return nil, fmt.Errorf("index %s must be non-negative", exprToString(kv.Key))
+			}
+			elt = kv.Value
+		}
+		if maxLen >= 0 && idx >= maxLen {
+			return nil, fmt.Errorf("index %d out of bounds [0:%d]", idx, maxLen)
+		}
+		for int64(len(elts)) <= idx {
+			elts = append(elts, nil)
+		}
+		if elts[idx] != nil {
+			return nil, fmt.Errorf("duplicate index %d in array or slice literal", idx)
+		}
+		elts[idx] = elt
+		idx++
+	}
+	return elts, nil
+}
+
+// assignElements writes n elements of type typ starting at addr, the
+// values of the elements are taken from elts, elements without a value
+// are zeroed.
+func (scope *EvalScope) assignElements(addr uint64, typ godwarf.Type, n int64, elts []ast.Expr) error {
+	stride := typ.Size()
+	for i := int64(0); i < n; i++ {
+		elemv := newVariable("", uintptr(addr+uint64(i*stride)), typ, scope.BinInfo, scope.Mem)
+		var err error
+		if i < int64(len(elts)) && elts[i] != nil {
+			err = scope.assign(elemv, elts[i])
+		} else {
+			err = elemv.writeZero()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignSliceLit replaces the contents of the slice dstv with the slice
+// literal lit. The backing array of dstv is reused if it is large enough,
+// otherwise a new one is allocated, which requires a function call.
+func (scope *EvalScope) assignSliceLit(dstv *Variable, lit *ast.CompositeLit) error {
+	t := dstv.RealType.(*godwarf.SliceType)
+	elts, err := scope.compositeLitElements(lit, -1)
+	if err != nil {
+		return err
+	}
+	dstv.loadSliceInfo(t)
+	if dstv.Unreadable != nil {
+		return dstv.Unreadable
+	}
+	n := int64(len(elts))
+	base, cap := uint64(dstv.Base), dstv.Cap
+	if n > cap || base == 0 {
+		if n == 0 {
+			return dstv.writeSlice(0, 0, 0)
+		}
+		base, err = scope.allocArray(t.ElemType, n)
+		if err != nil {
+			return err
+		}
+		cap = n
+	}
+	if err := scope.assignElements(base, t.ElemType, n, elts); err != nil {
+		return err
+	}
+	return dstv.writeSlice(n, cap, uintptr(base))
+}
+
+// assignMapLit replaces the contents of the map dstv with the map literal
+// lit, using the runtime functions that implement map operations. A new
+// map is created if dstv is nil.
+func (scope *EvalScope) assignMapLit(dstv *Variable, lit *ast.CompositeLit) error {
+	if scope.callCtx == nil {
+		return errFuncCallNotAllowedLitAlloc
+	}
+	t := dstv.RealType.(*godwarf.MapType)
+	maptype, _, found, err := dwarfToRuntimeType(scope.BinInfo, scope.Mem, dstv.RealType)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("could not find runtime type of %s", dstv.TypeString())
+	}
+	h, err := readUintRaw(scope.Mem, dstv.Addr, int64(scope.BinInfo.Arch.PtrSize()))
+	if err != nil {
+		return err
+	}
+	if h == 0 {
+		h, err = scope.callRuntime("makemap_small")
+		if err != nil {
+			return err
+		}
+		if err := writePointer(scope.BinInfo, scope.Mem, uint64(dstv.Addr), h); err != nil {
+			return err
+		}
+	} else if _, err := scope.callRuntime("mapclear", maptype, h); err != nil {
+		return err
+	}
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return fmt.Errorf("missing key in map literal")
+		}
+		keyv, err := scope.allocValue(t.KeyType)
+		if err != nil {
+			return err
+		}
+		if err := scope.assign(keyv, kv.Key); err != nil {
+			return err
+		}
+		p, err := scope.callRuntime("mapassign", maptype, h, uint64(keyv.Addr))
+		if err != nil {
+			return err
+		}
+		elemv := newVariable("", uintptr(p), t.ElemType, scope.BinInfo, scope.Mem)
+		if err := scope.assign(elemv, kv.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertToInterface sets the interface variable dstv to srcv, a value of
+// a concrete type. Values of types that are not pointer shaped are copied
+// to a newly allocated object, which requires a function call, unless
+// onHeap is set, meaning that srcv was allocated by allocValue.
+func (scope *EvalScope) convertToInterface(srcv, dstv *Variable, onHeap bool) error {
+	typeAddr, typeKind, found, err := dwarfToRuntimeType(scope.BinInfo, scope.Mem, srcv.DwarfType)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("could not find runtime type of %s", srcv.TypeString())
+	}
+	tab := typeAddr
+	if dstv.RealType.String() != "interface {}" {
+		tab, err = scope.findItab(srcv, dstv, typeAddr)
+		if err != nil {
+			return err
+		}
+	}
+	ptrSize := uint64(scope.BinInfo.Arch.PtrSize())
+	if typeKind&kindDirectIface != 0 {
+		datav := newVariable("", dstv.Addr+uintptr(ptrSize), srcv.DwarfType, scope.BinInfo, scope.Mem)
+		if err := scope.setValue(datav, srcv, srcv.Name); err != nil {
+			return err
+		}
+		return writePointer(scope.BinInfo, scope.Mem, uint64(dstv.Addr), tab)
+	}
+	datav := srcv
+	if !onHeap {
+		datav, err = scope.allocValue(srcv.DwarfType)
+		if err != nil {
+			return err
+		}
+		if err := scope.setValue(datav, srcv, srcv.Name); err != nil {
+			return err
+		}
+	}
+	if err := writePointer(scope.BinInfo, scope.Mem, uint64(dstv.Addr), tab); err != nil {
+		return err
+	}
+	return writePointer(scope.BinInfo, scope.Mem, uint64(dstv.Addr)+ptrSize, uint64(datav.Addr))
+}
+
+// findItab returns the address of the itab for the concrete type of srcv
+// and the interface type of dstv. The itab is looked up in the symbol
+// table first, if it isn't there runtime.getitab is called.
+func (scope *EvalScope) findItab(srcv, dstv *Variable, typeAddr uint64) (uint64, error) {
+	typ, iface := srcv.DwarfType.String(), dstv.DwarfType.String()
+	for addr, sym := range scope.BinInfo.SymNames {
+		if sym.Name == "go:itab."+typ+","+iface || sym.Name == "go.itab."+typ+","+iface {
+			return addr, nil
+		}
+	}
+	if scope.callCtx == nil {
+		return 0, fmt.Errorf("could not find itab for %s and %s, function calls are not allowed without using 'call'", typ, iface)
+	}
+	ifaceAddr, _, found, err := dwarfToRuntimeType(scope.BinInfo, scope.Mem, dstv.DwarfType)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("could not find runtime type of %s", iface)
+	}
+	tab, err := scope.callRuntime("getitab", ifaceAddr, typeAddr, true)
+	if err != nil {
+		return 0, err
+	}
+	if tab == 0 {
+		return 0, fmt.Errorf("%s does not implement %s", typ, iface)
+	}
+	return tab, nil
+}
+
+// allocValue allocates a zeroed value of type typ using runtime.mallocgc.
+func (scope *EvalScope) allocValue(typ godwarf.Type) (*Variable, error) {
+	addr, err := scope.allocArray(typ, 1)
+	if err != nil {
+		return nil, err
+	}
+	return newVariable("", uintptr(addr), typ, scope.BinInfo, scope.Mem), nil
+}
+
+// allocArray allocates a zeroed array of n elements of type typ using
+// runtime.mallocgc and returns its address.
+func (scope *EvalScope) allocArray(typ godwarf.Type, n int64) (uint64, error) {
+	if scope.callCtx == nil {
+		return 0, errFuncCallNotAllowedLitAlloc
+	}
+	typeAddr, _, found, err := dwarfToRuntimeType(scope.BinInfo, scope.Mem, typ)
+	if err != nil {
+		return 0, err
+	}
+	if !found && !isBasicKind(newVariable("", 0, typ, scope.BinInfo, scope.Mem).Kind) {
+		// the garbage collector needs the type of objects containing pointers
+		return 0, fmt.Errorf("could not find runtime type of %s", typ.String())
+	}
+	return scope.callRuntime("mallocgc", uint64(typ.Size()*n), typeAddr, true)
+}
+
+// callRuntime calls the runtime function called name and returns its
+// first return value, which must be a pointer. Arguments of type uint64
+// are converted to the type of the corresponding formal argument, zero
+// is converted to nil for pointer arguments.
+func (scope *EvalScope) callRuntime(name string, args ...interface{}) (uint64, error) {
+	if scope.callCtx == nil {
+		return 0, errFuncCallNotAllowed
+	}
+	fn := scope.BinInfo.LookupFunc["runtime."+name]
+	if fn == nil {
+		return 0, fmt.Errorf("could not find runtime.%s", name)
+	}
+	_, formalArgs, err := funcCallArgs(fn, scope.BinInfo, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(formalArgs) != len(args) {
+		return 0, fmt.Errorf("unsupported signature of runtime.%s", name)
+	}
+	node := &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   &ast.Ident{Name: "runtime"},
+			Sel: &ast.Ident{Name: name},
+		},
+	}
+	for i, arg := range args {
+		var argExpr ast.Expr
+		switch arg := arg.(type) {
+		case bool:
+			argExpr = &ast.Ident{Name: strconv.FormatBool(arg)}
+		case uint64:
+			argExpr = &ast.BasicLit{Kind: token.INT, Value: strconv.FormatUint(arg, 10)}
+			if _, isptr := formalArgs[i].typ.(*godwarf.PtrType); isptr {
+				if arg == 0 {
+					argExpr = &ast.Ident{Name: "nil"}
+				} else {
+					argExpr = &ast.CallExpr{
+						Fun:  &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(formalArgs[i].typ.String())},
+						Args: []ast.Expr{argExpr},
+					}
+				}
+			}
+		}
+		node.Args = append(node.Args, argExpr)
+	}
+
+	savedLoadCfg := scope.callCtx.retLoadCfg
+	scope.callCtx.retLoadCfg = loadSingleValue
+	defer func() {
+		scope.callCtx.retLoadCfg = savedLoadCfg
+	}()
+	retv, err := evalFunctionCall(scope, node)
+	if err != nil {
+		return 0, err
+	}
+	if retv.Unreadable != nil {
+		return 0, retv.Unreadable
+	}
+	if (retv.Kind != reflect.Ptr && retv.Kind != reflect.UnsafePointer) || len(retv.Children) != 1 {
+		return 0, internalErrorf("could not interpret return value of runtime.%s call", name)
+	}
+	return uint64(retv.Children[0].Addr), nil
+}
@@ -36,8 +36,16 @@ import (
 
 const (
 	dwarfGoLanguage    = 22   // DW_LANG_Go (from DWARF v5, section 7.12, page 231)
-	dwarfAttrAddrBase  = 0x74 // debug/dwarf.AttrAddrBase in Go 1.14, defined here for compatibility with Go < 1.14
+	dwarfAttrAddrBase  = 0x73 // debug/dwarf.AttrAddrBase in Go 1.14, defined here for compatibility with Go < 1.14
 	dwarfTreeCacheSize = 512  // size of the dwarfTree cache of each image
+
+	// Tag and attributes of split DWARF, see DWARFv5 section 3.1.2 page 66.
+	dwarfTagSkeletonUnit = 0x4a   // debug/dwarf.TagSkeletonUnit in Go 1.14
+	dwarfAttrDwoName     = 0x76   // debug/dwarf.AttrDwoName in Go 1.14
+	dwarfAttrGNUDwoName  = 0x2130 // DW_AT_GNU_dwo_name, used by DWARFv4 split units
+
+	dwarfAttrLinkageName     = dwarf.Attr(0x6e) // debug/dwarf.AttrLinkageName in Go 1.14, defined here for compatibility with Go < 1.14
+	dwarfAttrMIPSLinkageName = 0x2007           // DW_AT_MIPS_linkage_name, used by GCC before DWARFv4
 )
 
 // BinaryInfo holds information on the binaries being executed (this
@@ -67,8 +75,19 @@ type BinaryInfo struct {
 
 	ElfDynamicSection ElfDynamicSection
 
+	// Root is the root directory of the target process, as seen by Delve,
+	// prepended to the paths of its shared libraries. It is set for the
+	// processes running in a different mount namespace than Delve, for
+	// example in a container.
+	Root string
+
 	lastModified time.Time // Time the executable of this process was last modified
 
+	// staleSources are the results of SourceIsStale since the target
+	// stopped.
+	staleSources   map[string]bool
+	staleSourcesMu sync.Mutex
+
 	closer         io.Closer
 	sepDebugCloser io.Closer
 
@@ -90,6 +109,22 @@ type BinaryInfo struct {
 
 	gStructOffset uint64
 
+	tinyGo bool // the executable was built with TinyGo
+	gccgo  bool // the executable was built with gccgo
+
+	// flavor is the flavor of the target, see Target.SetFlavor.
+	flavor Flavor
+
+	// unavailable maps the features that are not available for the
+	// executable to the reason why, see Capabilities.
+	unavailable      map[Feature]string
+	capabilitiesOnce sync.Once
+
+	// rtdesc describes the structures of the runtime of the executable, see
+	// RuntimeDescriptor.
+	rtdesc                *runtimeDescriptor
+	runtimeDescriptorOnce sync.Once
+
 	// nameOfRuntimeType maps an address of a runtime._type struct to its
 	// decoded name. Used with versions of Go <= 1.10 to figure out the DIE of
 	// the concrete type of interfaces.
@@ -130,6 +165,7 @@ var (
 
 	supportedDarwinArch = map[macho.Cpu]bool{
 		macho.CpuAmd64: true,
+		macho.CpuArm64: true,
 	}
 )
 
@@ -190,7 +226,7 @@ func FindFunctionLocation(p Process, funcName string, lineOffset int) ([]uint64,
 		}
 		return r, nil
 	}
-	filename, lineno := origfn.cu.lineInfo.PCToLine(origfn.Entry, origfn.Entry)
+	filename, lineno := origfn.pcToLine(origfn.Entry)
 	return bi.LineToPC(filename, lineno+lineOffset)
 }
 
@@ -199,12 +235,12 @@ func FindFunctionLocation(p Process, funcName string, lineOffset int) ([]uint64,
 // If sameline is set FirstPCAfterPrologue will always return an
 // address associated with the same line as fn.Entry.
 func FirstPCAfterPrologue(p Process, fn *Function, sameline bool) (uint64, error) {
-	pc, _, line, ok := fn.cu.lineInfo.PrologueEndPC(fn.Entry, fn.End)
+	pc, _, line, ok := fn.cu.lines().PrologueEndPC(fn.Entry, fn.End)
 	if ok {
 		if !sameline {
 			return pc, nil
 		}
-		_, entryLine := fn.cu.lineInfo.PCToLine(fn.Entry, fn.Entry)
+		_, entryLine := fn.pcToLine(fn.Entry)
 		if entryLine == line {
 			return pc, nil
 		}
@@ -219,7 +255,7 @@ func FirstPCAfterPrologue(p Process, fn *Function, sameline bool) (uint64, error
 		// Look for the first instruction with the stmt flag set, so that setting a
 		// breakpoint with file:line and with the function name always result on
 		// the same instruction being selected.
-		if pc2, _, _, ok := fn.cu.lineInfo.FirstStmtForLine(fn.Entry, fn.End); ok {
+		if pc2, _, _, ok := fn.cu.lines().FirstStmtForLine(fn.Entry, fn.End); ok {
 			return pc2, nil
 		}
 	}
@@ -275,15 +311,67 @@ type compileUnit struct {
 	lowPC   uint64
 	ranges  [][2]uint64
 
-	entry     *dwarf.Entry        // debug_info entry describing this compile unit
-	isgo      bool                // true if this is the go compile unit
-	lineInfo  *line.DebugLineInfo // debug_line segment associated with this compile unit
-	optimized bool                // this compile unit is optimized
-	producer  string              // producer attribute
+	entry     *dwarf.Entry // debug_info entry describing this compile unit
+	isgo      bool         // true if this is the go compile unit
+	optimized bool         // this compile unit is optimized
+	producer  string       // producer attribute
+
+	// lineInfo is the debug_line segment associated with this compile unit,
+	// it is parsed the first time it is used, by loadLineInfo, and should
+	// be accessed through lines.
+	lineInfo     *line.DebugLineInfo
+	lineInfoOnce sync.Once
+	loadLineInfo func() *line.DebugLineInfo
+	// files are the paths of the entries of the file table of the line
+	// table and lineVersion is the version of the line table, read from its
+	// header, or from the index cache, when the compile unit is loaded.
+	files       []string
+	lineVersion uint16
 
 	offset dwarf.Offset // offset of the entry describing the compile unit
 
 	image *Image // parent image of this compilation unit.
+
+	skeleton *compileUnit // skeleton unit of a split compile unit
+}
+
+// lines returns the line table of cu, parsing it if necessary.
+func (cu *compileUnit) lines() *line.DebugLineInfo {
+	cu.lineInfoOnce.Do(func() {
+		if cu.loadLineInfo != nil {
+			cu.lineInfo = cu.loadLineInfo()
+			cu.loadLineInfo = nil
+		}
+	})
+	return cu.lineInfo
+}
+
+// fileNames returns the paths of the files in the line table of cu.
+func (cu *compileUnit) fileNames() []string {
+	return cu.files
+}
+
+// hasFile returns true if filename is in the line table of cu.
+func (cu *compileUnit) hasFile(filename string) bool {
+	for _, file := range cu.files {
+		if file == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// fileIndex returns the path of the entry of the file table of cu with the
+// given index, like line.DebugLineInfo.FileIndex, without parsing the line
+// table.
+func (cu *compileUnit) fileIndex(idx int64) (string, bool) {
+	if cu.lineVersion < 5 {
+		idx--
+	}
+	if idx < 0 || idx >= int64(len(cu.files)) {
+		return "", false
+	}
+	return cu.files[idx], true
 }
 
 type fileLine struct {
@@ -363,9 +451,17 @@ func (fn *Function) Optimized() bool {
 	return fn.cu.optimized
 }
 
+// pcToLine returns the file and line of pc, which must belong to fn.
+func (fn *Function) pcToLine(pc uint64) (string, int) {
+	if fn.fromPclntab() {
+		return fn.pclntabLine(pc)
+	}
+	return fn.cu.lines().PCToLine(fn.Entry, pc)
+}
+
 // PrologueEndPC returns the PC just after the function prologue
 func (fn *Function) PrologueEndPC() uint64 {
-	pc, _, _, ok := fn.cu.lineInfo.PrologueEndPC(fn.Entry, fn.End)
+	pc, _, _, ok := fn.cu.lines().PrologueEndPC(fn.Entry, fn.End)
 	if !ok {
 		return fn.Entry
 	}
@@ -458,7 +554,14 @@ func loadBinaryInfo(bi *BinaryInfo, image *Image, path string, entryPoint uint64
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
-	switch bi.GOOS {
+	// The loader is chosen by the format of the file rather than by the
+	// operating system of the host, so that, for example, a PE executable
+	// running under WINE on linux can be debugged.
+	goos, err := ExecutableOS(path)
+	if err != nil {
+		goos = bi.GOOS
+	}
+	switch goos {
 	case "linux", "freebsd":
 		return loadBinaryInfoElf(bi, image, path, entryPoint, &wg)
 	case "windows":
@@ -469,6 +572,40 @@ func loadBinaryInfo(bi *BinaryInfo, image *Image, path string, entryPoint uint64
 	return errors.New("unsupported operating system")
 }
 
+// ExecutableOS returns the operating system, as a GOOS value, that the
+// executable at path was built for, determined from its binary format:
+// "linux" or "freebsd" for ELF files, "windows" for PE files and "darwin"
+// for Mach-O files.
+func ExecutableOS(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var magic [4]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return "", fmt.Errorf("could not read %s: %v", path, err)
+	}
+	switch {
+	case string(magic[:]) == elf.ELFMAG:
+		if e, err := elf.NewFile(f); err == nil && e.OSABI == elf.ELFOSABI_FREEBSD {
+			return "freebsd", nil
+		}
+		return "linux", nil
+	case magic[0] == 'M' && magic[1] == 'Z':
+		return "windows", nil
+	}
+	switch binary.LittleEndian.Uint32(magic[:]) {
+	case macho.Magic32, macho.Magic64, macho.MagicFat:
+		return "darwin", nil
+	}
+	switch binary.BigEndian.Uint32(magic[:]) {
+	case macho.Magic32, macho.Magic64, macho.MagicFat:
+		return "darwin", nil
+	}
+	return "", fmt.Errorf("unknown binary format for %s", path)
+}
+
 // GStructOffset returns the offset of the G
 // struct in thread local storage.
 func (bi *BinaryInfo) GStructOffset() uint64 {
@@ -480,6 +617,52 @@ func (bi *BinaryInfo) LastModified() time.Time {
 	return bi.lastModified
 }
 
+// SourceIsStale returns true if the source file, a path as it appears in
+// the debug info, looks different from the file used to build the binary:
+// it was modified after the binary or its length differs from the one
+// recorded in the line table. Line numbers read from the debug info could
+// then be wrong for the file on disk. Files that do not exist are not
+// considered stale.
+// The result is remembered until the target is resumed, see
+// clearStaleSources.
+func (bi *BinaryInfo) SourceIsStale(file string) bool {
+	bi.staleSourcesMu.Lock()
+	defer bi.staleSourcesMu.Unlock()
+	if stale, ok := bi.staleSources[file]; ok {
+		return stale
+	}
+	stale := bi.sourceIsStale(file)
+	if bi.staleSources == nil {
+		bi.staleSources = make(map[string]bool)
+	}
+	bi.staleSources[file] = stale
+	return stale
+}
+
+func (bi *BinaryInfo) sourceIsStale(file string) bool {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+	if !bi.lastModified.IsZero() && fi.ModTime().After(bi.lastModified) {
+		return true
+	}
+	for _, image := range bi.Images {
+		if length, ok := image.sourceLengths[file]; ok && length != uint64(fi.Size()) {
+			return true
+		}
+	}
+	return false
+}
+
+// clearStaleSources forgets the results of SourceIsStale, the source files
+// could be changed while the target runs.
+func (bi *BinaryInfo) clearStaleSources() {
+	bi.staleSourcesMu.Lock()
+	bi.staleSources = nil
+	bi.staleSourcesMu.Unlock()
+}
+
 // DwarfReader returns a reader for the dwarf data
 func (so *Image) DwarfReader() *reader.Reader {
 	return reader.New(so.dwarf)
@@ -491,16 +674,42 @@ func (bi *BinaryInfo) Types() ([]string, error) {
 	for k := range bi.types {
 		types = append(types, k)
 	}
+	for _, image := range bi.Images {
+		image.debugNames.ForEach(func(name string, entries []godwarf.NameEntry) {
+			for _, e := range entries {
+				if !isTypeTag(e.Tag) || len(image.compileUnits) == 0 {
+					continue
+				}
+				if !image.findCompileUnitForOffset(e.CU).isgo {
+					name = "C." + name
+				}
+				if _, exists := bi.types[name]; !exists {
+					types = append(types, name)
+				}
+				break
+			}
+		})
+	}
 	return types, nil
 }
 
+// PackageVarNames returns the names of the package variables of the
+// program.
+func (bi *BinaryInfo) PackageVarNames() []string {
+	r := make([]string, len(bi.packageVars))
+	for i := range bi.packageVars {
+		r[i] = bi.packageVars[i].name
+	}
+	return r
+}
+
 // PCToLine converts an instruction address to a file/line/function.
 func (bi *BinaryInfo) PCToLine(pc uint64) (string, int, *Function) {
 	fn := bi.PCToFunc(pc)
 	if fn == nil {
 		return "", 0, nil
 	}
-	f, ln := fn.cu.lineInfo.PCToLine(fn.Entry, pc)
+	f, ln := fn.pcToLine(pc)
 	return f, ln, fn
 }
 
@@ -526,11 +735,11 @@ func (bi *BinaryInfo) LineToPC(filename string, lineno int) (pcs []uint64, err e
 pcsearch:
 	for _, image := range bi.Images {
 		for _, cu := range image.compileUnits {
-			if cu.lineInfo == nil || cu.lineInfo.Lookup[filename] == nil {
+			if !cu.hasFile(filename) {
 				continue
 			}
 			fileFound = true
-			pc = cu.lineInfo.LineToPC(filename, lineno)
+			pc = cu.lines().LineToPC(filename, lineno)
 			if pc != 0 {
 				break pcsearch
 			}
@@ -573,7 +782,7 @@ func appendLineToPCIn(pcs []uint64, filename string, lineno int, cu *compileUnit
 	if containingFn != nil {
 		entry = containingFn.Entry
 	}
-	pc := cu.lineInfo.LineToPCIn(filename, lineno, entry, lowPC, highPC)
+	pc := cu.lines().LineToPCIn(filename, lineno, entry, lowPC, highPC)
 	if pc != 0 {
 		return append(pcs, pc)
 	}
@@ -588,8 +797,8 @@ func (bi *BinaryInfo) AllPCsForFileLines(filename string, linenos []int) map[int
 	}
 	for _, image := range bi.Images {
 		for _, cu := range image.compileUnits {
-			if cu.lineInfo != nil && cu.lineInfo.Lookup[filename] != nil {
-				cu.lineInfo.AllPCsForFileLines(filename, r)
+			if cu.hasFile(filename) {
+				cu.lines().AllPCsForFileLines(filename, r)
 			}
 		}
 	}
@@ -633,6 +842,42 @@ func (bi *BinaryInfo) PCToInlineFunc(pc uint64) *Function {
 	return bi.LookupFunc[fnname]
 }
 
+// PCToLocations returns the source positions of pc, starting with the
+// innermost inlined function and ending with the concrete function
+// containing pc, each inlined function is followed by the position of its
+// call. Returns nil if pc does not belong to a function.
+func (bi *BinaryInfo) PCToLocations(pc uint64) []Location {
+	file, line, fn := bi.PCToLine(pc)
+	if fn == nil {
+		return nil
+	}
+	cur := Location{PC: pc, File: file, Line: line, Fn: fn}
+	if fn.cu.lines() == nil {
+		return []Location{cur}
+	}
+	dwarfTree, err := fn.cu.image.getDwarfTree(fn.offset)
+	if err != nil {
+		return []Location{cur}
+	}
+	var r []Location
+	for _, entry := range reader.InlineStack(dwarfTree, pc) {
+		fnname, okname := entry.Val(dwarf.AttrName).(string)
+		fileidx, okfileidx := entry.Val(dwarf.AttrCallFile).(int64)
+		callLine, okline := entry.Val(dwarf.AttrCallLine).(int64)
+		if !okname || !okfileidx || !okline {
+			break
+		}
+		callfile := fn.cu.lines().FileIndex(fileidx)
+		if callfile == nil {
+			break
+		}
+		cur.Fn = &Function{Name: fnname, Entry: fn.Entry, End: fn.End, offset: entry.Offset, cu: fn.cu}
+		r = append(r, cur)
+		cur = Location{PC: pc, File: callfile.Path, Line: int(callLine), Fn: fn}
+	}
+	return append(r, cur)
+}
+
 // PCToImage returns the image containing the given PC address.
 func (bi *BinaryInfo) PCToImage(pc uint64) *Image {
 	fn := bi.PCToFunc(pc)
@@ -643,23 +888,41 @@ func (bi *BinaryInfo) PCToImage(pc uint64) *Image {
 type Image struct {
 	Path       string
 	StaticBase uint64
-	addr       uint64
+	// BuildID is the GNU build ID of the image, in hexadecimal, or the
+	// empty string if the image does not have one.
+	BuildID string
+	addr    uint64
 
 	index int // index of this object in BinaryInfo.SharedObjects
 
 	closer         io.Closer
 	sepDebugCloser io.Closer
 
+	// splitOf is the image containing the skeleton units of the compile
+	// units of this image, for split DWARF files.
+	splitOf *Image
+
 	dwarf       *dwarf.Data
 	dwarfReader *dwarf.Reader
 	loclist2    *loclist.Dwarf2Reader
 	loclist5    *loclist.Dwarf5Reader
 	debugAddr   *godwarf.DebugAddrSection
+	// debugLineStr is the contents of .debug_line_str, used by DWARFv5 line
+	// tables.
+	debugLineStr []byte
+	// debugNames is the DWARFv5 name index, if the image has one. The types
+	// of the compile units it covers are looked up in the index instead of
+	// being added to BinaryInfo.types.
+	debugNames *godwarf.DebugNames
 
 	typeCache map[dwarf.Offset]godwarf.Type
 
 	compileUnits []*compileUnit // compileUnits is sorted by increasing DWARF offset
 
+	// sourceLengths are the lengths of the source files recorded in the
+	// file tables of the line tables, for the files that have one.
+	sourceLengths map[string]uint64
+
 	dwarfTreeCache *simplelru.LRU
 
 	// runtimeTypeToDIE maps between the offset of a runtime._type in
@@ -668,6 +931,12 @@ type Image struct {
 	// which was added in go 1.11.
 	runtimeTypeToDIE map[uint64]runtimeTypeDIE
 
+	// loadPclntab reads the table of functions used by the Go runtime, it
+	// is only set for the executable file. pclntab is the parsed table, if
+	// it was needed.
+	loadPclntab pclntabLoader
+	pclntab     *pclntab
+
 	loadErrMu sync.Mutex
 	loadErr   error
 }
@@ -689,6 +958,9 @@ func (bi *BinaryInfo) AddImage(path string, addr uint64) error {
 	if len(bi.Images) > 0 && !strings.HasPrefix(path, "/") {
 		return nil
 	}
+	if len(bi.Images) > 0 && bi.Root != "" {
+		path = filepath.Join(bi.Root, path)
+	}
 	for _, image := range bi.Images {
 		if image.Path == path && image.addr == addr {
 			return nil
@@ -785,6 +1057,9 @@ func (image *Image) LoadError() error {
 }
 
 func (image *Image) getDwarfTree(off dwarf.Offset) (*godwarf.Tree, error) {
+	if off == pclntabFunctionOffset {
+		return nil, errNoDebugInfoForFunction
+	}
 	if r, ok := image.dwarfTreeCache.Get(off); ok {
 		return r.(*godwarf.Tree), nil
 	}
@@ -942,7 +1217,11 @@ func (bi *BinaryInfo) loclistEntry(off int64, pc uint64) []byte {
 	var debugAddr *godwarf.DebugAddr
 	if cu != nil && cu.Version >= 5 && image.loclist5 != nil {
 		loclist = image.loclist5
-		if addrBase, ok := cu.entry.Val(dwarfAttrAddrBase).(int64); ok {
+		entry := cu.entry
+		if cu.skeleton != nil {
+			entry = cu.skeleton.entry
+		}
+		if addrBase, ok := entry.Val(dwarfAttrAddrBase).(int64); ok {
 			debugAddr = image.debugAddr.GetSubsection(uint64(addrBase))
 		}
 	}
@@ -1045,6 +1324,10 @@ func (bi *BinaryInfo) openSeparateDebugInfo(image *Image, exe *elf.File, debugIn
 		}
 		_, err := os.Stat(potentialDebugFilePath)
 		if err == nil {
+			if !strings.Contains(dir, "build-id") && !buildIDMatches(exe, potentialDebugFilePath) {
+				bi.logger.Warnf("ignoring separate debug file %s: its build-id does not match %s", potentialDebugFilePath, image.Path)
+				continue
+			}
 			debugFilePath = potentialDebugFilePath
 			break
 		}
@@ -1071,6 +1354,43 @@ func (bi *BinaryInfo) openSeparateDebugInfo(image *Image, exe *elf.File, debugIn
 	return sepFile, elfFile, nil
 }
 
+// buildIDMatches returns false if the executable exe and the separate
+// debug file at path both have a build-id and they are different, which
+// means that the debug file was produced by a different build.
+func buildIDMatches(exe *elf.File, path string) bool {
+	exe1, exe2, err := parseBuildID(exe)
+	if err != nil {
+		return true
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	dbg1, dbg2, err := parseBuildID(f)
+	if err != nil {
+		return true
+	}
+	return exe1 == dbg1 && exe2 == dbg2
+}
+
+// loadDebugStrSections loads the string sections and the name index of
+// DWARFv5, read with getSection.
+func (bi *BinaryInfo) loadDebugStrSections(image *Image, getSection func(name string) ([]byte, error)) {
+	image.debugLineStr, _ = getSection("line_str")
+	debugNamesBytes, _ := getSection("names")
+	if len(debugNamesBytes) == 0 {
+		return
+	}
+	debugStrBytes, _ := getSection("str")
+	var err error
+	image.debugNames, err = godwarf.ParseDebugNames(debugNamesBytes, debugStrBytes)
+	if err != nil {
+		bi.logger.Warnf("could not read .debug_names of %s: %v", image.Path, err)
+		image.debugNames = nil
+	}
+}
+
 func parseBuildID(exe *elf.File) (string, string, error) {
 	buildid := exe.Section(".note.gnu.build-id")
 	if buildid == nil {
@@ -1134,6 +1454,10 @@ func loadBinaryInfoElf(bi *BinaryInfo, image *Image, path string, addr uint64, w
 		image.StaticBase = addr
 	}
 
+	if desc1, desc2, err := parseBuildID(elfFile); err == nil {
+		image.BuildID = desc1 + desc2
+	}
+
 	dwarfFile := elfFile
 
 	var debugInfoBytes []byte
@@ -1143,7 +1467,13 @@ func loadBinaryInfoElf(bi *BinaryInfo, image *Image, path string, addr uint64, w
 		var serr error
 		sepFile, dwarfFile, serr = bi.openSeparateDebugInfo(image, elfFile, bi.debugInfoDirectories)
 		if serr != nil {
-			return serr
+			if image.index != 0 || bi.loadBinaryInfoPclntab(image, pclntabLoaderElf(elfFile)) != nil {
+				return serr
+			}
+			wg.Add(2)
+			go bi.loadSymbolName(image, elfFile, wg)
+			go bi.setGStructOffsetElf(image, elfFile, wg)
+			return nil
 		}
 		image.sepDebugCloser = sepFile
 		image.dwarf, err = dwarfFile.DWARF()
@@ -1169,6 +1499,10 @@ func loadBinaryInfoElf(bi *BinaryInfo, image *Image, path string, addr uint64, w
 	image.loclist5 = loclist.NewDwarf5Reader(debugLoclistBytes)
 	debugAddrBytes, _ := godwarf.GetDebugSectionElf(dwarfFile, "addr")
 	image.debugAddr = godwarf.ParseAddr(debugAddrBytes)
+	bi.loadDebugStrSections(image, func(name string) ([]byte, error) { return godwarf.GetDebugSectionElf(dwarfFile, name) })
+	if image.index == 0 {
+		image.loadPclntab = pclntabLoaderElf(elfFile)
+	}
 
 	wg.Add(3)
 	go bi.parseDebugFrameElf(image, dwarfFile, debugInfoBytes, wg)
@@ -1206,6 +1540,17 @@ func (bi *BinaryInfo) parseDebugFrameElf(image *Image, exe *elf.File, debugInfoB
 
 	debugFrameData, err := godwarf.GetDebugSectionElf(exe, "frame")
 	if err != nil {
+		// LLVM based compilers, like TinyGo, only emit .eh_frame.
+		if ehFrame := exe.Section(".eh_frame"); ehFrame != nil {
+			if ehFrameData, err2 := ehFrame.Data(); err2 == nil {
+				fdes, err2 := frame.ParseEhFrame(ehFrameData, exe.ByteOrder, image.StaticBase, bi.Arch.PtrSize(), ehFrame.Addr)
+				if err2 != nil {
+					bi.logger.Warnf("could not parse .eh_frame section: %v", err2)
+				}
+				bi.frameEntries = bi.frameEntries.Append(fdes)
+				return
+			}
+		}
 		image.setLoadError("could not get .debug_frame section: %v", err)
 		return
 	}
@@ -1275,14 +1620,6 @@ func loadBinaryInfoPE(bi *BinaryInfo, image *Image, path string, entryPoint uint
 	if !supportedWindowsArch[cpuArch] {
 		return &ErrUnsupportedArch{os: "windows", cpuArch: cpuArch}
 	}
-	image.dwarf, err = peFile.DWARF()
-	if err != nil {
-		return err
-	}
-	debugInfoBytes, err := godwarf.GetDebugSectionPE(peFile, "info")
-	if err != nil {
-		return err
-	}
 
 	//TODO(aarzilli): actually test this when Go supports PIE buildmode on Windows.
 	opth := peFile.OptionalHeader.(*pe.OptionalHeader64)
@@ -1294,6 +1631,24 @@ func loadBinaryInfoPE(bi *BinaryInfo, image *Image, path string, entryPoint uint
 		}
 	}
 
+	// Use ArbitraryUserPointer (0x28) as pointer to pointer
+	// to G struct per:
+	// https://golang.org/src/runtime/cgo/gcc_windows_amd64.c
+
+	bi.gStructOffset = 0x28
+
+	image.dwarf, err = peFile.DWARF()
+	if err != nil {
+		if image.index != 0 || bi.loadBinaryInfoPclntab(image, pclntabLoaderPE(peFile)) != nil {
+			return err
+		}
+		return nil
+	}
+	debugInfoBytes, err := godwarf.GetDebugSectionPE(peFile, "info")
+	if err != nil {
+		return err
+	}
+
 	image.dwarfReader = image.dwarf.Reader()
 
 	debugLineBytes, err := godwarf.GetDebugSectionPE(peFile, "line")
@@ -1306,16 +1661,14 @@ func loadBinaryInfoPE(bi *BinaryInfo, image *Image, path string, entryPoint uint
 	image.loclist5 = loclist.NewDwarf5Reader(debugLoclistBytes)
 	debugAddrBytes, _ := godwarf.GetDebugSectionPE(peFile, "addr")
 	image.debugAddr = godwarf.ParseAddr(debugAddrBytes)
+	bi.loadDebugStrSections(image, func(name string) ([]byte, error) { return godwarf.GetDebugSectionPE(peFile, name) })
+	if image.index == 0 {
+		image.loadPclntab = pclntabLoaderPE(peFile)
+	}
 
 	wg.Add(2)
 	go bi.parseDebugFramePE(image, peFile, debugInfoBytes, wg)
 	go bi.loadDebugInfoMaps(image, debugInfoBytes, debugLineBytes, wg, nil)
-
-	// Use ArbitraryUserPointer (0x28) as pointer to pointer
-	// to G struct per:
-	// https://golang.org/src/runtime/cgo/gcc_windows_amd64.c
-
-	bi.gStructOffset = 0x28
 	return nil
 }
 
@@ -1375,7 +1728,11 @@ func loadBinaryInfoMacho(bi *BinaryInfo, image *Image, path string, entryPoint u
 	}
 	image.dwarf, err = exe.DWARF()
 	if err != nil {
-		return err
+		if image.index != 0 || bi.loadBinaryInfoPclntab(image, pclntabLoaderMacho(exe)) != nil {
+			return err
+		}
+		bi.setGStructOffsetMacho()
+		return nil
 	}
 	debugInfoBytes, err := godwarf.GetDebugSectionMacho(exe, "info")
 	if err != nil {
@@ -1394,6 +1751,10 @@ func loadBinaryInfoMacho(bi *BinaryInfo, image *Image, path string, entryPoint u
 	image.loclist5 = loclist.NewDwarf5Reader(debugLoclistBytes)
 	debugAddrBytes, _ := godwarf.GetDebugSectionMacho(exe, "addr")
 	image.debugAddr = godwarf.ParseAddr(debugAddrBytes)
+	bi.loadDebugStrSections(image, func(name string) ([]byte, error) { return godwarf.GetDebugSectionMacho(exe, name) })
+	if image.index == 0 {
+		image.loadPclntab = pclntabLoaderMacho(exe)
+	}
 
 	wg.Add(2)
 	go bi.parseDebugFrameMacho(image, exe, debugInfoBytes, wg)
@@ -1428,6 +1789,9 @@ func (bi *BinaryInfo) parseDebugFrameMacho(image *Image, exe *macho.File, debugI
 // Do not call this function directly it isn't able to deal correctly with package paths
 func (bi *BinaryInfo) findType(name string) (godwarf.Type, error) {
 	ref, found := bi.types[name]
+	if !found {
+		ref, found = bi.findTypeInDebugNames(name)
+	}
 	if !found {
 		return nil, reader.TypeNotFoundErr
 	}
@@ -1435,6 +1799,50 @@ func (bi *BinaryInfo) findType(name string) (godwarf.Type, error) {
 	return godwarf.ReadType(image.dwarf, ref.imageIndex, ref.offset, image.typeCache)
 }
 
+// findConstant returns the value of the constant with the given name.
+func (bi *BinaryInfo) findConstant(name string) (int64, bool) {
+	for _, ct := range bi.consts {
+		for _, cv := range ct.values {
+			if cv.fullName == name {
+				return cv.value, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// isTypeTag returns true for the tags of the type entries that are added
+// to BinaryInfo.types.
+func isTypeTag(tag dwarf.Tag) bool {
+	switch tag {
+	case dwarf.TagArrayType, dwarf.TagBaseType, dwarf.TagClassType, dwarf.TagStructType, dwarf.TagUnionType, dwarf.TagConstType, dwarf.TagVolatileType, dwarf.TagRestrictType, dwarf.TagEnumerationType, dwarf.TagPointerType, dwarf.TagSubroutineType, dwarf.TagTypedef, dwarf.TagUnspecifiedType:
+		return true
+	}
+	return false
+}
+
+// findTypeInDebugNames looks up the type with the given name in the
+// .debug_names index of the images.
+func (bi *BinaryInfo) findTypeInDebugNames(name string) (dwarfRef, bool) {
+	cname := strings.TrimPrefix(name, "C.")
+	for _, image := range bi.Images {
+		if image.debugNames == nil {
+			continue
+		}
+		for _, e := range image.debugNames.Lookup(cname) {
+			if !isTypeTag(e.Tag) || len(image.compileUnits) == 0 {
+				continue
+			}
+			cu := image.findCompileUnitForOffset(e.CU)
+			// Names of C types are prefixed with "C."
+			if cu.isgo == (cname == name) {
+				return dwarfRef{image.index, e.Offset}, true
+			}
+		}
+	}
+	return dwarfRef{}, false
+}
+
 func (bi *BinaryInfo) findTypeExpr(expr ast.Expr) (godwarf.Type, error) {
 	if lit, islit := expr.(*ast.BasicLit); islit && lit.Kind == token.STRING {
 		// Allow users to specify type names verbatim as quoted
@@ -1550,10 +1958,65 @@ func (bi *BinaryInfo) loadDebugInfoMaps(image *Image, debugInfoBytes, debugLineB
 		bi.inlinedCallLines = make(map[fileLine][]uint64)
 	}
 
+	var skeletons []splitUnit
+	var splitImages []*Image
+	cached := bi.loadIndexCache(image, debugInfoBytes, debugLineBytes)
+	if !cached {
+		skeletons = bi.loadDebugInfoMapsUnits(image, debugInfoBytes, debugLineBytes, nil)
+		splitImages = bi.loadSplitUnits(image, skeletons, debugInfoBytes)
+	}
+
+	sort.Sort(compileUnitsByOffset(image.compileUnits))
+	sort.Sort(functionsDebugInfoByEntry(bi.Functions))
+	sort.Sort(packageVarsByAddr(bi.packageVars))
+
+	if !cached && len(skeletons) == 0 {
+		bi.saveIndexCache(image, debugInfoBytes, debugLineBytes)
+	}
+
+	if image.index == 0 {
+		for _, cu := range image.compileUnits {
+			if isTinyGoProducer(cu.producer) {
+				bi.tinyGo = true
+				break
+			}
+			if cu.isgo && isGccgoProducer(cu.producer) {
+				bi.gccgo = true
+				break
+			}
+		}
+		bi.loadPclntabFunctions(image)
+	}
+
+	bi.LookupFunc = make(map[string]*Function)
+	for i := range bi.Functions {
+		bi.LookupFunc[bi.Functions[i].Name] = &bi.Functions[i]
+	}
+
+	for _, im := range append([]*Image{image}, splitImages...) {
+		for _, cu := range im.compileUnits {
+			bi.Sources = append(bi.Sources, cu.fileNames()...)
+		}
+	}
+	sort.Strings(bi.Sources)
+	bi.Sources = uniq(bi.Sources)
+
+	if cont != nil {
+		cont()
+	}
+}
+
+// loadDebugInfoMapsUnits loads the compile units of image. If skeleton is
+// not nil image is a split DWARF file containing the split unit of
+// skeleton, which has its addresses and line table. Returns the skeleton
+// units found, that are not added to image.
+func (bi *BinaryInfo) loadDebugInfoMapsUnits(image *Image, debugInfoBytes, debugLineBytes []byte, skeleton *compileUnit) []splitUnit {
 	image.runtimeTypeToDIE = make(map[uint64]runtimeTypeDIE)
 
 	ctxt := newLoadDebugInfoMapsContext(bi, image, util.ReadUnitVersions(debugInfoBytes))
 
+	var skeletons []splitUnit
+
 	reader := image.DwarfReader()
 
 	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
@@ -1562,19 +2025,21 @@ func (bi *BinaryInfo) loadDebugInfoMaps(image *Image, debugInfoBytes, debugLineB
 			break
 		}
 		switch entry.Tag {
-		case dwarf.TagCompileUnit:
+		case dwarf.TagCompileUnit, dwarfTagSkeletonUnit:
 			cu := &compileUnit{}
 			cu.image = image
 			cu.entry = entry
 			cu.offset = entry.Offset
 			cu.Version = ctxt.offsetToVersion[cu.offset]
-			if lang, _ := entry.Val(dwarf.AttrLanguage).(int64); lang == dwarfGoLanguage {
+			cu.producer, _ = entry.Val(dwarf.AttrProducer).(string)
+			// TinyGo marks its compile units as C99.
+			if lang, _ := entry.Val(dwarf.AttrLanguage).(int64); lang == dwarfGoLanguage || isTinyGoProducer(cu.producer) {
 				cu.isgo = true
 			}
 			cu.name, _ = entry.Val(dwarf.AttrName).(string)
 			compdir, _ := entry.Val(dwarf.AttrCompDir).(string)
 			if compdir != "" {
-				cu.name = filepath.Join(compdir, cu.name)
+				cu.name = line.TargetJoin(compdir, cu.name, bi.GOOS == "windows")
 			}
 			cu.ranges, _ = image.dwarf.Ranges(entry)
 			for i := range cu.ranges {
@@ -1584,20 +2049,17 @@ func (bi *BinaryInfo) loadDebugInfoMaps(image *Image, debugInfoBytes, debugLineB
 			if len(cu.ranges) >= 1 {
 				cu.lowPC = cu.ranges[0][0]
 			}
-			lineInfoOffset, hasLineInfo := entry.Val(dwarf.AttrStmtList).(int64)
-			if hasLineInfo && lineInfoOffset >= 0 && lineInfoOffset < int64(len(debugLineBytes)) {
-				var logfn func(string, ...interface{})
-				if logflags.DebugLineErrors() {
-					logger := logrus.New().WithFields(logrus.Fields{"layer": "dwarf-line"})
-					logger.Logger.Level = logrus.DebugLevel
-					logfn = func(fmt string, args ...interface{}) {
-						logger.Printf(fmt, args)
-					}
+			if lineInfoOffset, hasLineInfo := entry.Val(dwarf.AttrStmtList).(int64); hasLineInfo {
+				if bi.setLineInfoLoader(image, cu, compdir, debugLineBytes, lineInfoOffset) {
+					bi.loadFileTable(image, cu, compdir, debugLineBytes[lineInfoOffset:])
 				}
-				cu.lineInfo = line.Parse(compdir, bytes.NewBuffer(debugLineBytes[lineInfoOffset:]), logfn, image.StaticBase, bi.GOOS == "windows", bi.Arch.PtrSize())
 			}
-			cu.producer, _ = entry.Val(dwarf.AttrProducer).(string)
-			if cu.isgo && cu.producer != "" {
+			if isTinyGoProducer(cu.producer) {
+				// TinyGo does not record its flags, it optimizes by default.
+				cu.optimized = true
+			} else if isGccgoProducer(cu.producer) {
+				cu.optimized = gccgoOptimized(cu.producer)
+			} else if cu.isgo && cu.producer != "" {
 				semicolon := strings.Index(cu.producer, ";")
 				if semicolon < 0 {
 					cu.optimized = goversion.ProducerAfterOrEqual(cu.producer, 1, 10)
@@ -1606,6 +2068,26 @@ func (bi *BinaryInfo) loadDebugInfoMaps(image *Image, debugInfoBytes, debugLineB
 					cu.producer = cu.producer[:semicolon]
 				}
 			}
+			if skeleton != nil {
+				// Split compile unit, the addresses and the line table are
+				// described by the skeleton unit.
+				if cu.name == "" {
+					cu.name = skeleton.name
+				} else if compdir == "" {
+					compdir, _ = skeleton.entry.Val(dwarf.AttrCompDir).(string)
+					cu.name = line.TargetJoin(compdir, cu.name, bi.GOOS == "windows")
+				}
+				cu.ranges, cu.lowPC, cu.loadLineInfo = skeleton.ranges, skeleton.lowPC, skeleton.lines
+				cu.files, cu.lineVersion = skeleton.files, skeleton.lineVersion
+				if cu.producer == "" {
+					cu.producer = skeleton.producer
+				}
+				cu.skeleton = skeleton
+			} else if sk, ok := newSplitUnit(entry, cu, compdir); ok {
+				skeletons = append(skeletons, sk)
+				reader.SkipChildren()
+				continue
+			}
 			gopkg, _ := entry.Val(godwarf.AttrGoPackageName).(string)
 			if cu.isgo && gopkg != "" {
 				bi.PackageMap[gopkg] = append(bi.PackageMap[gopkg], escapePackagePath(strings.Replace(cu.name, "\\", "/", -1)))
@@ -1624,27 +2106,45 @@ func (bi *BinaryInfo) loadDebugInfoMaps(image *Image, debugInfoBytes, debugLineB
 		}
 	}
 
-	sort.Sort(compileUnitsByOffset(image.compileUnits))
-	sort.Sort(functionsDebugInfoByEntry(bi.Functions))
-	sort.Sort(packageVarsByAddr(bi.packageVars))
+	return skeletons
+}
 
-	bi.LookupFunc = make(map[string]*Function)
-	for i := range bi.Functions {
-		bi.LookupFunc[bi.Functions[i].Name] = &bi.Functions[i]
+// setLineInfoLoader arranges for the line table of cu, at offset off of
+// debugLineBytes, to be parsed the first time it is used. Returns false if
+// off is not a valid offset.
+func (bi *BinaryInfo) setLineInfoLoader(image *Image, cu *compileUnit, compdir string, debugLineBytes []byte, off int64) bool {
+	if off < 0 || off >= int64(len(debugLineBytes)) {
+		return false
 	}
-
-	for _, cu := range image.compileUnits {
-		if cu.lineInfo != nil {
-			for _, fileEntry := range cu.lineInfo.FileNames {
-				bi.Sources = append(bi.Sources, fileEntry.Path)
+	cu.loadLineInfo = func() *line.DebugLineInfo {
+		var logfn func(string, ...interface{})
+		if logflags.DebugLineErrors() {
+			logger := logrus.New().WithFields(logrus.Fields{"layer": "dwarf-line"})
+			logger.Logger.Level = logrus.DebugLevel
+			logfn = func(fmt string, args ...interface{}) {
+				logger.Printf(fmt, args)
 			}
 		}
-	}
-	sort.Strings(bi.Sources)
-	bi.Sources = uniq(bi.Sources)
-
-	if cont != nil {
-		cont()
+		return line.Parse(compdir, bytes.NewBuffer(debugLineBytes[off:]), image.debugLineStr, logfn, image.StaticBase, bi.GOOS == "windows", bi.Arch.PtrSize())
+	}
+	return true
+}
+
+// loadFileTable reads the file table of the line table of cu, at the start
+// of debugLineBytes, without parsing the line table. The lengths of the
+// files recorded in the file table are added to image.sourceLengths.
+func (bi *BinaryInfo) loadFileTable(image *Image, cu *compileUnit, compdir string, debugLineBytes []byte) {
+	var entries []*line.FileEntry
+	cu.lineVersion, entries = line.ParseFileTable(compdir, bytes.NewBuffer(debugLineBytes), image.debugLineStr, bi.GOOS == "windows")
+	cu.files = make([]string, len(entries))
+	for i, entry := range entries {
+		cu.files[i] = entry.Path
+		if entry.Length != 0 {
+			if image.sourceLengths == nil {
+				image.sourceLengths = make(map[string]uint64)
+			}
+			image.sourceLengths[entry.Path] = entry.Length
+		}
 	}
 }
 
@@ -1675,7 +2175,7 @@ func (bi *BinaryInfo) loadDebugInfoMapsCompileUnit(ctxt *loadDebugInfoMapsContex
 				if !cu.isgo {
 					name = "C." + name
 				}
-				if _, exists := bi.types[name]; !exists {
+				if _, exists := bi.types[name]; !exists && !image.debugNames.CoversUnit(cu.offset) {
 					bi.types[name] = dwarfRef{image.index, entry.Offset}
 				}
 			}
@@ -1695,6 +2195,8 @@ func (bi *BinaryInfo) loadDebugInfoMapsCompileUnit(ctxt *loadDebugInfoMapsContex
 				}
 				if !cu.isgo {
 					n = "C." + n
+				} else if isGccgoProducer(cu.producer) {
+					n = gccgoEntryName(entry, n)
 				}
 				if _, known := ctxt.knownPackageVars[n]; !known {
 					bi.packageVars = append(bi.packageVars, packageVar{n, cu, entry.Offset, addr + image.StaticBase})
@@ -1860,6 +2362,8 @@ func subprogramEntryName(entry *dwarf.Entry, cu *compileUnit) (string, bool) {
 	}
 	if !cu.isgo {
 		name = "C." + name
+	} else if isGccgoProducer(cu.producer) {
+		name = gccgoEntryName(entry, name)
 	}
 	return name, true
 }
@@ -1914,17 +2418,17 @@ func (bi *BinaryInfo) loadDebugInfoMapsInlinedCalls(ctxt *loadDebugInfoMapsConte
 				reader.SkipChildren()
 				continue
 			}
-			if cu.lineInfo == nil {
+			if cu.lineVersion == 0 {
 				bi.logger.Warnf("reading debug_info: inlined call on a compilation unit without debug_line section at %#x", entry.Offset)
 				reader.SkipChildren()
 				continue
 			}
-			if int(callfileidx-1) >= len(cu.lineInfo.FileNames) {
+			callfile, ok := cu.fileIndex(callfileidx)
+			if !ok {
 				bi.logger.Warnf("reading debug_info: CallFile (%d) of inlined call does not exist in compile unit file table at %#x", callfileidx, entry.Offset)
 				reader.SkipChildren()
 				continue
 			}
-			callfile := cu.lineInfo.FileNames[callfileidx-1].Path
 
 			fn.InlinedCalls = append(fn.InlinedCalls, InlinedCall{
 				cu:     cu,
@@ -2049,14 +2553,14 @@ type PackageBuildInfo struct {
 func (bi *BinaryInfo) ListPackagesBuildInfo(includeFiles bool) []*PackageBuildInfo {
 	m := make(map[string]*PackageBuildInfo)
 	for _, cu := range bi.Images[0].compileUnits {
-		if cu.image != bi.Images[0] || !cu.isgo || cu.lineInfo == nil {
+		if cu.image != bi.Images[0] || !cu.isgo || cu.lines() == nil {
 			//TODO(aarzilli): what's the correct thing to do for plugins?
 			continue
 		}
 
 		ip := strings.Replace(cu.name, "\\", "/", -1)
 		if _, ok := m[ip]; !ok {
-			path := cu.lineInfo.FirstFile()
+			path := cu.lines().FirstFile()
 			if ext := filepath.Ext(path); ext != ".go" && ext != ".s" {
 				continue
 			}
@@ -2071,7 +2575,7 @@ func (bi *BinaryInfo) ListPackagesBuildInfo(includeFiles bool) []*PackageBuildIn
 		if includeFiles {
 			pbi := m[ip]
 
-			for _, file := range cu.lineInfo.FileNames {
+			for _, file := range cu.lines().FileNames {
 				pbi.Files[file.Path] = struct{}{}
 			}
 		}
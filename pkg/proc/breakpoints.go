@@ -6,6 +6,8 @@ import (
 	"go/ast"
 	"go/constant"
 	"reflect"
+	"strings"
+	"time"
 )
 
 const (
@@ -16,10 +18,35 @@ const (
 	// process dies because of a fatal runtime error.
 	FatalThrow = "runtime-fatal-throw"
 
+	// OSExit is the name given to the breakpoint on os.Exit, it is only
+	// created by SetExitBreakpoints.
+	OSExit = "os-exit"
+
+	// LogFatal is the name given to the breakpoint on the Fatal functions of
+	// the log package and methods of log.Logger, it is only created by
+	// SetExitBreakpoints.
+	LogFatal = "log-fatal"
+
+	// SubtestRunner is the name given to the breakpoint on testing.tRunner
+	// created by SetSubtestBreakpoint.
+	SubtestRunner = "subtest-runner"
+
+	// FuzzRunner is the name given to the breakpoint on testing.(*F).Fuzz
+	// created by SetFuzzBreakpoint.
+	FuzzRunner = "fuzz-runner"
+
 	unrecoveredPanicID = -1
 	fatalThrowID       = -2
+	osExitID           = -3
+	logFatalID         = -4
+	subtestRunnerID    = -5
+	fuzzRunnerID       = -6
 )
 
+// DefaultStackContainsDepth is the number of frames searched for the
+// function of Breakpoint.StackContains if StackContainsDepth is not set.
+const DefaultStackContainsDepth = 50
+
 // Breakpoint represents a physical breakpoint. Stores information on the break
 // point including the byte of data that originally was stored at that
 // address.
@@ -47,10 +74,15 @@ type Breakpoint struct {
 	Goroutine     bool     // Retrieve goroutine information
 	Stacktrace    int      // Number of stack frames to retrieve
 	Variables     []string // Variables to evaluate
+	Sample        bool     // Collect Variables without stopping the target
+	ErrorReturn   bool     // Only trigger if an error return value of the function is not nil
+	AtExit        bool     // Trigger when the function returns instead of when it is called, see ExitBreakpoint
 	LoadArgs      *LoadConfig
 	LoadLocals    *LoadConfig
 	HitCount      map[int]uint64 // Number of times a breakpoint has been reached in a certain goroutine
 	TotalHitCount uint64         // Number of times a breakpoint has been reached
+	// Stats are the statistics of the evaluations of Cond.
+	Stats BreakpointStats
 
 	// DeferReturns: when kind == NextDeferBreakpoint this breakpoint
 	// will also check if the caller is runtime.gopanic or if the return
@@ -64,12 +96,71 @@ type Breakpoint struct {
 	DeferReturns []uint64
 	// Cond: if not nil the breakpoint will be triggered only if evaluating Cond returns true
 	Cond ast.Expr
+	// StackContains: if not empty the breakpoint will be triggered only if
+	// one of the StackContainsDepth innermost frames of the stack is a call
+	// to the function named StackContains, see stackContains.
+	StackContains      string
+	StackContainsDepth int
 	// internalCond is the same as Cond but used for the condition of internal breakpoints
 	internalCond ast.Expr
 
 	// ReturnInfo describes how to collect return variables when this
 	// breakpoint is hit as a return breakpoint.
 	returnInfo *returnBreakpointInfo
+
+	// exits are the invocations waiting for this ExitBreakpoint.
+	exits []*exitInvocation
+	// exitOnRecovery is set on the ExitBreakpoint on runtime.recovery, it
+	// is hit by the invocations unwound by a recovered panic.
+	exitOnRecovery bool
+}
+
+// HotBreakpointRate is the number of evaluations per second of the
+// condition of a breakpoint above which the breakpoint is considered hot:
+// stopping the target so often to evaluate the condition slows it down
+// considerably.
+const HotBreakpointRate = 1000
+
+// BreakpointStats are statistics of the evaluations of the condition of a
+// user breakpoint, collected by CheckCondition.
+type BreakpointStats struct {
+	// CondEvals is the number of times the condition was evaluated and
+	// CondTime the time spent evaluating it.
+	CondEvals uint64
+	CondTime  time.Duration
+	// FalseHits is the number of evaluations that did not stop the target,
+	// because the condition was false.
+	FalseHits uint64
+	// MaxRate is the highest number of evaluations in one second.
+	MaxRate uint64
+
+	rateStart time.Time
+	rateCount uint64
+}
+
+// Hot returns true if the condition was evaluated more than
+// HotBreakpointRate times in one second.
+func (s *BreakpointStats) Hot() bool {
+	return s.MaxRate > HotBreakpointRate
+}
+
+func (s *BreakpointStats) add(start time.Time, active bool) (becameHot bool) {
+	now := time.Now()
+	s.CondEvals++
+	s.CondTime += now.Sub(start)
+	if !active {
+		s.FalseHits++
+	}
+	if now.Sub(s.rateStart) >= time.Second {
+		s.rateStart, s.rateCount = now, 0
+	}
+	s.rateCount++
+	if s.rateCount > s.MaxRate {
+		wasHot := s.Hot()
+		s.MaxRate = s.rateCount
+		return !wasHot && s.Hot()
+	}
+	return false
 }
 
 // BreakpointKind determines the behavior of delve when the
@@ -91,6 +182,32 @@ const (
 	// Continue will set a new breakpoint (of NextBreakpoint kind) on the
 	// destination of CALL, delete this breakpoint and then continue again
 	StepBreakpoint
+	// ChanSendBreakpoint is a breakpoint set by StepFollowChannel after the
+	// prologue of runtime.chansend1, Continue will replace it with a
+	// breakpoint (of NextBreakpoint kind) on the goroutine receiving from the
+	// channel, if one is waiting, and then continue again
+	ChanSendBreakpoint
+	// CallReturnBreakpoint is a breakpoint set by Next on the return address
+	// of the calls of the current line, Continue will collect the values
+	// returned by the called function and then continue again. Calls whose
+	// destination can not be determined in advance get a breakpoint of this
+	// kind on the CALL instruction, when it is reached Continue will set a
+	// new one on the return address of the call.
+	CallReturnBreakpoint
+	// ExitBreakpoint is a breakpoint set on the return address of an
+	// invocation of a function with an AtExit breakpoint, when the AtExit
+	// breakpoint is hit at the entry of the function, and on
+	// runtime.recovery, to catch the invocations unwound by a panic.
+	// It is not an internal breakpoint: it is never cleared by
+	// ClearInternalBreakpoints and it can overlap with any other kind of
+	// breakpoint. See Target.setExitBreakpoints.
+	ExitBreakpoint
+	// CoverageBreakpoint is a breakpoint set by AddCoverage on a statement
+	// of a function tracked by line coverage, Continue will mark the line
+	// executed, clear the breakpoint and continue again. Like ExitBreakpoint
+	// it is not an internal breakpoint and can overlap with any other kind
+	// of breakpoint.
+	CoverageBreakpoint
 )
 
 func (bp *Breakpoint) String() string {
@@ -129,7 +246,21 @@ type returnBreakpointInfo struct {
 // CheckCondition evaluates bp's condition on thread.
 func (bp *Breakpoint) CheckCondition(thread Thread) BreakpointState {
 	bpstate := BreakpointState{Breakpoint: bp, Active: false, Internal: false, CondError: nil}
-	if bp.Cond == nil && bp.internalCond == nil {
+	if bp.Kind&CoverageBreakpoint != 0 {
+		bpstate.covered = bp
+	}
+	if bp.Kind&ExitBreakpoint != 0 {
+		if bpstate.exited = bp.exitedInvocations(thread); len(bpstate.exited) > 0 {
+			// The target stops as if it had hit the AtExit breakpoint.
+			bpstate.Breakpoint = bpstate.exited[0].bp
+			bpstate.Active = true
+			return bpstate
+		}
+	}
+	if bp.Kind&^(ExitBreakpoint|CoverageBreakpoint) == 0 {
+		return bpstate
+	}
+	if bp.Cond == nil && bp.internalCond == nil && !bp.ErrorReturn && !bp.AtExit && bp.StackContains == "" {
 		bpstate.Active = true
 		bpstate.Internal = bp.IsInternal()
 		return bpstate
@@ -151,16 +282,88 @@ func (bp *Breakpoint) CheckCondition(thread Thread) BreakpointState {
 		bpstate.Active = bpstate.Active && nextDeferOk
 		if bpstate.Active || bpstate.CondError != nil {
 			bpstate.Internal = true
+			if bp.IsUser() && bp.AtExit {
+				// the invocation must be tracked even if the target stops for
+				// the internal breakpoint
+				bpstate.atExitCall, _ = evalBreakpointCondition(thread, bp.Cond)
+			}
 			return bpstate
 		}
 	}
 	if bp.IsUser() {
 		// Check normal condition if this is also a user breakpoint
+		start := time.Now()
 		bpstate.Active, bpstate.CondError = evalBreakpointCondition(thread, bp.Cond)
+		if bpstate.Active && bpstate.CondError == nil && bp.StackContains != "" {
+			bpstate.Active, bpstate.CondError = stackContains(thread, bp.StackContains, bp.StackContainsDepth)
+		}
+		if bpstate.Active && bpstate.CondError == nil && bp.ErrorReturn {
+			bpstate.Active, bpstate.CondError = errorReturnIsSet(thread)
+		}
+		if bp.Stats.add(start, bpstate.Active) {
+			thread.BinInfo().logger.Warnf("the condition of breakpoint %d at %s:%d is evaluated more than %d times per second, the target is slowed down", bp.LogicalID, bp.File, bp.Line, HotBreakpointRate)
+		}
+		if bp.AtExit && bpstate.CondError == nil {
+			// AtExit breakpoints do not stop when the function is called, the
+			// condition decides whether the invocation is tracked.
+			bpstate.atExitCall = bpstate.Active
+			bpstate.Active = false
+		}
 	}
 	return bpstate
 }
 
+// errorReturnIsSet returns true if any of the return values of type error
+// of the function currently executing on thread is not nil.
+func errorReturnIsSet(thread Thread) (bool, error) {
+	scope, err := GoroutineScope(thread)
+	if err != nil {
+		return true, err
+	}
+	vars, err := scope.Locals()
+	if err != nil {
+		return true, fmt.Errorf("could not read return values: %v", err)
+	}
+	for _, v := range vars {
+		if v.Flags&VariableReturnArgument == 0 || v.DwarfType == nil || v.DwarfType.String() != "error" {
+			continue
+		}
+		v.loadValue(loadFullValue)
+		if v.Unreadable != nil {
+			return true, fmt.Errorf("return value %s unreadable: %v", v.Name, v.Unreadable)
+		}
+		if !v.isNil() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// stackContains returns true if one of the depth innermost frames of the
+// stack of thread, counting the frame of the current function and inlined
+// calls, is a call to the function called fnname. Only the frames that are
+// searched are unwound.
+// The name can omit the directory part of the package path, for example
+// mypkg.HandleRequest matches github.com/me/mypkg.HandleRequest.
+func stackContains(thread Thread, fnname string, depth int) (bool, error) {
+	if depth <= 0 {
+		depth = DefaultStackContainsDepth
+	}
+	frames, err := ThreadStacktrace(thread, depth-1)
+	if err != nil {
+		return true, fmt.Errorf("could not read the stack: %v", err)
+	}
+	for _, frame := range frames {
+		if frame.Current.Fn == nil {
+			continue
+		}
+		if name := frame.Current.Fn.Name; name == fnname || strings.HasSuffix(name, "/"+fnname) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func isPanicCall(frames []Stackframe) bool {
 	return len(frames) >= 3 && frames[2].Current.Fn != nil && frames[2].Current.Fn.Name == "runtime.gopanic"
 }
@@ -180,7 +383,7 @@ func isDeferReturnCall(frames []Stackframe, deferReturns []uint64) (bool, uint64
 // User-set breakpoints can overlap with internal breakpoints, in that case
 // both IsUser and IsInternal will be true.
 func (bp *Breakpoint) IsInternal() bool {
-	return bp.Kind != UserBreakpoint
+	return bp.Kind&^(UserBreakpoint|ExitBreakpoint|CoverageBreakpoint) != 0
 }
 
 // IsUser returns true if bp is a user-set breakpoint.
@@ -190,6 +393,22 @@ func (bp *Breakpoint) IsUser() bool {
 	return bp.Kind&UserBreakpoint != 0
 }
 
+// CanSkip returns true if thread, stopped at bp, can be resumed without
+// stopping the target, as Continue would do after stopping it: bp is an
+// internal breakpoint whose condition is false for thread, for example a
+// breakpoint set by next hit by a different goroutine.
+// Backends use it to resume thread alone while the other threads are
+// still running.
+func (bp *Breakpoint) CanSkip(thread Thread) bool {
+	if bp.IsUser() || bp.Kind&CoverageBreakpoint != 0 || (bp.internalCond == nil && len(bp.exits) == 0) {
+		return false
+	}
+	bpstate := bp.CheckCondition(thread)
+	// the goroutine of thread could change once it is resumed
+	thread.Common().g = nil
+	return !bpstate.Active && bpstate.CondError == nil
+}
+
 func evalBreakpointCondition(thread Thread, cond ast.Expr) (bool, error) {
 	if cond == nil {
 		return true, nil
@@ -250,15 +469,22 @@ func (t *Target) SetBreakpoint(addr uint64, kind BreakpointKind, cond ast.Expr)
 	if bp, ok := bpmap.M[addr]; ok {
 		// We can overlap one internal breakpoint with one user breakpoint, we
 		// need to support this otherwise a conditional breakpoint can mask a
-		// breakpoint set by next or step.
-		if (kind != UserBreakpoint && bp.Kind != UserBreakpoint) || (kind == UserBreakpoint && bp.IsUser()) {
+		// breakpoint set by next or step. Exit and coverage breakpoints can
+		// overlap with both.
+		const overlapping = UserBreakpoint | ExitBreakpoint | CoverageBreakpoint
+		if (kind&overlapping == 0 && bp.IsInternal()) || bp.Kind&kind&overlapping != 0 {
 			return bp, BreakpointExistsError{bp.File, bp.Line, bp.Addr}
 		}
 		bp.Kind |= kind
-		if kind != UserBreakpoint {
-			bp.internalCond = cond
-		} else {
+		switch kind {
+		case UserBreakpoint:
+			// the logical ID of the breakpoint must be a user one
+			bpmap.breakpointIDCounter++
+			bp.LogicalID = bpmap.breakpointIDCounter
 			bp.Cond = cond
+		case ExitBreakpoint, CoverageBreakpoint:
+		default:
+			bp.internalCond = cond
 		}
 		return bp, nil
 	}
@@ -309,6 +535,19 @@ func (t *Target) setBreakpointWithID(id int, addr uint64) (*Breakpoint, error) {
 	return bp, err
 }
 
+// setLogicalBreakpointWithID creates a breakpoint at every address in
+// addrs, all belonging to the logical breakpoint with the specified ID.
+// Addresses where a breakpoint can not be created are skipped.
+func (t *Target) setLogicalBreakpointWithID(id int, addrs []uint64) []*Breakpoint {
+	var bps []*Breakpoint
+	for _, addr := range addrs {
+		if bp, err := t.setBreakpointWithID(id, addr); err == nil {
+			bps = append(bps, bp)
+		}
+	}
+	return bps
+}
+
 // ClearBreakpoint clears the breakpoint at addr.
 func (t *Target) ClearBreakpoint(addr uint64) (*Breakpoint, error) {
 	if valid, err := t.Valid(); !valid {
@@ -320,6 +559,12 @@ func (t *Target) ClearBreakpoint(addr uint64) (*Breakpoint, error) {
 		return nil, NoBreakpointError{Addr: addr}
 	}
 
+	if bp.AtExit {
+		if err := t.clearExitInvocations(bp); err != nil {
+			return nil, err
+		}
+	}
+
 	bp.Kind &= ^UserBreakpoint
 	bp.Cond = nil
 	if bp.Kind != 0 {
@@ -341,7 +586,7 @@ func (t *Target) ClearInternalBreakpoints() error {
 	bpmap := t.Breakpoints()
 	threads := t.ThreadList()
 	for addr, bp := range bpmap.M {
-		bp.Kind = bp.Kind & UserBreakpoint
+		bp.Kind = bp.Kind & (UserBreakpoint | ExitBreakpoint | CoverageBreakpoint)
 		bp.internalCond = nil
 		bp.returnInfo = nil
 		if bp.Kind != 0 {
@@ -382,6 +627,17 @@ type BreakpointState struct {
 	// CondError contains any error encountered while evaluating the
 	// breakpoint's condition.
 	CondError error
+
+	// atExitCall is true if the breakpoint is an AtExit breakpoint hit at
+	// the entry of its function with its condition met, Continue will
+	// track the invocation.
+	atExitCall bool
+	// exited are the invocations of functions with AtExit breakpoints that
+	// returned, or were unwound by a panic, when this breakpoint was hit.
+	exited []*exitInvocation
+	// covered is the CoverageBreakpoint hit, Continue will mark its line
+	// executed.
+	covered *Breakpoint
 }
 
 // Clear zeros the struct.
@@ -390,6 +646,9 @@ func (bpstate *BreakpointState) Clear() {
 	bpstate.Active = false
 	bpstate.Internal = false
 	bpstate.CondError = nil
+	bpstate.atExitCall = false
+	bpstate.exited = nil
+	bpstate.covered = nil
 }
 
 func (bpstate *BreakpointState) String() string {
@@ -415,6 +674,19 @@ func configureReturnBreakpoint(bi *BinaryInfo, bp *Breakpoint, topframe *Stackfr
 	}
 }
 
+// configureCallReturnBreakpoint configures bp, set on the return address
+// of a call to fn made by goroutine g with the stack pointer at sp, to
+// collect the values returned by fn.
+func configureCallReturnBreakpoint(bi *BinaryInfo, bp *Breakpoint, fn *Function, g *G, sp uint64, retFrameCond ast.Expr) {
+	frameOffset := int64(sp) - int64(g.stack.hi)
+	bp.returnInfo = &returnBreakpointInfo{
+		retFrameCond: retFrameCond,
+		fn:           fn,
+		frameOffset:  frameOffset,
+		spOffset:     frameOffset - int64(bi.Arch.PtrSize()),
+	}
+}
+
 func (rbpi *returnBreakpointInfo) Collect(thread Thread) []*Variable {
 	if rbpi == nil {
 		return nil
@@ -424,6 +696,9 @@ func (rbpi *returnBreakpointInfo) Collect(thread Thread) []*Variable {
 	if err != nil {
 		return returnInfoError("could not get g", err, thread)
 	}
+	if g == nil {
+		return returnInfoError("could not get g", errors.New("no goroutine running on the thread"), thread)
+	}
 	scope, err := GoroutineScope(thread)
 	if err != nil {
 		return returnInfoError("could not get scope", err, thread)
@@ -440,6 +715,16 @@ func (rbpi *returnBreakpointInfo) Collect(thread Thread) []*Variable {
 		return nil
 	}
 
+	if ints, _ := regabiRegisters(thread.BinInfo(), rbpi.fn); ints != nil {
+		// The return values are in registers, or on the stack above the stack
+		// pointer, and will be overwritten by the caller.
+		vars, err := regabiReturnValues(thread, rbpi.fn)
+		if err != nil {
+			return returnInfoError("could not read return values", err, thread)
+		}
+		return vars
+	}
+
 	oldFrameOffset := rbpi.frameOffset + int64(g.stack.hi)
 	oldSP := uint64(rbpi.spOffset + int64(g.stack.hi))
 	err = fakeFunctionEntryScope(scope, rbpi.fn, oldFrameOffset, oldSP)
@@ -458,6 +743,15 @@ func (rbpi *returnBreakpointInfo) Collect(thread Thread) []*Variable {
 	return vars
 }
 
+// collectReturnValues saves the return values described by rbpi on
+// thread, if there are any.
+func collectReturnValues(thread Thread, rbpi *returnBreakpointInfo) {
+	if retvals := rbpi.Collect(thread); len(retvals) > 0 {
+		thread.Common().returnValues = retvals
+		thread.Common().returnFn = rbpi.fn
+	}
+}
+
 func returnInfoError(descr string, err error, mem MemoryReadWriter) []*Variable {
 	v := newConstant(constant.MakeString(fmt.Sprintf("%s: %v", descr, err.Error())), mem)
 	v.Name = "return value read error"
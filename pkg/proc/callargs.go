@@ -0,0 +1,157 @@
+package proc
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"github.com/go-delve/delve/pkg/dwarf/op"
+)
+
+// Registers used to pass the integer arguments of C functions, as DWARF
+// register numbers, see the System V ABI for amd64 and the AAPCS64 for
+// arm64. On 386 the arguments are passed on the stack.
+var (
+	// RDI, RSI, RDX, RCX, R8, R9
+	amd64CIntArgRegs = []uint64{5, 4, 1, 2, 8, 9}
+	// X0 to X7
+	arm64CIntArgRegs = []uint64{0, 1, 2, 3, 4, 5, 6, 7}
+)
+
+// arm64LinkReg is the DWARF register number of the link register of arm64.
+const arm64LinkReg = 30
+
+// FindCFunction returns the entry point of the C function name: a
+// function of the executable, described by its debug symbols or its
+// symbol table, or a function exported by one of the shared libraries
+// loaded, for example malloc in the C library, which usually have no
+// debug symbols. Shared libraries are only searched on linux.
+func FindCFunction(t *Target, name string) (uint64, error) {
+	bi := t.BinInfo()
+	if fn := bi.LookupFunc[name]; fn != nil {
+		return fn.Entry, nil
+	}
+	for addr, sym := range bi.SymNames {
+		if sym.Name == name {
+			return addr, nil
+		}
+	}
+	for _, image := range bi.Images {
+		f, err := elf.Open(image.Path)
+		if err != nil {
+			continue
+		}
+		syms, _ := f.DynamicSymbols()
+		f.Close()
+		for _, sym := range syms {
+			if sym.Name == name && elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Section != elf.SHN_UNDEF && sym.Value != 0 {
+				return image.StaticBase + sym.Value, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("could not find function %s", name)
+}
+
+// EntryIntArgs returns the first n integer arguments, or pointers, of the
+// function called by thread, which must be stopped at its entry point. fn
+// is the function if it was written in Go, nil for C functions, whose
+// arguments are read following the C calling convention of the
+// architecture.
+func EntryIntArgs(thread Thread, fn *Function, n int) ([]uint64, error) {
+	bi := thread.BinInfo()
+	regs, err := thread.Registers()
+	if err != nil {
+		return nil, err
+	}
+	dregs := bi.Arch.RegistersToDwarfRegisters(0, regs)
+	ptrSize := int64(bi.Arch.PtrSize())
+
+	var argRegs []uint64
+	if fn != nil {
+		argRegs, _ = regabiRegisters(bi, fn)
+	} else {
+		switch bi.Arch.Name {
+		case "amd64":
+			argRegs = amd64CIntArgRegs
+		case "arm64":
+			argRegs = arm64CIntArgRegs
+		}
+	}
+	if argRegs != nil && n > len(argRegs) {
+		return nil, fmt.Errorf("too many arguments")
+	}
+
+	r := make([]uint64, n)
+	for i := range r {
+		if argRegs != nil {
+			r[i] = dregs.Uint64Val(argRegs[i])
+			continue
+		}
+		// the arguments are on the stack, above the return address or,
+		// for Go on arm64, above the space reserved for the link register.
+		if r[i], err = readUintRaw(thread, uintptr(dregs.SP()+uint64(int64(i+1)*ptrSize)), ptrSize); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// EntryReturnAddr returns the return address of the function called by
+// thread, which must be stopped at its entry point, and the value of the
+// stack pointer after the function returns.
+func EntryReturnAddr(thread Thread) (retaddr, sp uint64, err error) {
+	bi := thread.BinInfo()
+	regs, err := thread.Registers()
+	if err != nil {
+		return 0, 0, err
+	}
+	dregs := bi.Arch.RegistersToDwarfRegisters(0, regs)
+	if bi.Arch.Name == "arm64" {
+		return dregs.Uint64Val(arm64LinkReg), dregs.SP(), nil
+	}
+	ptrSize := int64(bi.Arch.PtrSize())
+	retaddr, err = readUintRaw(thread, uintptr(dregs.SP()), ptrSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	return retaddr, dregs.SP() + uint64(ptrSize), nil
+}
+
+// EntryStacktrace returns the stack trace of thread, which must be stopped
+// at the entry point of a function, starting from the caller of the
+// function. Unlike ThreadStacktrace it does not need the debug symbols of
+// the function called, for example malloc in the C library, to unwind the
+// stack, the registers of the caller are those at the entry point, with
+// the return address and the stack pointer after the function returns.
+func EntryStacktrace(thread Thread, depth int) ([]Stackframe, error) {
+	retaddr, sp, err := EntryReturnAddr(thread)
+	if err != nil {
+		return nil, err
+	}
+	regs, err := thread.Registers()
+	if err != nil {
+		return nil, err
+	}
+	bi := thread.BinInfo()
+	dregs := bi.Arch.RegistersToDwarfRegisters(bi.PCToImage(retaddr).StaticBase, regs)
+	dregs.AddReg(dregs.PCRegNum, op.DwarfRegisterFromUint64(retaddr))
+	dregs.AddReg(dregs.SPRegNum, op.DwarfRegisterFromUint64(sp))
+	g, _ := GetG(thread)
+	var stackhi uint64
+	if g != nil {
+		stackhi = g.stack.hi
+	}
+	it := newStackIterator(bi, thread, dregs, stackhi, nil, -1, g, 0)
+	return it.stacktrace(depth)
+}
+
+// CReturnValue returns the integer, or pointer, returned by the C function
+// called by thread, which must be stopped at its return address.
+func CReturnValue(thread Thread) (uint64, error) {
+	regs, err := thread.Registers()
+	if err != nil {
+		return 0, err
+	}
+	// RAX, EAX and X0 are the register 0 of their architecture.
+	dregs := thread.BinInfo().Arch.RegistersToDwarfRegisters(0, regs)
+	return dregs.Uint64Val(0), nil
+}
@@ -0,0 +1,166 @@
+package proc
+
+import (
+	"fmt"
+)
+
+// Feature is a feature of the debugger that depends on the debug
+// information of the target program, or of its runtime.
+type Feature string
+
+const (
+	FeatureGoroutines       Feature = "goroutines"
+	FeatureFunctionCalls    Feature = "function calls"
+	FeatureDefers           Feature = "deferred calls"
+	FeaturePanicBreakpoints Feature = "unrecovered-panic and fatal-throw breakpoints"
+	FeatureInterfaces       Feature = "dynamic types of interfaces"
+	FeatureVariables        Feature = "variables and types"
+)
+
+// Capability describes whether a feature is available for the target
+// program.
+type Capability struct {
+	Feature   Feature
+	Available bool
+	// Reason is the reason why the feature is not available.
+	Reason string
+}
+
+// ErrFeatureUnavailable is returned by the operations that need a feature
+// that is not available for the target program.
+type ErrFeatureUnavailable struct {
+	Feature Feature
+	Reason  string
+}
+
+func (err *ErrFeatureUnavailable) Error() string {
+	return fmt.Sprintf("%s are not available: %s", err.Feature, err.Reason)
+}
+
+// ErrUnsupportedOnArch is returned by the operations that are not
+// implemented for the architecture of the target program.
+type ErrUnsupportedOnArch struct {
+	Operation string
+	Arch      string
+}
+
+func (err *ErrUnsupportedOnArch) Error() string {
+	return fmt.Sprintf("%s not supported on %s", err.Operation, err.Arch)
+}
+
+const (
+	reasonNoDebugInfo        = "the executable does not contain debug information"
+	reasonNoRuntimeDebugInfo = "the executable does not contain debug information for the runtime"
+	reasonUnknownGoVersion   = "the version of Go used to build the executable is unknown"
+)
+
+var features = []Feature{FeatureVariables, FeatureGoroutines, FeatureFunctionCalls, FeatureDefers, FeaturePanicBreakpoints, FeatureInterfaces}
+
+// Capabilities returns the features that depend on the debug information
+// of the runtime and whether they are available for the executable.
+func (bi *BinaryInfo) Capabilities() []Capability {
+	r := make([]Capability, 0, len(features))
+	for _, feature := range features {
+		reason := bi.unavailableReason(feature)
+		r = append(r, Capability{Feature: feature, Available: reason == "", Reason: reason})
+	}
+	return r
+}
+
+// checkFeature returns an ErrFeatureUnavailable error if feature is not
+// available for the executable.
+func (bi *BinaryInfo) checkFeature(feature Feature) error {
+	if reason := bi.unavailableReason(feature); reason != "" {
+		return &ErrFeatureUnavailable{Feature: feature, Reason: reason}
+	}
+	return nil
+}
+
+// unavailableReason returns the reason why feature is not available for
+// the executable, or the empty string if it is available. The
+// capabilities are determined the first time they are needed, once the
+// executable is loaded, since the runtime is part of it.
+func (bi *BinaryInfo) unavailableReason(feature Feature) string {
+	bi.capabilitiesOnce.Do(func() {
+		bi.unavailable = make(map[Feature]string)
+		for _, feature := range features {
+			if reason := bi.findUnavailableReason(feature); reason != "" {
+				bi.unavailable[feature] = reason
+			}
+		}
+	})
+	return bi.unavailable[feature]
+}
+
+func (bi *BinaryInfo) findUnavailableReason(feature Feature) string {
+	if feature == FeaturePanicBreakpoints {
+		// Only the functions are needed, which can also be found in pclntab.
+		if (bi.LookupFunc["runtime.startpanic"] == nil && bi.LookupFunc["runtime.fatalpanic"] == nil) || bi.LookupFunc["runtime.fatalthrow"] == nil {
+			return "the panic functions of the runtime were not found"
+		}
+		return ""
+	}
+	if len(bi.Images) == 0 || bi.Images[0].dwarf == nil {
+		// The executable was loaded from pclntab.
+		return reasonNoDebugInfo
+	}
+	if feature == FeatureVariables {
+		return ""
+	}
+
+	switch {
+	case bi.tinyGo:
+		switch feature {
+		case FeatureFunctionCalls:
+			return "not supported for programs built with TinyGo"
+		case FeatureDefers, FeatureInterfaces:
+			return "not supported by the runtime of TinyGo"
+		}
+		return ""
+	case bi.gccgo:
+		switch feature {
+		case FeatureFunctionCalls:
+			return "not supported for programs built with gccgo"
+		case FeatureDefers, FeatureInterfaces:
+			return "not supported by the runtime of gccgo"
+		}
+		return ""
+	}
+
+	if _, err := bi.findType("runtime.g"); err != nil {
+		return reasonNoRuntimeDebugInfo
+	}
+	switch feature {
+	case FeatureGoroutines:
+		if !bi.hasPackageVar("runtime.allglen") || (!bi.hasPackageVar("runtime.allgs") && !bi.hasPackageVar("runtime.allg")) {
+			return "the list of goroutines (runtime.allgs) was not found"
+		}
+	case FeatureFunctionCalls:
+		if bi.Producer() == "" {
+			return reasonUnknownGoVersion
+		}
+		if bi.LookupFunc[debugCallFunctionName] == nil {
+			return "the executable was built with a version of Go that does not support them"
+		}
+	case FeatureDefers:
+		if _, err := bi.findType("runtime._defer"); err != nil {
+			return reasonNoRuntimeDebugInfo
+		}
+	case FeatureInterfaces:
+		if _, err := bi.findType("runtime._type"); err != nil || !bi.hasPackageVar("runtime.firstmoduledata") {
+			return reasonNoRuntimeDebugInfo
+		}
+	}
+	return ""
+}
+
+// hasPackageVar returns true if the executable has the package variable
+// called name.
+func (bi *BinaryInfo) hasPackageVar(name string) bool {
+	for i := range bi.packageVars {
+		if bi.packageVars[i].name == name {
+			return true
+		}
+	}
+	return false
+}
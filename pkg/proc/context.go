@@ -0,0 +1,256 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"reflect"
+	"time"
+)
+
+// Context is one of the contexts in the chain of parents of a
+// context.Context.
+type Context struct {
+	// Type is the concrete type of the context, for example
+	// *context.valueCtx.
+	Type string
+	Addr uint64
+	// Key and Value are the key and the value of a context created by
+	// context.WithValue, Value is nil if it is a nil interface.
+	Key, Value *Variable
+	// Deadline is the deadline of a context created by context.WithDeadline
+	// or context.WithTimeout, the zero time for the other contexts.
+	Deadline time.Time
+	// Cancellable is true if the context can be canceled, by its cancel
+	// function or when its deadline expires, independently of its parent.
+	Cancellable bool
+	// Err is the error of a canceled context, nil if it was not canceled.
+	Err *Variable
+	// Waiters are the IDs of the goroutines blocked receiving from the Done
+	// channel of the context.
+	Waiters []int
+}
+
+// maxContextDepth is the maximum number of contexts returned by
+// ContextChain, in case the chain of parents is corrupted.
+const maxContextDepth = 1000
+
+// maxChanWaiters is the maximum number of goroutines blocked on a channel
+// returned by chanWaiters.
+const maxChanWaiters = 1000
+
+// ContextChain returns the chain of parents of ctx, a variable of type
+// context.Context, starting with ctx itself, without calling functions of
+// the target. Only the parents of the contexts of package context are
+// known, the chain ends with the first context of another type, or the
+// root context. The keys, values and errors of the contexts are loaded
+// with cfg, if it is not nil.
+func ContextChain(ctx *Variable, cfg *LoadConfig) ([]Context, error) {
+	if ctx.Kind != reflect.Interface {
+		return nil, fmt.Errorf("%s (type %s) is not a context.Context", ctx.Name, ctx.TypeString())
+	}
+	var r []Context
+	for len(r) < maxContextDepth {
+		c, err := interfaceValue(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			break
+		}
+		node := Context{Type: c.TypeString()}
+		c = c.maybeDereference()
+		if c.Unreadable != nil {
+			return nil, c.Unreadable
+		}
+		node.Addr = uint64(c.Addr)
+		if err := node.load(c, cfg); err != nil {
+			return nil, err
+		}
+		r = append(r, node)
+
+		// cancelCtx, timerCtx, valueCtx and afterFuncCtx embed their parent,
+		// withoutCancelCtx stores it in c.
+		if ctx, err = c.structMember("Context"); err != nil {
+			if ctx, err = c.structMember("c"); err != nil || ctx.Kind != reflect.Interface {
+				break
+			}
+		}
+	}
+	return r, nil
+}
+
+// load reads the fields of node from c, a context of package context.
+func (node *Context) load(c *Variable, cfg *LoadConfig) error {
+	if c.Kind != reflect.Struct {
+		return nil
+	}
+	switch c.DwarfType.Common().Name {
+	case "context.valueCtx":
+		key, err := c.structMember("key")
+		if err != nil {
+			return err
+		}
+		if node.Key, err = interfaceValue(key); err != nil {
+			return err
+		}
+		val, err := c.structMember("val")
+		if err != nil {
+			return err
+		}
+		if node.Value, err = interfaceValue(val); err != nil {
+			return err
+		}
+		for _, v := range []*Variable{node.Key, node.Value} {
+			if v != nil && cfg != nil {
+				v.loadValue(*cfg)
+			}
+		}
+		return nil
+	case "context.timerCtx":
+		deadline, err := c.structMember("deadline")
+		if err != nil {
+			return err
+		}
+		if node.Deadline, err = timeValue(deadline); err != nil {
+			return err
+		}
+	case "context.cancelCtx", "context.afterFuncCtx":
+	default:
+		return nil
+	}
+
+	node.Cancellable = true
+	// done and err are atomic.Value since Go 1.17 and Go 1.23 respectively,
+	// which are created lazily.
+	if err, _ := c.structMember("err"); err != nil {
+		err, _ = atomicValue(err)
+		if err != nil && err.Kind == reflect.Interface {
+			err, _ = interfaceValue(err)
+		}
+		if err != nil {
+			if cfg != nil {
+				err.loadValue(*cfg)
+			}
+			node.Err = err
+		}
+	}
+	if done, _ := c.structMember("done"); done != nil {
+		done, _ = atomicValue(done)
+		if done != nil && done.Kind == reflect.Chan {
+			node.Waiters = chanWaiters(done, "recvq")
+		}
+	}
+	return nil
+}
+
+// interfaceValue returns the value contained in the interface v, nil if v
+// is nil.
+func interfaceValue(v *Variable) (*Variable, error) {
+	v.loadInterface(0, false, loadFullValue)
+	if v.Unreadable != nil {
+		return nil, v.Unreadable
+	}
+	data := &v.Children[0]
+	if data.Unreadable != nil {
+		return nil, data.Unreadable
+	}
+	if data.Addr == 0 {
+		return nil, nil
+	}
+	data.OnlyAddr = false
+	return data, nil
+}
+
+// atomicValue returns the value stored in v if it is a sync/atomic.Value,
+// or v itself. Returns nil if nothing is stored in v.
+func atomicValue(v *Variable) (*Variable, error) {
+	if v.DwarfType.Common().Name != "sync/atomic.Value" {
+		return v, nil
+	}
+	iface, err := v.structMember("v")
+	if err != nil {
+		return nil, err
+	}
+	return interfaceValue(iface)
+}
+
+// chanWaiters returns the IDs of the goroutines blocked on the channel ch,
+// receiving from it if queue is recvq, sending to it if queue is sendq.
+func chanWaiters(ch *Variable, queue string) []int {
+	ch.loadValue(loadSingleValue)
+	if ch.Unreadable != nil || ch.Base == 0 {
+		return nil
+	}
+	sg, err := ch.structMember(queue)
+	if err == nil {
+		sg, err = sg.structMember("first")
+	}
+	var r []int
+	for err == nil && len(r) < maxChanWaiters {
+		sg.loadValue(loadSingleValue)
+		if sg.Unreadable != nil || len(sg.Children) == 0 || sg.Children[0].Addr == 0 {
+			break
+		}
+		var goid *Variable
+		if goid, err = sg.structMember("g"); err == nil {
+			if goid, err = goid.structMember("goid"); err == nil {
+				goid.loadValue(loadSingleValue)
+				if goid.Value != nil {
+					n, _ := constant.Int64Val(goid.Value)
+					r = append(r, int(n))
+				}
+			}
+		}
+		if err == nil {
+			sg, err = sg.structMember("next")
+		}
+	}
+	return r
+}
+
+// Constants of the representation of time.Time, see $GOROOT/src/time/time.go.
+const (
+	timeHasMonotonic     = 1 << 63
+	timeNsecMask         = 1<<30 - 1
+	timeNsecShift        = 30
+	timeWallToInternal   = (1884*365 + 1884/4 - 1884/100 + 1884/400) * 24 * 60 * 60
+	timeUnixToInternal   = (1969*365 + 1969/4 - 1969/100 + 1969/400) * 24 * 60 * 60
+	timeInternalToUnix   = -timeUnixToInternal
+	timeWallToUnixOffset = timeWallToInternal + timeInternalToUnix
+)
+
+// timeValue returns the instant represented by v, of type time.Time, in UTC.
+func timeValue(v *Variable) (time.Time, error) {
+	if v.DwarfType.Common().Name != "time.Time" {
+		return time.Time{}, fmt.Errorf("%s is not a time.Time", v.TypeString())
+	}
+	var wall uint64
+	var ext int64
+	for _, f := range []string{"wall", "ext"} {
+		fv, err := v.structMember(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		fv.loadValue(loadSingleValue)
+		if fv.Unreadable != nil {
+			return time.Time{}, fv.Unreadable
+		}
+		if fv.Value == nil {
+			return time.Time{}, errors.New("could not read time.Time")
+		}
+		if f == "wall" {
+			wall, _ = constant.Uint64Val(fv.Value)
+		} else {
+			ext, _ = constant.Int64Val(fv.Value)
+		}
+	}
+	nsec := int64(wall & timeNsecMask)
+	var sec int64
+	if wall&timeHasMonotonic != 0 {
+		sec = int64(wall<<1>>(timeNsecShift+1)) + timeWallToUnixOffset
+	} else {
+		sec = ext + timeInternalToUnix
+	}
+	return time.Unix(sec, nsec).UTC(), nil
+}
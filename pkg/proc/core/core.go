@@ -157,6 +157,10 @@ type process struct {
 	bi            *proc.BinaryInfo
 	breakpoints   proc.BreakpointMap
 	currentThread *thread
+
+	// closers are the files read by the memory of a snapshot, closed by
+	// Detach.
+	closers []io.Closer
 }
 
 var _ proc.ProcessInternal = &process{}
@@ -405,10 +409,14 @@ func (p *process) CurrentThread() proc.Thread {
 	return p.currentThread
 }
 
-// Detach will always return nil and have no
-// effect as you cannot detach from a core file
-// and have it continue execution or exit.
+// Detach will always return nil, it only releases the files read by
+// snapshots as you cannot detach from a core file and have it continue
+// execution or exit.
 func (p *process) Detach(bool) error {
+	for _, c := range p.closers {
+		c.Close()
+	}
+	p.closers = nil
 	return nil
 }
 
@@ -2,6 +2,8 @@ package core
 
 import (
 	"bytes"
+	"debug/elf"
+	"encoding/binary"
 	"flag"
 	"fmt"
 	"go/constant"
@@ -467,3 +469,211 @@ func procdump(t *testing.T, exePath string) string {
 	t.Fatalf("could not find dump file")
 	return ""
 }
+
+func TestParseMappings(t *testing.T) {
+	const maps = `00400000-0049c000 r-xp 00000000 fd:01 1234                               /usr/bin/prog
+0049c000-004e1000 r--p 0009c000 fd:01 1234                               /usr/bin/prog
+c000000000-c004000000 rw-p 00000000 00:00 0 
+7ffd5a1f2000-7ffd5a213000 rw-p 00000000 00:00 0                          [stack]
+7f0000000000-7f0000001000 r--p 00000000 fd:01 99                         /tmp/a file (deleted)
+`
+	got, err := parseMappings(strings.NewReader(maps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mapping{
+		{start: 0x400000, end: 0x49c000, perms: "r-xp", offset: 0, path: "/usr/bin/prog"},
+		{start: 0x49c000, end: 0x4e1000, perms: "r--p", offset: 0x9c000, path: "/usr/bin/prog"},
+		{start: 0xc000000000, end: 0xc004000000, perms: "rw-p"},
+		{start: 0x7ffd5a1f2000, end: 0x7ffd5a213000, perms: "rw-p", path: "[stack]"},
+		{start: 0x7f0000000000, end: 0x7f0000001000, perms: "r--p", path: "/tmp/a file (deleted)"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v\nwant %#v", got, want)
+	}
+	for i, copied := range []bool{false, false, true, true, true} {
+		if got[i].copied() != copied {
+			t.Errorf("mapping %d: copied() = %v, want %v", i, got[i].copied(), copied)
+		}
+	}
+
+	if _, err := parseMappings(strings.NewReader("zz-00400000 r-xp 00000000 fd:01 1234 /usr/bin/prog\n")); err == nil {
+		t.Error("no error for malformed mapping")
+	}
+}
+
+// testProg is a segment of an ELF file written by writeTestELF.
+type testProg struct {
+	typ   elf.ProgType
+	vaddr uint64
+	data  []byte
+}
+
+// writeTestELF writes a little endian ELF file, of the class used by
+// machine, with the specified type, entry point and segments to path.
+func writeTestELF(t *testing.T, path string, machine elf.Machine, typ elf.Type, entry uint64, progs []testProg) {
+	is32 := machine == elf.EM_ARM
+	ehsize, phentsize := 64, 56
+	class := elf.ELFCLASS64
+	if is32 {
+		ehsize, phentsize = 52, 32
+		class = elf.ELFCLASS32
+	}
+	word := func(buf *bytes.Buffer, v uint64) {
+		if is32 {
+			binary.Write(buf, binary.LittleEndian, uint32(v))
+		} else {
+			binary.Write(buf, binary.LittleEndian, v)
+		}
+	}
+	var buf bytes.Buffer
+	buf.Write([]byte{0x7f, 'E', 'L', 'F', byte(class), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)})
+	buf.Write(make([]byte, elf.EI_NIDENT-buf.Len()))
+	binary.Write(&buf, binary.LittleEndian, uint16(typ))
+	binary.Write(&buf, binary.LittleEndian, uint16(machine))
+	binary.Write(&buf, binary.LittleEndian, uint32(elf.EV_CURRENT))
+	word(&buf, entry)
+	word(&buf, uint64(ehsize)) // program headers follow the ELF header
+	word(&buf, 0)              // no section headers
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	binary.Write(&buf, binary.LittleEndian, []uint16{uint16(ehsize), uint16(phentsize), uint16(len(progs)), 0, 0, 0})
+
+	off := uint64(ehsize + phentsize*len(progs))
+	for _, prog := range progs {
+		size := uint64(len(prog.data))
+		if is32 {
+			binary.Write(&buf, binary.LittleEndian, []uint32{uint32(prog.typ), uint32(off), uint32(prog.vaddr), uint32(prog.vaddr), uint32(size), uint32(size), uint32(elf.PF_R | elf.PF_W), 4})
+		} else {
+			binary.Write(&buf, binary.LittleEndian, []uint32{uint32(prog.typ), uint32(elf.PF_R | elf.PF_W)})
+			binary.Write(&buf, binary.LittleEndian, []uint64{off, prog.vaddr, prog.vaddr, size, size, 4})
+		}
+		off += size
+	}
+	for _, prog := range progs {
+		buf.Write(prog.data)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testNote encodes an ELF note.
+func testNote(typ elf.NType, desc interface{}) []byte {
+	var d bytes.Buffer
+	if b, ok := desc.([]byte); ok {
+		d.Write(b)
+	} else {
+		binary.Write(&d, binary.LittleEndian, desc)
+	}
+	pad := func(buf *bytes.Buffer) {
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{5, uint32(d.Len()), uint32(typ)})
+	buf.WriteString("CORE\x00")
+	pad(&buf)
+	buf.Write(d.Bytes())
+	pad(&buf)
+	return buf.Bytes()
+}
+
+// TestCrossArchCore checks that linux core files of every supported
+// architecture can be read on any host, using synthesized executables and
+// core files.
+func TestCrossArchCore(t *testing.T) {
+	const (
+		pid      = 4321
+		textAddr = 0x10000
+		entry    = textAddr + 0x40
+		stack    = 0x7ff000
+		pc       = textAddr + 0x80
+		sp       = stack + 0x10
+	)
+	text := bytes.Repeat([]byte{0xaa}, 0x100)
+	stackData := []byte("stack contents")
+
+	for _, tc := range []struct {
+		name    string
+		machine elf.Machine
+	}{
+		{"amd64", elf.EM_X86_64},
+		{"arm64", elf.EM_AARCH64},
+		{"arm", elf.EM_ARM},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "crossarchcore")
+			assertNoError(err, t, "TempDir")
+			defer os.RemoveAll(dir)
+			exePath, corePath := filepath.Join(dir, "exe"), filepath.Join(dir, "core")
+
+			writeTestELF(t, exePath, tc.machine, elf.ET_EXEC, entry, []testProg{{elf.PT_LOAD, textAddr, text}})
+
+			var prstatus, prpsinfo interface{}
+			switch tc.machine {
+			case elf.EM_X86_64:
+				s := &linuxPrStatusAMD64{Pid: pid}
+				s.Reg.Rip, s.Reg.Rsp = pc, sp
+				prstatus, prpsinfo = s, &linuxPrPsInfo{Pid: pid}
+			case elf.EM_AARCH64:
+				s := &linuxPrStatusARM64{Pid: pid}
+				s.Reg.Pc, s.Reg.Sp = pc, sp
+				prstatus, prpsinfo = s, &linuxPrPsInfo{Pid: pid}
+			case elf.EM_ARM:
+				s := &linuxPrStatusARM{Pid: pid}
+				s.Reg.Uregs[15], s.Reg.Uregs[13] = pc, sp
+				prstatus, prpsinfo = s, &linuxPrPsInfoARM{Pid: pid}
+			}
+			words := func(ws ...uint64) []byte {
+				var buf bytes.Buffer
+				for _, w := range ws {
+					if tc.machine == elf.EM_ARM {
+						binary.Write(&buf, binary.LittleEndian, uint32(w))
+					} else {
+						binary.Write(&buf, binary.LittleEndian, w)
+					}
+				}
+				return buf.Bytes()
+			}
+
+			var notes []byte
+			notes = append(notes, testNote(elf.NT_PRPSINFO, prpsinfo)...)
+			notes = append(notes, testNote(elf.NT_PRSTATUS, prstatus)...)
+			notes = append(notes, testNote(_NT_AUXV, words(9 /* AT_ENTRY */, entry, 0, 0))...)
+			ntfile := words(1, 0x1000, textAddr, textAddr+uint64(len(text)), 0)
+			notes = append(notes, testNote(_NT_FILE, append(ntfile, []byte(exePath+"\x00")...))...)
+			writeTestELF(t, corePath, tc.machine, elf.ET_CORE, 0, []testProg{{elf.PT_NOTE, 0, notes}, {elf.PT_LOAD, stack, stackData}})
+
+			p, err := readLinuxCore(corePath, exePath)
+			assertNoError(err, t, "readLinuxCore")
+			if p.pid != pid {
+				t.Errorf("pid = %d, want %d", p.pid, pid)
+			}
+			if p.entryPoint != entry {
+				t.Errorf("entry point = %#x, want %#x", p.entryPoint, entry)
+			}
+			if len(p.Threads) != 1 || p.Threads[pid] == nil {
+				t.Fatalf("wrong threads: %v", p.Threads)
+			}
+			regs, err := p.Threads[pid].Registers()
+			assertNoError(err, t, "Registers")
+			if regs.PC() != pc || regs.SP() != sp {
+				t.Errorf("PC, SP = %#x, %#x, want %#x, %#x", regs.PC(), regs.SP(), uint64(pc), uint64(sp))
+			}
+
+			buf := make([]byte, len(stackData))
+			_, err = p.mem.ReadMemory(buf, stack)
+			assertNoError(err, t, "ReadMemory(stack)")
+			if !bytes.Equal(buf, stackData) {
+				t.Errorf("stack contents %q, want %q", buf, stackData)
+			}
+			buf = make([]byte, 4)
+			_, err = p.mem.ReadMemory(buf, pc)
+			assertNoError(err, t, "ReadMemory(text)")
+			if !bytes.Equal(buf, text[:4]) {
+				t.Errorf("text contents %x, want %x", buf, text[:4])
+			}
+		})
+	}
+}
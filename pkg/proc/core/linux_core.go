@@ -20,6 +20,12 @@ type linuxCoreTimeval struct {
 	Usec int64
 }
 
+// linuxCoreTimeval32 is the timeval struct of 32bit architectures.
+type linuxCoreTimeval32 struct {
+	Sec  int32
+	Usec int32
+}
+
 // NT_FILE is file mapping information, e.g. program text mappings. Desc is a LinuxNTFile.
 const _NT_FILE elf.NType = 0x46494c45 // "FILE".
 
@@ -89,7 +95,12 @@ func linuxThreadsFromNotes(p *process, notes []*note, machineType elf.Machine) {
 				}
 			}
 		case elf.NT_PRPSINFO:
-			p.pid = int(note.Desc.(*linuxPrPsInfo).Pid)
+			switch desc := note.Desc.(type) {
+			case *linuxPrPsInfo:
+				p.pid = int(desc.Pid)
+			case *linuxPrPsInfoARM:
+				p.pid = int(desc.Pid)
+			}
 		}
 	}
 }
@@ -287,7 +298,11 @@ func readNote(r io.ReadSeeker, machineType elf.Machine) (*note, error) {
 			return nil, fmt.Errorf("reading NT_PRSTATUS: %v", err)
 		}
 	case elf.NT_PRPSINFO:
-		note.Desc = &linuxPrPsInfo{}
+		if machineType == _EM_ARM {
+			note.Desc = &linuxPrPsInfoARM{}
+		} else {
+			note.Desc = &linuxPrPsInfo{}
+		}
 		if err := binary.Read(descReader, binary.LittleEndian, note.Desc); err != nil {
 			return nil, fmt.Errorf("reading NT_PRPSINFO: %v", err)
 		}
@@ -296,13 +311,18 @@ func readNote(r io.ReadSeeker, machineType elf.Machine) (*note, error) {
 		// simply a header, including entry count, followed by that
 		// many entries, and then the file name of each entry,
 		// null-delimited. Not reading the names here.
+		// All the fields are word sized.
+		wordSize := 8
+		if machineType == _EM_ARM {
+			wordSize = 4
+		}
 		data := &linuxNTFile{}
-		if err := binary.Read(descReader, binary.LittleEndian, &data.linuxNTFileHdr); err != nil {
+		if err := readWords(descReader, wordSize, &data.Count, &data.PageSize); err != nil {
 			return nil, fmt.Errorf("reading NT_FILE header: %v", err)
 		}
 		for i := 0; i < int(data.Count); i++ {
 			entry := &linuxNTFileEntry{}
-			if err := binary.Read(descReader, binary.LittleEndian, entry); err != nil {
+			if err := readWords(descReader, wordSize, &entry.Start, &entry.End, &entry.FileOfs); err != nil {
 				return nil, fmt.Errorf("reading NT_FILE entry %v: %v", i, err)
 			}
 			data.entries = append(data.entries, entry)
@@ -341,6 +361,23 @@ func readNote(r io.ReadSeeker, machineType elf.Machine) (*note, error) {
 	return note, nil
 }
 
+// readWords reads a sequence of little endian words of the specified size
+// from r.
+func readWords(r io.Reader, wordSize int, words ...*uint64) error {
+	buf := make([]byte, wordSize)
+	for _, w := range words {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		if wordSize == 4 {
+			*w = uint64(binary.LittleEndian.Uint32(buf))
+		} else {
+			*w = binary.LittleEndian.Uint64(buf)
+		}
+	}
+	return nil
+}
+
 // skipPadding moves r to the next multiple of pad.
 func skipPadding(r io.ReadSeeker, pad int64) error {
 	pos, err := r.Seek(0, os.SEEK_CUR)
@@ -419,6 +456,20 @@ type linuxPrPsInfo struct {
 	Args                 [80]uint8
 }
 
+// linuxPrPsInfoARM is the prpsinfo kernel struct of 32bit ARM, where
+// words are 32 bits and user and group IDs are 16 bits.
+type linuxPrPsInfoARM struct {
+	State                uint8
+	Sname                int8
+	Zomb                 uint8
+	Nice                 int8
+	Flag                 uint32
+	Uid, Gid             uint16
+	Pid, Ppid, Pgrp, Sid int32
+	Fname                [16]uint8
+	Args                 [80]uint8
+}
+
 // LinuxPrStatusAMD64 is a copy of the prstatus kernel struct.
 type linuxPrStatusAMD64 struct {
 	Siginfo                      linuxSiginfo
@@ -445,15 +496,16 @@ type linuxPrStatusARM64 struct {
 	Fpvalid                      int32
 }
 
-// LinuxPrStatusARM is a copy of the prstatus kernel struct.
+// LinuxPrStatusARM is a copy of the prstatus kernel struct, words are 32
+// bits on ARM.
 type linuxPrStatusARM struct {
 	Siginfo                      linuxSiginfo
 	Cursig                       uint16
 	_                            [2]uint8
-	Sigpend                      uint64
-	Sighold                      uint64
+	Sigpend                      uint32
+	Sighold                      uint32
 	Pid, Ppid, Pgrp, Sid         int32
-	Utime, Stime, CUtime, CStime linuxCoreTimeval
+	Utime, Stime, CUtime, CStime linuxCoreTimeval32
 	Reg                          linutil.ARMPtraceRegs
 	Fpvalid                      int32
 }
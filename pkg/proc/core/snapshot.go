@@ -0,0 +1,210 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// snapshotChunk is the size of the reads used to copy the memory of the
+// target.
+const snapshotChunk = 1 << 20
+
+// Snapshot captures the state of the stopped target t into a new target,
+// backed by memory like a core file, that can be inspected after t resumes
+// or exits. The registers of all threads and the contents of the writable
+// and anonymous mappings of t are copied, read-only file mappings are read
+// from the mapped files, which are kept open until the snapshot is detached.
+//
+// The snapshot shares the BinaryInfo of t, they must not be used
+// concurrently.
+//
+// Snapshots are only supported on linux.
+func Snapshot(t *proc.Target) (*proc.Target, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("snapshots are not supported on %s", runtime.GOOS)
+	}
+	if _, err := t.Valid(); err != nil {
+		return nil, err
+	}
+	if recorded, _ := t.Recorded(); recorded {
+		return nil, errors.New("can not take snapshots of recorded targets")
+	}
+	entryPoint, err := t.EntryPoint()
+	if err != nil {
+		return nil, err
+	}
+	maps, err := readMappings(t.Pid())
+	if err != nil {
+		return nil, err
+	}
+
+	p := &process{
+		Threads:    map[int]*thread{},
+		pid:        t.Pid(),
+		entryPoint: entryPoint,
+		bi:         t.BinInfo(),
+	}
+	mem, closers := snapshotMemory(t.CurrentThread(), maps)
+	p.mem = mem
+	p.closers = closers
+
+	for _, th := range t.ThreadList() {
+		regs, err := th.Registers()
+		if err == nil {
+			regs, err = regs.Copy()
+		}
+		if err != nil {
+			p.Detach(false)
+			return nil, fmt.Errorf("could not read registers of thread %d: %v", th.ThreadID(), err)
+		}
+		p.Threads[th.ThreadID()] = &thread{th: &snapshotThread{tid: th.ThreadID(), regs: regs}, p: p}
+		if th.ThreadID() == t.CurrentThread().ThreadID() {
+			p.currentThread = p.Threads[th.ThreadID()]
+		}
+	}
+	if p.currentThread == nil {
+		p.Detach(false)
+		return nil, errors.New("the current thread of the target does not exist")
+	}
+
+	snap, err := proc.NewTarget(p, proc.NewTargetConfig{
+		Path:          t.BinInfo().Images[0].Path,
+		BinInfoLoaded: true,
+		StopReason:    t.StopReason,
+	})
+	if err != nil {
+		p.Detach(false)
+		return nil, err
+	}
+	if g := t.SelectedGoroutine(); g != nil {
+		if sg, err := proc.FindGoroutine(snap, g.ID); err == nil && sg != nil {
+			snap.SwitchGoroutine(sg)
+		}
+	}
+	return snap, nil
+}
+
+// snapshotThread is a thread of a snapshot.
+type snapshotThread struct {
+	tid  int
+	regs proc.Registers
+}
+
+func (th *snapshotThread) pid() int {
+	return th.tid
+}
+
+func (th *snapshotThread) registers() (proc.Registers, error) {
+	return th.regs, nil
+}
+
+// mapping is a memory mapping of a process, read from /proc/pid/maps.
+type mapping struct {
+	start, end uintptr
+	perms      string
+	offset     int64
+	path       string
+}
+
+func (m *mapping) readable() bool { return strings.HasPrefix(m.perms, "r") }
+
+// copied returns true if the contents of the mapping must be copied, it
+// returns false for read-only mappings of regular files.
+func (m *mapping) copied() bool {
+	return m.perms[1] == 'w' || !strings.HasPrefix(m.path, "/") || strings.HasSuffix(m.path, " (deleted)")
+}
+
+func readMappings(pid int) ([]mapping, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMappings(f)
+}
+
+// parseMappings parses the contents of /proc/pid/maps, for example:
+//
+//	00400000-0049c000 r-xp 00000000 fd:01 1234   /usr/bin/prog
+//	c000000000-c004000000 rw-p 00000000 00:00 0
+func parseMappings(r io.Reader) ([]mapping, error) {
+	var maps []mapping
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		addrs := strings.SplitN(fields[0], "-", 2)
+		if len(addrs) != 2 || len(fields[1]) < 4 {
+			return nil, fmt.Errorf("malformed mapping %q", s.Text())
+		}
+		start, err1 := strconv.ParseUint(addrs[0], 16, 64)
+		end, err2 := strconv.ParseUint(addrs[1], 16, 64)
+		offset, err3 := strconv.ParseInt(fields[2], 16, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("malformed mapping %q", s.Text())
+		}
+		m := mapping{start: uintptr(start), end: uintptr(end), perms: fields[1], offset: offset}
+		if len(fields) > 5 {
+			m.path = strings.Join(fields[5:], " ")
+		}
+		maps = append(maps, m)
+	}
+	return maps, s.Err()
+}
+
+// snapshotMemory returns the memory of a snapshot of the mappings maps,
+// read with mem, and the files it reads from.
+func snapshotMemory(mem proc.MemoryReader, maps []mapping) (*splicedMemory, []io.Closer) {
+	r := &splicedMemory{}
+	var closers []io.Closer
+	files := map[string]*os.File{}
+	for i := range maps {
+		m := &maps[i]
+		if !m.readable() {
+			continue
+		}
+		if !m.copied() {
+			f := files[m.path]
+			if f == nil {
+				var err error
+				if f, err = os.Open(m.path); err != nil {
+					continue
+				}
+				files[m.path] = f
+				closers = append(closers, f)
+			}
+			size := int64(m.end - m.start)
+			r.Add(&offsetReaderAt{reader: io.NewSectionReader(f, m.offset, size), offset: m.start}, m.start, m.end-m.start)
+			continue
+		}
+		// Some mappings, like [vvar], can not be read. Keep what could be
+		// read up to the first error.
+		var buf bytes.Buffer
+		chunk := make([]byte, snapshotChunk)
+		for addr := m.start; addr < m.end; addr += uintptr(len(chunk)) {
+			if n := m.end - addr; n < uintptr(len(chunk)) {
+				chunk = chunk[:n]
+			}
+			n, err := mem.ReadMemory(chunk, addr)
+			buf.Write(chunk[:n])
+			if err != nil || n < len(chunk) {
+				break
+			}
+		}
+		if buf.Len() > 0 {
+			r.Add(&offsetReaderAt{reader: bytes.NewReader(buf.Bytes()), offset: m.start}, m.start, uintptr(buf.Len()))
+		}
+	}
+	return r, closers
+}
@@ -0,0 +1,182 @@
+package proc
+
+import "sort"
+
+// CoverageLine is a source line of a function tracked by line coverage,
+// see Target.AddCoverage.
+type CoverageLine struct {
+	Function string // Name of the function the line belongs to
+	File     string
+	Line     int
+	Executed bool // The line was executed at least once since it was added
+
+	pcs []uint64 // addresses of the CoverageBreakpoints of the line
+}
+
+// coverage holds the lines tracked by line coverage.
+type coverage struct {
+	fns   map[*Function]bool
+	lines []*CoverageLine
+	byPC  map[uint64]*CoverageLine // lines by address of their CoverageBreakpoints
+}
+
+// AddCoverage starts recording which lines of the functions fns are
+// executed. A CoverageBreakpoint is set on every statement of the
+// functions, including their inlined instances; the first time one of
+// them is hit the line is marked executed and all its breakpoints are
+// cleared, afterwards the line runs at full speed.
+// Returns the number of lines added, functions that are already tracked
+// are skipped.
+func (t *Target) AddCoverage(fns []*Function) (int, error) {
+	if valid, err := t.Valid(); !valid {
+		return 0, err
+	}
+	if t.coverage.fns == nil {
+		t.coverage.fns = make(map[*Function]bool)
+		t.coverage.byPC = make(map[uint64]*CoverageLine)
+	}
+	bi := t.BinInfo()
+	n := 0
+	for _, fn := range fns {
+		if t.coverage.fns[fn] || fn.cu == nil {
+			continue
+		}
+		t.coverage.fns[fn] = true
+		type fileLine struct {
+			file string
+			line int
+		}
+		byLine := map[fileLine]*CoverageLine{}
+		var lines []*CoverageLine
+		addRange := func(cu *compileUnit, lowpc, highpc uint64) error {
+			pcs, err := cu.lines().AllPCsBetween(lowpc, highpc-1, "", -1)
+			if err != nil {
+				return err
+			}
+			for _, pc := range pcs {
+				// statements of the functions inlined into fn are not lines of fn
+				if bi.PCToInlineFunc(pc) != fn {
+					continue
+				}
+				file, line, _ := bi.PCToLine(pc)
+				cl := byLine[fileLine{file, line}]
+				if cl == nil {
+					cl = &CoverageLine{Function: fn.Name, File: file, Line: line}
+					byLine[fileLine{file, line}] = cl
+					lines = append(lines, cl)
+				}
+				cl.pcs = append(cl.pcs, pc)
+			}
+			return nil
+		}
+		if fn.Entry < fn.End {
+			if err := addRange(fn.cu, fn.Entry, fn.End); err != nil {
+				return n, err
+			}
+		}
+		for _, call := range fn.InlinedCalls {
+			if err := addRange(call.cu, call.LowPC, call.HighPC); err != nil {
+				return n, err
+			}
+		}
+		for _, cl := range lines {
+			pcs := cl.pcs
+			cl.pcs = nil
+			for _, pc := range pcs {
+				if _, err := t.SetBreakpoint(pc, CoverageBreakpoint, nil); err != nil {
+					if _, exists := err.(BreakpointExistsError); !exists {
+						t.clearCoverageLine(cl)
+						return n, err
+					}
+				}
+				cl.pcs = append(cl.pcs, pc)
+				t.coverage.byPC[pc] = cl
+			}
+			t.coverage.lines = append(t.coverage.lines, cl)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Coverage returns the lines tracked by line coverage, sorted by file and
+// line.
+func (t *Target) Coverage() []CoverageLine {
+	r := make([]CoverageLine, 0, len(t.coverage.lines))
+	for _, cl := range t.coverage.lines {
+		r = append(r, *cl)
+		r[len(r)-1].pcs = nil
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		if r[i].File != r[j].File {
+			return r[i].File < r[j].File
+		}
+		return r[i].Line < r[j].Line
+	})
+	return r
+}
+
+// ClearCoverage stops recording line coverage, clearing the remaining
+// CoverageBreakpoints, and forgets the lines tracked.
+func (t *Target) ClearCoverage() error {
+	if valid, _ := t.Valid(); !valid {
+		t.coverage = coverage{}
+		return nil
+	}
+	for _, cl := range t.coverage.lines {
+		if err := t.clearCoverageLine(cl); err != nil {
+			return err
+		}
+	}
+	t.coverage = coverage{}
+	return nil
+}
+
+// handleCoverageBreakpoints marks the lines of the CoverageBreakpoints hit
+// by threads executed.
+func (t *Target) handleCoverageBreakpoints(threads []Thread) error {
+	for _, thread := range threads {
+		bp := thread.Breakpoint().covered
+		if bp == nil {
+			continue
+		}
+		thread.Breakpoint().covered = nil
+		cl := t.coverage.byPC[bp.Addr]
+		if cl == nil {
+			// already cleared by another thread
+			continue
+		}
+		cl.Executed = true
+		if err := t.clearCoverageLine(cl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearCoverageLine clears the CoverageBreakpoints of cl.
+func (t *Target) clearCoverageLine(cl *CoverageLine) error {
+	bpmap := t.Breakpoints()
+	for _, pc := range cl.pcs {
+		delete(t.coverage.byPC, pc)
+		bp := bpmap.M[pc]
+		if bp == nil || bp.Kind&CoverageBreakpoint == 0 {
+			continue
+		}
+		bp.Kind &^= CoverageBreakpoint
+		if bp.Kind != 0 {
+			continue
+		}
+		if err := t.proc.EraseBreakpoint(bp); err != nil {
+			return err
+		}
+		for _, thread := range t.ThreadList() {
+			if thread.Breakpoint().Breakpoint == bp {
+				thread.Breakpoint().Clear()
+			}
+		}
+		delete(bpmap.M, pc)
+	}
+	cl.pcs = nil
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"go/constant"
+	"reflect"
 	"testing"
 	"unsafe"
 
@@ -353,3 +354,65 @@ func TestNestedCompileUnts(t *testing.T) {
 		t.Errorf("expected 2 variables, got %d", n)
 	}
 }
+
+func TestGccgoStringsAndSlices(t *testing.T) {
+	// gccgo does not emit DW_AT_go_kind, strings and slices are recognized
+	// by the names of their fields.
+	const stringVal = "gccgo string"
+	sliceVal := []int64{1, 2, 3}
+
+	dwb := dwarfbuilder.New()
+
+	intoff := dwb.AddBaseType("int", dwarfbuilder.DW_ATE_signed, 8)
+	byteoff := dwb.AddBaseType("uint8", dwarfbuilder.DW_ATE_unsigned, 1)
+	byteptroff := dwb.AddPointerType("*uint8", byteoff)
+	intptroff := dwb.AddPointerType("*int", intoff)
+
+	stringoff := dwb.AddStructType("string", 16)
+	dwb.AddMember("__data", byteptroff, dwarfbuilder.LocationBlock(op.DW_OP_plus_uconst, uint(0)))
+	dwb.AddMember("__length", intoff, dwarfbuilder.LocationBlock(op.DW_OP_plus_uconst, uint(8)))
+	dwb.TagClose()
+
+	sliceoff := dwb.AddStructType("", 24)
+	dwb.AddMember("__values", intptroff, dwarfbuilder.LocationBlock(op.DW_OP_plus_uconst, uint(0)))
+	dwb.AddMember("__count", intoff, dwarfbuilder.LocationBlock(op.DW_OP_plus_uconst, uint(8)))
+	dwb.AddMember("__capacity", intoff, dwarfbuilder.LocationBlock(op.DW_OP_plus_uconst, uint(16)))
+	dwb.TagClose()
+
+	dwb.AddSubprogram("main.main", 0x40100, 0x41000)
+	dwb.AddVariable("s", stringoff, dwarfbuilder.LocationBlock(op.DW_OP_call_frame_cfa))
+	dwb.AddVariable("sl", sliceoff, dwarfbuilder.LocationBlock(op.DW_OP_call_frame_cfa, op.DW_OP_consts, int(16), op.DW_OP_plus))
+	dwb.TagClose()
+
+	bi, _ := fakeBinaryInfo(t, dwb)
+
+	mainfn := bi.LookupFunc["main.main"]
+
+	dataAddr := fakeCFA() + 40
+	mem := newFakeMemory(fakeCFA(),
+		dataAddr, uint64(len(stringVal)),
+		dataAddr+uint64(len(stringVal)), uint64(len(sliceVal)), uint64(len(sliceVal)),
+		[]byte(stringVal), sliceVal)
+	regs := linutil.AMD64Registers{Regs: &linutil.AMD64PtraceRegs{Rip: 0x40100}}
+	scope := &proc.EvalScope{Location: proc.Location{PC: 0x40100, Fn: mainfn}, Regs: dwarfRegisters(bi, &regs), Mem: mem, BinInfo: bi}
+
+	s, err := scope.EvalExpression("s", normalLoadConfig)
+	assertNoError(err, t, "EvalExpression(s)")
+	if s.Kind != reflect.String || constant.StringVal(s.Value) != stringVal {
+		t.Errorf("wrong value for s: %v %v", s.Kind, s.Value)
+	}
+
+	sl, err := scope.EvalExpression("sl", normalLoadConfig)
+	assertNoError(err, t, "EvalExpression(sl)")
+	if sl.Kind != reflect.Slice || sl.Len != int64(len(sliceVal)) || len(sl.Children) != len(sliceVal) {
+		t.Fatalf("wrong value for sl: %v len %d children %d", sl.Kind, sl.Len, len(sl.Children))
+	}
+	for i := range sliceVal {
+		if n, _ := constant.Int64Val(sl.Children[i].Value); n != sliceVal[i] {
+			t.Errorf("wrong value for sl[%d]: %d", i, n)
+		}
+	}
+	if sl.TypeString() != "[]int" {
+		t.Errorf("wrong type for sl: %s", sl.TypeString())
+	}
+}
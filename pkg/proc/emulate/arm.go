@@ -0,0 +1,181 @@
+package emulate
+
+import (
+	"math/bits"
+
+	"golang.org/x/arch/arm/armasm"
+)
+
+// armPCOffset is the distance from the address of an ARM instruction of
+// the value it reads from PC, including the offsets of PC relative
+// branches.
+const armPCOffset = 8
+
+// armNextPCs returns the addresses of the instructions that can be
+// executed after instr, the ARM instruction at regs.PC(): the next
+// instruction, always first, and the destination of instr if it changes
+// PC. The control flow instructions handled are tested by TestARMNextPCs.
+// If instr is a load exclusive the addresses are the ones reachable from
+// the end of its sequence, see atomicSequence.
+func armNextPCs(instr []byte, regs Registers, mem MemoryReader) ([]uint64, error) {
+	instrLen := uint64(len(instr))
+	nextPcs := []uint64{
+		regs.PC() + instrLen,
+	}
+	// Golang always use ARM mode.
+	nextInstr, err := armasm.Decode(instr, armasm.ModeARM)
+	if err != nil {
+		return nil, err
+	}
+	if armLoadExclusive(nextInstr.Op) {
+		seqPcs, err := armAtomicSequence(regs.PC(), mem)
+		if err != nil || seqPcs != nil {
+			return seqPcs, err
+		}
+		// The sequence does not end with a store exclusive close enough,
+		// step through it one instruction at a time.
+	}
+	reg := func(r armasm.Reg) (uint64, error) {
+		if r == armasm.PC {
+			return regs.PC() + armPCOffset, nil
+		}
+		return regs.Get(int(r))
+	}
+	switch nextInstr.Op {
+	case armasm.BL, armasm.BLX, armasm.B, armasm.BX:
+		switch arg := nextInstr.Args[0].(type) {
+		case armasm.Imm:
+			nextPcs = append(nextPcs, uint64(arg))
+		case armasm.Reg:
+			pc, err := reg(arg)
+			if err != nil {
+				return nil, err
+			}
+			nextPcs = append(nextPcs, pc)
+		case armasm.PCRel:
+			nextPcs = append(nextPcs, regs.PC()+armPCOffset+uint64(arg))
+		}
+	case armasm.POP:
+		if regList, ok := nextInstr.Args[0].(armasm.RegList); ok && (regList&(1<<uint(armasm.PC)) != 0) {
+			pc, err := reg(armasm.SP)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < int(armasm.PC); i++ {
+				if regList&(1<<uint(i)) != 0 {
+					pc += instrLen
+				}
+			}
+			pc, err = readUint32(mem, pc)
+			if err != nil {
+				return nil, err
+			}
+			nextPcs = append(nextPcs, pc)
+		}
+	case armasm.LDR:
+		// We need to check for the first args to be PC.
+		if r, ok := nextInstr.Args[0].(armasm.Reg); ok && r == armasm.PC {
+			switch arg := nextInstr.Args[1].(type) {
+			case armasm.Mem:
+				pc, err := reg(arg.Base)
+				if err != nil {
+					return nil, err
+				}
+				if arg.Mode == armasm.AddrOffset || arg.Mode == armasm.AddrPreIndex {
+					if arg.Sign != 0 {
+						idx, err := reg(arg.Index)
+						if err != nil {
+							return nil, err
+						}
+						if arg.Shift != armasm.ShiftLeft || arg.Count != 0 {
+							switch arg.Shift {
+							case armasm.ShiftLeft:
+								idx <<= arg.Count
+							case armasm.ShiftRight, armasm.ShiftRightSigned:
+								idx >>= arg.Count
+							case armasm.RotateRight, armasm.RotateRightExt:
+								idx = bits.RotateLeft64(idx, int(-arg.Count))
+							}
+						}
+						if arg.Sign < 0 {
+							pc -= idx
+						} else {
+							pc += idx
+						}
+					} else {
+						pc = uint64(int64(pc) + int64(arg.Offset))
+					}
+				}
+				pc, err = readUint32(mem, pc)
+				if err != nil {
+					return nil, err
+				}
+				nextPcs = append(nextPcs, pc)
+			}
+		}
+	case armasm.MOV, armasm.ADD:
+		// We need to check for the first args to be PC.
+		if r, ok := nextInstr.Args[0].(armasm.Reg); ok && r == armasm.PC {
+			var pc uint64
+			for _, argRaw := range nextInstr.Args[1:] {
+				switch arg := argRaw.(type) {
+				case armasm.Imm:
+					pc += uint64(arg)
+				case armasm.Reg:
+					regVal, err := reg(arg)
+					if err != nil {
+						return nil, err
+					}
+					pc += regVal
+				}
+			}
+			nextPcs = append(nextPcs, pc)
+		}
+	}
+	return nextPcs, nil
+}
+
+// armAtomicSequence returns the addresses reachable from the end of the
+// sequence started by the load exclusive at pc, see atomicSequence.
+func armAtomicSequence(pc uint64, mem MemoryReader) ([]uint64, error) {
+	return atomicSequence(pc, mem, func(instr []byte, addr uint64) (seqInstr, bool) {
+		inst, err := armasm.Decode(instr, armasm.ModeARM)
+		if err != nil {
+			return seqInstr{}, false
+		}
+		r := seqInstr{storeExclusive: armStoreExclusive(inst.Op)}
+		if armCondOp(inst.Op) == armCondOp(armasm.B) {
+			if rel, ok := inst.Args[0].(armasm.PCRel); ok {
+				r.branch, r.dest = true, addr+armPCOffset+uint64(rel)
+			}
+		}
+		return r, true
+	})
+}
+
+// armCondOp returns the first of the conditional variants of op, the
+// variants of each instruction are consecutive and op&15 is the condition.
+func armCondOp(op armasm.Op) armasm.Op {
+	return op &^ 15
+}
+
+func armIsLoadExclusive(instr []byte) bool {
+	inst, err := armasm.Decode(instr, armasm.ModeARM)
+	return err == nil && armLoadExclusive(inst.Op)
+}
+
+func armLoadExclusive(op armasm.Op) bool {
+	switch armCondOp(op) {
+	case armCondOp(armasm.LDREX), armCondOp(armasm.LDREXB), armCondOp(armasm.LDREXH), armCondOp(armasm.LDREXD):
+		return true
+	}
+	return false
+}
+
+func armStoreExclusive(op armasm.Op) bool {
+	switch armCondOp(op) {
+	case armCondOp(armasm.STREX), armCondOp(armasm.STREXB), armCondOp(armasm.STREXH), armCondOp(armasm.STREXD):
+		return true
+	}
+	return false
+}
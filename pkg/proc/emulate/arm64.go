@@ -0,0 +1,92 @@
+package emulate
+
+import (
+	"golang.org/x/arch/arm64/arm64asm"
+)
+
+// arm64NextPCs returns the addresses of the instructions that can be
+// executed after instr, the ARM64 instruction at regs.PC(): the next
+// instruction, always first, and the destination of instr if it is a
+// branch.
+// If instr is a load exclusive the addresses are the ones reachable from
+// the end of its sequence, see atomicSequence.
+func arm64NextPCs(instr []byte, regs Registers, mem MemoryReader) ([]uint64, error) {
+	pc := regs.PC()
+	inst, err := arm64asm.Decode(instr)
+	if err != nil {
+		return nil, err
+	}
+	if arm64LoadExclusive(inst.Op) {
+		nextPcs, err := arm64AtomicSequence(pc, mem)
+		if err != nil || nextPcs != nil {
+			return nextPcs, err
+		}
+		// The sequence does not end with a store exclusive close enough,
+		// step through it one instruction at a time.
+	}
+	nextPcs := []uint64{pc + instructionLen}
+	switch inst.Op {
+	case arm64asm.B, arm64asm.BL, arm64asm.CBZ, arm64asm.CBNZ, arm64asm.TBZ, arm64asm.TBNZ:
+		if dest, ok := arm64BranchDest(inst, pc); ok {
+			nextPcs = append(nextPcs, dest)
+		}
+	case arm64asm.BR, arm64asm.BLR, arm64asm.RET:
+		if r, ok := inst.Args[0].(arm64asm.Reg); ok {
+			dest, err := regs.Get(int(r))
+			if err != nil {
+				return nil, err
+			}
+			nextPcs = append(nextPcs, dest)
+		}
+	}
+	return nextPcs, nil
+}
+
+// arm64AtomicSequence returns the addresses reachable from the end of the
+// sequence started by the load exclusive at pc, see atomicSequence.
+func arm64AtomicSequence(pc uint64, mem MemoryReader) ([]uint64, error) {
+	return atomicSequence(pc, mem, func(instr []byte, addr uint64) (seqInstr, bool) {
+		inst, err := arm64asm.Decode(instr)
+		if err != nil {
+			return seqInstr{}, false
+		}
+		r := seqInstr{storeExclusive: arm64StoreExclusive(inst.Op)}
+		switch inst.Op {
+		case arm64asm.B, arm64asm.CBZ, arm64asm.CBNZ, arm64asm.TBZ, arm64asm.TBNZ:
+			r.dest, r.branch = arm64BranchDest(inst, addr)
+		}
+		return r, true
+	})
+}
+
+// arm64BranchDest returns the destination of the PC relative branch inst
+// at pc.
+func arm64BranchDest(inst arm64asm.Inst, pc uint64) (uint64, bool) {
+	for _, arg := range inst.Args {
+		if rel, ok := arg.(arm64asm.PCRel); ok {
+			return pc + uint64(rel), true
+		}
+	}
+	return 0, false
+}
+
+func arm64IsLoadExclusive(instr []byte) bool {
+	inst, err := arm64asm.Decode(instr)
+	return err == nil && arm64LoadExclusive(inst.Op)
+}
+
+func arm64LoadExclusive(op arm64asm.Op) bool {
+	switch op {
+	case arm64asm.LDXR, arm64asm.LDXRB, arm64asm.LDXRH, arm64asm.LDXP, arm64asm.LDAXR, arm64asm.LDAXRB, arm64asm.LDAXRH, arm64asm.LDAXP:
+		return true
+	}
+	return false
+}
+
+func arm64StoreExclusive(op arm64asm.Op) bool {
+	switch op {
+	case arm64asm.STXR, arm64asm.STXRB, arm64asm.STXRH, arm64asm.STXP, arm64asm.STLXR, arm64asm.STLXRB, arm64asm.STLXRH, arm64asm.STLXP:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package emulate
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/arch/arm64/arm64asm"
+)
+
+func TestARM64NextPCs(t *testing.T) {
+	// The sequences of exclusive loads and stores are the ones of
+	// _fixtures/arm64atomic, assembled by the Go toolchain.
+	const pc = 0x1000
+	tests := []struct {
+		name string
+		code []uint32 // instructions starting at pc
+		regs map[int]uint64
+		want []uint64
+	}{
+		{"b", []uint32{0x14000004}, nil, []uint64{pc + 4, pc + 16}},                                        // B .+16
+		{"bl", []uint32{0x94000004}, nil, []uint64{pc + 4, pc + 16}},                                       // BL .+16
+		{"bcond", []uint32{0x54000082}, nil, []uint64{pc + 4, pc + 16}},                                    // BHS .+16
+		{"cbnz", []uint32{0x35ffffa2}, nil, []uint64{pc + 4, pc - 12}},                                     // CBNZW R2, .-12
+		{"tbz", []uint32{0x36000041}, nil, []uint64{pc + 4, pc + 8}},                                       // TBZ $0, R1, .+8
+		{"br", []uint32{0xd61f0020}, map[int]uint64{int(arm64asm.X1): 0x2000}, []uint64{pc + 4, 0x2000}},   // B (R1)
+		{"blr", []uint32{0xd63f0020}, map[int]uint64{int(arm64asm.X1): 0x2000}, []uint64{pc + 4, 0x2000}},  // BL (R1)
+		{"ret", []uint32{0xd65f03c0}, map[int]uint64{int(arm64asm.X30): 0x2000}, []uint64{pc + 4, 0x2000}}, // RET
+		{"add", []uint32{0x11000421}, nil, []uint64{pc + 4}},                                               // ADDW $1, R1, R1
+
+		// LDAXRW (R0), R1; ADDW $1, R1, R1; STLXRW R1, (R0), R2; CBNZW R2, loop
+		{"atomic", []uint32{0x885ffc01, 0x11000421, 0x8802fc01, 0x35ffffa2}, nil, []uint64{pc + 12}},
+		// LDAXRW (R0), R1; CMPW $100, R1; BHS done; ADDW $1, R1, R1;
+		// STLXRW R1, (R0), R2; CBNZW R2, loop; done: RET
+		{"atomicWithBranch", []uint32{0x885ffc01, 0x7101903f, 0x54000082, 0x11000421, 0x8802fc01, 0x35ffff62, 0xd65f03c0}, nil, []uint64{pc + 20, pc + 24}},
+		// LDXP (R0), (R1, R2); ADD $1, R1, R1; ADD $1, R2, R2;
+		// STXP (R1, R2), (R0), R3; CBNZ R3, loop
+		{"atomicPair", []uint32{0xc87f0801, 0x91000421, 0x91000442, 0xc8230801, 0xb5ffff83}, nil, []uint64{pc + 16}},
+		// A load exclusive without a store exclusive is stepped normally.
+		{"atomicWithoutStore", append([]uint32{0x885ffc01}, repeatUint32(0x11000421, maxAtomicSequenceLen)...), nil, []uint64{pc + 4}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mem := fakeMemory{}
+			for i, instr := range tc.code {
+				mem[pc+uint64(i)*4] = instr
+			}
+			regs := &fakeRegisters{pc: pc, regs: tc.regs}
+			pcs, err := NextPCs("arm64", regs, mem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%#x", pcs) != fmt.Sprintf("%#x", tc.want) {
+				t.Errorf("got %#x, expected %#x", pcs, tc.want)
+			}
+			atomic, err := StartsAtomicSequence("arm64", regs, mem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isAtomic := tc.code[0] == 0x885ffc01 || tc.code[0] == 0xc87f0801; atomic != isAtomic {
+				t.Errorf("StartsAtomicSequence returned %v", atomic)
+			}
+		})
+	}
+}
+
+func repeatUint32(v uint32, n int) []uint32 {
+	r := make([]uint32, n)
+	for i := range r {
+		r[i] = v
+	}
+	return r
+}
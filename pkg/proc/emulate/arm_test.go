@@ -0,0 +1,124 @@
+package emulate
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/arch/arm/armasm"
+)
+
+type armRegs map[armasm.Reg]uint64
+
+// armStepTests are the control flow instructions of _fixtures/armstep,
+// assembled by the Go toolchain, with the state of the registers and
+// memory when they are executed. TestSoftwareSingleStepARM in pkg/proc
+// runs the same instructions under the native backend.
+var armStepTests = []struct {
+	name  string
+	asm   string
+	pc    uint64
+	instr uint32
+	regs  armRegs
+	mem   fakeMemory
+	want  uint64
+	// unhandled is true for the instructions NextPCs does not handle
+	// yet, the test fails if it starts handling them so that the flag can
+	// be removed.
+	unhandled bool
+}{
+	{"branch", "B ·target(SB)", 0xa183c, 0xeafffff9, nil, nil, armTarget, false},
+	{"branchLink", "BL ·target(SB)", 0xa184c, 0xebfffff5, nil, nil, armTarget, false},
+	{"branchReg", "B (R5)", 0xa1860, 0xe285f000, armRegs{armasm.R5: armTarget}, nil, armTarget, false},
+	{"branchLinkReg", "BL (R5)", 0xa1878, 0xe12fff35, armRegs{armasm.R5: armTarget}, nil, armTarget, false},
+	{"movPC", "MOVW R5, R15", 0xa1890, 0xe1a0f005, armRegs{armasm.R5: armTarget}, nil, armTarget, false},
+	{"addPC", "ADD $4, R15, R15", 0xa18a4, 0xe28ff004, nil, nil, 0xa18b0, false},
+	{"addPCReg", "ADD R6, R5, R15", 0xa18c4, 0xe085f006, armRegs{armasm.R5: armTarget - 4, armasm.R6: 4}, nil, armTarget, false},
+	{"ldrPC", "MOVW (R5), R15", 0xa18dc, 0xe595f000,
+		armRegs{armasm.R5: armTargets}, fakeMemory{armTargets: armTarget}, armTarget, false},
+	{"ldrPCOffset", "MOVW 4(R5), R15", 0xa18f4, 0xe595f004,
+		armRegs{armasm.R5: armTargets}, fakeMemory{armTargets + 4: armTarget}, armTarget, false},
+	{"ldrPCIndex", "MOVW R6<<2(R5), R15", 0xa1910, 0xe795f106,
+		armRegs{armasm.R5: armTargets, armasm.R6: 1}, fakeMemory{armTargets + 4: armTarget}, armTarget, false},
+	{"ldrPCPostIndex", "MOVW.P 4(R13), R15", 0xa192c, 0xe49df004,
+		armRegs{armasm.SP: armSP}, fakeMemory{armSP: armTarget}, armTarget, false},
+	{"popPC", "MOVM.IA.W (R13), [R4, R15]", 0xa1948, 0xe8bd8010,
+		armRegs{armasm.SP: armSP}, fakeMemory{armSP + 4: armTarget}, armTarget, false},
+	{"branchCondNotTaken", "BNE taken", 0xa1974, 0x1a000000, nil, nil, 0xa1978, false},
+
+	{"branchCondTaken", "BEQ taken", 0xa1960, 0x0a000000, nil, nil, 0xa1968, true},
+	{"movPCCond", "MOVW.EQ R5, R15", 0xa198c, 0x01a0f005, armRegs{armasm.R5: armTarget}, nil, armTarget, true},
+	{"subPC", "SUB $4, R5, R15", 0xa19a8, 0xe245f004, armRegs{armasm.R5: armTarget + 4}, nil, armTarget, true},
+	{"addPCShift", "ADD R6<<2, R5, R15", 0xa19cc, 0xe085f106, armRegs{armasm.R5: armTarget - 4, armasm.R6: 1}, nil, armTarget, true},
+	{"ldmPC", "MOVM.IA (R5), [R4, R15]", 0xa19e4, 0xe8958010,
+		armRegs{armasm.R5: armTargets}, fakeMemory{armTargets + 4: armTarget}, armTarget, true},
+}
+
+// Addresses of main.target and main.targets in _fixtures/armstep and of
+// the top of the stack.
+const (
+	armTarget  = 0xa1828
+	armTargets = 0xb7ae8
+	armSP      = 0x1000
+)
+
+func TestARMNextPCs(t *testing.T) {
+	for _, tc := range armStepTests {
+		t.Run(tc.name, func(t *testing.T) {
+			regs := &fakeRegisters{pc: tc.pc, regs: map[int]uint64{}}
+			for r, v := range tc.regs {
+				regs.regs[int(r)] = v
+			}
+			mem := fakeMemory{tc.pc: tc.instr}
+			for addr, v := range tc.mem {
+				mem[addr] = v
+			}
+			pcs, err := NextPCs("arm", regs, mem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkNextPCs(t, tc.asm, pcs, tc.pc+4, tc.want, tc.unhandled)
+		})
+	}
+}
+
+func TestARMAtomicSequence(t *testing.T) {
+	// The sequences are the ones of main.atomicAdd and main.atomicCas in
+	// _fixtures/armstep, starting at the load exclusive.
+	const pc = 0x1000
+	tests := []struct {
+		name string
+		code []uint32 // instructions starting at pc
+		want []uint64
+	}{
+		// LDREX (R1), R0; ADD $1, R0; STREX R0, (R1), R2; CMP $0, R2; BNE loop
+		{"atomicAdd", []uint32{0xe1910f9f, 0xe2800001, 0xe1812f90, 0xe3520000, 0x1afffffa}, []uint64{pc + 12}},
+		// LDREX (R1), R0; CMP R0, R2; BNE fail; STREX R3, (R1), R0;
+		// CMP $0, R0; BNE loop; B (R7); fail: B (R7)
+		{"atomicCas", []uint32{0xe1910f9f, 0xe1520000, 0x1a000003, 0xe1810f93, 0xe3500000, 0x1afffff9, 0xe287f000, 0xe287f000}, []uint64{pc + 16, pc + 28}},
+		// A load exclusive without a store exclusive is stepped normally.
+		{"atomicWithoutStore", append([]uint32{0xe1910f9f}, repeatUint32(0xe2800001, maxAtomicSequenceLen)...), []uint64{pc + 4}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mem := fakeMemory{}
+			for i, instr := range tc.code {
+				mem[pc+uint64(i)*4] = instr
+			}
+			regs := &fakeRegisters{pc: pc}
+			pcs, err := NextPCs("arm", regs, mem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%#x", pcs) != fmt.Sprintf("%#x", tc.want) {
+				t.Errorf("got %#x, expected %#x", pcs, tc.want)
+			}
+			atomic, err := StartsAtomicSequence("arm", regs, mem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !atomic {
+				t.Errorf("StartsAtomicSequence returned false")
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Package emulate predicts the addresses of the instructions a thread can
+// execute after the current one, for the architectures where the backends
+// can not single step every instruction: ptrace does not implement single
+// stepping on ARM and single stepping a sequence of exclusive loads and
+// stores, on ARM and ARM64, clears the exclusive monitor, so that the
+// sequence never completes. The backends emulate single stepping with a breakpoint on
+// each of the addresses.
+//
+// Only the registers and the memory of the thread are needed, through the
+// Registers and MemoryReader interfaces, which are satisfied by
+// proc.Registers and proc.MemoryReader, so that the package can be used by
+// all the backends and to analyze core files.
+package emulate
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Registers gives access to the registers of a thread.
+type Registers interface {
+	// PC returns the address of the current instruction.
+	PC() uint64
+	// Get returns the value of register n, numbered like the registers of
+	// golang.org/x/arch/arm/armasm on ARM and of
+	// golang.org/x/arch/arm64/arm64asm on ARM64.
+	Get(n int) (uint64, error)
+}
+
+// MemoryReader reads the memory of the target.
+type MemoryReader interface {
+	ReadMemory(buf []byte, addr uintptr) (n int, err error)
+}
+
+// instructionLen is the length of the instructions of ARM, in ARM mode,
+// and ARM64.
+const instructionLen = 4
+
+// NextPCs returns the addresses of the instructions that can be executed
+// after the instruction at regs.PC() on the architecture arch, named like
+// proc.Arch. The first address is the one of the next instruction, or,
+// if the current instruction starts a sequence of exclusive loads and
+// stores on ARM64, of the instruction following the sequence.
+func NextPCs(arch string, regs Registers, mem MemoryReader) ([]uint64, error) {
+	instr, err := readInstruction(mem, regs.PC())
+	if err != nil {
+		return nil, err
+	}
+	switch arch {
+	case "arm":
+		return armNextPCs(instr, regs, mem)
+	case "arm64":
+		return arm64NextPCs(instr, regs, mem)
+	}
+	return nil, fmt.Errorf("next PC prediction not implemented for %s", arch)
+}
+
+// StartsAtomicSequence returns true if the instruction at regs.PC() is a
+// load exclusive starting a sequence that can not be single stepped, on
+// ARM and ARM64. The addresses returned by NextPCs must be used to step
+// over the sequence instead.
+func StartsAtomicSequence(arch string, regs Registers, mem MemoryReader) (bool, error) {
+	var isLoadExclusive func([]byte) bool
+	switch arch {
+	case "arm":
+		isLoadExclusive = armIsLoadExclusive
+	case "arm64":
+		isLoadExclusive = arm64IsLoadExclusive
+	default:
+		return false, nil
+	}
+	instr, err := readInstruction(mem, regs.PC())
+	if err != nil {
+		return false, err
+	}
+	return isLoadExclusive(instr), nil
+}
+
+// maxAtomicSequenceLen is the maximum number of instructions, after a
+// load exclusive, searched for the store exclusive ending its sequence.
+const maxAtomicSequenceLen = 16
+
+// seqInstr describes an instruction of an atomic sequence.
+type seqInstr struct {
+	storeExclusive bool
+	branch         bool
+	dest           uint64 // destination of a branch
+}
+
+// atomicSequence returns the addresses reachable from the end of the
+// sequence of exclusive loads and stores started by the load exclusive at
+// pc: the instruction after the store exclusive ending the sequence and
+// the destinations outside of the sequence of its branches, the first
+// instructions that can be executed after the whole sequence. Stopping
+// inside of the sequence clears the exclusive monitor, the store would
+// fail every time and the sequence would be retried forever.
+// Returns nil if the sequence does not end with a store exclusive within
+// maxAtomicSequenceLen instructions or an instruction can not be decoded
+// by decode, which returns the description of the instruction at addr.
+func atomicSequence(pc uint64, mem MemoryReader, decode func(instr []byte, addr uint64) (seqInstr, bool)) ([]uint64, error) {
+	var dests []uint64
+	for i := uint64(1); i <= maxAtomicSequenceLen; i++ {
+		addr := pc + i*instructionLen
+		instr, err := readInstruction(mem, addr)
+		if err != nil {
+			return nil, err
+		}
+		inst, ok := decode(instr, addr)
+		if !ok {
+			return nil, nil
+		}
+		if inst.storeExclusive {
+			nextPcs := []uint64{addr + instructionLen}
+			for _, dest := range dests {
+				// Branches to the inside of the sequence, for example to
+				// retry it, don't leave it.
+				if dest <= pc || dest > addr {
+					nextPcs = append(nextPcs, dest)
+				}
+			}
+			return nextPcs, nil
+		}
+		if inst.branch {
+			dests = append(dests, inst.dest)
+		}
+	}
+	return nil, nil
+}
+
+func readInstruction(mem MemoryReader, addr uint64) ([]byte, error) {
+	instr := make([]byte, instructionLen)
+	if _, err := mem.ReadMemory(instr, uintptr(addr)); err != nil {
+		return nil, err
+	}
+	return instr, nil
+}
+
+func readUint32(mem MemoryReader, addr uint64) (uint64, error) {
+	buf := make([]byte, 4)
+	if _, err := mem.ReadMemory(buf, uintptr(addr)); err != nil {
+		return 0, err
+	}
+	return uint64(binary.LittleEndian.Uint32(buf)), nil
+}
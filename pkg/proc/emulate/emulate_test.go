@@ -0,0 +1,53 @@
+package emulate
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+type fakeRegisters struct {
+	pc   uint64
+	regs map[int]uint64
+}
+
+func (regs *fakeRegisters) PC() uint64 {
+	return regs.pc
+}
+
+func (regs *fakeRegisters) Get(n int) (uint64, error) {
+	return regs.regs[n], nil
+}
+
+// fakeMemory maps addresses to the 32 bit words stored there.
+type fakeMemory map[uint64]uint32
+
+func (mem fakeMemory) ReadMemory(buf []byte, addr uintptr) (int, error) {
+	v, ok := mem[uint64(addr)]
+	if !ok || len(buf) != 4 {
+		return 0, fmt.Errorf("could not read %d bytes at %#x", len(buf), addr)
+	}
+	binary.LittleEndian.PutUint32(buf, v)
+	return len(buf), nil
+}
+
+// checkNextPCs checks that the first address of pcs is first and that want
+// is one of them or, if unhandled is true, that it isn't.
+func checkNextPCs(t *testing.T, asm string, pcs []uint64, first, want uint64, unhandled bool) {
+	t.Helper()
+	if len(pcs) == 0 || pcs[0] != first {
+		t.Errorf("%s: first address is not %#x in %#x", asm, first, pcs)
+	}
+	found := false
+	for _, pc := range pcs {
+		found = found || pc == want
+	}
+	switch {
+	case unhandled && found:
+		t.Errorf("%s: expected address %#x found in %#x, the instruction is handled now", asm, want, pcs)
+	case unhandled:
+		t.Logf("%s: expected address %#x not found in %#x, not handled yet", asm, want, pcs)
+	case !found:
+		t.Errorf("%s: expected address %#x not found in %#x", asm, want, pcs)
+	}
+}
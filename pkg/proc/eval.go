@@ -25,6 +25,8 @@ import (
 
 var errOperationOnSpecialFloat = errors.New("operations on non-finite floats not implemented")
 
+var errKeyNotFound = errors.New("key not found")
+
 // EvalScope is the scope for variable evaluation. Contains the thread,
 // current location (PC), and canonical frame address.
 type EvalScope struct {
@@ -304,10 +306,12 @@ func afterLastArgAddr(vars []*Variable) uintptr {
 // * If srcv is nil and dstv is of a nil'able type then dstv is nilled.
 // * If srcv is the empty string and dstv is a string then dstv is set to the
 //   empty string.
-// * If dstv is an "interface {}" and srcv is either an interface (possibly
-//   non-empty) or a pointer shaped type (map, channel, pointer or struct
-//   containing a single pointer field) the type conversion to "interface {}"
-//   is performed.
+// * If dstv is an "interface {}" and srcv is an interface (possibly
+//   non-empty) the type conversion to "interface {}" is performed.
+// * If dstv is an interface and srcv is a value of a concrete type the
+//   interface is set to srcv, values that are not pointer shaped (map,
+//   channel, pointer or struct containing a single pointer field) are
+//   copied to the heap, which requires a function call.
 // * If srcv and dstv have the same type and are both addressable then the
 //   contents of srcv are copied byte-by-byte into dstv
 func (scope *EvalScope) setValue(dstv, srcv *Variable, srcExpr string) error {
@@ -315,7 +319,11 @@ func (scope *EvalScope) setValue(dstv, srcv *Variable, srcExpr string) error {
 
 	typerr := srcv.isType(dstv.RealType, dstv.Kind)
 	if _, isTypeConvErr := typerr.(*typeConvErr); isTypeConvErr {
-		// attempt iface -> eface and ptr-shaped -> eface conversions.
+		if dstv.Kind == reflect.Interface && srcv.Kind != reflect.Interface && srcv.DwarfType != nil {
+			// concrete type -> interface conversion
+			return scope.convertToInterface(srcv, dstv, false)
+		}
+		// attempt iface -> eface conversions.
 		return convertToEface(srcv, dstv)
 	}
 	if typerr != nil {
@@ -403,15 +411,19 @@ func (scope *EvalScope) SetVariable(name, value string) error {
 
 	t, err = parser.ParseExpr(value)
 	if err != nil {
-		return err
-	}
-
-	yv, err := scope.evalAST(t)
-	if err != nil {
-		return err
+		if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+			return err
+		}
+		// composite literal with the type elided
+		if t, _ = parser.ParseExpr(elidedLitType + value); t == nil {
+			return err
+		}
+		if _, ok := t.(*ast.CompositeLit); !ok {
+			return err
+		}
 	}
 
-	return scope.setValue(xv, yv, value)
+	return scope.assign(xv, t)
 }
 
 // LocalVariables returns all local variables from the current function scope.
@@ -728,15 +740,27 @@ func (scope *EvalScope) evalAST(t ast.Expr) (*Variable, error) {
 		// try to interpret the selector as a package variable
 		if maybePkg, ok := node.X.(*ast.Ident); ok {
 			if maybePkg.Name == "runtime" && node.Sel.Name == "curg" {
-				if scope.g == nil {
-					typ, err := scope.BinInfo.findType("runtime.g")
+				if scope.g == nil || scope.BinInfo.tinyGo {
+					// TinyGo tasks do not have a goid field, the ID of the
+					// goroutine is faked for breakpoint conditions.
+					gtyp, goid := "runtime.g", int64(0)
+					if scope.BinInfo.tinyGo {
+						gtyp = tinyGoTaskType
+						if scope.g != nil {
+							goid = int64(scope.g.ID)
+						}
+					}
+					typ, err := scope.BinInfo.findType(gtyp)
 					if err != nil {
-						return nil, fmt.Errorf("blah: %v", err)
+						if err := scope.BinInfo.checkFeature(FeatureGoroutines); err != nil {
+							return nil, err
+						}
+						return nil, fmt.Errorf("could not evaluate runtime.curg: %v", err)
 					}
 					gvar := newVariable("curg", fakeAddress, typ, scope.BinInfo, scope.Mem)
 					gvar.loaded = true
 					gvar.Flags = VariableFakeAddress
-					gvar.Children = append(gvar.Children, *newConstant(constant.MakeInt64(0), scope.Mem))
+					gvar.Children = append(gvar.Children, *newConstant(constant.MakeInt64(goid), scope.Mem))
 					gvar.Children[0].Name = "goid"
 					return gvar, nil
 				}
@@ -961,11 +985,192 @@ func (scope *EvalScope) evalBuiltinCall(node *ast.CallExpr) (*Variable, error) {
 		return callBuiltinWithArgs(imagBuiltin)
 	case "real":
 		return callBuiltinWithArgs(realBuiltin)
+	case "iface":
+		return scope.ifaceBuiltin(node)
+	case "glob":
+		return scope.globBuiltin(node)
+	case "haskey":
+		return scope.haskeyBuiltin(node)
+	case "ctxvalue":
+		return scope.ctxvalueBuiltin(node)
 	}
 
 	return nil, nil
 }
 
+// maxGlobStringLen is the maximum length of the strings loaded by the
+// glob builtin.
+const maxGlobStringLen = 4096
+
+// globBuiltin evaluates glob(pattern, s...), true if the concatenation of
+// the strings s matches pattern, where '*' matches any sequence of
+// characters, including '/', and '?' matches any single character.
+func (scope *EvalScope) globBuiltin(node *ast.CallExpr) (*Variable, error) {
+	if len(node.Args) < 2 {
+		return nil, fmt.Errorf("wrong number of arguments to glob: %d", len(node.Args))
+	}
+	var strs []string
+	for _, arg := range node.Args {
+		v, err := scope.evalAST(arg)
+		if err != nil {
+			return nil, err
+		}
+		if v.Kind != reflect.String {
+			return nil, fmt.Errorf("invalid argument %s (type %s) for glob", exprToString(arg), v.TypeString())
+		}
+		if v.Value == nil {
+			v.loadValue(LoadConfig{MaxStringLen: maxGlobStringLen})
+			if v.Unreadable != nil {
+				return nil, v.Unreadable
+			}
+		}
+		strs = append(strs, constant.StringVal(v.Value))
+	}
+	return newConstant(constant.MakeBool(globMatch(strs[0], strings.Join(strs[1:], ""))), scope.Mem), nil
+}
+
+// globMatch returns true if s matches pattern, see globBuiltin.
+func globMatch(pattern, s string) bool {
+	p, str := []rune(pattern), []rune(s)
+	// star and starStr are the positions, in p and str, after the last '*'
+	// of pattern, from where the match is retried consuming one more
+	// character of s if the rest of pattern does not match.
+	star, starStr := -1, 0
+	i, j := 0, 0
+	for j < len(str) {
+		switch {
+		case i < len(p) && (p[i] == '?' || p[i] == str[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '*':
+			star, starStr = i+1, j
+			i++
+		case star >= 0:
+			starStr++
+			i, j = star, starStr
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// haskeyBuiltin evaluates haskey(m, k), true if the map m contains the key
+// k. Indexing a map with a missing key is an error, haskey can guard it in
+// breakpoint conditions.
+func (scope *EvalScope) haskeyBuiltin(node *ast.CallExpr) (*Variable, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments to haskey: %d", len(node.Args))
+	}
+	m, err := scope.evalAST(node.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	m = m.maybeDereference()
+	if m.Kind != reflect.Map {
+		return nil, fmt.Errorf("invalid argument %s (type %s) for haskey", exprToString(node.Args[0]), m.TypeString())
+	}
+	k, err := scope.evalAST(node.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	k.loadValue(loadFullValue)
+	if k.Unreadable != nil {
+		return nil, k.Unreadable
+	}
+	_, err = m.mapAccess(k)
+	switch err {
+	case nil:
+		return newConstant(constant.MakeBool(true), scope.Mem), nil
+	case errKeyNotFound:
+		return newConstant(constant.MakeBool(false), scope.Mem), nil
+	}
+	return nil, err
+}
+
+// ctxvalueBuiltin evaluates ctxvalue(ctx, "T"), the value associated in the
+// context ctx, or one of its parents, with a key of the type named T, like
+// ctx.Value(T{}) without calling functions of the target. Only the parents
+// of the contexts of package context are visited, see ContextChain.
+func (scope *EvalScope) ctxvalueBuiltin(node *ast.CallExpr) (*Variable, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments to ctxvalue: %d", len(node.Args))
+	}
+	ctx, err := scope.evalAST(node.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Kind != reflect.Interface {
+		return nil, fmt.Errorf("invalid argument %s (type %s) for ctxvalue", exprToString(node.Args[0]), ctx.TypeString())
+	}
+	keytyp, err := scope.evalAST(node.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if keytyp.Kind != reflect.String || keytyp.Value == nil {
+		return nil, fmt.Errorf("invalid argument %s for ctxvalue, must be the name of a type", exprToString(node.Args[1]))
+	}
+	keyname := constant.StringVal(keytyp.Value)
+
+	chain, err := ContextChain(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chain {
+		if c.Key != nil && c.Key.DwarfType.Common().Name == keyname {
+			if c.Value == nil {
+				return nilVariable, nil
+			}
+			return c.Value, nil
+		}
+	}
+	return nil, fmt.Errorf("no value with a key of type %s in %s", keyname, exprToString(node.Args[0]))
+}
+
+// ifaceBuiltin evaluates iface(x, T), the value contained in the interface
+// x viewed as a value of type T. Unlike the type assertion x.(T) the
+// dynamic type of x is not checked, which makes it usable when the dynamic
+// type can not be determined, for example when the executable lacks the
+// debug information of the runtime.
+func (scope *EvalScope) ifaceBuiltin(node *ast.CallExpr) (*Variable, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments to iface: %d", len(node.Args))
+	}
+	xv, err := scope.evalAST(node.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if xv.Kind != reflect.Interface {
+		return nil, fmt.Errorf("invalid argument %s (type %s) for iface", exprToString(node.Args[0]), xv.TypeString())
+	}
+	typ, err := scope.BinInfo.findTypeExpr(node.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	_, data, isnil := xv.readInterface()
+	if xv.Unreadable != nil {
+		return nil, xv.Unreadable
+	}
+	if data == nil {
+		return nil, fmt.Errorf("invalid interface type")
+	}
+	if isnil {
+		return nil, fmt.Errorf("interface conversion: %s is nil, not %s", exprToString(node.Args[0]), exprToString(node.Args[1]))
+	}
+	// Values of pointer shaped types are stored in the data word of the
+	// interface, all others are stored in the memory it points to.
+	switch resolveTypedef(typ).(type) {
+	case *godwarf.PtrType, *godwarf.MapType, *godwarf.ChanType, *godwarf.FuncType:
+		return data.newVariable("", data.Addr, typ, data.mem), nil
+	}
+	v := data.newVariable("", data.Addr, pointerTo(typ, scope.BinInfo.Arch), data.mem).maybeDereference()
+	v.Name = ""
+	return v, nil
+}
+
 func capBuiltin(args []*Variable, nodeargs []ast.Expr) (*Variable, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("wrong number of arguments to cap: %d", len(args))
@@ -1919,7 +2124,7 @@ func (v *Variable) mapAccess(idx *Variable) (*Variable, error) {
 		return nil, v.Unreadable
 	}
 	// go would return zero for the map value type here, we do not have the ability to create zeroes
-	return nil, fmt.Errorf("key not found")
+	return nil, errKeyNotFound
 }
 
 func (v *Variable) reslice(low int64, high int64) (*Variable, error) {
@@ -0,0 +1,253 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+
+	"github.com/go-delve/delve/pkg/astutil"
+)
+
+// exitInvocation is an invocation of a function with an AtExit breakpoint
+// that has not returned yet.
+type exitInvocation struct {
+	bp          *Breakpoint // AtExit breakpoint of the function
+	goid        int         // goroutine executing the invocation
+	frameOffset int64       // frame offset of the invocation, see Stackframe.FrameOffset
+	cond        ast.Expr    // condition that is true when the invocation exits
+	pcs         []uint64    // addresses of the ExitBreakpoints waiting for the invocation
+
+	// returnInfo describes how to collect the values returned by the
+	// invocation, it is nil for inlined calls.
+	returnInfo *returnBreakpointInfo
+}
+
+// setExitBreakpoints starts tracking the invocation of the function of the
+// AtExit breakpoint bp that thread is stopped at the entry of.
+//
+// Instead of stopping at the return instructions of the function, which
+// would miss the exits through runtime.deferreturn and depend on how the
+// compiler laid out the function, an ExitBreakpoint is set on the return
+// address of this invocation with a condition checking that the stack
+// frame of the caller is reached by the same goroutine, which is also
+// how StepOut works. For inlined calls, that do not have a return
+// address, an ExitBreakpoint is set on every line of the function they
+// were inlined into, excluding the inlined calls, like StepOut does for
+// inlined frames.
+// Invocations unwound by a panic never return, an ExitBreakpoint on
+// runtime.recovery stops the target when a recovered panic unwinds them.
+// Unrecovered panics stop at the unrecovered-panic breakpoint instead.
+func (t *Target) setExitBreakpoints(thread Thread, bp *Breakpoint) error {
+	g, err := GetG(thread)
+	if err != nil {
+		return err
+	}
+	if g == nil {
+		return errors.New("no goroutine running on the thread")
+	}
+	topframe, retframe, err := topframe(g, thread)
+	if err != nil {
+		return err
+	}
+	if topframe.Current.Fn == nil {
+		return &ErrNoSourceForPC{topframe.Current.PC}
+	}
+
+	inv := &exitInvocation{bp: bp, goid: g.ID, frameOffset: topframe.FrameOffset()}
+	sameGCond := sameGoroutineCondition(g)
+	var pcs []uint64
+	if topframe.Inlined {
+		fn := topframe.Current.Fn
+		pcs, err = fn.cu.lines().AllPCsBetween(fn.Entry, fn.End-1, "", -1)
+		if err != nil {
+			return err
+		}
+		pcs, err = removeInlinedCalls(pcs, retframe)
+		if err != nil {
+			return err
+		}
+		inv.cond = astutil.And(sameGCond, frameoffCondition(&topframe))
+	} else {
+		if topframe.Ret == 0 {
+			return fmt.Errorf("could not find the return address of %s", topframe.Current.Fn.Name)
+		}
+		topframe, retframe := skipAutogeneratedWrappersOut(g, thread, &topframe, &retframe)
+		inv.cond = astutil.And(sameGCond, frameoffCondition(retframe))
+		inv.returnInfo = &returnBreakpointInfo{
+			retFrameCond: inv.cond,
+			fn:           topframe.Current.Fn,
+			frameOffset:  topframe.FrameOffset(),
+			spOffset:     topframe.FrameOffset() - int64(t.BinInfo().Arch.PtrSize()),
+		}
+		pcs = []uint64{retframe.Current.PC}
+	}
+
+	var recoveryPC uint64
+	if fn := t.BinInfo().LookupFunc["runtime.recovery"]; fn != nil {
+		recoveryPC = fn.Entry
+		pcs = append(pcs, recoveryPC)
+	}
+
+	for _, pc := range pcs {
+		exitbp, err := t.SetBreakpoint(pc, ExitBreakpoint, nil)
+		if err != nil {
+			if _, exists := err.(BreakpointExistsError); !exists {
+				t.clearExitInvocation(inv)
+				return err
+			}
+		}
+		exitbp.exits = append(exitbp.exits, inv)
+		exitbp.exitOnRecovery = pc == recoveryPC
+		inv.pcs = append(inv.pcs, pc)
+	}
+	return nil
+}
+
+// exitedInvocations returns the invocations waiting for bp, an
+// ExitBreakpoint, that exited when thread hit it.
+func (bp *Breakpoint) exitedInvocations(thread Thread) []*exitInvocation {
+	g, err := GetG(thread)
+	if err != nil || g == nil {
+		return nil
+	}
+	var r []*exitInvocation
+	if bp.exitOnRecovery {
+		sp, err := recoveredFrameSP(thread)
+		if err != nil {
+			thread.BinInfo().logger.Warnf("could not find the frame resumed by the recovered panic: %v", err)
+			return nil
+		}
+		// The frames below the one resumed are unwound.
+		for _, inv := range bp.exits {
+			if inv.goid == g.ID && inv.frameOffset+int64(g.stack.hi) <= int64(sp) {
+				r = append(r, inv)
+			}
+		}
+		return r
+	}
+	for _, inv := range bp.exits {
+		if inv.goid != g.ID {
+			continue
+		}
+		if exited, err := evalBreakpointCondition(thread, inv.cond); exited && err == nil {
+			r = append(r, inv)
+		}
+	}
+	return r
+}
+
+// recoveredFrameSP returns the stack pointer of the frame resumed by the
+// panic recovered by the goroutine of thread, which must be stopped at
+// the entry of runtime.recovery.
+func recoveredFrameSP(thread Thread) (uint64, error) {
+	scope, err := GoroutineScope(thread)
+	if err != nil {
+		return 0, err
+	}
+	// Since Go 1.22 the frame is described by the _panic struct, before it
+	// was passed to runtime.recovery in g.sigcode0.
+	if _, err := scope.EvalExpression("runtime.curg._panic.retpc", loadSingleValue); err == nil {
+		v, err := scope.EvalExpression("runtime.curg._panic.sp", loadSingleValue)
+		if err != nil {
+			return 0, err
+		}
+		if v.Unreadable != nil {
+			return 0, v.Unreadable
+		}
+		if len(v.Children) == 0 {
+			return 0, errors.New("could not read _panic.sp")
+		}
+		return uint64(v.Children[0].Addr), nil
+	}
+	v, err := scope.EvalExpression("runtime.curg.sigcode0", loadSingleValue)
+	if err != nil {
+		return 0, err
+	}
+	if v.Unreadable != nil {
+		return 0, v.Unreadable
+	}
+	sp, _ := constant.Uint64Val(v.Value)
+	return sp, nil
+}
+
+// handleExitBreakpoints starts tracking the invocations of the functions
+// with AtExit breakpoints that threads were stopped at the entry of and
+// stops tracking the ones that exited, collecting their return values.
+func (t *Target) handleExitBreakpoints(threads []Thread) error {
+	for _, thread := range threads {
+		bpstate := thread.Breakpoint()
+		if bpstate.atExitCall && t.GetDirection() == Forward {
+			if err := t.setExitBreakpoints(thread, bpstate.Breakpoint); err != nil {
+				t.BinInfo().logger.Warnf("could not set the exit breakpoints of breakpoint %d: %v", bpstate.LogicalID, err)
+			}
+		}
+		for i, inv := range bpstate.exited {
+			if i == 0 {
+				collectReturnValues(thread, inv.returnInfo)
+			}
+			if err := t.clearExitInvocation(inv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clearExitInvocation stops tracking inv, clearing the ExitBreakpoints
+// that do not wait for other invocations.
+func (t *Target) clearExitInvocation(inv *exitInvocation) error {
+	bpmap := t.Breakpoints()
+	for _, pc := range inv.pcs {
+		bp := bpmap.M[pc]
+		if bp == nil {
+			continue
+		}
+		for i := range bp.exits {
+			if bp.exits[i] == inv {
+				bp.exits = append(bp.exits[:i], bp.exits[i+1:]...)
+				break
+			}
+		}
+		if len(bp.exits) > 0 {
+			continue
+		}
+		bp.Kind &^= ExitBreakpoint
+		bp.exitOnRecovery = false
+		if bp.Kind != 0 {
+			continue
+		}
+		if err := t.proc.EraseBreakpoint(bp); err != nil {
+			return err
+		}
+		for _, thread := range t.ThreadList() {
+			if thread.Breakpoint().Breakpoint == bp {
+				thread.Breakpoint().Clear()
+			}
+		}
+		delete(bpmap.M, pc)
+	}
+	inv.pcs = nil
+	return nil
+}
+
+// clearExitInvocations stops tracking the invocations of the function of
+// the AtExit breakpoint bp, or all invocations if bp is nil.
+func (t *Target) clearExitInvocations(bp *Breakpoint) error {
+	var invs []*exitInvocation
+	seen := map[*exitInvocation]bool{}
+	for _, exitbp := range t.Breakpoints().M {
+		for _, inv := range exitbp.exits {
+			if (bp == nil || inv.bp == bp) && !seen[inv] {
+				seen[inv] = true
+				invs = append(invs, inv)
+			}
+		}
+	}
+	for _, inv := range invs {
+		if err := t.clearExitInvocation(inv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package proc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/constant"
+	"reflect"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+)
+
+// Finalizer is a finalizer set with runtime.SetFinalizer, or a cleanup
+// added with runtime.AddCleanup, on an object of the target.
+type Finalizer struct {
+	// Obj is the address of the object.
+	Obj uint64
+	// Type is the type of the argument of the finalizer function, usually
+	// a pointer to the type of the object. It is empty for cleanups, whose
+	// argument is not the object.
+	Type string
+	// Func is the finalizer or cleanup function.
+	Func string
+	// Cleanup is true for the cleanups added with runtime.AddCleanup.
+	Cleanup bool
+	// Queued is true if the object is unreachable and the finalizer is
+	// queued, waiting for the finalizer goroutine to run it.
+	Queued bool
+}
+
+// FinalizerState is the state of the finalizers of the target, see
+// Finalizers.
+type FinalizerState struct {
+	// Finalizers are the finalizers queued to run, followed by the
+	// finalizers and cleanups of the objects still reachable, in the order
+	// of the spans of the heap.
+	Finalizers []Finalizer
+	// G is the goroutine running the finalizers, nil if no finalizer was
+	// ever set or if it did not start yet.
+	G *G
+	// Running is true if G is running a finalizer, false if it is waiting
+	// for finalizers to be queued.
+	Running bool
+}
+
+// specialFinalizerKind is the kind of the specials of the spans for
+// finalizers, see $GOROOT/src/runtime/mheap.go, used when the binary does
+// not describe the constants of the runtime.
+const specialFinalizerKind = 1
+
+// fingRunningFinalizer is the bit of runtime.fingStatus set while the
+// finalizer goroutine runs a finalizer, since Go 1.21.
+const fingRunningFinalizer = 2
+
+// maxFinalizers is the maximum number of finalizers returned by
+// Finalizers, it protects against loops in corrupted lists.
+const maxFinalizers = 1 << 20
+
+// Finalizers returns the finalizers of the target and the state of the
+// goroutine running them, reading the specials of the spans of the heap
+// and the queue of the finalizers from the memory of the target, without
+// calling any function of the target, therefore it also works on core
+// files. The cleanups queued to run, since Go 1.24, are not returned.
+func Finalizers(t *Target) (*FinalizerState, error) {
+	scope, err := ThreadScope(t.CurrentThread())
+	if err != nil {
+		return nil, err
+	}
+	bi := t.BinInfo()
+	mem := t.CurrentThread()
+	ptrSize := int64(bi.Arch.PtrSize())
+	r := &FinalizerState{}
+	fr := finalizerReader{bi: bi, mem: mem, types: make(map[*Function]string)}
+
+	if fing, err := scope.findGlobal("runtime", "fing"); err == nil {
+		if gaddr, err := readUintRaw(mem, fing.Addr, ptrSize); err == nil && gaddr != 0 {
+			if goid, err := fing.structMember("goid"); err == nil {
+				if id, err := goid.asInt(); err == nil {
+					r.G, _ = FindGoroutine(t, int(id))
+				} else if id, err := goid.asUint(); err == nil {
+					r.G, _ = FindGoroutine(t, int(id))
+				}
+			}
+		}
+	}
+	// fingRunning was replaced by a bit of fingStatus in Go 1.21.
+	if status, err := scope.findGlobal("runtime", "fingStatus"); err == nil {
+		if status.Kind == reflect.Struct {
+			status, err = status.structMember("value")
+		}
+		if err == nil {
+			n, _ := status.asUint()
+			r.Running = n&fingRunningFinalizer != 0
+		}
+	} else if running, err := scope.findGlobal("runtime", "fingRunning"); err == nil {
+		running.loadValue(loadSingleValue)
+		r.Running = running.Value != nil && constant.BoolVal(running.Value)
+	}
+
+	// finq is a list of blocks of finalizers.
+	finq, err := scope.findGlobal("runtime", "finq")
+	if err != nil {
+		return nil, err
+	}
+	for b := finq.maybeDereference(); b.Addr != 0 && b.Unreadable == nil; {
+		cnt, err := b.structMember("cnt")
+		if err != nil {
+			return nil, err
+		}
+		n, err := cnt.asUint()
+		if err != nil {
+			return nil, err
+		}
+		fin, err := b.structMember("fin")
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < int(n) && i < int(fin.Len); i++ {
+			f, err := fin.sliceAccess(i)
+			if err != nil {
+				return nil, err
+			}
+			fn, err := f.structMember("fn")
+			if err != nil {
+				return nil, err
+			}
+			arg, err := f.structMember("arg")
+			if err != nil {
+				return nil, err
+			}
+			obj, err := readUintRaw(mem, arg.Addr, ptrSize)
+			if err != nil {
+				return nil, err
+			}
+			if r.Finalizers, err = fr.append(r.Finalizers, fn.Addr, obj, false, true); err != nil {
+				return nil, err
+			}
+		}
+		next, err := b.structMember("next")
+		if err != nil {
+			return nil, err
+		}
+		b = next.maybeDereference()
+	}
+
+	if r.Finalizers, err = fr.appendSpecials(scope, r.Finalizers); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// finalizerReader reads the finalizers of the target.
+type finalizerReader struct {
+	bi  *BinaryInfo
+	mem MemoryReadWriter
+	// types caches the type of the argument of the finalizer functions.
+	types map[*Function]string
+}
+
+// appendSpecials appends to r the finalizers and cleanups in the specials
+// of the spans of the heap.
+func (fr *finalizerReader) appendSpecials(scope *EvalScope, r []Finalizer) ([]Finalizer, error) {
+	bi, mem := fr.bi, fr.mem
+	ptrSize := int64(bi.Arch.PtrSize())
+	finalizerKind, ok := bi.findConstant("runtime._KindSpecialFinalizer")
+	if !ok {
+		finalizerKind = specialFinalizerKind
+	}
+	// cleanups were added in Go 1.24, which describes the constants.
+	cleanupKind, hasCleanups := bi.findConstant("runtime._KindSpecialCleanup")
+
+	var types [4]godwarf.Type
+	for i, name := range []string{"runtime.mspan", "runtime.special", "runtime.specialfinalizer", "runtime.specialCleanup"} {
+		if i == 3 && !hasCleanups {
+			break
+		}
+		typ, err := bi.findType(name)
+		if err != nil {
+			return nil, err
+		}
+		types[i] = typ
+	}
+	readMember := func(v *Variable, name string) (uint64, error) {
+		field, err := v.structMember(name)
+		if err != nil {
+			return 0, err
+		}
+		return readUintRaw(mem, field.Addr, field.RealType.Size())
+	}
+
+	mheap, err := scope.findGlobal("runtime", "mheap_")
+	if err != nil {
+		return nil, err
+	}
+	allspans, err := mheap.structMember("allspans")
+	if err != nil {
+		return nil, err
+	}
+	allspans.loadValue(loadSingleValue)
+	if allspans.Unreadable != nil {
+		return nil, allspans.Unreadable
+	}
+	spans := make([]byte, allspans.Len*ptrSize)
+	if _, err := mem.ReadMemory(spans, allspans.Base); err != nil {
+		return nil, err
+	}
+	for i := int64(0); i < allspans.Len; i++ {
+		// all the architectures supported are little endian.
+		var spanAddr uint64
+		if ptrSize == 4 {
+			spanAddr = uint64(binary.LittleEndian.Uint32(spans[i*ptrSize:]))
+		} else {
+			spanAddr = binary.LittleEndian.Uint64(spans[i*ptrSize:])
+		}
+		if spanAddr == 0 {
+			continue
+		}
+		span := newVariable("", uintptr(spanAddr), types[0], bi, mem)
+		addr, err := readMember(span, "specials")
+		if err != nil {
+			return nil, err
+		}
+		if addr == 0 {
+			continue
+		}
+		base, err := readMember(span, "startAddr")
+		if err != nil {
+			return nil, err
+		}
+		for addr != 0 {
+			if len(r) >= maxFinalizers {
+				return nil, errors.New("too many finalizers")
+			}
+			special := newVariable("", uintptr(addr), types[1], bi, mem)
+			kind, err := readMember(special, "kind")
+			if err != nil {
+				return nil, err
+			}
+			offset, err := readMember(special, "offset")
+			if err != nil {
+				return nil, err
+			}
+			var fn *Variable
+			switch {
+			case int64(kind) == finalizerKind:
+				fn, err = newVariable("", uintptr(addr), types[2], bi, mem).structMember("fn")
+			case hasCleanups && int64(kind) == cleanupKind:
+				// the function is in a cleanupFn since Go 1.25.
+				sc := newVariable("", uintptr(addr), types[3], bi, mem)
+				if fn, err = sc.structMember("cleanup"); err == nil {
+					fn, err = fn.structMember("fn")
+				} else {
+					fn, err = sc.structMember("fn")
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			if fn != nil {
+				if r, err = fr.append(r, fn.Addr, base+offset, int64(kind) != finalizerKind, false); err != nil {
+					return nil, err
+				}
+			}
+			if addr, err = readMember(special, "next"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// append appends to r the finalizer of obj, whose function is the funcval
+// pointed to by the pointer at fnAddr.
+func (fr *finalizerReader) append(r []Finalizer, fnAddr uintptr, obj uint64, cleanup, queued bool) ([]Finalizer, error) {
+	if len(r) >= maxFinalizers {
+		return nil, errors.New("too many finalizers")
+	}
+	ptrSize := int64(fr.bi.Arch.PtrSize())
+	f := Finalizer{Obj: obj, Cleanup: cleanup, Queued: queued}
+	funcval, err := readUintRaw(fr.mem, fnAddr, ptrSize)
+	if err != nil {
+		return nil, err
+	}
+	if funcval != 0 {
+		pc, err := readUintRaw(fr.mem, uintptr(funcval), ptrSize)
+		if err != nil {
+			return nil, err
+		}
+		if fn := fr.bi.PCToFunc(pc); fn != nil {
+			f.Func = fn.Name
+			if !cleanup {
+				f.Type = fr.argType(fn)
+			}
+		} else {
+			f.Func = fmt.Sprintf("%#x", pc)
+		}
+	}
+	return append(r, f), nil
+}
+
+// argType returns the type of the first argument of the finalizer fn.
+func (fr *finalizerReader) argType(fn *Function) string {
+	if typ, ok := fr.types[fn]; ok {
+		return typ
+	}
+	typ := ""
+	if _, args, err := funcCallArgs(fn, fr.bi, false); err == nil && len(args) > 0 {
+		typ = args[0].typ.String()
+	}
+	fr.types[fn] = typ
+	return typ
+}
@@ -0,0 +1,342 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+)
+
+// Flavor teaches Delve about the threads of interest of targets that do
+// not use the goroutines of the Go runtime, for example the tasks of an
+// RTOS or of a unikernel debugged through the gdb stub of qemu, whose
+// threads are the CPUs of the virtual machine. When a flavor is set on a
+// target its threads of interest replace the goroutines: they are listed
+// by the goroutines command, their stacks are unwound from the registers
+// saved when they are not running and the current goroutine is the one
+// running on the current thread.
+//
+// Flavors are registered with RegisterFlavor, for example by the init
+// function of a Go plugin, and selected by name.
+type Flavor interface {
+	// Threads returns the threads of interest of the target, reading them
+	// from memory through scope, a global scope of the target. The threads
+	// of interest that are running on one of threads, which starts with the
+	// current thread of the target, must have ThreadID set to its ID.
+	Threads(scope *EvalScope, threads []Thread) ([]FlavorThread, error)
+}
+
+// FlavorThread is a thread of interest of a flavor.
+type FlavorThread struct {
+	// ID is the ID of the thread of interest, used as goroutine ID.
+	ID int
+	// Name is the name of the thread of interest.
+	Name string
+	// ThreadID is the ID of the thread running the thread of interest, or
+	// 0 if it is not running.
+	ThreadID int
+	// PC, SP, BP and LR are the registers saved when the thread of interest
+	// stopped running, used to unwind its stack if it is not running.
+	PC, SP, BP, LR uint64
+	// Addr is the address of the structure describing the thread of
+	// interest, if any.
+	Addr uint64
+}
+
+const maxFlavorThreads = 1 << 16
+
+var (
+	flavorsMu sync.Mutex
+	flavors   = map[string]Flavor{}
+)
+
+// RegisterFlavor registers flavor with the specified name, replacing the
+// flavor previously registered with the same name.
+func RegisterFlavor(name string, flavor Flavor) {
+	flavorsMu.Lock()
+	flavors[name] = flavor
+	flavorsMu.Unlock()
+}
+
+// FindFlavor returns the flavor registered with the specified name.
+func FindFlavor(name string) (Flavor, error) {
+	flavorsMu.Lock()
+	defer flavorsMu.Unlock()
+	if flavor, ok := flavors[name]; ok {
+		return flavor, nil
+	}
+	names := make([]string, 0, len(flavors))
+	for name := range flavors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown flavor %q, registered flavors: %v", name, names)
+}
+
+// SetFlavor sets the flavor of the target, nil restores the goroutines of
+// the Go runtime.
+func (t *Target) SetFlavor(flavor Flavor) {
+	t.BinInfo().flavor = flavor
+	t.ClearAllGCache()
+	for _, th := range t.ThreadList() {
+		th.Common().g = nil
+	}
+	t.selectedGoroutine, _ = GetG(t.CurrentThread())
+}
+
+func flavorScope(bi *BinaryInfo, mem MemoryReadWriter) *EvalScope {
+	return globalScope(bi, bi.Images[0], mem)
+}
+
+// flavorG returns the goroutine for the thread of interest th.
+func flavorG(bi *BinaryInfo, mem MemoryReadWriter, th *FlavorThread, thread Thread) *G {
+	typ := &godwarf.StructType{CommonType: godwarf.CommonType{Name: "thread of interest"}, Kind: "struct"}
+	g := &G{
+		ID:       th.ID,
+		Name:     th.Name,
+		PC:       th.PC,
+		SP:       th.SP,
+		BP:       th.BP,
+		LR:       th.LR,
+		Status:   Gwaiting,
+		variable: newVariable("", uintptr(th.Addr), typ, bi, mem),
+	}
+	if thread != nil {
+		g.Status = Grunning
+		g.Thread = thread
+		if loc, err := thread.Location(); err == nil {
+			g.CurrentLoc = *loc
+		}
+		return g
+	}
+	f, l, fn := bi.PCToLine(g.PC)
+	g.CurrentLoc = Location{PC: g.PC, File: f, Line: l, Fn: fn}
+	return g
+}
+
+// flavorGetG returns the thread of interest running on thread, see GetG.
+func flavorGetG(thread Thread) (*G, error) {
+	bi := thread.BinInfo()
+	ths, err := bi.flavor.Threads(flavorScope(bi, thread), []Thread{thread})
+	if err != nil {
+		return nil, err
+	}
+	for i := range ths {
+		if ths[i].ThreadID == thread.ThreadID() {
+			g := flavorG(bi, thread, &ths[i], thread)
+			thread.Common().g = g
+			return g, nil
+		}
+	}
+	return nil, nil
+}
+
+// flavorGoroutines returns the threads of interest of dbp as goroutines,
+// see GoroutinesInfo.
+func flavorGoroutines(dbp *Target, start, count int) ([]*G, int, error) {
+	bi := dbp.BinInfo()
+	mem := dbp.CurrentThread()
+	// The current thread goes first, see ListFlavor.Current.
+	threads := []Thread{mem}
+	for _, th := range dbp.ThreadList() {
+		if th.ThreadID() != mem.ThreadID() {
+			threads = append(threads, th)
+		}
+	}
+	ths, err := bi.flavor.Threads(flavorScope(bi, mem), threads)
+	if err != nil {
+		return nil, -1, err
+	}
+	byID := make(map[int]Thread, len(threads))
+	for _, th := range threads {
+		byID[th.ThreadID()] = th
+	}
+
+	allg := make([]*G, 0, len(ths))
+	for i := range ths {
+		var thread Thread
+		if ths[i].ThreadID != 0 {
+			thread = byID[ths[i].ThreadID]
+		}
+		g := flavorG(bi, mem, &ths[i], thread)
+		dbp.gcache.addGoroutine(g)
+		allg = append(allg, g)
+	}
+
+	if start >= len(allg) {
+		return nil, -1, nil
+	}
+	allg = allg[start:]
+	if count != 0 && len(allg) > count {
+		return allg[:count], start + count, nil
+	}
+	return allg, -1, nil
+}
+
+// ListFlavor is a flavor for targets that keep their threads of interest
+// in a linked list, described by expressions, evaluated in the global
+// scope of the target, and by the names of the fields of the elements of
+// the list, which must be structures.
+type ListFlavor struct {
+	// Head is an expression evaluating to a pointer to the first element of
+	// the list.
+	Head string
+	// Current is an expression evaluating to a pointer to the element
+	// running on the current thread of the target, the first of the threads
+	// passed to Threads. Optional, targets with more than one CPU are not
+	// supported.
+	Current string
+
+	// Next is the field of the elements pointing to the next element.
+	Next string
+	// ID and Name are the fields containing the ID and the name of the
+	// elements. Name can be a string or an array of bytes terminated by a
+	// NUL character and is optional. Without ID the index of the element in
+	// the list is used.
+	ID, Name string
+	// PC, SP and BP are the fields containing the registers saved by the
+	// elements that are not running. PC and BP are optional.
+	PC, SP, BP string
+	// PCOffset is the offset, from the saved stack pointer, of the saved
+	// program counter, used when PC is not specified.
+	PCOffset int64
+}
+
+// Threads implements Flavor.
+func (f *ListFlavor) Threads(scope *EvalScope, threads []Thread) ([]FlavorThread, error) {
+	if f.Head == "" || f.Next == "" || f.SP == "" {
+		return nil, errors.New("the head, next and sp of a list flavor are required")
+	}
+	cfg := LoadConfig{FollowPointers: false, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1}
+
+	var current uint64
+	if f.Current != "" && len(threads) > 0 {
+		v, err := scope.EvalExpression(f.Current, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("could not evaluate current element %s: %v", f.Current, err)
+		}
+		if current, err = listFlavorPointer(v); err != nil {
+			return nil, fmt.Errorf("could not evaluate current element %s: %v", f.Current, err)
+		}
+	}
+
+	head, err := scope.EvalExpression(f.Head, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not evaluate head %s: %v", f.Head, err)
+	}
+	addr, err := listFlavorPointer(head)
+	if err != nil {
+		return nil, fmt.Errorf("could not evaluate head %s: %v", f.Head, err)
+	}
+	ptrtyp, _ := head.RealType.(*godwarf.PtrType)
+
+	var r []FlavorThread
+	seen := make(map[uint64]bool)
+	for addr != 0 && !seen[addr] && len(r) < maxFlavorThreads {
+		seen[addr] = true
+		elem := newVariable("", uintptr(addr), ptrtyp.Type, scope.BinInfo, scope.Mem)
+		elem.loadValue(cfg)
+		if elem.Unreadable != nil {
+			return r, fmt.Errorf("could not read element at %#x: %v", addr, elem.Unreadable)
+		}
+		if elem.Kind != reflect.Struct {
+			return nil, fmt.Errorf("the elements of the list are not structs (%s)", elem.TypeString())
+		}
+		th := FlavorThread{ID: len(r) + 1, Addr: addr}
+		if f.ID != "" {
+			id, err := listFlavorUint(elem, f.ID)
+			if err != nil {
+				return r, err
+			}
+			th.ID = int(id)
+		}
+		if f.Name != "" {
+			th.Name = listFlavorString(elem.fieldVariable(f.Name))
+		}
+		if th.SP, err = listFlavorUint(elem, f.SP); err != nil {
+			return r, err
+		}
+		if f.PC != "" {
+			if th.PC, err = listFlavorUint(elem, f.PC); err != nil {
+				return r, err
+			}
+		} else if th.SP != 0 {
+			th.PC, _ = readUintRaw(scope.Mem, uintptr(int64(th.SP)+f.PCOffset), int64(scope.BinInfo.Arch.PtrSize()))
+		}
+		if f.BP != "" {
+			if th.BP, err = listFlavorUint(elem, f.BP); err != nil {
+				return r, err
+			}
+		}
+		if addr == current {
+			th.ThreadID = threads[0].ThreadID()
+		}
+		r = append(r, th)
+
+		next := elem.fieldVariable(f.Next)
+		if next == nil {
+			return r, fmt.Errorf("no field %s in %s", f.Next, elem.TypeString())
+		}
+		if addr, err = listFlavorPointer(next); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+func listFlavorPointer(v *Variable) (uint64, error) {
+	if v.Unreadable != nil {
+		return 0, v.Unreadable
+	}
+	if v.Kind != reflect.Ptr {
+		return 0, fmt.Errorf("%s is not a pointer", v.TypeString())
+	}
+	return uint64(v.Children[0].Addr), nil
+}
+
+func listFlavorUint(elem *Variable, name string) (uint64, error) {
+	v := elem.fieldVariable(name)
+	if v == nil {
+		return 0, fmt.Errorf("no field %s in %s", name, elem.TypeString())
+	}
+	if v.Unreadable != nil {
+		return 0, v.Unreadable
+	}
+	switch v.Kind {
+	case reflect.Ptr, reflect.UnsafePointer:
+		return uint64(v.Children[0].Addr), nil
+	}
+	if v.Value == nil || v.Value.Kind() != constant.Int {
+		return 0, fmt.Errorf("field %s of %s is not an integer", name, elem.TypeString())
+	}
+	n, _ := constant.Uint64Val(v.Value)
+	return n, nil
+}
+
+func listFlavorString(v *Variable) string {
+	if v == nil || v.Unreadable != nil {
+		return ""
+	}
+	switch v.Kind {
+	case reflect.String:
+		return constant.StringVal(v.Value)
+	case reflect.Array:
+		buf := make([]byte, 0, len(v.Children))
+		for _, ch := range v.Children {
+			if ch.Value == nil || ch.Value.Kind() != constant.Int {
+				break
+			}
+			b, _ := constant.Uint64Val(ch.Value)
+			if b == 0 {
+				break
+			}
+			buf = append(buf, byte(b))
+		}
+		return string(buf)
+	}
+	return ""
+}
@@ -149,9 +149,21 @@ func (callCtx *callContext) doReturn(ret *Variable, err error) {
 // EvalExpression, EvalExpressionWithCalls is not a method of EvalScope.
 func EvalExpressionWithCalls(t *Target, g *G, expr string, retLoadCfg LoadConfig, checkEscape bool) error {
 	bi := t.BinInfo()
+	if bi.tinyGo {
+		return errFuncCallUnsupportedTinyGo
+	}
+	if bi.gccgo {
+		return errFuncCallUnsupportedGccgo
+	}
+	if bi.Arch.Name != "amd64" {
+		return &ErrUnsupportedOnArch{Operation: "function calls", Arch: bi.Arch.Name}
+	}
 	if !t.SupportsFunctionCalls() {
 		return errFuncCallUnsupportedBackend
 	}
+	if err := bi.checkFeature(FeatureFunctionCalls); err != nil {
+		return err
+	}
 
 	// check that the target goroutine is running
 	if g == nil {
@@ -202,11 +214,31 @@ func EvalExpressionWithCalls(t *Target, g *G, expr string, retLoadCfg LoadConfig
 	return finishEvalExpressionWithCalls(t, g, contReq, ok)
 }
 
+// CallFunction calls the functions in expr on goroutine g, like
+// EvalExpressionWithCalls, on behalf of the debugger rather than of the
+// user: the target is resumed until the call returns and the values
+// returned by the last call are returned, loaded with retLoadCfg. Returns
+// an error if the call does not return, for example because it stopped at
+// a breakpoint, the call is then left in progress, or if it panics.
+func CallFunction(t *Target, g *G, expr string, retLoadCfg LoadConfig) ([]*Variable, error) {
+	if err := EvalExpressionWithCalls(t, g, expr, retLoadCfg, true); err != nil {
+		return nil, err
+	}
+	if t.fncallForG[g.ID] != nil {
+		return nil, fmt.Errorf("%s did not return, the target stopped before", expr)
+	}
+	r := g.Thread.Common().ReturnValues(retLoadCfg)
+	if len(r) == 1 && r[0].Name == "~panic" {
+		return nil, fmt.Errorf("%s panicked", expr)
+	}
+	return r, nil
+}
+
 func finishEvalExpressionWithCalls(t *Target, g *G, contReq continueRequest, ok bool) error {
 	fncallLog("stashing return values for %d in thread=%d", g.ID, g.Thread.ThreadID())
 	var err error
 	if !ok {
-		err = errors.New("internal error EvalExpressionWithCalls didn't return anything")
+		err = internalErrorf("EvalExpressionWithCalls didn't return anything")
 	} else if contReq.err != nil {
 		if fpe, ispanic := contReq.err.(fncallPanicErr); ispanic {
 			g.Thread.Common().returnValues = []*Variable{fpe.panicVar}
@@ -269,9 +301,18 @@ func evalFunctionCall(scope *EvalScope, node *ast.CallExpr) (*Variable, error) {
 
 	p := scope.callCtx.p
 	bi := scope.BinInfo
+	if bi.tinyGo {
+		return nil, errFuncCallUnsupportedTinyGo
+	}
+	if bi.gccgo {
+		return nil, errFuncCallUnsupportedGccgo
+	}
 	if !p.SupportsFunctionCalls() {
 		return nil, errFuncCallUnsupportedBackend
 	}
+	if err := bi.checkFeature(FeatureFunctionCalls); err != nil {
+		return nil, err
+	}
 
 	dbgcallfn := bi.LookupFunc[debugCallFunctionName]
 	if dbgcallfn == nil {
@@ -454,7 +495,7 @@ func funcCallEvalFuncExpr(scope *EvalScope, fncall *functionCallState, allowCall
 	if fnvar.Kind != reflect.Func {
 		return fmt.Errorf("expression %q is not a function", exprToString(fncall.expr.Fun))
 	}
-	fnvar.loadValue(LoadConfig{false, 0, 0, 0, 0, 0})
+	fnvar.loadValue(LoadConfig{false, 0, 0, 0, 0, 0, nil})
 	if fnvar.Unreadable != nil {
 		return fnvar.Unreadable
 	}
@@ -930,7 +971,7 @@ func allocString(scope *EvalScope, v *Variable) error {
 		return fmt.Errorf("unexpected return type for mallocgc call: %v", mallocv.DwarfType.String())
 	}
 	if len(mallocv.Children) != 1 {
-		return errors.New("internal error, could not interpret return value of mallocgc call")
+		return internalErrorf("could not interpret return value of mallocgc call")
 	}
 	v.Base = uintptr(mallocv.Children[0].Addr)
 	_, err = scope.Mem.WriteMemory(v.Base, []byte(constant.StringVal(v.Value)))
@@ -0,0 +1,134 @@
+package proc
+
+import (
+	"debug/dwarf"
+	"errors"
+	"go/constant"
+	"strconv"
+	"strings"
+)
+
+// Programs built with gccgo use libgo as their runtime. Its goroutine
+// structure (runtime.g) does not contain the registers of parked
+// goroutines, which are saved in a ucontext, and the pointer to the
+// current goroutine is a thread local variable of C code. Delve can list
+// the goroutines of these programs but it can not associate them with
+// threads or unwind the stacks of the goroutines that are not running.
+
+const gccgoProducer = "GNU Go"
+
+var (
+	errFuncCallUnsupportedGccgo = errors.New("function calls are not supported for programs built with gccgo")
+	errGccgoParkedStack         = errors.New("the stack of a goroutine that is not running is not available for programs built with gccgo")
+)
+
+// isGccgoProducer returns true if producer is the DW_AT_producer of a
+// compile unit created by gccgo.
+func isGccgoProducer(producer string) bool {
+	return strings.HasPrefix(producer, gccgoProducer)
+}
+
+// Gccgo returns true if the executable was built with gccgo.
+func (bi *BinaryInfo) Gccgo() bool {
+	return bi.gccgo
+}
+
+// gccgoOptimized returns true if the gccgo producer string producer, which
+// lists the options of the compiler, enables optimizations.
+func gccgoOptimized(producer string) bool {
+	optimized := false
+	for _, opt := range strings.Fields(producer) {
+		if strings.HasPrefix(opt, "-O") {
+			optimized = opt != "-O0"
+		}
+	}
+	return optimized
+}
+
+// gccgoEntryName returns the name of the function or variable described by
+// entry, whose DW_AT_name is name: gccgo records the name of the symbol,
+// qualified with its package path, as the linkage name.
+func gccgoEntryName(entry *dwarf.Entry, name string) string {
+	if linkageName, ok := entry.Val(dwarfAttrLinkageName).(string); ok {
+		return gccgoDemangle(linkageName)
+	}
+	if linkageName, ok := entry.Val(dwarfAttrMIPSLinkageName).(string); ok {
+		return gccgoDemangle(linkageName)
+	}
+	return name
+}
+
+// gccgoDemangle converts a symbol name mangled by gccgo into the name of
+// the symbol used by gc:
+//
+//	github.com..z2fgo-delve..z2fdelve.Func	github.com/go-delve/delve.Func
+//	main.T.Method				main.T.Method
+//	main.main..func1			main.main.func1
+//
+// Characters that are not valid in assembler symbols are encoded as ".."
+// followed by 'z' and two hex digits, by 'u' and four hex digits or by 'U'
+// and eight hex digits. The other occurrences of ".." separate the names
+// generated by the compiler from the name of the function they belong to.
+func gccgoDemangle(name string) string {
+	if !strings.Contains(name, "..") {
+		return name
+	}
+	var buf strings.Builder
+	for i := 0; i < len(name); {
+		if !strings.HasPrefix(name[i:], "..") {
+			buf.WriteByte(name[i])
+			i++
+			continue
+		}
+		n := 0
+		if i+2 < len(name) {
+			switch name[i+2] {
+			case 'z':
+				n = 2
+			case 'u':
+				n = 4
+			case 'U':
+				n = 8
+			}
+		}
+		if n > 0 && i+3+n <= len(name) {
+			if r, err := strconv.ParseUint(name[i+3:i+3+n], 16, 32); err == nil {
+				buf.WriteRune(rune(r))
+				i += 3 + n
+				continue
+			}
+		}
+		buf.WriteByte('.')
+		i += 2
+	}
+	return buf.String()
+}
+
+// parseGccgoG parses v, a libgo runtime.g structure. The location of the
+// goroutine is not available.
+func (v *Variable) parseGccgoG() (*G, error) {
+	field := func(name string) (int64, bool) {
+		fv := v.loadFieldNamed(name)
+		if fv == nil || fv.Value == nil {
+			return 0, false
+		}
+		n, _ := constant.Int64Val(fv.Value)
+		return n, true
+	}
+	id, ok := field("goid")
+	if !ok {
+		return nil, ErrUnreadableG
+	}
+	status, _ := field("atomicstatus")
+	gopc, _ := field("gopc")
+	startpc, _ := field("startpc")
+
+	v.Name = "runtime.curg"
+	return &G{
+		ID:       int(id),
+		GoPC:     uint64(gopc),
+		StartPC:  uint64(startpc),
+		Status:   uint64(status),
+		variable: v,
+	}, nil
+}
@@ -75,11 +75,13 @@ import (
 	"strings"
 	"time"
 
+	"golang.org/x/arch/arm64/arm64asm"
 	"golang.org/x/arch/x86/x86asm"
 
 	"github.com/go-delve/delve/pkg/logflags"
 	"github.com/go-delve/delve/pkg/proc"
 	"github.com/go-delve/delve/pkg/proc/linutil"
+	"github.com/go-delve/delve/pkg/proc/macutil"
 	isatty "github.com/mattn/go-isatty"
 )
 
@@ -128,7 +130,8 @@ type gdbProcess struct {
 	process  *os.Process
 	waitChan chan *os.ProcessState
 
-	onDetach func() // called after a successful detach
+	onDetach  func()       // called after a successful detach
+	onConnect func() error // called after the handshake, before the inferior is initialized
 }
 
 var _ proc.ProcessInternal = &gdbProcess{}
@@ -159,6 +162,7 @@ func (err *ErrBackendUnavailable) Error() string {
 type gdbRegisters struct {
 	regs     map[string]gdbRegister
 	regsInfo []gdbRegisterInfo
+	arch     *gdbArch
 	tls      uint64
 	gaddr    uint64
 	hasgaddr bool
@@ -182,6 +186,7 @@ func newProcess(process *os.Process) *gdbProcess {
 			inbuf:               make([]byte, 0, initialInputBufferSize),
 			direction:           proc.Forward,
 			log:                 logger,
+			arch:                gdbArchFor(runtime.GOARCH),
 		},
 		threads:        make(map[int]*gdbThread),
 		bi:             proc.NewBinaryInfo(runtime.GOOS, runtime.GOARCH),
@@ -202,6 +207,14 @@ func newProcess(process *os.Process) *gdbProcess {
 	return p
 }
 
+// setTargetArch sets the operating system and the architecture of the
+// inferior, when they are not the ones of the host. Must be called before
+// connecting.
+func (p *gdbProcess) setTargetArch(goos, goarch string) {
+	p.bi = proc.NewBinaryInfo(goos, goarch)
+	p.conn.arch = gdbArchFor(goarch)
+}
+
 // Listen waits for a connection from the stub.
 func (p *gdbProcess) Listen(listener net.Listener, path string, pid int, debugInfoDirs []string, stopReason proc.StopReason) (*proc.Target, error) {
 	acceptChan := make(chan net.Conn)
@@ -254,6 +267,16 @@ func (p *gdbProcess) Connect(conn net.Conn, path string, pid int, debugInfoDirs
 		conn.Close()
 		return nil, err
 	}
+	if p.onConnect != nil {
+		if err := p.onConnect(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if p.conn.arch.name != p.bi.Arch.Name {
+		// the architecture of the inferior was detected during the handshake
+		p.bi = proc.NewBinaryInfo(p.bi.GOOS, p.conn.arch.name)
+	}
 
 	if verbuf, err := p.conn.exec([]byte("$qGDBServerVersion"), "init"); err == nil {
 		for _, v := range strings.Split(string(verbuf), ";") {
@@ -280,6 +303,10 @@ func (p *gdbProcess) Connect(conn net.Conn, path string, pid int, debugInfoDirs
 	// store the MOV instruction.
 	// If the stub doesn't support memory allocation reloadRegisters will
 	// overwrite some existing memory to store the MOV.
+	// Architectures that keep G in a register do not need it.
+	if p.conn.arch.g != "" {
+		return tgt, nil
+	}
 	if addr, err := p.conn.allocMemory(256); err == nil {
 		if _, err := p.conn.writeMemory(uintptr(addr), p.loadGInstr()); err == nil {
 			p.loadGInstrAddr = addr
@@ -315,6 +342,12 @@ func getDebugServerAbsolutePath() string {
 	return ""
 }
 
+// DebugServerPath returns the path of the debugserver executable used by
+// the lldb backend, or the empty string if it can not be found.
+func DebugServerPath() string {
+	return getDebugServerAbsolutePath()
+}
+
 // commandLogger is a wrapper around the exec.Command() function to log the arguments prior to
 // starting the process
 func commandLogger(binary string, arguments ...string) *exec.Cmd {
@@ -322,6 +355,17 @@ func commandLogger(binary string, arguments ...string) *exec.Cmd {
 	return exec.Command(binary, arguments...)
 }
 
+// debugserverCommand returns the command running debugserver with the
+// specified arguments. If Delve is translated by Rosetta 2 debugserver is
+// run natively, since it can not debug processes when it is translated
+// but can debug translated processes.
+func debugserverCommand(debugserverExecutable string, arguments ...string) *exec.Cmd {
+	if macutil.Translated() {
+		return commandLogger("/usr/bin/arch", append([]string{"-arm64", debugserverExecutable}, arguments...)...)
+	}
+	return commandLogger(debugserverExecutable, arguments...)
+}
+
 // ErrUnsupportedOS is returned when trying to use the lldb backend on Windows.
 var ErrUnsupportedOS = errors.New("lldb backend not supported on Windows")
 
@@ -347,6 +391,12 @@ func LLDBLaunch(cmd []string, wd string, foreground bool, debugInfoDirs []string
 		return nil, ErrUnsupportedOS
 	}
 
+	if runtime.GOOS == "darwin" {
+		if err := macutil.CheckExecutableArch(cmd[0]); err != nil {
+			return nil, err
+		}
+	}
+
 	if foreground {
 		// Disable foregrounding if we can't open /dev/tty or debugserver will
 		// crash. See issue #1215.
@@ -405,7 +455,7 @@ func LLDBLaunch(cmd []string, wd string, foreground bool, debugInfoDirs []string
 
 		isDebugserver = true
 
-		process = commandLogger(debugserverExecutable, args...)
+		process = debugserverCommand(debugserverExecutable, args...)
 	} else {
 		if _, err = exec.LookPath("lldb-server"); err != nil {
 			return nil, &ErrBackendUnavailable{}
@@ -475,7 +525,7 @@ func LLDBAttach(pid int, path string, debugInfoDirs []string) (*proc.Target, err
 		if err != nil {
 			return nil, err
 		}
-		process = commandLogger(debugserverExecutable, "-R", fmt.Sprintf("127.0.0.1:%d", listener.Addr().(*net.TCPAddr).Port), "--attach="+strconv.Itoa(pid))
+		process = debugserverCommand(debugserverExecutable, "-R", fmt.Sprintf("127.0.0.1:%d", listener.Addr().(*net.TCPAddr).Port), "--attach="+strconv.Itoa(pid))
 	} else {
 		if _, err = exec.LookPath("lldb-server"); err != nil {
 			return nil, &ErrBackendUnavailable{}
@@ -555,6 +605,12 @@ func (p *gdbProcess) initialize(path string, debugInfoDirs []string, stopReason
 		}
 	}
 
+	// The stub could be running the target on a different operating system
+	// than the host, for example a windows executable running under WINE.
+	if goos, err := proc.ExecutableOS(path); err == nil && goos != p.bi.GOOS {
+		p.bi = proc.NewBinaryInfo(goos, p.bi.Arch.Name)
+	}
+
 	err = p.updateThreadList(&threadUpdater{p: p})
 	if err != nil {
 		p.conn.conn.Close()
@@ -1279,10 +1335,10 @@ func (t *gdbThread) Location() (*proc.Location, error) {
 	if err != nil {
 		return nil, err
 	}
-	if pcreg, ok := regs.(*gdbRegisters).regs[regnamePC]; !ok {
-		t.p.conn.log.Errorf("thread %d could not find RIP register", t.ID)
+	if pcreg, ok := regs.(*gdbRegisters).regs[t.p.conn.arch.pc]; !ok {
+		t.p.conn.log.Errorf("thread %d could not find %s register", t.ID, strings.ToUpper(t.p.conn.arch.pc))
 	} else if len(pcreg.value) < t.p.bi.Arch.PtrSize() {
-		t.p.conn.log.Errorf("thread %d bad length for RIP register: %d", t.ID, len(pcreg.value))
+		t.p.conn.log.Errorf("thread %d bad length for %s register: %d", t.ID, strings.ToUpper(t.p.conn.arch.pc), len(pcreg.value))
 	}
 	pc := regs.PC()
 	f, l, fn := t.p.bi.PCToLine(pc)
@@ -1388,9 +1444,10 @@ func (p *gdbProcess) loadGInstr() []byte {
 	return buf.Bytes()
 }
 
-func (regs *gdbRegisters) init(regsInfo []gdbRegisterInfo) {
+func (regs *gdbRegisters) init(regsInfo []gdbRegisterInfo, arch *gdbArch) {
 	regs.regs = make(map[string]gdbRegister)
 	regs.regsInfo = regsInfo
+	regs.arch = arch
 
 	regsz := 0
 	for _, reginfo := range regsInfo {
@@ -1402,6 +1459,15 @@ func (regs *gdbRegisters) init(regsInfo []gdbRegisterInfo) {
 	for _, reginfo := range regsInfo {
 		regs.regs[reginfo.Name] = gdbRegister{regnum: reginfo.Regnum, value: regs.buf[reginfo.Offset : reginfo.Offset+reginfo.Bitsize/8]}
 	}
+	for name, alias := range arch.aliases {
+		if reg, ok := regs.regs[name]; ok {
+			if _, ok := regs.regs[alias]; !ok {
+				regs.regs[alias] = reg
+			}
+		} else if reg, ok := regs.regs[alias]; ok {
+			regs.regs[name] = reg
+		}
+	}
 }
 
 // reloadRegisters loads the current value of the thread's registers.
@@ -1410,7 +1476,7 @@ func (regs *gdbRegisters) init(regsInfo []gdbRegisterInfo) {
 // the stub can allocate memory, or reloadGAtPC, if the stub can't.
 func (t *gdbThread) reloadRegisters() error {
 	if t.regs.regs == nil {
-		t.regs.init(t.p.conn.regsInfo)
+		t.regs.init(t.p.conn.regsInfo, t.p.conn.arch)
 	}
 
 	if t.p.gcmdok {
@@ -1430,6 +1496,16 @@ func (t *gdbThread) reloadRegisters() error {
 		}
 	}
 
+	if t.p.conn.arch.g != "" {
+		t.regs.tls = 0
+		t.regs.gaddr = 0
+		if !t.Blocked() {
+			t.regs.gaddr = t.regs.byName(t.p.conn.arch.g)
+		}
+		t.regs.hasgaddr = true
+		return nil
+	}
+
 	switch t.p.bi.GOOS {
 	case "linux":
 		if reg, hasFsBase := t.regs.regs[regnameFsBase]; hasFsBase {
@@ -1462,7 +1538,8 @@ func (t *gdbThread) writeRegisters() error {
 	if t.p.gcmdok {
 		return t.p.conn.writeRegisters(t.strID, t.regs.buf)
 	}
-	for _, r := range t.regs.regs {
+	for _, reginfo := range t.regs.regsInfo {
+		r := t.regs.regs[reginfo.Name]
 		if err := t.p.conn.writeRegister(t.strID, r.regnum, r.value); err != nil {
 			return err
 		}
@@ -1637,7 +1714,7 @@ func (t *gdbThread) SetCurrentBreakpoint(adjustPC bool) error {
 		}
 		t.CurrentBreakpoint = bp.CheckCondition(t)
 		if t.CurrentBreakpoint.Breakpoint != nil && t.CurrentBreakpoint.Active {
-			if g, err := proc.GetG(t); err == nil {
+			if g, err := proc.GetG(t); err == nil && g != nil {
 				t.CurrentBreakpoint.HitCount[g.ID]++
 			}
 			t.CurrentBreakpoint.TotalHitCount++
@@ -1647,18 +1724,18 @@ func (t *gdbThread) SetCurrentBreakpoint(adjustPC bool) error {
 }
 
 func (regs *gdbRegisters) PC() uint64 {
-	return binary.LittleEndian.Uint64(regs.regs[regnamePC].value)
+	return binary.LittleEndian.Uint64(regs.regs[regs.arch.pc].value)
 }
 
 func (regs *gdbRegisters) setPC(value uint64) {
-	binary.LittleEndian.PutUint64(regs.regs[regnamePC].value, value)
+	binary.LittleEndian.PutUint64(regs.regs[regs.arch.pc].value, value)
 }
 
 func (regs *gdbRegisters) SP() uint64 {
-	return binary.LittleEndian.Uint64(regs.regs[regnameSP].value)
+	return binary.LittleEndian.Uint64(regs.regs[regs.arch.sp].value)
 }
 func (regs *gdbRegisters) setSP(value uint64) {
-	binary.LittleEndian.PutUint64(regs.regs[regnameSP].value, value)
+	binary.LittleEndian.PutUint64(regs.regs[regs.arch.sp].value, value)
 }
 
 func (regs *gdbRegisters) setDX(value uint64) {
@@ -1666,7 +1743,7 @@ func (regs *gdbRegisters) setDX(value uint64) {
 }
 
 func (regs *gdbRegisters) BP() uint64 {
-	return binary.LittleEndian.Uint64(regs.regs[regnameBP].value)
+	return regs.byName(regs.arch.bp)
 }
 
 func (regs *gdbRegisters) CX() uint64 {
@@ -1694,6 +1771,9 @@ func (regs *gdbRegisters) byName(name string) uint64 {
 }
 
 func (regs *gdbRegisters) Get(n int) (uint64, error) {
+	if regs.arch.name == "arm64" {
+		return regs.getARM64(n)
+	}
 	reg := x86asm.Reg(n)
 	const (
 		mask8  = 0x000f
@@ -1850,6 +1930,19 @@ func (regs *gdbRegisters) Get(n int) (uint64, error) {
 	return 0, proc.ErrUnknownRegister
 }
 
+// getARM64 returns the value of the n-th register, in arm64asm order.
+func (regs *gdbRegisters) getARM64(n int) (uint64, error) {
+	reg := arm64asm.Reg(n)
+	if reg >= arm64asm.X0 && reg <= arm64asm.X30 {
+		r, ok := regs.regs[fmt.Sprintf("x%d", reg-arm64asm.X0)]
+		if !ok {
+			return 0, proc.ErrUnknownRegister
+		}
+		return binary.LittleEndian.Uint64(r.value), nil
+	}
+	return 0, proc.ErrUnknownRegister
+}
+
 func (r *gdbRegisters) FloatLoadError() error {
 	return nil
 }
@@ -1861,7 +1954,7 @@ func (t *gdbThread) SetPC(pc uint64) error {
 	if t.p.gcmdok {
 		return t.p.conn.writeRegisters(t.strID, t.regs.buf)
 	}
-	reg := t.regs.regs[regnamePC]
+	reg := t.regs.regs[t.regs.arch.pc]
 	return t.p.conn.writeRegister(t.strID, reg.regnum, reg.value)
 }
 
@@ -1872,7 +1965,7 @@ func (t *gdbThread) SetSP(sp uint64) error {
 	if t.p.gcmdok {
 		return t.p.conn.writeRegisters(t.strID, t.regs.buf)
 	}
-	reg := t.regs.regs[regnameSP]
+	reg := t.regs.regs[t.regs.arch.sp]
 	return t.p.conn.writeRegister(t.strID, reg.regnum, reg.value)
 }
 
@@ -1942,7 +2035,7 @@ func (regs *gdbRegisters) Slice(floatingPoint bool) ([]proc.Register, error) {
 
 func (regs *gdbRegisters) Copy() (proc.Registers, error) {
 	savedRegs := &gdbRegisters{}
-	savedRegs.init(regs.regsInfo)
+	savedRegs.init(regs.regsInfo, regs.arch)
 	copy(savedRegs.buf, regs.buf)
 	return savedRegs, nil
 }
@@ -18,6 +18,7 @@ import (
 
 	"github.com/go-delve/delve/pkg/logflags"
 	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/pkg/proc/macutil"
 	"github.com/sirupsen/logrus"
 )
 
@@ -45,6 +46,8 @@ type gdbConn struct {
 	threadSuffixSupported bool // thread suffix supported by stub
 	isDebugserver         bool // true if the stub is debugserver
 
+	arch *gdbArch // architecture of the inferior
+
 	log *logrus.Entry
 }
 
@@ -58,6 +61,44 @@ const (
 	regnameGsBase = "gs_base"
 )
 
+// gdbArch describes the registers and breakpoints of an architecture
+// supported by the backend, the registers are named as the stubs name
+// them.
+type gdbArch struct {
+	name       string
+	pc, sp, bp string
+	// g is the register containing the address of the current G, if it is
+	// empty the address is loaded from TLS executing a MOV (see
+	// loadGInstr) and clobbering regnameCX.
+	g string
+	// aliases maps registers to their alternative names, stubs use either.
+	aliases map[string]string
+	// breakpointKind is the kind argument of Z0 and z0 packets, the size of
+	// the breakpoint instruction.
+	breakpointKind int
+}
+
+var (
+	amd64GdbArch = &gdbArch{name: "amd64", pc: regnamePC, sp: regnameSP, bp: regnameBP, breakpointKind: 1}
+	arm64GdbArch = &gdbArch{name: "arm64", pc: "pc", sp: "sp", bp: "fp", g: "x28", aliases: map[string]string{"fp": "x29", "lr": "x30"}, breakpointKind: 4}
+)
+
+// gdbArchFor returns the description of the architecture goarch.
+func gdbArchFor(goarch string) *gdbArch {
+	if goarch == "arm64" {
+		return arm64GdbArch
+	}
+	return amd64GdbArch
+}
+
+// requiredRegisters returns the registers that the stub must provide.
+func (a *gdbArch) requiredRegisters() []string {
+	if a.g != "" {
+		return []string{a.pc, a.sp, a.g}
+	}
+	return []string{a.pc, a.sp, regnameCX}
+}
+
 var ErrTooManyAttempts = errors.New("too many transmit attempts")
 
 // GdbProtocolError is an error response (Exx) of Gdb Remote Serial Protocol
@@ -147,6 +188,13 @@ func (conn *gdbConn) handshake() error {
 		}
 	}
 
+	// debugserver can debug processes of a different architecture than its
+	// own, like amd64 processes translated by Rosetta 2 on arm64 machines,
+	// the names of the registers depend on the architecture of the inferior.
+	if conn.isDebugserver {
+		conn.detectArch()
+	}
+
 	// Attempt to figure out the name of the processor register.
 	// We either need qXfer:features:read (gdbserver/rr) or qRegisterInfo (lldb)
 	if err := conn.readRegisterInfo(); err != nil {
@@ -176,6 +224,22 @@ func (conn *gdbConn) handshake() error {
 	return nil
 }
 
+// detectArch sets the architecture of the inferior from the CPU type
+// returned by qProcessInfo, if the stub returns it.
+func (conn *gdbConn) detectArch() {
+	pi, err := conn.queryProcessInfo(0)
+	if err != nil {
+		return
+	}
+	cputype, err := strconv.ParseUint(pi["cputype"], 16, 32)
+	if err != nil {
+		return
+	}
+	if goarch, err := macutil.CPUTypeArch(uint32(cputype)); err == nil {
+		conn.arch = gdbArchFor(goarch)
+	}
+}
+
 // qSupported interprets qSupported responses.
 func (conn *gdbConn) qSupported(multiprocess bool) (features map[string]bool, err error) {
 	q := qSupportedSimple
@@ -241,7 +305,6 @@ func (conn *gdbConn) readTargetXml() (err error) {
 		return err
 	}
 	var offset int
-	var pcFound, cxFound, spFound bool
 	regnum := 0
 	for i := range conn.regsInfo {
 		if conn.regsInfo[i].Regnum == 0 {
@@ -251,24 +314,27 @@ func (conn *gdbConn) readTargetXml() (err error) {
 		}
 		conn.regsInfo[i].Offset = offset
 		offset += conn.regsInfo[i].Bitsize / 8
-		switch conn.regsInfo[i].Name {
-		case regnamePC:
-			pcFound = true
-		case regnameCX:
-			cxFound = true
-		case regnameSP:
-			spFound = true
-		}
 		regnum++
 	}
-	if !pcFound {
-		return errors.New("could not find RIP register")
-	}
-	if !spFound {
-		return errors.New("could not find RSP register")
+	return conn.checkRegisters()
+}
+
+// checkRegisters returns an error if one of the registers required by the
+// architecture is missing from conn.regsInfo.
+func (conn *gdbConn) checkRegisters() error {
+	found := make(map[string]bool)
+	for _, reginfo := range conn.regsInfo {
+		found[reginfo.Name] = true
+		for name, alias := range conn.arch.aliases {
+			if reginfo.Name == name || reginfo.Name == alias {
+				found[name], found[alias] = true, true
+			}
+		}
 	}
-	if !cxFound {
-		return errors.New("could not find RCX register")
+	for _, name := range conn.arch.requiredRegisters() {
+		if !found[name] {
+			return fmt.Errorf("could not find %s register", strings.ToUpper(name))
+		}
 	}
 	return nil
 }
@@ -277,7 +343,6 @@ func (conn *gdbConn) readTargetXml() (err error) {
 // when qXfer:feature:read is not supported).
 func (conn *gdbConn) readRegisterInfo() (err error) {
 	regnum := 0
-	var pcFound, cxFound, spFound bool
 	for {
 		conn.outbuf.Reset()
 		fmt.Fprintf(&conn.outbuf, "$qRegisterInfo%x", regnum)
@@ -330,31 +395,12 @@ func (conn *gdbConn) readRegisterInfo() (err error) {
 			continue
 		}
 
-		switch regname {
-		case regnamePC:
-			pcFound = true
-		case regnameCX:
-			cxFound = true
-		case regnameSP:
-			spFound = true
-		}
-
 		conn.regsInfo = append(conn.regsInfo, gdbRegisterInfo{Regnum: regnum, Name: regname, Bitsize: bitsize, Offset: offset})
 
 		regnum++
 	}
 
-	if !pcFound {
-		return errors.New("could not find RIP register")
-	}
-	if !spFound {
-		return errors.New("could not find RSP register")
-	}
-	if !cxFound {
-		return errors.New("could not find RCX register")
-	}
-
-	return nil
+	return conn.checkRegisters()
 }
 
 func (conn *gdbConn) readAnnex(annex string) ([]gdbRegisterInfo, error) {
@@ -412,18 +458,20 @@ func (conn *gdbConn) qXfer(kind, annex string, binary bool) ([]byte, error) {
 	return out, nil
 }
 
-// setBreakpoint executes a 'Z' (insert breakpoint) command of type '0' and kind '1'
+// setBreakpoint executes a 'Z' (insert breakpoint) command of type '0' and
+// the kind of the architecture
 func (conn *gdbConn) setBreakpoint(addr uint64) error {
 	conn.outbuf.Reset()
-	fmt.Fprintf(&conn.outbuf, "$Z0,%x,1", addr)
+	fmt.Fprintf(&conn.outbuf, "$Z0,%x,%d", addr, conn.arch.breakpointKind)
 	_, err := conn.exec(conn.outbuf.Bytes(), "set breakpoint")
 	return err
 }
 
-// clearBreakpoint executes a 'z' (remove breakpoint) command of type '0' and kind '1'
+// clearBreakpoint executes a 'z' (remove breakpoint) command of type '0'
+// and the kind of the architecture
 func (conn *gdbConn) clearBreakpoint(addr uint64) error {
 	conn.outbuf.Reset()
-	fmt.Fprintf(&conn.outbuf, "$z0,%x,1", addr)
+	fmt.Fprintf(&conn.outbuf, "$z0,%x,%d", addr, conn.arch.breakpointKind)
 	_, err := conn.exec(conn.outbuf.Bytes(), "clear breakpoint")
 	return err
 }
@@ -445,6 +493,42 @@ func (conn *gdbConn) kill() error {
 	return err
 }
 
+// launch asks the stub to launch the inferior with the arguments args and
+// the environment variables env, with the A, QEnvironmentHexEncoded and
+// qLaunchSuccess packets of lldb. If disableASLR is true the inferior is
+// launched with address space layout randomization disabled, stubs that
+// do not support it launch the inferior normally.
+func (conn *gdbConn) launch(args, env []string, disableASLR bool) error {
+	if disableASLR {
+		if _, err := conn.exec([]byte("$QSetDisableASLR:1"), "launch"); err != nil && !isProtocolErrorUnsupported(err) {
+			return err
+		}
+	}
+	for _, kv := range env {
+		conn.outbuf.Reset()
+		fmt.Fprintf(&conn.outbuf, "$QEnvironmentHexEncoded:%x", kv)
+		if _, err := conn.exec(conn.outbuf.Bytes(), "launch"); err != nil {
+			return err
+		}
+	}
+
+	conn.outbuf.Reset()
+	conn.outbuf.WriteString("$A")
+	for i, arg := range args {
+		if i > 0 {
+			conn.outbuf.WriteByte(',')
+		}
+		fmt.Fprintf(&conn.outbuf, "%d,%d,%x", len(arg)*2, i, arg)
+	}
+	if _, err := conn.exec(conn.outbuf.Bytes(), "launch"); err != nil {
+		return err
+	}
+	if _, err := conn.exec([]byte("$qLaunchSuccess"), "launch"); err != nil {
+		return fmt.Errorf("could not launch %s: %v", args[0], err)
+	}
+	return nil
+}
+
 // detach executes a 'D' (detach) command.
 func (conn *gdbConn) detach() error {
 	if conn.conn == nil {
@@ -0,0 +1,243 @@
+package gdbserial
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// ErrIOSToolsUnavailable is returned by IOSLaunch when the libimobiledevice
+// tools can not be found.
+var ErrIOSToolsUnavailable = errors.New("could not find idevicedebugserverproxy, install libimobiledevice and ideviceinstaller")
+
+// iosDevice is an iOS device connected to the host, controlled with the
+// tools of libimobiledevice.
+type iosDevice struct {
+	udid string // UDID of the device, empty for the only device connected
+}
+
+// newIOSDevice returns the device selected by the DELVE_IOS_DEVICE
+// environment variable, containing its UDID, or the only device connected.
+func newIOSDevice() (*iosDevice, error) {
+	for _, tool := range []string{"idevicedebugserverproxy", "ideviceimagemounter", "ideviceinfo", "ideviceinstaller"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return nil, ErrIOSToolsUnavailable
+		}
+	}
+	return &iosDevice{udid: os.Getenv("DELVE_IOS_DEVICE")}, nil
+}
+
+// command returns the command running tool on the device.
+func (dev *iosDevice) command(tool string, args ...string) *exec.Cmd {
+	if dev.udid != "" {
+		args = append([]string{"-u", dev.udid}, args...)
+	}
+	return commandLogger(tool, args...)
+}
+
+// output runs tool on the device and returns its standard output.
+func (dev *iosDevice) output(tool string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := dev.command(tool, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v %s", tool, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// mountDeveloperDiskImage mounts the developer disk image, containing
+// debugserver, if the device does not have one mounted already.
+// The image matching the version of iOS running on the device is searched
+// in the DeviceSupport directory of Xcode, or in the directory specified
+// by the DELVE_IOS_DDI environment variable.
+func (dev *iosDevice) mountDeveloperDiskImage() error {
+	out, err := dev.output("ideviceimagemounter", "-l")
+	if err != nil {
+		return err
+	}
+	// the signatures of the mounted images are listed as ImageSignature[n]
+	if bytes.Contains(out, []byte("ImageSignature[")) && !bytes.Contains(out, []byte("ImageSignature[0]")) {
+		return nil
+	}
+
+	dir := os.Getenv("DELVE_IOS_DDI")
+	if dir == "" {
+		out, err := dev.output("ideviceinfo", "-k", "ProductVersion")
+		if err != nil {
+			return err
+		}
+		dir, err = findDeveloperDiskImage(strings.TrimSpace(string(out)))
+		if err != nil {
+			return err
+		}
+	}
+	image := filepath.Join(dir, "DeveloperDiskImage.dmg")
+	_, err = dev.output("ideviceimagemounter", image, image+".signature")
+	return err
+}
+
+// findDeveloperDiskImage returns the directory of Xcode containing the
+// developer disk image for the version of iOS, which is named after the
+// major and minor version, followed by the build number in newer versions
+// of Xcode.
+func findDeveloperDiskImage(version string) (string, error) {
+	if v := strings.SplitN(version, ".", 3); len(v) == 3 {
+		version = v[0] + "." + v[1]
+	}
+	developerDir := "/Applications/Xcode.app/Contents/Developer"
+	if out, err := exec.Command("xcode-select", "-p").Output(); err == nil {
+		developerDir = strings.TrimSpace(string(out))
+	}
+	supportDir := filepath.Join(developerDir, "Platforms", "iPhoneOS.platform", "DeviceSupport")
+	fis, _ := ioutil.ReadDir(supportDir)
+	for _, fi := range fis {
+		if fi.Name() == version || strings.HasPrefix(fi.Name(), version+" ") {
+			return filepath.Join(supportDir, fi.Name()), nil
+		}
+	}
+	return "", fmt.Errorf("could not find the developer disk image of iOS %s in %s, set DELVE_IOS_DDI to the directory containing it", version, supportDir)
+}
+
+// appPath returns the path on the device of the executable of the installed
+// app whose executable is exe, an executable on the host. If exe is inside
+// an app bundle the installed app must have the same bundle name.
+func (dev *iosDevice) appPath(exe string) (string, error) {
+	out, err := dev.output("ideviceinstaller", "-l", "-o", "xml")
+	if err != nil {
+		return "", err
+	}
+	apps, err := parsePlist(bytes.NewReader(out))
+	if err != nil {
+		return "", fmt.Errorf("could not parse the installed apps: %v", err)
+	}
+	name := filepath.Base(exe)
+	bundle := ""
+	if dir := filepath.Base(filepath.Dir(exe)); strings.HasSuffix(dir, ".app") {
+		bundle = dir
+	}
+	list, _ := apps.([]interface{})
+	for _, app := range list {
+		info, _ := app.(map[string]interface{})
+		path, _ := info["Path"].(string)
+		if info["CFBundleExecutable"] != name || path == "" {
+			continue
+		}
+		if bundle != "" && filepath.Base(path) != bundle {
+			continue
+		}
+		return path + "/" + name, nil
+	}
+	return "", fmt.Errorf("%s is not installed on the device", name)
+}
+
+// parsePlist parses a property list in XML format, returning dictionaries
+// as maps, arrays as slices and the other values as strings, except
+// booleans.
+func parsePlist(r io.Reader) (interface{}, error) {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return parsePlistValue(dec, start)
+		}
+	}
+}
+
+func parsePlistValue(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict", "array":
+		dict := make(map[string]interface{})
+		var array []interface{}
+		key := ""
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				if tok.Name.Local == "key" {
+					if err := dec.DecodeElement(&key, &tok); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				v, err := parsePlistValue(dec, tok)
+				if err != nil {
+					return nil, err
+				}
+				if start.Name.Local == "dict" {
+					dict[key] = v
+				} else {
+					array = append(array, v)
+				}
+			case xml.EndElement:
+				if start.Name.Local == "dict" {
+					return dict, nil
+				}
+				return array, nil
+			}
+		}
+	case "true", "false":
+		return start.Name.Local == "true", dec.Skip()
+	default:
+		var s string
+		err := dec.DecodeElement(&s, &start)
+		return s, err
+	}
+}
+
+// IOSLaunch launches an app on an iOS device connected to the host and
+// connects to it through debugserver, running on the device. The device
+// is selected with DELVE_IOS_DEVICE (see newIOSDevice).
+//
+// cmd[0] is the executable of the app on the host, with its debug
+// information, the app must already be installed on the device, for
+// example with ideviceinstaller or Xcode. The developer disk image is
+// mounted if needed (see mountDeveloperDiskImage) and debugserver is
+// reached through the proxy of libimobiledevice, idevicedebugserverproxy.
+// The app is launched with ASLR disabled, since the executable is not
+// relocated, and asynchronous preemption disabled.
+func IOSLaunch(cmd []string, debugInfoDirs []string) (*proc.Target, error) {
+	dev, err := newIOSDevice()
+	if err != nil {
+		return nil, err
+	}
+	if err := dev.mountDeveloperDiskImage(); err != nil {
+		return nil, fmt.Errorf("could not mount the developer disk image: %v", err)
+	}
+	path, err := dev.appPath(cmd[0])
+	if err != nil {
+		return nil, err
+	}
+
+	port := unusedPort()
+	process := dev.command("idevicedebugserverproxy", strings.TrimPrefix(port, ":"))
+	process.SysProcAttr = sysProcAttr(false)
+	if err := process.Start(); err != nil {
+		return nil, err
+	}
+
+	p := newProcess(process.Process)
+	p.conn.isDebugserver = true
+	p.setTargetArch("darwin", "arm64")
+	args := append([]string{path}, cmd[1:]...)
+	p.onConnect = func() error {
+		return p.conn.launch(args, []string{"GODEBUG=asyncpreemptoff=1"}, true)
+	}
+	return p.Dial("127.0.0.1"+port, cmd[0], 0, debugInfoDirs, proc.StopLaunched)
+}
@@ -0,0 +1,27 @@
+package gdbserial
+
+import (
+	"net"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// DefaultStubAddr is the address of the gdb stub of qemu started with -s.
+const DefaultStubAddr = "127.0.0.1:1234"
+
+// StubAttach connects to a gdb remote protocol stub that is already
+// running at addr, for example the gdb stub of qemu or of a JTAG probe,
+// debugging the executable at path. The threads of these targets are
+// often CPUs: a flavor (see proc.Flavor) can be used to list the threads
+// of the program they run.
+func StubAttach(addr, path string, debugInfoDirs []string) (*proc.Target, error) {
+	if addr == "" {
+		addr = DefaultStubAddr
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	p := newProcess(nil)
+	return p.Connect(conn, path, 0, debugInfoDirs, proc.StopAttached)
+}
@@ -0,0 +1,65 @@
+package gdbserial
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// ErrWineUnavailable is returned by WineLaunch when winedbg can not be found.
+var ErrWineUnavailable = errors.New("could not find winedbg, install WINE or set DELVE_WINEDBG to the path of winedbg")
+
+// winedbgExecutable returns the winedbg program to use, which can be
+// overridden with the DELVE_WINEDBG environment variable, for example to
+// use the WINE shipped with proton.
+func winedbgExecutable() (string, error) {
+	if path := os.Getenv("DELVE_WINEDBG"); path != "" {
+		return path, nil
+	}
+	path, err := exec.LookPath("winedbg")
+	if err != nil {
+		return "", ErrWineUnavailable
+	}
+	return path, nil
+}
+
+// WineLaunch starts the windows executable cmd[0] under WINE, using the
+// gdb remote protocol stub of winedbg, and connects to it.
+func WineLaunch(cmd []string, wd string, debugInfoDirs []string, redirects [3]string) (*proc.Target, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("the wine backend is not supported on windows")
+	}
+	winedbg, err := winedbgExecutable()
+	if err != nil {
+		return nil, err
+	}
+
+	port := unusedPort()
+	args := make([]string, 0, len(cmd)+4)
+	args = append(args, "--gdb", "--no-start", "--port", strings.TrimPrefix(port, ":"))
+	args = append(args, cmd...)
+	process := commandLogger(winedbg, args...)
+
+	var closefn func()
+	process.Stdin, process.Stdout, process.Stderr, closefn, err = openRedirects(redirects, false)
+	if err != nil {
+		return nil, err
+	}
+	if wd != "" {
+		process.Dir = wd
+	}
+	process.SysProcAttr = sysProcAttr(false)
+
+	err = process.Start()
+	closefn()
+	if err != nil {
+		return nil, err
+	}
+
+	p := newProcess(process.Process)
+	return p.Dial("127.0.0.1"+port, cmd[0], 0, debugInfoDirs, proc.StopLaunched)
+}
@@ -11,6 +11,9 @@ func (gcache *goroutineCache) init(bi *BinaryInfo) {
 	var err error
 
 	exeimage := bi.Images[0]
+	if exeimage.dwarf == nil {
+		return
+	}
 	rdr := exeimage.DwarfReader()
 
 	gcache.allglenAddr, _ = rdr.AddrFor("runtime.allglen", exeimage.StaticBase, bi.Arch.PtrSize())
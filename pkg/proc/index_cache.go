@@ -0,0 +1,517 @@
+package proc
+
+import (
+	"debug/dwarf"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-delve/delve/pkg/config"
+)
+
+// The index cache stores, for executables that have a build ID, the
+// result of the walk of debug_info done by loadDebugInfoMaps: the list of
+// compile units, functions, package variables, constants and types. When
+// the same executable is loaded again the walk is skipped, which makes
+// opening binaries with a lot of debug information much faster. Only the
+// file tables of the line tables are read while loading an executable, with
+// or without the cache, line tables are parsed when they are first used.
+//
+// Cached addresses are not relocated, so that the cache can be used for
+// position independent executables loaded at a different address.
+//
+// Entries are invalidated when they can not be decoded or do not match the
+// debug information of the executable, the cache can be inspected and
+// cleaned with 'dlv cache'.
+
+const (
+	// indexCacheVersion must be changed whenever the format of indexCache
+	// or the content of the data it stores changes.
+	indexCacheVersion = 4
+
+	// indexCacheMaxEntries is the number of executables for which the
+	// index is kept, the least recently used ones are deleted.
+	indexCacheMaxEntries = 32
+)
+
+// indexCacheMinSize is the minimum size of debug_info for which the index
+// cache is used, smaller executables are faster to load than to decode.
+var indexCacheMinSize = 16 * 1024 * 1024
+
+// indexCacheHeader is the first value encoded in an index cache file, it
+// can be decoded without reading the rest of the file.
+type indexCacheHeader struct {
+	Path                         string // path of the executable when the file was written
+	GOOS                         string
+	DebugInfoSize, DebugLineSize int
+}
+
+type indexCache struct {
+	Units            []indexCacheUnit
+	Functions        []indexCacheFunction
+	PackageVars      []indexCachePackageVar
+	Consts           []indexCacheConst
+	Types            map[string]dwarf.Offset
+	PackageMap       map[string][]string
+	RuntimeTypes     map[uint64]indexCacheRuntimeType
+	InlinedCallLines []indexCacheCallLine
+	SourceLengths    map[string]uint64
+}
+
+type indexCacheUnit struct {
+	Offset         dwarf.Offset
+	Name           string
+	Version        uint8
+	Ranges         [][2]uint64
+	IsGo           bool
+	Optimized      bool
+	Producer       string
+	CompDir        string
+	LineInfoOffset int64 // -1 if the unit does not have a line table
+	LineVersion    uint16
+	Files          []string
+}
+
+type indexCacheFunction struct {
+	Name         string
+	Entry, End   uint64
+	Offset       dwarf.Offset
+	CU           int // index in Units
+	InlinedCalls []indexCacheInlinedCall
+}
+
+type indexCacheInlinedCall struct {
+	CU            int
+	LowPC, HighPC uint64
+}
+
+type indexCachePackageVar struct {
+	Name   string
+	CU     int
+	Offset dwarf.Offset
+	Addr   uint64
+}
+
+type indexCacheConst struct {
+	Type   dwarf.Offset
+	Values []indexCacheConstValue
+}
+
+type indexCacheConstValue struct {
+	Name, FullName string
+	Value          int64
+}
+
+type indexCacheRuntimeType struct {
+	Offset dwarf.Offset
+	Kind   int64
+}
+
+type indexCacheCallLine struct {
+	File string
+	Line int
+	PCs  []uint64
+}
+
+// IndexCacheDir returns the directory of the index cache, in the
+// configuration directory of delve, which can be changed with the
+// DELVE_INDEX_CACHE environment variable. Setting it to "off" disables the
+// cache, in which case IndexCacheDir returns false.
+func IndexCacheDir() (string, bool) {
+	switch dir := os.Getenv("DELVE_INDEX_CACHE"); dir {
+	case "off":
+		return "", false
+	case "":
+		dir, err := config.GetConfigFilePath("index")
+		if err != nil {
+			return "", false
+		}
+		return dir, true
+	default:
+		return dir, true
+	}
+}
+
+// indexCacheSuffix is the suffix of the name of the files of the index
+// cache, which are named after the build ID of the executable.
+var indexCacheSuffix = fmt.Sprintf(".v%d", indexCacheVersion)
+
+// indexCacheFileRe matches the names of the files of the index cache
+// written by any version of delve, including temporary files.
+var indexCacheFileRe = regexp.MustCompile(`^([0-9a-f]+\.v[0-9]+|tmp-[0-9]+)$`)
+
+// indexCachePath returns the path of the index cache file for image, or
+// the empty string if the index of image should not be cached.
+func indexCachePath(image *Image, debugInfoBytes []byte) string {
+	// Only the executable is cached, since its index is the first one
+	// loaded it is the only content of BinaryInfo when the walk ends.
+	if image.index != 0 || image.BuildID == "" || len(debugInfoBytes) < indexCacheMinSize {
+		return ""
+	}
+	dir, ok := IndexCacheDir()
+	if !ok {
+		return ""
+	}
+	return filepath.Join(dir, image.BuildID+indexCacheSuffix)
+}
+
+// IndexCacheEntry describes the cached index of an executable.
+type IndexCacheEntry struct {
+	BuildID  string
+	Path     string // path of the executable when the index was cached
+	Size     int64
+	LastUsed time.Time
+}
+
+// IndexCacheEntries returns the entries of the index cache, the most
+// recently used first.
+func IndexCacheEntries() ([]IndexCacheEntry, error) {
+	dir, ok := IndexCacheDir()
+	if !ok {
+		return nil, nil
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return nil, err
+	}
+	var r []IndexCacheEntry
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), indexCacheSuffix) {
+			continue
+		}
+		e := IndexCacheEntry{BuildID: strings.TrimSuffix(fi.Name(), indexCacheSuffix), Size: fi.Size(), LastUsed: fi.ModTime()}
+		if fh, err := os.Open(filepath.Join(dir, fi.Name())); err == nil {
+			var hdr indexCacheHeader
+			if gob.NewDecoder(fh).Decode(&hdr) == nil {
+				e.Path = hdr.Path
+			}
+			fh.Close()
+		}
+		r = append(r, e)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].LastUsed.After(r[j].LastUsed) })
+	return r, nil
+}
+
+// RemoveIndexCache deletes the cached indexes of the executables with the
+// specified build IDs, or the whole index cache if buildIDs is empty.
+// Returns the number of executables whose index was deleted.
+func RemoveIndexCache(buildIDs []string) (int, error) {
+	dir, ok := IndexCacheDir()
+	if !ok {
+		return 0, nil
+	}
+	if len(buildIDs) > 0 {
+		n := 0
+		for _, id := range buildIDs {
+			err := os.Remove(filepath.Join(dir, filepath.Base(id)+indexCacheSuffix))
+			if err == nil {
+				n++
+			} else if !os.IsNotExist(err) {
+				return n, err
+			}
+		}
+		return n, nil
+	}
+	entries, err := IndexCacheEntries()
+	if err != nil {
+		return 0, err
+	}
+	// Files left by other versions of delve and temporary files are also
+	// removed.
+	fis, _ := ioutil.ReadDir(dir)
+	for _, fi := range fis {
+		if !indexCacheFileRe.MatchString(fi.Name()) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
+
+// loadIndexCache loads the index of image from the index cache, returns
+// false if it is not cached.
+func (bi *BinaryInfo) loadIndexCache(image *Image, debugInfoBytes, debugLineBytes []byte) bool {
+	path := indexCachePath(image, debugInfoBytes)
+	if path == "" {
+		return false
+	}
+	fh, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	var hdr indexCacheHeader
+	var c indexCache
+	dec := gob.NewDecoder(fh)
+	err = dec.Decode(&hdr)
+	if err == nil && (hdr.GOOS != bi.GOOS || hdr.DebugInfoSize != len(debugInfoBytes) || hdr.DebugLineSize != len(debugLineBytes)) {
+		err = fmt.Errorf("does not match %s", image.Path)
+	}
+	if err == nil {
+		err = dec.Decode(&c)
+	}
+	fh.Close()
+	if err != nil {
+		// The file is corrupted or belongs to a different executable with the
+		// same build ID, it is deleted so that the index is cached again.
+		bi.logger.Debugf("invalid index cache %s: %v", path, err)
+		os.Remove(path)
+		return false
+	}
+
+	rdr := image.dwarf.Reader()
+	cus := make([]*compileUnit, len(c.Units))
+	for i, u := range c.Units {
+		rdr.Seek(u.Offset)
+		entry, err := rdr.Next()
+		if err != nil || entry == nil || entry.Offset != u.Offset {
+			bi.logger.Debugf("invalid index cache %s: does not match %s", path, image.Path)
+			os.Remove(path)
+			return false
+		}
+		cu := &compileUnit{
+			name:        u.Name,
+			Version:     u.Version,
+			entry:       entry,
+			isgo:        u.IsGo,
+			optimized:   u.Optimized,
+			producer:    u.Producer,
+			files:       u.Files,
+			lineVersion: u.LineVersion,
+			offset:      u.Offset,
+			image:       image,
+		}
+		for _, rng := range u.Ranges {
+			cu.ranges = append(cu.ranges, [2]uint64{rng[0] + image.StaticBase, rng[1] + image.StaticBase})
+		}
+		if len(cu.ranges) >= 1 {
+			cu.lowPC = cu.ranges[0][0]
+		}
+		if u.LineInfoOffset >= 0 {
+			bi.setLineInfoLoader(image, cu, u.CompDir, debugLineBytes, u.LineInfoOffset)
+		}
+		cus[i] = cu
+	}
+	validCU := func(i int) bool { return i >= 0 && i < len(cus) }
+
+	image.compileUnits = append(image.compileUnits, cus...)
+
+	for _, f := range c.Functions {
+		if !validCU(f.CU) {
+			continue
+		}
+		fn := Function{
+			Name:   f.Name,
+			offset: f.Offset,
+			cu:     cus[f.CU],
+		}
+		if f.Entry != 0 || f.End != 0 {
+			fn.Entry, fn.End = f.Entry+image.StaticBase, f.End+image.StaticBase
+		}
+		for _, call := range f.InlinedCalls {
+			if validCU(call.CU) {
+				fn.InlinedCalls = append(fn.InlinedCalls, InlinedCall{cu: cus[call.CU], LowPC: call.LowPC + image.StaticBase, HighPC: call.HighPC + image.StaticBase})
+			}
+		}
+		bi.Functions = append(bi.Functions, fn)
+	}
+
+	for _, v := range c.PackageVars {
+		if validCU(v.CU) {
+			bi.packageVars = append(bi.packageVars, packageVar{v.Name, cus[v.CU], v.Offset, v.Addr + image.StaticBase})
+		}
+	}
+
+	for _, ct := range c.Consts {
+		values := make([]constantValue, len(ct.Values))
+		for i, v := range ct.Values {
+			values[i] = constantValue{name: v.Name, fullName: v.FullName, value: v.Value}
+		}
+		bi.consts[dwarfRef{image.index, ct.Type}] = &constantType{values: values}
+	}
+
+	for name, off := range c.Types {
+		bi.types[name] = dwarfRef{image.index, off}
+	}
+	for name, paths := range c.PackageMap {
+		bi.PackageMap[name] = paths
+	}
+
+	image.sourceLengths = c.SourceLengths
+
+	image.runtimeTypeToDIE = make(map[uint64]runtimeTypeDIE, len(c.RuntimeTypes))
+	for off, rtdie := range c.RuntimeTypes {
+		image.runtimeTypeToDIE[off+image.StaticBase] = runtimeTypeDIE{rtdie.Offset, rtdie.Kind}
+	}
+
+	for _, fl := range c.InlinedCallLines {
+		pcs := make([]uint64, len(fl.PCs))
+		for i := range fl.PCs {
+			pcs[i] = fl.PCs[i] + image.StaticBase
+		}
+		bi.inlinedCallLines[fileLine{fl.File, fl.Line}] = pcs
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	bi.logger.Debugf("loaded index of %s from %s", image.Path, path)
+	return true
+}
+
+// saveIndexCache saves the index of image, which must have just been
+// loaded by walking debug_info, to the index cache.
+func (bi *BinaryInfo) saveIndexCache(image *Image, debugInfoBytes, debugLineBytes []byte) {
+	path := indexCachePath(image, debugInfoBytes)
+	if path == "" || image.loadErr != nil {
+		return
+	}
+
+	hdr := indexCacheHeader{
+		Path:          image.Path,
+		GOOS:          bi.GOOS,
+		DebugInfoSize: len(debugInfoBytes),
+		DebugLineSize: len(debugLineBytes),
+	}
+	c := indexCache{
+		Types:         make(map[string]dwarf.Offset),
+		PackageMap:    bi.PackageMap,
+		RuntimeTypes:  make(map[uint64]indexCacheRuntimeType, len(image.runtimeTypeToDIE)),
+		SourceLengths: image.sourceLengths,
+	}
+
+	cuIndex := make(map[*compileUnit]int, len(image.compileUnits))
+	for i, cu := range image.compileUnits {
+		cuIndex[cu] = i
+		u := indexCacheUnit{
+			Offset:         cu.offset,
+			Name:           cu.name,
+			Version:        cu.Version,
+			IsGo:           cu.isgo,
+			Optimized:      cu.optimized,
+			Producer:       cu.producer,
+			LineInfoOffset: -1,
+			LineVersion:    cu.lineVersion,
+			Files:          cu.fileNames(),
+		}
+		u.CompDir, _ = cu.entry.Val(dwarf.AttrCompDir).(string)
+		if off, ok := cu.entry.Val(dwarf.AttrStmtList).(int64); ok {
+			u.LineInfoOffset = off
+		}
+		for _, rng := range cu.ranges {
+			u.Ranges = append(u.Ranges, [2]uint64{rng[0] - image.StaticBase, rng[1] - image.StaticBase})
+		}
+		c.Units = append(c.Units, u)
+	}
+
+	for _, fn := range bi.Functions {
+		f := indexCacheFunction{
+			Name:   fn.Name,
+			Offset: fn.offset,
+			CU:     cuIndex[fn.cu],
+		}
+		if fn.Entry != 0 || fn.End != 0 {
+			f.Entry, f.End = fn.Entry-image.StaticBase, fn.End-image.StaticBase
+		}
+		for _, call := range fn.InlinedCalls {
+			f.InlinedCalls = append(f.InlinedCalls, indexCacheInlinedCall{cuIndex[call.cu], call.LowPC - image.StaticBase, call.HighPC - image.StaticBase})
+		}
+		c.Functions = append(c.Functions, f)
+	}
+
+	for _, v := range bi.packageVars {
+		c.PackageVars = append(c.PackageVars, indexCachePackageVar{v.name, cuIndex[v.cu], v.offset, v.addr - image.StaticBase})
+	}
+
+	for ref, ct := range bi.consts {
+		cc := indexCacheConst{Type: ref.offset}
+		for _, v := range ct.values {
+			cc.Values = append(cc.Values, indexCacheConstValue{v.name, v.fullName, v.value})
+		}
+		c.Consts = append(c.Consts, cc)
+	}
+
+	for name, ref := range bi.types {
+		c.Types[name] = ref.offset
+	}
+
+	for off, rtdie := range image.runtimeTypeToDIE {
+		c.RuntimeTypes[off-image.StaticBase] = indexCacheRuntimeType{rtdie.offset, rtdie.kind}
+	}
+
+	for fl, pcs := range bi.inlinedCallLines {
+		cl := indexCacheCallLine{File: fl.file, Line: fl.line, PCs: make([]uint64, len(pcs))}
+		for i := range pcs {
+			cl.PCs[i] = pcs[i] - image.StaticBase
+		}
+		c.InlinedCallLines = append(c.InlinedCallLines, cl)
+	}
+
+	if err := writeIndexCache(path, &hdr, &c); err != nil {
+		bi.logger.Debugf("could not write index cache %s: %v", path, err)
+	}
+}
+
+// writeIndexCache writes hdr and c to path and deletes the least recently
+// used entries of the cache, if there are too many, and the entries
+// written by other versions of delve.
+func writeIndexCache(path string, hdr *indexCacheHeader, c *indexCache) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	fh, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(fh)
+	err = enc.Encode(hdr)
+	if err == nil {
+		err = enc.Encode(c)
+	}
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// The rename is atomic, concurrent instances of delve will never read
+		// a partially written file.
+		err = os.Rename(fh.Name(), path)
+	}
+	if err != nil {
+		os.Remove(fh.Name())
+		return err
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var entries []os.FileInfo
+	for _, fi := range fis {
+		switch {
+		case strings.HasSuffix(fi.Name(), indexCacheSuffix):
+			entries = append(entries, fi)
+		case indexCacheFileRe.MatchString(fi.Name()) && !strings.HasPrefix(fi.Name(), "tmp-"):
+			// written by a different version of delve
+			os.Remove(filepath.Join(dir, fi.Name()))
+		}
+	}
+	if len(entries) <= indexCacheMaxEntries {
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ModTime().After(entries[j].ModTime()) })
+	for _, fi := range entries[indexCacheMaxEntries:] {
+		os.Remove(filepath.Join(dir, fi.Name()))
+	}
+	return nil
+}
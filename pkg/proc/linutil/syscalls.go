@@ -0,0 +1,19 @@
+package linutil
+
+//go:generate go run ../../../_scripts/gen-syscalls.go ../../../vendor/golang.org/x/sys/unix syscalls_table.go
+
+// SyscallName returns the name of the system call number nr on arch, or
+// the empty string if it is unknown.
+func SyscallName(arch string, nr int) string {
+	return syscallNames[arch][nr]
+}
+
+// SyscallNumber returns the number of the system call name on arch.
+func SyscallNumber(arch, name string) (int, bool) {
+	for nr, n := range syscallNames[arch] {
+		if n == name {
+			return nr, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,3 @@
+// This package contains functions used by the backends to deal with the
+// peculiarities of macOS, like Rosetta 2.
+package macutil
@@ -0,0 +1,70 @@
+package macutil
+
+import (
+	"debug/macho"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// ErrTranslated is returned by the native backend, which can not run
+// under Rosetta 2 or debug processes translated by it.
+var ErrTranslated = errors.New("the native backend can not run under Rosetta 2 or debug processes translated by it, use the lldb backend (--backend=lldb)")
+
+// ErrRosettaNotInstalled is returned by CheckExecutableArch for amd64
+// executables on arm64 machines where Rosetta 2 is not installed.
+var ErrRosettaNotInstalled = errors.New("amd64 executables are translated by Rosetta 2 on this machine, install it with 'softwareupdate --install-rosetta'")
+
+// rosettaPath is the path of the runtime of Rosetta 2, if it is installed.
+const rosettaPath = "/Library/Apple/usr/share/rosetta/rosetta"
+
+// CheckExecutableArch returns an error if the Mach-O executable at path
+// can not run on this machine.
+func CheckExecutableArch(path string) error {
+	goarch, err := ExecutableArch(path)
+	if err != nil {
+		// fat executables, or not Mach-O at all, are left to the stub
+		return nil
+	}
+	hostArch := runtime.GOARCH
+	if Translated() {
+		hostArch = "arm64"
+	}
+	switch {
+	case goarch == "arm64" && hostArch == "amd64":
+		return fmt.Errorf("%s is an arm64 executable, it can only run on Apple Silicon machines", path)
+	case goarch == "amd64" && hostArch == "arm64":
+		if _, err := os.Stat(rosettaPath); err != nil {
+			return ErrRosettaNotInstalled
+		}
+	}
+	return nil
+}
+
+// ExecutableArch returns the architecture, as a GOARCH, of the Mach-O
+// executable at path.
+func ExecutableArch(path string) (string, error) {
+	f, err := macho.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return cpuArch(f.Cpu)
+}
+
+// CPUTypeArch returns the architecture, as a GOARCH, of the Mach-O CPU
+// type cputype.
+func CPUTypeArch(cputype uint32) (string, error) {
+	return cpuArch(macho.Cpu(cputype))
+}
+
+func cpuArch(cpu macho.Cpu) (string, error) {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64", nil
+	case macho.CpuArm64:
+		return "arm64", nil
+	}
+	return "", fmt.Errorf("unsupported CPU type %v", cpu)
+}
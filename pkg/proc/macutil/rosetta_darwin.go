@@ -0,0 +1,12 @@
+package macutil
+
+import (
+	sys "golang.org/x/sys/unix"
+)
+
+// Translated returns true if the calling process is an amd64 process
+// translated by Rosetta 2 on an arm64 (Apple Silicon) machine.
+func Translated() bool {
+	translated, err := sys.SysctlUint32("sysctl.proc_translated")
+	return err == nil && translated == 1
+}
@@ -0,0 +1,9 @@
+// +build !darwin
+
+package macutil
+
+// Translated returns true if the calling process is an amd64 process
+// translated by Rosetta 2 on an arm64 (Apple Silicon) machine.
+func Translated() bool {
+	return false
+}
@@ -0,0 +1,117 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// memProfile is the value of runtime.bucketType for memory profile buckets.
+const memProfile = 1
+
+// maxMemProfileRecords is the maximum number of records read by
+// ReadMemProfile, it protects against loops in corrupted lists.
+const maxMemProfileRecords = 1 << 20
+
+// MemProfileRecord describes the allocations made from a single call
+// stack, as recorded by the memory profiler of the runtime.
+type MemProfileRecord struct {
+	AllocBytes, FreeBytes     int64
+	AllocObjects, FreeObjects int64
+	Stack                     []uint64 // return addresses, innermost first
+}
+
+// ReadMemProfile reads the memory profile maintained by the runtime
+// directly from the memory of the target. It returns the same data that
+// runtime.MemProfile would return, without calling any function of the
+// target, therefore it also works on core files.
+func ReadMemProfile(t *Target) ([]MemProfileRecord, error) {
+	scope, err := ThreadScope(t.CurrentThread())
+	if err != nil {
+		return nil, err
+	}
+	mbuckets, err := scope.findGlobal("runtime", "mbuckets")
+	if err != nil {
+		return nil, err
+	}
+	bi := t.BinInfo()
+	mem := t.CurrentThread()
+	bucketType, err := bi.findType("runtime.bucket")
+	if err != nil {
+		return nil, err
+	}
+	memRecordType, err := bi.findType("runtime.memRecord")
+	if err != nil {
+		return nil, err
+	}
+	ptrSize := int64(bi.Arch.PtrSize())
+
+	readMember := func(v *Variable, name string) (uint64, error) {
+		field, err := v.structMember(name)
+		if err != nil {
+			return 0, err
+		}
+		return readUintRaw(mem, field.Addr, field.RealType.Size())
+	}
+
+	addr, err := readUintRaw(mem, mbuckets.Addr, ptrSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var r []MemProfileRecord
+	for addr != 0 {
+		if len(r) >= maxMemProfileRecords {
+			return nil, errors.New("too many memory profile records")
+		}
+		b := newVariable("", uintptr(addr), bucketType, bi, mem)
+		typ, err := readMember(b, "typ")
+		if err != nil {
+			return nil, err
+		}
+		nstk, err := readMember(b, "nstk")
+		if err != nil {
+			return nil, err
+		}
+		next, err := readMember(b, "allnext")
+		if err != nil {
+			return nil, err
+		}
+		if typ != memProfile {
+			addr = next
+			continue
+		}
+
+		stkaddr := uintptr(addr) + uintptr(bucketType.Size())
+		rec := MemProfileRecord{Stack: make([]uint64, nstk)}
+		for i := range rec.Stack {
+			rec.Stack[i], err = readUintRaw(mem, stkaddr+uintptr(int64(i)*ptrSize), ptrSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		mr := newVariable("", stkaddr+uintptr(int64(nstk)*ptrSize), memRecordType, bi, mem)
+		active, err := mr.structMember("active")
+		if err != nil {
+			return nil, fmt.Errorf("unsupported memory profile format: %v", err)
+		}
+		for _, field := range []struct {
+			name string
+			dst  *int64
+		}{
+			{"allocs", &rec.AllocObjects},
+			{"frees", &rec.FreeObjects},
+			{"alloc_bytes", &rec.AllocBytes},
+			{"free_bytes", &rec.FreeBytes},
+		} {
+			n, err := readMember(active, field.name)
+			if err != nil {
+				return nil, fmt.Errorf("unsupported memory profile format: %v", err)
+			}
+			*field.dst = int64(n)
+		}
+		r = append(r, rec)
+		addr = next
+	}
+	return r, nil
+}
@@ -0,0 +1,94 @@
+package native
+
+import (
+	"fmt"
+
+	"github.com/go-delve/delve/pkg/logflags"
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// displacedSize is the size of the memory allocated in the target to
+// execute the instructions replaced by breakpoints out of line.
+const displacedSize = 4096
+
+// allocDisplaced allocates the memory used by skipBreakpoint when the
+// process has internal breakpoints. Must be called when all threads are
+// stopped.
+func (dbp *nativeProcess) allocDisplaced() {
+	if dbp.displaced != 0 || !dbp.breakpoints.HasInternalBreakpoints() {
+		return
+	}
+	// close to the code, so that instructions addressing memory relative to
+	// the PC can be moved
+	near := ^uint64(0)
+	for addr := range dbp.breakpoints.M {
+		if addr < near {
+			near = addr
+		}
+	}
+	addr, err := predicateRegionHint(dbp.pid, near)
+	if err == nil {
+		addr, err = dbp.memoryThread().injectMmap(addr, displacedSize)
+	}
+	if err != nil {
+		logflags.DebuggerLogger().Debugf("could not allocate memory for displaced instructions: %v", err)
+		dbp.displaced = ^uint64(0)
+		return
+	}
+	dbp.displaced = addr
+}
+
+// skipBreakpoint resumes th, stopped by a SIGTRAP while the other threads
+// are running, if it is stopped at a breakpoint that does not need to stop
+// the process, see proc.(*Breakpoint).CanSkip. Returns false if th needs
+// to stop the process.
+// The instruction replaced by the breakpoint is executed out of line, so
+// that the breakpoint is never removed while other threads are running.
+func (dbp *nativeProcess) skipBreakpoint(th *nativeThread) (bool, error) {
+	if dbp.displaced == 0 || dbp.displaced == ^uint64(0) || !th.os.setbp {
+		return false, nil
+	}
+	dbp.stopMu.Lock()
+	manualStop := dbp.manualStopRequested
+	dbp.stopMu.Unlock()
+	if manualStop {
+		return false, nil
+	}
+	pc, err := th.PC()
+	if err != nil {
+		return false, nil
+	}
+	bp, ok := dbp.FindBreakpoint(pc, true)
+	if !ok || bp.Addr != pc-uint64(dbp.bi.Arch.BreakpointSize()) || !bp.CanSkip(th) {
+		return false, nil
+	}
+	inst, err := proc.DisplacedInstruction(dbp.bi, th, bp, dbp.displaced)
+	if err != nil {
+		return false, nil
+	}
+	if _, err := th.WriteMemory(uintptr(dbp.displaced), inst); err != nil {
+		return false, nil
+	}
+	if err := th.SetPC(dbp.displaced); err != nil {
+		return false, nil
+	}
+	if err := th.singleStep(); err != nil {
+		return false, err
+	}
+	pc, err = th.PC()
+	if err != nil {
+		return false, err
+	}
+	switch pc {
+	case dbp.displaced + uint64(len(inst)):
+		if err := th.SetPC(bp.Addr + uint64(len(inst))); err != nil {
+			return false, err
+		}
+	case dbp.displaced:
+		// the instruction was not executed, stop at the breakpoint
+		return false, th.SetPC(bp.Addr + uint64(dbp.bi.Arch.BreakpointSize()))
+	default:
+		return false, fmt.Errorf("thread %d stopped at %#x stepping over the breakpoint at %#x", th.ID, pc, bp.Addr)
+	}
+	return true, th.resume()
+}
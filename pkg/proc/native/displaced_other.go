@@ -0,0 +1,9 @@
+// +build !linux !amd64
+
+package native
+
+func (dbp *nativeProcess) allocDisplaced() {}
+
+// skipBreakpoint always returns false, breakpoints can only be skipped
+// without stopping the process on linux/amd64.
+func (dbp *nativeProcess) skipBreakpoint(th *nativeThread) (bool, error) { return false, nil }
@@ -39,7 +39,12 @@ fork_exec(char *argv0, char **argv, int size,
 		close(fd[0]);
 		close(efd[1]);
 		kret = acquire_mach_task(pid, task, port_set, exception_port, notification_port);
-		if (kret != KERN_SUCCESS) return -1;
+		if (kret != KERN_SUCCESS) {
+			// The child is waiting for us, kill it.
+			kill(pid, SIGKILL);
+			waitpid(pid, NULL, 0);
+			return fork_exec_task_for_pid_failed;
+		}
 
 		char msg = 'c';
 		write(fd[1], &msg, 1);
@@ -7,6 +7,11 @@
 #include <errno.h>
 #include <stdlib.h>
 #include <fcntl.h>
+#include <signal.h>
+
+// fork_exec_task_for_pid_failed is returned by fork_exec when the mach
+// task of the child could not be acquired.
+#define fork_exec_task_for_pid_failed -2
 
 int
 fork_exec(char *, char **, int, char *, task_t*, mach_port_t*, mach_port_t*, mach_port_t*);
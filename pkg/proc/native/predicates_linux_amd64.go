@@ -0,0 +1,384 @@
+package native
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"io/ioutil"
+	"sort"
+
+	sys "golang.org/x/sys/unix"
+
+	"github.com/go-delve/delve/pkg/logflags"
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// predicateRegionSize is the size of the memory regions allocated in the
+// target for the code of predicates.
+const predicateRegionSize = 64 * 1024
+
+// predicateMaxSteps is the maximum number of instructions executed by a
+// thread to leave the code of a predicate when the target stops.
+const predicateMaxSteps = 64
+
+// predicateTable holds the predicates compiled from the conditions of the
+// breakpoints of the process, see CompileConditions.
+// While the process is running the code at the address of each predicate
+// is replaced with a jump to the code of the predicate, loaded in memory
+// allocated in the target; when the process stops the original code,
+// with the breakpoint instruction, is restored.
+type predicateTable struct {
+	enabled bool
+	m       map[uint64]*predicate
+	regions []predicateRegion
+}
+
+type predicate struct {
+	bp   *proc.Breakpoint
+	cond ast.Expr // condition of bp compiled in p
+	p    *proc.Predicate
+	err  error
+
+	code      uint64 // address of the code of the predicate, 0 if not loaded
+	codeLen   uint64
+	trap      uint64 // address of the breakpoint instruction in the code
+	saved     []byte // code replaced by the jump
+	installed bool
+}
+
+// predicateRegion is a memory region allocated in the target.
+type predicateRegion struct {
+	addr, next, end uint64
+}
+
+// CompileConditions enables the compilation of the conditions of the user
+// breakpoints of the process to predicates evaluated by the target, see
+// proc.CompilePredicate. The conditions that can not be compiled are
+// evaluated stopping the target, as usual.
+func (dbp *nativeProcess) CompileConditions(enabled bool) bool {
+	dbp.predicates.enabled = enabled
+	return true
+}
+
+// installPredicates replaces the code at the address of the breakpoints
+// with a compiled condition with jumps to their predicates. Must be called
+// when all threads are stopped, after they were made to step over their
+// breakpoints.
+func (dbp *nativeProcess) installPredicates() error {
+	if !dbp.predicates.enabled {
+		return nil
+	}
+	if dbp.predicates.m == nil {
+		dbp.predicates.m = make(map[uint64]*predicate)
+	}
+	thread := dbp.memoryThread()
+	for addr, pred := range dbp.predicates.m {
+		if dbp.breakpoints.M[addr] != pred.bp {
+			delete(dbp.predicates.m, addr)
+		}
+	}
+	for addr, bp := range dbp.breakpoints.M {
+		if bp.Kind != proc.UserBreakpoint || bp.Cond == nil || bp.ErrorReturn {
+			delete(dbp.predicates.m, addr)
+			continue
+		}
+		pred := dbp.predicates.m[addr]
+		if pred == nil || pred.cond != bp.Cond {
+			pred = &predicate{bp: bp, cond: bp.Cond}
+			pred.p, pred.err = proc.CompilePredicate(dbp.bi, thread, &dbp.breakpoints, bp)
+			if pred.err != nil {
+				logflags.DebuggerLogger().Debugf("condition of breakpoint %d at %#x not compiled: %v", bp.LogicalID, addr, pred.err)
+			}
+			dbp.predicates.m[addr] = pred
+		}
+		if pred.err != nil || !dbp.canInstallPredicate(pred.p) {
+			continue
+		}
+		if pred.code == 0 {
+			if err := dbp.loadPredicate(thread, pred); err != nil {
+				pred.err = err
+				logflags.DebuggerLogger().Debugf("predicate of breakpoint %d at %#x not loaded: %v", bp.LogicalID, addr, err)
+				continue
+			}
+		}
+		jmp, err := pred.p.Jump(pred.code)
+		if err != nil {
+			return err
+		}
+		pred.saved = make([]byte, len(jmp))
+		if _, err := thread.ReadMemory(pred.saved, uintptr(addr)); err != nil {
+			return err
+		}
+		if _, err := thread.WriteMemory(uintptr(addr), jmp); err != nil {
+			return err
+		}
+		pred.installed = true
+	}
+	return nil
+}
+
+// canInstallPredicate returns false if the jump to p would overwrite
+// another breakpoint. Threads about to execute the code overwritten by
+// the jump, for example because they just stepped over the breakpoint,
+// are made to step after it.
+func (dbp *nativeProcess) canInstallPredicate(p *proc.Predicate) bool {
+	inside := func(addr uint64) bool {
+		return addr > p.Addr && addr < p.Addr+uint64(p.Len)
+	}
+	for addr := range dbp.breakpoints.M {
+		if inside(addr) {
+			return false
+		}
+	}
+	for _, th := range dbp.threads {
+		// The instructions replaced by the jump do not transfer control.
+		for i := 0; ; i++ {
+			pc, err := th.PC()
+			if err != nil || (inside(pc) && i >= p.Len) {
+				return false
+			}
+			if !inside(pc) {
+				break
+			}
+			if err := th.singleStep(); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// memoryThread returns a thread that can be used to access the memory of
+// the process: the current thread could have exited.
+func (dbp *nativeProcess) memoryThread() *nativeThread {
+	if _, err := dbp.currentThread.PC(); err == nil {
+		return dbp.currentThread
+	}
+	for _, th := range dbp.threads {
+		if _, err := th.PC(); err == nil {
+			return th
+		}
+	}
+	return dbp.currentThread
+}
+
+// loadPredicate writes the code of pred in memory allocated in the target,
+// using thread.
+func (dbp *nativeProcess) loadPredicate(thread *nativeThread, pred *predicate) error {
+	code, trap, err := pred.p.Code()
+	if err != nil {
+		return err
+	}
+	addr, err := dbp.allocPredicate(thread, pred.p, uint64(len(code)))
+	if err != nil {
+		return err
+	}
+	if _, err := thread.WriteMemory(uintptr(addr), code); err != nil {
+		return err
+	}
+	pred.code, pred.codeLen, pred.trap = addr, uint64(len(code)), addr+uint64(trap)
+	logflags.DebuggerLogger().Debugf("condition of breakpoint %d compiled to a predicate at %#x", pred.bp.LogicalID, addr)
+	return nil
+}
+
+// allocPredicate returns the address of size bytes of memory, that can be
+// reached by the jump to p, for the code of p. The memory is never freed.
+// New memory is allocated by thread.
+func (dbp *nativeProcess) allocPredicate(thread *nativeThread, p *proc.Predicate, size uint64) (uint64, error) {
+	for i := range dbp.predicates.regions {
+		r := &dbp.predicates.regions[i]
+		if r.next+size > r.end {
+			continue
+		}
+		if _, err := p.Jump(r.next); err != nil {
+			continue
+		}
+		addr := r.next
+		r.next += (size + 15) &^ 15
+		return addr, nil
+	}
+	if size > predicateRegionSize {
+		return 0, errors.New("predicate too large")
+	}
+	hint, err := predicateRegionHint(dbp.pid, p.Addr)
+	if err != nil {
+		return 0, err
+	}
+	addr, err := thread.injectMmap(hint, predicateRegionSize)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := p.Jump(addr); err != nil {
+		return 0, err
+	}
+	dbp.predicates.regions = append(dbp.predicates.regions, predicateRegion{addr: addr, next: addr + (size+15)&^15, end: addr + predicateRegionSize})
+	return addr, nil
+}
+
+// predicateRegionHint returns the address of the unmapped region of
+// predicateRegionSize bytes closest to addr.
+func predicateRegionHint(pid int, addr uint64) (uint64, error) {
+	maps, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return 0, err
+	}
+	type mapping struct{ start, end uint64 }
+	mappings := []mapping{{0, 0x10000}} // below vm.mmap_min_addr
+	scan := bufio.NewScanner(bytes.NewReader(maps))
+	for scan.Scan() {
+		var m mapping
+		if _, err := fmt.Sscanf(scan.Text(), "%x-%x", &m.start, &m.end); err == nil {
+			mappings = append(mappings, m)
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].start < mappings[j].start })
+
+	var best uint64
+	found := false
+	try := func(hint uint64) {
+		if !found || distance(hint, addr) < distance(best, addr) {
+			best, found = hint, true
+		}
+	}
+	for i := 0; i+1 < len(mappings); i++ {
+		start, end := mappings[i].end, mappings[i+1].start
+		if end < start || end-start < predicateRegionSize {
+			continue
+		}
+		try(start)
+		try(end - predicateRegionSize)
+	}
+	if !found {
+		return 0, errors.New("no space for predicates")
+	}
+	return best, nil
+}
+
+func distance(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// injectMmap makes thread call mmap to allocate size bytes of executable
+// memory at hint, or near it, and returns the address of the memory.
+func (thread *nativeThread) injectMmap(hint, size uint64) (uint64, error) {
+	var regs sys.PtraceRegs
+	var err error
+	thread.dbp.execPtraceFunc(func() { err = sys.PtraceGetRegs(thread.ID, &regs) })
+	if err != nil {
+		return 0, err
+	}
+	savedRegs := regs
+	savedCode := make([]byte, 2)
+	if _, err := thread.ReadMemory(savedCode, uintptr(regs.Rip)); err != nil {
+		return 0, err
+	}
+	if _, err := thread.WriteMemory(uintptr(regs.Rip), []byte{0x0f, 0x05}); err != nil { // syscall
+		return 0, err
+	}
+
+	regs.Rax = sys.SYS_MMAP
+	regs.Rdi = hint
+	regs.Rsi = size
+	regs.Rdx = sys.PROT_READ | sys.PROT_WRITE | sys.PROT_EXEC
+	regs.R10 = sys.MAP_PRIVATE | sys.MAP_ANONYMOUS
+	regs.R8 = ^uint64(0)
+	regs.R9 = 0
+	// Do not restart the system call the thread could be stopped in.
+	regs.Orig_rax = ^uint64(0)
+	thread.dbp.execPtraceFunc(func() { err = sys.PtraceSetRegs(thread.ID, &regs) })
+	if err == nil {
+		err = thread.singleStep()
+	}
+	if err == nil {
+		thread.dbp.execPtraceFunc(func() { err = sys.PtraceGetRegs(thread.ID, &regs) })
+	}
+
+	var restoreErr error
+	if _, restoreErr = thread.WriteMemory(uintptr(savedRegs.Rip), savedCode); restoreErr == nil {
+		thread.dbp.execPtraceFunc(func() { restoreErr = sys.PtraceSetRegs(thread.ID, &savedRegs) })
+	}
+	if err != nil {
+		return 0, err
+	}
+	if restoreErr != nil {
+		return 0, restoreErr
+	}
+	if int64(regs.Rax) < 0 && int64(regs.Rax) > -4096 {
+		return 0, fmt.Errorf("could not allocate memory for predicates: %v", sys.Errno(-int64(regs.Rax)))
+	}
+	return regs.Rax, nil
+}
+
+// removePredicates restores the code replaced by the jumps to predicates,
+// moving the threads that are executing predicates out of them. Must be
+// called when all threads are stopped, before their breakpoints are set.
+func (dbp *nativeProcess) removePredicates() error {
+	installed := false
+	for _, pred := range dbp.predicates.m {
+		installed = installed || pred.installed
+	}
+	if !installed {
+		return nil
+	}
+	for _, th := range dbp.threads {
+		if err := dbp.leavePredicates(th); err != nil {
+			return err
+		}
+	}
+	thread := dbp.memoryThread()
+	for addr, pred := range dbp.predicates.m {
+		if !pred.installed {
+			continue
+		}
+		if _, err := thread.WriteMemory(uintptr(addr), pred.saved); err != nil {
+			return err
+		}
+		pred.installed = false
+	}
+	return nil
+}
+
+// leavePredicates moves th out of the code of predicates: a thread that
+// executed the breakpoint instruction of a predicate is moved after the
+// breakpoint it replaced, as if it had executed it, a thread that is about
+// to execute it is moved to the breakpoint and the other threads are made
+// to step until they leave the code.
+func (dbp *nativeProcess) leavePredicates(th *nativeThread) error {
+	for i := 0; ; i++ {
+		pc, err := th.PC()
+		if err != nil {
+			if err == sys.ESRCH {
+				// the thread exited
+				return nil
+			}
+			return err
+		}
+		var pred *predicate
+		for _, p := range dbp.predicates.m {
+			if p.code != 0 && pc >= p.code && pc < p.code+p.codeLen {
+				pred = p
+				break
+			}
+		}
+		switch {
+		case pred == nil:
+			return nil
+		case pc == pred.trap+uint64(len(dbp.bi.Arch.BreakpointInstruction())):
+			// the SIGTRAP could have been received while stepping
+			th.os.setbp = true
+			return th.SetPC(pred.p.Addr + uint64(len(dbp.bi.Arch.BreakpointInstruction())))
+		case pc == pred.trap:
+			return th.SetPC(pred.p.Addr)
+		case i >= predicateMaxSteps:
+			return fmt.Errorf("thread %d did not leave the predicate at %#x", th.ID, pred.code)
+		}
+		if err := th.singleStep(); err != nil {
+			return err
+		}
+	}
+}
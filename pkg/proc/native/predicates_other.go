@@ -0,0 +1,17 @@
+// +build !linux !amd64
+
+package native
+
+// predicateTable holds the predicates compiled from the conditions of the
+// breakpoints of the process, only supported on linux/amd64.
+type predicateTable struct{}
+
+// CompileConditions returns false, the conditions of breakpoints can only
+// be compiled on linux/amd64.
+func (dbp *nativeProcess) CompileConditions(enabled bool) bool {
+	return false
+}
+
+func (dbp *nativeProcess) installPredicates() error { return nil }
+
+func (dbp *nativeProcess) removePredicates() error { return nil }
@@ -34,6 +34,13 @@ type nativeProcess struct {
 	childProcess        bool // this process was launched, not attached to
 	manualStopRequested bool
 
+	// predicates compiled from the conditions of breakpoints, see
+	// CompileConditions.
+	predicates predicateTable
+	// displaced is the address of the memory used to step threads over
+	// breakpoints without stopping the process, see skipBreakpoint.
+	displaced uint64
+
 	// Controlling terminal file descriptor for
 	// this process.
 	ctty *os.File
@@ -244,14 +251,28 @@ func (dbp *nativeProcess) ContinueOnce() (proc.Thread, proc.StopReason, error) {
 		dbp.resumeChan = nil
 	}
 
-	trapthread, err := dbp.trapWait(-1)
-	if err != nil {
-		return nil, proc.StopUnknown, err
+	var trapthread *nativeThread
+	for {
+		var err error
+		trapthread, err = dbp.trapWait(-1)
+		if err != nil {
+			return nil, proc.StopUnknown, err
+		}
+		skipped, err := dbp.skipBreakpoint(trapthread)
+		if err != nil {
+			return nil, proc.StopUnknown, err
+		}
+		if !skipped {
+			break
+		}
 	}
 	if err := dbp.stop(trapthread); err != nil {
 		return nil, proc.StopUnknown, err
 	}
-	return trapthread, proc.StopUnknown, err
+	if trapthread.syscall != nil {
+		return trapthread, proc.StopSyscall, nil
+	}
+	return trapthread, proc.StopUnknown, nil
 }
 
 // FindBreakpoint finds the breakpoint for the given pc.
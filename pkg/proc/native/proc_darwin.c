@@ -45,7 +45,7 @@ acquire_mach_task(int tid,
 	if (kret != KERN_SUCCESS) return kret;
 
 	kret = task_set_exception_ports(*task, EXC_MASK_BREAKPOINT|EXC_MASK_SOFTWARE, *exception_port,
-			EXCEPTION_DEFAULT, THREAD_STATE_NONE);
+			EXCEPTION_DEFAULT|MACH_EXCEPTION_CODES, THREAD_STATE_NONE);
 	if (kret != KERN_SUCCESS) return kret;
 
 	// Allocate notification port to alert of when the process dies.
@@ -77,7 +77,7 @@ reset_exception_ports(task_t task, mach_port_t *exception_port, mach_port_t *not
 	mach_port_t self = mach_task_self();
 	
 	kret = task_set_exception_ports(task, EXC_MASK_BREAKPOINT|EXC_MASK_SOFTWARE, *exception_port,
-			EXCEPTION_DEFAULT, THREAD_STATE_NONE);
+			EXCEPTION_DEFAULT|MACH_EXCEPTION_CODES, THREAD_STATE_NONE);
 	if (kret != KERN_SUCCESS) return kret;
 	
 	kret = mach_port_request_notification(self, task, MACH_NOTIFY_DEAD_NAME, 0, *notification_port,
@@ -157,10 +157,14 @@ mach_port_wait(mach_port_t port_set, task_t *task, int nonblocking) {
 
 
 	switch (msg.hdr.msgh_id) {
-		case 2401: { // Exception
+		case 2401: // Exception
+		case 2405: { // Exception with 64bit codes
 			// 2401 is the exception_raise event, defined in:
 			// http://opensource.apple.com/source/xnu/xnu-2422.1.72/osfmk/mach/exc.defs?txt
-			// compile this file with mig to get the C version of the description
+			// 2405 is mach_exception_raise, sent by the kernel since the exception
+			// ports are set with MACH_EXCEPTION_CODES, defined in:
+			// http://opensource.apple.com/source/xnu/xnu-2422.1.72/osfmk/mach/mach_exc.defs?txt
+			// compile these files with mig to get the C version of the description
 			
 			mach_msg_body_t *bod = (mach_msg_body_t*)(&msg.hdr + 1);
 			mach_msg_port_descriptor_t *desc = (mach_msg_port_descriptor_t *)(bod + 1);
@@ -169,12 +173,19 @@ mach_port_wait(mach_port_t port_set, task_t *task, int nonblocking) {
 			ndr = (NDR_record_t *)(desc + 2);
 			data = (integer_t *)(ndr + 1);
 
+			// data[0] is the exception type, data[1] the number of codes
+			int64_t code[2] = { data[2], data[3] };
+			if (msg.hdr.msgh_id == 2405) {
+				// the message is packed, the 64bit codes are not aligned
+				memcpy(code, &data[2], sizeof(code));
+			}
+
 			if (thread_suspend(thread) != KERN_SUCCESS) return 0;
 			// Send our reply back so the kernel knows this exception has been handled.
 			kret = mach_send_reply(msg.hdr);
 			if (kret != MACH_MSG_SUCCESS) return 0;
-			if (data[2] == EXC_SOFT_SIGNAL) {
-				if (data[3] != SIGTRAP) {
+			if (code[0] == EXC_SOFT_SIGNAL) {
+				if (code[1] != SIGTRAP) {
 					if (thread_resume(thread) != KERN_SUCCESS) return 0;
 					return mach_port_wait(port_set, task, nonblocking);
 				}
@@ -13,11 +13,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"unsafe"
 
 	sys "golang.org/x/sys/unix"
 
 	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/pkg/proc/macutil"
 )
 
 // osProcessDetails holds Darwin specific information.
@@ -33,11 +35,18 @@ type osProcessDetails struct {
 	portSet C.mach_port_t
 }
 
+// ErrTaskForPid is returned when the mach task of the target could not be
+// acquired with task_for_pid.
+var ErrTaskForPid = errors.New("task_for_pid failed: dlv must be signed with the com.apple.security.cs.debugger entitlement (run 'dlv codesign'), developer mode must be enabled (run 'DevToolsSecurity -enable') and the target can not be protected by System Integrity Protection")
+
 // Launch creates and begins debugging a new process. Uses a
 // custom fork/exec process in order to take advantage of
 // PT_SIGEXC on Darwin which will turn Unix signals into
 // Mach exceptions.
-func Launch(cmd []string, wd string, foreground bool, _ []string, _ string, _ [3]string) (*proc.Target, error) {
+func Launch(cmd []string, wd string, foreground bool, _ []string, _ string, _ [3]string, sandbox *proc.Sandbox) (*proc.Target, error) {
+	if !sandbox.Empty() {
+		return nil, proc.ErrSandboxUnsupported
+	}
 	argv0Go, err := filepath.Abs(cmd[0])
 	if err != nil {
 		return nil, err
@@ -51,6 +60,13 @@ func Launch(cmd []string, wd string, foreground bool, _ []string, _ string, _ [3
 	if _, err := os.Stat(argv0Go); err != nil {
 		return nil, err
 	}
+	if macutil.Translated() {
+		return nil, macutil.ErrTranslated
+	}
+	if goarch, _ := macutil.ExecutableArch(argv0Go); goarch == "amd64" && runtime.GOARCH == "arm64" {
+		// the executable would be translated by Rosetta 2
+		return nil, macutil.ErrTranslated
+	}
 
 	argv0 := C.CString(argv0Go)
 	argvSlice := make([]*C.char, 0, len(cmd)+1)
@@ -74,6 +90,9 @@ func Launch(cmd []string, wd string, foreground bool, _ []string, _ string, _ [3
 			&dbp.os.notificationPort)
 		pid = int(ret)
 	})
+	if pid == C.fork_exec_task_for_pid_failed {
+		return nil, ErrTaskForPid
+	}
 	if pid <= 0 {
 		return nil, fmt.Errorf("could not fork/exec")
 	}
@@ -130,6 +149,9 @@ func Launch(cmd []string, wd string, foreground bool, _ []string, _ string, _ [3
 
 // Attach to an existing process with the given PID.
 func Attach(pid int, _ []string) (*proc.Target, error) {
+	if macutil.Translated() {
+		return nil, macutil.ErrTranslated
+	}
 	dbp := newProcess(pid)
 
 	kret := C.acquire_mach_task(C.int(pid),
@@ -137,7 +159,7 @@ func Attach(pid int, _ []string) (*proc.Target, error) {
 		&dbp.os.notificationPort)
 
 	if kret != C.KERN_SUCCESS {
-		return nil, fmt.Errorf("could not attach to %d", pid)
+		return nil, fmt.Errorf("could not attach to %d: %v", pid, ErrTaskForPid)
 	}
 
 	dbp.os.initialized = true
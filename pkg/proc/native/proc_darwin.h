@@ -1,6 +1,7 @@
 //+build darwin,macnative
 
 #include <sys/types.h>
+#include <string.h>
 #include <libproc.h>
 #include <mach/mach.h>
 #include <mach/mach_vm.h>
@@ -42,7 +42,10 @@ type osProcessDetails struct {
 // to be supplied to that process. `wd` is working directory of the program.
 // If the DWARF information cannot be found in the binary, Delve will look
 // for external debug files in the directories passed in.
-func Launch(cmd []string, wd string, foreground bool, debugInfoDirs []string, tty string, redirects [3]string) (*proc.Target, error) {
+func Launch(cmd []string, wd string, foreground bool, debugInfoDirs []string, tty string, redirects [3]string, sandbox *proc.Sandbox) (*proc.Target, error) {
+	if !sandbox.Empty() {
+		return nil, proc.ErrSandboxUnsupported
+	}
 	var (
 		process *exec.Cmd
 		err     error
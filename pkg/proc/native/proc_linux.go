@@ -9,12 +9,14 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"os/user"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
+	"unsafe"
 
 	sys "golang.org/x/sys/unix"
 
@@ -42,6 +44,16 @@ const (
 // process details.
 type osProcessDetails struct {
 	comm string
+
+	// followExec receives the children of the process when they call
+	// execve, see FollowExec.
+	followExec func(pid int, path string)
+	// forked are the children of the process that are traced until they
+	// call execve.
+	forked map[int]bool
+	// catchSyscalls are the numbers of the system calls caught, the threads
+	// only trace system calls if it is not nil, see CatchSyscalls.
+	catchSyscalls map[int]bool
 }
 
 // Launch creates and begins debugging a new process. First entry in
@@ -49,7 +61,9 @@ type osProcessDetails struct {
 // to be supplied to that process. `wd` is working directory of the program.
 // If the DWARF information cannot be found in the binary, Delve will look
 // for external debug files in the directories passed in.
-func Launch(cmd []string, wd string, foreground bool, debugInfoDirs []string, tty string, redirects [3]string) (*proc.Target, error) {
+// If sandbox is not nil the process is launched with its environment,
+// resource limits, credentials and namespaces.
+func Launch(cmd []string, wd string, foreground bool, debugInfoDirs []string, tty string, redirects [3]string, sandbox *proc.Sandbox) (*proc.Target, error) {
 	var (
 		process *exec.Cmd
 		err     error
@@ -95,6 +109,11 @@ func Launch(cmd []string, wd string, foreground bool, debugInfoDirs []string, tt
 		if wd != "" {
 			process.Dir = wd
 		}
+		if !sandbox.Empty() {
+			if err = setupSandbox(process, sandbox); err != nil {
+				return
+			}
+		}
 		err = process.Start()
 	})
 	closefn()
@@ -111,6 +130,13 @@ func Launch(cmd []string, wd string, foreground bool, debugInfoDirs []string, tt
 	if err != nil {
 		return nil, err
 	}
+	if !sandbox.Empty() {
+		// The process is stopped after execve, before executing any
+		// instruction of the program.
+		if err = setRlimits(dbp.pid, sandbox.Rlimits); err != nil {
+			return nil, err
+		}
+	}
 	return tgt, nil
 }
 
@@ -130,6 +156,7 @@ func Attach(pid int, debugInfoDirs []string) (*proc.Target, error) {
 		return nil, err
 	}
 
+	dbp.bi.Root = procRoot(pid)
 	execPath, err := findExecutable(pid)
 	if err != nil {
 		return nil, err
@@ -225,12 +252,12 @@ func (dbp *nativeProcess) addThread(tid int, attach bool) (*nativeThread, error)
 		}
 	}
 
-	dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, syscall.PTRACE_O_TRACECLONE) })
+	dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, dbp.ptraceOptions()) })
 	if err == syscall.ESRCH {
 		if _, _, err = dbp.waitFast(tid); err != nil {
 			return nil, fmt.Errorf("error while waiting after adding thread: %d %s", tid, err)
 		}
-		dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, syscall.PTRACE_O_TRACECLONE) })
+		dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, dbp.ptraceOptions()) })
 		if err == syscall.ESRCH {
 			return nil, err
 		}
@@ -250,6 +277,157 @@ func (dbp *nativeProcess) addThread(tid int, attach bool) (*nativeThread, error)
 	return dbp.threads[tid], nil
 }
 
+// ptraceOptions returns the ptrace options of the threads of the process.
+func (dbp *nativeProcess) ptraceOptions() int {
+	opts := syscall.PTRACE_O_TRACECLONE
+	if dbp.os.followExec != nil {
+		opts |= syscall.PTRACE_O_TRACEFORK | syscall.PTRACE_O_TRACEVFORK | syscall.PTRACE_O_TRACEEXEC
+	}
+	if dbp.os.catchSyscalls != nil {
+		opts |= syscall.PTRACE_O_TRACESYSGOOD
+	}
+	return opts
+}
+
+// setPtraceOptions updates the ptrace options of all the threads of the
+// process, see ptraceOptions.
+func (dbp *nativeProcess) setPtraceOptions() error {
+	for _, th := range dbp.threads {
+		var err error
+		dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(th.ID, dbp.ptraceOptions()) })
+		if err != nil {
+			return fmt.Errorf("could not set options of thread %d: %v", th.ID, err)
+		}
+	}
+	return nil
+}
+
+// FollowExec starts following the children of the process or, if fn is
+// nil, stops: the children are traced from their creation until they call
+// execve, then they are detached, left stopped by SIGSTOP, and passed to fn
+// with the path of their new executable. fn must resume them, with SIGCONT
+// or by attaching a debugger to them, and is called while the process is
+// being continued, it must not block.
+// The process must be stopped.
+func (dbp *nativeProcess) FollowExec(fn func(pid int, path string)) error {
+	dbp.os.followExec = fn
+	if dbp.os.forked == nil {
+		dbp.os.forked = make(map[int]bool)
+	}
+	return dbp.setPtraceOptions()
+}
+
+// CatchSyscalls starts catching the system calls in names or, if names is
+// empty, stops: while any system call is caught the threads are resumed
+// with PTRACE_SYSCALL, they stop at the entry and at the exit of every
+// system call and are resumed immediately unless it is caught.
+// The process must be stopped.
+func (dbp *nativeProcess) CatchSyscalls(names []string) error {
+	var catch map[int]bool
+	if len(names) > 0 {
+		catch = make(map[int]bool)
+		for _, name := range names {
+			nr, ok := linutil.SyscallNumber(dbp.bi.Arch.Name, name)
+			if !ok {
+				return fmt.Errorf("unknown system call %q", name)
+			}
+			catch[nr] = true
+		}
+	}
+	dbp.os.catchSyscalls = catch
+	for _, th := range dbp.threads {
+		th.os.inSyscall = false
+	}
+	return dbp.setPtraceOptions()
+}
+
+// syscallStop handles a syscall-stop of th, returns true if th entered or
+// returned from a caught system call, see CatchSyscalls.
+func (dbp *nativeProcess) syscallStop(th *nativeThread) (bool, error) {
+	var info ptraceSyscallInfo
+	var err error
+	dbp.execPtraceFunc(func() { err = ptraceGetSyscallInfo(th.ID, &info) })
+	if err != nil {
+		return false, fmt.Errorf("could not read the system call of thread %d, catching system calls requires Linux 5.3 or later: %v", th.ID, err)
+	}
+	var ev *proc.SyscallEvent
+	switch info.Op {
+	case ptraceSyscallInfoEntry:
+		th.os.inSyscall, th.os.syscallNr = true, int(info.Data[0])
+		ev = &proc.SyscallEvent{Number: th.os.syscallNr}
+		copy(ev.Args[:], info.Data[1:])
+	case ptraceSyscallInfoExit:
+		if !th.os.inSyscall {
+			// the entry was not traced, the system call is unknown
+			return false, nil
+		}
+		th.os.inSyscall = false
+		ev = &proc.SyscallEvent{Number: th.os.syscallNr, Exit: true, Ret: int64(info.Data[0]), IsError: uint8(info.Data[1]) != 0}
+	default:
+		return false, nil
+	}
+	if !dbp.os.catchSyscalls[ev.Number] {
+		return false, nil
+	}
+	ev.Name = linutil.SyscallName(dbp.bi.Arch.Name, ev.Number)
+	th.syscall = ev
+	return true, nil
+}
+
+// handleForkedStop handles a change of state of pid, which is not a thread
+// of the process: a child of the process traced until it calls execve, see
+// FollowExec.
+func (dbp *nativeProcess) handleForkedStop(pid int, status *sys.WaitStatus) {
+	var err error
+	switch {
+	case status.Exited() || status.Signaled():
+		delete(dbp.os.forked, pid)
+		return
+	case !status.Stopped():
+		return
+	case status.StopSignal() == sys.SIGTRAP && status.TrapCause() == sys.PTRACE_EVENT_EXEC:
+		delete(dbp.os.forked, pid)
+		path, err := findExecutable(pid)
+		fn := dbp.os.followExec
+		if err != nil || fn == nil {
+			dbp.execPtraceFunc(func() { err = ptraceDetach(pid, 0) })
+			return
+		}
+		// signals passed to PTRACE_DETACH are ignored at ptrace events, the
+		// SIGSTOP is pending until the child is detached.
+		if err := sys.Kill(pid, sys.SIGSTOP); err != nil {
+			return
+		}
+		dbp.execPtraceFunc(func() { err = ptraceDetach(pid, 0) })
+		if err == nil {
+			fn(pid, path)
+		}
+		return
+	case status.StopSignal() == sys.SIGTRAP && (status.TrapCause() == sys.PTRACE_EVENT_FORK || status.TrapCause() == sys.PTRACE_EVENT_VFORK):
+		// the child also created a child, which is traced as well
+		var child uint
+		dbp.execPtraceFunc(func() { child, err = sys.PtraceGetEventMsg(pid) })
+		if err == nil {
+			dbp.os.forked[int(child)] = true
+		}
+	}
+	dbp.os.forked[pid] = true
+	sig := 0
+	if status.StopSignal() != sys.SIGSTOP && status.StopSignal() != sys.SIGTRAP {
+		// the children are stopped by SIGSTOP when they start being traced
+		// and by SIGTRAP at ptrace events, other signals are delivered.
+		sig = int(status.StopSignal())
+	}
+	dbp.execPtraceFunc(func() { err = ptraceCont(pid, sig) })
+}
+
+// isThread returns true if pid is a thread of the process, possibly not
+// added yet.
+func (dbp *nativeProcess) isThread(pid int) bool {
+	_, err := os.Stat(fmt.Sprintf("/proc/%d/task/%d", dbp.pid, pid))
+	return err == nil
+}
+
 func (dbp *nativeProcess) updateThreadList() error {
 	tids, _ := filepath.Glob(fmt.Sprintf("/proc/%d/task/*", dbp.pid))
 	for _, tidpath := range tids {
@@ -265,11 +443,148 @@ func (dbp *nativeProcess) updateThreadList() error {
 	return linutil.ElfUpdateSharedObjects(dbp)
 }
 
+var rlimitResources = map[string]int{
+	"as":         sys.RLIMIT_AS,
+	"core":       sys.RLIMIT_CORE,
+	"cpu":        sys.RLIMIT_CPU,
+	"data":       sys.RLIMIT_DATA,
+	"fsize":      sys.RLIMIT_FSIZE,
+	"locks":      sys.RLIMIT_LOCKS,
+	"memlock":    sys.RLIMIT_MEMLOCK,
+	"msgqueue":   sys.RLIMIT_MSGQUEUE,
+	"nice":       sys.RLIMIT_NICE,
+	"nofile":     sys.RLIMIT_NOFILE,
+	"nproc":      sys.RLIMIT_NPROC,
+	"rss":        sys.RLIMIT_RSS,
+	"rtprio":     sys.RLIMIT_RTPRIO,
+	"sigpending": sys.RLIMIT_SIGPENDING,
+	"stack":      sys.RLIMIT_STACK,
+}
+
+var namespaceFlags = map[string]uintptr{
+	"cgroup": sys.CLONE_NEWCGROUP,
+	"ipc":    sys.CLONE_NEWIPC,
+	"mount":  sys.CLONE_NEWNS,
+	"net":    sys.CLONE_NEWNET,
+	"pid":    sys.CLONE_NEWPID,
+	"user":   sys.CLONE_NEWUSER,
+	"uts":    sys.CLONE_NEWUTS,
+}
+
+// setupSandbox configures the environment, the credentials and the
+// namespaces of process as specified by sandbox.
+func setupSandbox(process *exec.Cmd, sandbox *proc.Sandbox) error {
+	env, err := sandbox.Environ()
+	if err != nil {
+		return err
+	}
+	// A nil environment means the environment of Delve.
+	process.Env = append([]string{}, env...)
+
+	for _, r := range sandbox.Rlimits {
+		if _, ok := rlimitResources[r.Resource]; !ok {
+			return fmt.Errorf("unknown resource %q", r.Resource)
+		}
+	}
+
+	if sandbox.User != "" || sandbox.Group != "" {
+		cred, err := credential(sandbox.User, sandbox.Group)
+		if err != nil {
+			return err
+		}
+		process.SysProcAttr.Credential = cred
+	}
+
+	for _, ns := range sandbox.Namespaces {
+		flag, ok := namespaceFlags[ns]
+		if !ok {
+			return fmt.Errorf("unknown namespace %q", ns)
+		}
+		process.SysProcAttr.Cloneflags |= flag
+		if flag == sys.CLONE_NEWUSER {
+			// Maps the user and the group of Delve to themselves, so that the
+			// process keeps its privileges on their files.
+			uid, gid := os.Getuid(), os.Getgid()
+			if cred := process.SysProcAttr.Credential; cred != nil {
+				uid, gid = int(cred.Uid), int(cred.Gid)
+			}
+			process.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: os.Getuid(), Size: 1}}
+			process.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: os.Getgid(), Size: 1}}
+			process.SysProcAttr.Credential = nil
+		}
+	}
+	return nil
+}
+
+// credential returns the credentials of the user and the group called
+// username and groupname, or with those IDs. The group defaults to the
+// primary group of the user, the user to the user of Delve.
+func credential(username, groupname string) (*syscall.Credential, error) {
+	cred := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid()), NoSetGroups: true}
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			if u, err = user.LookupId(username); err != nil {
+				return nil, fmt.Errorf("unknown user %q", username)
+			}
+		}
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+	}
+	if groupname != "" {
+		g, err := user.LookupGroup(groupname)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupname); err != nil {
+				return nil, fmt.Errorf("unknown group %q", groupname)
+			}
+		}
+		gid, _ := strconv.ParseUint(g.Gid, 10, 32)
+		cred.Gid = uint32(gid)
+	}
+	return cred, nil
+}
+
+// setRlimits sets the resource limits of the process pid.
+func setRlimits(pid int, rlimits []proc.Rlimit) error {
+	for _, r := range rlimits {
+		lim := sys.Rlimit{Cur: r.Soft, Max: r.Hard}
+		_, _, errno := sys.RawSyscall6(sys.SYS_PRLIMIT64, uintptr(pid), uintptr(rlimitResources[r.Resource]), uintptr(unsafe.Pointer(&lim)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("could not set the limit of %s: %v", r.Resource, errno)
+		}
+	}
+	return nil
+}
+
 func findExecutable(pid int) (string, error) {
 	path := fmt.Sprintf("/proc/%d/exe", pid)
+	if root := procRoot(pid); root != "" {
+		// The path is relative to the root directory of the process.
+		exe, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(root, exe), nil
+	}
 	return filepath.EvalSymlinks(path)
 }
 
+// procRoot returns the root directory of the process pid, as seen by Delve,
+// if it runs in a different mount namespace, for example in a container.
+// Returns the empty string otherwise.
+func procRoot(pid int) string {
+	self, err := os.Readlink("/proc/self/ns/mnt")
+	if err != nil {
+		return ""
+	}
+	ns, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/mnt", pid))
+	if err != nil || ns == self {
+		return ""
+	}
+	return fmt.Sprintf("/proc/%d/root", pid)
+}
+
 func (dbp *nativeProcess) trapWait(pid int) (*nativeThread, error) {
 	return dbp.trapWaitInternal(pid, 0)
 }
@@ -302,6 +617,10 @@ func (dbp *nativeProcess) trapWaitInternal(pid int, options trapWaitOptions) (*n
 		if ok {
 			th.Status = (*waitStatus)(status)
 		}
+		if !ok && dbp.os.forked != nil && (dbp.os.forked[wpid] || !dbp.isThread(wpid)) {
+			dbp.handleForkedStop(wpid, status)
+			continue
+		}
 		if status.Exited() {
 			if wpid == dbp.pid {
 				dbp.postExit()
@@ -310,6 +629,23 @@ func (dbp *nativeProcess) trapWaitInternal(pid int, options trapWaitOptions) (*n
 			delete(dbp.threads, wpid)
 			continue
 		}
+		if status.StopSignal() == sys.SIGTRAP && (status.TrapCause() == sys.PTRACE_EVENT_FORK || status.TrapCause() == sys.PTRACE_EVENT_VFORK) && th != nil {
+			// A traced thread has created a child process, it is traced until
+			// it calls execve, see FollowExec.
+			var child uint
+			dbp.execPtraceFunc(func() { child, err = sys.PtraceGetEventMsg(wpid) })
+			if err == nil {
+				dbp.os.forked[int(child)] = true
+			}
+			if halt {
+				th.os.running = false
+				return nil, nil
+			}
+			if err = th.Continue(); err != nil && err != sys.ESRCH {
+				return nil, fmt.Errorf("could not continue thread %d after fork %s", wpid, err)
+			}
+			continue
+		}
 		if status.StopSignal() == sys.SIGTRAP && status.TrapCause() == sys.PTRACE_EVENT_CLONE {
 			// A traced thread has cloned a new thread, grab the pid and
 			// add it to our list of traced threads.
@@ -355,6 +691,27 @@ func (dbp *nativeProcess) trapWaitInternal(pid int, options trapWaitOptions) (*n
 			// Sometimes we get an unknown thread, ignore it?
 			continue
 		}
+		if status.StopSignal() == sys.SIGTRAP|0x80 {
+			// The thread entered or returned from a system call, see
+			// CatchSyscalls. While stopping the process the system calls are
+			// not caught, the threads are resumed until they receive SIGSTOP.
+			caught, err := dbp.syscallStop(th)
+			if err != nil {
+				return nil, err
+			}
+			if caught && !halt {
+				th.os.running = false
+				th.os.setbp = false
+				return th, nil
+			}
+			if err := th.resumeWithSig(0); err != nil {
+				if err == sys.ESRCH {
+					continue
+				}
+				return nil, err
+			}
+			continue
+		}
 		if (halt && status.StopSignal() == sys.SIGSTOP) || (status.StopSignal() == sys.SIGTRAP) {
 			th.os.running = false
 			if status.StopSignal() == sys.SIGTRAP {
@@ -465,6 +822,11 @@ func (dbp *nativeProcess) resume() error {
 			thread.CurrentBreakpoint.Clear()
 		}
 	}
+	if err := dbp.installPredicates(); err != nil {
+		dbp.removePredicates()
+		return err
+	}
+	dbp.allocDisplaced()
 	// everything is resumed
 	for _, thread := range dbp.threads {
 		if err := thread.resume(); err != nil && err != sys.ESRCH {
@@ -523,6 +885,10 @@ func (dbp *nativeProcess) stop(trapthread *nativeThread) (err error) {
 		}
 	}
 
+	if err := dbp.removePredicates(); err != nil {
+		return err
+	}
+
 	if err := linutil.ElfUpdateSharedObjects(dbp); err != nil {
 		return err
 	}
@@ -545,6 +911,11 @@ func (dbp *nativeProcess) detach(kill bool) error {
 			return err
 		}
 	}
+	for pid := range dbp.os.forked {
+		// the children that did not call execve yet may be gone
+		_ = ptraceDetach(pid, 0)
+	}
+	dbp.os.forked = nil
 	if kill {
 		return nil
 	}
@@ -21,7 +21,10 @@ type osProcessDetails struct {
 }
 
 // Launch creates and begins debugging a new process.
-func Launch(cmd []string, wd string, foreground bool, _ []string, _ string, redirects [3]string) (*proc.Target, error) {
+func Launch(cmd []string, wd string, foreground bool, _ []string, _ string, redirects [3]string, sandbox *proc.Sandbox) (*proc.Target, error) {
+	if !sandbox.Empty() {
+		return nil, proc.ErrSandboxUnsupported
+	}
 	argv0Go, err := filepath.Abs(cmd[0])
 	if err != nil {
 		return nil, err
@@ -2,6 +2,7 @@ package native
 
 import (
 	"syscall"
+	"unsafe"
 
 	sys "golang.org/x/sys/unix"
 )
@@ -24,3 +25,36 @@ func ptraceDetach(tid, sig int) error {
 func ptraceCont(tid, sig int) error {
 	return sys.PtraceCont(tid, sig)
 }
+
+// ptraceSyscall executes ptrace PTRACE_SYSCALL
+func ptraceSyscall(tid, sig int) error {
+	return sys.PtraceSyscall(tid, sig)
+}
+
+// Values of ptraceSyscallInfo.Op
+const (
+	ptraceSyscallInfoEntry = 1
+	ptraceSyscallInfoExit  = 2
+)
+
+// ptraceSyscallInfo is struct ptrace_syscall_info, Data is the nr and
+// args of its entry member, or the rval and is_error of the exit member.
+type ptraceSyscallInfo struct {
+	Op                 uint8
+	_                  [3]uint8
+	Arch               uint32
+	InstructionPointer uint64
+	StackPointer       uint64
+	Data               [7]uint64
+	_                  [2]uint32
+}
+
+// ptraceGetSyscallInfo executes ptrace PTRACE_GET_SYSCALL_INFO, available
+// since Linux 5.3.
+func ptraceGetSyscallInfo(tid int, info *ptraceSyscallInfo) error {
+	_, _, err := sys.Syscall6(sys.SYS_PTRACE, sys.PTRACE_GET_SYSCALL_INFO, uintptr(tid), unsafe.Sizeof(*info), uintptr(unsafe.Pointer(info)), 0, 0)
+	if err != syscall.Errno(0) {
+		return err
+	}
+	return nil
+}
@@ -5,7 +5,6 @@ package native
 // #include "threads_darwin.h"
 import "C"
 import (
-	"errors"
 	"fmt"
 	"unsafe"
 
@@ -39,6 +38,8 @@ type Regs struct {
 	gs     uint64
 	gsBase uint64
 	fpregs []proc.Register
+
+	fpstate []byte // contents of x86_float_state64_t, used by restoreRegisters
 }
 
 func (r *Regs) Slice(floatingPoint bool) ([]proc.Register, error) {
@@ -119,13 +120,29 @@ func (thread *nativeThread) SetPC(pc uint64) error {
 	return nil
 }
 
-// SetSP sets the RSP register to the value specified by `pc`.
+// SetSP sets the RSP register to the value specified by `sp`.
 func (thread *nativeThread) SetSP(sp uint64) error {
-	return errors.New("not implemented")
+	return thread.setRegister(func(state *C.x86_thread_state64_t) { state.__rsp = C.__uint64_t(sp) })
 }
 
+// SetDX sets the RDX register to the value specified by `dx`.
 func (thread *nativeThread) SetDX(dx uint64) error {
-	return errors.New("not implemented")
+	return thread.setRegister(func(state *C.x86_thread_state64_t) { state.__rdx = C.__uint64_t(dx) })
+}
+
+// setRegister changes the general purpose registers of thread with fn.
+func (thread *nativeThread) setRegister(fn func(*C.x86_thread_state64_t)) error {
+	var state C.x86_thread_state64_t
+	kret := C.get_registers(C.mach_port_name_t(thread.os.threadAct), &state)
+	if kret != C.KERN_SUCCESS {
+		return fmt.Errorf("could not get registers")
+	}
+	fn(&state)
+	kret = C.set_registers(C.mach_port_name_t(thread.os.threadAct), &state)
+	if kret != C.KERN_SUCCESS {
+		return fmt.Errorf("could not set registers")
+	}
+	return nil
 }
 
 func (r *Regs) Get(n int) (uint64, error) {
@@ -359,10 +376,49 @@ func registers(thread *nativeThread) (proc.Registers, error) {
 		regs.fpregs = proc.AppendBytesRegister(regs.fpregs, fmt.Sprintf("XMM%d", i), C.GoBytes(unsafe.Pointer(xmm), 16))
 	}
 
+	regs.fpstate = C.GoBytes(unsafe.Pointer(&fpstate), C.sizeof_x86_float_state64_t)
+
 	return regs, nil
 }
 
+// Copy returns a copy of these registers that is guaranteed not to change.
 func (r *Regs) Copy() (proc.Registers, error) {
-	//TODO(aarzilli): implement this to support function calls
-	return nil, nil
+	rr := *r
+	rr.fpregs = make([]proc.Register, len(r.fpregs))
+	copy(rr.fpregs, r.fpregs)
+	rr.fpstate = make([]byte, len(r.fpstate))
+	copy(rr.fpstate, r.fpstate)
+	return &rr, nil
+}
+
+func (t *nativeThread) restoreRegisters(savedRegs proc.Registers) error {
+	sr := savedRegs.(*Regs)
+	err := t.setRegister(func(state *C.x86_thread_state64_t) {
+		state.__rax = C.__uint64_t(sr.rax)
+		state.__rbx = C.__uint64_t(sr.rbx)
+		state.__rcx = C.__uint64_t(sr.rcx)
+		state.__rdx = C.__uint64_t(sr.rdx)
+		state.__rdi = C.__uint64_t(sr.rdi)
+		state.__rsi = C.__uint64_t(sr.rsi)
+		state.__rbp = C.__uint64_t(sr.rbp)
+		state.__rsp = C.__uint64_t(sr.rsp)
+		state.__r8 = C.__uint64_t(sr.r8)
+		state.__r9 = C.__uint64_t(sr.r9)
+		state.__r10 = C.__uint64_t(sr.r10)
+		state.__r11 = C.__uint64_t(sr.r11)
+		state.__r12 = C.__uint64_t(sr.r12)
+		state.__r13 = C.__uint64_t(sr.r13)
+		state.__r14 = C.__uint64_t(sr.r14)
+		state.__r15 = C.__uint64_t(sr.r15)
+		state.__rip = C.__uint64_t(sr.rip)
+		state.__rflags = C.__uint64_t(sr.rflags)
+	})
+	if err != nil || len(sr.fpstate) == 0 {
+		return err
+	}
+	kret := C.set_fpu_registers(C.mach_port_name_t(t.os.threadAct), (*C.x86_float_state64_t)(unsafe.Pointer(&sr.fpstate[0])))
+	if kret != C.KERN_SUCCESS {
+		return fmt.Errorf("could not set floating point registers")
+	}
+	return nil
 }
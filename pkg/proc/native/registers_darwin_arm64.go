@@ -0,0 +1,116 @@
+//+build darwin,macnative
+
+package native
+
+// #include "threads_darwin.h"
+import "C"
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/pkg/proc/linutil"
+)
+
+// The general purpose registers of arm64 have the same layout on macOS
+// and linux, the registers returned by thread_get_state are converted to
+// linutil.ARM64Registers.
+
+// SetPC sets the PC register to the value specified by `pc`.
+func (thread *nativeThread) SetPC(pc uint64) error {
+	kret := C.set_pc(thread.os.threadAct, C.uint64_t(pc))
+	if kret != C.KERN_SUCCESS {
+		return fmt.Errorf("could not set pc")
+	}
+	return nil
+}
+
+// SetSP sets the SP register to the value specified by `sp`.
+func (thread *nativeThread) SetSP(sp uint64) error {
+	return thread.setRegister(func(state *C.arm_thread_state64_t) { state.__sp = C.__uint64_t(sp) })
+}
+
+func (thread *nativeThread) SetDX(dx uint64) error {
+	return fmt.Errorf("not supported")
+}
+
+// setRegister changes the general purpose registers of thread with fn.
+func (thread *nativeThread) setRegister(fn func(*C.arm_thread_state64_t)) error {
+	var state C.arm_thread_state64_t
+	kret := C.get_registers(C.mach_port_name_t(thread.os.threadAct), &state)
+	if kret != C.KERN_SUCCESS {
+		return fmt.Errorf("could not get registers")
+	}
+	fn(&state)
+	kret = C.set_registers(C.mach_port_name_t(thread.os.threadAct), &state)
+	if kret != C.KERN_SUCCESS {
+		return fmt.Errorf("could not set registers")
+	}
+	return nil
+}
+
+func registers(thread *nativeThread) (proc.Registers, error) {
+	var state C.arm_thread_state64_t
+	kret := C.get_registers(C.mach_port_name_t(thread.os.threadAct), &state)
+	if kret != C.KERN_SUCCESS {
+		return nil, fmt.Errorf("could not get registers")
+	}
+	var regs linutil.ARM64PtraceRegs
+	for i := 0; i < len(state.__x); i++ {
+		regs.Regs[i] = uint64(state.__x[i])
+	}
+	regs.Regs[29] = uint64(state.__fp)
+	regs.Regs[30] = uint64(state.__lr)
+	regs.Sp = uint64(state.__sp)
+	regs.Pc = uint64(state.__pc)
+	regs.Pstate = uint64(state.__cpsr)
+
+	r := linutil.NewARM64Registers(&regs, func(r *linutil.ARM64Registers) error {
+		var floatLoadError error
+		r.Fpregs, r.Fpregset, floatLoadError = thread.fpRegisters()
+		return floatLoadError
+	})
+	return r, nil
+}
+
+// fpRegisters returns the NEON registers of the thread, decoded and as
+// the contents of arm_neon_state64_t.
+func (thread *nativeThread) fpRegisters() ([]proc.Register, []byte, error) {
+	var fpstate C.arm_neon_state64_t
+	kret := C.get_fpu_registers(C.mach_port_name_t(thread.os.threadAct), &fpstate)
+	if kret != C.KERN_SUCCESS {
+		return nil, nil, fmt.Errorf("could not get floating point registers")
+	}
+	fpregset := C.GoBytes(unsafe.Pointer(&fpstate), C.sizeof_arm_neon_state64_t)
+	arm_fpregs := linutil.ARM64PtraceFpRegs{
+		Vregs: fpregset[:unsafe.Sizeof(fpstate.__v)],
+		Fpsr:  uint32(fpstate.__fpsr),
+		Fpcr:  uint32(fpstate.__fpcr),
+	}
+	fpregs := arm_fpregs.Decode()
+	fpregs = proc.AppendUint64Register(fpregs, "FPSR", uint64(arm_fpregs.Fpsr))
+	fpregs = proc.AppendUint64Register(fpregs, "FPCR", uint64(arm_fpregs.Fpcr))
+	return fpregs, fpregset, nil
+}
+
+func (t *nativeThread) restoreRegisters(savedRegs proc.Registers) error {
+	sr := savedRegs.(*linutil.ARM64Registers)
+	err := t.setRegister(func(state *C.arm_thread_state64_t) {
+		for i := 0; i < len(state.__x); i++ {
+			state.__x[i] = C.__uint64_t(sr.Regs.Regs[i])
+		}
+		state.__fp = C.__uint64_t(sr.Regs.Regs[29])
+		state.__lr = C.__uint64_t(sr.Regs.Regs[30])
+		state.__sp = C.__uint64_t(sr.Regs.Sp)
+		state.__pc = C.__uint64_t(sr.Regs.Pc)
+		state.__cpsr = C.__uint32_t(sr.Regs.Pstate)
+	})
+	if err != nil || len(sr.Fpregset) == 0 {
+		return err
+	}
+	kret := C.set_fpu_registers(C.mach_port_name_t(t.os.threadAct), (*C.arm_neon_state64_t)(unsafe.Pointer(&sr.Fpregset[0])))
+	if kret != C.KERN_SUCCESS {
+		return fmt.Errorf("could not set floating point registers")
+	}
+	return nil
+}
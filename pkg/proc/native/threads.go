@@ -20,6 +20,9 @@ type nativeThread struct {
 	singleStepping bool
 	os             *osSpecificDetails
 	common         proc.CommonThread
+
+	// syscall is the system call the thread stopped at, see CatchSyscalls.
+	syscall *proc.SyscallEvent
 }
 
 // Continue the execution of this thread.
@@ -50,6 +53,7 @@ func (t *nativeThread) Continue() error {
 // Otherwise we simply execute the next instruction.
 func (t *nativeThread) StepInstruction() (err error) {
 	t.singleStepping = true
+	t.syscall = nil
 	defer func() {
 		t.singleStepping = false
 	}()
@@ -99,6 +103,12 @@ func (t *nativeThread) BinInfo() *proc.BinaryInfo {
 	return t.dbp.bi
 }
 
+// SyscallEvent returns the system call the thread stopped at, or nil if
+// it did not stop because of a caught system call.
+func (t *nativeThread) SyscallEvent() *proc.SyscallEvent {
+	return t.syscall
+}
+
 // Common returns information common across Process
 // implementations.
 func (t *nativeThread) Common() *proc.CommonThread {
@@ -128,7 +138,7 @@ func (t *nativeThread) SetCurrentBreakpoint(adjustPC bool) error {
 		}
 		t.CurrentBreakpoint = bp.CheckCondition(t)
 		if t.CurrentBreakpoint.Breakpoint != nil && t.CurrentBreakpoint.Active {
-			if g, err := proc.GetG(t); err == nil {
+			if g, err := proc.GetG(t); err == nil && g != nil {
 				t.CurrentBreakpoint.HitCount[g.ID]++
 			}
 			t.CurrentBreakpoint.TotalHitCount++
@@ -0,0 +1,75 @@
+//+build darwin,macnative
+
+#include "threads_darwin.h"
+
+kern_return_t
+get_registers(mach_port_name_t task, arm_thread_state64_t *state) {
+	mach_msg_type_number_t stateCount = ARM_THREAD_STATE64_COUNT;
+	return thread_get_state(task, ARM_THREAD_STATE64, (thread_state_t)state, &stateCount);
+}
+
+kern_return_t
+get_fpu_registers(mach_port_name_t task, arm_neon_state64_t *state) {
+	mach_msg_type_number_t stateCount = ARM_NEON_STATE64_COUNT;
+	return thread_get_state(task, ARM_NEON_STATE64, (thread_state_t)state, &stateCount);
+}
+
+kern_return_t
+set_registers(mach_port_name_t task, arm_thread_state64_t *state) {
+	mach_msg_type_number_t stateCount = ARM_THREAD_STATE64_COUNT;
+	return thread_set_state(task, ARM_THREAD_STATE64, (thread_state_t)state, stateCount);
+}
+
+kern_return_t
+set_fpu_registers(mach_port_name_t task, arm_neon_state64_t *state) {
+	mach_msg_type_number_t stateCount = ARM_NEON_STATE64_COUNT;
+	return thread_set_state(task, ARM_NEON_STATE64, (thread_state_t)state, stateCount);
+}
+
+kern_return_t
+set_pc(thread_act_t task, uint64_t pc) {
+	kern_return_t kret;
+	arm_thread_state64_t state;
+	mach_msg_type_number_t stateCount = ARM_THREAD_STATE64_COUNT;
+
+	kret = thread_get_state(task, ARM_THREAD_STATE64, (thread_state_t)&state, &stateCount);
+	if (kret != KERN_SUCCESS) return kret;
+	state.__pc = pc;
+
+	return thread_set_state(task, ARM_THREAD_STATE64, (thread_state_t)&state, stateCount);
+}
+
+// set_single_step sets or clears the software step bit (SS) of MDSCR_EL1,
+// the thread raises EXC_BREAKPOINT after executing one instruction.
+static kern_return_t
+set_single_step(thread_act_t thread, int enable) {
+	kern_return_t kret;
+	arm_debug_state64_t dbg;
+	mach_msg_type_number_t count = ARM_DEBUG_STATE64_COUNT;
+
+	kret = thread_get_state(thread, ARM_DEBUG_STATE64, (thread_state_t)&dbg, &count);
+	if (kret != KERN_SUCCESS) return kret;
+
+	if (enable) {
+		dbg.__mdscr_el1 |= 1UL;
+	} else {
+		dbg.__mdscr_el1 &= ~1UL;
+	}
+
+	return thread_set_state(thread, ARM_DEBUG_STATE64, (thread_state_t)&dbg, count);
+}
+
+kern_return_t
+single_step(thread_act_t thread) {
+	kern_return_t kret;
+
+	kret = set_single_step(thread, 1);
+	if (kret != KERN_SUCCESS) return kret;
+
+	return resume_thread(thread);
+}
+
+kern_return_t
+clear_trap_flag(thread_act_t thread) {
+	return set_single_step(thread, 0);
+}
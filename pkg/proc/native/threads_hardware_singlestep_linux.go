@@ -4,10 +4,22 @@ package native
 
 import (
 	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/pkg/proc/emulate"
 	sys "golang.org/x/sys/unix"
 )
 
 func (t *nativeThread) singleStep() (err error) {
+	if t.BinInfo().Arch.Name == "arm64" {
+		// Single stepping a sequence of exclusive loads and stores clears
+		// the exclusive monitor, the store would fail every time.
+		regs, err := t.Registers()
+		if err != nil {
+			return err
+		}
+		if atomic, _ := emulate.StartsAtomicSequence("arm64", regs, t); atomic {
+			return t.softwareSingleStep(regs)
+		}
+	}
 	for {
 		t.dbp.execPtraceFunc(func() { err = sys.PtraceSingleStep(t.ID) })
 		if err != nil {
@@ -6,6 +6,7 @@ import (
 	sys "golang.org/x/sys/unix"
 
 	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/pkg/proc/emulate"
 )
 
 type waitStatus sys.WaitStatus
@@ -17,6 +18,11 @@ type osSpecificDetails struct {
 	registers     sys.PtraceRegs
 	running       bool
 	setbp         bool
+
+	// inSyscall is true if the thread stopped at the entry of the system
+	// call syscallNr and did not return from it yet, see CatchSyscalls.
+	inSyscall bool
+	syscallNr int
 }
 
 func (t *nativeThread) stop() (err error) {
@@ -43,6 +49,11 @@ func (t *nativeThread) resume() error {
 
 func (t *nativeThread) resumeWithSig(sig int) (err error) {
 	t.os.running = true
+	t.syscall = nil
+	if t.dbp.os.catchSyscalls != nil {
+		t.dbp.execPtraceFunc(func() { err = ptraceSyscall(t.ID, sig) })
+		return
+	}
 	t.dbp.execPtraceFunc(func() { err = ptraceCont(t.ID, sig) })
 	return
 }
@@ -91,3 +102,72 @@ func (t *nativeThread) ReadMemory(data []byte, addr uintptr) (n int, err error)
 	}
 	return
 }
+
+// softwareSingleStep steps over the current instruction by setting a
+// breakpoint on each of the instructions that can be executed after it,
+// see package emulate, and resuming the thread. Used for the instructions
+// that ptrace can not single step.
+func (t *nativeThread) softwareSingleStep(regs proc.Registers) (err error) {
+	nextPcs, err := emulate.NextPCs(t.BinInfo().Arch.Name, regs, t)
+	if err != nil {
+		return err
+	}
+	originalDatas := make(map[uintptr][]byte)
+	// Do in batch, first set breakpoint, then continue.
+	t.dbp.execPtraceFunc(func() {
+		breakpointInstr := t.BinInfo().Arch.BreakpointInstruction()
+		readWriteMem := func(i int, addr uintptr, instr []byte) error {
+			originalData := make([]byte, len(breakpointInstr))
+			_, err = sys.PtracePeekData(t.ID, addr, originalData)
+			if err != nil {
+				return err
+			}
+			_, err = sys.PtracePokeData(t.ID, addr, instr)
+			if err != nil {
+				return err
+			}
+			// Everything is ok, store originalData
+			originalDatas[addr] = originalData
+			return nil
+		}
+		for i, nextPc := range nextPcs {
+			err = readWriteMem(i, uintptr(nextPc), breakpointInstr)
+			if err != nil {
+				return
+			}
+		}
+		err = ptraceCont(t.ID, 0)
+	})
+	// Make sure we restore before return.
+	defer func() {
+		// Update err.
+		t.dbp.execPtraceFunc(func() {
+			for addr, originalData := range originalDatas {
+				if originalData != nil {
+					_, err = sys.PtracePokeData(t.ID, addr, originalData)
+				}
+			}
+		})
+	}()
+	if err != nil {
+		return err
+	}
+	for {
+		// To be able to catch process exit, we can only use wait instead of waitFast.
+		wpid, status, err := t.dbp.wait(t.ID, 0)
+		if err != nil {
+			return err
+		}
+		if (status == nil || status.Exited()) && wpid == t.dbp.pid {
+			t.dbp.postExit()
+			rs := 0
+			if status != nil {
+				rs = status.ExitStatus()
+			}
+			return proc.ErrProcessExited{Pid: t.dbp.pid, Status: rs}
+		}
+		if wpid == t.ID && status.StopSignal() == sys.SIGTRAP {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package proc
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/gosym"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/dwarf/frame"
+)
+
+// The functions of an executable that do not have debug information, for
+// example the runtime of an executable whose debug information was
+// partially stripped, are described by the table that the Go runtime uses
+// for its own tracebacks, pclntab. They have a name, an address range and
+// line information, but no local variables.
+//
+// Executables built with -ldflags=-w have no debug information at all, they
+// are loaded using only pclntab: the functions can be used for breakpoints
+// and disassembly, and the size of their stack frames, which pclntab also
+// contains, is used to unwind the stack.
+
+// pclntabFunctionOffset is the DWARF offset of the functions read from
+// pclntab.
+const pclntabFunctionOffset = dwarf.Offset(^uint32(0))
+
+var errNoDebugInfoForFunction = errors.New("function has no debug information")
+
+// pclntab holds the parsed pclntab and symtab tables of an image.
+type pclntab struct {
+	table *gosym.Table
+	cu    *compileUnit // compile unit of the functions read from the table
+
+	// frames is used to read the size of the stack frames of the functions,
+	// it is nil if the format of the table is not supported.
+	frames *pclntabFrames
+}
+
+// Magic numbers of the versions of pclntab that contain the offsets of
+// its subtables in the header, see $GOROOT/src/runtime/symtab.go.
+const (
+	pclntabMagic116 = 0xfffffffa
+	pclntabMagic118 = 0xfffffff0
+	pclntabMagic120 = 0xfffffff1
+)
+
+// pclntabFrames reads the table of the stack pointer deltas (pcsp) of the
+// functions from a pclntab created by Go 1.16 or later.
+type pclntabFrames struct {
+	order     binary.ByteOrder
+	magic     uint32
+	quantum   uint64 // minimum instruction size
+	ptrSize   int
+	nfunc     int
+	textStart uint64 // unrelocated address of the text segment
+	pctab     []byte
+	functab   []byte // the function table, followed by the _func structs
+}
+
+// parsePclntabFrames parses the header of data, a pclntab, returns nil if
+// the version of the table is not supported.
+func parsePclntabFrames(data []byte, textStart uint64) *pclntabFrames {
+	if len(data) < 8 {
+		return nil
+	}
+	t := &pclntabFrames{quantum: uint64(data[6]), ptrSize: int(data[7]), textStart: textStart}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch magic := order.Uint32(data); magic {
+		case pclntabMagic116, pclntabMagic118, pclntabMagic120:
+			t.order, t.magic = order, magic
+		}
+	}
+	if t.order == nil || (t.ptrSize != 4 && t.ptrSize != 8) || t.quantum == 0 {
+		return nil
+	}
+	fields := 7
+	if t.magic != pclntabMagic116 {
+		// textStart was added after nfiles, it is not used because it could
+		// be unrelocated, like for debug/gosym.
+		fields = 8
+	}
+	if len(data) < 8+fields*t.ptrSize {
+		return nil
+	}
+	word := func(i int) uint64 { return t.uint(data[8+i*t.ptrSize:]) }
+	t.nfunc = int(word(0))
+	pctabOff, pclnOff := word(fields-2), word(fields-1)
+	if pctabOff > uint64(len(data)) || pclnOff > uint64(len(data)) {
+		return nil
+	}
+	t.pctab, t.functab = data[pctabOff:], data[pclnOff:]
+	if uint64(len(t.functab)) < uint64(t.nfunc+1)*uint64(t.functabEntrySize()) {
+		return nil
+	}
+	return t
+}
+
+func (t *pclntabFrames) uint(b []byte) uint64 {
+	if t.ptrSize == 4 {
+		return uint64(t.order.Uint32(b))
+	}
+	return t.order.Uint64(b)
+}
+
+// functabEntrySize returns the size of an entry of the function table.
+func (t *pclntabFrames) functabEntrySize() int {
+	if t.magic == pclntabMagic116 {
+		return 2 * t.ptrSize // entry and _func offset
+	}
+	return 8 // entry offset and _func offset, 32 bits each
+}
+
+// functabEntry returns the entry point and the offset of the _func
+// struct of the i-th function.
+func (t *pclntabFrames) functabEntry(i int) (uint64, uint64) {
+	b := t.functab[i*t.functabEntrySize():]
+	if t.magic == pclntabMagic116 {
+		return t.uint(b), t.uint(b[t.ptrSize:])
+	}
+	return t.textStart + uint64(t.order.Uint32(b)), uint64(t.order.Uint32(b[4:]))
+}
+
+// spDelta returns the difference between the stack pointer at the entry
+// point of the function containing pc, an unrelocated address, and the
+// stack pointer at pc.
+func (t *pclntabFrames) spDelta(pc uint64) (int64, bool) {
+	i := sort.Search(t.nfunc, func(i int) bool {
+		entry, _ := t.functabEntry(i + 1)
+		return pc < entry
+	})
+	if i >= t.nfunc {
+		return 0, false
+	}
+	entry, funcoff := t.functabEntry(i)
+	if pc < entry {
+		return 0, false
+	}
+	// The offset of pcsp in the _func struct follows the entry point (an
+	// address up to Go 1.17, an offset afterwards), nameOff, args and
+	// deferreturn.
+	pcspField := funcoff + 12 + 4
+	if t.magic == pclntabMagic116 {
+		pcspField = funcoff + uint64(t.ptrSize) + 12
+	}
+	if pcspField+4 > uint64(len(t.functab)) {
+		return 0, false
+	}
+	pcsp := uint64(t.order.Uint32(t.functab[pcspField:]))
+	if pcsp == 0 || pcsp >= uint64(len(t.pctab)) {
+		return 0, false
+	}
+	return pcValue(t.pctab[pcsp:], entry, pc, t.quantum)
+}
+
+// pcValue returns the value for targetpc in the pc-value table p of the
+// function starting at entry, see runtime.pcvalue.
+func pcValue(p []byte, entry, targetpc, quantum uint64) (int64, bool) {
+	val, pc := int64(-1), entry
+	for first := true; ; first = false {
+		uvdelta, n := binary.Uvarint(p)
+		if n <= 0 || (uvdelta == 0 && !first) {
+			return 0, false
+		}
+		p = p[n:]
+		if uvdelta&1 != 0 {
+			val += int64(^(uvdelta >> 1))
+		} else {
+			val += int64(uvdelta >> 1)
+		}
+		pcdelta, n := binary.Uvarint(p)
+		if n <= 0 {
+			return 0, false
+		}
+		p = p[n:]
+		pc += pcdelta * quantum
+		if targetpc < pc {
+			return val, true
+		}
+	}
+}
+
+// pclntabLoader reads the pclntab and symtab tables of an image and the
+// unrelocated address of its text segment. The tables are read only if
+// they are needed, by loadPclntabFunctions.
+type pclntabLoader func() (data, symtab []byte, textStart uint64, err error)
+
+var errNoPclntab = errors.New("no pclntab section")
+
+func pclntabLoaderElf(exe *elf.File) pclntabLoader {
+	return func() ([]byte, []byte, uint64, error) {
+		sec, text := exe.Section(".gopclntab"), exe.Section(".text")
+		if sec == nil || text == nil {
+			return nil, nil, 0, errNoPclntab
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		var symtab []byte
+		if sec := exe.Section(".gosymtab"); sec != nil {
+			symtab, _ = sec.Data()
+		}
+		return data, symtab, text.Addr, nil
+	}
+}
+
+func pclntabLoaderMacho(exe *macho.File) pclntabLoader {
+	return func() ([]byte, []byte, uint64, error) {
+		sec, text := exe.Section("__gopclntab"), exe.Section("__text")
+		if sec == nil || text == nil {
+			return nil, nil, 0, errNoPclntab
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		var symtab []byte
+		if sec := exe.Section("__gosymtab"); sec != nil {
+			symtab, _ = sec.Data()
+		}
+		return data, symtab, text.Addr, nil
+	}
+}
+
+// pclntabLoaderPE reads pclntab from the data between the symbols
+// runtime.pclntab and runtime.epclntab, since PE files do not have a
+// section for it.
+// Borrowed from https://golang.org/src/cmd/internal/objfile/pe.go
+func pclntabLoaderPE(exe *pe.File) pclntabLoader {
+	return func() ([]byte, []byte, uint64, error) {
+		start, err := findPESymbol(exe, "runtime.pclntab")
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		end, err := findPESymbol(exe, "runtime.epclntab")
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if start.SectionNumber != end.SectionNumber || end.Value < start.Value {
+			return nil, nil, 0, errNoPclntab
+		}
+		data, err := exe.Sections[start.SectionNumber-1].Data()
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		text := exe.Section(".text")
+		if uint32(len(data)) < end.Value || text == nil {
+			return nil, nil, 0, errNoPclntab
+		}
+		var imageBase uint64
+		switch opth := exe.OptionalHeader.(type) {
+		case *pe.OptionalHeader32:
+			imageBase = uint64(opth.ImageBase)
+		case *pe.OptionalHeader64:
+			imageBase = opth.ImageBase
+		}
+		return data[start.Value:end.Value], nil, imageBase + uint64(text.VirtualAddress), nil
+	}
+}
+
+// loadPclntabFunctions adds to bi.Functions the functions of image that
+// are in its pclntab but not in its debug information. This is only done
+// when the debug information of the runtime is missing, since otherwise
+// the functions without debug information are the ones written in C or
+// assembly, which pclntab does not describe either.
+func (bi *BinaryInfo) loadPclntabFunctions(image *Image) {
+	if image.loadPclntab == nil {
+		return
+	}
+	for i := range bi.Functions {
+		if fn := &bi.Functions[i]; fn.cu.image == image && strings.HasPrefix(fn.Name, "runtime.") {
+			return
+		}
+	}
+
+	tab, err := readPclntab(image)
+	if err != nil {
+		bi.logger.Warnf("could not read pclntab of %s: %v", image.Path, err)
+		return
+	}
+	if n := bi.addPclntabFunctions(image, tab); n > 0 {
+		bi.logger.Infof("debug information missing for %d functions of %s, using pclntab", n, image.Path)
+	}
+}
+
+// loadBinaryInfoPclntab loads image, an executable without debug
+// information, using only its pclntab.
+func (bi *BinaryInfo) loadBinaryInfoPclntab(image *Image, loader pclntabLoader) error {
+	image.loadPclntab = loader
+	tab, err := readPclntab(image)
+	if err != nil {
+		return err
+	}
+	bi.logger.Warnf("%s has no debug information, using pclntab", image.Path)
+	bi.addPclntabFunctions(image, tab)
+	bi.LookupFunc = make(map[string]*Function)
+	for i := range bi.Functions {
+		bi.LookupFunc[bi.Functions[i].Name] = &bi.Functions[i]
+	}
+	return nil
+}
+
+// readPclntab parses the pclntab of image.
+func readPclntab(image *Image) (*pclntab, error) {
+	data, symtab, textStart, err := image.loadPclntab()
+	if err != nil {
+		return nil, err
+	}
+	table, err := gosym.NewTable(symtab, gosym.NewLineTable(data, textStart))
+	if err != nil {
+		return nil, err
+	}
+	tab := &pclntab{table: table, frames: parsePclntabFrames(data, textStart)}
+	tab.cu = &compileUnit{name: "<pclntab>", isgo: true, image: image, offset: pclntabFunctionOffset}
+	return tab, nil
+}
+
+// addPclntabFunctions adds to bi.Functions the functions of tab, the
+// pclntab of image, that are not already in it. Returns the number of
+// functions added.
+func (bi *BinaryInfo) addPclntabFunctions(image *Image, tab *pclntab) int {
+	var fns []Function
+	for i := range tab.table.Funcs {
+		sym := &tab.table.Funcs[i]
+		entry, end := sym.Entry+image.StaticBase, sym.End+image.StaticBase
+		if bi.PCToFunc(entry) != nil {
+			continue
+		}
+		fns = append(fns, Function{Name: sym.Name, Entry: entry, End: end, offset: pclntabFunctionOffset, cu: tab.cu})
+	}
+	if len(fns) == 0 {
+		return 0
+	}
+	image.pclntab = tab
+	bi.Functions = append(bi.Functions, fns...)
+	sort.Sort(functionsDebugInfoByEntry(bi.Functions))
+	return len(fns)
+}
+
+// fromPclntab returns true if fn was read from pclntab and has no debug
+// information.
+func (fn *Function) fromPclntab() bool {
+	return fn.offset == pclntabFunctionOffset
+}
+
+// pclntabLine returns the file and line of pc, which must belong to fn, a
+// function read from pclntab.
+func (fn *Function) pclntabLine(pc uint64) (string, int) {
+	image := fn.cu.image
+	file, line, _ := image.pclntab.table.PCToLine(pc - image.StaticBase)
+	return file, line
+}
+
+// pclntabFrameContext returns the rules to unwind the stack frame of fn,
+// a function read from pclntab, at pc. Returns nil if the size of the
+// frame is not known or the return address is not pushed on the stack by
+// the call instructions of the architecture.
+func (fn *Function) pclntabFrameContext(pc uint64, arch *Arch) *frame.FrameContext {
+	image := fn.cu.image
+	var pcRegNum, spRegNum uint64
+	switch arch.Name {
+	case "amd64":
+		pcRegNum, spRegNum = amd64DwarfIPRegNum, amd64DwarfSPRegNum
+	case "386":
+		pcRegNum, spRegNum = i386DwarfIPRegNum, i386DwarfSPRegNum
+	default:
+		return nil
+	}
+	if image.pclntab.frames == nil {
+		return nil
+	}
+	spdelta, ok := image.pclntab.frames.spDelta(pc - image.StaticBase)
+	if !ok || spdelta < 0 {
+		return nil
+	}
+	ptrSize := int64(arch.PtrSize())
+	return &frame.FrameContext{
+		RetAddrReg: pcRegNum,
+		Regs: map[uint64]frame.DWRule{
+			pcRegNum: {Rule: frame.RuleOffset, Offset: -ptrSize},
+			spRegNum: {Rule: frame.RuleValOffset, Offset: 0},
+		},
+		CFA: frame.DWRule{Rule: frame.RuleCFA, Reg: spRegNum, Offset: spdelta + ptrSize},
+	}
+}
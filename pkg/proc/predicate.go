@@ -0,0 +1,425 @@
+package proc
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/dwarf/frame"
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	"github.com/go-delve/delve/pkg/dwarf/op"
+	"github.com/go-delve/delve/pkg/dwarf/reader"
+	"github.com/go-delve/delve/pkg/dwarf/util"
+	"github.com/go-delve/delve/pkg/goversion"
+)
+
+// Predicate is the condition of a breakpoint compiled to code that the
+// target executes instead of the breakpoint instruction, so that the
+// target only stops when the condition is true.
+// Backends that support predicates replace the code at Addr with a jump to
+// the code of the predicate (see Code) while the target is running, and
+// restore it when the target stops.
+// Only conditions comparing integer variables with constants, joined by
+// &&, can be compiled, see CompilePredicate.
+type Predicate struct {
+	Addr uint64 // Address of the breakpoint
+	// Len is the number of bytes of code at Addr replaced by the jump to the
+	// predicate: the predicate executes the instructions it replaces.
+	// No thread can be resumed between Addr and Addr+Len while the jump is
+	// written.
+	Len int
+
+	terms []predicateTerm
+	code  []byte // the instructions replaced by the jump
+}
+
+// predicateTerm is a comparison of a variable with a constant.
+type predicateTerm struct {
+	loc    predicateLoc
+	size   int
+	signed bool
+	op     token.Token
+	value  uint64
+}
+
+// predicateLoc is the location of a variable used by a predicate, as seen
+// by the instruction at the address of the breakpoint.
+type predicateLoc struct {
+	// reg is the DWARF number of the register containing the variable, or
+	// its address if mem is set. If reg is negative the address of the
+	// variable is off.
+	reg int
+	mem bool
+	off int64
+}
+
+// CompilePredicate compiles the condition of bp to a predicate, or returns
+// an error if the condition or the code at the address of bp are not
+// supported. The original code of the function containing bp is read from
+// mem, using the original data of the breakpoints in bpmap.
+// Only the amd64 architecture is supported.
+func CompilePredicate(bi *BinaryInfo, mem MemoryReader, bpmap *BreakpointMap, bp *Breakpoint) (*Predicate, error) {
+	if bi.Arch.Name != "amd64" {
+		return nil, &ErrUnsupportedOnArch{Operation: "predicates", Arch: bi.Arch.Name}
+	}
+	if bp.Kind != UserBreakpoint || bp.Cond == nil || bp.ErrorReturn {
+		return nil, errors.New("not a conditional user breakpoint")
+	}
+	fn := bi.PCToFunc(bp.Addr)
+	if fn == nil || fn.cu == nil || fn.fromPclntab() {
+		return nil, errors.New("no debug information for the function")
+	}
+	if inlfn := bi.PCToInlineFunc(bp.Addr); inlfn != nil && inlfn != fn {
+		return nil, errors.New("breakpoint inside an inlined call")
+	}
+	conds := splitAndCondition(bp.Cond, nil)
+	p := &Predicate{Addr: bp.Addr, terms: make([]predicateTerm, 0, len(conds))}
+	for _, cond := range conds {
+		term, err := compilePredicateTerm(bi, fn, bp.Addr, cond)
+		if err != nil {
+			return nil, err
+		}
+		p.terms = append(p.terms, term)
+	}
+	var err error
+	p.code, err = amd64PredicateRelocate(mem, bpmap, fn, bp.Addr)
+	if err != nil {
+		return nil, err
+	}
+	p.Len = len(p.code)
+	if _, _, err := p.Code(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// splitAndCondition returns the operands of the && operators of cond.
+func splitAndCondition(cond ast.Expr, conds []ast.Expr) []ast.Expr {
+	switch n := cond.(type) {
+	case *ast.ParenExpr:
+		return splitAndCondition(n.X, conds)
+	case *ast.BinaryExpr:
+		if n.Op == token.LAND {
+			return splitAndCondition(n.Y, splitAndCondition(n.X, conds))
+		}
+	}
+	return append(conds, cond)
+}
+
+// compilePredicateTerm compiles cond, which must compare an integer
+// variable with a constant.
+func compilePredicateTerm(bi *BinaryInfo, fn *Function, pc uint64, cond ast.Expr) (predicateTerm, error) {
+	for {
+		paren, ok := cond.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		cond = paren.X
+	}
+	bexpr, ok := cond.(*ast.BinaryExpr)
+	if !ok {
+		return predicateTerm{}, fmt.Errorf("unsupported expression %s", exprToString(cond))
+	}
+	x, y, op := bexpr.X, bexpr.Y, bexpr.Op
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+	default:
+		return predicateTerm{}, fmt.Errorf("unsupported operator %s", op)
+	}
+	val, ok := predicateConstant(y)
+	if !ok {
+		// constant <op> variable
+		if val, ok = predicateConstant(x); !ok {
+			return predicateTerm{}, fmt.Errorf("%s does not compare a variable with a constant", exprToString(cond))
+		}
+		x = y
+		switch op {
+		case token.LSS:
+			op = token.GTR
+		case token.LEQ:
+			op = token.GEQ
+		case token.GTR:
+			op = token.LSS
+		case token.GEQ:
+			op = token.LEQ
+		}
+	}
+
+	term := predicateTerm{op: op}
+	var typ godwarf.Type
+	var err error
+	term.loc, typ, err = predicateVariable(bi, fn, pc, x)
+	if err != nil {
+		return predicateTerm{}, err
+	}
+	// Like negotiateType only integer types, not characters or typedefs of
+	// integer types, can be compared with constants.
+	switch typ.(type) {
+	case *godwarf.IntType:
+		term.signed = true
+	case *godwarf.UintType:
+	default:
+		return predicateTerm{}, fmt.Errorf("%s is not an integer", exprToString(x))
+	}
+	term.size = int(typ.Size())
+	switch term.size {
+	case 1, 2, 4, 8:
+	default:
+		return predicateTerm{}, fmt.Errorf("unsupported size %d of %s", term.size, exprToString(x))
+	}
+	bits := uint(term.size * 8)
+	if term.signed {
+		n, exact := constant.Int64Val(val)
+		if !exact || (bits < 64 && (n < -1<<(bits-1) || n >= 1<<(bits-1))) {
+			return predicateTerm{}, fmt.Errorf("constant %s overflows %s", val, typ)
+		}
+		term.value = uint64(n)
+	} else {
+		n, exact := constant.Uint64Val(val)
+		if !exact || (bits < 64 && n >= 1<<bits) {
+			return predicateTerm{}, fmt.Errorf("constant %s overflows %s", val, typ)
+		}
+		term.value = n
+	}
+	return term, nil
+}
+
+// predicateConstant returns the value of expr if it is an integer
+// constant.
+func predicateConstant(expr ast.Expr) (constant.Value, bool) {
+	switch n := expr.(type) {
+	case *ast.ParenExpr:
+		return predicateConstant(n.X)
+	case *ast.BasicLit:
+		if n.Kind != token.INT && n.Kind != token.CHAR {
+			return nil, false
+		}
+		val := constant.MakeFromLiteral(n.Value, n.Kind, 0)
+		if val.Kind() == constant.Unknown {
+			return nil, false
+		}
+		return constant.ToInt(val), true
+	case *ast.UnaryExpr:
+		if n.Op != token.SUB && n.Op != token.ADD {
+			return nil, false
+		}
+		val, ok := predicateConstant(n.X)
+		if !ok {
+			return nil, false
+		}
+		return constant.UnaryOp(n.Op, val, 0), true
+	}
+	return nil, false
+}
+
+// predicateVariable returns the location and type of the local variable
+// or package variable expr at pc, resolving names like evalIdent does.
+func predicateVariable(bi *BinaryInfo, fn *Function, pc uint64, expr ast.Expr) (predicateLoc, godwarf.Type, error) {
+	switch n := expr.(type) {
+	case *ast.Ident:
+		loc, typ, found, err := predicateLocal(bi, fn, pc, n.Name)
+		if found || err != nil {
+			return loc, typ, err
+		}
+		return predicateGlobal(bi, fn.PackageName(), n.Name)
+	case *ast.SelectorExpr:
+		if pkg, ok := n.X.(*ast.Ident); ok {
+			if _, _, found, _ := predicateLocal(bi, fn, pc, pkg.Name); !found {
+				return predicateGlobal(bi, pkg.Name, n.Sel.Name)
+			}
+		}
+	}
+	return predicateLoc{}, nil, fmt.Errorf("unsupported expression %s", exprToString(expr))
+}
+
+func predicateLocal(bi *BinaryInfo, fn *Function, pc uint64, name string) (loc predicateLoc, typ godwarf.Type, found bool, err error) {
+	image := bi.funcToImage(fn)
+	dwarfTree, err := image.getDwarfTree(fn.offset)
+	if err != nil {
+		return predicateLoc{}, nil, false, err
+	}
+	variablesFlags := reader.VariablesOnlyVisible
+	if bi.Producer() != "" && goversion.ProducerAfterOrEqual(bi.Producer(), 1, 15) {
+		variablesFlags |= reader.VariablesTrustDeclLine
+	}
+	_, line, _ := bi.PCToLine(pc)
+
+	// Like Locals the innermost variable, declared last, shadows the others.
+	var entry *godwarf.Tree
+	var entryDepth, entryDeclLine int64
+	for _, v := range reader.Variables(dwarfTree, pc, line, variablesFlags) {
+		vname, _ := v.Val(dwarf.AttrName).(string)
+		if vname != name && vname != "&"+name {
+			continue
+		}
+		depth := int64(v.Depth)
+		if v.Tag == dwarf.TagFormalParameter && depth <= 1 {
+			depth = 0
+		}
+		declLine, _ := v.Val(dwarf.AttrDeclLine).(int64)
+		if entry != nil && (depth < entryDepth || (depth == entryDepth && declLine < entryDeclLine)) {
+			continue
+		}
+		entry, entryDepth, entryDeclLine = v.Tree, depth, declLine
+	}
+	if entry == nil {
+		return predicateLoc{}, nil, false, nil
+	}
+	if vname, _ := entry.Val(dwarf.AttrName).(string); vname != name {
+		return predicateLoc{}, nil, true, fmt.Errorf("%s escapes to the heap", name)
+	}
+	typ, err = predicateType(image, entry)
+	if err != nil {
+		return predicateLoc{}, nil, true, err
+	}
+	instr, _, err := bi.locationExpr(entry, dwarf.AttrLocation, pc)
+	if err != nil {
+		return predicateLoc{}, nil, true, err
+	}
+	loc, err = predicateLocation(bi, dwarfTree, image, pc, instr, typ.Size())
+	return loc, typ, true, err
+}
+
+// predicateGlobal returns the location and type of the package variable
+// pkgName.varName, see findGlobal.
+func predicateGlobal(bi *BinaryInfo, pkgName, varName string) (predicateLoc, godwarf.Type, error) {
+	names := make([]string, 0, len(bi.PackageMap[pkgName])+1)
+	for _, pkgPath := range bi.PackageMap[pkgName] {
+		names = append(names, pkgPath+"."+varName)
+	}
+	names = append(names, pkgName+"."+varName)
+	for _, name := range names {
+		for _, pkgvar := range bi.packageVars {
+			if pkgvar.name != name && !strings.HasSuffix(pkgvar.name, "/"+name) {
+				continue
+			}
+			if pkgvar.addr == pkgvar.cu.image.StaticBase {
+				return predicateLoc{}, nil, fmt.Errorf("unsupported location of %s", name)
+			}
+			rdr := pkgvar.cu.image.dwarfReader
+			rdr.Seek(pkgvar.offset)
+			entry, err := rdr.Next()
+			if err != nil {
+				return predicateLoc{}, nil, err
+			}
+			typ, err := predicateType(pkgvar.cu.image, entry)
+			if err != nil {
+				return predicateLoc{}, nil, err
+			}
+			return predicateLoc{reg: -1, mem: true, off: int64(pkgvar.addr)}, typ, nil
+		}
+	}
+	return predicateLoc{}, nil, fmt.Errorf("could not find symbol value for %s.%s", pkgName, varName)
+}
+
+func predicateType(image *Image, entry godwarf.Entry) (godwarf.Type, error) {
+	off, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+	if !ok {
+		return nil, errors.New("type attribute not found")
+	}
+	return image.Type(off)
+}
+
+// predicateLocation converts the location expression instr of a variable
+// of size bytes at pc to a predicateLoc. Only the operations supported by
+// op.ExecuteStackProgram that locate a variable in a register, at an
+// offset from the CFA or frame base, or at a fixed address are supported.
+func predicateLocation(bi *BinaryInfo, dwarfTree *godwarf.Tree, image *Image, pc uint64, instr []byte, size int64) (predicateLoc, error) {
+	errUnsupported := fmt.Errorf("unsupported location expression %s", (&locationExpr{isBlock: true, instr: instr}).String())
+	buf := bytes.NewBuffer(instr)
+	var loc predicateLoc
+	opcode, err := buf.ReadByte()
+	if err != nil {
+		return loc, errUnsupported
+	}
+	switch op.Opcode(opcode) {
+	case op.DW_OP_addr:
+		addr, err := util.ReadUintRaw(buf, binary.LittleEndian, bi.Arch.PtrSize())
+		if err != nil {
+			return loc, errUnsupported
+		}
+		loc = predicateLoc{reg: -1, mem: true, off: int64(addr + image.StaticBase)}
+	case op.DW_OP_call_frame_cfa:
+		loc, err = predicateCFA(bi, pc)
+		if err != nil {
+			return loc, err
+		}
+	case op.DW_OP_fbreg:
+		off, _ := util.DecodeSLEB128(buf)
+		fb, _, err := bi.locationExpr(dwarfTree.Entry, dwarf.AttrFrameBase, pc)
+		if err != nil {
+			return loc, err
+		}
+		switch {
+		case len(fb) == 1 && op.Opcode(fb[0]) == op.DW_OP_call_frame_cfa:
+			loc, err = predicateCFA(bi, pc)
+			if err != nil {
+				return loc, err
+			}
+		case len(fb) == 1 && op.Opcode(fb[0]) >= op.DW_OP_reg0 && op.Opcode(fb[0]) <= op.DW_OP_reg31:
+			loc = predicateLoc{reg: int(fb[0] - byte(op.DW_OP_reg0)), mem: true}
+		default:
+			return loc, fmt.Errorf("unsupported frame base %s", (&locationExpr{isBlock: true, instr: fb}).String())
+		}
+		loc.off += off
+	case op.DW_OP_regx:
+		n, _ := util.DecodeSLEB128(buf)
+		loc = predicateLoc{reg: int(n)}
+	default:
+		if op.Opcode(opcode) < op.DW_OP_reg0 || op.Opcode(opcode) > op.DW_OP_reg31 {
+			return loc, errUnsupported
+		}
+		loc = predicateLoc{reg: int(opcode - byte(op.DW_OP_reg0))}
+	}
+
+	for buf.Len() > 0 {
+		opcode, _ := buf.ReadByte()
+		switch op.Opcode(opcode) {
+		case op.DW_OP_consts:
+			// DW_OP_consts n DW_OP_plus
+			n, _ := util.DecodeSLEB128(buf)
+			if next, _ := buf.ReadByte(); !loc.mem || op.Opcode(next) != op.DW_OP_plus {
+				return loc, errUnsupported
+			}
+			loc.off += n
+		case op.DW_OP_plus_uconst:
+			n, _ := util.DecodeULEB128(buf)
+			if !loc.mem {
+				return loc, errUnsupported
+			}
+			loc.off += int64(n)
+		case op.DW_OP_piece:
+			// A single piece containing the whole variable.
+			n, _ := util.DecodeULEB128(buf)
+			if int64(n) != size || buf.Len() > 0 {
+				return loc, errUnsupported
+			}
+		default:
+			return loc, errUnsupported
+		}
+	}
+	if !loc.mem && size > int64(bi.Arch.PtrSize()) {
+		return loc, errUnsupported
+	}
+	return loc, nil
+}
+
+// predicateCFA returns the location of the CFA at pc, which must be at an
+// offset from a register.
+func predicateCFA(bi *BinaryInfo, pc uint64) (predicateLoc, error) {
+	fde, err := bi.frameEntries.FDEForPC(pc)
+	if err != nil {
+		return predicateLoc{}, err
+	}
+	framectx := bi.Arch.fixFrameUnwindContext(fde.EstablishFrame(pc), pc, bi)
+	if framectx.CFA.Rule != frame.RuleCFA {
+		return predicateLoc{}, fmt.Errorf("unsupported CFA rule at %#x", pc)
+	}
+	return predicateLoc{reg: int(framectx.CFA.Reg), mem: true, off: framectx.CFA.Offset}, nil
+}
@@ -1,11 +1,24 @@
 package proc
 
 import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 	"unsafe"
 
+	"golang.org/x/arch/x86/x86asm"
+
+	"github.com/go-delve/delve/pkg/astutil"
 	protest "github.com/go-delve/delve/pkg/proc/test"
 )
 
@@ -113,8 +126,667 @@ func TestDwarfVersion(t *testing.T) {
 	bi := NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
 	assertNoError(bi.LoadBinaryInfo(fixture.Path, 0, nil), t, "LoadBinaryInfo")
 	for _, cu := range bi.Images[0].compileUnits {
-		if cu.Version != 4 {
+		// Go 1.25 and later emit DWARFv5 by default.
+		if cu.Version != 4 && cu.Version != 5 {
 			t.Errorf("compile unit %q at %#x has bad version %d", cu.name, cu.entry.Offset, cu.Version)
 		}
 	}
 }
+
+func TestExecutableOS(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	goos, err := ExecutableOS(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if goos != runtime.GOOS {
+		t.Errorf("ExecutableOS(%q) = %q, want %q", exe, goos, runtime.GOOS)
+	}
+
+	dir, err := ioutil.TempDir("", "executableos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, tc := range []struct {
+		magic string
+		goos  string
+	}{
+		{"MZ\x90\x00", "windows"},
+		{"\xcf\xfa\xed\xfe", "darwin"},
+		{"\xca\xfe\xba\xbe", "darwin"},
+		{"#!/bin/sh", ""},
+	} {
+		path := filepath.Join(dir, "exe")
+		if err := ioutil.WriteFile(path, []byte(tc.magic), 0600); err != nil {
+			t.Fatal(err)
+		}
+		goos, err := ExecutableOS(path)
+		if goos != tc.goos || (err == nil) != (tc.goos != "") {
+			t.Errorf("ExecutableOS(%q) = %q, %v, want %q", tc.magic, goos, err, tc.goos)
+		}
+	}
+}
+
+func TestSourceIsStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sourceisstale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte("package main\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	built := time.Now()
+	if err := os.Chtimes(src, built.Add(-time.Hour), built.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	image := &Image{}
+	bi := &BinaryInfo{lastModified: built, Images: []*Image{image}}
+
+	if bi.SourceIsStale(src) {
+		t.Error("unmodified source reported as stale")
+	}
+	if bi.SourceIsStale(filepath.Join(dir, "missing.go")) {
+		t.Error("missing source reported as stale")
+	}
+	image.sourceLengths = map[string]uint64{src: 100}
+	if bi.SourceIsStale(src) {
+		t.Error("result of SourceIsStale not remembered until the target is resumed")
+	}
+	bi.clearStaleSources()
+	if !bi.SourceIsStale(src) {
+		t.Error("source with a different length not reported as stale")
+	}
+	image.sourceLengths[src] = uint64(len("package main\n"))
+	bi.clearStaleSources()
+	if bi.SourceIsStale(src) {
+		t.Error("source with the same length reported as stale")
+	}
+	if err := os.Chtimes(src, built.Add(time.Hour), built.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	bi.clearStaleSources()
+	if !bi.SourceIsStale(src) {
+		t.Error("source modified after the build not reported as stale")
+	}
+}
+
+func TestSplitDwarf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("split DWARF is only supported on linux")
+	}
+	if !splitDwarfSupported {
+		t.Skip("split DWARF needs Go 1.14 or later")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	dir, err := ioutil.TempDir("", "splitdwarf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sources := map[string]string{
+		"main.c":   "int helper(int);\nint main(void) {\n\treturn helper(1);\n}\n",
+		"helper.c": "struct point { int x, y; };\nint helper(int a) {\n\tstruct point p = {a, a};\n\treturn p.x + p.y;\n}\n",
+	}
+	for name, src := range sources {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("gcc", "-c", "-g", "-gdwarf-5", "-gsplit-dwarf", "-O0", name)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("gcc does not support split DWARF: %v\n%s", err, out)
+		}
+	}
+	exe := filepath.Join(dir, "prog")
+	cmd := exec.Command("gcc", "-no-pie", "-o", exe, "main.o", "helper.o")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	check := func(descr string) {
+		bi := NewBinaryInfo("linux", runtime.GOARCH)
+		if err := bi.LoadBinaryInfo(exe, 0, nil); err != nil {
+			t.Fatalf("%s: %v", descr, err)
+		}
+		fn := bi.LookupFunc["C.helper"]
+		if fn == nil {
+			t.Fatalf("%s: function of split unit not found", descr)
+		}
+		if !fn.cu.image.IsSplitDwarf() || fn.cu.name != filepath.Join(dir, "helper.c") {
+			t.Errorf("%s: wrong compile unit %q", descr, fn.cu.name)
+		}
+		if file, line, _ := bi.PCToLine(fn.Entry); file != filepath.Join(dir, "helper.c") || line != 2 {
+			t.Errorf("%s: wrong position of function entry %s:%d", descr, file, line)
+		}
+		if _, err := bi.findType("C.point"); err != nil {
+			t.Errorf("%s: type of split unit not found: %v", descr, err)
+		}
+	}
+	check("dwo")
+
+	dwp, err := exec.LookPath("llvm-dwp")
+	if err != nil {
+		if dwp, err = exec.LookPath("dwp"); err != nil {
+			return
+		}
+	}
+	cmd = exec.Command(dwp, "-e", exe, "-o", exe+".dwp")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("could not create DWARF package: %v\n%s", err, out)
+		return
+	}
+	for name := range sources {
+		os.Remove(filepath.Join(dir, name[:len(name)-len(".c")]+".dwo"))
+	}
+	check("dwp")
+}
+
+func TestCompressedDebugSections(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("compressed debug sections are only supported on linux")
+	}
+	if _, err := exec.LookPath("objcopy"); err != nil {
+		t.Skip("objcopy not found")
+	}
+	fixture := protest.BuildFixture("math", 0)
+	dir, err := ioutil.TempDir("", "compresseddebug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, kind := range []string{"zlib-gnu", "zlib-gabi", "zstd"} {
+		exe := filepath.Join(dir, kind)
+		if out, err := exec.Command("objcopy", "--compress-debug-sections="+kind, fixture.Path, exe).CombinedOutput(); err != nil {
+			t.Logf("objcopy does not support %s: %v\n%s", kind, err, out)
+			continue
+		}
+		bi := NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
+		if err := bi.LoadBinaryInfo(exe, 0, nil); err != nil {
+			t.Errorf("%s: %v", kind, err)
+			continue
+		}
+		if bi.LookupFunc["main.main"] == nil {
+			t.Errorf("%s: main.main not found", kind)
+		}
+		if len(bi.Sources) == 0 {
+			t.Errorf("%s: no line tables", kind)
+		}
+	}
+}
+
+func TestIndexCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "indexcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("DELVE_INDEX_CACHE", os.Getenv("DELVE_INDEX_CACHE"))
+	os.Setenv("DELVE_INDEX_CACHE", dir)
+	defer func(old int) { indexCacheMinSize = old }(indexCacheMinSize)
+	indexCacheMinSize = 0
+
+	fixture := protest.BuildFixture("testinline", protest.EnableInlining)
+	load := func() *BinaryInfo {
+		bi := NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
+		if err := bi.LoadBinaryInfo(fixture.Path, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+		if bi.Images[0].BuildID == "" {
+			t.Skip("executable does not have a build ID")
+		}
+		return bi
+	}
+
+	walked := load()
+	if fis, _ := ioutil.ReadDir(dir); len(fis) != 1 {
+		t.Fatalf("wrong number of cache entries %d", len(fis))
+	}
+	cached := load()
+
+	for _, bi := range []*BinaryInfo{walked, cached} {
+		for _, cu := range bi.Images[0].compileUnits {
+			if cu.lineInfo != nil {
+				t.Fatalf("line table of %s loaded eagerly", cu.name)
+			}
+		}
+	}
+
+	if len(walked.Functions) != len(cached.Functions) {
+		t.Fatalf("wrong number of functions %d %d", len(walked.Functions), len(cached.Functions))
+	}
+	for i := range walked.Functions {
+		fn1, fn2 := &walked.Functions[i], &cached.Functions[i]
+		if fn1.Name != fn2.Name || fn1.Entry != fn2.Entry || fn1.End != fn2.End || fn1.offset != fn2.offset || len(fn1.InlinedCalls) != len(fn2.InlinedCalls) || fn1.cu.name != fn2.cu.name {
+			t.Errorf("function mismatch %#v %#v", fn1, fn2)
+		}
+	}
+	if !reflect.DeepEqual(walked.Sources, cached.Sources) {
+		t.Errorf("sources mismatch")
+	}
+	if !reflect.DeepEqual(walked.types, cached.types) {
+		t.Errorf("types mismatch")
+	}
+	if !reflect.DeepEqual(walked.PackageMap, cached.PackageMap) {
+		t.Errorf("package map mismatch")
+	}
+	if !reflect.DeepEqual(walked.inlinedCallLines, cached.inlinedCallLines) {
+		t.Errorf("inlined call lines mismatch")
+	}
+	if len(walked.packageVars) != len(cached.packageVars) {
+		t.Errorf("wrong number of package variables %d %d", len(walked.packageVars), len(cached.packageVars))
+	}
+
+	pcs1, err1 := walked.LineToPC(fixture.Source, 7)
+	pcs2, err2 := cached.LineToPC(fixture.Source, 7)
+	if err1 != nil || err2 != nil || !reflect.DeepEqual(pcs1, pcs2) {
+		t.Errorf("LineToPC mismatch %v %v %v %v", pcs1, err1, pcs2, err2)
+	}
+	file, ln, fn := cached.PCToLine(cached.LookupFunc["main.main"].Entry)
+	if file != fixture.Source || ln != 15 || fn.Name != "main.main" {
+		t.Errorf("PCToLine(main.main) = %s:%d", file, ln)
+	}
+
+	entries, err := IndexCacheEntries()
+	if err != nil || len(entries) != 1 || entries[0].BuildID != cached.Images[0].BuildID || entries[0].Path != fixture.Path {
+		t.Fatalf("IndexCacheEntries() = %v, %v", entries, err)
+	}
+
+	// A corrupted entry is replaced.
+	path := filepath.Join(dir, entries[0].BuildID+indexCacheSuffix)
+	if err := ioutil.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if bi := load(); len(bi.Functions) != len(walked.Functions) {
+		t.Errorf("wrong number of functions after invalidation %d", len(bi.Functions))
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() == int64(len("garbage")) {
+		t.Errorf("corrupted entry not replaced: %v", err)
+	}
+
+	if n, err := RemoveIndexCache([]string{entries[0].BuildID}); n != 1 || err != nil {
+		t.Errorf("RemoveIndexCache() = %d, %v", n, err)
+	}
+	if entries, _ := IndexCacheEntries(); len(entries) != 0 {
+		t.Errorf("entries not removed: %v", entries)
+	}
+}
+
+func TestPclntabFunctions(t *testing.T) {
+	// Simulates an executable without the debug information of the runtime
+	// by removing the runtime functions read from it.
+	fixture := protest.BuildFixture("testnextprog", 0)
+	bi := NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
+	if err := bi.LoadBinaryInfo(fixture.Path, 0, nil); err != nil {
+		t.Fatalf("LoadBinaryInfo: %v", err)
+	}
+	defer bi.Close()
+
+	if err := bi.checkFeature(FeatureGoroutines); err != nil {
+		t.Errorf("goroutines not available with the debug information of the runtime: %v", err)
+	}
+
+	mainfn := bi.LookupFunc["runtime.main"]
+	if mainfn == nil {
+		t.Fatal("could not find runtime.main")
+	}
+	entry, end := mainfn.Entry, mainfn.End
+	file, line, _ := bi.PCToLine(entry)
+
+	fns := bi.Functions[:0]
+	for _, fn := range bi.Functions {
+		if !strings.HasPrefix(fn.Name, "runtime.") {
+			fns = append(fns, fn)
+		}
+	}
+	bi.Functions = fns
+	bi.loadPclntabFunctions(bi.Images[0])
+
+	file2, line2, fn := bi.PCToLine(entry)
+	if fn == nil || fn.Name != "runtime.main" || !fn.fromPclntab() {
+		t.Fatalf("wrong function for %#x: %v", entry, fn)
+	}
+	if file2 != file || line2 != line {
+		t.Errorf("wrong position for %#x: %s:%d, expected %s:%d", entry, file2, line2, file, line)
+	}
+	// pclntab includes the padding after the function in its range.
+	if fn.Entry != entry || fn.End < end {
+		t.Errorf("wrong address range for runtime.main: %#x-%#x, expected %#x-%#x", fn.Entry, fn.End, entry, end)
+	}
+	if _, err := fn.cu.image.getDwarfTree(fn.offset); err != errNoDebugInfoForFunction {
+		t.Errorf("getDwarfTree of a pclntab function returned %v", err)
+	}
+}
+
+func TestPclntabOnly(t *testing.T) {
+	// Executables without debug information are loaded from pclntab.
+	load := func(flags protest.BuildFlags) *BinaryInfo {
+		fixture := protest.BuildFixture("testnextprog", flags)
+		bi := NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
+		if err := bi.LoadBinaryInfo(fixture.Path, 0, nil); err != nil {
+			t.Fatalf("LoadBinaryInfo: %v", err)
+		}
+		return bi
+	}
+	full := load(0)
+	defer full.Close()
+	bi := load(protest.LinkStripDWARF)
+	defer bi.Close()
+	if bi.Images[0].dwarf != nil {
+		t.Fatal("executable built with -ldflags=-w has debug information")
+	}
+	if err := bi.checkFeature(FeatureVariables); err == nil {
+		t.Error("variables available without debug information")
+	}
+
+	for _, name := range []string{"main.main", "main.helloworld", "runtime.main"} {
+		fn, fullfn := bi.LookupFunc[name], full.LookupFunc[name]
+		if fn == nil || fullfn == nil {
+			t.Fatalf("could not find %s: %v %v", name, fn, fullfn)
+		}
+		if fn.Entry != fullfn.Entry {
+			t.Errorf("%s: wrong entry point %#x, expected %#x", name, fn.Entry, fullfn.Entry)
+		}
+		file, line, _ := bi.PCToLine(fn.Entry)
+		file2, line2, _ := full.PCToLine(fn.Entry)
+		if file != file2 || line != line2 {
+			t.Errorf("%s: wrong position %s:%d, expected %s:%d", name, file, line, file2, line2)
+		}
+
+		if bi.Arch.Name != "amd64" && bi.Arch.Name != "386" {
+			continue
+		}
+		// The size of the frames in pclntab must match .debug_frame.
+		for pc := fullfn.Entry; pc < fullfn.End; pc++ {
+			fde, err := full.frameEntries.FDEForPC(pc)
+			if err != nil {
+				t.Fatalf("%s: no frame descriptor for %#x: %v", name, pc, err)
+			}
+			fctxt := fde.EstablishFrame(pc)
+			pctxt := fn.pclntabFrameContext(pc, bi.Arch)
+			if pctxt == nil {
+				t.Fatalf("%s: no frame size for %#x", name, pc)
+			}
+			if pctxt.CFA.Offset != fctxt.CFA.Offset {
+				t.Errorf("%s: wrong CFA offset at %#x: %d, expected %d", name, pc, pctxt.CFA.Offset, fctxt.CFA.Offset)
+			}
+		}
+	}
+}
+
+func TestRuntimeDescriptors(t *testing.T) {
+	descs := append(RuntimeDescriptors(), RuntimeDescriptor{
+		GoVersion: "1.12",
+		Structs:   map[string]map[string]string{"runtime.g": {"goid": "id"}},
+	})
+	for _, tc := range []struct {
+		producer   string
+		stkbar     string
+		goid       string
+		minTopHash int64
+	}{
+		{"", "stkbar", "goid", 4},
+		{"Go cmd/compile go1.8.3", "stkbar", "goid", 4},
+		{"Go cmd/compile go1.11", "", "goid", 4},
+		{"Go cmd/compile go1.14.2", "", "id", 5},
+		{"Go cmd/compile devel +f3b4e78516", "", "id", 5},
+	} {
+		desc := mergeRuntimeDescriptors(descs, tc.producer)
+		if stkbar := desc.structs["runtime.g"]["stkbar"]; stkbar != tc.stkbar {
+			t.Errorf("%q: stkbar field %q, expected %q", tc.producer, stkbar, tc.stkbar)
+		}
+		if goid := desc.structs["runtime.g"]["goid"]; goid != tc.goid {
+			t.Errorf("%q: goid field %q, expected %q", tc.producer, goid, tc.goid)
+		}
+		if minTopHash := desc.consts["runtime.minTopHash"]; minTopHash != tc.minTopHash {
+			t.Errorf("%q: minTopHash %d, expected %d", tc.producer, minTopHash, tc.minTopHash)
+		}
+		if sched := desc.structs["runtime.g"]["sched"]; sched != "sched" {
+			t.Errorf("%q: sched field %q", tc.producer, sched)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "runtime-descriptors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(descs []RuntimeDescriptor) {
+		userRuntimeDescriptors = descs
+	}(userRuntimeDescriptors)
+
+	for _, tc := range []struct {
+		desc string
+		err  string
+	}{
+		{`[{"go": "1.99", "structs": {"runtime.g": {"goid": "id"}}, "consts": {"runtime.emptyOne": 2}}]`, ""},
+		{`[{"go": "1.99.1"}]`, "malformed Go version"},
+		{`[{"structs": {"runtime.x": {"goid": "id"}}}]`, "unknown structure runtime.x"},
+		{`[{"structs": {"runtime.g": {"id": "goid"}}}]`, "unknown field id of runtime.g"},
+		{`[{"consts": {"runtime.bucketCnt": 8}}]`, "unknown constant runtime.bucketCnt"},
+		{`{}`, "could not parse"},
+	} {
+		path := filepath.Join(dir, "descriptors.json")
+		if err := ioutil.WriteFile(path, []byte(tc.desc), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := LoadRuntimeDescriptors(path)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.desc, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected error %q got %v", tc.desc, tc.err, err)
+		}
+	}
+	if n := len(RuntimeDescriptors()) - len(builtinRuntimeDescriptors); n != 1 {
+		t.Errorf("%d descriptors loaded, expected 1", n)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	os.Setenv("DELVE_SANDBOX_TEST_A", "a")
+	os.Setenv("DELVE_SANDBOX_TEST_B", "b")
+	defer os.Unsetenv("DELVE_SANDBOX_TEST_A")
+	defer os.Unsetenv("DELVE_SANDBOX_TEST_B")
+
+	lookup := func(env []string, name string) (string, bool) {
+		for _, kv := range env {
+			if strings.HasPrefix(kv, name+"=") {
+				return kv[len(name)+1:], true
+			}
+		}
+		return "", false
+	}
+
+	for _, tc := range []struct {
+		sb   Sandbox
+		a, b string // "" if the variable is not expected
+		c    string
+	}{
+		{Sandbox{}, "a", "b", ""},
+		{Sandbox{EnvMode: EnvInherit, Env: []string{"DELVE_SANDBOX_TEST_A=x", "DELVE_SANDBOX_TEST_C=c"}}, "x", "b", "c"},
+		{Sandbox{EnvMode: EnvClear, Env: []string{"DELVE_SANDBOX_TEST_C=c"}}, "", "", "c"},
+		{Sandbox{EnvMode: EnvAllowlist, EnvAllow: []string{"DELVE_SANDBOX_TEST_B"}}, "", "b", ""},
+	} {
+		env, err := tc.sb.Environ()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, expected := range map[string]string{"DELVE_SANDBOX_TEST_A": tc.a, "DELVE_SANDBOX_TEST_B": tc.b, "DELVE_SANDBOX_TEST_C": tc.c} {
+			value, ok := lookup(env, name)
+			if ok != (expected != "") || value != expected {
+				t.Errorf("%#v: %s=%q (%v), expected %q", tc.sb, name, value, ok, expected)
+			}
+		}
+	}
+	if _, err := (&Sandbox{Env: []string{"NOVALUE"}}).Environ(); err == nil {
+		t.Error("no error for a malformed variable")
+	}
+	if !(&Sandbox{EnvMode: EnvInherit}).Empty() || (&Sandbox{User: "nobody"}).Empty() {
+		t.Error("wrong result of Empty")
+	}
+
+	for _, tc := range []struct {
+		in  string
+		out Rlimit
+		err bool
+	}{
+		{"nofile=1024", Rlimit{"nofile", 1024, 1024}, false},
+		{"NOFILE=1024:4096", Rlimit{"nofile", 1024, 4096}, false},
+		{"core=unlimited", Rlimit{"core", RlimInfinity, RlimInfinity}, false},
+		{"as=0x1000:unlimited", Rlimit{"as", 0x1000, RlimInfinity}, false},
+		{"nofile=4096:1024", Rlimit{}, true},
+		{"nofile", Rlimit{}, true},
+		{"=1", Rlimit{}, true},
+		{"nofile=many", Rlimit{}, true},
+	} {
+		out, err := ParseRlimit(tc.in)
+		if (err != nil) != tc.err || out != tc.out {
+			t.Errorf("ParseRlimit(%q) = %v %v, expected %v (error: %v)", tc.in, out, err, tc.out, tc.err)
+		}
+	}
+}
+
+func TestBreakpointStatsRate(t *testing.T) {
+	var s BreakpointStats
+	for i := 0; i < HotBreakpointRate; i++ {
+		if s.add(time.Now(), false) {
+			t.Fatalf("hot after %d evaluations", i+1)
+		}
+	}
+	if !s.add(time.Now(), true) || !s.Hot() || s.add(time.Now(), false) {
+		t.Fatal("hot breakpoint not reported exactly once")
+	}
+	if s.CondEvals != HotBreakpointRate+2 || s.FalseHits != HotBreakpointRate+1 || s.MaxRate != HotBreakpointRate+2 {
+		t.Fatalf("wrong statistics %#v", s)
+	}
+}
+
+func TestPredicateCode(t *testing.T) {
+	p := &Predicate{
+		Addr: 0x401000,
+		terms: []predicateTerm{
+			{loc: predicateLoc{reg: 5}, size: 4, signed: true, op: token.EQL, value: 25000},
+			{loc: predicateLoc{reg: 7, mem: true, off: 8}, size: 2, op: token.LSS, value: 10},
+			{loc: predicateLoc{reg: -1, mem: true, off: 0x601000}, size: 8, signed: true, op: token.GEQ, value: ^uint64(0)},
+		},
+		code: []byte{0x55, 0x48, 0x89, 0xe5, 0x89, 0x7d, 0xfc}, // push rbp; mov rbp, rsp; mov [rbp-4], edi
+	}
+	p.Len = len(p.code)
+	code, trap, err := p.Code()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code[trap] != 0xcc {
+		t.Fatalf("no breakpoint instruction at %d", trap)
+	}
+	var ops []x86asm.Op
+	for pc := 0; pc < len(code); {
+		inst, err := x86asm.Decode(code[pc:], 64)
+		if err != nil {
+			t.Fatalf("could not decode instruction at %d: %v", pc, err)
+		}
+		ops = append(ops, inst.Op)
+		if inst.Op == x86asm.JMP {
+			pc += 8 // address of the indirect jump
+		}
+		pc += inst.Len
+	}
+	jccs, jmps := 0, 0
+	for _, op := range ops {
+		switch op {
+		case x86asm.JNE, x86asm.JAE, x86asm.JL:
+			jccs++
+		case x86asm.JMP:
+			jmps++
+		}
+	}
+	if jccs != len(p.terms) || jmps != 2 {
+		t.Fatalf("wrong jumps in %v", ops)
+	}
+
+	jmp, err := p.Jump(p.Addr + 0x1000)
+	if err != nil || len(jmp) != amd64PredicateJumpLen || jmp[0] != 0xe9 {
+		t.Fatalf("wrong jump %x %v", jmp, err)
+	}
+	if _, err := p.Jump(p.Addr + 1<<32); err == nil {
+		t.Fatal("jump out of range accepted")
+	}
+}
+
+type sliceMemory struct {
+	base uint64
+	data []byte
+}
+
+func (mem *sliceMemory) ReadMemory(data []byte, addr uintptr) (int, error) {
+	if uint64(addr) < mem.base || uint64(addr)-mem.base >= uint64(len(mem.data)) {
+		return 0, fmt.Errorf("read out of bounds %#x", addr)
+	}
+	return copy(data, mem.data[uint64(addr)-mem.base:]), nil
+}
+
+func TestDisplacedInstruction(t *testing.T) {
+	bi := NewBinaryInfo("linux", "amd64")
+	mem := &sliceMemory{base: 0x401000, data: []byte{
+		0xcc, 0x8d, 0x0c, 0x00, // lea rcx, [rax+rax*1] with a breakpoint
+		0xcc, 0x01, 0x05, 0x10, 0x00, 0x00, 0x00, // add [rip+0x10], eax with a breakpoint
+		0xcc, 0x08, 0x00, 0x00, 0x00, // call with a breakpoint
+	}}
+	for _, tc := range []struct {
+		addr, displaced uint64
+		orig            byte
+		out             []byte
+	}{
+		{0x401000, 0x500000, 0x48, []byte{0x48, 0x8d, 0x0c, 0x00}},
+		{0x401004, 0x400000, 0x48, []byte{0x48, 0x01, 0x05, 0x14, 0x10, 0x00, 0x00}},
+		{0x401004, 0x401004 + 1<<32, 0x48, nil},
+		{0x40100b, 0x500000, 0xe8, nil},
+	} {
+		bp := &Breakpoint{Addr: tc.addr, OriginalData: []byte{tc.orig}}
+		out, err := DisplacedInstruction(bi, mem, bp, tc.displaced)
+		if tc.out == nil {
+			if err == nil {
+				t.Errorf("instruction at %#x moved to %#x: %x", tc.addr, tc.displaced, out)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(out, tc.out) {
+			t.Errorf("instruction at %#x moved to %#x: %x %v, expected %x", tc.addr, tc.displaced, out, err, tc.out)
+		}
+	}
+}
+
+func TestGoroutineCondition(t *testing.T) {
+	g := &G{ID: 7}
+	frame := &Stackframe{}
+	for _, tc := range []struct {
+		cond ast.Expr
+		out  string
+	}{
+		{nil, ""},
+		{frameoffCondition(frame), ""},
+		{sameGoroutineCondition(g), "runtime.curg.goid == 7"},
+		{astutil.And(sameGoroutineCondition(g), frameoffCondition(frame)), "runtime.curg.goid == 7"},
+		{astutil.And(sameGoroutineCondition(g), astutil.Or(frameoffCondition(frame), frameoffCondition(frame))), "runtime.curg.goid == 7"},
+	} {
+		out := ""
+		if cond := goroutineCondition(tc.cond); cond != nil {
+			out = exprToString(cond)
+		}
+		if out != tc.out {
+			t.Errorf("goroutine clause of %s: %q, expected %q", exprToString(tc.cond), out, tc.out)
+		}
+	}
+}
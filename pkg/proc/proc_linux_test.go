@@ -4,8 +4,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 
+	"github.com/go-delve/delve/pkg/proc"
 	"github.com/go-delve/delve/pkg/proc/native"
 	protest "github.com/go-delve/delve/pkg/proc/test"
 )
@@ -14,7 +17,7 @@ func TestLoadingExternalDebugInfo(t *testing.T) {
 	fixture := protest.BuildFixture("locationsprog", 0)
 	defer os.Remove(fixture.Path)
 	stripAndCopyDebugInfo(fixture, t)
-	p, err := native.Launch(append([]string{fixture.Path}, ""), "", false, []string{filepath.Dir(fixture.Path)}, "", [3]string{})
+	p, err := native.Launch(append([]string{fixture.Path}, ""), "", false, []string{filepath.Dir(fixture.Path)}, "", [3]string{}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -37,3 +40,73 @@ func stripAndCopyDebugInfo(f protest.Fixture, t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestFollowExec(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	withTestProcess("followexec", t, func(p *proc.Target, fixture protest.Fixture) {
+		var children []int
+		assertNoError(p.FollowExec(func(pid int, path string) {
+			if path != fixture.Path {
+				t.Errorf("wrong executable of child %d: %s", pid, path)
+			}
+			children = append(children, pid)
+			syscall.Kill(pid, syscall.SIGCONT)
+		}), t, "FollowExec()")
+		err := p.Continue()
+		if _, exited := err.(proc.ErrProcessExited); !exited {
+			t.Fatalf("expected the target to exit: %v", err)
+		}
+		if len(children) != 2 || children[0] == children[1] {
+			t.Fatalf("wrong children %v", children)
+		}
+	})
+}
+
+func TestCatchSyscalls(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	withTestProcess("catchsyscalls", t, func(p *proc.Target, fixture protest.Fixture) {
+		assertNoError(p.CatchSyscalls([]string{"openat", "connect"}), t, "CatchSyscalls()")
+		var openTid int
+		var openRet, connectAddr string
+		for i := 0; i < 100 && (openRet == "" || connectAddr == ""); i++ {
+			assertNoError(p.Continue(), t, "Continue()")
+			if p.StopReason != proc.StopSyscall {
+				t.Fatalf("wrong stop reason %v", p.StopReason)
+			}
+			th := p.CurrentThread()
+			ev := proc.ThreadSyscallEvent(th)
+			if ev == nil {
+				t.Fatalf("no system call on thread %d", th.ThreadID())
+			}
+			args := proc.FormatSyscallArgs(th, ev)
+			t.Logf("thread %d: %#v %v %s", th.ThreadID(), ev, args, proc.FormatSyscallRet(ev))
+			switch {
+			case ev.Name == "openat" && !ev.Exit && args[1] == `"/nonexistent/catchsyscalls"`:
+				if args[0] != "AT_FDCWD" || !strings.HasPrefix(args[2], "O_RDONLY") {
+					t.Errorf("wrong arguments of openat %v", args)
+				}
+				openTid = th.ThreadID()
+			case ev.Name == "openat" && ev.Exit && th.ThreadID() == openTid && openRet == "":
+				if !ev.IsError || ev.Ret != -int64(syscall.ENOENT) {
+					t.Errorf("wrong value returned by openat %#v", ev)
+				}
+				openRet = proc.FormatSyscallRet(ev)
+			case ev.Name == "connect" && !ev.Exit && openRet != "":
+				connectAddr = args[1]
+			}
+		}
+		if openRet == "" || !strings.HasPrefix(connectAddr, "127.0.0.1:") {
+			t.Fatalf("system calls not caught, openat returned %q, connect address %q", openRet, connectAddr)
+		}
+
+		assertNoError(p.CatchSyscalls(nil), t, "CatchSyscalls(nil)")
+		err := p.Continue()
+		if _, exited := err.(proc.ErrProcessExited); !exited {
+			t.Fatalf("expected the target to exit: %v", err)
+		}
+	})
+}
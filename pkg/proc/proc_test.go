@@ -31,7 +31,7 @@ import (
 	protest "github.com/go-delve/delve/pkg/proc/test"
 )
 
-var normalLoadConfig = proc.LoadConfig{true, 1, 64, 64, -1, 0}
+var normalLoadConfig = proc.LoadConfig{true, 1, 64, 64, -1, 0, nil}
 var testBackend, buildMode string
 
 func init() {
@@ -50,7 +50,7 @@ func TestMain(m *testing.M) {
 		fmt.Fprintf(os.Stderr, "unknown build mode %q", buildMode)
 		os.Exit(1)
 	}
-	logflags.Setup(logConf != "", logConf, "")
+	logflags.Setup(logConf != "", logConf, "", "")
 	os.Exit(protest.RunTestsWithFixtures(m))
 }
 
@@ -69,7 +69,7 @@ func withTestProcessArgs(name string, t testing.TB, wd string, args []string, bu
 
 	switch testBackend {
 	case "native":
-		p, err = native.Launch(append([]string{fixture.Path}, args...), wd, false, []string{}, "", [3]string{})
+		p, err = native.Launch(append([]string{fixture.Path}, args...), wd, false, []string{}, "", [3]string{}, nil)
 	case "lldb":
 		p, err = gdbserial.LLDBLaunch(append([]string{fixture.Path}, args...), wd, false, []string{}, "", [3]string{})
 	case "rr":
@@ -1447,6 +1447,30 @@ func TestBreakpointCounts(t *testing.T) {
 	})
 }
 
+func TestBreakpointStats(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("bpcountstest", t, func(p *proc.Target, fixture protest.Fixture) {
+		bp := setFileBreakpoint(p, t, fixture.Source, 12)
+		bp.Cond = &ast.BinaryExpr{
+			Op: token.EQL,
+			X:  &ast.Ident{Name: "i"},
+			Y:  &ast.BasicLit{Kind: token.INT, Value: "50"},
+		}
+		assertNoError(p.Continue(), t, "Continue()")
+		// Each goroutine evaluates the condition for i from 0 to 50, the
+		// first one to reach 50 stops the target.
+		if bp.Stats.CondEvals < 51 || bp.Stats.CondEvals > 101 {
+			t.Fatalf("wrong number of evaluations %d", bp.Stats.CondEvals)
+		}
+		if bp.Stats.FalseHits != bp.Stats.CondEvals-1 {
+			t.Fatalf("wrong number of false hits %d of %d", bp.Stats.FalseHits, bp.Stats.CondEvals)
+		}
+		if bp.Stats.CondTime <= 0 || bp.Stats.MaxRate == 0 || bp.Stats.MaxRate > bp.Stats.CondEvals {
+			t.Fatalf("wrong statistics %#v", bp.Stats)
+		}
+	})
+}
+
 func BenchmarkArray(b *testing.B) {
 	// each bencharr struct is 128 bytes, bencharr is 64 elements long
 	b.SetBytes(int64(64 * 128))
@@ -1905,6 +1929,48 @@ func TestPanicBreakpoint(t *testing.T) {
 	})
 }
 
+func TestExitBreakpoint(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("issue1101", t, func(p *proc.Target, fixture protest.Fixture) {
+		p.SetExitBreakpoints()
+		assertNoError(p.Continue(), t, "Continue()")
+		bp := p.CurrentThread().Breakpoint()
+		if bp.Breakpoint == nil || bp.Name != proc.OSExit {
+			t.Fatalf("not on os-exit breakpoint: %v", bp)
+		}
+		if code, _ := constant.Int64Val(evalVariable(p, t, "code").Value); code != 2 {
+			t.Fatalf("wrong exit code %d", code)
+		}
+	})
+}
+
+func TestLogFatalBreakpoint(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("logfatal", t, func(p *proc.Target, fixture protest.Fixture) {
+		p.SetExitBreakpoints()
+		n := 0
+		ids := map[int]bool{}
+		for _, bp := range p.Breakpoints().M {
+			if bp.Name == proc.LogFatal {
+				ids[bp.LogicalID] = true
+				n++
+			}
+		}
+		// log.Fatalln and (*log.Logger).Fatalf, at least, are linked.
+		if n < 2 || len(ids) != 1 {
+			t.Fatalf("log-fatal breakpoint set at %d addresses with logical IDs %v", n, ids)
+		}
+		assertNoError(p.Continue(), t, "Continue()")
+		bp := p.CurrentThread().Breakpoint()
+		if bp.Breakpoint == nil || bp.Name != proc.LogFatal {
+			t.Fatalf("not on log-fatal breakpoint: %v", bp)
+		}
+		if loc, _ := p.CurrentThread().Location(); loc.Fn == nil || loc.Fn.Name != "log.(*Logger).Fatalf" {
+			t.Fatalf("wrong location %v", loc)
+		}
+	})
+}
+
 func TestCmdLineArgs(t *testing.T) {
 	expectSuccess := func(p *proc.Target, fixture protest.Fixture) {
 		err := p.Continue()
@@ -2102,7 +2168,7 @@ func TestUnsupportedArch(t *testing.T) {
 
 	switch testBackend {
 	case "native":
-		p, err = native.Launch([]string{outfile}, ".", false, []string{}, "", [3]string{})
+		p, err = native.Launch([]string{outfile}, ".", false, []string{}, "", [3]string{}, nil)
 	case "lldb":
 		p, err = gdbserial.LLDBLaunch([]string{outfile}, ".", false, []string{}, "", [3]string{})
 	default:
@@ -2677,7 +2743,7 @@ func BenchmarkTrace(b *testing.B) {
 			assertNoError(p.Continue(), b, "Continue()")
 			s, err := proc.GoroutineScope(p.CurrentThread())
 			assertNoError(err, b, "Scope()")
-			_, err = s.FunctionArguments(proc.LoadConfig{false, 0, 64, 0, 3, 0})
+			_, err = s.FunctionArguments(proc.LoadConfig{false, 0, 64, 0, 3, 0, nil})
 			assertNoError(err, b, "FunctionArguments()")
 		}
 		b.StopTimer()
@@ -4068,6 +4134,168 @@ func TestStepOutReturn(t *testing.T) {
 	})
 }
 
+func TestNextReturnValues(t *testing.T) {
+	// Next over a call must collect the values returned by the called
+	// function even though the caller discards them.
+	withTestProcess("stepoutret", t, func(p *proc.Target, fixture protest.Fixture) {
+		setFileBreakpoint(p, t, fixture.Source, 10)
+		assertNoError(p.Continue(), t, "Continue")
+		assertNoError(p.Next(), t, "Next")
+		if fn := p.CurrentThread().Common().ReturnFunction(); fn == nil || fn.Name != "main.stepout" {
+			t.Fatalf("wrong return function %v", fn)
+		}
+		ret := p.CurrentThread().Common().ReturnValues(normalLoadConfig)
+		if len(ret) != 2 {
+			t.Fatalf("wrong number of return values %v", ret)
+		}
+		if ret[0].Name != "str" || ret[0].Kind != reflect.String || constant.StringVal(ret[0].Value) != "return 47" {
+			t.Fatalf("bad return value %s = %v", ret[0].Name, ret[0].Value)
+		}
+		if n, _ := constant.Int64Val(ret[1].Value); ret[1].Name != "num" || ret[1].Kind != reflect.Int || n != 48 {
+			t.Fatalf("bad return value %s = %v", ret[1].Name, ret[1].Value)
+		}
+
+		// return values are discarded when execution resumes
+		assertNoError(p.Next(), t, "Next")
+		if ret := p.CurrentThread().Common().ReturnValues(normalLoadConfig); len(ret) != 0 {
+			t.Fatalf("unexpected return values %v", ret)
+		}
+	})
+}
+
+func TestAtExitBreakpoint(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("atexit", t, func(p *proc.Target, fixture protest.Fixture) {
+		atExit := func(fname string) *proc.Breakpoint {
+			bp := setFunctionBreakpoint(p, t, fname)
+			bp.AtExit = true
+			return bp
+		}
+		signbp := atExit("main.sign")
+		factbp := atExit("main.fact")
+		explodebp := atExit("main.explode")
+		recoveringbp := atExit("main.recovering")
+
+		assertExit := func(bp *proc.Breakpoint, fnname string, line int, retval string) {
+			assertNoError(p.Continue(), t, "Continue")
+			if curbp := p.CurrentThread().Breakpoint().Breakpoint; curbp != bp {
+				t.Fatalf("stopped at %v, expected %v", curbp, bp)
+			}
+			loc, err := p.CurrentThread().Location()
+			assertNoError(err, t, "Location")
+			if loc.Fn == nil || loc.Fn.Name != fnname || (line > 0 && loc.Line != line) {
+				t.Fatalf("wrong location %s:%d", loc.File, loc.Line)
+			}
+			ret := p.CurrentThread().Common().ReturnValues(normalLoadConfig)
+			if retval == "" {
+				if len(ret) != 0 {
+					t.Fatalf("unexpected return values %v", ret)
+				}
+				return
+			}
+			if len(ret) != 1 {
+				t.Fatalf("wrong number of return values %v", ret)
+			}
+			if s := ret[0].Value.ExactString(); s != retval {
+				t.Fatalf("wrong return value %s, expected %s", s, retval)
+			}
+		}
+
+		// every return path, the deferred call runs before the exit
+		assertExit(signbp, "main.main", 37, `"<negative>"`)
+		assertExit(signbp, "main.main", 37, `"<zero>"`)
+		assertExit(signbp, "main.main", 37, `"<positive>"`)
+
+		// the innermost invocation exits first, clearing the breakpoint stops
+		// tracking the others
+		assertExit(factbp, "main.fact", 20, "1")
+		_, err := p.ClearBreakpoint(factbp.Addr)
+		assertNoError(err, t, "ClearBreakpoint")
+
+		// unwound by a panic recovered by its caller
+		assertExit(explodebp, "runtime.recovery", -1, "")
+		assertExit(recoveringbp, "main.main", 39, "-1")
+
+		if err := p.Continue(); err == nil {
+			t.Fatalf("expected the process to exit")
+		} else if _, exited := err.(proc.ErrProcessExited); !exited {
+			t.Fatalf("Continue: %v", err)
+		}
+	})
+}
+
+func TestStackContainsBreakpoint(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("stackcontains", t, func(p *proc.Target, fixture protest.Fixture) {
+		bp := setFileBreakpoint(p, t, fixture.Source, 6)
+		bp.StackContains = "main.handleRequest"
+
+		assertNoError(p.Continue(), t, "Continue")
+		assertLineNumber(p, t, 6, "lookup")
+		if key := evalVariable(p, t, "key"); constant.StringVal(key.Value) != "bb" {
+			t.Fatalf("wrong key %s", key.Value)
+		}
+
+		// main.handleRequest is the third frame of the stack
+		bp.StackContainsDepth = 2
+		if err := p.Continue(); err == nil {
+			t.Fatalf("expected the process to exit, stopped at key %s", evalVariable(p, t, "key").Value)
+		} else if _, exited := err.(proc.ErrProcessExited); !exited {
+			t.Fatalf("Continue: %v", err)
+		}
+	})
+}
+
+func TestLineCoverage(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("linecoverage", t, func(p *proc.Target, fixture protest.Fixture) {
+		var fns []*proc.Function
+		for _, name := range []string{"main.classify", "main.unused"} {
+			fn := p.BinInfo().LookupFunc[name]
+			if fn == nil {
+				t.Fatalf("function %s not found", name)
+			}
+			fns = append(fns, fn)
+		}
+		n, err := p.AddCoverage(fns)
+		assertNoError(err, t, "AddCoverage")
+		if n == 0 {
+			t.Fatal("no lines tracked")
+		}
+		// a user breakpoint on a tracked line still stops
+		bp := setFileBreakpoint(p, t, fixture.Source, 12)
+
+		executed := func() map[int]bool {
+			r := map[int]bool{}
+			for _, cl := range p.Coverage() {
+				r[cl.Line] = cl.Executed
+			}
+			return r
+		}
+		assertExecuted := func(lines map[int]bool, expected map[int]bool) {
+			t.Helper()
+			for line, exec := range expected {
+				if e, tracked := lines[line]; !tracked || e != exec {
+					t.Errorf("line %d: executed %v tracked %v, expected executed %v", line, e, tracked, exec)
+				}
+			}
+		}
+
+		assertNoError(p.Continue(), t, "Continue")
+		assertLineNumber(p, t, 12, "classify")
+		assertExecuted(executed(), map[int]bool{6: true, 7: true, 9: true, 10: false, 16: false})
+		_, err = p.ClearBreakpoint(bp.Addr)
+		assertNoError(err, t, "ClearBreakpoint")
+
+		if err := p.Continue(); err == nil {
+			t.Fatalf("expected the process to exit")
+		} else if _, exited := err.(proc.ErrProcessExited); !exited {
+			t.Fatalf("Continue: %v", err)
+		}
+		assertExecuted(executed(), map[int]bool{6: true, 7: true, 9: true, 10: false, 12: true, 16: false})
+	})
+}
+
 func TestOptimizationCheck(t *testing.T) {
 	withTestProcess("continuetestprog", t, func(p *proc.Target, fixture protest.Fixture) {
 		fn := p.BinInfo().LookupFunc["main.main"]
@@ -4216,6 +4444,41 @@ func TestReadDeferArgs(t *testing.T) {
 	})
 }
 
+func TestDeferFunctionArguments(t *testing.T) {
+	if runtime.GOARCH == "arm64" {
+		t.Skip("arm64 does not support ReadDeferArgs for now")
+	}
+	withTestProcess("deferstack", t, func(p *proc.Target, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue()")
+		frames, err := p.SelectedGoroutine().Stacktrace(10, proc.StacktraceReadDefers)
+		assertNoError(err, t, "Stacktrace")
+
+		d := frames[1].Defers[0]
+		fn := d.Function(p.BinInfo(), p.CurrentThread(), p.Breakpoints())
+		if fn == nil || fn.Name != "main.f2" {
+			t.Fatalf("wrong function of deferred call %v", fn)
+		}
+		if d.CallsRecover(p.BinInfo(), p.CurrentThread(), p.Breakpoints()) {
+			t.Fatalf("main.f2 does not call recover")
+		}
+		args, err := d.Arguments(p.CurrentThread(), normalLoadConfig)
+		assertNoError(err, t, "Arguments()")
+		values := []int64{}
+		for _, arg := range args {
+			n, _ := constant.Int64Val(arg.Value)
+			values = append(values, n)
+		}
+		if goversion.VersionAfterOrEqual(runtime.Version(), 1, 17) {
+			// the arguments are constants, the deferred closure captures nothing
+			if len(values) != 0 {
+				t.Fatalf("wrong variables captured by deferred call %v", values)
+			}
+		} else if len(values) != 2 || values[0] != 42 || values[1] != 61 {
+			t.Fatalf("wrong arguments of deferred call %v", values)
+		}
+	})
+}
+
 func TestIssue1374(t *testing.T) {
 	// Continue did not work when stopped at a breakpoint immediately after calling CallFunction.
 	protest.MustSupportFunctionCalls(t, testBackend)
@@ -5017,3 +5280,182 @@ func TestStepOutPreservesGoroutine(t *testing.T) {
 		}
 	})
 }
+
+func TestListFlavor(t *testing.T) {
+	withTestProcess("flavortasks", t, func(p *proc.Target, fixture protest.Fixture) {
+		p.SetFlavor(&proc.ListFlavor{
+			Head:    "main.tasks.head",
+			Current: "main.tasks.current",
+			Next:    "next",
+			ID:      "id",
+			Name:    "name",
+			PC:      "pc",
+			SP:      "sp",
+		})
+		assertNoError(p.Continue(), t, "Continue()")
+
+		gs, _, err := proc.GoroutinesInfo(p, 0, 0)
+		assertNoError(err, t, "GoroutinesInfo()")
+		if len(gs) != 3 {
+			t.Fatalf("wrong number of threads of interest %d", len(gs))
+		}
+		for i, name := range []string{"main", "worker", "idle"} {
+			if gs[i].ID != i+1 || gs[i].Name != name {
+				t.Errorf("thread of interest %d is %d %q, expected %d %q", i, gs[i].ID, gs[i].Name, i+1, name)
+			}
+		}
+		if gs[0].Thread == nil || gs[0].Thread.ThreadID() != p.CurrentThread().ThreadID() {
+			t.Errorf("thread of interest 1 not running on the current thread")
+		}
+		for _, g := range gs[1:] {
+			if g.Thread != nil || g.CurrentLoc.Fn == nil || g.CurrentLoc.Fn.Name != "main.taskEntry" {
+				t.Errorf("thread of interest %d: thread %v location %v", g.ID, g.Thread, g.CurrentLoc)
+			}
+		}
+
+		g, err := proc.GetG(p.CurrentThread())
+		assertNoError(err, t, "GetG()")
+		if g == nil || g.ID != 1 {
+			t.Errorf("wrong current thread of interest %v", g)
+		}
+	})
+}
+
+func TestSubtestBreakpoint(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("subtests", t, func(p *proc.Target, fixture protest.Fixture) {
+		assertNoError(p.SetSubtestBreakpoint("TestFoo/two"), t, "SetSubtestBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+		bp := p.CurrentThread().Breakpoint()
+		if bp.Breakpoint == nil || bp.Name != proc.SubtestRunner {
+			t.Fatalf("not stopped at the %s breakpoint: %v", proc.SubtestRunner, bp.Breakpoint)
+		}
+		fn, g, err := proc.SubtestFunction(p.CurrentThread())
+		assertNoError(err, t, "SubtestFunction()")
+		if fn.Name != "main.TestFoo.func1" {
+			t.Fatalf("wrong function of the subtest %s", fn.Name)
+		}
+		_, err = p.ClearBreakpoint(bp.Addr)
+		assertNoError(err, t, "ClearBreakpoint()")
+
+		pc, err := proc.FirstPCAfterPrologue(p, fn, false)
+		assertNoError(err, t, "FirstPCAfterPrologue()")
+		cond := &ast.BinaryExpr{
+			Op: token.EQL,
+			X:  &ast.SelectorExpr{X: &ast.SelectorExpr{X: &ast.Ident{Name: "runtime"}, Sel: &ast.Ident{Name: "curg"}}, Sel: &ast.Ident{Name: "goid"}},
+			Y:  &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(g.ID)},
+		}
+		_, err = p.SetBreakpoint(pc, proc.UserBreakpoint, cond)
+		assertNoError(err, t, "SetBreakpoint()")
+		assertNoError(p.Continue(), t, "Continue()")
+		if n, _ := constant.Int64Val(evalVariable(p, t, "tc.n").Value); n != 2 {
+			t.Fatalf("stopped in the wrong subtest, tc.n = %d", n)
+		}
+	})
+}
+
+func TestSoftwareSingleStepARM(t *testing.T) {
+	// Ptrace does not implement single stepping on ARM, the native backend
+	// emulates it with breakpoints on the possible destinations of each
+	// instruction, see pkg/proc/emulate. Each test case steps
+	// over one of the control flow instructions of _fixtures/armstep.
+	if runtime.GOOS != "linux" || runtime.GOARCH != "arm" || testBackend != "native" {
+		t.Skip("software single stepping is only used by the native backend on linux/arm")
+	}
+	tests := []struct {
+		fn        string
+		off       uint64 // offset of the instruction from the entry of fn
+		tgtfn     string
+		tgtoff    uint64
+		unhandled bool // see armStepTests in pkg/proc/emulate
+	}{
+		{"main.branch", 4, "main.target", 0, false},
+		{"main.branchLink", 4, "main.target", 0, false},
+		{"main.branchReg", 8, "main.target", 0, false},
+		{"main.branchLinkReg", 8, "main.target", 0, false},
+		{"main.movPC", 8, "main.target", 0, false},
+		{"main.addPC", 4, "main.addPC", 16, false},
+		{"main.addPCReg", 16, "main.target", 0, false},
+		{"main.ldrPC", 8, "main.target", 0, false},
+		{"main.ldrPCOffset", 8, "main.target", 0, false},
+		{"main.ldrPCIndex", 12, "main.target", 0, false},
+		{"main.ldrPCPostIndex", 12, "main.target", 0, false},
+		{"main.popPC", 12, "main.target", 0, false},
+		{"main.branchCondNotTaken", 8, "main.branchCondNotTaken", 12, false},
+		// Stepping the exclusive load executes the whole atomic sequence.
+		{"main.atomicAdd", 8, "main.atomicAdd", 20, false},
+		{"main.atomicCas", 16, "main.atomicCas", 32, false},
+
+		{"main.branchCondTaken", 8, "main.branchCondTaken", 16, true},
+		{"main.movPCCond", 12, "main.target", 0, true},
+		{"main.subPC", 12, "main.target", 0, true},
+		{"main.addPCShift", 20, "main.target", 0, true},
+		{"main.ldmPC", 8, "main.target", 0, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.fn, func(t *testing.T) {
+			withTestProcess("armstep/", t, func(p *proc.Target, fixture protest.Fixture) {
+				fn, tgtfn := p.BinInfo().LookupFunc[tc.fn], p.BinInfo().LookupFunc[tc.tgtfn]
+				if fn == nil || tgtfn == nil {
+					t.Fatalf("could not find %s or %s", tc.fn, tc.tgtfn)
+				}
+				addr, tgt := fn.Entry+tc.off, tgtfn.Entry+tc.tgtoff
+				_, err := p.SetBreakpoint(addr, proc.UserBreakpoint, nil)
+				assertNoError(err, t, "SetBreakpoint")
+				assertNoError(p.Continue(), t, "Continue")
+				if pc := currentPC(p, t); pc != addr {
+					t.Fatalf("stopped at %#x instead of %#x", pc, addr)
+				}
+				err = p.StepInstruction()
+				if tc.unhandled {
+					if err == nil && currentPC(p, t) == tgt {
+						t.Errorf("stepped to %#x, the instruction is handled now", tgt)
+					}
+					return
+				}
+				assertNoError(err, t, "StepInstruction")
+				if pc := currentPC(p, t); pc != tgt {
+					t.Errorf("stepped to %#x instead of %#x", pc, tgt)
+				}
+			})
+		})
+	}
+}
+
+func TestStepAtomicSequenceARM64(t *testing.T) {
+	// Single stepping the exclusive load starting an atomic sequence must
+	// execute the whole sequence, otherwise the exclusive store fails and
+	// the sequence is retried forever.
+	if runtime.GOOS != "linux" || runtime.GOARCH != "arm64" || testBackend != "native" {
+		t.Skip("atomic sequences are only emulated by the native backend on linux/arm64")
+	}
+	tests := []struct {
+		fn  string
+		off uint64 // offset of the instruction after the exclusive store
+	}{
+		{"main.add", 16},
+		{"main.addWithBranch", 24},
+		{"main.addPair", 20},
+	}
+	withTestProcess("arm64atomic/", t, func(p *proc.Target, fixture protest.Fixture) {
+		for _, tc := range tests {
+			fn := p.BinInfo().LookupFunc[tc.fn]
+			if fn == nil {
+				fn = p.BinInfo().LookupFunc[tc.fn+".abi0"]
+			}
+			if fn == nil {
+				t.Fatalf("could not find %s", tc.fn)
+			}
+			// The exclusive load is the second instruction of each function.
+			bp, err := p.SetBreakpoint(fn.Entry+4, proc.UserBreakpoint, nil)
+			assertNoError(err, t, "SetBreakpoint")
+			assertNoError(p.Continue(), t, "Continue")
+			assertNoError(p.StepInstruction(), t, "StepInstruction")
+			if pc := currentPC(p, t); pc != fn.Entry+tc.off {
+				t.Errorf("%s: stepped to %#x instead of %#x", tc.fn, pc, fn.Entry+tc.off)
+			}
+			_, err = p.ClearBreakpoint(bp.Addr)
+			assertNoError(err, t, "ClearBreakpoint")
+		}
+	})
+}
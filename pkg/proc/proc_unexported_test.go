@@ -73,3 +73,18 @@ func TestAlignAddr(t *testing.T) {
 		c(example.align, example.in+0x10000, example.tgt+0x10000)
 	}
 }
+
+func TestGccgoDemangle(t *testing.T) {
+	for _, tc := range []struct{ in, out string }{
+		{"main.main", "main.main"},
+		{"main.T.Method", "main.T.Method"},
+		{"github.com..z2fgo-delve..z2fdelve.Func", "github.com/go-delve/delve.Func"},
+		{"main.main..func1", "main.main.func1"},
+		{"main..u00e8", "main\u00e8"},
+		{"main..z2", "main.z2"},
+	} {
+		if out := gccgoDemangle(tc.in); out != tc.out {
+			t.Errorf("gccgoDemangle(%q) = %q, expected %q", tc.in, out, tc.out)
+		}
+	}
+}
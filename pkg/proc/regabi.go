@@ -0,0 +1,215 @@
+package proc
+
+import (
+	"debug/dwarf"
+	"fmt"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	"github.com/go-delve/delve/pkg/dwarf/reader"
+	"github.com/go-delve/delve/pkg/goversion"
+)
+
+// Registers used to pass arguments and results by the register based
+// calling convention (ABIInternal) of Go, as DWARF register numbers.
+// See $GOROOT/src/cmd/compile/abi-internal.md.
+var (
+	// RAX, RBX, RCX, RDI, RSI, R8, R9, R10, R11
+	amd64RegabiIntRegs = []uint64{0, 3, 2, 5, 4, 8, 9, 10, 11}
+	// X0 to X14
+	amd64RegabiFloatRegs = []uint64{17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31}
+	// R0 to R15
+	arm64RegabiIntRegs = []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	// F0 to F15
+	arm64RegabiFloatRegs = []uint64{64, 65, 66, 67, 68, 69, 70, 71, 72, 73, 74, 75, 76, 77, 78, 79}
+)
+
+// regabiRegisters returns the registers used for arguments and results by
+// fn, or nil if fn uses the stack based calling convention: functions
+// written in assembly and functions compiled with a version of Go that
+// does not use registers on this architecture (before Go 1.17 on amd64,
+// before Go 1.18 on arm64).
+func regabiRegisters(bi *BinaryInfo, fn *Function) (ints, floats []uint64) {
+	if fn.cu == nil || !fn.cu.isgo {
+		return nil, nil
+	}
+	producer := fn.cu.producer
+	if producer == "" {
+		producer = bi.Producer()
+	}
+	switch bi.Arch.Name {
+	case "amd64":
+		if goversion.ProducerAfterOrEqual(producer, 1, 17) {
+			return amd64RegabiIntRegs, amd64RegabiFloatRegs
+		}
+	case "arm64":
+		if goversion.ProducerAfterOrEqual(producer, 1, 18) {
+			return arm64RegabiIntRegs, arm64RegabiFloatRegs
+		}
+	}
+	return nil, nil
+}
+
+// regabiPiece is a part of a value assigned to a register.
+type regabiPiece struct {
+	off, size int64 // offset and size of the part in the value
+	reg       uint64
+}
+
+// regabiAssigner implements the assignment of values to registers of the
+// register based calling convention.
+type regabiAssigner struct {
+	ints, floats []uint64
+	nint, nfloat int
+	pieces       []regabiPiece
+}
+
+// assignValue assigns a value of type typ to registers, returning false
+// if it doesn't fit, in which case the value is assigned to the stack and
+// no registers are consumed.
+func (a *regabiAssigner) assignValue(typ godwarf.Type) bool {
+	nint, nfloat, npieces := a.nint, a.nfloat, len(a.pieces)
+	if !a.assign(typ, 0) {
+		a.nint, a.nfloat, a.pieces = nint, nfloat, a.pieces[:npieces]
+		return false
+	}
+	return true
+}
+
+func (a *regabiAssigner) assign(typ godwarf.Type, off int64) bool {
+	switch t := resolveTypedef(typ).(type) {
+	case *godwarf.StructType:
+		return a.assignFields(t.Field, off)
+	case *godwarf.StringType:
+		return a.assignFields(t.Field, off)
+	case *godwarf.SliceType:
+		return a.assignFields(t.Field, off)
+	case *godwarf.InterfaceType:
+		return a.assignInt(off, t.Size()/2) && a.assignInt(off+t.Size()/2, t.Size()/2)
+	case *godwarf.ArrayType:
+		switch t.Count {
+		case 0:
+			return true
+		case 1:
+			return a.assign(t.Type, off)
+		}
+		return false
+	case *godwarf.FloatType:
+		return a.assignFloat(off, t.Size())
+	case *godwarf.ComplexType:
+		return a.assignFloat(off, t.Size()/2) && a.assignFloat(off+t.Size()/2, t.Size()/2)
+	case *godwarf.IntType, *godwarf.UintType, *godwarf.BoolType, *godwarf.PtrType, *godwarf.MapType, *godwarf.ChanType, *godwarf.FuncType:
+		return a.assignInt(off, t.Size())
+	}
+	return false
+}
+
+func (a *regabiAssigner) assignFields(fields []*godwarf.StructField, off int64) bool {
+	for _, field := range fields {
+		if !a.assign(field.Type, off+field.ByteOffset) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *regabiAssigner) assignInt(off, size int64) bool {
+	if a.nint >= len(a.ints) {
+		return false
+	}
+	a.pieces = append(a.pieces, regabiPiece{off, size, a.ints[a.nint]})
+	a.nint++
+	return true
+}
+
+func (a *regabiAssigner) assignFloat(off, size int64) bool {
+	if a.nfloat >= len(a.floats) {
+		return false
+	}
+	a.pieces = append(a.pieces, regabiPiece{off, size, a.floats[a.nfloat]})
+	a.nfloat++
+	return true
+}
+
+// regabiReturnValues reads the values returned by fn, which uses the
+// register based calling convention, on thread, which must be stopped at
+// the return address of a call to fn. Results are assigned to registers
+// starting from the first one, results that do not fit are stored on the
+// stack, after the arguments that do not fit in registers.
+func regabiReturnValues(thread Thread, fn *Function) ([]*Variable, error) {
+	bi := thread.BinInfo()
+	ints, floats := regabiRegisters(bi, fn)
+	image := fn.cu.image
+
+	dwarfTree, err := image.getDwarfTree(fn.offset)
+	if err != nil {
+		return nil, fmt.Errorf("DWARF read error: %v", err)
+	}
+	regs, err := thread.Registers()
+	if err != nil {
+		return nil, err
+	}
+	dregs := bi.Arch.RegistersToDwarfRegisters(image.StaticBase, regs)
+
+	ptrSize := int64(bi.Arch.PtrSize())
+	// the arguments area starts at the stack pointer of the caller, above
+	// the saved link register on architectures that use one
+	argsBase := dregs.SP()
+	if bi.Arch.Name == "arm64" {
+		argsBase += uint64(ptrSize)
+	}
+
+	args := &regabiAssigner{ints: ints, floats: floats}
+	rets := &regabiAssigner{ints: ints, floats: floats}
+	var stackOff int64
+	var retEntries []*godwarf.Tree
+	for _, entry := range reader.Variables(dwarfTree, fn.Entry, int(^uint(0)>>1), reader.VariablesSkipInlinedSubroutines) {
+		if entry.Tag != dwarf.TagFormalParameter {
+			continue
+		}
+		if isret, _ := entry.Val(dwarf.AttrVarParam).(bool); isret {
+			retEntries = append(retEntries, entry.Tree)
+			continue
+		}
+		_, typ, err := readVarEntry(entry.Tree, image)
+		if err != nil {
+			return nil, err
+		}
+		if !args.assignValue(typ) {
+			stackOff = alignAddr(stackOff, typ.Align()) + typ.Size()
+		}
+	}
+	stackOff = alignAddr(stackOff, ptrSize)
+
+	vars := make([]*Variable, 0, len(retEntries))
+	for _, entry := range retEntries {
+		name, typ, err := readVarEntry(entry, image)
+		if err != nil {
+			return nil, err
+		}
+		npieces := len(rets.pieces)
+		if !rets.assignValue(typ) {
+			stackOff = alignAddr(stackOff, typ.Align())
+			v := newVariable(name, uintptr(argsBase+uint64(stackOff)), typ, bi, thread)
+			v.Flags |= VariableReturnArgument
+			vars = append(vars, v)
+			stackOff += typ.Size()
+			continue
+		}
+		buf := make([]byte, typ.Size())
+		for _, piece := range rets.pieces[npieces:] {
+			reg := dregs.Bytes(piece.reg)
+			if int64(len(reg)) < piece.size {
+				err = fmt.Errorf("could not read %d bytes from register %d", piece.size, piece.reg)
+				break
+			}
+			copy(buf[piece.off:piece.off+piece.size], reg[:piece.size])
+		}
+		v := newVariable(name, fakeAddress, typ, bi, &compositeMemory{realmem: thread, regs: dregs, data: buf})
+		v.Flags |= VariableReturnArgument | VariableFakeAddress
+		if err != nil {
+			v.Unreadable = err
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
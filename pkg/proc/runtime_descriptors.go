@@ -0,0 +1,287 @@
+package proc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-delve/delve/pkg/goversion"
+)
+
+// RuntimeDescriptor describes, for the versions of Go starting with
+// GoVersion, the fields of the structures of the runtime that Delve reads
+// and the values of the constants of the runtime it uses. The offsets of
+// the fields are always read from the debug information, the descriptors
+// only map the names used by Delve to the names used by the runtime, so
+// that the fields that are renamed (or removed) by a new version of Go can
+// be described without changing Delve.
+//
+// The descriptors for a target are obtained merging, in order, the
+// descriptors of the versions of Go up to the one used to build it: the
+// built-in ones, followed by the ones loaded with LoadRuntimeDescriptors.
+// The descriptors of development versions of Go are all merged.
+type RuntimeDescriptor struct {
+	// GoVersion is the first version of Go the descriptor applies to, as
+	// major.minor (for example "1.16"). The empty string stands for every
+	// version.
+	GoVersion string `json:"go"`
+	// Structs maps the names of the structures of the runtime (for example
+	// "runtime.g") to their fields, mapping the names used by Delve to the
+	// names used by the runtime. Fields that do not exist are mapped to the
+	// empty string.
+	Structs map[string]map[string]string `json:"structs,omitempty"`
+	// Consts maps the names of the constants of the runtime to their values.
+	Consts map[string]int64 `json:"consts,omitempty"`
+}
+
+var builtinRuntimeDescriptors = []RuntimeDescriptor{
+	{
+		GoVersion: "",
+		Structs: map[string]map[string]string{
+			"runtime.g": {
+				"sched":        "sched",
+				"stack":        "stack",
+				"goid":         "goid",
+				"gopc":         "gopc",
+				"startpc":      "startpc",
+				"atomicstatus": "atomicstatus",
+				"m":            "m",
+				"_defer":       "_defer",
+				"_panic":       "_panic",
+				"labels":       "labels",
+				"ancestors":    "ancestors",
+				"stkbar":       "stkbar",
+				"stkbarPos":    "stkbarPos",
+			},
+			"runtime.gobuf": {
+				"pc": "pc",
+				"sp": "sp",
+				"bp": "bp",
+				"lr": "lr",
+			},
+			"runtime.stack": {
+				"lo": "lo",
+				"hi": "hi",
+			},
+			"runtime.m": {
+				"g0":   "g0",
+				"curg": "curg",
+				"id":   "id",
+				"p":    "p",
+			},
+			"runtime.p": {
+				"id": "id",
+			},
+			"runtime._defer": {
+				"fn":   "fn",
+				"pc":   "pc",
+				"sp":   "sp",
+				"siz":  "siz",
+				"link": "link",
+			},
+			"runtime.funcval": {
+				"fn": "fn",
+			},
+			"runtime.ancestorInfo": {
+				"goid": "goid",
+				"pcs":  "pcs",
+			},
+			"runtime.hmap": {
+				"count":      "count",
+				"B":          "B",
+				"buckets":    "buckets",
+				"oldbuckets": "oldbuckets",
+			},
+			"runtime.bmap": {
+				"tophash":  "tophash",
+				"keys":     "keys",
+				"values":   "values",
+				"overflow": "overflow",
+			},
+			"runtime.hchan": {
+				"dataqsiz": "dataqsiz",
+				"buf":      "buf",
+			},
+			"runtime.iface": {
+				"tab":  "tab",
+				"data": "data",
+			},
+			"runtime.eface": {
+				"_type": "_type",
+				"data":  "data",
+			},
+			"runtime.itab": {
+				"_type": "_type",
+			},
+		},
+		Consts: map[string]int64{
+			"runtime.emptyOne":   0,
+			"runtime.minTopHash": 4,
+		},
+	},
+	{
+		// Stack barriers were removed.
+		GoVersion: "1.9",
+		Structs: map[string]map[string]string{
+			"runtime.g": {
+				"stkbar":    "",
+				"stkbarPos": "",
+			},
+		},
+	},
+	{
+		// Empty cells and evacuated empty cells of map buckets are distinct.
+		GoVersion: "1.12",
+		Consts: map[string]int64{
+			"runtime.emptyOne":   1,
+			"runtime.minTopHash": 5,
+		},
+	},
+	{
+		// runtime.itab became an alias of internal/abi.ITab, whose fields
+		// are exported.
+		GoVersion: "1.22",
+		Structs: map[string]map[string]string{
+			"runtime.itab": {
+				"_type": "Type",
+			},
+		},
+	},
+}
+
+var (
+	runtimeDescriptorsMu sync.Mutex
+	// userRuntimeDescriptors are the descriptors loaded with
+	// LoadRuntimeDescriptors.
+	userRuntimeDescriptors []RuntimeDescriptor
+)
+
+// LoadRuntimeDescriptors loads the runtime descriptors in the JSON file at
+// path, a list of RuntimeDescriptor objects, which override the built-in
+// ones for the executables loaded afterwards. Only the structures and the
+// fields described by the built-in descriptors can be described.
+func LoadRuntimeDescriptors(path string) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var descs []RuntimeDescriptor
+	if err := json.Unmarshal(buf, &descs); err != nil {
+		return fmt.Errorf("could not parse runtime descriptors %s: %v", path, err)
+	}
+	for i := range descs {
+		if err := checkRuntimeDescriptor(&descs[i]); err != nil {
+			return fmt.Errorf("invalid runtime descriptor %d in %s: %v", i, path, err)
+		}
+	}
+	runtimeDescriptorsMu.Lock()
+	userRuntimeDescriptors = append(userRuntimeDescriptors, descs...)
+	runtimeDescriptorsMu.Unlock()
+	return nil
+}
+
+// RuntimeDescriptors returns the built-in runtime descriptors followed by
+// the ones loaded with LoadRuntimeDescriptors.
+func RuntimeDescriptors() []RuntimeDescriptor {
+	runtimeDescriptorsMu.Lock()
+	defer runtimeDescriptorsMu.Unlock()
+	r := make([]RuntimeDescriptor, 0, len(builtinRuntimeDescriptors)+len(userRuntimeDescriptors))
+	r = append(r, builtinRuntimeDescriptors...)
+	return append(r, userRuntimeDescriptors...)
+}
+
+func checkRuntimeDescriptor(desc *RuntimeDescriptor) error {
+	if desc.GoVersion != "" {
+		if _, _, ok := parseDescriptorVersion(desc.GoVersion); !ok {
+			return fmt.Errorf("malformed Go version %q", desc.GoVersion)
+		}
+	}
+	base := &builtinRuntimeDescriptors[0]
+	for strct, fields := range desc.Structs {
+		basefields, ok := base.Structs[strct]
+		if !ok {
+			return fmt.Errorf("unknown structure %s", strct)
+		}
+		for field := range fields {
+			if _, ok := basefields[field]; !ok {
+				return fmt.Errorf("unknown field %s of %s", field, strct)
+			}
+		}
+	}
+	for name := range desc.Consts {
+		if _, ok := base.Consts[name]; !ok {
+			return fmt.Errorf("unknown constant %s", name)
+		}
+	}
+	return nil
+}
+
+func parseDescriptorVersion(ver string) (major, minor int, ok bool) {
+	v, ok := goversion.Parse("go" + ver)
+	if !ok || v.IsDevel() || strings.Count(ver, ".") != 1 {
+		return 0, 0, false
+	}
+	return v.Major, v.Minor, true
+}
+
+// runtimeDescriptor is the merge of the runtime descriptors that apply to
+// an executable.
+type runtimeDescriptor struct {
+	structs map[string]map[string]string
+	consts  map[string]int64
+}
+
+// mergeRuntimeDescriptors merges the descriptors in descs that apply to
+// executables built by producer, in order of Go version. If producer is
+// the empty string only the descriptors for every version apply.
+func mergeRuntimeDescriptors(descs []RuntimeDescriptor, producer string) *runtimeDescriptor {
+	descs = append([]RuntimeDescriptor(nil), descs...)
+	sort.SliceStable(descs, func(i, j int) bool {
+		imajor, iminor, _ := parseDescriptorVersion(descs[i].GoVersion)
+		jmajor, jminor, _ := parseDescriptorVersion(descs[j].GoVersion)
+		return imajor < jmajor || (imajor == jmajor && iminor < jminor)
+	})
+	r := &runtimeDescriptor{structs: make(map[string]map[string]string), consts: make(map[string]int64)}
+	for _, desc := range descs {
+		if desc.GoVersion != "" {
+			major, minor, ok := parseDescriptorVersion(desc.GoVersion)
+			if !ok || producer == "" || !goversion.ProducerAfterOrEqual(producer, major, minor) {
+				continue
+			}
+		}
+		for strct, fields := range desc.Structs {
+			if r.structs[strct] == nil {
+				r.structs[strct] = make(map[string]string)
+			}
+			for field, name := range fields {
+				r.structs[strct][field] = name
+			}
+		}
+		for name, val := range desc.Consts {
+			r.consts[name] = val
+		}
+	}
+	return r
+}
+
+func (bi *BinaryInfo) runtimeDescriptor() *runtimeDescriptor {
+	bi.runtimeDescriptorOnce.Do(func() {
+		bi.rtdesc = mergeRuntimeDescriptors(RuntimeDescriptors(), bi.Producer())
+	})
+	return bi.rtdesc
+}
+
+// rtField returns the name of field, a field of the runtime structure
+// strct, in the runtime of the executable. Returns the empty string if the
+// field does not exist.
+func (bi *BinaryInfo) rtField(strct, field string) string {
+	return bi.runtimeDescriptor().structs[strct][field]
+}
+
+// rtConst returns the value of the runtime constant called name.
+func (bi *BinaryInfo) rtConst(name string) int64 {
+	return bi.runtimeDescriptor().consts[name]
+}
@@ -0,0 +1,147 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Sandbox restricts the environment, the resources and the privileges of
+// a process launched by the debugger. The zero value launches processes
+// with the environment, the resources and the privileges of the debugger.
+type Sandbox struct {
+	// EnvMode selects the variables of the environment of the debugger
+	// that the process inherits.
+	EnvMode EnvMode
+	// EnvAllow are the names of the variables inherited with EnvAllowlist.
+	EnvAllow []string
+	// Env are additional variables of the environment, as NAME=VALUE,
+	// overriding the inherited ones.
+	Env []string
+
+	// Rlimits are the resource limits of the process.
+	Rlimits []Rlimit
+
+	// User and Group are the user and the group, names or numeric IDs, the
+	// process runs as. The group defaults to the primary group of the user.
+	User, Group string
+
+	// Namespaces are the namespaces created for the process (Linux only):
+	// cgroup, ipc, mount, net, pid, user or uts.
+	Namespaces []string
+}
+
+// EnvMode selects the environment inherited by a launched process.
+type EnvMode string
+
+const (
+	// EnvInherit inherits the whole environment of the debugger.
+	EnvInherit EnvMode = "inherit"
+	// EnvClear starts the process with an empty environment.
+	EnvClear EnvMode = "clear"
+	// EnvAllowlist only inherits the variables listed in Sandbox.EnvAllow.
+	EnvAllowlist EnvMode = "allowlist"
+)
+
+// Rlimit is a resource limit.
+type Rlimit struct {
+	// Resource is the name of the resource, the name of the RLIMIT_
+	// constant without prefix in lower case, for example "nofile" or
+	// "core".
+	Resource string
+	// Soft and Hard are the soft and the hard limits, RlimInfinity for no
+	// limit.
+	Soft, Hard uint64
+}
+
+// RlimInfinity is the value of resource limits meaning no limit.
+const RlimInfinity = math.MaxUint64
+
+// ErrSandboxUnsupported is returned when launching a process with a
+// sandbox on a backend that does not support it.
+var ErrSandboxUnsupported = errors.New("launching processes with restricted environment, resources or privileges is not supported by this backend")
+
+// Empty returns true if sb does not restrict anything.
+func (sb *Sandbox) Empty() bool {
+	return sb == nil || ((sb.EnvMode == "" || sb.EnvMode == EnvInherit) && len(sb.Env) == 0 && len(sb.Rlimits) == 0 && sb.User == "" && sb.Group == "" && len(sb.Namespaces) == 0)
+}
+
+// Environ returns the environment of the process, computed from the
+// environment of the debugger.
+func (sb *Sandbox) Environ() ([]string, error) {
+	var env []string
+	switch sb.EnvMode {
+	case "", EnvInherit:
+		env = os.Environ()
+	case EnvClear:
+	case EnvAllowlist:
+		allowed := make(map[string]bool, len(sb.EnvAllow))
+		for _, name := range sb.EnvAllow {
+			allowed[name] = true
+		}
+		for _, kv := range os.Environ() {
+			if allowed[envName(kv)] {
+				env = append(env, kv)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown environment mode %q", sb.EnvMode)
+	}
+	for _, kv := range sb.Env {
+		if !strings.Contains(kv, "=") {
+			return nil, fmt.Errorf("malformed environment variable %q, expected NAME=VALUE", kv)
+		}
+		name := envName(kv)
+		for i := 0; i < len(env); i++ {
+			if envName(env[i]) == name {
+				env = append(env[:i], env[i+1:]...)
+				i--
+			}
+		}
+		env = append(env, kv)
+	}
+	return env, nil
+}
+
+func envName(kv string) string {
+	if i := strings.Index(kv, "="); i >= 0 {
+		return kv[:i]
+	}
+	return kv
+}
+
+// ParseRlimit parses a resource limit of the form resource=soft[:hard],
+// where the limits are numbers or "unlimited". The hard limit defaults to
+// the soft limit.
+func ParseRlimit(s string) (Rlimit, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return Rlimit{}, fmt.Errorf("malformed resource limit %q, expected resource=soft[:hard]", s)
+	}
+	r := Rlimit{Resource: strings.ToLower(s[:i])}
+	limits := strings.SplitN(s[i+1:], ":", 2)
+	var err error
+	if r.Soft, err = parseRlimitValue(limits[0]); err != nil {
+		return Rlimit{}, fmt.Errorf("malformed resource limit %q: %v", s, err)
+	}
+	r.Hard = r.Soft
+	if len(limits) > 1 {
+		if r.Hard, err = parseRlimitValue(limits[1]); err != nil {
+			return Rlimit{}, fmt.Errorf("malformed resource limit %q: %v", s, err)
+		}
+	}
+	if r.Soft > r.Hard {
+		return Rlimit{}, fmt.Errorf("malformed resource limit %q: the soft limit is greater than the hard limit", s)
+	}
+	return r, nil
+}
+
+func parseRlimitValue(s string) (uint64, error) {
+	if s == "unlimited" || s == "infinity" {
+		return RlimInfinity, nil
+	}
+	return strconv.ParseUint(s, 0, 64)
+}
@@ -0,0 +1,276 @@
+package proc
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	"github.com/go-delve/delve/pkg/dwarf/loclist"
+	"github.com/go-delve/delve/pkg/dwarf/util"
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// splitUnit is a skeleton compile unit, whose debugging information
+// entries are in a split DWARF object file (.dwo) or in a DWARF package
+// file (.dwp), as produced by compilers with the -gsplit-dwarf flag.
+// See DWARFv5 appendix F page 389.
+type splitUnit struct {
+	cu      *compileUnit
+	dwoName string // value of DW_AT_dwo_name
+	compdir string
+}
+
+// newSplitUnit returns the split unit of cu, whose entry is entry, or
+// false if cu is not a skeleton unit.
+func newSplitUnit(entry *dwarf.Entry, cu *compileUnit, compdir string) (splitUnit, bool) {
+	dwoName, _ := entry.Val(dwarfAttrDwoName).(string)
+	if dwoName == "" {
+		dwoName, _ = entry.Val(dwarfAttrGNUDwoName).(string)
+	}
+	if dwoName == "" {
+		return splitUnit{}, false
+	}
+	return splitUnit{cu: cu, dwoName: dwoName, compdir: compdir}, true
+}
+
+// IsSplitDwarf returns true if image is a split DWARF file, containing the
+// debugging information of some compile units of another image, rather
+// than a library.
+func (image *Image) IsSplitDwarf() bool {
+	return image.splitOf != nil
+}
+
+// splitSections are the debug sections of a split compile unit.
+type splitSections struct {
+	path                                              string
+	info, abbrev, str, strOffsets, loclists, rnglists []byte
+}
+
+// openDwo reads the debug sections of the split DWARF object file at
+// path.
+func openDwo(path string) (*splitSections, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	get := func(name string) []byte {
+		data, _ := godwarf.GetDebugSectionElf(f, name+".dwo")
+		return data
+	}
+	secs := &splitSections{
+		path:       path,
+		info:       get("info"),
+		abbrev:     get("abbrev"),
+		str:        get("str"),
+		strOffsets: get("str_offsets"),
+		loclists:   get("loclists"),
+		rnglists:   get("rnglists"),
+	}
+	if len(secs.info) == 0 {
+		return nil, fmt.Errorf("%s: no .debug_info.dwo section", path)
+	}
+	return secs, nil
+}
+
+// dwpFile is a DWARF package file, containing the split compile units of
+// an executable.
+type dwpFile struct {
+	index *godwarf.DwpIndex
+	all   *splitSections
+}
+
+// openDwp reads the DWARF package file at path.
+func openDwp(path string) (*dwpFile, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	indexBytes, err := godwarf.GetDebugSectionElf(f, "cu_index")
+	byteOrder := f.ByteOrder
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	index, err := godwarf.ParseDwpIndex(indexBytes, byteOrder)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	all, err := openDwo(path)
+	if err != nil {
+		return nil, err
+	}
+	return &dwpFile{index: index, all: all}, nil
+}
+
+// unit returns the sections of the split compile unit with the given ID,
+// or nil if the package does not contain it.
+func (dwp *dwpFile) unit(id uint64) *splitSections {
+	contribution := func(data []byte, sect uint32) []byte {
+		off, size, ok := dwp.index.Contribution(id, sect)
+		if !ok || uint64(off)+uint64(size) > uint64(len(data)) {
+			return nil
+		}
+		return data[off : off+size]
+	}
+	secs := &splitSections{
+		path:       dwp.all.path,
+		info:       contribution(dwp.all.info, godwarf.DwpSectInfo),
+		abbrev:     contribution(dwp.all.abbrev, godwarf.DwpSectAbbrev),
+		str:        dwp.all.str,
+		strOffsets: contribution(dwp.all.strOffsets, godwarf.DwpSectStrOffsets),
+		loclists:   contribution(dwp.all.loclists, godwarf.DwpSectLoclists),
+		rnglists:   contribution(dwp.all.rnglists, godwarf.DwpSectRnglists),
+	}
+	if len(secs.info) == 0 {
+		return nil
+	}
+	return secs
+}
+
+// loadSplitUnits loads the split compile units of the skeleton units of
+// image, from the DWARF package file of image or from their split DWARF
+// object files, adding an image for each of them. The skeleton units that
+// can not be loaded are added to image, so that at least their line
+// tables are available.
+func (bi *BinaryInfo) loadSplitUnits(image *Image, skeletons []splitUnit, debugInfoBytes []byte) []*Image {
+	if len(skeletons) == 0 {
+		return nil
+	}
+	ids := util.ReadUnitIDs(debugInfoBytes)
+	dwp, err := openDwp(image.Path + ".dwp")
+	if err != nil && !os.IsNotExist(err) {
+		bi.logger.Warnf("could not read DWARF package file: %v", err)
+	}
+
+	var r []*Image
+	var nfailed int
+	var firstErr error
+	for _, sk := range skeletons {
+		dwo, err := bi.loadSplitUnit(image, dwp, sk, ids)
+		if err != nil {
+			if nfailed == 0 {
+				firstErr = err
+			}
+			nfailed++
+			image.compileUnits = append(image.compileUnits, sk.cu)
+			continue
+		}
+		r = append(r, dwo)
+	}
+	if nfailed > 0 {
+		bi.logger.Warnf("could not load the split DWARF of %d compile units, their functions, variables and types are not available: %v", nfailed, firstErr)
+	}
+	return r
+}
+
+func (bi *BinaryInfo) loadSplitUnit(image *Image, dwp *dwpFile, sk splitUnit, ids map[dwarf.Offset]uint64) (*Image, error) {
+	if sk.cu.Version < 5 {
+		return nil, fmt.Errorf("%s: split DWARF is only supported for DWARFv5", sk.dwoName)
+	}
+	id, hasID := ids[sk.cu.offset]
+
+	var secs *splitSections
+	if dwp != nil && hasID {
+		secs = dwp.unit(id)
+	}
+	if secs == nil {
+		var err error
+		secs, err = bi.openDwoOf(image, sk)
+		if err != nil {
+			return nil, err
+		}
+		for _, dwoID := range util.ReadUnitIDs(secs.info) {
+			if hasID && dwoID != id {
+				return nil, fmt.Errorf("%s does not match the executable", secs.path)
+			}
+		}
+	}
+
+	d, err := dwarf.New(secs.abbrev, nil, nil, secs.info, nil, nil, nil, secs.str)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", secs.path, err)
+	}
+	// The split unit does not have the attributes specifying the base of the
+	// entries it uses in debug_str_offsets, debug_rnglists and debug_addr,
+	// they are implicitly the start of the unit's entries in the first two
+	// and the base specified by the skeleton in the executable for the
+	// third. The sections are truncated so that the base is 0.
+	addrBase, _ := sk.cu.entry.Val(dwarfAttrAddrBase).(int64)
+	if err := addSplitSections(d, skipSectionHeader(secs.strOffsets, 4), skipSectionHeader(secs.rnglists, 8), image.debugAddr.Bytes(uint64(addrBase))); err != nil {
+		return nil, fmt.Errorf("%s: %v", secs.path, err)
+	}
+
+	dwo := &Image{
+		Path:         secs.path,
+		StaticBase:   image.StaticBase,
+		BuildID:      image.BuildID,
+		addr:         image.addr,
+		splitOf:      image,
+		dwarf:        d,
+		debugAddr:    image.debugAddr,
+		debugLineStr: image.debugLineStr,
+		typeCache:    make(map[dwarf.Offset]godwarf.Type),
+	}
+	dwo.dwarfReader = d.Reader()
+	dwo.dwarfTreeCache, _ = simplelru.NewLRU(dwarfTreeCacheSize, nil)
+	dwo.loclist2 = loclist.NewDwarf2Reader(nil, bi.Arch.PtrSize())
+	dwo.loclist5 = loclist.NewDwarf5Reader(secs.loclists)
+	dwo.index = len(bi.Images)
+	bi.Images = append(bi.Images, dwo)
+
+	bi.loadDebugInfoMapsUnits(dwo, secs.info, nil, sk.cu)
+	sort.Sort(compileUnitsByOffset(dwo.compileUnits))
+	if dwo.loadErr != nil {
+		// A broken split unit should not prevent debugging the rest of the
+		// program.
+		bi.logger.Warnf("%v", dwo.loadErr)
+		dwo.loadErr = nil
+	}
+	if len(dwo.compileUnits) == 0 {
+		return nil, errors.New("no compile unit found in " + secs.path)
+	}
+	return dwo, nil
+}
+
+// openDwoOf opens the split DWARF object file of sk, looking for it in
+// the compilation directory, in the directory of image and in the debug
+// info directories.
+func (bi *BinaryInfo) openDwoOf(image *Image, sk splitUnit) (*splitSections, error) {
+	var paths []string
+	if filepath.IsAbs(sk.dwoName) {
+		paths = append(paths, sk.dwoName)
+	} else {
+		paths = append(paths, filepath.Join(sk.compdir, sk.dwoName))
+	}
+	base := filepath.Base(sk.dwoName)
+	paths = append(paths, filepath.Join(filepath.Dir(image.Path), base))
+	for _, dir := range bi.debugInfoDirectories {
+		paths = append(paths, filepath.Join(dir, base))
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return openDwo(path)
+		}
+	}
+	return nil, fmt.Errorf("could not find %s", sk.dwoName)
+}
+
+// skipSectionHeader returns the contents of a DWARFv5 section following
+// the unit length and the n bytes of the rest of its header.
+func skipSectionHeader(data []byte, n int) []byte {
+	_, dwarf64, _, _ := util.ReadDwarfLengthVersion(data)
+	hdrsz := 4 + n
+	if dwarf64 {
+		hdrsz += 8
+	}
+	if len(data) < hdrsz {
+		return nil
+	}
+	return data[hdrsz:]
+}
@@ -0,0 +1,19 @@
+// +build !go1.14
+
+package proc
+
+import (
+	"debug/dwarf"
+	"errors"
+)
+
+// splitDwarfSupported is true if Delve can load split DWARF, which needs
+// (*dwarf.Data).AddSection.
+const splitDwarfSupported = false
+
+// addSplitSections returns an error, debug/dwarf can not read the string
+// offsets, range lists and addresses of split compile units before Go
+// 1.14.
+func addSplitSections(d *dwarf.Data, strOffsets, rnglists, addr []byte) error {
+	return errors.New("split DWARF is only supported when Delve is built with Go 1.14 or later")
+}
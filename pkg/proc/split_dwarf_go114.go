@@ -0,0 +1,22 @@
+// +build go1.14
+
+package proc
+
+import "debug/dwarf"
+
+// splitDwarfSupported is true if Delve can load split DWARF, which needs
+// (*dwarf.Data).AddSection.
+const splitDwarfSupported = true
+
+// addSplitSections adds to d, the debugging information of a split
+// compile unit, the sections of its string offsets, range lists and
+// addresses.
+func addSplitSections(d *dwarf.Data, strOffsets, rnglists, addr []byte) error {
+	if err := d.AddSection(".debug_str_offsets", strOffsets); err != nil {
+		return err
+	}
+	if err := d.AddSection(".debug_rnglists", rnglists); err != nil {
+		return err
+	}
+	return d.AddSection(".debug_addr", addr)
+}
@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"go/constant"
+	"reflect"
+	"strings"
 
 	"github.com/go-delve/delve/pkg/dwarf/frame"
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
 	"github.com/go-delve/delve/pkg/dwarf/op"
 	"github.com/go-delve/delve/pkg/dwarf/reader"
 )
@@ -113,6 +116,9 @@ func (g *G) stackIterator(opts StacktraceOptions) (*stackIterator, error) {
 	}
 
 	bi := g.variable.bi
+	if g.Thread == nil && bi.gccgo {
+		return nil, errGccgoParkedStack
+	}
 	if g.Thread != nil {
 		regs, err := g.Thread.Registers()
 		if err != nil {
@@ -321,7 +327,7 @@ func (it *stackIterator) newStackframe(ret, retaddr uint64) Stackframe {
 			// instruction to look for at pc - 1
 		default:
 			r.lastpc = it.pc - 1
-			r.Call.File, r.Call.Line = r.Current.Fn.cu.lineInfo.PCToLine(r.Current.Fn.Entry, it.pc-1)
+			r.Call.File, r.Call.Line = r.Current.Fn.pcToLine(it.pc - 1)
 		}
 	}
 	return r
@@ -355,7 +361,7 @@ func (it *stackIterator) appendInlineCalls(frames []Stackframe, frame Stackframe
 	if frame.Call.Fn == nil {
 		return append(frames, frame)
 	}
-	if frame.Call.Fn.cu.lineInfo == nil {
+	if frame.Call.Fn.cu.lines() == nil {
 		return append(frames, frame)
 	}
 
@@ -377,7 +383,8 @@ func (it *stackIterator) appendInlineCalls(frames []Stackframe, frame Stackframe
 		if !okname || !okfileidx || !okline {
 			break
 		}
-		if fileidx-1 < 0 || fileidx-1 >= int64(len(frame.Current.Fn.cu.lineInfo.FileNames)) {
+		callfile := frame.Current.Fn.cu.lines().FileIndex(fileidx)
+		if callfile == nil {
 			break
 		}
 
@@ -400,7 +407,7 @@ func (it *stackIterator) appendInlineCalls(frames []Stackframe, frame Stackframe
 			lastpc:      frame.lastpc,
 		})
 
-		frame.Call.File = frame.Current.Fn.cu.lineInfo.FileNames[fileidx-1].Path
+		frame.Call.File = callfile.Path
 		frame.Call.Line = int(line)
 	}
 
@@ -414,7 +421,10 @@ func (it *stackIterator) advanceRegs() (callFrameRegs op.DwarfRegisters, ret uin
 	fde, err := it.bi.frameEntries.FDEForPC(it.pc)
 	var framectx *frame.FrameContext
 	if _, nofde := err.(*frame.ErrNoFDEForPC); nofde {
-		framectx = it.bi.Arch.fixFrameUnwindContext(nil, it.pc, it.bi)
+		if fn := it.bi.PCToFunc(it.pc); fn != nil && fn.fromPclntab() {
+			framectx = fn.pclntabFrameContext(it.pc, it.bi.Arch)
+		}
+		framectx = it.bi.Arch.fixFrameUnwindContext(framectx, it.pc, it.bi)
 	} else {
 		framectx = it.bi.Arch.fixFrameUnwindContext(fde.EstablishFrame(it.pc), it.pc, it.bi)
 	}
@@ -529,9 +539,10 @@ func (it *stackIterator) loadG0SchedSP() {
 	}
 	it.g0_sched_sp_loaded = true
 	if it.g != nil {
-		mvar, _ := it.g.variable.structMember("m")
+		bi := it.g.variable.bi
+		mvar, _ := it.g.variable.structMember(bi.rtField("runtime.g", "m"))
 		if mvar != nil {
-			g0var, _ := mvar.structMember("g0")
+			g0var, _ := mvar.structMember(bi.rtField("runtime.m", "g0"))
 			if g0var != nil {
 				g0, _ := g0var.parseG()
 				if g0 != nil {
@@ -549,6 +560,7 @@ type Defer struct {
 	SP         uint64 // Value of SP register when this function was deferred (this field gets adjusted when the stack is moved to match the new stack space)
 	link       *Defer // Next deferred function
 	argSz      int64
+	fnAddr     uint64 // Address of the runtime.funcval of the deferred function
 
 	variable   *Variable
 	Unreadable error
@@ -599,25 +611,45 @@ func (g *G) readDefers(frames []Stackframe) {
 }
 
 func (d *Defer) load() {
-	d.variable.loadValue(LoadConfig{false, 1, 0, 0, -1, 0})
+	d.variable.loadValue(LoadConfig{false, 1, 0, 0, -1, 0, nil})
 	if d.variable.Unreadable != nil {
 		d.Unreadable = d.variable.Unreadable
 		return
 	}
 
-	fnvar := d.variable.fieldVariable("fn").maybeDereference()
-	if fnvar.Addr != 0 {
-		fnvar = fnvar.loadFieldNamed("fn")
-		if fnvar.Unreadable == nil {
-			d.DeferredPC, _ = constant.Uint64Val(fnvar.Value)
+	bi := d.variable.bi
+	fnvar := d.variable.fieldVariable(bi.rtField("runtime._defer", "fn"))
+	pcvar := d.variable.fieldVariable(bi.rtField("runtime._defer", "pc"))
+	spvar := d.variable.fieldVariable(bi.rtField("runtime._defer", "sp"))
+	linkvar := d.variable.fieldVariable(bi.rtField("runtime._defer", "link"))
+	if fnvar == nil || pcvar == nil || spvar == nil || linkvar == nil {
+		d.Unreadable = errors.New("malformed runtime._defer")
+		return
+	}
+
+	if fnvar.Kind == reflect.Func {
+		// Since Go 1.17 fn is a func() value
+		fnvar.readFunctionPtr()
+		d.fnAddr = fnvar.closureAddr
+		d.DeferredPC = uint64(fnvar.Base)
+	} else {
+		fnvar = fnvar.maybeDereference()
+		if fnvar.Addr != 0 {
+			d.fnAddr = uint64(fnvar.Addr)
+			fnvar = fnvar.loadFieldNamed(bi.rtField("runtime.funcval", "fn"))
+			if fnvar != nil {
+				d.DeferredPC, _ = constant.Uint64Val(fnvar.Value)
+			}
 		}
 	}
 
-	d.DeferPC, _ = constant.Uint64Val(d.variable.fieldVariable("pc").Value)
-	d.SP, _ = constant.Uint64Val(d.variable.fieldVariable("sp").Value)
-	d.argSz, _ = constant.Int64Val(d.variable.fieldVariable("siz").Value)
+	d.DeferPC, _ = constant.Uint64Val(pcvar.Value)
+	d.SP, _ = constant.Uint64Val(spvar.Value)
+	if sizvar := d.variable.fieldVariable(bi.rtField("runtime._defer", "siz")); sizvar != nil {
+		d.argSz, _ = constant.Int64Val(sizvar.Value)
+	}
 
-	linkvar := d.variable.fieldVariable("link").maybeDereference()
+	linkvar = linkvar.maybeDereference()
 	if linkvar.Addr != 0 {
 		d.link = &Defer{variable: linkvar}
 	}
@@ -679,3 +711,103 @@ func (d *Defer) EvalScope(thread Thread) (*EvalScope, error) {
 
 	return scope, nil
 }
+
+// Function returns the function called by the deferred call.
+// Since Go 1.17 defer statements calling a function with arguments defer
+// a compiler generated closure (named like main.f.deferwrap1) that calls
+// the function, in that case the function called by the closure is
+// returned, if it can be determined.
+func (d *Defer) Function(bi *BinaryInfo, mem MemoryReadWriter, breakpoints *BreakpointMap) *Function {
+	fn := bi.PCToFunc(d.DeferredPC)
+	if fn == nil || !strings.Contains(fn.Name, ".deferwrap") {
+		return fn
+	}
+	text, err := disassemble(mem, nil, breakpoints, bi, fn.Entry, fn.End, false)
+	if err != nil {
+		return fn
+	}
+	for _, instr := range text {
+		if !instr.IsCall() || instr.DestLoc == nil || instr.DestLoc.Fn == nil {
+			continue
+		}
+		if strings.HasPrefix(instr.DestLoc.Fn.Name, "runtime.morestack") {
+			continue
+		}
+		return instr.DestLoc.Fn
+	}
+	return fn
+}
+
+// CallsRecover returns true if the function called by the deferred call
+// calls recover, i.e. if it will stop a panic that happens while it is
+// pending. Calls to recover made by functions called by the deferred call
+// do not count, they always return nil.
+func (d *Defer) CallsRecover(bi *BinaryInfo, mem MemoryReadWriter, breakpoints *BreakpointMap) bool {
+	recoverFn := bi.LookupFunc["runtime.gorecover"]
+	fn := d.Function(bi, mem, breakpoints)
+	if recoverFn == nil || fn == nil {
+		return false
+	}
+	text, err := disassemble(mem, nil, breakpoints, bi, fn.Entry, fn.End, false)
+	if err != nil {
+		return false
+	}
+	for _, instr := range text {
+		if instr.IsCall() && instr.DestLoc != nil && instr.DestLoc.Fn == recoverFn {
+			return true
+		}
+	}
+	return false
+}
+
+// Arguments returns the arguments of the deferred call.
+// Before Go 1.17 these are the arguments of the deferred function, stored
+// after the defer header, since Go 1.17 the deferred function is a closure
+// without arguments and the variables it captures are returned instead.
+func (d *Defer) Arguments(thread Thread, cfg LoadConfig) ([]*Variable, error) {
+	if d.Unreadable != nil {
+		return nil, d.Unreadable
+	}
+	if d.argSz > 0 {
+		scope, err := d.EvalScope(thread)
+		if err != nil {
+			return nil, err
+		}
+		return scope.FunctionArguments(cfg)
+	}
+
+	bi := thread.BinInfo()
+	fn := bi.PCToFunc(d.DeferredPC)
+	if fn == nil {
+		return nil, fmt.Errorf("could not find function at %#x", d.DeferredPC)
+	}
+	if d.fnAddr == 0 {
+		return nil, nil
+	}
+	image := fn.cu.image
+	tree, err := image.getDwarfTree(fn.offset)
+	if err != nil {
+		return nil, err
+	}
+	vars := []*Variable{}
+	for _, entry := range tree.Children {
+		off, ok := entry.Val(godwarf.AttrGoClosureOffset).(int64)
+		if !ok {
+			continue
+		}
+		name, typ, err := readVarEntry(entry, image)
+		if err != nil {
+			return nil, err
+		}
+		v := newVariable(name, uintptr(int64(d.fnAddr)+off), typ, bi, thread)
+		if strings.HasPrefix(name, "&") {
+			// captured by reference
+			v = v.maybeDereference()
+			v.Name = name[1:]
+		}
+		vars = append(vars, v)
+	}
+	cfg.MaxMapBuckets = maxMapBucketsFactor * cfg.MaxArrayValues
+	loadValues(vars, cfg)
+	return vars, nil
+}
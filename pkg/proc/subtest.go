@@ -0,0 +1,86 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+
+	"github.com/go-delve/delve/pkg/astutil"
+)
+
+// SetSubtestBreakpoint creates the subtest-runner breakpoint, on
+// testing.tRunner, which stops the target when it starts running the test
+// or subtest called name, as reported by go test -v, for example
+// TestFoo/bar/baz. The function of the test, usually a closure passed to
+// t.Run, is returned by SubtestFunction.
+func (t *Target) SetSubtestBreakpoint(name string) error {
+	// tRunner(t *T, fn func(t *T))
+	return t.setTestBreakpoint(subtestRunnerID, SubtestRunner, "testing.tRunner", "t", name)
+}
+
+// SetFuzzBreakpoint creates the fuzz-runner breakpoint, on
+// testing.(*F).Fuzz, which stops the target when the fuzz test called name
+// passes its fuzz function to f.Fuzz, before running it with the inputs
+// of the corpus. The fuzz function is returned by SubtestFunction.
+func (t *Target) SetFuzzBreakpoint(name string) error {
+	// (f *F) Fuzz(ff interface{})
+	return t.setTestBreakpoint(fuzzRunnerID, FuzzRunner, "testing.(*F).Fuzz", "f", name)
+}
+
+func (t *Target) setTestBreakpoint(id int, bpname, fnname, arg, name string) error {
+	pcs, err := FindFunctionLocation(t.Process, fnname, 0)
+	if err != nil {
+		return err
+	}
+	bp, err := t.setBreakpointWithID(id, pcs[0])
+	if err != nil {
+		return err
+	}
+	bp.Name = bpname
+	bp.Cond = astutil.Eql(astutil.Sel(ast.NewIdent(arg), "name"), &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(name)})
+	return nil
+}
+
+// SubtestFunction returns the function of the test that thread, stopped at
+// the subtest-runner or at the fuzz-runner breakpoint, is about to run.
+// For subtests it also returns the goroutine that runs it, fuzz functions
+// run in new goroutines.
+func SubtestFunction(thread Thread) (*Function, *G, error) {
+	var expr string
+	switch thread.Breakpoint().Name {
+	case SubtestRunner:
+		expr = "fn"
+	case FuzzRunner:
+		expr = "ff"
+	default:
+		return nil, nil, fmt.Errorf("not stopped at the %s or %s breakpoint", SubtestRunner, FuzzRunner)
+	}
+	scope, err := GoroutineScope(thread)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := scope.EvalVariable(expr, LoadConfig{FollowPointers: true, MaxVariableRecurse: 1})
+	if err != nil {
+		return nil, nil, err
+	}
+	if v.Kind == reflect.Interface && len(v.Children) > 0 {
+		v = &v.Children[0]
+	}
+	if v.Unreadable != nil {
+		return nil, nil, v.Unreadable
+	}
+	if v.Kind != reflect.Func {
+		return nil, nil, fmt.Errorf("%s is not a function (%s)", expr, v.TypeString())
+	}
+	fn := thread.BinInfo().PCToFunc(uint64(v.Base))
+	if fn == nil {
+		return nil, nil, errors.New("the function of the test is nil")
+	}
+	if expr == "ff" {
+		return fn, nil, nil
+	}
+	return fn, scope.g, nil
+}
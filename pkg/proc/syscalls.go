@@ -0,0 +1,309 @@
+package proc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// SyscallEvent is the entry or the exit of a system call caught by a
+// thread, see Target.CatchSyscalls.
+type SyscallEvent struct {
+	Name   string
+	Number int
+	// Exit is true if the thread is returning from the system call, false
+	// if it is entering it.
+	Exit bool
+	// Args are the arguments of the system call, they are only known at
+	// its entry.
+	Args [6]uint64
+	// Ret is the value returned by the system call, IsError is true if it
+	// is an error number, negated.
+	Ret     int64
+	IsError bool
+}
+
+// ErrCatchSyscallsUnsupported is returned by CatchSyscalls if the backend
+// can not catch system calls.
+var ErrCatchSyscallsUnsupported = errors.New("catching system calls is not supported by the backend")
+
+// CatchSyscalls makes the target stop, with StopSyscall, when one of its
+// threads enters or returns from one of the system calls in names, or
+// stops catching system calls if names is empty. Only supported by the
+// native backend on linux, which traces every system call while any is
+// caught, slowing down the target.
+func (t *Target) CatchSyscalls(names []string) error {
+	cs, ok := t.proc.(interface {
+		CatchSyscalls([]string) error
+	})
+	if !ok {
+		return ErrCatchSyscallsUnsupported
+	}
+	return cs.CatchSyscalls(names)
+}
+
+// ThreadSyscallEvent returns the system call thread stopped at, or nil if
+// it did not stop because of a caught system call.
+func ThreadSyscallEvent(thread Thread) *SyscallEvent {
+	st, ok := thread.(interface {
+		SyscallEvent() *SyscallEvent
+	})
+	if !ok {
+		return nil
+	}
+	return st.SyscallEvent()
+}
+
+// syscallArgKind is how an argument of a system call is decoded.
+type syscallArgKind uint8
+
+const (
+	syscallArgHex       syscallArgKind = iota // raw value, for pointers and unknown arguments
+	syscallArgInt                             // signed integer
+	syscallArgOct                             // file mode
+	syscallArgFD                              // file descriptor, or AT_FDCWD
+	syscallArgPath                            // NUL terminated string
+	syscallArgOpenFlags                       // flags of open
+	syscallArgSockaddr                        // socket address, followed by its length
+)
+
+// syscallArgKinds are the arguments of the system calls that are decoded.
+var syscallArgKinds = map[string][]syscallArgKind{
+	"open":       {syscallArgPath, syscallArgOpenFlags, syscallArgOct},
+	"openat":     {syscallArgFD, syscallArgPath, syscallArgOpenFlags, syscallArgOct},
+	"creat":      {syscallArgPath, syscallArgOct},
+	"close":      {syscallArgFD},
+	"read":       {syscallArgFD, syscallArgHex, syscallArgInt},
+	"write":      {syscallArgFD, syscallArgHex, syscallArgInt},
+	"pread64":    {syscallArgFD, syscallArgHex, syscallArgInt, syscallArgInt},
+	"pwrite64":   {syscallArgFD, syscallArgHex, syscallArgInt, syscallArgInt},
+	"stat":       {syscallArgPath, syscallArgHex},
+	"lstat":      {syscallArgPath, syscallArgHex},
+	"fstat":      {syscallArgFD, syscallArgHex},
+	"newfstatat": {syscallArgFD, syscallArgPath, syscallArgHex, syscallArgHex},
+	"fstatat64":  {syscallArgFD, syscallArgPath, syscallArgHex, syscallArgHex},
+	"statx":      {syscallArgFD, syscallArgPath, syscallArgHex, syscallArgHex, syscallArgHex},
+	"access":     {syscallArgPath, syscallArgOct},
+	"faccessat":  {syscallArgFD, syscallArgPath, syscallArgOct},
+	"faccessat2": {syscallArgFD, syscallArgPath, syscallArgOct, syscallArgHex},
+	"unlink":     {syscallArgPath},
+	"unlinkat":   {syscallArgFD, syscallArgPath, syscallArgHex},
+	"mkdir":      {syscallArgPath, syscallArgOct},
+	"mkdirat":    {syscallArgFD, syscallArgPath, syscallArgOct},
+	"rmdir":      {syscallArgPath},
+	"chdir":      {syscallArgPath},
+	"rename":     {syscallArgPath, syscallArgPath},
+	"renameat":   {syscallArgFD, syscallArgPath, syscallArgFD, syscallArgPath},
+	"renameat2":  {syscallArgFD, syscallArgPath, syscallArgFD, syscallArgPath, syscallArgHex},
+	"readlink":   {syscallArgPath, syscallArgHex, syscallArgInt},
+	"readlinkat": {syscallArgFD, syscallArgPath, syscallArgHex, syscallArgInt},
+	"execve":     {syscallArgPath, syscallArgHex, syscallArgHex},
+	"execveat":   {syscallArgFD, syscallArgPath, syscallArgHex, syscallArgHex, syscallArgHex},
+	"socket":     {syscallArgInt, syscallArgInt, syscallArgInt},
+	"connect":    {syscallArgFD, syscallArgSockaddr, syscallArgInt},
+	"bind":       {syscallArgFD, syscallArgSockaddr, syscallArgInt},
+	"listen":     {syscallArgFD, syscallArgInt},
+	"accept":     {syscallArgFD, syscallArgHex, syscallArgHex},
+	"accept4":    {syscallArgFD, syscallArgHex, syscallArgHex, syscallArgHex},
+	"sendto":     {syscallArgFD, syscallArgHex, syscallArgInt, syscallArgHex, syscallArgSockaddr, syscallArgInt},
+	"dup":        {syscallArgFD},
+	"dup2":       {syscallArgFD, syscallArgFD},
+	"dup3":       {syscallArgFD, syscallArgFD, syscallArgHex},
+	"kill":       {syscallArgInt, syscallArgInt},
+	"tgkill":     {syscallArgInt, syscallArgInt, syscallArgInt},
+	"exit":       {syscallArgInt},
+	"exit_group": {syscallArgInt},
+}
+
+// syscallHexRet are the system calls returning addresses.
+var syscallHexRet = map[string]bool{"mmap": true, "mmap2": true, "mremap": true, "brk": true}
+
+// maxSyscallString is the maximum length of the strings read from the
+// arguments of system calls.
+const maxSyscallString = 256
+
+// FormatSyscallArgs returns the arguments of the system call ev, caught by
+// thread, decoded for the system calls that open files and sockets and
+// the most common ones operating on them; the arguments of the others are
+// returned as hexadecimal numbers. Returns nil when ev is the exit of a
+// system call.
+func FormatSyscallArgs(thread Thread, ev *SyscallEvent) []string {
+	if ev.Exit {
+		return nil
+	}
+	kinds, ok := syscallArgKinds[ev.Name]
+	if !ok {
+		kinds = make([]syscallArgKind, len(ev.Args))
+	}
+	arch := thread.BinInfo().Arch.Name
+	r := make([]string, len(kinds))
+	for i, kind := range kinds {
+		arg := ev.Args[i]
+		switch kind {
+		case syscallArgInt:
+			r[i] = strconv.FormatInt(syscallSigned(arch, arg), 10)
+		case syscallArgOct:
+			r[i] = fmt.Sprintf("%#o", arg)
+		case syscallArgFD:
+			// file descriptors are C ints, the upper half of the register
+			// is not always sign extended.
+			if fd := int64(int32(arg)); fd == atFdCwd {
+				r[i] = "AT_FDCWD"
+			} else {
+				r[i] = strconv.FormatInt(fd, 10)
+			}
+		case syscallArgPath:
+			r[i] = formatSyscallString(thread, arg)
+		case syscallArgOpenFlags:
+			r[i] = formatOpenFlags(arch, arg)
+		case syscallArgSockaddr:
+			r[i] = formatSockaddr(thread, arg, ev.Args[i+1])
+		default:
+			r[i] = fmt.Sprintf("%#x", arg)
+		}
+	}
+	return r
+}
+
+// FormatSyscallRet returns the value returned by the system call ev, with
+// the error it represents if it is an error number. Returns the empty
+// string when ev is the entry of a system call.
+func FormatSyscallRet(ev *SyscallEvent) string {
+	switch {
+	case !ev.Exit:
+		return ""
+	case ev.IsError:
+		return fmt.Sprintf("%d (%v)", ev.Ret, syscall.Errno(-ev.Ret))
+	case syscallHexRet[ev.Name]:
+		return fmt.Sprintf("%#x", uint64(ev.Ret))
+	}
+	return strconv.FormatInt(ev.Ret, 10)
+}
+
+// atFdCwd is the value of AT_FDCWD, the file descriptor argument of the
+// *at system calls for paths relative to the working directory.
+const atFdCwd = -100
+
+// syscallSigned returns the integer argument v of a system call on arch,
+// sign extended on 32 bit architectures.
+func syscallSigned(arch string, v uint64) int64 {
+	switch arch {
+	case "386", "arm":
+		return int64(int32(v))
+	}
+	return int64(v)
+}
+
+func formatSyscallString(mem MemoryReadWriter, addr uint64) string {
+	if addr == 0 {
+		return "NULL"
+	}
+	s, done, err := readCStringValue(mem, uintptr(addr), LoadConfig{MaxStringLen: maxSyscallString})
+	if err != nil {
+		return fmt.Sprintf("%#x", addr)
+	}
+	s = strconv.Quote(s)
+	if !done {
+		s += "..."
+	}
+	return s
+}
+
+// openFlags are the flags of open, and their values on each architecture
+// if they differ.
+var openFlags = []struct {
+	name  string
+	value uint64
+	arm   uint64 // value on arm and arm64
+}{
+	{"O_CREAT", 0x40, 0x40},
+	{"O_EXCL", 0x80, 0x80},
+	{"O_NOCTTY", 0x100, 0x100},
+	{"O_TRUNC", 0x200, 0x200},
+	{"O_APPEND", 0x400, 0x400},
+	{"O_NONBLOCK", 0x800, 0x800},
+	{"O_DSYNC", 0x1000, 0x1000},
+	{"O_DIRECT", 0x4000, 0x10000},
+	{"O_DIRECTORY", 0x10000, 0x4000},
+	{"O_NOFOLLOW", 0x20000, 0x8000},
+	{"O_NOATIME", 0x40000, 0x40000},
+	{"O_CLOEXEC", 0x80000, 0x80000},
+	{"O_PATH", 0x200000, 0x200000},
+}
+
+func formatOpenFlags(arch string, flags uint64) string {
+	var r []string
+	switch flags & 3 {
+	case 0:
+		r = append(r, "O_RDONLY")
+	case 1:
+		r = append(r, "O_WRONLY")
+	case 2:
+		r = append(r, "O_RDWR")
+	default:
+		r = append(r, "O_ACCMODE")
+	}
+	flags &^= 3
+	for _, f := range openFlags {
+		v := f.value
+		if arch == "arm" || arch == "arm64" {
+			v = f.arm
+		}
+		if flags&v != 0 {
+			r = append(r, f.name)
+			flags &^= v
+		}
+	}
+	if flags != 0 {
+		r = append(r, fmt.Sprintf("%#x", flags))
+	}
+	return strings.Join(r, "|")
+}
+
+// Address families of the socket addresses decoded by formatSockaddr.
+const (
+	afUnix  = 1
+	afInet  = 2
+	afInet6 = 10
+)
+
+// maxSockaddrLen is the size of struct sockaddr_storage.
+const maxSockaddrLen = 128
+
+// formatSockaddr returns the socket address of length n at addr.
+func formatSockaddr(mem MemoryReadWriter, addr, n uint64) string {
+	if addr == 0 {
+		return "NULL"
+	}
+	if n < 2 || n > maxSockaddrLen {
+		return fmt.Sprintf("%#x", addr)
+	}
+	buf := make([]byte, n)
+	if _, err := mem.ReadMemory(buf, uintptr(addr)); err != nil {
+		return fmt.Sprintf("%#x", addr)
+	}
+	// The family is in the byte order of the target, the port in network
+	// byte order; all the architectures supported are little endian.
+	family := binary.LittleEndian.Uint16(buf)
+	switch {
+	case family == afInet && n >= 8:
+		return net.JoinHostPort(net.IP(buf[4:8]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(buf[2:]))))
+	case family == afInet6 && n >= 24:
+		return net.JoinHostPort(net.IP(buf[8:24]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(buf[2:]))))
+	case family == afUnix:
+		path := buf[2:]
+		if len(path) > 0 && path[0] == 0 {
+			// abstract socket address
+			return strconv.Quote("@" + string(path[1:]))
+		}
+		if i := strings.IndexByte(string(path), 0); i >= 0 {
+			path = path[:i]
+		}
+		return strconv.Quote(string(path))
+	}
+	return fmt.Sprintf("{family %d}", family)
+}
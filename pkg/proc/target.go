@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"go/constant"
 	"os"
+	"runtime/debug"
 	"strings"
 
 	"github.com/go-delve/delve/pkg/goversion"
@@ -48,6 +49,13 @@ type Target struct {
 	// have read and parsed from the targets memory.
 	// This must be cleared whenever the target is resumed.
 	gcache goroutineCache
+
+	// stepSkipPackages are the packages that Step will not stop in, see
+	// SetStepSkipPackages.
+	stepSkipPackages []string
+
+	// coverage holds the lines tracked by line coverage, see AddCoverage.
+	coverage coverage
 }
 
 // ErrProcessExited indicates that the process has exited and contains both
@@ -61,6 +69,23 @@ func (pe ErrProcessExited) Error() string {
 	return fmt.Sprintf("Process %d has exited with status %d", pe.Pid, pe.Status)
 }
 
+// ErrInternal is returned when the debugger finds an inconsistency in its
+// own state, or in the state of the target, that indicates a bug of Delve
+// or of its backend.
+type ErrInternal struct {
+	Msg string
+	// Stack is the stack of the debugger where the error was found.
+	Stack string
+}
+
+func internalErrorf(format string, args ...interface{}) *ErrInternal {
+	return &ErrInternal{Msg: fmt.Sprintf(format, args...), Stack: string(debug.Stack())}
+}
+
+func (err *ErrInternal) Error() string {
+	return "internal error: " + err.Msg
+}
+
 // StopReason describes the reason why the target process is stopped.
 // A process could be stopped for multiple simultaneous reasons, in which
 // case only one will be reported.
@@ -76,6 +101,7 @@ const (
 	StopManual                         // A manual stop was requested
 	StopNextFinished                   // The next/step/stepout command terminated
 	StopCallReturned                   // An injected call completed
+	StopSyscall                        // A thread entered or returned from a caught system call, see CatchSyscalls
 )
 
 // NewTargetConfig contains the configuration for a new Target object,
@@ -84,6 +110,7 @@ type NewTargetConfig struct {
 	DebugInfoDirs       []string   // Directories to search for split debug info
 	DisableAsyncPreempt bool       // Go 1.14 asynchronous preemption should be disabled
 	StopReason          StopReason // Initial stop reason
+	BinInfoLoaded       bool       // The BinaryInfo of the process is already loaded, for example because it is shared with another target
 }
 
 // DisableAsyncPreemptEnv returns a process environment (like os.Environ)
@@ -107,9 +134,11 @@ func NewTarget(p Process, cfg NewTargetConfig) (*Target, error) {
 		return nil, err
 	}
 
-	err = p.BinInfo().LoadBinaryInfo(cfg.Path, entryPoint, cfg.DebugInfoDirs)
-	if err != nil {
-		return nil, err
+	if !cfg.BinInfoLoaded {
+		err = p.BinInfo().LoadBinaryInfo(cfg.Path, entryPoint, cfg.DebugInfoDirs)
+		if err != nil {
+			return nil, err
+		}
 	}
 	for _, image := range p.BinInfo().Images {
 		if image.loadErr != nil {
@@ -150,6 +179,35 @@ func (t *Target) SupportsFunctionCalls() bool {
 	return t.Process.BinInfo().Arch.Name == "amd64"
 }
 
+// CompileConditions enables or disables the compilation of the conditions
+// of user breakpoints to predicates evaluated by the target without
+// stopping, see CompilePredicate. Returns false if the backend does not
+// support it.
+func (t *Target) CompileConditions(enabled bool) bool {
+	cc, ok := t.proc.(interface{ CompileConditions(bool) bool })
+	return ok && cc.CompileConditions(enabled)
+}
+
+// ErrFollowExecUnsupported is returned by FollowExec if the backend can
+// not follow the children of the target.
+var ErrFollowExecUnsupported = errors.New("following child processes is not supported by the backend")
+
+// FollowExec starts following the child processes of the target or, if fn
+// is nil, stops: every time a child of the target calls execve it is left
+// stopped by SIGSTOP and passed to fn, with the path of its new
+// executable, so that a debugger can attach to it. fn is called while the
+// target is being continued, it must resume the child or hand it over
+// without blocking. Only supported by the native backend on linux.
+func (t *Target) FollowExec(fn func(pid int, path string)) error {
+	fe, ok := t.proc.(interface {
+		FollowExec(func(int, string)) error
+	})
+	if !ok {
+		return ErrFollowExecUnsupported
+	}
+	return fe.FollowExec(fn)
+}
+
 // ClearAllGCache clears the internal Goroutine cache.
 // This should be called anytime the target process executes instructions.
 func (t *Target) ClearAllGCache() {
@@ -168,6 +226,10 @@ func (t *Target) Restart(from string) error {
 	if err != nil {
 		return err
 	}
+	// the invocations tracked by AtExit breakpoints are gone
+	if err := t.clearExitInvocations(nil); err != nil {
+		return err
+	}
 	t.selectedGoroutine, _ = GetG(t.CurrentThread())
 	if from != "" {
 		t.StopReason = StopManual
@@ -278,6 +340,30 @@ func (t *Target) createUnrecoveredPanicBreakpoint() {
 	}
 }
 
+// SetExitBreakpoints creates the os-exit breakpoint, on os.Exit, and the
+// log-fatal breakpoint, on the Fatal, Fatalf and Fatalln functions of the
+// log package and methods of log.Logger. Functions that are not linked
+// into the executable are skipped.
+func (t *Target) SetExitBreakpoints() {
+	exitpcs, err := FindFunctionLocation(t.Process, "os.Exit", 0)
+	if err == nil {
+		bp, err := t.setBreakpointWithID(osExitID, exitpcs[0])
+		if err == nil {
+			bp.Name = OSExit
+			bp.Variables = []string{"code"}
+		}
+	}
+	var fatalpcs []uint64
+	for _, fnname := range []string{"log.Fatal", "log.Fatalf", "log.Fatalln", "log.(*Logger).Fatal", "log.(*Logger).Fatalf", "log.(*Logger).Fatalln"} {
+		if pcs, err := FindFunctionLocation(t.Process, fnname, 0); err == nil {
+			fatalpcs = append(fatalpcs, pcs[0])
+		}
+	}
+	for _, bp := range t.setLogicalBreakpointWithID(logFatalID, fatalpcs) {
+		bp.Name = LogFatal
+	}
+}
+
 // createFatalThrowBreakpoint creates the a breakpoint as runtime.fatalthrow.
 func (t *Target) createFatalThrowBreakpoint() {
 	fatalpcs, err := FindFunctionLocation(t.Process, "runtime.fatalthrow", 0)
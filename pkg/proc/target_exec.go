@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"path/filepath"
 	"strings"
@@ -14,6 +15,7 @@ import (
 )
 
 const maxSkipAutogeneratedWrappers = 5 // maximum recursion depth for skipAutogeneratedWrappers
+const maxSkipPackagesFrames = 50       // maximum number of frames skipped by skipPackagesOut
 
 // ErrNoSourceForPC is returned when the given address
 // does not correspond with a source file location.
@@ -51,6 +53,7 @@ func (dbp *Target) Continue() error {
 	}
 	for _, thread := range dbp.ThreadList() {
 		thread.Common().returnValues = nil
+		thread.Common().returnFn = nil
 	}
 	dbp.CheckAndClearManualStopRequest()
 	defer func() {
@@ -68,6 +71,7 @@ func (dbp *Target) Continue() error {
 			return nil
 		}
 		dbp.ClearAllGCache()
+		dbp.BinInfo().clearStaleSources()
 		trapthread, stopReason, err := dbp.proc.ContinueOnce()
 		dbp.StopReason = stopReason
 		if err != nil {
@@ -103,12 +107,28 @@ func (dbp *Target) Continue() error {
 			return callErr
 		}
 
+		if err := dbp.handleExitBreakpoints(threads); err != nil {
+			return err
+		}
+
 		curthread := dbp.CurrentThread()
+		covered := curthread.Breakpoint().covered != nil
+		if err := dbp.handleCoverageBreakpoints(threads); err != nil {
+			return err
+		}
 		curbp := curthread.Breakpoint()
+		if covered && curbp.Breakpoint == nil && !callInjectionDone {
+			// only hit a coverage breakpoint, that was cleared
+			continue
+		}
 
 		switch {
 		case curbp.Breakpoint == nil:
-			// runtime.Breakpoint, manual stop or debugCallV1-related stop
+			// runtime.Breakpoint, manual stop, caught system call or
+			// debugCallV1-related stop
+			if dbp.StopReason == StopSyscall {
+				return conditionErrors(threads)
+			}
 			recorded, _ := dbp.Recorded()
 			if recorded {
 				return conditionErrors(threads)
@@ -150,7 +170,7 @@ func (dbp *Target) Continue() error {
 				return conditionErrors(threads)
 			}
 		case curbp.Active && curbp.Internal:
-			switch curbp.Kind {
+			switch curbp.Kind &^ (ExitBreakpoint | CoverageBreakpoint) {
 			case StepBreakpoint:
 				// See description of proc.(*Process).next for the meaning of StepBreakpoints
 				if err := conditionErrors(threads); err != nil {
@@ -165,10 +185,18 @@ func (dbp *Target) Continue() error {
 					if loc, _ := curthread.Location(); loc != nil {
 						fn = loc.Fn
 					}
+					// The breakpoint into the destination of the CALL instruction is
+					// armed for the goroutine that the step breakpoint was armed for,
+					// the selected goroutine could be unknown or different if the
+					// goroutine was migrated to a different thread.
+					cond := goroutineCondition(curbp.internalCond)
+					if cond == nil {
+						cond = sameGoroutineCondition(dbp.SelectedGoroutine())
+					}
 					// here we either set a breakpoint into the destination of the CALL
 					// instruction or we determined that the called function is hidden,
 					// either way we need to resume execution
-					if err = setStepIntoBreakpoint(dbp, fn, text, sameGoroutineCondition(dbp.SelectedGoroutine())); err != nil {
+					if err = setStepIntoBreakpoint(dbp, fn, text, cond); err != nil {
 						return err
 					}
 				} else {
@@ -177,8 +205,26 @@ func (dbp *Target) Continue() error {
 					}
 					return dbp.StepInstruction()
 				}
+			case ChanSendBreakpoint:
+				// See description of proc.(*Target).StepFollowChannel
+				if err := conditionErrors(threads); err != nil {
+					return err
+				}
+				if err := followChannelReceiver(dbp, curthread); err != nil {
+					return err
+				}
+			case CallReturnBreakpoint:
+				// See description of proc.next for the meaning of CallReturnBreakpoints
+				if err := conditionErrors(threads); err != nil {
+					return err
+				}
+				if curbp.returnInfo != nil {
+					collectReturnValues(curthread, curbp.returnInfo)
+				} else if err := setCallReturnBreakpointOnCall(dbp, curthread, curbp.internalCond); err != nil {
+					return err
+				}
 			default:
-				curthread.Common().returnValues = curbp.Breakpoint.returnInfo.Collect(curthread)
+				collectReturnValues(curthread, curbp.Breakpoint.returnInfo)
 				if err := dbp.ClearInternalBreakpoints(); err != nil {
 					return err
 				}
@@ -282,6 +328,45 @@ func stepInstructionOut(dbp *Target, curthread Thread, fnname1, fnname2 string)
 // Step will continue until another source line is reached.
 // Will step into functions.
 func (dbp *Target) Step() (err error) {
+	return dbp.step(false)
+}
+
+// StepFollowChannel is like Step but if the current line sends a value on
+// a channel and a goroutine is waiting to receive from it, execution will
+// stop in the receiving goroutine, after it has received the value, rather
+// than in the current goroutine.
+func (dbp *Target) StepFollowChannel() error {
+	if dbp.GetDirection() == Backward {
+		return fmt.Errorf("can not follow channel sends backwards")
+	}
+	return dbp.step(true)
+}
+
+// SetStepSkipPackages sets the packages that Step will not stop in: calls
+// to functions of these packages, or of the packages below them, are
+// stepped over and returning into one of them continues to the first
+// caller that isn't in them. They are not skipped while stepping through
+// one of their functions.
+func (dbp *Target) SetStepSkipPackages(pkgs []string) {
+	dbp.stepSkipPackages = pkgs
+}
+
+// stepSkip returns true if fn belongs to one of the packages set with
+// SetStepSkipPackages.
+func (dbp *Target) stepSkip(fn *Function) bool {
+	if fn == nil {
+		return false
+	}
+	pkg := fn.PackageName()
+	for _, skip := range dbp.stepSkipPackages {
+		if pkg == skip || strings.HasPrefix(pkg, skip+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (dbp *Target) step(followChannel bool) (err error) {
 	if _, err := dbp.Valid(); err != nil {
 		return err
 	}
@@ -298,6 +383,13 @@ func (dbp *Target) Step() (err error) {
 		}
 	}
 
+	if followChannel {
+		if err := setChanSendBreakpoint(dbp); err != nil {
+			dbp.ClearInternalBreakpoints()
+			return err
+		}
+	}
+
 	if bp := dbp.CurrentThread().Breakpoint().Breakpoint; bp != nil && bp.Kind == StepBreakpoint && dbp.GetDirection() == Backward {
 		dbp.ClearInternalBreakpoints()
 		return dbp.StepInstruction()
@@ -546,7 +638,7 @@ func next(dbp *Target, stepInto, inlinedStepOut bool) error {
 	}
 
 	// Add breakpoints on all the lines in the current function
-	pcs, err := topframe.Current.Fn.cu.lineInfo.AllPCsBetween(topframe.Current.Fn.Entry, topframe.Current.Fn.End-1, topframe.Current.File, topframe.Current.Line)
+	pcs, err := topframe.Current.Fn.cu.lines().AllPCsBetween(topframe.Current.Fn.Entry, topframe.Current.Fn.End-1, topframe.Current.File, topframe.Current.Line)
 	if err != nil {
 		return err
 	}
@@ -601,6 +693,12 @@ func next(dbp *Target, stepInto, inlinedStepOut bool) error {
 		}
 	}
 
+	if !stepInto && !backward && selg != nil {
+		if err := setCallReturnBreakpoints(dbp, text, topframe, selg, sameFrameCond); err != nil {
+			return err
+		}
+	}
+
 	if stepInto && backward {
 		err := setStepIntoBreakpointsReverse(dbp, text, topframe, sameGCond)
 		if err != nil {
@@ -610,30 +708,35 @@ func next(dbp *Target, stepInto, inlinedStepOut bool) error {
 
 	if !topframe.Inlined {
 		topframe, retframe := skipAutogeneratedWrappersOut(selg, curthread, &topframe, &retframe)
-		retFrameCond := astutil.And(sameGCond, frameoffCondition(retframe))
-		var sameOrRetFrameCond ast.Expr
-		if sameGCond != nil {
-			sameOrRetFrameCond = astutil.And(sameGCond, astutil.Or(frameoffCondition(topframe), frameoffCondition(retframe)))
-		}
+		if stepInto && !backward && !dbp.stepSkip(topframe.Current.Fn) {
+			topframe, retframe = skipPackagesOut(dbp, selg, curthread, topframe, retframe)
+		}
+		if retframe != nil {
+			retFrameCond := astutil.And(sameGCond, frameoffCondition(retframe))
+			var sameOrRetFrameCond ast.Expr
+			if sameGCond != nil {
+				sameOrRetFrameCond = astutil.And(sameGCond, astutil.Or(frameoffCondition(topframe), frameoffCondition(retframe)))
+			}
 
-		// Add a breakpoint on the return address for the current frame.
-		// For inlined functions there is no need to do this, the set of PCs
-		// returned by the AllPCsBetween call above already cover all instructions
-		// of the containing function.
-		bp, err := dbp.SetBreakpoint(retframe.Current.PC, NextBreakpoint, retFrameCond)
-		if _, isexists := err.(BreakpointExistsError); isexists {
-			if bp.Kind == NextBreakpoint {
-				// If the return address shares the same address with one of the lines
-				// of the function (because we are stepping through a recursive
-				// function) then the corresponding breakpoint should be active both on
-				// this frame and on the return frame.
-				bp.Cond = sameOrRetFrameCond
+			// Add a breakpoint on the return address for the current frame.
+			// For inlined functions there is no need to do this, the set of PCs
+			// returned by the AllPCsBetween call above already cover all instructions
+			// of the containing function.
+			bp, err := dbp.SetBreakpoint(retframe.Current.PC, NextBreakpoint, retFrameCond)
+			if _, isexists := err.(BreakpointExistsError); isexists {
+				if bp.Kind == NextBreakpoint {
+					// If the return address shares the same address with one of the lines
+					// of the function (because we are stepping through a recursive
+					// function) then the corresponding breakpoint should be active both on
+					// this frame and on the return frame.
+					bp.Cond = sameOrRetFrameCond
+				}
+			}
+			// Return address could be wrong, if we are unable to set a breakpoint
+			// there it's ok.
+			if bp != nil {
+				configureReturnBreakpoint(dbp.BinInfo(), bp, topframe, retFrameCond)
 			}
-		}
-		// Return address could be wrong, if we are unable to set a breakpoint
-		// there it's ok.
-		if bp != nil {
-			configureReturnBreakpoint(dbp.BinInfo(), bp, topframe, retFrameCond)
 		}
 	}
 
@@ -664,6 +767,65 @@ func setStepIntoBreakpoints(dbp *Target, curfn *Function, text []AsmInstruction,
 	return nil
 }
 
+// setCallReturnBreakpoints sets a CallReturnBreakpoint on the return
+// address of each call of the current line, or on the CALL instruction if
+// its destination isn't known, so that the values returned by the called
+// functions are collected, even if the caller discards them.
+func setCallReturnBreakpoints(dbp *Target, text []AsmInstruction, topframe Stackframe, g *G, sameFrameCond ast.Expr) error {
+	for _, instr := range text {
+		if instr.Loc.File != topframe.Current.File || instr.Loc.Line != topframe.Current.Line || !instr.IsCall() {
+			continue
+		}
+		if instr.DestLoc == nil {
+			if _, err := allowDuplicateBreakpoint(dbp.SetBreakpoint(instr.Loc.PC, CallReturnBreakpoint, sameFrameCond)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := setCallReturnBreakpoint(dbp, instr, g, topframe.Regs.SP(), sameFrameCond); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setCallReturnBreakpointOnCall sets a CallReturnBreakpoint on the return
+// address of the CALL instruction curthread is stopped at.
+func setCallReturnBreakpointOnCall(dbp *Target, curthread Thread, cond ast.Expr) error {
+	g, err := GetG(curthread)
+	if err != nil || g == nil {
+		return err
+	}
+	regs, err := curthread.Registers()
+	if err != nil {
+		return err
+	}
+	text, err := disassembleCurrentInstruction(dbp, curthread, 0)
+	if err != nil || len(text) == 0 || text[0].DestLoc == nil {
+		return err
+	}
+	return setCallReturnBreakpoint(dbp, text[0], g, regs.SP(), cond)
+}
+
+// setCallReturnBreakpoint sets a CallReturnBreakpoint on the return
+// address of instr, a call executed by g with the stack pointer at sp.
+// Calls to unexported runtime functions, inserted by the compiler, are
+// ignored.
+func setCallReturnBreakpoint(dbp *Target, instr AsmInstruction, g *G, sp uint64, cond ast.Expr) error {
+	fn := instr.DestLoc.Fn
+	if fn == nil || fn.privateRuntime() {
+		return nil
+	}
+	bp, err := allowDuplicateBreakpoint(dbp.SetBreakpoint(instr.Loc.PC+uint64(instr.Size), CallReturnBreakpoint, cond))
+	if err != nil {
+		return err
+	}
+	if bp != nil {
+		configureCallReturnBreakpoint(dbp.BinInfo(), bp, fn, g, sp, cond)
+	}
+	return nil
+}
+
 func setStepIntoBreakpointsReverse(dbp *Target, text []AsmInstruction, topframe Stackframe, sameGCond ast.Expr) error {
 	// Set a breakpoint after every CALL instruction
 	for i, instr := range text {
@@ -752,9 +914,10 @@ func setStepIntoBreakpoint(dbp *Target, curfn *Function, text []AsmInstruction,
 		return nil
 	}
 
-	//TODO(aarzilli): if we want to let users hide functions
-	// or entire packages from being stepped into with 'step'
-	// those extra checks should be done here.
+	// Skip functions of the packages set by SetStepSkipPackages
+	if !dbp.stepSkip(curfn) && dbp.stepSkip(fn) {
+		return nil
+	}
 
 	pc := instr.DestLoc.PC
 
@@ -888,7 +1051,7 @@ func skipAutogeneratedWrappersOut(g *G, thread Thread, startTopframe, startRetfr
 		if frame.Current.Fn == nil {
 			return
 		}
-		file, line := frame.Current.Fn.cu.lineInfo.PCToLine(frame.Current.Fn.Entry, frame.Current.Fn.Entry)
+		file, line := frame.Current.Fn.pcToLine(frame.Current.Fn.Entry)
 		if !isAutogenerated(Location{File: file, Line: line, Fn: frame.Current.Fn}) {
 			return &frames[i-1], &frames[i]
 		}
@@ -896,6 +1059,43 @@ func skipAutogeneratedWrappersOut(g *G, thread Thread, startTopframe, startRetfr
 	return
 }
 
+// skipPackagesOut skips the frames of the packages set by
+// SetStepSkipPackages when setting the return breakpoint of a step, it
+// returns the first caller that doesn't belong to them and the frame it
+// called, or nil if there is no such caller.
+func skipPackagesOut(dbp *Target, g *G, thread Thread, startTopframe, startRetframe *Stackframe) (topframe, retframe *Stackframe) {
+	if !dbp.stepSkip(startRetframe.Current.Fn) {
+		return startTopframe, startRetframe
+	}
+	var err error
+	var frames []Stackframe
+	if g == nil {
+		if thread.Blocked() {
+			return startTopframe, startRetframe
+		}
+		frames, err = ThreadStacktrace(thread, maxSkipPackagesFrames)
+	} else {
+		frames, err = g.Stacktrace(maxSkipPackagesFrames, 0)
+	}
+	if err != nil {
+		return startTopframe, startRetframe
+	}
+	for i := range frames {
+		if frames[i].FrameOffset() == startRetframe.FrameOffset() && frames[i].Current.PC == startRetframe.Current.PC {
+			for i++; i < len(frames); i++ {
+				if frames[i].Current.Fn == nil {
+					return nil, nil
+				}
+				if !dbp.stepSkip(frames[i].Current.Fn) {
+					return &frames[i-1], &frames[i]
+				}
+			}
+			return nil, nil
+		}
+	}
+	return startTopframe, startRetframe
+}
+
 // setDeferBreakpoint is a helper function used by next and StepOut to set a
 // breakpoint on the first deferred function.
 func setDeferBreakpoint(p *Target, text []AsmInstruction, topframe Stackframe, sameGCond ast.Expr, stepInto bool) (uint64, error) {
@@ -1012,30 +1212,129 @@ func onNextGoroutine(thread Thread, breakpoints *BreakpointMap) (bool, error) {
 	if bp == nil {
 		return false, nil
 	}
-	// Internal breakpoint conditions can take multiple different forms:
-	// Step into breakpoints:
-	//   runtime.curg.goid == X
-	// Next or StepOut breakpoints:
-	//   runtime.curg.goid == X && runtime.frameoff == Y
-	// Breakpoints that can be hit either by stepping on a line in the same
-	// function or by returning from the function:
-	//   runtime.curg.goid == X && (runtime.frameoff == Y || runtime.frameoff == Z)
-	// Here we are only interested in testing the runtime.curg.goid clause.
-	w := onNextGoroutineWalker{thread: thread}
-	ast.Walk(&w, bp.internalCond)
-	return w.ret, w.err
+	cond := goroutineCondition(bp.internalCond)
+	if cond == nil {
+		return false, nil
+	}
+	return evalBreakpointCondition(thread, cond)
+}
+
+// goroutineCondition returns the runtime.curg.goid clause of the condition
+// of an internal breakpoint, or nil if it doesn't have one.
+// Internal breakpoint conditions can take multiple different forms:
+// Step into breakpoints:
+//   runtime.curg.goid == X
+// Next or StepOut breakpoints:
+//   runtime.curg.goid == X && runtime.frameoff == Y
+// Breakpoints that can be hit either by stepping on a line in the same
+// function or by returning from the function:
+//   runtime.curg.goid == X && (runtime.frameoff == Y || runtime.frameoff == Z)
+func goroutineCondition(cond ast.Expr) ast.Expr {
+	if cond == nil {
+		return nil
+	}
+	w := goroutineConditionWalker{}
+	ast.Walk(&w, cond)
+	return w.cond
 }
 
-type onNextGoroutineWalker struct {
-	thread Thread
-	ret    bool
-	err    error
+type goroutineConditionWalker struct {
+	cond ast.Expr
 }
 
-func (w *onNextGoroutineWalker) Visit(n ast.Node) ast.Visitor {
+func (w *goroutineConditionWalker) Visit(n ast.Node) ast.Visitor {
 	if binx, isbin := n.(*ast.BinaryExpr); isbin && binx.Op == token.EQL && exprToString(binx.X) == "runtime.curg.goid" {
-		w.ret, w.err = evalBreakpointCondition(w.thread, n.(ast.Expr))
+		w.cond = binx
+		return nil
+	}
+	if w.cond != nil {
 		return nil
 	}
 	return w
 }
+
+// setChanSendBreakpoint sets a breakpoint of kind ChanSendBreakpoint after
+// the prologue of runtime.chansend1 if the current line of the selected
+// goroutine sends a value on a channel.
+func setChanSendBreakpoint(dbp *Target) error {
+	const chansend = "runtime.chansend1"
+	chansendFn := dbp.BinInfo().LookupFunc[chansend]
+	if chansendFn == nil {
+		return nil
+	}
+	selg := dbp.SelectedGoroutine()
+	curthread := dbp.CurrentThread()
+	topframe, _, err := topframe(selg, curthread)
+	if err != nil {
+		return err
+	}
+	if topframe.Current.Fn == nil {
+		return nil
+	}
+	var thread MemoryReadWriter = curthread
+	var regs Registers
+	if selg != nil && selg.Thread != nil {
+		thread = selg.Thread
+		regs, err = selg.Thread.Registers()
+		if err != nil {
+			return err
+		}
+	}
+	text, err := disassemble(thread, regs, dbp.Breakpoints(), dbp.BinInfo(), topframe.Current.Fn.Entry, topframe.Current.Fn.End, false)
+	if err != nil {
+		return err
+	}
+	for _, instr := range text {
+		if instr.Loc.File != topframe.Current.File || instr.Loc.Line != topframe.Current.Line || !instr.IsCall() {
+			continue
+		}
+		if instr.DestLoc == nil || instr.DestLoc.Fn != chansendFn {
+			continue
+		}
+		pc, err := FirstPCAfterPrologue(dbp, chansendFn, false)
+		if err != nil {
+			return err
+		}
+		_, err = allowDuplicateBreakpoint(dbp.SetBreakpoint(pc, ChanSendBreakpoint, sameGoroutineCondition(selg)))
+		return err
+	}
+	return nil
+}
+
+// followChannelReceiver is called when the goroutine being stepped by
+// StepFollowChannel reaches the ChanSendBreakpoint on runtime.chansend1.
+// If a goroutine is waiting to receive from the channel the step is
+// redirected to it: all internal breakpoints are cleared and a breakpoint is
+// set on the return address of its first frame that is not in the runtime.
+// Otherwise the step continues normally.
+func followChannelReceiver(dbp *Target, curthread Thread) error {
+	var recvg *G
+	if scope, err := GoroutineScope(curthread); err == nil {
+		if v, err := scope.EvalExpression("c.recvq.first.g.goid", loadSingleValue); err == nil && v.Unreadable == nil && v.Value != nil {
+			n, _ := constant.Int64Val(v.Value)
+			recvg, _ = FindGoroutine(dbp, int(n))
+		}
+	}
+
+	if recvg == nil {
+		return nil
+	}
+
+	frames, err := recvg.Stacktrace(maxSkipAutogeneratedWrappers+4, 0)
+	if err != nil {
+		return err
+	}
+	if err := dbp.ClearInternalBreakpoints(); err != nil {
+		return err
+	}
+	for i := range frames {
+		frame := &frames[i]
+		if frame.Current.Fn == nil || frame.Current.Fn.privateRuntime() {
+			continue
+		}
+		cond := astutil.And(sameGoroutineCondition(recvg), frameoffCondition(frame))
+		_, err := allowDuplicateBreakpoint(dbp.SetBreakpoint(frame.Current.PC, NextBreakpoint, cond))
+		return err
+	}
+	return fmt.Errorf("could not find the caller of the receive operation of goroutine %d", recvg.ID)
+}
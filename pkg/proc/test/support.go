@@ -77,6 +77,9 @@ const (
 	BuildModePIE
 	BuildModePlugin
 	AllNonOptimized
+	// LinkStripDWARF enables '-ldflags="-w"', which removes the debug
+	// information but not the symbol table.
+	LinkStripDWARF
 )
 
 // BuildFixture will compile the fixture 'name' using the provided build flags.
@@ -116,6 +119,9 @@ func BuildFixture(name string, flags BuildFlags) Fixture {
 	if flags&LinkStrip != 0 {
 		buildFlags = append(buildFlags, "-ldflags=-s")
 	}
+	if flags&LinkStripDWARF != 0 {
+		buildFlags = append(buildFlags, "-ldflags=-w")
+	}
 	gcflagsv := []string{}
 	if flags&EnableInlining == 0 {
 		gcflagsv = append(gcflagsv, "-l")
@@ -59,7 +59,8 @@ func (tbe ErrThreadBlocked) Error() string {
 // implementations of the Thread interface.
 type CommonThread struct {
 	returnValues []*Variable
-	g            *G // cached g for this thread
+	returnFn     *Function // function that returned returnValues
+	g            *G        // cached g for this thread
 }
 
 // ReturnValues reads the return values from the function executing on
@@ -69,6 +70,37 @@ func (t *CommonThread) ReturnValues(cfg LoadConfig) []*Variable {
 	return t.returnValues
 }
 
+// ReturnFunction returns the function that returned the values returned
+// by ReturnValues, if known.
+func (t *CommonThread) ReturnFunction() *Function {
+	return t.returnFn
+}
+
+// ThreadMP returns the IDs of the M, the OS thread of the runtime, of
+// thread and of the P it holds, -1 if they are unknown, for example for
+// the threads not created by the runtime, or if the M does not hold a P.
+// Unlike the M returned by G.MP it is also known for the threads that are
+// not running any goroutine.
+func ThreadMP(thread Thread) (m, p int) {
+	bi := thread.BinInfo()
+	if bi.flavor != nil || bi.tinyGo || bi.gccgo || bi.unavailableReason(FeatureGoroutines) != "" {
+		return -1, -1
+	}
+	if loc, _ := thread.Location(); loc != nil && loc.Fn != nil && loc.Fn.Name == "runtime.clone" {
+		// the value of TLS is unreliable, see GetG.
+		return -1, -1
+	}
+	gvar, err := getGVariable(thread)
+	if err != nil {
+		return -1, -1
+	}
+	gvar = gvar.maybeDereference()
+	if gvar.Unreadable != nil || gvar.Addr == 0 {
+		return -1, -1
+	}
+	return gvarMP(gvar)
+}
+
 // topframe returns the two topmost frames of g, or thread if g is nil.
 func topframe(g *G, thread Thread) (Stackframe, Stackframe, error) {
 	var frames []Stackframe
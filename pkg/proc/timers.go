@@ -0,0 +1,277 @@
+package proc
+
+import (
+	"errors"
+	"go/constant"
+	"reflect"
+	"sort"
+)
+
+// Timer is a pending timer of the runtime, see Timers.
+type Timer struct {
+	Addr uint64
+	// When is the time the timer fires, on the monotonic clock of the
+	// runtime, the one of runtime.nanotime.
+	When int64
+	// Period is the period of a ticker, 0 for the timers firing once.
+	Period int64
+	// Kind is what created the timer: "timer" for a time.Timer, "ticker"
+	// for a time.Ticker, "afterfunc" for time.AfterFunc, "sleep" for
+	// time.Sleep and "runtime" for the others, for example the deadlines of
+	// network connections.
+	Kind string
+	// Func is the function called by the runtime when the timer fires.
+	Func string
+	// Callback is the function passed to time.AfterFunc.
+	Callback string
+	// Waiters are the IDs of the goroutines receiving from the channel of a
+	// time.Timer or time.Ticker, or of the goroutine sleeping.
+	Waiters []int
+	// P is the ID of the P holding the timer in its heap, -1 before Go 1.14
+	// where the timers are in global buckets.
+	P int
+}
+
+// Callbacks of the timers of package time, see Timer.Kind.
+const (
+	timerSendTime       = "time.sendTime"
+	timerGoFunc         = "time.goFunc"
+	timerGoroutineReady = "runtime.goroutineReady"
+)
+
+// States of the timers skipped by Timers, see $GOROOT/src/runtime/time.go.
+const (
+	// Go 1.14 to 1.22, values of the status field.
+	timerDeleted         = 3
+	timerRemoving        = 4
+	timerRemoved         = 5
+	timerModifiedEarlier = 7
+	timerModifiedLater   = 8
+
+	// Since Go 1.23, bit of the state field.
+	timerZombie = 4
+)
+
+// maxTimers is the maximum number of timers returned by Timers, in case
+// the heaps are corrupted.
+const maxTimers = 1 << 20
+
+// Timers returns the pending timers of the runtime, sorted by the time
+// they fire, reading the heaps of timers of the Ps, or the global buckets
+// before Go 1.14, from the memory of the target, therefore it also works
+// on core files. Since Go 1.23 the timers of the channels of time.Timer
+// and time.Ticker are only in the heaps while a goroutine is receiving
+// from them, unless the GODEBUG setting asynctimerchan=1 restores the
+// behavior of the previous versions.
+func Timers(t *Target) ([]Timer, error) {
+	scope, err := ThreadScope(t.CurrentThread())
+	if err != nil {
+		return nil, err
+	}
+	var r []Timer
+	if allp, err := scope.findGlobal("runtime", "allp"); err == nil {
+		allp.loadValue(loadSingleValue)
+		if allp.Unreadable != nil {
+			return nil, allp.Unreadable
+		}
+		for i := int64(0); i < allp.Len; i++ {
+			p, err := allp.sliceAccess(int(i))
+			if err != nil {
+				return nil, err
+			}
+			p = p.maybeDereference()
+			if p.Unreadable != nil || p.Addr == 0 {
+				continue
+			}
+			id := int(i)
+			if idv, err := p.structMember("id"); err == nil {
+				if n, err := idv.asInt(); err == nil {
+					id = int(n)
+				}
+			}
+			ts, err := p.structMember("timers")
+			if err != nil {
+				return nil, err
+			}
+			// since Go 1.23 the heap is in a timers struct.
+			if ts.Kind == reflect.Struct {
+				if ts, err = ts.structMember("heap"); err != nil {
+					return nil, err
+				}
+			}
+			if r, err = appendTimers(r, ts, id); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		buckets, err := scope.findGlobal("runtime", "timers")
+		if err != nil {
+			return nil, errors.New("could not find the timers of the runtime")
+		}
+		// before Go 1.10 there is a single bucket.
+		n := int64(1)
+		if buckets.Kind == reflect.Array {
+			n = buckets.Len
+		}
+		for i := int64(0); i < n; i++ {
+			b := buckets
+			if buckets.Kind == reflect.Array {
+				if b, err = buckets.sliceAccess(int(i)); err != nil {
+					return nil, err
+				}
+			}
+			ts, err := b.structMember("t")
+			if err != nil {
+				return nil, err
+			}
+			if r, err = appendTimers(r, ts, -1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].When < r[j].When })
+	return r, nil
+}
+
+// appendTimers appends to r the pending timers in ts, a heap of timers of
+// the P with ID p, a slice of *runtime.timer or, since Go 1.23, of
+// runtime.timerWhen.
+func appendTimers(r []Timer, ts *Variable, p int) ([]Timer, error) {
+	ts.loadValue(loadSingleValue)
+	if ts.Unreadable != nil {
+		return nil, ts.Unreadable
+	}
+	for i := int64(0); i < ts.Len; i++ {
+		if len(r) >= maxTimers {
+			return nil, errors.New("too many timers")
+		}
+		tv, err := ts.sliceAccess(int(i))
+		if err != nil {
+			return nil, err
+		}
+		if tv.Kind == reflect.Struct {
+			if tv, err = tv.structMember("timer"); err != nil {
+				return nil, err
+			}
+		}
+		tv = tv.maybeDereference()
+		if tv.Unreadable != nil || tv.Addr == 0 {
+			continue
+		}
+		timer, ok, err := readTimer(tv)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			timer.P = p
+			r = append(r, timer)
+		}
+	}
+	return r, nil
+}
+
+// readTimer reads the runtime.timer tv, returns false if it was stopped
+// and is waiting to be removed from its heap.
+func readTimer(tv *Variable) (Timer, bool, error) {
+	timer := Timer{Addr: uint64(tv.Addr), Kind: "runtime"}
+	for _, f := range []struct {
+		name string
+		n    *int64
+	}{{"when", &timer.When}, {"period", &timer.Period}} {
+		fv, err := tv.structMember(f.name)
+		if err != nil {
+			return timer, false, err
+		}
+		if *f.n, err = fv.asInt(); err != nil {
+			return timer, false, err
+		}
+	}
+
+	if state, err := tv.structMember("state"); err == nil {
+		if n, err := state.asUint(); err == nil && n&timerZombie != 0 {
+			return timer, false, nil
+		}
+	} else if status, err := tv.structMember("status"); err == nil {
+		// status is an atomic.Uint32 since Go 1.20.
+		if status.Kind == reflect.Struct {
+			status, _ = status.structMember("value")
+		}
+		var n uint64
+		if status != nil {
+			n, _ = status.asUint()
+		}
+		switch n {
+		case timerDeleted, timerRemoving, timerRemoved:
+			return timer, false, nil
+		case timerModifiedEarlier, timerModifiedLater:
+			if nextwhen, err := tv.structMember("nextwhen"); err == nil {
+				timer.When, _ = nextwhen.asInt()
+			}
+		}
+	}
+
+	f, err := tv.structMember("f")
+	if err != nil {
+		return timer, false, err
+	}
+	f.loadValue(loadSingleValue)
+	if f.Unreadable != nil {
+		return timer, false, f.Unreadable
+	}
+	if f.Value == nil {
+		return timer, true, nil
+	}
+	timer.Func = constant.StringVal(f.Value)
+	arg, err := tv.structMember("arg")
+	if err != nil {
+		return timer, false, err
+	}
+	timer.decodeArg(arg)
+	return timer, true, nil
+}
+
+// decodeArg sets the kind of timer, and what it is waited on by, from the
+// argument of the callbacks of package time. The dynamic type of the
+// argument is known from the callback, it is read directly from the data
+// word of the interface, without the type information of the runtime.
+func (timer *Timer) decodeArg(arg *Variable) {
+	bi := arg.bi
+	data := arg.Addr + uintptr(bi.Arch.PtrSize())
+	switch timer.Func {
+	case timerSendTime:
+		timer.Kind = "timer"
+		if timer.Period > 0 {
+			timer.Kind = "ticker"
+		}
+		if typ, err := bi.findType("chan time.Time"); err == nil {
+			timer.Waiters = chanWaiters(newVariable("", data, typ, bi, arg.mem), "recvq")
+		}
+	case timerGoFunc:
+		timer.Kind = "afterfunc"
+		if typ, err := bi.findType("func()"); err == nil {
+			fn := newVariable("", data, typ, bi, arg.mem)
+			fn.loadValue(loadSingleValue)
+			if fn.Unreadable == nil && fn.Value != nil {
+				timer.Callback = constant.StringVal(fn.Value)
+			}
+		}
+	case timerGoroutineReady:
+		timer.Kind = "sleep"
+		gaddr, err := readUintRaw(arg.mem, data, int64(bi.Arch.PtrSize()))
+		if err != nil || gaddr == 0 {
+			return
+		}
+		typ, err := bi.findType("runtime.g")
+		if err != nil {
+			return
+		}
+		g := newVariable("", uintptr(gaddr), typ, bi, arg.mem)
+		if goid, err := g.structMember("goid"); err == nil {
+			goid.loadValue(loadSingleValue)
+			if goid.Value != nil {
+				n, _ := constant.Int64Val(goid.Value)
+				timer.Waiters = []int{int(n)}
+			}
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package proc
+
+import (
+	"debug/dwarf"
+	"errors"
+	"go/constant"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+)
+
+// Programs built with TinyGo use the LLVM toolchain and a runtime of their
+// own: there is no runtime.g structure, goroutines are tasks of package
+// internal/task (with the "tasks" scheduler, the default on most targets)
+// that are switched on a single thread by tinygo_swapTask, and the compile
+// units are marked as C99 rather than Go.
+// See https://github.com/tinygo-org/tinygo/tree/release/src/internal/task.
+
+const (
+	tinyGoProducer = "TinyGo"
+	tinyGoTaskType = "internal/task.Task"
+
+	// maxTinyGoTasks is the maximum number of tasks read from a task queue,
+	// to stop at corrupted queues.
+	maxTinyGoTasks = 1 << 16
+)
+
+var errFuncCallUnsupportedTinyGo = errors.New("function calls are not supported for programs built with TinyGo")
+
+// tinyGoSwapFrame describes the frame that tinygo_swapTask pushes on the
+// stack of a task before saving its stack pointer: the offsets, from the
+// saved stack pointer, of the return address and of the frame pointer,
+// and the size of the frame including the return address (if it is pushed
+// on the stack).
+type tinyGoSwapFrame struct {
+	ret, bp, size uint64
+}
+
+var tinyGoSwapFrames = map[string]tinyGoSwapFrame{
+	// pushq %r15, %r14, %r13, %r12, %rbp, %rbx
+	"amd64": {ret: 6 * 8, bp: 1 * 8, size: 7 * 8},
+	// pushl %ebp, %edi, %esi, %ebx
+	"386": {ret: 4 * 4, bp: 3 * 4, size: 5 * 4},
+	// stp x19, x20, [sp, #-160]! ... stp x29, x30, [sp, #80] ...
+	"arm64": {ret: 88, bp: 80, size: 160},
+}
+
+// isTinyGoProducer returns true if producer is the DW_AT_producer of a
+// compile unit created by TinyGo.
+func isTinyGoProducer(producer string) bool {
+	return strings.HasPrefix(producer, tinyGoProducer)
+}
+
+// TinyGo returns true if the executable was built with TinyGo.
+func (bi *BinaryInfo) TinyGo() bool {
+	return bi.tinyGo
+}
+
+// tinyGoPackageVar returns the package variable called name, or nil if it
+// does not exist.
+func (bi *BinaryInfo) tinyGoPackageVar(mem MemoryReadWriter, name string) *Variable {
+	for _, pkgvar := range bi.packageVars {
+		if pkgvar.name != name || pkgvar.addr == 0 {
+			continue
+		}
+		rdr := pkgvar.cu.image.DwarfReader()
+		rdr.Seek(pkgvar.offset)
+		entry, err := rdr.Next()
+		if err != nil || entry == nil {
+			return nil
+		}
+		off, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			return nil
+		}
+		typ, err := pkgvar.cu.image.Type(off)
+		if err != nil {
+			return nil
+		}
+		return newVariable(name, uintptr(pkgvar.addr), typ, bi, mem)
+	}
+	return nil
+}
+
+// tinyGoCurrentTask returns the address of the task running on thread, or
+// 0 if thread is running the scheduler or if the scheduler does not use
+// tasks.
+func tinyGoCurrentTask(thread Thread) (uint64, error) {
+	bi := thread.BinInfo()
+	v := bi.tinyGoPackageVar(thread, "internal/task.currentTask")
+	if v == nil {
+		return 0, nil
+	}
+	return readUintRaw(thread, v.Addr, int64(bi.Arch.PtrSize()))
+}
+
+// tinyGoTask returns the goroutine for the task at address addr. The ID of
+// the goroutine is the ID of the task, for the versions of TinyGo that
+// assign one, and its address otherwise. Unless running is true, the
+// location of the goroutine is read from the frame saved by
+// tinygo_swapTask.
+func tinyGoTask(bi *BinaryInfo, mem MemoryReadWriter, addr uint64, status uint64, running bool) (*G, error) {
+	typ, err := bi.findType(tinyGoTaskType)
+	if err != nil {
+		return nil, err
+	}
+	v := newVariable("", uintptr(addr), typ, bi, mem)
+	v.mem = cacheMemory(v.mem, v.Addr, int(typ.Size()))
+
+	g := &G{ID: int(addr), Status: status, variable: v}
+	state := v.loadFieldNamed("state")
+	if state == nil {
+		return nil, ErrUnreadableG
+	}
+	if id := state.fieldVariable("id"); id != nil && id.Value != nil {
+		if n, _ := constant.Int64Val(id.Value); n != 0 {
+			g.ID = int(n)
+		}
+	}
+	if canary, ok := tinyGoPointerField(state, "canaryPtr"); ok {
+		g.stack.lo = canary
+	}
+	if running {
+		return g, nil
+	}
+
+	frame, ok := tinyGoSwapFrames[bi.Arch.Name]
+	sp := state.fieldVariable("sp")
+	if !ok || sp == nil || sp.Value == nil {
+		return g, nil
+	}
+	savedSP, _ := constant.Uint64Val(sp.Value)
+	if savedSP == 0 {
+		// The task has not started yet.
+		return g, nil
+	}
+	ptrSize := int64(bi.Arch.PtrSize())
+	ret, err := readUintRaw(mem, uintptr(savedSP+frame.ret), ptrSize)
+	if err != nil {
+		return nil, err
+	}
+	bp, err := readUintRaw(mem, uintptr(savedSP+frame.bp), ptrSize)
+	if err != nil {
+		return nil, err
+	}
+	g.PC, g.SP, g.BP, g.LR = ret, savedSP+frame.size, bp, ret
+	f, l, fn := bi.PCToLine(g.PC)
+	g.CurrentLoc = Location{PC: g.PC, File: f, Line: l, Fn: fn}
+	return g, nil
+}
+
+// tinyGoGetG returns the goroutine running on thread, see GetG.
+func tinyGoGetG(thread Thread) (*G, error) {
+	addr, err := tinyGoCurrentTask(thread)
+	if err != nil || addr == 0 {
+		// The scheduler runs on the system stack, outside of any goroutine.
+		return nil, err
+	}
+	g, err := tinyGoTask(thread.BinInfo(), thread, addr, Grunning, true)
+	if err != nil {
+		return nil, err
+	}
+	if regs, err := thread.Registers(); err == nil && regs.SP() < g.stack.lo {
+		// The task is only switched on one thread, this one is not it (or
+		// the scheduler did not reset currentTask yet).
+		return nil, nil
+	}
+	g.Thread = thread
+	if loc, err := thread.Location(); err == nil {
+		g.CurrentLoc = *loc
+	}
+	thread.Common().g = g
+	return g, nil
+}
+
+// tinyGoGoroutines returns the goroutines of a program built with TinyGo,
+// see GoroutinesInfo. Only the running tasks and the tasks in the run
+// queue and in the sleep queue of the scheduler can be found, the tasks
+// blocked on a channel or on a mutex are referenced only by it.
+func tinyGoGoroutines(dbp *Target, start, count int) ([]*G, int, error) {
+	bi := dbp.BinInfo()
+	mem := dbp.CurrentThread()
+
+	var allg []*G
+	seen := make(map[uint64]bool)
+
+	for _, th := range dbp.ThreadList() {
+		if th.Blocked() {
+			continue
+		}
+		if g, _ := GetG(th); g != nil && !seen[uint64(g.variable.Addr)] {
+			seen[uint64(g.variable.Addr)] = true
+			allg = append(allg, g)
+		}
+	}
+
+	addQueue := func(head uint64, status uint64) {
+		for i := 0; head != 0 && !seen[head] && i < maxTinyGoTasks; i++ {
+			seen[head] = true
+			g, err := tinyGoTask(bi, mem, head, status, false)
+			if err != nil {
+				allg = append(allg, &G{Unreadable: err})
+				return
+			}
+			allg = append(allg, g)
+			next, ok := tinyGoPointerField(g.variable, "Next")
+			if !ok {
+				return
+			}
+			head = next
+		}
+	}
+
+	if runqueue := bi.tinyGoPackageVar(mem, "runtime.runqueue"); runqueue != nil {
+		if head, ok := tinyGoPointerField(runqueue, "head"); ok {
+			addQueue(head, Grunnable)
+		}
+	}
+	if sleepQueue := bi.tinyGoPackageVar(mem, "runtime.sleepQueue"); sleepQueue != nil {
+		if head, err := readUintRaw(mem, sleepQueue.Addr, int64(bi.Arch.PtrSize())); err == nil {
+			addQueue(head, Gwaiting)
+		}
+	}
+
+	for _, g := range allg {
+		if g.Unreadable == nil {
+			dbp.gcache.addGoroutine(g)
+		}
+	}
+
+	if start >= len(allg) {
+		return nil, -1, nil
+	}
+	allg = allg[start:]
+	if count != 0 && len(allg) > count {
+		return allg[:count], start + count, nil
+	}
+	return allg, -1, nil
+}
+
+// tinyGoPointerField returns the value of the pointer field called name
+// of the struct variable v.
+func tinyGoPointerField(v *Variable, name string) (uint64, bool) {
+	field, err := v.structMember(name)
+	if err != nil || field.Unreadable != nil {
+		return 0, false
+	}
+	if _, isptr := field.RealType.(*godwarf.PtrType); !isptr {
+		return 0, false
+	}
+	ptr, err := readUintRaw(field.mem, field.Addr, int64(v.bi.Arch.PtrSize()))
+	return ptr, err == nil
+}
@@ -109,6 +109,9 @@ func newLoadDebugInfoMapsContext(bi *BinaryInfo, image *Image, offsetToVersion m
 //   the type and map it drectly to a DIE.
 func runtimeTypeToDIE(_type *Variable, dataAddr uintptr) (typ godwarf.Type, kind int64, err error) {
 	bi := _type.bi
+	if err := bi.checkFeature(FeatureInterfaces); err != nil {
+		return nil, 0, err
+	}
 
 	_type = _type.maybeDereference()
 
@@ -401,7 +404,7 @@ func nameOfInterfaceRuntimeType(mds []moduleData, _type *Variable, kind, tflag i
 	buf.WriteString("interface {")
 
 	methods, _ := _type.structMember(interfacetypeFieldMhdr)
-	methods.loadArrayValues(0, LoadConfig{false, 1, 0, 4096, -1, 0})
+	methods.loadArrayValues(0, LoadConfig{false, 1, 0, 4096, -1, 0, nil})
 	if methods.Unreadable != nil {
 		return "", nil
 	}
@@ -462,7 +465,7 @@ func nameOfStructRuntimeType(mds []moduleData, _type *Variable, kind, tflag int6
 	buf.WriteString("struct {")
 
 	fields, _ := _type.structMember("fields")
-	fields.loadArrayValues(0, LoadConfig{false, 2, 0, 4096, -1, 0})
+	fields.loadArrayValues(0, LoadConfig{false, 2, 0, 4096, -1, 0, nil})
 	if fields.Unreadable != nil {
 		return "", fields.Unreadable
 	}
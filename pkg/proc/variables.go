@@ -16,7 +16,6 @@ import (
 
 	"github.com/go-delve/delve/pkg/dwarf/godwarf"
 	"github.com/go-delve/delve/pkg/dwarf/op"
-	"github.com/go-delve/delve/pkg/goversion"
 )
 
 const (
@@ -28,9 +27,6 @@ const (
 	chanSend = "chan send"
 
 	hashTophashEmptyZero = 0 // used by map reading code, indicates an empty cell
-	hashTophashEmptyOne  = 1 // used by map reading code, indicates an empty cell in Go 1.12 and later
-	hashMinTopHashGo111  = 4 // used by map reading code, indicates minimum value of tophash that isn't empty or evacuated, in Go1.11
-	hashMinTopHashGo112  = 5 // used by map reading code, indicates minimum value of tophash that isn't empty or evacuated, in Go1.12
 
 	maxFramePrefetchSize = 1 * 1024 * 1024 // Maximum prefetch size for a stack frame
 
@@ -167,11 +163,32 @@ type LoadConfig struct {
 	// sparse map is in scope, but evaluating a single variable will still work
 	// correctly, even if the variable in question is a very sparse map.
 	MaxMapBuckets int
+
+	// Cancel, if not nil, abandons loading when it is closed: the values that
+	// were not loaded yet are marked unreadable with ErrCancelled.
+	Cancel <-chan struct{}
 }
 
-var loadSingleValue = LoadConfig{false, 0, 64, 0, 0, 0}
-var loadFullValue = LoadConfig{true, 1, 64, 64, -1, 0}
-var loadFullValueLongerStrings = LoadConfig{true, 1, 1024 * 1024, 64, -1, 0}
+// ErrCancelled is the error of variables whose loading was cancelled, see
+// LoadConfig.Cancel.
+var ErrCancelled = errors.New("cancelled")
+
+// Cancelled returns true if loading with cfg was cancelled.
+func (cfg *LoadConfig) Cancelled() bool {
+	if cfg.Cancel == nil {
+		return false
+	}
+	select {
+	case <-cfg.Cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+var loadSingleValue = LoadConfig{false, 0, 64, 0, 0, 0, nil}
+var loadFullValue = LoadConfig{true, 1, 64, 64, -1, 0, nil}
+var loadFullValueLongerStrings = LoadConfig{true, 1, 1024 * 1024, 64, -1, 0, nil}
 
 // G status, from: src/runtime/runtime2.go
 const (
@@ -190,6 +207,7 @@ const (
 // fields that Delve is interested in).
 type G struct {
 	ID        int    // Goroutine ID
+	Name      string // Name of the goroutine, for the threads of interest of flavors
 	PC        uint64 // PC of goroutine when it was parked.
 	SP        uint64 // SP of goroutine when it was parked.
 	BP        uint64 // BP of goroutine when it was parked (go >= 1.7).
@@ -239,6 +257,22 @@ func GetG(thread Thread) (*G, error) {
 	if thread.Common().g != nil {
 		return thread.Common().g, nil
 	}
+	if thread.BinInfo().flavor != nil {
+		return flavorGetG(thread)
+	}
+	if thread.BinInfo().tinyGo {
+		return tinyGoGetG(thread)
+	}
+	if thread.BinInfo().gccgo {
+		// The current goroutine of libgo is a thread local variable of C
+		// code, which can not be read.
+		return nil, nil
+	}
+	if thread.BinInfo().unavailableReason(FeatureGoroutines) != "" {
+		// Without the debug information of the runtime the threads are not
+		// associated with goroutines.
+		return nil, nil
+	}
 	if loc, _ := thread.Location(); loc != nil && loc.Fn != nil && loc.Fn.Name == "runtime.clone" {
 		// When threads are executing runtime.clone the value of TLS is unreliable.
 		return nil, nil
@@ -260,11 +294,11 @@ func GetG(thread Thread) (*G, error) {
 		// For our purposes it's better if we always return the real goroutine
 		// since the rest of the code assumes the goroutine ID is univocal.
 		// The real 'current goroutine' is stored in g0.m.curg
-		mvar, err := g.variable.structMember("m")
+		mvar, err := g.variable.structMember(thread.BinInfo().rtField("runtime.g", "m"))
 		if err != nil {
 			return nil, err
 		}
-		curgvar, err := mvar.structMember("curg")
+		curgvar, err := mvar.structMember(thread.BinInfo().rtField("runtime.m", "curg"))
 		if err != nil {
 			return nil, err
 		}
@@ -302,6 +336,15 @@ func GoroutinesInfo(dbp *Target, start, count int) ([]*G, int, error) {
 			return dbp.gcache.allGCache, -1, nil
 		}
 	}
+	if dbp.BinInfo().flavor != nil {
+		return flavorGoroutines(dbp, start, count)
+	}
+	if dbp.BinInfo().tinyGo {
+		return tinyGoGoroutines(dbp, start, count)
+	}
+	if err := dbp.BinInfo().checkFeature(FeatureGoroutines); err != nil {
+		return nil, -1, err
+	}
 
 	var (
 		threadg = map[int]*G{}
@@ -469,7 +512,7 @@ func (g *G) Defer() *Defer {
 	if g.variable.Unreadable != nil {
 		return nil
 	}
-	dvar, _ := g.variable.structMember("_defer")
+	dvar, _ := g.variable.structMember(g.variable.bi.rtField("runtime.g", "_defer"))
 	if dvar == nil {
 		return nil
 	}
@@ -482,6 +525,19 @@ func (g *G) Defer() *Defer {
 	return d
 }
 
+// Panicking returns true if the goroutine is panicking.
+func (g *G) Panicking() bool {
+	if g.variable.Unreadable != nil {
+		return false
+	}
+	pvar, _ := g.variable.structMember(g.variable.bi.rtField("runtime.g", "_panic"))
+	if pvar == nil {
+		return false
+	}
+	pvar = pvar.maybeDereference()
+	return pvar.Unreadable == nil && pvar.Addr != 0
+}
+
 // UserCurrent returns the location the users code is at,
 // or was at before entering a runtime function.
 func (g *G) UserCurrent() Location {
@@ -527,7 +583,7 @@ func (g *G) Labels() map[string]string {
 		return *g.labels
 	}
 	var labels map[string]string
-	if labelsVar := g.variable.loadFieldNamed("labels"); labelsVar != nil && len(labelsVar.Children) == 1 {
+	if labelsVar := g.variable.loadFieldNamed(g.variable.bi.rtField("runtime.g", "labels")); labelsVar != nil && len(labelsVar.Children) == 1 {
 		if address := labelsVar.Children[0]; address.Addr != 0 {
 			labelMapType, _ := g.variable.bi.findType("runtime/pprof.labelMap")
 			if labelMapType != nil {
@@ -548,6 +604,56 @@ func (g *G) Labels() map[string]string {
 	return *g.labels
 }
 
+// MP returns the IDs of the M, the OS thread of the runtime, running g and
+// of the P it holds, -1 if g is not running on an M, for example because it
+// is waiting, or if the M does not hold a P, for example while g is in a
+// system call.
+func (g *G) MP() (m, p int) {
+	if g.variable == nil || g.variable.bi.flavor != nil || g.variable.bi.tinyGo || g.variable.bi.gccgo {
+		return -1, -1
+	}
+	return gvarMP(g.variable)
+}
+
+// gvarMP returns the IDs of the M of the runtime.g gvar and of its P, see
+// G.MP.
+func gvarMP(gvar *Variable) (m, p int) {
+	m, p = -1, -1
+	bi := gvar.bi
+	mvar, err := gvar.structMember(bi.rtField("runtime.g", "m"))
+	if err != nil {
+		return m, p
+	}
+	mvar = mvar.maybeDereference()
+	if mvar.Unreadable != nil || mvar.Addr == 0 {
+		return m, p
+	}
+	if id, err := mvar.structMember(bi.rtField("runtime.m", "id")); err == nil {
+		if n, err := id.asInt(); err == nil {
+			m = int(n)
+		}
+	}
+	// m.p is a puintptr, not a pointer.
+	pfield, err := mvar.structMember(bi.rtField("runtime.m", "p"))
+	if err != nil {
+		return m, p
+	}
+	paddr, err := readUintRaw(gvar.mem, pfield.Addr, int64(bi.Arch.PtrSize()))
+	if err != nil || paddr == 0 {
+		return m, p
+	}
+	ptyp, err := bi.findType("runtime.p")
+	if err != nil {
+		return m, p
+	}
+	if id, err := newVariable("", uintptr(paddr), ptyp, bi, gvar.mem).structMember(bi.rtField("runtime.p", "id")); err == nil {
+		if n, err := id.asInt(); err == nil {
+			p = int(n)
+		}
+	}
+	return m, p
+}
+
 type Ancestor struct {
 	ID         int64 // Goroutine ID
 	Unreadable error
@@ -821,24 +927,32 @@ func (v *Variable) parseG() (*G, error) {
 
 	v.mem = cacheMemory(v.mem, v.Addr, int(v.RealType.Size()))
 
-	schedVar := v.loadFieldNamed("sched")
+	bi := v.bi
+	schedVar := v.loadFieldNamed(bi.rtField("runtime.g", "sched"))
 	if schedVar == nil {
+		if v.bi.gccgo {
+			return v.parseGccgoG()
+		}
 		return nil, ErrUnreadableG
 	}
-	pc, _ := constant.Int64Val(schedVar.fieldVariable("pc").Value)
-	sp, _ := constant.Int64Val(schedVar.fieldVariable("sp").Value)
+	pcvar, spvar := schedVar.fieldVariable(bi.rtField("runtime.gobuf", "pc")), schedVar.fieldVariable(bi.rtField("runtime.gobuf", "sp"))
+	if pcvar == nil || spvar == nil {
+		return nil, ErrUnreadableG
+	}
+	pc, _ := constant.Int64Val(pcvar.Value)
+	sp, _ := constant.Int64Val(spvar.Value)
 	var bp, lr int64
-	if bpvar := schedVar.fieldVariable("bp"); bpvar != nil && bpvar.Value != nil {
+	if bpvar := schedVar.fieldVariable(bi.rtField("runtime.gobuf", "bp")); bpvar != nil && bpvar.Value != nil {
 		bp, _ = constant.Int64Val(bpvar.Value)
 	}
-	if bpvar := schedVar.fieldVariable("lr"); bpvar != nil && bpvar.Value != nil {
+	if bpvar := schedVar.fieldVariable(bi.rtField("runtime.gobuf", "lr")); bpvar != nil && bpvar.Value != nil {
 		lr, _ = constant.Int64Val(bpvar.Value)
 	}
 
 	unreadable := false
 
 	loadInt64Maybe := func(name string) int64 {
-		vv := v.loadFieldNamed(name)
+		vv := v.loadFieldNamed(bi.rtField("runtime.g", name))
 		if vv == nil {
 			unreadable = true
 			return 0
@@ -851,17 +965,17 @@ func (v *Variable) parseG() (*G, error) {
 	gopc := loadInt64Maybe("gopc")
 	startpc := loadInt64Maybe("startpc")
 	var stackhi, stacklo uint64
-	if stackVar := v.loadFieldNamed("stack"); stackVar != nil {
-		if stackhiVar := stackVar.fieldVariable("hi"); stackhiVar != nil {
+	if stackVar := v.loadFieldNamed(bi.rtField("runtime.g", "stack")); stackVar != nil {
+		if stackhiVar := stackVar.fieldVariable(bi.rtField("runtime.stack", "hi")); stackhiVar != nil {
 			stackhi, _ = constant.Uint64Val(stackhiVar.Value)
 		}
-		if stackloVar := stackVar.fieldVariable("lo"); stackloVar != nil {
+		if stackloVar := stackVar.fieldVariable(bi.rtField("runtime.stack", "lo")); stackloVar != nil {
 			stacklo, _ = constant.Uint64Val(stackloVar.Value)
 		}
 	}
 
-	stkbarVar := v.loadFieldNamed("stkbar")
-	stkbarVarPosFld := v.loadFieldNamed("stkbarPos")
+	stkbarVar := v.loadFieldNamed(bi.rtField("runtime.g", "stkbar"))
+	stkbarVarPosFld := v.loadFieldNamed(bi.rtField("runtime.g", "stkbarPos"))
 	var stkbarPos int64
 	if stkbarVarPosFld != nil { // stack barriers were removed in Go 1.9
 		stkbarPos, _ = constant.Int64Val(stkbarVarPosFld.Value)
@@ -873,7 +987,7 @@ func (v *Variable) parseG() (*G, error) {
 		return nil, ErrUnreadableG
 	}
 
-	f, l, fn := v.bi.PCToLine(uint64(pc))
+	f, l, fn := bi.PCToLine(uint64(pc))
 
 	v.Name = "runtime.curg"
 
@@ -932,7 +1046,8 @@ func Ancestors(p Process, g *G, n int) ([]Ancestor, error) {
 		}
 	}
 
-	av, err := g.variable.structMember("ancestors")
+	bi := p.BinInfo()
+	av, err := g.variable.structMember(bi.rtField("runtime.g", "ancestors"))
 	if err != nil {
 		return nil, err
 	}
@@ -953,13 +1068,17 @@ func Ancestors(p Process, g *G, n int) ([]Ancestor, error) {
 			r[i].Unreadable = av.Children[i].Unreadable
 			continue
 		}
-		goidv := av.Children[i].fieldVariable("goid")
+		goidv := av.Children[i].fieldVariable(bi.rtField("runtime.ancestorInfo", "goid"))
+		pcsVar := av.Children[i].fieldVariable(bi.rtField("runtime.ancestorInfo", "pcs"))
+		if goidv == nil || pcsVar == nil {
+			r[i].Unreadable = errors.New("malformed runtime.ancestorInfo")
+			continue
+		}
 		if goidv.Unreadable != nil {
 			r[i].Unreadable = goidv.Unreadable
 			continue
 		}
 		r[i].ID, _ = constant.Int64Val(goidv.Value)
-		pcsVar := av.Children[i].fieldVariable("pcs")
 		if pcsVar.Unreadable != nil {
 			r[i].Unreadable = pcsVar.Unreadable
 		}
@@ -1001,7 +1120,7 @@ func (a *Ancestor) Stack(n int) ([]Stackframe, error) {
 		if pc2-1 >= fn.Entry {
 			pc2--
 		}
-		f, ln := fn.cu.lineInfo.PCToLine(fn.Entry, pc2)
+		f, ln := fn.pcToLine(pc2)
 		loc := Location{PC: uint64(pc), File: f, Line: ln, Fn: fn}
 		r[i] = Stackframe{Current: loc, Call: loc}
 	}
@@ -1014,7 +1133,7 @@ func (g *G) stkbar() ([]savedLR, error) {
 	if g.stkbarVar == nil { // stack barriers were removed in Go 1.9
 		return nil, nil
 	}
-	g.stkbarVar.loadValue(LoadConfig{false, 1, 0, int(g.stkbarVar.Len), 3, 0})
+	g.stkbarVar.loadValue(LoadConfig{false, 1, 0, int(g.stkbarVar.Len), 3, 0, nil})
 	if g.stkbarVar.Unreadable != nil {
 		return nil, fmt.Errorf("unreadable stkbar: %v", g.stkbarVar.Unreadable)
 	}
@@ -1199,6 +1318,10 @@ func (v *Variable) loadValueInternal(recurseLevel int, cfg LoadConfig) {
 	if v.Unreadable != nil || v.loaded || (v.Addr == 0 && v.Base == 0) {
 		return
 	}
+	if cfg.Cancelled() {
+		v.Unreadable = ErrCancelled
+		return
+	}
 
 	v.loaded = true
 	switch v.Kind {
@@ -1314,9 +1437,8 @@ func (v *Variable) loadValueInternal(recurseLevel int, cfg LoadConfig) {
 
 // convertToEface converts srcv into an "interface {}" and writes it to
 // dstv.
-// Dstv must be a variable of type "inteface {}" and srcv must either be an
-// interface or a pointer shaped variable (map, channel, pointer or struct
-// containing a single pointer)
+// Dstv must be a variable of type "inteface {}" and srcv must be an
+// interface, concrete values are converted by convertToInterface.
 func convertToEface(srcv, dstv *Variable) error {
 	if dstv.RealType.String() != "interface {}" {
 		return &typeConvErr{srcv.DwarfType, dstv.RealType}
@@ -1331,14 +1453,7 @@ func convertToEface(srcv, dstv *Variable) error {
 		dstv.writeEmptyInterface(uint64(_type.Addr), data)
 		return nil
 	}
-	typeAddr, typeKind, runtimeTypeFound, err := dwarfToRuntimeType(srcv.bi, srcv.mem, srcv.RealType)
-	if err != nil {
-		return err
-	}
-	if !runtimeTypeFound || typeKind&kindDirectIface == 0 {
-		return &typeConvErr{srcv.DwarfType, dstv.RealType}
-	}
-	return dstv.writeEmptyInterface(typeAddr, srcv)
+	return &typeConvErr{srcv.DwarfType, dstv.RealType}
 }
 
 func readStringInfo(mem MemoryReadWriter, arch *Arch, addr uintptr) (uintptr, int64, error) {
@@ -1503,7 +1618,11 @@ func (v *Variable) loadChanInfo() {
 		return
 	}
 
-	lenAddr, _ := sv.toField(structType.Field[1])
+	lenAddr, err := sv.structMember(v.bi.rtField("runtime.hchan", "dataqsiz"))
+	if err != nil {
+		v.Unreadable = fmt.Errorf("bad channel type: %v", err)
+		return
+	}
 	lenAddr.loadValue(loadSingleValue)
 	if lenAddr.Unreadable != nil {
 		v.Unreadable = fmt.Errorf("unreadable length: %v", lenAddr.Unreadable)
@@ -1518,7 +1637,7 @@ func (v *Variable) loadChanInfo() {
 	for i := range structType.Field {
 		field := &godwarf.StructField{}
 		*field = *structType.Field[i]
-		if field.Name == "buf" {
+		if field.Name == v.bi.rtField("runtime.hchan", "buf") {
 			field.Type = pointerTo(fakeArrayType(chanLen, chanType.ElemType), v.bi.Arch)
 		}
 		newStructType.Field[i] = field
@@ -1896,20 +2015,21 @@ func (v *Variable) mapIterator() *mapIterator {
 
 	v.mem = cacheMemory(v.mem, v.Base, int(v.RealType.Size()))
 
+	bi := v.bi
 	for _, f := range maptype.Field {
 		var err error
 		field, _ := sv.toField(f)
 		switch f.Name {
-		case "count":
+		case bi.rtField("runtime.hmap", "count"):
 			v.Len, err = field.asInt()
-		case "B":
+		case bi.rtField("runtime.hmap", "B"):
 			var b uint64
 			b, err = field.asUint()
 			it.numbuckets = 1 << b
 			it.oldmask = (1 << (b - 1)) - 1
-		case "buckets":
+		case bi.rtField("runtime.hmap", "buckets"):
 			it.buckets = field.maybeDereference()
-		case "oldbuckets":
+		case bi.rtField("runtime.hmap", "oldbuckets"):
 			it.oldbuckets = field.maybeDereference()
 		}
 		if err != nil {
@@ -1923,12 +2043,8 @@ func (v *Variable) mapIterator() *mapIterator {
 		return nil
 	}
 
-	it.hashTophashEmptyOne = hashTophashEmptyZero
-	it.hashMinTopHash = hashMinTopHashGo111
-	if producer := v.bi.Producer(); producer != "" && goversion.ProducerAfterOrEqual(producer, 1, 12) {
-		it.hashTophashEmptyOne = hashTophashEmptyOne
-		it.hashMinTopHash = hashMinTopHashGo112
-	}
+	it.hashTophashEmptyOne = uint64(bi.rtConst("runtime.emptyOne"))
+	it.hashMinTopHash = uint64(bi.rtConst("runtime.minTopHash"))
 
 	return it
 }
@@ -2010,14 +2126,14 @@ func (it *mapIterator) nextBucket() bool {
 			return false
 		}
 
-		switch f.Name {
-		case "tophash":
+		switch bi := it.v.bi; f.Name {
+		case bi.rtField("runtime.bmap", "tophash"):
 			it.tophashes = field
-		case "keys":
+		case bi.rtField("runtime.bmap", "keys"):
 			it.keys = field
-		case "values":
+		case bi.rtField("runtime.bmap", "values"):
 			it.values = field
-		case "overflow":
+		case bi.rtField("runtime.bmap", "overflow"):
 			it.overflow = field.maybeDereference()
 		}
 	}
@@ -2127,24 +2243,25 @@ func (v *Variable) readInterface() (_type, data *Variable, isnil bool) {
 
 	ityp := resolveTypedef(&v.RealType.(*godwarf.InterfaceType).TypedefType).(*godwarf.StructType)
 
+	bi := v.bi
 	for _, f := range ityp.Field {
 		switch f.Name {
-		case "tab": // for runtime.iface
+		case bi.rtField("runtime.iface", "tab"):
 			tab, _ := v.toField(f)
 			tab = tab.maybeDereference()
 			isnil = tab.Addr == 0
 			if !isnil {
 				var err error
-				_type, err = tab.structMember("_type")
+				_type, err = tab.structMember(bi.rtField("runtime.itab", "_type"))
 				if err != nil {
 					v.Unreadable = fmt.Errorf("invalid interface type: %v", err)
 					return
 				}
 			}
-		case "_type": // for runtime.eface
+		case bi.rtField("runtime.eface", "_type"):
 			_type, _ = v.toField(f)
 			isnil = _type.maybeDereference().Addr == 0
-		case "data":
+		case bi.rtField("runtime.iface", "data"), bi.rtField("runtime.eface", "data"):
 			data, _ = v.toField(f)
 		}
 	}
@@ -2191,13 +2308,27 @@ func (v *Variable) loadInterface(recurseLevel int, loadData bool, cfg LoadConfig
 	}
 
 	v.Children = []Variable{*data}
-	if loadData && recurseLevel <= cfg.MaxVariableRecurse {
+	if loadData && (recurseLevel <= cfg.MaxVariableRecurse || isBasicKind(data.Kind)) {
+		// values of basic types are loaded even past the recursion limit,
+		// loading them does not recurse any further.
 		v.Children[0].loadValueInternal(recurseLevel, cfg)
 	} else {
 		v.Children[0].OnlyAddr = true
 	}
 }
 
+// isBasicKind returns true for the kinds of the basic types of Go.
+func isBasicKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
+
 // ConstDescr describes the value of v using constants.
 func (v *Variable) ConstDescr() string {
 	if v.bi == nil || (v.Flags&VariableConstant != 0) {
@@ -0,0 +1,225 @@
+package proc
+
+import (
+	"fmt"
+	"go/constant"
+	"reflect"
+	"strings"
+)
+
+// WorkerGroup are the goroutines working for a value of the target that
+// coordinates them, see FindWorkers.
+type WorkerGroup struct {
+	// Kind is the kind of the value: errgroup, semaphore or channel.
+	Kind    string
+	Workers []Worker
+	// Err is the first error returned by a function run by an
+	// errgroup.Group, nil if none failed.
+	Err *Variable
+	// Limit is the maximum number of active goroutines of an errgroup.Group,
+	// the size of a semaphore.Weighted or the capacity of a channel, 0 if
+	// there is none.
+	Limit int64
+	// Active is the number of active goroutines of an errgroup.Group with a
+	// limit, the weight acquired from a semaphore.Weighted or the number of
+	// values buffered in a channel.
+	Active int64
+}
+
+// Worker is one of the goroutines of a WorkerGroup.
+type Worker struct {
+	G *G
+	// Role is what the goroutine does with the value: "run" for the
+	// goroutines started by an errgroup.Group, "acquire <n>" for the
+	// goroutines waiting for a semaphore.Weighted, "receive" and "send" for
+	// the goroutines blocked on a channel.
+	Role string
+	// Func is the function run by a goroutine of an errgroup.Group.
+	Func string
+}
+
+const (
+	errgroupType  = "golang.org/x/sync/errgroup.Group"
+	semaphoreType = "golang.org/x/sync/semaphore.Weighted"
+
+	// errgroupFuncs is the prefix of the closures started by the methods
+	// of errgroup.Group.
+	errgroupFuncs = "golang.org/x/sync/errgroup.(*Group)."
+)
+
+// maxWorkerStackDepth is the maximum depth of the stacks searched for the
+// closures started by an errgroup.Group.
+const maxWorkerStackDepth = 1024
+
+// maxSemaphoreWaiters is the maximum number of waiters of a
+// semaphore.Weighted returned by FindWorkers.
+const maxSemaphoreWaiters = 1000
+
+// FindWorkers returns the goroutines working for v, which can be:
+//
+//   - an errgroup.Group, of golang.org/x/sync/errgroup: the goroutines
+//     running the functions passed to its Go and TryGo methods, recognized
+//     by the closure they started with, which refers to the group
+//   - a semaphore.Weighted, of golang.org/x/sync/semaphore: the goroutines
+//     waiting to acquire it
+//   - a channel, for example the queue of the jobs of a pool of workers:
+//     the goroutines blocked receiving from it and sending to it
+//
+// Pointers to them are dereferenced. The error of the group is loaded with
+// cfg.
+func FindWorkers(t *Target, v *Variable, cfg LoadConfig) (*WorkerGroup, error) {
+	v = v.maybeDereference()
+	if v.Unreadable != nil {
+		return nil, v.Unreadable
+	}
+	name := v.DwarfType.Common().Name
+	switch {
+	case v.Kind == reflect.Chan:
+		return chanWorkers(t, v)
+	case strings.HasSuffix(name, errgroupType):
+		return errgroupWorkers(t, v, cfg)
+	case strings.HasSuffix(name, semaphoreType):
+		return semaphoreWorkers(t, v)
+	}
+	return nil, fmt.Errorf("%s (type %s) is not an errgroup.Group, a semaphore.Weighted or a channel", v.Name, v.TypeString())
+}
+
+func errgroupWorkers(t *Target, v *Variable, cfg LoadConfig) (*WorkerGroup, error) {
+	r := &WorkerGroup{Kind: "errgroup"}
+	errv, err := v.structMember("err")
+	if err != nil {
+		return nil, err
+	}
+	if r.Err, err = interfaceValue(errv); err != nil {
+		return nil, err
+	}
+	if r.Err != nil {
+		r.Err.loadValue(cfg)
+	}
+	if sem, err := v.structMember("sem"); err == nil {
+		r.Active, r.Limit = chanLenCap(sem)
+	}
+
+	gs, _, err := GoroutinesInfo(t, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range gs {
+		if fn := g.StartLoc().Fn; fn == nil || !strings.HasPrefix(fn.Name, errgroupFuncs) {
+			continue
+		}
+		frames, err := g.Stacktrace(maxWorkerStackDepth, 0)
+		if err != nil {
+			continue
+		}
+		var thread MemoryReadWriter = t.CurrentThread()
+		if g.Thread != nil {
+			thread = g.Thread
+		}
+		// the closure is the first frame of the goroutine, the last one of
+		// the stack.
+		for i := len(frames) - 1; i >= 0; i-- {
+			if frames[i].Call.Fn == nil || !strings.HasPrefix(frames[i].Call.Fn.Name, errgroupFuncs) {
+				continue
+			}
+			scope := FrameToScope(t.BinInfo(), thread, g, frames[i:]...)
+			gv, err := scope.EvalVariable("g", loadSingleValue)
+			if err != nil || gv.Kind != reflect.Ptr || len(gv.Children) == 0 || gv.Children[0].Addr != v.Addr {
+				break
+			}
+			w := Worker{G: g, Role: "run"}
+			if f, err := scope.EvalVariable("f", loadSingleValue); err == nil && f.Value != nil && f.Value.Kind() == constant.String {
+				w.Func = constant.StringVal(f.Value)
+			}
+			r.Workers = append(r.Workers, w)
+			break
+		}
+	}
+	return r, nil
+}
+
+func semaphoreWorkers(t *Target, v *Variable) (*WorkerGroup, error) {
+	r := &WorkerGroup{Kind: "semaphore"}
+	for _, f := range []struct {
+		name string
+		n    *int64
+	}{{"size", &r.Limit}, {"cur", &r.Active}} {
+		fv, err := v.structMember(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if *f.n, err = fv.asInt(); err != nil {
+			return nil, err
+		}
+	}
+
+	// waiters is a container/list.List of waiter structs, each goroutine
+	// waits receiving from the ready channel of its waiter.
+	l, err := v.structMember("waiters")
+	if err != nil {
+		return nil, err
+	}
+	root, err := l.structMember("root")
+	if err != nil {
+		return nil, err
+	}
+	e, err := root.structMember("next")
+	for i := 0; err == nil && i < maxSemaphoreWaiters; i++ {
+		e = e.maybeDereference()
+		if e.Unreadable != nil || e.Addr == 0 || e.Addr == root.Addr {
+			break
+		}
+		var waiter *Variable
+		if waiter, err = e.structMember("Value"); err == nil {
+			waiter, err = interfaceValue(waiter)
+		}
+		if err != nil || waiter == nil {
+			break
+		}
+		var n int64
+		if nv, err := waiter.structMember("n"); err == nil {
+			n, _ = nv.asInt()
+		}
+		if ready, err := waiter.structMember("ready"); err == nil {
+			for _, id := range chanWaiters(ready, "recvq") {
+				if g, _ := FindGoroutine(t, id); g != nil {
+					r.Workers = append(r.Workers, Worker{G: g, Role: fmt.Sprintf("acquire %d", n)})
+				}
+			}
+		}
+		e, err = e.structMember("next")
+	}
+	return r, nil
+}
+
+func chanWorkers(t *Target, v *Variable) (*WorkerGroup, error) {
+	r := &WorkerGroup{Kind: "channel"}
+	r.Active, r.Limit = chanLenCap(v)
+	for _, q := range []struct{ queue, role string }{{"recvq", "receive"}, {"sendq", "send"}} {
+		for _, id := range chanWaiters(v, q.queue) {
+			if g, _ := FindGoroutine(t, id); g != nil {
+				r.Workers = append(r.Workers, Worker{G: g, Role: q.role})
+			}
+		}
+	}
+	return r, nil
+}
+
+// chanLenCap returns the number of values buffered in the channel ch and
+// its capacity, 0 if ch is nil.
+func chanLenCap(ch *Variable) (n, capacity int64) {
+	ch.loadValue(loadSingleValue)
+	if ch.Unreadable != nil || ch.Base == 0 {
+		return 0, 0
+	}
+	for _, f := range []struct {
+		name string
+		n    *int64
+	}{{"qcount", &n}, {"dataqsiz", &capacity}} {
+		if fv, err := ch.structMember(f.name); err == nil {
+			u, _ := fv.asUint()
+			*f.n = int64(u)
+		}
+	}
+	return n, capacity
+}
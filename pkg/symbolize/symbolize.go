@@ -0,0 +1,340 @@
+// Package symbolize translates the addresses of a Go program, for example
+// copied from logs or from a panic traceback, into function names and
+// source positions, taking inlining into account.
+package symbolize
+
+import (
+	"bufio"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/pkg/proc/core"
+)
+
+// Open loads the debug information of the executable at exePath. If
+// corePath is not empty the executable is loaded at the address recorded
+// in the core file, which is necessary to symbolize the addresses of
+// position independent executables. The returned function releases the
+// resources used by the debug information.
+func Open(exePath, corePath string, debugInfoDirs []string) (*proc.BinaryInfo, func(), error) {
+	if corePath != "" {
+		t, err := core.OpenCore(corePath, exePath, debugInfoDirs)
+		if err != nil {
+			return nil, nil, err
+		}
+		return t.BinInfo(), func() { t.Detach(false) }, nil
+	}
+	goos, err := proc.ExecutableOS(exePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	goarch, err := executableArch(exePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	bi := proc.NewBinaryInfo(goos, goarch)
+	if err := bi.LoadBinaryInfo(exePath, 0, debugInfoDirs); err != nil {
+		if err == proc.ErrCouldNotDetermineRelocation {
+			return nil, nil, fmt.Errorf("%v: a core file is needed to symbolize position independent executables", err)
+		}
+		return nil, nil, err
+	}
+	return bi, func() { bi.Close() }, nil
+}
+
+// executableArch returns the architecture, as a GOARCH value, of the
+// executable at path.
+func executableArch(path string) (string, error) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		switch f.Machine {
+		case elf.EM_X86_64:
+			return "amd64", nil
+		case elf.EM_AARCH64:
+			return "arm64", nil
+		case elf.EM_ARM:
+			return "arm", nil
+		case elf.EM_386:
+			return "386", nil
+		}
+		return "", fmt.Errorf("unsupported machine type %v", f.Machine)
+	}
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		switch f.Machine {
+		case pe.IMAGE_FILE_MACHINE_AMD64:
+			return "amd64", nil
+		case pe.IMAGE_FILE_MACHINE_I386:
+			return "386", nil
+		}
+		return "", fmt.Errorf("unsupported machine type %#x", f.Machine)
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		switch f.Cpu {
+		case macho.CpuAmd64:
+			return "amd64", nil
+		case macho.CpuArm64:
+			return "arm64", nil
+		}
+		return "", fmt.Errorf("unsupported cpu type %v", f.Cpu)
+	}
+	return "", fmt.Errorf("unknown binary format for %s", path)
+}
+
+// Frame is a source position of a symbolized address.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+	// Inlined is true if Function was inlined, the next frame is the
+	// position of the call.
+	Inlined bool
+	// Offset is the distance of the address from the entry point of
+	// Function, for frames that are not inlined.
+	Offset uint64
+}
+
+// Address returns the source positions of pc, starting with the innermost
+// inlined function. Returns nil if pc does not belong to a function.
+func Address(bi *proc.BinaryInfo, pc uint64) []Frame {
+	locs := bi.PCToLocations(pc)
+	frames := make([]Frame, len(locs))
+	for i, loc := range locs {
+		frames[i] = Frame{Function: loc.Fn.Name, File: loc.File, Line: loc.Line, Inlined: i < len(locs)-1}
+		if !frames[i].Inlined {
+			frames[i].Offset = pc - loc.Fn.Entry
+		}
+	}
+	return frames
+}
+
+// WriteAddress writes the source positions of pc to w, in the format used
+// by Go tracebacks.
+func WriteAddress(w io.Writer, bi *proc.BinaryInfo, pc uint64) {
+	fmt.Fprintf(w, "%#x\n", pc)
+	frames := Address(bi, pc)
+	if len(frames) == 0 {
+		fmt.Fprintf(w, "\t?\n")
+		return
+	}
+	writeFrames(w, frames, "", "")
+}
+
+// writeFrames writes frames in the format used by Go tracebacks, prefix
+// and args are written around the name of the outermost frame.
+func writeFrames(w io.Writer, frames []Frame, prefix, args string) {
+	for _, f := range frames {
+		if f.Inlined {
+			fmt.Fprintf(w, "%s(...)\n\t%s:%d\n", f.Function, f.File, f.Line)
+			continue
+		}
+		if prefix != "" {
+			fmt.Fprintf(w, "%s%s%s\n", prefix, f.Function, args)
+		} else {
+			if args == "" {
+				args = "()"
+			}
+			fmt.Fprintf(w, "%s%s\n", f.Function, args)
+		}
+		fmt.Fprintf(w, "\t%s:%d +%#x\n", f.File, f.Line, f.Offset)
+	}
+}
+
+var (
+	// goroutineHeaderRx matches the first line of the stack trace of a
+	// goroutine, for example "goroutine 1 [running]:".
+	goroutineHeaderRx = regexp.MustCompile(`^goroutine (\d+) \[.*\]:$`)
+	// funcLineRx matches the line of a stack frame with the name and the
+	// arguments of the function, for example "main.f(0x1, 0x2)", and the
+	// line with the function that created a goroutine, for example
+	// "created by main.main in goroutine 1".
+	funcLineRx = regexp.MustCompile(`^(created by )?([^\s(]\S*?)(\([^()]*\))?( in goroutine \d+)?$`)
+	// posLineRx matches the line of a stack frame with the position,
+	// which can be removed or altered by sanitizers, followed by the
+	// offset of the PC from the entry point of the function, for example
+	// "\t/src/main.go:12 +0x1d".
+	posLineRx = regexp.MustCompile(`^\s+.*\+0x([0-9a-fA-F]+)(?: fp=.*)?$`)
+	// inlinedPosLineRx matches the position line of an inlined frame,
+	// which has no PC offset.
+	inlinedPosLineRx = regexp.MustCompile(`^\s+\S.*$`)
+	// framePosLineRx matches the position line of a stack frame that was
+	// not altered, for example "\t/src/main.go:12 +0x1d", capturing the
+	// file, the line and the PC offset, which inlined frames do not have.
+	framePosLineRx = regexp.MustCompile(`^\s+(.+):(\d+)(?: \+0x([0-9a-fA-F]+))?(?: fp=.*)?$`)
+	// addrLineRx matches a line with only an address.
+	addrLineRx = regexp.MustCompile(`^\s*(0x[0-9a-fA-F]+)\s*$`)
+	// pcRx matches the PC reported by the runtime for signals, for
+	// example "[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x4a3b2c]".
+	pcRx = regexp.MustCompile(`\bpc=(0x[0-9a-fA-F]+)`)
+)
+
+// Text symbolizes the addresses in the text read from r, which can be a Go
+// traceback or a list of addresses, one per line, and writes the result to
+// w. The positions of the frames of tracebacks are recomputed from the
+// name of the function and the offset of the PC, expanding the calls of
+// inlined functions, lines with only an address are replaced with its
+// positions and the PCs of signals are symbolized after the line
+// reporting them. All other lines are copied unmodified.
+func Text(bi *proc.BinaryInfo, r io.Reader, w io.Writer) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var (
+		// held are the lines of the inlined frames, already expanded by the
+		// runtime, preceding the current frame. They are replaced by the
+		// symbolization of the current frame.
+		held []string
+		// pending is the function line of the current frame, waiting for
+		// its position line.
+		pending      string
+		firstFrame   bool // the next frame is the first of a goroutine
+		prevSigpanic bool // the previous frame was runtime.sigpanic
+	)
+	release := func() {
+		for _, line := range held {
+			fmt.Fprintln(w, line)
+		}
+		held = held[:0]
+		if pending != "" {
+			fmt.Fprintln(w, pending)
+			pending = ""
+		}
+	}
+
+	for s.Scan() {
+		line := s.Text()
+
+		if pending != "" {
+			if m := posLineRx.FindStringSubmatch(line); m != nil {
+				name := funcLineRx.FindStringSubmatch(pending)[2]
+				if symbolizeFrame(w, bi, pending, m[1], firstFrame, prevSigpanic) {
+					held = held[:0]
+					pending = ""
+				} else {
+					release()
+					fmt.Fprintln(w, line)
+				}
+				firstFrame = false
+				prevSigpanic = name == "runtime.sigpanic"
+				continue
+			}
+			if strings.HasSuffix(pending, "(...)") && inlinedPosLineRx.MatchString(line) {
+				held = append(held, pending, line)
+				pending = ""
+				continue
+			}
+		}
+
+		switch {
+		case goroutineHeaderRx.MatchString(line):
+			release()
+			fmt.Fprintln(w, line)
+			firstFrame, prevSigpanic = true, false
+		case addrLineRx.MatchString(line):
+			release()
+			pc, _ := strconv.ParseUint(strings.TrimSpace(line)[2:], 16, 64)
+			WriteAddress(w, bi, pc)
+		case pcRx.MatchString(line):
+			release()
+			fmt.Fprintln(w, line)
+			pc, _ := strconv.ParseUint(pcRx.FindStringSubmatch(line)[1][2:], 16, 64)
+			WriteAddress(w, bi, pc)
+		case funcLineRx.MatchString(line) && !strings.HasSuffix(line, ":"):
+			if pending != "" {
+				release()
+			}
+			pending = line
+		default:
+			release()
+			fmt.Fprintln(w, line)
+		}
+	}
+	release()
+	return s.Err()
+}
+
+// symbolizeFrame writes the symbolization of the frame of a traceback with
+// function line funcLine and PC offset off (in hexadecimal) to w. Returns
+// false if the frame could not be symbolized.
+func symbolizeFrame(w io.Writer, bi *proc.BinaryInfo, funcLine, off string, firstFrame, prevSigpanic bool) bool {
+	m := funcLineRx.FindStringSubmatch(funcLine)
+	createdBy, name, args := m[1], m[2], m[3]+m[4]
+	fn := bi.LookupFunc[name]
+	if fn == nil {
+		return false
+	}
+	offset, _ := strconv.ParseUint(off, 16, 64)
+	// Except for the innermost frame and for the callers of sigpanic the PC
+	// is a return address, the position of the call is given by the
+	// previous instruction.
+	pc := fn.Entry + offset
+	if offset > 0 && (!firstFrame || createdBy != "") && !prevSigpanic {
+		pc--
+	}
+	frames := Address(bi, pc)
+	if len(frames) == 0 {
+		return false
+	}
+	frames[len(frames)-1].Offset = offset
+	writeFrames(w, frames, createdBy, args)
+	return true
+}
+
+// TracebackFrame is a frame of a Go traceback.
+type TracebackFrame struct {
+	Frame
+	// Goroutine is the ID of the goroutine of the frame.
+	Goroutine int
+	// CreatedBy is true if the frame is the call of the go statement that
+	// created the goroutine.
+	CreatedBy bool
+}
+
+// ParseTraceback returns the frames of the Go tracebacks in the text read
+// from r, for example the output of a program that panicked, in order.
+// Lines that are not part of a traceback are ignored, as well as the
+// frames whose position was removed.
+func ParseTraceback(r io.Reader) ([]TracebackFrame, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var (
+		frames    []TracebackFrame
+		goroutine int
+		fnline    []string
+	)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if m := goroutineHeaderRx.FindStringSubmatch(line); m != nil {
+			goroutine, _ = strconv.Atoi(m[1])
+			fnline = nil
+			continue
+		}
+		if fnline != nil {
+			if m := framePosLineRx.FindStringSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(m[2])
+				f := TracebackFrame{
+					Frame:     Frame{Function: fnline[2], File: m[1], Line: n, Inlined: fnline[3] == "(...)"},
+					Goroutine: goroutine,
+					CreatedBy: fnline[1] != "",
+				}
+				if m[3] != "" {
+					f.Offset, _ = strconv.ParseUint(m[3], 16, 64)
+				}
+				frames = append(frames, f)
+				fnline = nil
+				continue
+			}
+		}
+		fnline = funcLineRx.FindStringSubmatch(line)
+	}
+	return frames, s.Err()
+}
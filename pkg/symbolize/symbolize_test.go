@@ -0,0 +1,100 @@
+package symbolize
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+
+	protest "github.com/go-delve/delve/pkg/proc/test"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(protest.RunTestsWithFixtures(m))
+}
+
+func TestTextTraceback(t *testing.T) {
+	fixture := protest.BuildFixture("panic", 0)
+	out, _ := exec.Command(fixture.Path).CombinedOutput()
+	if !strings.Contains(string(out), "goroutine 1 [running]:") {
+		t.Fatalf("no traceback in output of the fixture:\n%s", out)
+	}
+	// remove the positions, like a sanitizer would
+	sanitized := regexp.MustCompile(`(?m)^\t.*:\d+ \+`).ReplaceAllString(string(out), "\t? +")
+
+	bi, closefn, err := Open(fixture.Path, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closefn()
+
+	var buf bytes.Buffer
+	if err := Text(bi, strings.NewReader(sanitized), &buf); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%s", buf.String())
+	if want := fmt.Sprintf("main.main()\n\t%s:5 +", fixture.Source); !strings.Contains(buf.String(), want) {
+		t.Errorf("position of main.main not found in output, want %q", want)
+	}
+	if !strings.Contains(buf.String(), "panic: BOOM!") {
+		t.Errorf("panic message not copied to the output")
+	}
+
+	fn := bi.LookupFunc["main.main"]
+	buf.Reset()
+	WriteAddress(&buf, bi, fn.Entry)
+	if want := fmt.Sprintf("%#x\nmain.main()\n\t%s:3 +0x0\n", fn.Entry, fixture.Source); buf.String() != want {
+		t.Errorf("WriteAddress(main.main): got %q want %q", buf.String(), want)
+	}
+	buf.Reset()
+	WriteAddress(&buf, bi, 1)
+	if want := "0x1\n\t?\n"; buf.String() != want {
+		t.Errorf("WriteAddress(1): got %q want %q", buf.String(), want)
+	}
+}
+
+func TestParseTraceback(t *testing.T) {
+	const trace = `panic: runtime error: invalid memory address or nil pointer dereference
+[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x47db03]
+
+goroutine 6 [running]:
+main.(*T).get(0x0?)
+	/build/app/main.go:6 +0x3
+main.helper(...)
+	/build/app/main.go:11
+main.worker()
+	/build/app/main.go:15 +0x1d
+created by main.main in goroutine 1
+	/build/app/main.go:20 +0x25
+
+goroutine 1 [chan receive]:
+main.main()
+	/build/app/main.go:21 +0x38
+exit status 2
+`
+	frames, err := ParseTraceback(strings.NewReader(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := func(g int, fn string, line int, inlined, createdBy bool, off uint64) TracebackFrame {
+		return TracebackFrame{Frame: Frame{Function: fn, File: "/build/app/main.go", Line: line, Inlined: inlined, Offset: off}, Goroutine: g, CreatedBy: createdBy}
+	}
+	tgt := []TracebackFrame{
+		frame(6, "main.(*T).get", 6, false, false, 0x3),
+		frame(6, "main.helper", 11, true, false, 0),
+		frame(6, "main.worker", 15, false, false, 0x1d),
+		frame(6, "main.main", 20, false, true, 0x25),
+		frame(1, "main.main", 21, false, false, 0x38),
+	}
+	if len(frames) != len(tgt) {
+		t.Fatalf("wrong number of frames %d, expected %d: %#v", len(frames), len(tgt), frames)
+	}
+	for i := range tgt {
+		if frames[i] != tgt[i] {
+			t.Errorf("frame %d: got %#v, expected %#v", i, frames[i], tgt[i])
+		}
+	}
+}
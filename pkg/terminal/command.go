@@ -5,12 +5,15 @@ package terminal
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"go/parser"
 	"go/scanner"
 	"io"
+	"io/ioutil"
 	"math"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -20,9 +23,11 @@ import (
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/cosiner/argv"
 	"github.com/go-delve/delve/pkg/locspec"
+	"github.com/go-delve/delve/pkg/modsrc"
 	"github.com/go-delve/delve/service"
 	"github.com/go-delve/delve/service/api"
 	"github.com/go-delve/delve/service/rpc2"
@@ -116,17 +121,37 @@ func DebugCommands(client service.Client) *Commands {
 Type "help" followed by the name of a command for more information about it.`},
 		{aliases: []string{"break", "b"}, group: breakCmds, cmdFn: breakpoint, helpMsg: `Sets a breakpoint.
 
-	break [name] <linespec>
+	break [--on-error] [name] <linespec>
+	break --at-exit [name] <linespec>
+	break --runtime [name] <event>
 
 See $GOPATH/src/github.com/go-delve/delve/Documentation/cli/locspec.md for the syntax of linespec.
 
+If --on-error is specified linespec must be a function and the breakpoint is set on its return instructions, it will only stop when one of the return values of type error is not nil.
+
+If --at-exit is specified linespec must be a function and the breakpoint stops every time the function returns, in the caller right after the call, showing the values it returned, or when a recovered panic unwinds it, in runtime.recovery. Every return path is covered, including the deferred calls and inlined calls. The condition of the breakpoint is evaluated when the function is called.
+
+If --runtime is specified the breakpoint is set on the runtime function called when event happens, event must be one of:
+
+	gc-start		a garbage collection cycle is started
+	gc-end			the mark phase of a garbage collection cycle ends
+	goroutine-create	a new goroutine is created
+	goroutine-exit		a goroutine exits
+
 See also: "help on", "help cond" and "help clear"`},
 		{aliases: []string{"trace", "t"}, group: breakCmds, cmdFn: tracepoint, helpMsg: `Set tracepoint.
 
-	trace [name] <linespec>
+	trace [--on-error] [name] <linespec>
+	trace --runtime [name] <event>
 
 A tracepoint is a breakpoint that does not stop the execution of the program, instead when the tracepoint is hit a notification is displayed. See $GOPATH/src/github.com/go-delve/delve/Documentation/cli/locspec.md for the syntax of linespec.
 
+If linespec specifies a function the arguments are printed every time the function is called and the return values every time it returns. If linespec specifies a line inside a function (for example issue573.go:19 or main.foo:2) the arguments and local variables are printed when that line is reached.
+
+If --on-error is specified linespec must be a function and a notification is displayed only when it returns a non-nil error.
+
+If --runtime is specified the tracepoint is set on a runtime event, see "help break" for the list of runtime events.
+
 See also: "help on", "help cond" and "help clear"`},
 		{aliases: []string{"restart", "r"}, group: runCmds, cmdFn: restart, helpMsg: `Restart process.
 
@@ -138,7 +163,9 @@ For recorded targets the command takes the following forms:
 	
 For live targets the command takes the following forms:
 
-	restart [newargv...] [redirects...]	restarts the process
+	restart [--rebuild] [newargv...] [redirects...]	restarts the process
+
+If --rebuild is specified the executable is built again before restarting, like the rebuild command does, this only works if the executable was built by delve. Breakpoints set on a line of a function are moved with their function and the ones that can not be set in the new executable are reported.
 
 If newargv is omitted the process is restarted (or re-recorded) with the same argument vector.
 If -noargs is specified instead, the argument vector is cleared.
@@ -149,9 +176,19 @@ A list of file redirections can be specified after the new argument list to over
 	>output.txt	redirects the standard output of the target process to output.txt
 	2>error.txt	redirects the standard error of the target process to error.txt
 `},
-		{aliases: []string{"rebuild"}, group: runCmds, cmdFn: c.rebuild, allowedPrefixes: revPrefix, helpMsg: "Rebuild the target executable and restarts it. It does not work if the executable was not built by delve."},
+		{aliases: []string{"rebuild"}, group: runCmds, cmdFn: c.rebuild, allowedPrefixes: revPrefix, helpMsg: `Rebuild the target executable and restarts it. It does not work if the executable was not built by delve.
+
+	rebuild [-c]
+
+The breakpoints are set again in the new executable, the ones that can not be found in it are discarded. If the executable can not be built the current process is not restarted. If -c is specified the process is continued after being restarted.`},
 		{aliases: []string{"continue", "c"}, group: runCmds, cmdFn: c.cont, allowedPrefixes: revPrefix, helpMsg: "Run until breakpoint or program termination."},
-		{aliases: []string{"step", "s"}, group: runCmds, cmdFn: c.step, allowedPrefixes: revPrefix, helpMsg: "Single step through program."},
+		{aliases: []string{"step", "s"}, group: runCmds, cmdFn: c.step, allowedPrefixes: revPrefix, helpMsg: `Single step through program.
+
+	step [-chan]
+
+If -chan is specified and the current line sends a value on a channel that a goroutine is waiting to receive from, the step will stop in the receiving goroutine after it has received the value.
+
+Calls to functions of the packages listed by the step-skip-packages configuration parameter, and of the runtime and reflect packages if step-instructions-skip-runtime is true, are stepped over and returning into them continues to the first caller outside of them.`},
 		{aliases: []string{"step-instruction", "si"}, group: runCmds, allowedPrefixes: revPrefix, cmdFn: c.stepInstruction, helpMsg: "Single step a single cpu instruction."},
 		{aliases: []string{"next", "n"}, group: runCmds, cmdFn: c.next, allowedPrefixes: revPrefix, helpMsg: `Step over to next source line.
 
@@ -176,7 +213,9 @@ Current limitations:
 - calling a function will resume execution of all goroutines.
 - only supported on linux's native backend.
 `},
-		{aliases: []string{"threads"}, group: goroutineCmds, cmdFn: threads, helpMsg: "Print out info for every traced thread."},
+		{aliases: []string{"threads"}, group: goroutineCmds, cmdFn: threads, helpMsg: `Print out info for every traced thread.
+
+Each thread is shown with its name, when the target is a process of this machine (on linux the name in /proc/<pid>/task/<tid>/comm), and the IDs of the M of the runtime associated with it and of the P it holds, to correlate the threads with the output of tools like perf.`},
 		{aliases: []string{"thread", "tr"}, group: goroutineCmds, cmdFn: thread, helpMsg: `Switch to the specified thread.
 
 	thread <id>`},
@@ -201,7 +240,7 @@ Print out info for every goroutine. The flag controls what information is shown
 	-t	displays goroutine's stacktrace
 	-l	displays goroutine's labels
 
-If no flag is specified the default is -u.`},
+If no flag is specified the default is -u. Running goroutines are shown with their thread, its name, and the IDs of the M running them and of the P it holds.`},
 		{aliases: []string{"goroutine", "gr"}, group: goroutineCmds, allowedPrefixes: onPrefix, cmdFn: c.goroutine, helpMsg: `Shows or changes current goroutine
 
 	goroutine
@@ -211,12 +250,62 @@ If no flag is specified the default is -u.`},
 Called without arguments it will show information about the current goroutine.
 Called with a single argument it will switch to the specified goroutine.
 Called with more arguments it will execute a command on the specified goroutine.`},
-		{aliases: []string{"breakpoints", "bp"}, group: breakCmds, cmdFn: breakpoints, helpMsg: "Print out info for active breakpoints."},
+		{aliases: []string{"breakpoints", "bp"}, group: breakCmds, cmdFn: breakpoints, helpMsg: `Print out info for active breakpoints.
+
+	breakpoints [--stats]
+
+If --stats is specified the statistics of the evaluations of the conditions of the breakpoints are printed: how many times the condition was evaluated, how many of them did not stop the target, how long an evaluation takes on average and the highest number of evaluations in one second. Breakpoints whose condition is evaluated more than 1000 times per second, slowing down the target considerably, are marked as hot.`},
 		{aliases: []string{"print", "p"}, group: dataCmds, allowedPrefixes: onPrefix | deferredPrefix, cmdFn: printVar, helpMsg: `Evaluate an expression.
 
 	[goroutine <n>] [frame <m>] print <expression>
 
 See $GOPATH/src/github.com/go-delve/delve/Documentation/cli/expr.md for a description of supported expressions.`},
+		{aliases: []string{"ctx"}, group: dataCmds, allowedPrefixes: deferredPrefix, cmdFn: ctxCommand, helpMsg: `Examines a context.Context.
+
+	[goroutine <n>] [frame <m>] ctx <expression>
+
+Prints the chain of parents of the context, starting with the context itself, with its concrete type and address and, for each context:
+
+- the key and the value attached to contexts created by context.WithValue
+- the deadline of contexts created by context.WithDeadline and context.WithTimeout
+- whether the context can be canceled independently of its parent, and the error of the contexts already canceled
+- the goroutines blocked receiving from its Done channel
+
+Only the parents of the contexts of package context are known, the chain ends with the first context of another type.`},
+		{aliases: []string{"workers"}, group: goroutineCmds, allowedPrefixes: deferredPrefix, cmdFn: workersCommand, helpMsg: `Lists the goroutines working for an errgroup, a semaphore or a channel.
+
+	[goroutine <n>] [frame <m>] workers <expression>
+
+The expression can be:
+
+- an errgroup.Group, of golang.org/x/sync/errgroup: lists the goroutines running the functions passed to its Go and TryGo methods, with the function they run, and prints the first error returned by them
+- a semaphore.Weighted, of golang.org/x/sync/semaphore: lists the goroutines waiting to acquire it
+- a channel, for example the queue of the jobs of a pool of workers: lists the goroutines blocked receiving from it and sending to it
+
+Pointers to them are dereferenced. The goroutines are grouped by the location of the go statement that created them, with their state.`},
+		{aliases: []string{"timers"}, group: goroutineCmds, cmdFn: timersCommand, helpMsg: `Lists the pending timers of the runtime.
+
+	timers [<kind>...]
+
+Lists the timers sorted by the time they fire, optionally only the ones of the kinds specified:
+
+- timer: a time.Timer, with the goroutines receiving from its channel
+- ticker: a time.Ticker, with its period and the goroutines receiving from its channel
+- afterfunc: a function passed to time.AfterFunc, with the function
+- sleep: a goroutine sleeping in time.Sleep
+- runtime: the other timers, for example the deadlines of network connections, with the function called by the runtime when they fire
+
+For live targets on linux the time they fire is relative to the current time, a timer that should have fired already is overdue, otherwise it is the time of the monotonic clock of the target. Since Go 1.23 the timers and tickers are only pending while a goroutine is receiving from their channel.`},
+		{aliases: []string{"finalizers"}, group: dataCmds, cmdFn: finalizersCommand, helpMsg: `Lists the finalizers of the target.
+
+	finalizers [-v] [<type>]
+
+Prints the state of the goroutine running the finalizers, and the finalizers set with runtime.SetFinalizer and cleanups added with runtime.AddCleanup, counted by type of the object and function:
+
+- the finalizers queued, of the objects that are unreachable, waiting for the finalizer goroutine to run them: a long queue while the goroutine is running a finalizer means that the finalizer is stuck, and that the resources released by the queued finalizers leak
+- the finalizers and cleanups of the objects still reachable
+
+With a type, with or without the leading '*' of the pointer types, only the finalizers of the objects of that type are listed; with -v the address of every object is listed. Use breakfinalizer to stop when a finalizer runs.`},
 		{aliases: []string{"whatis"}, group: dataCmds, cmdFn: whatisCommand, helpMsg: `Prints type of an expression.
 
 	whatis <expression>`},
@@ -224,7 +313,7 @@ See $GOPATH/src/github.com/go-delve/delve/Documentation/cli/expr.md for a descri
 
 	[goroutine <n>] [frame <m>] set <variable> = <value>
 
-See $GOPATH/src/github.com/go-delve/delve/Documentation/cli/expr.md for a description of supported expressions. Only numerical variables and pointers can be changed.`},
+See $GOPATH/src/github.com/go-delve/delve/Documentation/cli/expr.md for a description of supported expressions. Composite literals (for example "set s = {A: 1, B: 2}") can be assigned to structs, arrays and slices, assignments that need to allocate memory, and assignments of map literals, can only be executed with the call command.`},
 		{aliases: []string{"sources"}, cmdFn: sources, helpMsg: `Print list of source files.
 
 	sources [<regex>]
@@ -257,6 +346,13 @@ If regex is specified only local variables with a name matching it will be retur
 	vars [-v] [<regex>]
 
 If regex is specified only package variables with a name matching it will be returned. If -v is specified more information about each package variable will be shown.`},
+		{aliases: []string{"returnvalues"}, cmdFn: returnValues, group: dataCmds, helpMsg: `Print the values returned by the last function stepped out of or over.
+
+	returnvalues [-v] [<regex>]
+
+Prints the values returned by the function that the last stepout command stepped out of or, after a next command, by the last function called by the line that was stepped over, even if they were discarded by the caller. The values are discarded when execution is resumed.
+
+If regex is specified only return values with a name matching it will be printed. If -v is specified more information about each return value will be shown.`},
 		{aliases: []string{"regs"}, cmdFn: regs, group: dataCmds, helpMsg: `Print contents of CPU registers.
 
 	regs [-a]
@@ -273,6 +369,8 @@ When connected to a headless instance started with the --accept-multiclient, pas
 
 Show source around current point or provided linespec.
 
+The sources of dependencies missing from the local module cache are downloaded from the module proxies in GOPROXY, or from their version control system, into the cache of Delve. They are verified against the go.sum file of the module of the current directory or, like the go command does, against the checksum database (see GOSUMDB and GONOSUMDB). Set GOPROXY=off to disable downloads.
+
 For example:
 
 	frame 1 list 69
@@ -281,11 +379,12 @@ For example:
 	list 40`},
 		{aliases: []string{"stack", "bt"}, allowedPrefixes: onPrefix, group: stackCmds, cmdFn: stackCommand, helpMsg: `Print stack trace.
 
-	[goroutine <n>] [frame <m>] stack [<depth>] [-full] [-offsets] [-defer] [-a <n>] [-adepth <depth>] [-mode <mode>]
+	[goroutine <n>] [frame <m>] stack [<depth>] [-full] [-offsets] [-defer] [-hidden] [-a <n>] [-adepth <depth>] [-mode <mode>]
 
 	-full		every stackframe is decorated with the value of its local variables and arguments.
 	-offsets	prints frame offset of each frame.
 	-defer		prints deferred function call stack for each frame.
+	-hidden		prints the frames hidden by the frame-filters configuration parameter.
 	-a <n>		prints stacktrace of n ancestors of the selected goroutine (target process must have tracebackancestors enabled)
 	-adepth <depth>	configures depth of ancestor stacktrace
 	-mode <mode>	specifies the stacktrace mode, possible values are:
@@ -332,6 +431,11 @@ Move the current frame down by <m>. The second form runs the command on the give
 	deferred <n> <command>
 
 Executes the specified command (print, args, locals) in the context of the n-th deferred call in the current frame.`},
+		{aliases: []string{"defers"}, group: stackCmds, cmdFn: defersCommand, helpMsg: `Print the pending deferred calls of the selected goroutine.
+
+	[goroutine <n>] defers [<depth>]
+
+Prints the deferred calls of the first <depth> frames (default 50) in the order they will be executed, with the function they call and their arguments (or the variables captured by the deferred closure). If the goroutine is panicking the deferred call that will recover the panic is marked.`},
 		{aliases: []string{"source"}, cmdFn: c.sourceCommand, helpMsg: `Executes a file containing a list of delve commands
 
 	source <path>
@@ -347,16 +451,190 @@ If no argument is specified the function being executed in the selected stack fr
 
 	-a <start> <end>	disassembles the specified address range
 	-l <locspec>		disassembles the specified function`},
+		{aliases: []string{"trace-runtime"}, group: runCmds, cmdFn: traceRuntimeCmd, helpMsg: `Writes a runtime execution trace of the target, for 'go tool trace'.
+
+	trace-runtime start [<file>]
+	trace-runtime stop
+
+The first form starts the trace, like runtime/trace.Start, written to the specified file (trace.out by default). The second form stops it and closes the file. The functions of runtime/trace are called on the current goroutine, the target must call trace.Start and trace.Stop somewhere, so that they are linked in the executable (net/http/pprof does), and support function calls.
+
+If trace.Log is also linked in the executable, while the trace is written every stop at a breakpoint is logged in the trace with category "delve" on the goroutine that stopped, when the target is resumed, with the breakpoint, where it stopped and for how long. The messages appear on the timelines of the goroutines in 'go tool trace', to correlate the stops with the scheduling of the goroutines. The trace is lost if the target is restarted or exits before the trace is stopped.`},
+		{aliases: []string{"profile"}, group: runCmds, cmdFn: profileCmd, helpMsg: `Collects a profile of the target in pprof format.
+
+	profile cpu <duration> [-o <file>] [-open]
+	profile heap [-o <file>] [-open]
+	profile cmalloc <duration> [-go] [-o <file>] [-open]
+
+The cpu profile resumes the target for the specified duration (for example 10s) and periodically stops it to sample the stacks of the running goroutines. Profiling ends early if a breakpoint is reached, the target is halted (for example with ctrl-C) or exits.
+
+The heap profile is read from the memory profile maintained by the runtime of the target, it is equivalent to the profile returned by runtime/pprof and does not resume the target.
+
+The cmalloc profile resumes the target for the specified duration and traces the calls to malloc, calloc, realloc and free of the C library, to find the memory leaked by C code called with cgo. It is a heap profile of the memory allocated through each stack during the profile, the in use memory is the part that was not freed when the profile ended. With -go the allocations of Go, by runtime.mallocgc, are also traced for comparison, the memory they free is not tracked. Every allocation stops the target twice, which slows it down considerably. Profiling ends early if a breakpoint is reached or the target exits.
+
+The profile is saved to cpu.pprof, heap.pprof or cmalloc.pprof in the current directory, unless a different file is specified with -o. If -open is specified 'go tool pprof' is started on the profile.`},
+		{aliases: []string{"watch"}, group: breakCmds, cmdFn: watchCmd, helpMsg: `Stops when the value of an expression changes.
+
+	watch --expr <expression> [--at <location>...]
+	watch
+	watch --clear <id>
+
+The first form starts watching the value of the expression, the target stops whenever it differs from the previous evaluation and the change is printed. Unlike a hardware watchpoint the expression can be any expression, for example one computed from multiple fields.
+
+Without --at the expression is evaluated on the current goroutine every time the target stops, including at tracepoints and sample breakpoints, which then stop the target if the value changed. With --at the expression is evaluated only when the target reaches one of the locations (see $GOPATH/src/github.com/go-delve/delve/Documentation/cli/locspec.md), on the goroutine that reached it, by breakpoints named watch<id> that do not stop the target unless the value changed.
+
+Evaluations that fail, for example because a variable is not in scope, are ignored. Previous values are forgotten when the target is restarted.
+
+Without arguments watch lists the watched expressions with their last value, --clear stops watching an expression.`},
+		{aliases: []string{"catch"}, group: breakCmds, cmdFn: catchCmd, helpMsg: `Stops when the target enters or returns from a system call, opens a file, dials an address or sends an HTTP request.
+
+	catch syscall <name>...
+	catch
+	catch --clear [<name>...]
+	catch open <pattern>
+	catch dial <pattern>
+	catch http <pattern>
+
+The first form adds the system calls, specified by their linux names, for example openat or connect, to the caught system calls: the target stops every time one of its threads enters or returns from one of them, which becomes the current thread, and the system call is printed with its arguments, decoded for the system calls operating on files and sockets, or with the value it returned.
+
+Without arguments catch lists the caught system calls, --clear stops catching the specified system calls, or all of them. System calls are caught again when the target is restarted.
+
+Only supported by the native backend on linux, version 5.3 or later. While any system call is caught every system call made by the target stops it briefly, slowing it down.
+
+The last three forms create breakpoints on the functions of the standard library opening files (os.OpenFile), dialing network addresses (net.Dialer.DialContext) and sending HTTP requests (net/http.Transport.RoundTrip), which stop when the file name, the address, for example example.com:443, or the URL of the request, without its query, matches pattern. In the pattern '*' matches any sequence of characters, including '/', and '?' any single character, for example:
+
+	catch open /etc/*
+	catch dial *:5432
+	catch http https://api.example.com/v1/*
+
+The breakpoints are listed and deleted like any other breakpoint and work with every backend and operating system.`},
+		{aliases: []string{"breakhttp"}, group: breakCmds, cmdFn: breakhttpCmd, helpMsg: `Stops when the target starts serving an HTTP request.
+
+	breakhttp [--method <method>] [--route <pattern>] [--header <name>=<pattern>]...
+
+Creates a breakpoint in the net/http server that stops only for the requests with the specified method, a path matching the route pattern and, for each --header option, a header whose first value matches the pattern, for example:
+
+	breakhttp --method POST --route /api/v1/users/* --header x-debug=1
+
+In patterns '*' matches any sequence of characters, including '/', and '?' any single character; header names are case insensitive. Without options every request stops the target.
+
+The target stops in net/http before the handlers of the program, including the routers built on net/http, are called; the request is the variable req, use step or a breakpoint on the handler to reach it. The breakpoint is listed and deleted like any other breakpoint.`},
+		{aliases: []string{"breakgrpc"}, group: breakCmds, cmdFn: breakgrpcCmd, helpMsg: `Stops when the target starts serving a gRPC call.
+
+	breakgrpc [--method <pattern>] [--metadata <key>=<pattern>]...
+
+Creates a breakpoint in the server of google.golang.org/grpc that stops only for the calls of a method whose full name matches the pattern, for example /helloworld.Greeter/SayHello, and, for each --metadata option, with a key of the metadata whose first value matches the pattern, for example:
+
+	breakgrpc --method /shop.Orders/* --metadata tenant=acme
+
+In patterns '*' matches any sequence of characters, including '/', and '?' any single character; metadata keys are case insensitive. Without options every call stops the target.
+
+The target stops in the grpc package before the interceptors and the handlers of the program are called; the stream of the call is the variable stream, use a breakpoint on the handler of the method to reach it. The breakpoint is listed and deleted like any other breakpoint.`},
+		{aliases: []string{"breakfinalizer"}, group: breakCmds, cmdFn: breakfinalizerCmd, helpMsg: `Stops when a finalizer of an object of a type runs.
+
+	breakfinalizer <type>
+
+Creates a breakpoint on each function set as the finalizer of an object of the type, with or without the leading '*' of the pointer types, that stops only when the finalizer goroutine calls it, for example:
+
+	breakfinalizer *os.file
+
+Only the functions of the finalizers already set are known, see the finalizers command. The breakpoints are listed and deleted like any other breakpoint.`},
+		{aliases: []string{"bisect"}, group: runCmds, cmdFn: bisectCmd, helpMsg: `Finds the statement that makes a condition true.
+
+	bisect <start> <end> <predicate>
+
+Start and end are locations (see $GOPATH/src/github.com/go-delve/delve/Documentation/cli/locspec.md) and predicate is a boolean expression, for example:
+
+	bisect main.go:20 main.go:25 total > 100
+
+Every time the target reaches start is an iteration, the predicate must be false at the first iteration and true when the target reaches end. Bisect restarts the target, or replays the recording, to evaluate the predicate at an iteration and finds with a binary search the first iteration where it is true, then steps through the iteration before it, with next, until the predicate is true. The target is left stopped after the statement that made the predicate true.
+
+The target must behave the same way every time it is restarted, which is always true for recordings. Other breakpoints are ignored while bisecting.`},
+		{aliases: []string{"callers"}, group: runCmds, cmdFn: callersCmd, helpMsg: `Records the callers of a function.
+
+	callers <function> --record <duration>
+
+Resumes the target for the specified duration (for example 10s), recording the stack of callers of every call to the function, then prints the tree of its callers: the callers of each caller are printed below it, indented, with the number of calls made through them. Unlike the call graph computed from the source code the tree includes the calls made through interfaces and function values.
+
+Calls are intercepted by a temporary breakpoint on the entry of the function, creating it fails if a breakpoint already exists there. Recording ends early if another breakpoint is reached or the target exits.`},
+		{aliases: []string{"runtimestats"}, cmdFn: runtimeStats, helpMsg: `Print memory and scheduler statistics of the target.
+
+	runtimestats
+
+Statistics are read directly from the memory of the runtime of the target, it works on core files and does not require the target program to export them. Statistics that can not be read, because the version of Go used to build the target stores them differently, are omitted.`},
+		{aliases: []string{"stoptime"}, cmdFn: stopTimeCmd, helpMsg: `Print how long the target was stopped by the debugger.
+
+	stoptime
+
+The target is stopped from when a command, for example continue or next, stops it to when the next one resumes it. The time is printed in total and by the command that stopped the target, launch, attach and restart are the stops of new processes. The time the target is stopped while a command runs, for example to evaluate the condition of a breakpoint, is not included.
+
+The '--stop-time-alarm' command line option logs a warning when the target stays stopped longer than the specified duration.`},
+		{aliases: []string{"timeline"}, cmdFn: timelineCmd, helpMsg: `Prints the stops of the target recorded during the debugging session.
+
+	timeline [-bp <breakpoint name or id>]
+	timeline <index>
+	timeline -o <file>
+	timeline eval [<expr>]
+	timeline eval -clear
+
+Every command that resumes the target, for example continue, next or call, and every restart records the stop it ends with in the timeline, with why the target stopped, the goroutine and the location, including the exit of the target. The timeline is kept when the target is restarted, only the last 10000 stops are kept.
+
+The expressions of a breakpoint are recorded with the stops at the breakpoint. Expressions added with 'on <breakpoint> print <expr>' are recorded when the breakpoint stops the target, expressions added with 'on <breakpoint> sample <expr>' are recorded every time the breakpoint is reached, without stopping the target, like printf debugging without rebuilding the program.
+
+The first form lists the stops, with the values of their expressions, only the stops at the specified breakpoint if -bp is used. The second form prints the stop with the specified index. The third form writes the timeline to the specified file in JSON format.
+
+The fourth form adds an expression evaluated on the current goroutine at every stop recorded from now on, or lists the expressions without arguments. The last form removes all the expressions.`},
+		{aliases: []string{"log"}, cmdFn: logCmd, helpMsg: `Prints or changes the log levels of Delve, or prints its last log entries.
+
+	log
+	log <component> <level>
+	log dump [<file>]
+
+Called without arguments prints the log level of each component of Delve. With a component and a level, one of panic, fatal, error, warning, info, debug or trace, changes the level of the component, see 'dlv help log' for the list of components. Logs are written to the destination specified with --log-dest when Delve was started, standard error by default.
+
+'log dump' prints the last 1000 log entries, oldest first, or writes them to the specified file. They are kept in memory even if logging was not enabled when Delve was started, but only for the levels enabled when they were logged.`},
 		{aliases: []string{"on"}, group: breakCmds, cmdFn: c.onCmd, helpMsg: `Executes a command when a breakpoint is hit.
 
 	on <breakpoint name or id> <command>.
 
 Supported commands: print, stack and goroutine)`},
+		{aliases: []string{"sample"}, group: breakCmds, allowedPrefixes: onPrefix, cmdFn: sampleCmd, helpMsg: `Records expressions without stopping, or prints the recorded values.
+
+	on <breakpoint name or id> sample <expression>
+	sample [-clear]
+
+When used with the 'on' command the breakpoint becomes a sample breakpoint: every time it is reached the expression is evaluated, its value is recorded, also in the timeline (see 'help timeline'), and execution resumes without stopping. Can be used multiple times on the same breakpoint to record more than one expression.
+
+Called without the 'on' prefix prints all recorded values, oldest first. If -clear is specified the recorded values are discarded after being printed.`},
+		{aliases: []string{"coverage"}, group: breakCmds, cmdFn: coverageCmd, helpMsg: `Records which lines of a set of functions are executed.
+
+	coverage add <location or file> [<location or file>...]
+	coverage
+	coverage clear
+
+Use 'coverage add' to start tracking the lines of the functions a location resolves to, for example a function name or a regular expression, or of all the functions of a source file ending in .go. The first time a line is executed it is recorded and the breakpoint used to detect it is cleared, afterwards the line runs at full speed. The target never stops because of line coverage.
+
+Called without arguments prints, for each function, how many of its lines were executed and the lines that were not executed. Line coverage starts over when the target is restarted, 'coverage clear' stops it.`},
 		{aliases: []string{"condition", "cond"}, group: breakCmds, cmdFn: conditionCmd, helpMsg: `Set breakpoint condition.
 
 	condition <breakpoint name or id> <boolean expression>.
+	condition -stack-contains <breakpoint name or id> [<function> [<depth>]]
+
+Specifies that the breakpoint or tracepoint should break only if the boolean expression is true.
+
+With -stack-contains the breakpoint or tracepoint breaks only if one of the innermost depth frames of the stack, 50 by default, is a call to the specified function, for example:
+
+	condition -stack-contains 1 mypkg.HandleRequest
+
+only stops at breakpoint 1 when it is reached by a call from mypkg.HandleRequest. The function is specified like in the break command. If no function is specified the constraint is removed. The stack constraint is checked after the boolean expression.
+
+When Delve is started with --compile-conditions, simple conditions, comparisons of integer variables with constants joined by &&, are evaluated in the target without stopping it, which makes breakpoints with conditions that are rarely true much faster. This is only supported by the native backend on linux/amd64, other conditions are evaluated as usual.`},
+		{aliases: []string{"frompanic"}, group: breakCmds, cmdFn: fromPanic, helpMsg: `Sets breakpoints on the frames of a Go stack trace.
 
-Specifies that the breakpoint or tracepoint should break only if the boolean expression is true.`},
+	frompanic [-b <frames>] [<file>]
+
+Reads a stack trace, for example the output of a program that panicked, from file or, if no file is specified, pasted in the terminal and terminated by an empty line or by Ctrl-D. Each frame of the stack trace is mapped to a location of the current binary, using its position or, if the position can not be found, its function, and the frames are printed with their numbers.
+
+Breakpoints are then set on the frames selected at the prompt, or on the frames specified with -b, as a list of frame numbers and ranges like '0,2-4' or as 'all'.`},
 		{aliases: []string{"config"}, cmdFn: configureCmd, helpMsg: `Changes configuration parameters.
 
 	config -list
@@ -369,12 +647,16 @@ Saves the configuration file to disk, overwriting the current configuration file
 
 	config <parameter> <value>
 
-Changes the value of a configuration parameter.
+Changes the value of a configuration parameter. Parameters that are lists, like step-skip-packages, take a space separated list of values.
 
-	config substitute-path <from> <to>
+	config substitute-path [-regex] <from> <to>
 	config substitute-path <from>
 
-Adds or removes a path substitution rule.
+Adds or removes a path substitution rule. With -regex <from> is a regular expression and its first match is replaced with <to>, which can refer to submatches as $1, $2, etc. If no rule matches a file that does not exist, paths inside the module cache or a GOPATH of the machine where the program was built are mapped to the local module cache or GOPATH. The paths of programs built with -trimpath are mapped to the module cache, to GOROOT or to the directories of the modules listed in the go.mod or go.work file of the current directory, including local replacements.
+
+	config substitute-path -test <path>
+
+Shows how <path> is mapped by the substitution rules, and the rules ignored because their regular expression is invalid.
 
 	config alias <command> <alias>
 	config alias <alias>
@@ -390,15 +672,22 @@ If locspec is omitted edit will open the current source file in the editor, othe
 
 		{aliases: []string{"examinemem", "x"}, group: dataCmds, cmdFn: examineMemoryCmd, helpMsg: `Examine memory:
 
-	examinemem [-fmt <format>] [-len <length>] <address>
+	examinemem [-fmt <format>] [-len <length>] [-display] <address>
+	examinemem -display
+	examinemem -undisplay <number>
 
 Format represents the data format and the value is one of this list (default hex): bin(binary), oct(octal), dec(decimal), hex(hexadecimal),.
 Length is the number of bytes (default 1) and must be less than or equal to 1000.
 Address is the memory location of the target to examine.
 
+The contents of memory are remembered, when the same address is examined again the bytes that changed since the last time are highlighted and counted.
+
+The '-display' option also adds the memory to the list of memory printed every time the program stops, like the display command, to watch how a buffer changes. Without an address it prints all the memory of the list. The '-undisplay' option removes the specified memory from the list.
+
 For example:
 
-    x -fmt hex -len 20 0xc00008af38`},
+    x -fmt hex -len 20 0xc00008af38
+    x -display -len 16 0xc00008af38`},
 
 		{aliases: []string{"display"}, group: dataCmds, cmdFn: display, helpMsg: `Print value of an expression every time the program stops.
 
@@ -408,6 +697,31 @@ For example:
 The '-a' option adds an expression to the list of expression printed every time the program stops. The '-d' option removes the specified expression from the list.
 
 If display is called without arguments it will print the value of all expression in the list.`},
+
+		{aliases: []string{"snapshot"}, cmdFn: snapshotCmd, helpMsg: `Captures the state of the stopped target into a snapshot.
+
+	snapshot [note]
+
+The snapshot is kept in memory and can be inspected, with switch-snapshot, after the target resumes or exits. The "note" is arbitrary text that can be used to identify the snapshot, if it is not specified it defaults to the current filename:line position.`},
+		{aliases: []string{"snapshots"}, cmdFn: snapshots, helpMsg: "Print out info for existing snapshots."},
+		{aliases: []string{"switch-snapshot"}, cmdFn: switchSnapshot, helpMsg: `Selects a snapshot.
+
+	switch-snapshot [<id>]
+
+While a snapshot is selected the commands that inspect the target, like print, stack or goroutines, read the snapshot and the commands that resume the target are refused. Without arguments the process is selected again.`},
+		{aliases: []string{"clear-snapshot"}, cmdFn: clearSnapshot, helpMsg: `Deletes snapshot.
+
+	clear-snapshot <id>`},
+		{aliases: []string{"targets"}, cmdFn: targets, helpMsg: `Print out the processes being debugged.
+
+Lists the target followed by its child processes debugged with --follow-exec, each one by a headless instance of Delve whose address is printed. The selected process is marked with *.
+
+The breakpoints on lines and functions are created in every child process whose executable contains their location. --follow-exec is only supported by the native backend on linux.`},
+		{aliases: []string{"switch-target"}, cmdFn: switchTarget, helpMsg: `Selects a process being debugged.
+
+	switch-target [<pid>]
+
+Selects one of the processes listed by targets: the commands that follow are sent to the instance of Delve debugging it. Without arguments the target is selected again. Breakpoints created while a child process is selected are only created in it.`},
 	}
 
 	addrecorded := client == nil
@@ -606,8 +920,8 @@ func threads(t *Term, ctx callContext, args string) error {
 			prefix = "* "
 		}
 		if th.Function != nil {
-			fmt.Printf("%sThread %d at %#v %s:%d %s\n",
-				prefix, th.ID, th.PC, shortenFilePath(th.File),
+			fmt.Printf("%sThread %d%s at %#v %s:%d %s\n",
+				prefix, th.ID, threadDetails(th), th.PC, shortenFilePath(th.File),
 				th.Line, th.Function.Name())
 		} else {
 			fmt.Printf("%sThread %s\n", prefix, formatThread(th))
@@ -878,7 +1192,32 @@ func formatThread(th *api.Thread) string {
 	if th == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("%d at %s:%d", th.ID, shortenFilePath(th.File), th.Line)
+	return fmt.Sprintf("%d%s at %s:%d", th.ID, threadDetails(th), shortenFilePath(th.File), th.Line)
+}
+
+// threadDetails returns the name of th and its M and P, formatted to follow
+// its ID.
+func threadDetails(th *api.Thread) string {
+	var r string
+	if th.Name != "" {
+		r = fmt.Sprintf(" [%s]", th.Name)
+	}
+	if mp := formatMP(th.M, th.P); mp != "" {
+		r += " (" + mp + ")"
+	}
+	return r
+}
+
+// formatMP formats the IDs of the M and the P of a thread or goroutine,
+// which are -1 if unknown.
+func formatMP(m, p int) string {
+	switch {
+	case m < 0:
+		return ""
+	case p < 0:
+		return fmt.Sprintf("M %d", m)
+	}
+	return fmt.Sprintf("M %d, P %d", m, p)
 }
 
 type formatGoroutineLoc int
@@ -919,14 +1258,30 @@ func formatGoroutine(g *api.Goroutine, fgl formatGoroutineLoc) string {
 	}
 	thread := ""
 	if g.ThreadID != 0 {
-		thread = fmt.Sprintf(" (thread %d)", g.ThreadID)
+		thread = fmt.Sprintf(" (thread %d", g.ThreadID)
+		if g.ThreadName != "" {
+			thread += fmt.Sprintf(" [%s]", g.ThreadName)
+		}
+		if mp := formatMP(g.M, g.P); mp != "" {
+			thread += ", " + mp
+		}
+		thread += ")"
+	}
+	return fmt.Sprintf("%d%s - %s: %s%s", g.ID, goroutineName(g), locname, formatLocation(loc), thread)
+}
+
+// goroutineName returns the name of g, for the threads of interest of
+// flavors, formatted to follow its ID.
+func goroutineName(g *api.Goroutine) string {
+	if g.Name == "" {
+		return ""
 	}
-	return fmt.Sprintf("%d - %s: %s%s", g.ID, locname, formatLocation(loc), thread)
+	return fmt.Sprintf(" [%s]", g.Name)
 }
 
 func writeGoroutineLong(w io.Writer, g *api.Goroutine, prefix string) {
-	fmt.Fprintf(w, "%sGoroutine %d:\n%s\tRuntime: %s\n%s\tUser: %s\n%s\tGo: %s\n%s\tStart: %s\n",
-		prefix, g.ID,
+	fmt.Fprintf(w, "%sGoroutine %d%s:\n%s\tRuntime: %s\n%s\tUser: %s\n%s\tGo: %s\n%s\tStart: %s\n",
+		prefix, g.ID, goroutineName(g),
 		prefix, formatLocation(g.CurrentLoc),
 		prefix, formatLocation(g.UserCurrentLoc),
 		prefix, formatLocation(g.GoStatementLoc),
@@ -998,7 +1353,7 @@ func restartRecorded(t *Term, ctx callContext, args string) error {
 		}
 	}
 
-	if err := restartIntl(t, rerecord, restartPos, resetArgs, newArgv, newRedirects); err != nil {
+	if err := restartIntl(t, rerecord, restartPos, resetArgs, newArgv, newRedirects, false); err != nil {
 		return err
 	}
 
@@ -1022,12 +1377,20 @@ func parseOptionalCount(arg string) (int64, error) {
 }
 
 func restartLive(t *Term, ctx callContext, args string) error {
+	rebuild := false
+	if v := split2PartsBySpace(args); v[0] == "--rebuild" {
+		rebuild = true
+		args = ""
+		if len(v) == 2 {
+			args = v[1]
+		}
+	}
 	resetArgs, newArgv, newRedirects, err := parseNewArgv(args)
 	if err != nil {
 		return err
 	}
 
-	if err := restartIntl(t, false, "", resetArgs, newArgv, newRedirects); err != nil {
+	if err := restartIntl(t, false, "", resetArgs, newArgv, newRedirects, rebuild); err != nil {
 		return err
 	}
 
@@ -1035,15 +1398,19 @@ func restartLive(t *Term, ctx callContext, args string) error {
 	return nil
 }
 
-func restartIntl(t *Term, rerecord bool, restartPos string, resetArgs bool, newArgv []string, newRedirects [3]string) error {
-	discarded, err := t.client.RestartFrom(rerecord, restartPos, resetArgs, newArgv, newRedirects, false)
+func restartIntl(t *Term, rerecord bool, restartPos string, resetArgs bool, newArgv []string, newRedirects [3]string, rebuild bool) error {
+	discarded, err := t.client.RestartFrom(rerecord, restartPos, resetArgs, newArgv, newRedirects, rebuild)
 	if err != nil {
 		return err
 	}
+	printDiscarded(discarded)
+	return nil
+}
+
+func printDiscarded(discarded []api.DiscardedBreakpoint) {
 	for i := range discarded {
 		fmt.Printf("Discarded %s at %s: %v\n", formatBreakpointName(discarded[i].Breakpoint, false), formatBreakpointLocation(discarded[i].Breakpoint), discarded[i].Reason)
 	}
-	return nil
 }
 
 func parseNewArgv(args string) (resetArgs bool, newArgv []string, newRedirects [3]string, err error) {
@@ -1122,12 +1489,25 @@ func (c *Commands) rebuild(t *Term, ctx callContext, args string) error {
 	if ctx.Prefix == revPrefix {
 		return c.rewind(t, ctx, args)
 	}
-	defer t.onStop()
+	cont := false
+	switch args {
+	case "":
+	case "-c":
+		cont = true
+	default:
+		return fmt.Errorf("wrong argument to rebuild: %q", args)
+	}
 	discarded, err := t.client.Restart(true)
-	if len(discarded) > 0 {
-		fmt.Printf("not all breakpoints could be restored.")
+	if err != nil {
+		return err
 	}
-	return err
+	printDiscarded(discarded)
+	if cont {
+		return c.cont(t, callContext{}, "")
+	}
+	fmt.Println("Process restarted with PID", t.client.ProcessPid())
+	t.onStop()
+	return nil
 }
 
 func (c *Commands) cont(t *Term, ctx callContext, args string) error {
@@ -1187,7 +1567,7 @@ func scopePrefixSwitch(t *Term, ctx callContext) error {
 
 func exitedToError(state *api.DebuggerState, err error) (*api.DebuggerState, error) {
 	if err == nil && state.Exited {
-		return nil, fmt.Errorf("Process has exited with status %d", state.ExitStatus)
+		return nil, api.Errorf(api.ErrCodeProcessExited, "Process has exited with status %d", state.ExitStatus)
 	}
 	return state, err
 }
@@ -1198,7 +1578,15 @@ func (c *Commands) step(t *Term, ctx callContext, args string) error {
 	}
 	c.frame = 0
 	stepfn := t.client.Step
-	if ctx.Prefix == revPrefix {
+	switch args = strings.TrimSpace(args); {
+	case args == "-chan":
+		if ctx.Prefix == revPrefix {
+			return errors.New("can not follow channel sends backwards")
+		}
+		stepfn = t.client.StepFollowChannel
+	case args != "":
+		return fmt.Errorf("unknown argument %q", args)
+	case ctx.Prefix == revPrefix:
 		stepfn = t.client.ReverseStep
 	}
 	state, err := exitedToError(stepfn())
@@ -1395,13 +1783,25 @@ func (a byID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a byID) Less(i, j int) bool { return a[i].ID < a[j].ID }
 
 func breakpoints(t *Term, ctx callContext, args string) error {
+	stats := false
+	switch args {
+	case "":
+	case "--stats":
+		stats = true
+	default:
+		return fmt.Errorf("wrong argument: %q", args)
+	}
 	breakPoints, err := t.client.ListBreakpoints()
 	if err != nil {
 		return err
 	}
 	sort.Sort(byID(breakPoints))
 	for _, bp := range breakPoints {
-		fmt.Printf("%s at %v (%d)\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp), bp.TotalHitCount)
+		hot := ""
+		if bp.Stats != nil && bp.Stats.Hot {
+			hot = " (hot)"
+		}
+		fmt.Printf("%s at %v (%d)%s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp), bp.TotalHitCount, hot)
 
 		var attrs []string
 		if bp.Cond != "" {
@@ -1413,6 +1813,19 @@ func breakpoints(t *Term, ctx callContext, args string) error {
 		if bp.Goroutine {
 			attrs = append(attrs, "\tgoroutine")
 		}
+		if bp.ErrorReturn {
+			attrs = append(attrs, "\ton-error")
+		}
+		if bp.AtExit {
+			attrs = append(attrs, "\tat-exit")
+		}
+		if bp.StackContains != "" {
+			if bp.StackContainsDepth > 0 {
+				attrs = append(attrs, fmt.Sprintf("\tstack contains %s within %d frames", bp.StackContains, bp.StackContainsDepth))
+			} else {
+				attrs = append(attrs, fmt.Sprintf("\tstack contains %s", bp.StackContains))
+			}
+		}
 		if bp.LoadArgs != nil {
 			if *(bp.LoadArgs) == longLoadConfig {
 				attrs = append(attrs, "\targs -v")
@@ -1427,8 +1840,15 @@ func breakpoints(t *Term, ctx callContext, args string) error {
 				attrs = append(attrs, "\tlocals")
 			}
 		}
+		verb := "print"
+		if bp.Sample {
+			verb = "sample"
+		}
 		for i := range bp.Variables {
-			attrs = append(attrs, fmt.Sprintf("\tprint %s", bp.Variables[i]))
+			attrs = append(attrs, fmt.Sprintf("\t%s %s", verb, bp.Variables[i]))
+		}
+		if stats && bp.Stats != nil {
+			attrs = append(attrs, fmt.Sprintf("\tcondition evaluated %d times, %d false, %v on average, up to %d times per second", bp.Stats.CondEvals, bp.Stats.FalseHits, bp.Stats.CondTime/time.Duration(bp.Stats.CondEvals), bp.Stats.MaxRate))
 		}
 		if len(attrs) > 0 {
 			fmt.Printf("%s\n", strings.Join(attrs, "\n"))
@@ -1438,6 +1858,26 @@ func breakpoints(t *Term, ctx callContext, args string) error {
 }
 
 func setBreakpoint(t *Term, ctx callContext, tracepoint bool, argstr string) error {
+	if argstr == "--runtime" || strings.HasPrefix(argstr, "--runtime ") {
+		return setRuntimeEventBreakpoint(t, tracepoint, strings.TrimSpace(argstr[len("--runtime"):]))
+	}
+	onError, atExit := false, false
+	for {
+		switch {
+		case argstr == "--on-error" || strings.HasPrefix(argstr, "--on-error "):
+			onError = true
+			argstr = strings.TrimSpace(argstr[len("--on-error"):])
+			continue
+		case !tracepoint && (argstr == "--at-exit" || strings.HasPrefix(argstr, "--at-exit ")):
+			atExit = true
+			argstr = strings.TrimSpace(argstr[len("--at-exit"):])
+			continue
+		}
+		break
+	}
+	if onError && atExit {
+		return errors.New("--on-error and --at-exit can not be used together")
+	}
 	args := split2PartsBySpace(argstr)
 
 	requestedBp := &api.Breakpoint{}
@@ -1470,11 +1910,44 @@ func setBreakpoint(t *Term, ctx callContext, tracepoint bool, argstr string) err
 			return err
 		}
 	}
+
+	var shouldSetReturnBreakpoints bool
+	loc, err := locspec.Parse(spec)
+	if err != nil {
+		return err
+	}
+	switch t := loc.(type) {
+	case *locspec.NormalLocationSpec:
+		shouldSetReturnBreakpoints = t.LineOffset == -1 && t.FuncBase != nil
+	case *locspec.RegexLocationSpec:
+		shouldSetReturnBreakpoints = true
+	}
+
+	if onError {
+		if !shouldSetReturnBreakpoints {
+			return errors.New("--on-error can only be used with functions")
+		}
+		return setErrorReturnBreakpoints(t, requestedBp.Name, tracepoint, locs)
+	}
+
+	if atExit {
+		if !shouldSetReturnBreakpoints {
+			return errors.New("--at-exit can only be used with functions")
+		}
+		requestedBp.AtExit = true
+	}
+
 	for _, loc := range locs {
 		requestedBp.Addr = loc.PC
 		requestedBp.Addrs = loc.PCs
 		if tracepoint {
 			requestedBp.LoadArgs = &ShortLoadConfig
+			if !shouldSetReturnBreakpoints {
+				// tracepoints set on a line inside a function also report the
+				// value of local variables, since that is usually why the line
+				// was chosen.
+				requestedBp.LoadLocals = &ShortLoadConfig
+			}
 		}
 
 		bp, err := t.client.CreateBreakpoint(requestedBp)
@@ -1482,20 +1955,13 @@ func setBreakpoint(t *Term, ctx callContext, tracepoint bool, argstr string) err
 			return err
 		}
 
-		fmt.Printf("%s set at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
+		if bp.AtExit {
+			fmt.Printf("%s set at exit of %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
+		} else {
+			fmt.Printf("%s set at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
+		}
 	}
 
-	var shouldSetReturnBreakpoints bool
-	loc, err := locspec.Parse(spec)
-	if err != nil {
-		return err
-	}
-	switch t := loc.(type) {
-	case *locspec.NormalLocationSpec:
-		shouldSetReturnBreakpoints = t.LineOffset == -1 && t.FuncBase != nil
-	case *locspec.RegexLocationSpec:
-		shouldSetReturnBreakpoints = true
-	}
 	if tracepoint && shouldSetReturnBreakpoints && locs[0].Function != nil {
 		for i := range locs {
 			if locs[i].Function == nil {
@@ -1521,6 +1987,64 @@ func setBreakpoint(t *Term, ctx callContext, tracepoint bool, argstr string) err
 	return nil
 }
 
+// setRuntimeEventBreakpoint creates a breakpoint, or tracepoint, on the
+// runtime function called when the event specified by argstr happens.
+func setRuntimeEventBreakpoint(t *Term, tracepoint bool, argstr string) error {
+	args := strings.Fields(argstr)
+	requestedBp := &api.Breakpoint{Tracepoint: tracepoint}
+	switch len(args) {
+	case 1:
+	case 2:
+		requestedBp.Name = args[0]
+		args = args[1:]
+	default:
+		return errors.New("wrong number of arguments to --runtime")
+	}
+	fnname, ok := api.RuntimeEvents[args[0]]
+	if !ok {
+		events := make([]string, 0, len(api.RuntimeEvents))
+		for event := range api.RuntimeEvents {
+			events = append(events, event)
+		}
+		sort.Strings(events)
+		return fmt.Errorf("unknown runtime event %q, must be one of: %s", args[0], strings.Join(events, ", "))
+	}
+	requestedBp.FunctionName = fnname
+	if tracepoint {
+		requestedBp.Goroutine = true
+	}
+	bp, err := t.client.CreateBreakpoint(requestedBp)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s set at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
+	return nil
+}
+
+// setErrorReturnBreakpoints creates a breakpoint, or tracepoint, on the
+// return instructions of each function in locs that is only triggered when
+// the function returns a non-nil error.
+func setErrorReturnBreakpoints(t *Term, name string, tracepoint bool, locs []api.Location) error {
+	for _, loc := range locs {
+		if loc.Function == nil {
+			continue
+		}
+		bp, err := t.client.CreateBreakpoint(&api.Breakpoint{
+			Name:         name,
+			FunctionName: loc.Function.Name(),
+			ErrorReturn:  true,
+			Tracepoint:   tracepoint,
+			TraceReturn:  tracepoint,
+			LoadArgs:     &ShortLoadConfig,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s set on error return of %s\n", formatBreakpointName(bp, true), loc.Function.Name())
+	}
+	return nil
+}
+
 func breakpoint(t *Term, ctx callContext, args string) error {
 	return setBreakpoint(t, ctx, false, args)
 }
@@ -1558,6 +2082,7 @@ func examineMemoryCmd(t *Term, ctx callContext, args string) error {
 		address int64
 		err     error
 		ok      bool
+		display bool
 	)
 
 	// Default value
@@ -1571,16 +2096,6 @@ func examineMemoryCmd(t *Term, ctx callContext, args string) error {
 			if i >= len(v) {
 				return fmt.Errorf("expected argument after -fmt")
 			}
-			fmtMapToPriFmt := map[string]byte{
-				"oct":         'o',
-				"octal":       'o',
-				"hex":         'x',
-				"hexadecimal": 'x',
-				"dec":         'd',
-				"decimal":     'd',
-				"bin":         'b',
-				"binary":      'b',
-			}
 			priFmt, ok = fmtMapToPriFmt[v[i]]
 			if !ok {
 				return fmt.Errorf("%q is not a valid format", v[i])
@@ -1599,6 +2114,18 @@ func examineMemoryCmd(t *Term, ctx callContext, args string) error {
 			if length > 1000 {
 				return fmt.Errorf("len must be less than or equal to 1000")
 			}
+		case "-display":
+			display = true
+		case "-undisplay":
+			i++
+			if i != len(v)-1 {
+				return fmt.Errorf("expected one argument after -undisplay")
+			}
+			n, err := strconv.Atoi(v[i])
+			if err != nil {
+				return fmt.Errorf("%q is not a number", v[i])
+			}
+			return t.removeMemoryDisplay(n)
 		default:
 			if i != len(v)-1 {
 				return fmt.Errorf("unknown option %q", v[i])
@@ -1612,34 +2139,373 @@ func examineMemoryCmd(t *Term, ctx callContext, args string) error {
 	}
 
 	if address == 0 {
+		if display && len(v) == 1 {
+			t.printMemoryDisplays()
+			return nil
+		}
 		return fmt.Errorf("no address specified")
 	}
 
-	memArea, err := t.client.ExamineMemory(uintptr(address), length)
-	if err != nil {
-		return err
+	md := &memoryDisplay{address: uintptr(address), length: length, format: priFmt}
+	if display {
+		t.memoryDisplays = append(t.memoryDisplays, md)
 	}
+	return t.examineMemory(md)
+}
 
-	fmt.Print(api.PrettyExamineMemory(uintptr(address), memArea, priFmt))
-	return nil
+// fmtMapToPriFmt are the formats of examinemem.
+var fmtMapToPriFmt = map[string]byte{
+	"oct":         'o',
+	"octal":       'o',
+	"hex":         'x',
+	"hexadecimal": 'x',
+	"dec":         'd',
+	"decimal":     'd',
+	"bin":         'b',
+	"binary":      'b',
 }
 
-func printVar(t *Term, ctx callContext, args string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("not enough arguments")
-	}
-	if ctx.Prefix == onPrefix {
-		ctx.Breakpoint.Variables = append(ctx.Breakpoint.Variables, args)
-		return nil
-	}
-	val, err := t.client.EvalVariable(ctx.Scope, args, t.loadConfig())
+// memoryDisplay is a region of memory examined with examinemem.
+type memoryDisplay struct {
+	address uintptr
+	length  int
+	format  byte
+}
+
+func (md *memoryDisplay) String() string {
+	name := map[byte]string{'o': "oct", 'x': "hex", 'd': "dec", 'b': "bin"}[md.format]
+	return fmt.Sprintf("examinemem -fmt %s -len %d %#x", name, md.length, md.address)
+}
+
+// examineMemory prints the region of memory md, the bytes that changed
+// since the last time the same address was examined are highlighted.
+func (t *Term) examineMemory(md *memoryDisplay) error {
+	memArea, err := t.client.ExamineMemory(md.address, md.length)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(val.MultilineString(""))
-	return nil
-}
+	prev := t.examined[md.address]
+	changed := 0
+	for i := 0; i < len(prev) && i < len(memArea); i++ {
+		if prev[i] != memArea[i] {
+			changed++
+		}
+	}
+	var decorate func(int, string) string
+	if changed > 0 && !t.dumb {
+		highlight := fmt.Sprintf(terminalHighlightEscapeCode, ansiBrRed)
+		// the default color, to add the same number of characters to the
+		// bytes that did not change.
+		normal := fmt.Sprintf(terminalHighlightEscapeCode, 39)
+		decorate = func(i int, value string) string {
+			if i < len(prev) && prev[i] != memArea[i] {
+				return highlight + value + terminalResetEscapeCode
+			}
+			return normal + value + terminalResetEscapeCode
+		}
+	}
+	fmt.Print(api.PrettyExamineMemoryFunc(md.address, memArea, md.format, decorate))
+	if changed > 0 {
+		fmt.Printf("%d of %d bytes changed since the last time\n", changed, len(memArea))
+	}
+
+	if t.examined == nil {
+		t.examined = make(map[uintptr][]byte)
+	}
+	t.examined[md.address] = memArea
+	return nil
+}
+
+// printMemoryDisplays prints the regions of memory added with
+// examinemem -display.
+func (t *Term) printMemoryDisplays() {
+	for i, md := range t.memoryDisplays {
+		if md == nil {
+			continue
+		}
+		fmt.Printf("x%d: %s\n", i, md)
+		if err := t.examineMemory(md); err != nil {
+			if isErrProcessExited(err) {
+				return
+			}
+			fmt.Printf("error %v\n", err)
+		}
+	}
+}
+
+func (t *Term) removeMemoryDisplay(n int) error {
+	if n < 0 || n >= len(t.memoryDisplays) || t.memoryDisplays[n] == nil {
+		return fmt.Errorf("%d is out of range", n)
+	}
+	t.memoryDisplays[n] = nil
+	for i := len(t.memoryDisplays) - 1; i >= 0; i-- {
+		if t.memoryDisplays[i] != nil {
+			t.memoryDisplays = t.memoryDisplays[:i+1]
+			return nil
+		}
+	}
+	t.memoryDisplays = t.memoryDisplays[:0]
+	return nil
+}
+
+func printVar(t *Term, ctx callContext, args string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("not enough arguments")
+	}
+	if ctx.Prefix == onPrefix {
+		ctx.Breakpoint.Variables = append(ctx.Breakpoint.Variables, args)
+		return nil
+	}
+	val, err := t.client.EvalVariable(ctx.Scope, args, t.loadConfig())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(val.MultilineString(""))
+	return nil
+}
+
+func ctxCommand(t *Term, ctx callContext, args string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("not enough arguments")
+	}
+	contexts, err := t.client.ExamineContext(ctx.Scope, args, t.loadConfig())
+	if err != nil {
+		return err
+	}
+	for i, c := range contexts {
+		fmt.Printf("%d %s %#x\n", i, c.Type, c.Addr)
+		if c.Key != nil {
+			value := "nil"
+			if c.Value != nil {
+				value = c.Value.SinglelineString()
+			}
+			fmt.Printf("\tvalue %s = %s\n", formatContextKey(c.Key), value)
+		}
+		if c.Deadline != "" {
+			fmt.Printf("\tdeadline %s\n", c.Deadline)
+		}
+		switch {
+		case c.Err != nil:
+			fmt.Printf("\tcanceled: %s\n", c.Err.SinglelineString())
+		case c.Cancellable:
+			fmt.Printf("\tcancellable\n")
+		}
+		if len(c.Waiters) > 0 {
+			ids := make([]string, len(c.Waiters))
+			for j, id := range c.Waiters {
+				ids[j] = strconv.Itoa(id)
+			}
+			fmt.Printf("\tDone waited on by goroutines %s\n", strings.Join(ids, " "))
+		}
+	}
+	return nil
+}
+
+// formatContextKey describes the key of a value attached to a context,
+// with its type, which is what identifies it.
+func formatContextKey(key *api.Variable) string {
+	if key.Kind == reflect.Struct {
+		// structs are printed with their type
+		return key.SinglelineString()
+	}
+	return fmt.Sprintf("%s(%s)", key.Type, key.SinglelineString())
+}
+
+func workersCommand(t *Term, ctx callContext, args string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("not enough arguments")
+	}
+	wg, err := t.client.ListWorkers(ctx.Scope, args, t.loadConfig())
+	if err != nil {
+		return err
+	}
+	switch wg.Kind {
+	case "errgroup":
+		fmt.Printf("errgroup.Group with %d goroutines", len(wg.Workers))
+		if wg.Limit > 0 {
+			fmt.Printf(", limit %d (%d active)", wg.Limit, wg.Active)
+		}
+	case "semaphore":
+		fmt.Printf("semaphore.Weighted of size %d, %d acquired, %d goroutines waiting", wg.Limit, wg.Active, len(wg.Workers))
+	case "channel":
+		fmt.Printf("channel with %d/%d values buffered, %d goroutines blocked", wg.Active, wg.Limit, len(wg.Workers))
+	}
+	fmt.Println()
+	if wg.Err != nil {
+		fmt.Printf("First error: %s\n", wg.Err.SinglelineString())
+	}
+
+	// group the goroutines by the go statement that created them
+	var sites []string
+	bySite := make(map[string][]api.Worker)
+	for _, w := range wg.Workers {
+		site := formatLocation(w.Goroutine.GoStatementLoc)
+		if _, ok := bySite[site]; !ok {
+			sites = append(sites, site)
+		}
+		bySite[site] = append(bySite[site], w)
+	}
+	for _, site := range sites {
+		fmt.Printf("Created at %s:\n", site)
+		for _, w := range bySite[site] {
+			role := w.Role
+			if w.Func != "" {
+				role += " " + w.Func
+			}
+			fmt.Printf("\tGoroutine %s [%s, %s]\n", formatGoroutine(w.Goroutine, fglUserCurrent), role, w.Goroutine.StatusString())
+		}
+	}
+	return nil
+}
+
+// timerKinds are the kinds of timers listed by the timers command.
+var timerKinds = []string{"timer", "ticker", "afterfunc", "sleep", "runtime"}
+
+func timersCommand(t *Term, ctx callContext, args string) error {
+	kinds := make(map[string]bool)
+	for _, kind := range strings.Fields(args) {
+		found := false
+		for _, k := range timerKinds {
+			if k == kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown kind of timer %q, must be one of %s", kind, strings.Join(timerKinds, ", "))
+		}
+		kinds[kind] = true
+	}
+	timers, now, err := t.client.ListTimers()
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, timer := range timers {
+		if len(kinds) > 0 && !kinds[timer.Kind] {
+			continue
+		}
+		n++
+		var when string
+		switch d := time.Duration(timer.When - now).Round(time.Millisecond); {
+		case now == 0:
+			when = fmt.Sprintf("fires at %d", timer.When)
+		case d < 0:
+			when = fmt.Sprintf("overdue by %v", -d)
+		default:
+			when = fmt.Sprintf("fires in %v", d)
+		}
+		fmt.Printf("%-9s %#x %s", timer.Kind, timer.Addr, when)
+		if timer.Period > 0 {
+			fmt.Printf(" every %v", time.Duration(timer.Period))
+		}
+		if timer.P >= 0 {
+			fmt.Printf(" (P %d)", timer.P)
+		}
+		switch {
+		case timer.Callback != "":
+			fmt.Printf(" calls %s", timer.Callback)
+		case timer.Kind == "runtime" && timer.Func != "":
+			fmt.Printf(" calls %s", timer.Func)
+		}
+		if len(timer.Waiters) > 0 {
+			ids := make([]string, len(timer.Waiters))
+			for i, id := range timer.Waiters {
+				ids[i] = strconv.Itoa(id)
+			}
+			what := "waited on by goroutines"
+			if timer.Kind == "sleep" {
+				what = "wakes up goroutine"
+			}
+			fmt.Printf(" %s %s", what, strings.Join(ids, ", "))
+		}
+		fmt.Println()
+	}
+	if n == 0 {
+		fmt.Println("No pending timers")
+	}
+	return nil
+}
+
+func finalizersCommand(t *Term, ctx callContext, args string) error {
+	verbose := false
+	typ := ""
+	for _, arg := range strings.Fields(args) {
+		switch {
+		case arg == "-v":
+			verbose = true
+		case typ == "":
+			typ = arg
+		default:
+			return fmt.Errorf("too many arguments")
+		}
+	}
+	fs, err := t.client.ListFinalizers()
+	if err != nil {
+		return err
+	}
+	switch {
+	case fs.Goroutine == nil:
+		fmt.Println("No finalizer goroutine, no finalizer was ever set or it did not start yet")
+	case fs.Running:
+		fmt.Printf("Finalizer goroutine %s [running a finalizer, %s]\n", formatGoroutine(fs.Goroutine, fglUserCurrent), fs.Goroutine.StatusString())
+	default:
+		fmt.Printf("Finalizer goroutine %s [waiting for finalizers]\n", formatGoroutine(fs.Goroutine, fglUserCurrent))
+	}
+
+	sections := []struct {
+		title      string
+		queued     bool
+		cleanup    bool
+		finalizers []api.Finalizer
+	}{
+		{title: "Queued finalizers", queued: true},
+		{title: "Finalizers"},
+		{title: "Cleanups", cleanup: true},
+	}
+	for _, f := range fs.Finalizers {
+		if typ != "" && (f.Cleanup || (f.Type != typ && f.Type != "*"+typ)) {
+			continue
+		}
+		for i := range sections {
+			if sections[i].queued == f.Queued && sections[i].cleanup == f.Cleanup {
+				sections[i].finalizers = append(sections[i].finalizers, f)
+				break
+			}
+		}
+	}
+	for _, section := range sections {
+		fmt.Printf("%s: %d\n", section.title, len(section.finalizers))
+		if verbose {
+			for _, f := range section.finalizers {
+				fmt.Printf("\t%#x %s %s\n", f.Obj, f.Type, f.Func)
+			}
+			continue
+		}
+		// count the finalizers by type and function
+		type key struct{ typ, fn string }
+		var keys []key
+		count := make(map[key]int)
+		for _, f := range section.finalizers {
+			k := key{f.Type, f.Func}
+			if count[k] == 0 {
+				keys = append(keys, k)
+			}
+			count[k]++
+		}
+		sort.SliceStable(keys, func(i, j int) bool { return count[keys[i]] > count[keys[j]] })
+		for _, k := range keys {
+			if k.typ != "" {
+				fmt.Printf("\t%d %s %s\n", count[k], k.typ, k.fn)
+			} else {
+				fmt.Printf("\t%d %s\n", count[k], k.fn)
+			}
+		}
+	}
+	return nil
+}
 
 func whatisCommand(t *Term, ctx callContext, args string) error {
 	if len(args) == 0 {
@@ -1757,6 +2623,18 @@ func args(t *Term, ctx callContext, args string) error {
 	return printFilteredVariables("args", vars, filter, cfg)
 }
 
+func returnValues(t *Term, ctx callContext, args string) error {
+	filter, cfg := parseVarArguments(args, t)
+	vars, fn, err := t.client.ListReturnValues(cfg)
+	if err != nil {
+		return err
+	}
+	if fn != nil && len(vars) > 0 {
+		fmt.Printf("Values returned by %s:\n", fn.Name())
+	}
+	return printFilteredVariables("return values", vars, filter, cfg)
+}
+
 func locals(t *Term, ctx callContext, args string) error {
 	filter, cfg := parseVarArguments(args, t)
 	if ctx.Prefix == onPrefix {
@@ -1836,6 +2714,62 @@ func stackCommand(t *Term, ctx callContext, args string) error {
 	return nil
 }
 
+func defersCommand(t *Term, ctx callContext, args string) error {
+	depth := 50
+	if args = strings.TrimSpace(args); args != "" {
+		var err error
+		depth, err = strconv.Atoi(args)
+		if err != nil {
+			return fmt.Errorf("depth must be a number: %v", err)
+		}
+	}
+	calls, err := t.client.ListDeferredCalls(ctx.Scope.GoroutineID, depth, &ShortLoadConfig)
+	if err != nil {
+		return err
+	}
+	if len(calls) == 0 {
+		fmt.Println("No deferred calls")
+		return nil
+	}
+	printDeferredCalls(os.Stdout, calls)
+	return nil
+}
+
+func printDeferredCalls(out io.Writer, calls []api.DeferredCall) {
+	frame := -1
+	n := 0
+	for _, d := range calls {
+		if d.Frame != frame {
+			frame = d.Frame
+			n = 0
+			fmt.Fprintf(out, "frame %d: %s\n", d.Frame, d.DeferLoc.Function.Name())
+		}
+		n++
+		deferHeader := fmt.Sprintf("    defer %d: ", n)
+		s := strings.Repeat(" ", len(deferHeader))
+		if d.Unreadable != "" && d.Function == nil {
+			fmt.Fprintf(out, "%s(unreadable defer: %s)\n", deferHeader, d.Unreadable)
+			continue
+		}
+		fnname := d.DeferredLoc.Function.Name()
+		if d.Function != nil {
+			fnname = d.Function.Name()
+		}
+		fmt.Fprintf(out, "%s%s", deferHeader, fnname)
+		if d.Recovers {
+			fmt.Fprintf(out, " (recovers the current panic)")
+		}
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "%sdeferred at %s:%d\n", s, d.DeferLoc.File, d.DeferLoc.Line)
+		if d.Unreadable != "" {
+			fmt.Fprintf(out, "%s(unreadable arguments: %s)\n", s, d.Unreadable)
+		}
+		for i := range d.Arguments {
+			fmt.Fprintf(out, "%s%s = %s\n", s, d.Arguments[i].Name, d.Arguments[i].SinglelineString())
+		}
+	}
+}
+
 type stackArgs struct {
 	depth   int
 	full    bool
@@ -1872,6 +2806,8 @@ func parseStackArgs(argstr string) (stackArgs, error) {
 				r.offsets = true
 			case "-defer":
 				r.opts |= api.StacktraceReadDefers
+			case "-hidden":
+				r.opts |= api.StacktraceShowHidden
 			case "-mode":
 				i++
 				if i >= len(args) {
@@ -2105,17 +3041,30 @@ func printStack(out io.Writer, stack []api.Stackframe, ind string, offsets bool)
 		extranl = extranl || (len(stack[i].Defers) > 0) || (len(stack[i].Arguments) > 0) || (len(stack[i].Locals) > 0)
 	}
 
-	d := digits(len(stack) - 1)
+	last := len(stack) - 1
+	for i := range stack {
+		last += stack[i].Hidden
+	}
+	d := digits(last)
 	fmtstr := "%s%" + strconv.Itoa(d) + "d  0x%016x in %s\n"
 	s := ind + strings.Repeat(" ", d+2+len(ind))
 
+	n := -1 // index of the frame, counting the hidden frames
 	for i := range stack {
+		n += 1 + stack[i].Hidden
+		if stack[i].Hidden > 0 {
+			fmt.Fprintf(out, "%s(%d hidden frames)\n", s, stack[i].Hidden)
+		}
 		if stack[i].Err != "" {
 			fmt.Fprintf(out, "%serror: %s\n", s, stack[i].Err)
 			continue
 		}
-		fmt.Fprintf(out, fmtstr, ind, i, stack[i].PC, stack[i].Function.Name())
-		fmt.Fprintf(out, "%sat %s:%d\n", s, shortenFilePath(stack[i].File), stack[i].Line)
+		fmt.Fprintf(out, fmtstr, ind, n, stack[i].PC, stack[i].Function.Name())
+		fmt.Fprintf(out, "%sat %s:%d", s, shortenFilePath(stack[i].File), stack[i].Line)
+		if stack[i].StaleSource {
+			fmt.Fprintf(out, " (stale source)")
+		}
+		fmt.Fprintln(out)
 
 		if offsets {
 			fmt.Fprintf(out, "%sframe: %+#x frame pointer %+#x\n", s, stack[i].FrameOffset, stack[i].FramePointerOffset)
@@ -2192,6 +3141,9 @@ func printcontext(t *Term, state *api.DebuggerState) {
 	if state.When != "" {
 		fmt.Println(state.When)
 	}
+	for _, c := range state.ExprWatchChanges {
+		fmt.Printf("Watch %d: %s changed from %s to %s\n", c.ID, c.Expr, c.Old, c.New)
+	}
 }
 
 func printcontextLocation(loc api.Location) {
@@ -2202,10 +3154,14 @@ func printcontextLocation(loc api.Location) {
 }
 
 func printReturnValues(th *api.Thread) {
-	if th.ReturnValues == nil {
+	if len(th.ReturnValues) == 0 {
 		return
 	}
-	fmt.Println("Values returned:")
+	if th.ReturnFunction != nil {
+		fmt.Printf("Values returned by %s:\n", th.ReturnFunction.Name())
+	} else {
+		fmt.Println("Values returned:")
+	}
 	for _, v := range th.ReturnValues {
 		fmt.Printf("\t%s: %s\n", v.Name, v.MultilineString("\t"))
 	}
@@ -2216,6 +3172,9 @@ func printcontextThread(t *Term, th *api.Thread) {
 	fn := th.Function
 
 	if th.Breakpoint == nil {
+		if th.Syscall != nil {
+			fmt.Printf("Thread %d %s\n", th.ID, formatSyscall(th.Syscall))
+		}
 		printcontextLocation(api.Location{PC: th.PC, File: th.File, Line: th.Line, Function: th.Function})
 		printReturnValues(th)
 		return
@@ -2275,6 +3234,9 @@ func printcontextThread(t *Term, th *api.Thread) {
 	if th.Function != nil && th.Function.Optimized {
 		fmt.Println(optimizedFunctionWarning)
 	}
+	if th.Breakpoint.AtExit && fn != nil && fn.Name() == "runtime.recovery" {
+		fmt.Printf("%s unwound by a recovered panic\n", th.Breakpoint.FunctionName)
+	}
 
 	printReturnValues(th)
 	printBreakpointInfo(th, false)
@@ -2310,6 +3272,19 @@ func printBreakpointInfo(th *api.Thread, tracepointOnNewline bool) {
 		fmt.Printf("\t%s: %s\n", v.Name, v.MultilineString("\t"))
 	}
 
+	if len(bpi.ErrorChain) > 0 {
+		tracepointnl()
+		fmt.Printf("\tError chain:\n")
+		for _, e := range bpi.ErrorChain {
+			indent := strings.Repeat("  ", e.Depth)
+			if e.Message != "" {
+				fmt.Printf("\t\t%s%s: %q\n", indent, e.Type, e.Message)
+			} else {
+				fmt.Printf("\t\t%s%s: %s\n", indent, e.Type, e.Value)
+			}
+		}
+	}
+
 	for _, v := range bpi.Locals {
 		tracepointnl()
 		if *bp.LoadLocals == longLoadConfig {
@@ -2336,6 +3311,10 @@ func printBreakpointInfo(th *api.Thread, tracepointOnNewline bool) {
 func printTracepoint(th *api.Thread, bpname string, fn *api.Function, args string, hasReturnValue bool) {
 	if th.Breakpoint.Tracepoint {
 		fmt.Fprintf(os.Stderr, "> goroutine(%d): %s%s(%s)", th.GoroutineID, bpname, fn.Name(), args)
+		if th.Breakpoint.LoadLocals != nil {
+			// line tracepoint, print the position inside the function
+			fmt.Fprintf(os.Stderr, " %s:%d", shortenFilePath(th.File), th.Line)
+		}
 		if !hasReturnValue {
 			fmt.Println()
 		}
@@ -2360,7 +3339,20 @@ func printfile(t *Term, filename string, line int, showArrow bool) error {
 	if filename == "" {
 		return nil
 	}
-	file, err := os.Open(t.substitutePath(filename))
+	path := t.substitutePath(filename)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// The file could belong to a dependency that is not in the local
+		// module cache.
+		if _, _, _, ok := modsrc.SplitCachePath(path); ok {
+			var err2 error
+			if path, err2 = modsrc.Find(path); err2 == nil {
+				file, err = os.Open(path)
+			} else {
+				fmt.Fprintf(os.Stderr, "%v\n", err2)
+			}
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -2452,55 +3444,883 @@ func (c *Commands) onCmd(t *Term, ctx callContext, argstr string) error {
 	return t.client.AmendBreakpoint(ctx.Breakpoint)
 }
 
-func conditionCmd(t *Term, ctx callContext, argstr string) error {
-	args := split2PartsBySpace(argstr)
-
-	if len(args) < 2 {
-		return fmt.Errorf("not enough arguments")
+func traceRuntimeCmd(t *Term, ctx callContext, args string) error {
+	v := strings.Fields(args)
+	if len(v) == 0 {
+		return errors.New("not enough arguments")
 	}
-
-	bp, err := getBreakpointByIDOrName(t, args[0])
-	if err != nil {
-		return err
+	switch v[0] {
+	case "start":
+		if len(v) > 2 {
+			return errors.New("too many arguments")
+		}
+		path := "trace.out"
+		if len(v) == 2 {
+			path = v[1]
+		}
+		trace, err := t.client.StartRuntimeTrace(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Runtime trace started, writing to %s\n", trace.Path)
+		if !trace.LogsStops {
+			fmt.Printf("The stops will not be logged in the trace, trace.Log is not linked in the target\n")
+		}
+	case "stop":
+		if len(v) > 1 {
+			return errors.New("too many arguments")
+		}
+		trace, err := t.client.StopRuntimeTrace()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Runtime trace saved to %s, %d stops logged, see 'go tool trace %s'\n", trace.Path, trace.Stops, trace.Path)
+	default:
+		return fmt.Errorf("unknown argument %q", v[0])
 	}
-	bp.Cond = args[1]
-
-	return t.client.AmendBreakpoint(bp)
+	return nil
 }
 
-// shortenFilePath take a full file path and attempts to shorten
-// it by replacing the current directory to './'.
-func shortenFilePath(fullPath string) string {
-	workingDir, _ := os.Getwd()
-	return strings.Replace(fullPath, workingDir, ".", 1)
-}
+func profileCmd(t *Term, ctx callContext, args string) error {
+	v := strings.Fields(args)
+	if len(v) == 0 {
+		return errors.New("not enough arguments")
+	}
+	kind := v[0]
+	v = v[1:]
+	var duration time.Duration
+	switch kind {
+	case "cpu", "cmalloc":
+		if len(v) == 0 {
+			return fmt.Errorf("%s profile requires a duration", kind)
+		}
+		var err error
+		duration, err = time.ParseDuration(v[0])
+		if err != nil {
+			return err
+		}
+		v = v[1:]
+	case "heap":
+	default:
+		return fmt.Errorf("unknown profile kind %q", kind)
+	}
 
-func (c *Commands) executeFile(t *Term, name string) error {
-	fh, err := os.Open(name)
+	out := kind + ".pprof"
+	open, mallocgc := false, false
+	for len(v) > 0 {
+		switch v[0] {
+		case "-go":
+			if kind != "cmalloc" {
+				return errors.New("-go is only valid for cmalloc profiles")
+			}
+			mallocgc = true
+			v = v[1:]
+		case "-o":
+			if len(v) < 2 {
+				return errors.New("-o requires a file name")
+			}
+			out = v[1]
+			v = v[2:]
+		case "-open":
+			open = true
+			v = v[1:]
+		default:
+			return fmt.Errorf("unknown argument %q", v[0])
+		}
+	}
+
+	var data []byte
+	var err error
+	if kind == "cmalloc" {
+		data, err = t.client.ProfileCMalloc(duration, mallocgc)
+	} else {
+		data, err = t.client.Profile(kind, duration)
+	}
 	if err != nil {
 		return err
 	}
-	defer fh.Close()
-
-	scanner := bufio.NewScanner(fh)
-	lineno := 0
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		lineno++
+	if err := ioutil.WriteFile(out, data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%s profile saved to %s\n", kind, out)
 
-		if line == "" || line[0] == '#' {
-			continue
+	if kind != "heap" {
+		// the target was resumed, it could have stopped on a breakpoint or exited.
+		state, err := t.client.GetState()
+		if err != nil {
+			return err
 		}
-
-		if err := c.Call(line, t); err != nil {
-			if _, isExitRequest := err.(ExitRequestError); isExitRequest {
-				return err
-			}
-			fmt.Printf("%s:%d: %v\n", name, lineno, err)
+		if state.CurrentThread != nil && state.CurrentThread.Breakpoint != nil {
+			printcontext(t, state)
 		}
 	}
 
-	return scanner.Err()
+	if !open {
+		return nil
+	}
+	cmd := exec.Command("go", "tool", "pprof", out)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func catchCmd(t *Term, ctx callContext, args string) error {
+	args = strings.TrimSpace(args)
+	if v := strings.SplitN(args, " ", 2); v[0] == "open" || v[0] == "dial" || v[0] == "http" {
+		if len(v) < 2 || strings.TrimSpace(v[1]) == "" {
+			return errors.New("not enough arguments")
+		}
+		bps, err := t.client.CreateCatchpoint(v[0], strings.TrimSpace(v[1]))
+		if err != nil {
+			return err
+		}
+		for _, bp := range bps {
+			fmt.Printf("%s set at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
+		}
+		return nil
+	}
+	caught, err := t.client.ListCaughtSyscalls()
+	if err != nil {
+		return err
+	}
+	switch {
+	case args == "":
+	case strings.HasPrefix(args, "--clear"):
+		clear := make(map[string]bool)
+		for _, name := range strings.Fields(strings.TrimPrefix(args, "--clear")) {
+			clear[name] = true
+		}
+		var keep []string
+		for _, name := range caught {
+			if len(clear) > 0 && !clear[name] {
+				keep = append(keep, name)
+			}
+		}
+		if caught, err = t.client.CatchSyscalls(keep); err != nil {
+			return err
+		}
+	case strings.HasPrefix(args, "syscall"):
+		names := strings.Fields(strings.TrimPrefix(args, "syscall"))
+		if len(names) == 0 {
+			return errors.New("not enough arguments")
+		}
+		if caught, err = t.client.CatchSyscalls(append(caught, names...)); err != nil {
+			return err
+		}
+	default:
+		return errors.New("wrong arguments")
+	}
+	if len(caught) == 0 {
+		fmt.Println("No caught system calls")
+		return nil
+	}
+	fmt.Printf("Caught system calls: %s\n", strings.Join(caught, " "))
+	return nil
+}
+
+func breakhttpCmd(t *Term, ctx callContext, args string) error {
+	var filter api.HTTPRequestFilter
+	v := strings.Fields(args)
+	for i := 0; i < len(v); i += 2 {
+		if i+1 >= len(v) {
+			return fmt.Errorf("no value for %s", v[i])
+		}
+		switch v[i] {
+		case "--method":
+			filter.Method = v[i+1]
+		case "--route":
+			filter.Route = v[i+1]
+		case "--header":
+			if filter.Headers == nil {
+				filter.Headers = make(map[string]string)
+			}
+			if err := parseNamePattern("header", v[i+1], filter.Headers); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown option %s", v[i])
+		}
+	}
+	bps, err := t.client.CreateHTTPBreakpoint(filter)
+	if err != nil {
+		return err
+	}
+	for _, bp := range bps {
+		fmt.Printf("%s set at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
+	}
+	return nil
+}
+
+func breakgrpcCmd(t *Term, ctx callContext, args string) error {
+	var filter api.GRPCRequestFilter
+	v := strings.Fields(args)
+	for i := 0; i < len(v); i += 2 {
+		if i+1 >= len(v) {
+			return fmt.Errorf("no value for %s", v[i])
+		}
+		switch v[i] {
+		case "--method":
+			filter.Method = v[i+1]
+		case "--metadata":
+			if filter.Metadata == nil {
+				filter.Metadata = make(map[string]string)
+			}
+			if err := parseNamePattern("metadata", v[i+1], filter.Metadata); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown option %s", v[i])
+		}
+	}
+	bps, err := t.client.CreateGRPCBreakpoint(filter)
+	if err != nil {
+		return err
+	}
+	for _, bp := range bps {
+		fmt.Printf("%s set at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
+	}
+	return nil
+}
+
+func breakfinalizerCmd(t *Term, ctx callContext, args string) error {
+	typ := strings.TrimSpace(args)
+	if typ == "" {
+		return fmt.Errorf("not enough arguments")
+	}
+	bps, err := t.client.CreateFinalizerBreakpoint(typ)
+	if err != nil {
+		return err
+	}
+	for _, bp := range bps {
+		fmt.Printf("%s set at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
+	}
+	return nil
+}
+
+// parseNamePattern parses s, an option of kind what, as <name>=<pattern>
+// and adds it to m.
+func parseNamePattern(what, s string, m map[string]string) error {
+	eq := strings.Index(s, "=")
+	if eq <= 0 {
+		return fmt.Errorf("wrong %s %q, must be <name>=<pattern>", what, s)
+	}
+	m[s[:eq]] = s[eq+1:]
+	return nil
+}
+
+// formatSyscall describes the entry or the exit of the system call sc.
+func formatSyscall(sc *api.SyscallEvent) string {
+	if sc.Exit {
+		return fmt.Sprintf("returned from syscall %s = %s", sc.Name, sc.Ret)
+	}
+	return fmt.Sprintf("entering syscall %s(%s)", sc.Name, strings.Join(sc.Args, ", "))
+}
+
+func watchCmd(t *Term, ctx callContext, args string) error {
+	args = strings.TrimSpace(args)
+	switch {
+	case args == "":
+		watches, err := t.client.ListExprWatches()
+		if err != nil {
+			return err
+		}
+		if len(watches) == 0 {
+			fmt.Println("No watched expressions")
+		}
+		for _, w := range watches {
+			fmt.Printf("Watch %d: %s = %s", w.ID, w.Expr, w.Value)
+			if len(w.Locations) > 0 {
+				fmt.Printf(" at %s", strings.Join(w.Locations, " "))
+			}
+			fmt.Println()
+		}
+		return nil
+	case strings.HasPrefix(args, "--clear"):
+		id, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(args, "--clear")))
+		if err != nil {
+			return errors.New("--clear requires the ID of a watch")
+		}
+		return t.client.ClearExprWatch(id)
+	case strings.HasPrefix(args, "--expr "):
+		expr := strings.TrimSpace(strings.TrimPrefix(args, "--expr "))
+		var locations []string
+		if i := strings.Index(expr, " --at "); i >= 0 {
+			locations = strings.Fields(expr[i+len(" --at "):])
+			expr = strings.TrimSpace(expr[:i])
+			if len(locations) == 0 {
+				return errors.New("--at requires a location")
+			}
+		}
+		if expr == "" {
+			return errors.New("--expr requires an expression")
+		}
+		w, err := t.client.CreateExprWatch(expr, locations)
+		if err != nil {
+			return err
+		}
+		if w.Value != "" {
+			fmt.Printf("Watch %d: %s = %s\n", w.ID, w.Expr, w.Value)
+		} else {
+			fmt.Printf("Watch %d: %s\n", w.ID, w.Expr)
+		}
+		return nil
+	}
+	return errors.New("wrong arguments, usage: watch --expr <expression> [--at <location>...]")
+}
+
+func bisectCmd(t *Term, ctx callContext, args string) error {
+	v := strings.SplitN(strings.TrimSpace(args), " ", 3)
+	if len(v) != 3 {
+		return errors.New("wrong arguments, usage: bisect <start> <end> <predicate>")
+	}
+	r, err := t.client.Bisect(strings.TrimSpace(v[2]), v[0], v[1])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s became true in iteration %d of %d, after %d statements (%d runs)\n", strings.TrimSpace(v[2]), r.Iteration, r.Iterations, r.Steps, r.Runs)
+	fn := "?"
+	if r.Statement.Function != nil {
+		fn = r.Statement.Function.Name()
+	}
+	fmt.Printf("Statement: %s at %s:%d\n", fn, shortenFilePath(r.Statement.File), r.Statement.Line)
+	state, err := t.client.GetState()
+	if err != nil {
+		return err
+	}
+	printcontext(t, state)
+	if state.CurrentThread != nil {
+		printfile(t, state.CurrentThread.File, state.CurrentThread.Line, true)
+	}
+	return nil
+}
+
+func callersCmd(t *Term, ctx callContext, args string) error {
+	v := strings.Fields(args)
+	if len(v) != 3 || v[1] != "--record" {
+		return errors.New("wrong arguments, usage: callers <function> --record <duration>")
+	}
+	duration, err := time.ParseDuration(v[2])
+	if err != nil {
+		return err
+	}
+	locs, err := t.client.FindLocation(ctx.Scope, v[0], false)
+	if err != nil {
+		return err
+	}
+	if len(locs) != 1 || locs[0].Function == nil {
+		return fmt.Errorf("%q is not a function", v[0])
+	}
+	fn := locs[0].Function.Name()
+
+	stacks, err := t.client.RecordCallers(fn, duration)
+	if err != nil {
+		return err
+	}
+	printCallers(os.Stdout, fn, stacks)
+
+	// the target was resumed, it could have stopped on a breakpoint or exited.
+	state, err := t.client.GetState()
+	if err != nil {
+		return err
+	}
+	if state.CurrentThread != nil && state.CurrentThread.Breakpoint != nil {
+		printcontext(t, state)
+	}
+	return nil
+}
+
+// callersNode is a caller in the tree printed by printCallers.
+type callersNode struct {
+	frame    api.CallerFrame
+	count    int
+	children []*callersNode
+}
+
+func (n *callersNode) child(frame api.CallerFrame) *callersNode {
+	for _, child := range n.children {
+		if child.frame == frame {
+			return child
+		}
+	}
+	child := &callersNode{frame: frame}
+	n.children = append(n.children, child)
+	return child
+}
+
+// printCallers prints the stacks of callers of fn as a tree, merging the
+// stacks that share their innermost callers.
+func printCallers(out io.Writer, fn string, stacks []api.CallerStack) {
+	root := &callersNode{}
+	for _, stack := range stacks {
+		root.count += stack.Count
+		n := root
+		for _, frame := range stack.Frames {
+			n = n.child(frame)
+			n.count += stack.Count
+		}
+	}
+	if root.count == 0 {
+		fmt.Fprintf(out, "No calls to %s\n", fn)
+		return
+	}
+	fmt.Fprintf(out, "%d calls to %s\n", root.count, fn)
+	d := digits(root.count)
+	var printNode func(n *callersNode, ind string)
+	printNode = func(n *callersNode, ind string) {
+		sort.SliceStable(n.children, func(i, j int) bool { return n.children[i].count > n.children[j].count })
+		for _, child := range n.children {
+			fmt.Fprintf(out, "%s%*d %s at %s:%d\n", ind, d, child.count, child.frame.Function, shortenFilePath(child.frame.File), child.frame.Line)
+			printNode(child, ind+"  ")
+		}
+	}
+	printNode(root, "  ")
+}
+
+func runtimeStats(t *Term, ctx callContext, args string) error {
+	if args != "" {
+		return errors.New("too many arguments")
+	}
+	stats, err := t.client.RuntimeStats()
+	if err != nil {
+		return err
+	}
+	unavailable := map[string]bool{}
+	for _, name := range stats.Unavailable {
+		unavailable[name] = true
+	}
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	for _, field := range []struct {
+		name string
+		val  uint64
+	}{
+		{"HeapAlloc", stats.HeapAlloc},
+		{"HeapSys", stats.HeapSys},
+		{"HeapIdle", stats.HeapIdle},
+		{"HeapInuse", stats.HeapInuse},
+		{"HeapReleased", stats.HeapReleased},
+		{"HeapObjects", stats.HeapObjects},
+		{"StackInuse", stats.StackInuse},
+		{"NextGC", stats.NextGC},
+		{"NumGC", stats.NumGC},
+		{"PauseTotalNs", stats.PauseTotalNs},
+		{"Goroutines", uint64(stats.Goroutines)},
+		{"Threads", uint64(stats.Threads)},
+	} {
+		if unavailable[field.name] {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\n", field.name, field.val)
+	}
+	w.Flush()
+	if len(stats.PauseNs) > 0 {
+		pauses := make([]string, len(stats.PauseNs))
+		for i := range stats.PauseNs {
+			pauses[i] = strconv.FormatUint(stats.PauseNs[i], 10)
+		}
+		fmt.Printf("Recent GC pauses (ns, most recent first): %s\n", strings.Join(pauses, " "))
+	}
+	return nil
+}
+
+func stopTimeCmd(t *Term, ctx callContext, args string) error {
+	if args != "" {
+		return errors.New("too many arguments")
+	}
+	st, err := t.client.GetStopTime()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Stopped for %v in total", st.Total)
+	if st.Stopped {
+		fmt.Printf(", for %v by %s now", st.Current, st.Command)
+	}
+	fmt.Println()
+	if st.Alarm > 0 {
+		fmt.Printf("Stopped for more than %v %d times\n", st.Alarm, st.Alarms)
+	}
+	if len(st.Commands) == 0 {
+		return nil
+	}
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintf(w, "Command\tStops\tTotal\tMax\n")
+	for _, c := range st.Commands {
+		fmt.Fprintf(w, "%s\t%d\t%v\t%v\n", c.Command, c.Count, c.Total, c.Max)
+	}
+	return w.Flush()
+}
+
+func timelineCmd(t *Term, ctx callContext, args string) error {
+	argv := strings.SplitN(args, " ", 2)
+	switch argv[0] {
+	case "eval":
+		_, exprs, err := t.client.GetTimeline()
+		if err != nil {
+			return err
+		}
+		if len(argv) < 2 || strings.TrimSpace(argv[1]) == "" {
+			for _, expr := range exprs {
+				fmt.Println(expr)
+			}
+			return nil
+		}
+		if expr := strings.TrimSpace(argv[1]); expr != "-clear" {
+			exprs = append(exprs, expr)
+		} else {
+			exprs = nil
+		}
+		return t.client.SetTimelineExprs(exprs)
+	case "-o":
+		if len(argv) < 2 || strings.TrimSpace(argv[1]) == "" {
+			return errors.New("-o requires a file name")
+		}
+		stops, _, err := t.client.GetTimeline()
+		if err != nil {
+			return err
+		}
+		if stops == nil {
+			stops = []api.TimelineStop{}
+		}
+		data, err := json.MarshalIndent(stops, "", "\t")
+		if err != nil {
+			return err
+		}
+		out := strings.TrimSpace(argv[1])
+		if err := ioutil.WriteFile(out, append(data, '\n'), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("%d stops saved to %s\n", len(stops), out)
+		return nil
+	}
+
+	stops, _, err := t.client.GetTimeline()
+	if err != nil {
+		return err
+	}
+	if args == "" || argv[0] == "-bp" {
+		bpID := 0
+		if args != "" {
+			if len(argv) < 2 || strings.TrimSpace(argv[1]) == "" {
+				return errors.New("-bp requires a breakpoint name or id")
+			}
+			arg := strings.TrimSpace(argv[1])
+			// the breakpoints cleared can only be specified by id.
+			if bpID, err = strconv.Atoi(arg); err != nil {
+				bp, err := t.client.GetBreakpointByName(arg)
+				if err != nil {
+					return err
+				}
+				bpID = bp.ID
+			}
+		}
+		for i := range stops {
+			if bpID == 0 || stops[i].BreakpointID == bpID {
+				fmt.Println(formatTimelineStop(&stops[i]))
+			}
+		}
+		return nil
+	}
+	index, err := strconv.Atoi(args)
+	if err != nil {
+		return fmt.Errorf("invalid index %q", args)
+	}
+	for i := range stops {
+		s := &stops[i]
+		if s.Index != index {
+			continue
+		}
+		fmt.Printf("Stop #%d at %s, by %s: %s", s.Index, s.Time.Format("15:04:05.000"), s.Command, s.Reason)
+		if s.Resumed {
+			fmt.Printf(", resumed without stopping")
+		}
+		fmt.Println()
+		if !s.Exited {
+			fmt.Printf("\tgoroutine %d, thread %d\n", s.GoroutineID, s.ThreadID)
+			fmt.Printf("\t%s:%d %s\n", shortenFilePath(s.File), s.Line, s.Function)
+		}
+		for _, v := range s.Values {
+			if v.Err != "" {
+				fmt.Printf("\t%s: %s\n", v.Expr, v.Err)
+			} else {
+				fmt.Printf("\t%s = %s\n", v.Expr, v.Value)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("no stop with index %d in the timeline", index)
+}
+
+// formatTimelineStop formats s on one line, for the timeline command.
+func formatTimelineStop(s *api.TimelineStop) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "#%d %s: %s", s.Index, s.Command, s.Reason)
+	if !s.Exited {
+		fmt.Fprintf(&buf, " at %s:%d %s (goroutine %d)", shortenFilePath(s.File), s.Line, s.Function, s.GoroutineID)
+	}
+	for i, v := range s.Values {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		if v.Err != "" {
+			fmt.Fprintf(&buf, " %s: <%s>", v.Expr, v.Err)
+		} else {
+			fmt.Fprintf(&buf, " %s = %s", v.Expr, v.Value)
+		}
+	}
+	return buf.String()
+}
+
+func logCmd(t *Term, ctx callContext, args string) error {
+	argv := strings.Fields(args)
+	switch {
+	case len(argv) == 0:
+		levels, err := t.client.GetLogLevels()
+		if err != nil {
+			return err
+		}
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+		for _, lvl := range levels {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", lvl.Subsystem, lvl.Level, lvl.Description)
+		}
+		return w.Flush()
+	case argv[0] == "dump":
+		if len(argv) > 2 {
+			return errors.New("too many arguments")
+		}
+		entries, err := t.client.DumpLog()
+		if err != nil {
+			return err
+		}
+		out := io.Writer(os.Stdout)
+		if len(argv) == 2 {
+			fh, err := os.Create(argv[1])
+			if err != nil {
+				return err
+			}
+			defer fh.Close()
+			out = fh
+		}
+		for _, entry := range entries {
+			fmt.Fprintln(out, entry)
+		}
+		return nil
+	case len(argv) == 2:
+		return t.client.SetLogLevel(argv[0], argv[1])
+	}
+	return errors.New("wrong number of arguments")
+}
+
+func coverageCmd(t *Term, ctx callContext, args string) error {
+	argv := strings.Fields(args)
+	if len(argv) == 0 {
+		lines, err := t.client.GetCoverage()
+		if err != nil {
+			return err
+		}
+		printCoverage(lines)
+		return nil
+	}
+	switch argv[0] {
+	case "add":
+		if len(argv) < 2 {
+			return errors.New("not enough arguments")
+		}
+		n, err := t.client.AddCoverage(argv[1:])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Tracking %d lines\n", n)
+		return nil
+	case "clear":
+		if len(argv) > 1 {
+			return errors.New("too many arguments")
+		}
+		return t.client.ClearCoverage()
+	}
+	return fmt.Errorf("unknown subcommand %q", argv[0])
+}
+
+// printCoverage prints, for each function, how many of its lines were
+// executed and the ones that were not.
+func printCoverage(lines []api.CoverageLine) {
+	if len(lines) == 0 {
+		fmt.Println("No lines tracked")
+		return
+	}
+	type group struct {
+		fn, file string
+		executed int
+		missed   []int
+		total    int
+	}
+	var groups []*group
+	byFn := map[[2]string]*group{}
+	for _, l := range lines {
+		k := [2]string{l.Function, l.File}
+		g := byFn[k]
+		if g == nil {
+			g = &group{fn: l.Function, file: l.File}
+			byFn[k] = g
+			groups = append(groups, g)
+		}
+		g.total++
+		if l.Executed {
+			g.executed++
+		} else {
+			g.missed = append(g.missed, l.Line)
+		}
+	}
+	for _, g := range groups {
+		fmt.Printf("%s %s: %d of %d lines executed", g.fn, shortenFilePath(g.file), g.executed, g.total)
+		if len(g.missed) > 0 {
+			fmt.Printf(", not executed: %s", formatLineRanges(g.missed))
+		}
+		fmt.Println()
+	}
+}
+
+// formatLineRanges formats a sorted list of line numbers, joining
+// consecutive lines in ranges, for example 4 7-9.
+func formatLineRanges(lines []int) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if buf.Len() > 0 {
+			buf.WriteString(" ")
+		}
+		if j > i {
+			fmt.Fprintf(&buf, "%d-%d", lines[i], lines[j])
+		} else {
+			fmt.Fprintf(&buf, "%d", lines[i])
+		}
+		i = j + 1
+	}
+	return buf.String()
+}
+
+func sampleCmd(t *Term, ctx callContext, args string) error {
+	if ctx.Prefix == onPrefix {
+		if args == "" {
+			return errors.New("not enough arguments")
+		}
+		ctx.Breakpoint.Variables = append(ctx.Breakpoint.Variables, args)
+		ctx.Breakpoint.Sample = true
+		return nil
+	}
+
+	var clear bool
+	switch args {
+	case "":
+	case "-clear":
+		clear = true
+	default:
+		return fmt.Errorf("wrong argument: %q", args)
+	}
+
+	samples, dropped, err := t.client.GetSamples(clear)
+	if err != nil {
+		return err
+	}
+	if dropped > 0 {
+		fmt.Printf("(%d older samples discarded)\n", dropped)
+	}
+	for _, sample := range samples {
+		vals := make([]string, len(sample.Variables))
+		for i, v := range sample.Variables {
+			vals[i] = fmt.Sprintf("%s = %s", v.Name, v.SinglelineString())
+		}
+		fmt.Printf("%s breakpoint %d goroutine %d: %s\n", sample.Time.Format("15:04:05.000000"), sample.BreakpointID, sample.GoroutineID, strings.Join(vals, ", "))
+	}
+	return nil
+}
+
+func conditionCmd(t *Term, ctx callContext, argstr string) error {
+	if argstr == "-stack-contains" || strings.HasPrefix(argstr, "-stack-contains ") {
+		return stackContainsCmd(t, ctx, strings.TrimSpace(argstr[len("-stack-contains"):]))
+	}
+	args := split2PartsBySpace(argstr)
+
+	if len(args) < 2 {
+		return fmt.Errorf("not enough arguments")
+	}
+
+	bp, err := getBreakpointByIDOrName(t, args[0])
+	if err != nil {
+		return err
+	}
+	bp.Cond = args[1]
+
+	return t.client.AmendBreakpoint(bp)
+}
+
+func stackContainsCmd(t *Term, ctx callContext, argstr string) error {
+	args := strings.Fields(argstr)
+	if len(args) < 1 || len(args) > 3 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+	bp, err := getBreakpointByIDOrName(t, args[0])
+	if err != nil {
+		return err
+	}
+	bp.StackContains, bp.StackContainsDepth = "", 0
+	if len(args) > 1 {
+		locs, err := t.client.FindLocation(ctx.Scope, args[1], false)
+		if err != nil {
+			return err
+		}
+		if len(locs) != 1 || locs[0].Function == nil {
+			return fmt.Errorf("%q is not a function", args[1])
+		}
+		bp.StackContains = locs[0].Function.Name()
+	}
+	if len(args) > 2 {
+		bp.StackContainsDepth, err = strconv.Atoi(args[2])
+		if err != nil || bp.StackContainsDepth <= 0 {
+			return fmt.Errorf("wrong depth %q", args[2])
+		}
+	}
+	return t.client.AmendBreakpoint(bp)
+}
+
+// shortenFilePath take a full file path and attempts to shorten
+// it by replacing the current directory to './'.
+func shortenFilePath(fullPath string) string {
+	workingDir, _ := os.Getwd()
+	return strings.Replace(fullPath, workingDir, ".", 1)
+}
+
+func (c *Commands) executeFile(t *Term, name string) error {
+	fh, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	lineno := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lineno++
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if err := c.Call(line, t); err != nil {
+			if _, isExitRequest := err.(ExitRequestError); isExitRequest {
+				return err
+			}
+			fmt.Printf("%s:%d: %v\n", name, lineno, err)
+		}
+	}
+
+	return scanner.Err()
 }
 
 func (c *Commands) rewind(t *Term, ctx callContext, args string) error {
@@ -2568,6 +4388,167 @@ func clearCheckpoint(t *Term, ctx callContext, args string) error {
 	return t.client.ClearCheckpoint(id)
 }
 
+func snapshotCmd(t *Term, ctx callContext, args string) error {
+	if args == "" {
+		state, err := t.client.GetState()
+		if err != nil {
+			return err
+		}
+		var loc api.Location = api.Location{PC: state.CurrentThread.PC, File: state.CurrentThread.File, Line: state.CurrentThread.Line, Function: state.CurrentThread.Function}
+		if state.SelectedGoroutine != nil {
+			loc = state.SelectedGoroutine.CurrentLoc
+		}
+		args = fmt.Sprintf("%s() %s:%d (%#x)", loc.Function.Name(), loc.File, loc.Line, loc.PC)
+	}
+
+	id, err := t.client.Snapshot(args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot s%d created.\n", id)
+	return nil
+}
+
+func snapshots(t *Term, ctx callContext, args string) error {
+	snaps, err := t.client.ListSnapshots()
+	if err != nil {
+		return err
+	}
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 4, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tWhen\tNote")
+	for _, s := range snaps {
+		sel := " "
+		if s.Selected {
+			sel = "*"
+		}
+		fmt.Fprintf(w, "%ss%d\t%s\t%s\n", sel, s.ID, s.When.Format(time.Stamp), s.Note)
+	}
+	w.Flush()
+	return nil
+}
+
+func switchSnapshot(t *Term, ctx callContext, args string) error {
+	if args == "" {
+		if err := t.client.SwitchSnapshot(0); err != nil {
+			return err
+		}
+		fmt.Println("Switched to the process.")
+		return nil
+	}
+	id, err := parseSnapshotID("switch-snapshot", args)
+	if err != nil {
+		return err
+	}
+	if err := t.client.SwitchSnapshot(id); err != nil {
+		return err
+	}
+	fmt.Printf("Switched to snapshot s%d.\n", id)
+	return nil
+}
+
+func clearSnapshot(t *Term, ctx callContext, args string) error {
+	if len(args) == 0 {
+		return errors.New("not enough arguments to clear-snapshot")
+	}
+	id, err := parseSnapshotID("clear-snapshot", args)
+	if err != nil {
+		return err
+	}
+	return t.client.ClearSnapshot(id)
+}
+
+func parseSnapshotID(cmd, args string) (int, error) {
+	if args[0] != 's' {
+		return 0, fmt.Errorf("%s argument must be a snapshot ID", cmd)
+	}
+	id, err := strconv.Atoi(args[1:])
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%s argument must be a snapshot ID", cmd)
+	}
+	return id, nil
+}
+
+func targets(t *Term, ctx callContext, args string) error {
+	client := t.client
+	if t.parentClient != nil {
+		client = t.parentClient
+	}
+	tgts, err := client.ListTargets()
+	if err != nil {
+		return err
+	}
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 4, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Pid\tState\tAddress\tPath")
+	for _, tgt := range tgts {
+		sel := " "
+		if tgt.Addr == t.targetAddr {
+			sel = "*"
+		}
+		state := "stopped"
+		switch {
+		case tgt.Err != "":
+			state = tgt.Err
+		case tgt.Exited:
+			state = fmt.Sprintf("exited (%d)", tgt.ExitStatus)
+		case tgt.Running:
+			state = "running"
+		}
+		fmt.Fprintf(w, "%s%d\t%s\t%s\t%s\n", sel, tgt.Pid, state, tgt.Addr, tgt.Path)
+	}
+	w.Flush()
+	return nil
+}
+
+func switchTarget(t *Term, ctx callContext, args string) error {
+	if args == "" {
+		if t.parentClient == nil {
+			return errors.New("the target is already selected")
+		}
+		t.selectParentTarget()
+		fmt.Println("Switched to the target.")
+		return nil
+	}
+	pid, err := strconv.Atoi(args)
+	if err != nil {
+		return errors.New("switch-target argument must be a PID")
+	}
+	client := t.client
+	if t.parentClient != nil {
+		client = t.parentClient
+	}
+	tgts, err := client.ListTargets()
+	if err != nil {
+		return err
+	}
+	for _, tgt := range tgts {
+		if tgt.Pid != pid {
+			continue
+		}
+		if tgt.Addr == "" {
+			t.selectParentTarget()
+			fmt.Println("Switched to the target.")
+			return nil
+		}
+		if tgt.Err != "" || tgt.Exited {
+			return fmt.Errorf("process %d can not be debugged", pid)
+		}
+		conn, err := net.Dial("tcp", tgt.Addr)
+		if err != nil {
+			return err
+		}
+		t.selectParentTarget()
+		t.parentClient = t.client
+		t.client = rpc2.NewClientFromConn(conn)
+		t.targetAddr = tgt.Addr
+		fmt.Printf("Switched to process %d.\n", pid)
+		return nil
+	}
+	return fmt.Errorf("no process %d", pid)
+}
+
 func display(t *Term, ctx callContext, args string) error {
 	const (
 		addOption = "-a "
@@ -2634,5 +4615,8 @@ func formatBreakpointLocation(bp *api.Breakpoint) string {
 		fmt.Fprintf(&out, "%s() ", bp.FunctionName)
 	}
 	fmt.Fprintf(&out, "%s:%d", p, bp.Line)
+	if bp.StaleSource {
+		fmt.Fprintf(&out, " (stale source, line numbers may be off)")
+	}
 	return out.String()
 }
@@ -1,6 +1,9 @@
 package terminal
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -8,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
 	"strconv"
@@ -39,7 +43,7 @@ func TestMain(m *testing.M) {
 		fmt.Fprintf(os.Stderr, "unknown build mode %q", buildMode)
 		os.Exit(1)
 	}
-	logflags.Setup(logConf != "", logConf, "")
+	logflags.Setup(logConf != "", logConf, "", "")
 	os.Exit(test.RunTestsWithFixtures(m))
 }
 
@@ -321,6 +325,9 @@ func TestTraceOnNonFunctionEntry(t *testing.T) {
 		if strings.Contains(out, "=> (9900)") {
 			t.Fatalf("Tracepoint on non-function locspec should not have return value:\n%s", out)
 		}
+		if !strings.Contains(out, "issue573.go:19") {
+			t.Fatalf("Tracepoint on non-function locspec should print its position:\n%s", out)
+		}
 	})
 }
 
@@ -878,6 +885,18 @@ func TestConfig(t *testing.T) {
 		t.Fatalf("expected MaxVariableRecurse 4, got: %d", *term.conf.MaxVariableRecurse)
 	}
 
+	err = configureCmd(&term, callContext{}, "step-skip-packages sort example.com/a")
+	if err != nil {
+		t.Fatalf("error executing configureCmd(step-skip-packages): %v", err)
+	}
+	err = configureCmd(&term, callContext{}, "step-instructions-skip-runtime true")
+	if err != nil {
+		t.Fatalf("error executing configureCmd(step-instructions-skip-runtime): %v", err)
+	}
+	if pkgs := term.conf.GetStepSkipPackages(); !reflect.DeepEqual(pkgs, []string{"runtime", "reflect", "sort", "example.com/a"}) {
+		t.Fatalf("unexpected step skip packages %v", pkgs)
+	}
+
 	err = configureCmd(&term, callContext{}, "substitute-path a b")
 	if err != nil {
 		t.Fatalf("error executing configureCmd(substitute-path a b): %v", err)
@@ -1185,3 +1204,506 @@ func TestParseNewArgv(t *testing.T) {
 		}
 	}
 }
+
+func TestParseFrameSelection(t *testing.T) {
+	testCases := []struct {
+		in     string
+		tgt    string
+		tgterr bool
+	}{
+		{"", "[]", false},
+		{"0", "[0]", false},
+		{"0 2-3", "[0 2 3]", false},
+		{"1,3", "[1 3]", false},
+		{"all", "[0 1 2 3 4]", false},
+		{"5", "", true},
+		{"3-1", "", true},
+		{"a", "", true},
+	}
+	for _, tc := range testCases {
+		sel, err := parseFrameSelection(tc.in, 5)
+		if tc.tgterr {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", tc.in, sel)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.in, err)
+			continue
+		}
+		if out := fmt.Sprint(sel); out != tc.tgt {
+			t.Errorf("%q: got %s, expected %s", tc.in, out, tc.tgt)
+		}
+	}
+}
+
+func TestLogCommand(t *testing.T) {
+	withTestTerminal("continuetestprog", t, func(term *FakeTerminal) {
+		term.MustExec("log minidump warning")
+		defer term.MustExec("log minidump error")
+		if out := term.MustExec("log"); !strings.Contains(out, "minidump\twarning\tLog minidump loading") {
+			t.Errorf("wrong output of log: %q", out)
+		}
+		if _, err := term.Exec("log minidump"); err == nil {
+			t.Error("no error with a missing level")
+		}
+		term.MustExec("log dump")
+	})
+}
+
+func TestCatchCommand(t *testing.T) {
+	if runtime.GOOS != "linux" || testBackend != "native" {
+		t.Skip("only supported by the native backend on linux")
+	}
+	withTestTerminal("catchsyscalls", t, func(term *FakeTerminal) {
+		if out := term.MustExec("catch syscall openat connect"); out != "Caught system calls: connect openat\n" {
+			t.Errorf("wrong output of catch syscall: %q", out)
+		}
+		if _, err := term.Exec("catch syscall nosuchsyscall"); err == nil {
+			t.Error("no error catching an unknown system call")
+		}
+		term.MustExec("catch --clear openat")
+		out := term.MustExec("continue")
+		if !strings.Contains(out, "entering syscall connect(") || !strings.Contains(out, "127.0.0.1:") {
+			t.Errorf("wrong output of continue: %q", out)
+		}
+		out = term.MustExec("continue")
+		if !strings.Contains(out, "returned from syscall connect = ") {
+			t.Errorf("wrong output of continue: %q", out)
+		}
+		if out := term.MustExec("catch --clear"); out != "No caught system calls\n" {
+			t.Errorf("wrong output of catch --clear: %q", out)
+		}
+	})
+}
+
+func TestCatchpoints(t *testing.T) {
+	withTestTerminal("catchpoints", t, func(term *FakeTerminal) {
+		if out := term.MustExec("catch open */catchpoints"); !strings.Contains(out, "set at") || !strings.Contains(out, "os.OpenFile()") {
+			t.Errorf("wrong output of catch open: %q", out)
+		}
+		term.MustExec("catch dial 127.0.0.1:*")
+		term.MustExec("catch http http://127.0.0.1:*/catchpoints/*")
+		if _, err := term.Exec("catch ftp *"); err == nil {
+			t.Error("no error creating an unknown catchpoint")
+		}
+		if _, err := term.Exec("catch open"); err == nil {
+			t.Error("no error creating a catchpoint without a pattern")
+		}
+
+		if goversion.VersionAfterOrEqual(runtime.Version(), 1, 17) && (runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64") {
+			// with the register ABI the arguments are not on the stack yet
+			// when the breakpoints are hit.
+			return
+		}
+		term.MustExec("continue")
+		if out := term.MustExec("print name"); out != "\"/nonexistent/catchpoints\"\n" {
+			t.Errorf("wrong file name: %q", out)
+		}
+		term.MustExec("continue")
+		if out := term.MustExec("print address"); !strings.HasPrefix(out, "\"127.0.0.1:") {
+			t.Errorf("wrong address: %q", out)
+		}
+		// The request dials the server again, after reaching the transport.
+		term.MustExec("continue")
+		if out := term.MustExec("print req.URL.Path"); out != "\"/catchpoints/get\"\n" {
+			t.Errorf("wrong path: %q", out)
+		}
+	})
+}
+
+func TestBreakHTTP(t *testing.T) {
+	withTestTerminal("breakhttp", t, func(term *FakeTerminal) {
+		if _, err := term.Exec("breakhttp --route"); err == nil {
+			t.Error("no error for an option without value")
+		}
+		if _, err := term.Exec("breakhttp --header x-debug"); err == nil {
+			t.Error("no error for a header without pattern")
+		}
+		out := term.MustExec("breakhttp --method post --route /api/v1/* --header x-debug=1")
+		if !strings.Contains(out, "set at") || !strings.Contains(out, "net/http.serverHandler.ServeHTTP()") {
+			t.Errorf("wrong output of breakhttp: %q", out)
+		}
+
+		if goversion.VersionAfterOrEqual(runtime.Version(), 1, 17) && (runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64") {
+			// with the register ABI the arguments are not on the stack yet
+			// when the breakpoints are hit.
+			return
+		}
+		term.MustExec("continue")
+		if out := term.MustExec("print req.URL.Path"); out != "\"/api/v1/users/4\"\n" {
+			t.Errorf("wrong request: %q", out)
+		}
+	})
+}
+
+func TestBreakGRPC(t *testing.T) {
+	withTestTerminal("breakhttp", t, func(term *FakeTerminal) {
+		if _, err := term.Exec("breakgrpc --metadata tenant"); err == nil || !strings.Contains(err.Error(), "<name>=<pattern>") {
+			t.Errorf("wrong error for metadata without pattern: %v", err)
+		}
+		if _, err := term.Exec("breakgrpc --method /helloworld.Greeter/SayHello"); err == nil || !strings.Contains(err.Error(), "does not serve gRPC") {
+			t.Errorf("wrong error for a target without gRPC servers: %v", err)
+		}
+	})
+}
+
+func TestCtxCommand(t *testing.T) {
+	withTestTerminal("ctxvalue", t, func(term *FakeTerminal) {
+		term.MustExec("continue")
+		out, err := term.Exec("ctx ctx")
+		if err != nil && strings.Contains(err.Error(), "dynamic types of interfaces are not available") {
+			t.Skip(err)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%s", out)
+		for _, tgt := range []string{
+			"0 *context.cancelCtx ",
+			"\tcancellable\n\tDone waited on by goroutines ",
+			"1 *context.timerCtx ",
+			"\tdeadline ",
+			`value main.requestID("id") = 42`,
+			`value main.userKey {} = "gopher"`,
+		} {
+			if !strings.Contains(out, tgt) {
+				t.Errorf("output of ctx does not contain %q", tgt)
+			}
+		}
+		if out := term.MustExec("ctx canceled"); !strings.Contains(out, "\tcanceled: ") {
+			t.Errorf("wrong output for a canceled context: %q", out)
+		}
+		if _, err := term.Exec("ctx n"); err == nil {
+			t.Error("no error examining an int")
+		}
+	})
+}
+
+func TestWorkersCommand(t *testing.T) {
+	withTestTerminal("workers", t, func(term *FakeTerminal) {
+		term.MustExec("continue")
+		out := term.MustExec("workers jobs")
+		t.Logf("%s", out)
+		if !strings.HasPrefix(out, "channel with 0/2 values buffered, 3 goroutines blocked\nCreated at ") || strings.Count(out, "[receive, waiting]") != 3 {
+			t.Errorf("wrong output of workers jobs: %q", out)
+		}
+		out = term.MustExec("workers results")
+		if !strings.HasPrefix(out, "channel with 0/0 values buffered, 2 goroutines blocked\n") || strings.Count(out, "[send, waiting]") != 2 {
+			t.Errorf("wrong output of workers results: %q", out)
+		}
+		if _, err := term.Exec("workers n"); err == nil {
+			t.Error("no error listing the workers of an int")
+		}
+	})
+}
+
+func TestTimersCommand(t *testing.T) {
+	withTestTerminal("timers", t, func(term *FakeTerminal) {
+		term.MustExec("continue")
+		out := term.MustExec("timers timer ticker afterfunc sleep")
+		t.Logf("%s", out)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		prefixes := []string{"ticker ", "timer ", "sleep ", "afterfunc "}
+		if len(lines) != len(prefixes) {
+			t.Fatalf("wrong number of timers: %q", out)
+		}
+		// the timers are sorted by the time they fire.
+		for i, prefix := range prefixes {
+			if !strings.HasPrefix(lines[i], prefix) {
+				t.Errorf("timer %d is not a %s: %q", i, prefix, lines[i])
+			}
+		}
+		if !strings.Contains(lines[0], "every 1m0s") || !strings.Contains(lines[0], "waited on by goroutines") {
+			t.Errorf("wrong ticker: %q", lines[0])
+		}
+		if !strings.Contains(lines[1], "waited on by goroutines") {
+			t.Errorf("no goroutine receiving from the timer: %q", lines[1])
+		}
+		if !strings.Contains(lines[2], "wakes up goroutine") {
+			t.Errorf("no goroutine sleeping: %q", lines[2])
+		}
+		if !strings.Contains(lines[3], "calls main.onTimeout") {
+			t.Errorf("wrong callback of time.AfterFunc: %q", lines[3])
+		}
+		if runtime.GOOS == "linux" && !strings.Contains(lines[3], "fires in 2h59m") {
+			t.Errorf("wrong time of time.AfterFunc: %q", lines[3])
+		}
+		if _, err := term.Exec("timers alarm"); err == nil {
+			t.Error("no error listing an unknown kind of timers")
+		}
+	})
+}
+
+func TestFinalizersCommand(t *testing.T) {
+	withTestTerminal("finalizers", t, func(term *FakeTerminal) {
+		term.MustExec("continue")
+		out := term.MustExec("finalizers")
+		t.Logf("%s", out)
+		if !strings.HasPrefix(out, "Finalizer goroutine ") || !strings.Contains(out, "\nFinalizers: ") || !strings.Contains(out, "\t3 *main.resource main.release\n") {
+			t.Errorf("wrong output of finalizers: %q", out)
+		}
+		out = term.MustExec("finalizers -v main.resource")
+		if !strings.Contains(out, "\nQueued finalizers: 0\n") || !strings.Contains(out, "\nFinalizers: 3\n") || strings.Count(out, "*main.resource main.release\n") != 3 {
+			t.Errorf("wrong output of finalizers -v main.resource: %q", out)
+		}
+
+		if _, err := term.Exec("breakfinalizer main.unknown"); err == nil {
+			t.Error("no error creating a breakpoint on the finalizers of a type without finalizers")
+		}
+		out = term.MustExec("breakfinalizer *main.resource")
+		if !strings.Contains(out, " set at ") || !strings.Contains(out, "main.release") {
+			t.Errorf("wrong output of breakfinalizer: %q", out)
+		}
+		out = term.MustExec("continue")
+		if !strings.Contains(out, "main.release()") {
+			t.Fatalf("did not stop in the finalizer: %q", out)
+		}
+		out = term.MustExec("finalizers")
+		if !strings.Contains(out, "main.release") || !strings.Contains(out, "[running a finalizer, ") {
+			t.Errorf("the finalizer goroutine is not running a finalizer: %q", out)
+		}
+		if goversion.VersionAfterOrEqual(runtime.Version(), 1, 17) && (runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64") {
+			// the argument of the finalizer is not spilled yet at the entry
+			// of the function with the register ABI.
+			return
+		}
+		out = term.MustExec("print r.name")
+		if strings.TrimSpace(out) != `"dropped"` {
+			t.Errorf("stopped on the wrong finalizer: %q", out)
+		}
+	})
+}
+
+func TestThreadsMP(t *testing.T) {
+	withTestTerminal("goroutinestackprog", t, func(term *FakeTerminal) {
+		term.MustExec("break main.stacktraceme")
+		term.MustExec("continue")
+		out := term.MustExec("threads")
+		var cur string
+		for _, line := range strings.Split(out, "\n") {
+			if strings.HasPrefix(line, "* ") {
+				cur = line
+			}
+		}
+		// the current thread is running main.stacktraceme, it holds a P.
+		if !regexp.MustCompile(`^\* Thread \d+ .*\(M \d+, P \d+\) at `).MatchString(cur) {
+			t.Errorf("no M and P for the current thread: %q", cur)
+		}
+		if runtime.GOOS == "linux" && testBackend != "rr" && !strings.Contains(cur, "[goroutinestack") {
+			t.Errorf("no name for the current thread: %q", cur)
+		}
+		out = term.MustExec("goroutines")
+		if !regexp.MustCompile(`\(thread \d+.*, M \d+, P \d+\)`).MatchString(out) {
+			t.Errorf("no M and P for the current goroutine: %q", out)
+		}
+	})
+}
+
+func TestProfileCMallocCommand(t *testing.T) {
+	test.MustHaveCgo(t)
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("the C library is only traced on linux/amd64 and linux/arm64")
+	}
+	out := filepath.Join(os.TempDir(), fmt.Sprintf("cmalloc%d.pprof", os.Getpid()))
+	defer os.Remove(out)
+	withTestTerminal("cmalloc", t, func(term *FakeTerminal) {
+		term.MustExec("continue")
+		term.MustExec("profile cmalloc 1m -o " + out)
+		// profiling ends at the second breakpoint of the fixture.
+		term.AssertExec("print len(leaked)", "10\n")
+		f, err := os.Open(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"malloc", "calloc", "realloc", "main._Cfunc_leak", "main._Cfunc_scratch", "inuse_space"} {
+			if !bytes.Contains(data, []byte(name)) {
+				t.Errorf("%s not in the profile", name)
+			}
+		}
+		if _, err := term.Exec("profile heap -go"); err == nil {
+			t.Error("no error tracing the allocations of Go in a heap profile")
+		}
+	})
+}
+
+func TestTraceRuntimeCommand(t *testing.T) {
+	test.MustSupportFunctionCalls(t, testBackend)
+	out := filepath.Join(os.TempDir(), fmt.Sprintf("runtimetrace%d.out", os.Getpid()))
+	defer os.Remove(out)
+	withTestTerminal("runtimetrace", t, func(term *FakeTerminal) {
+		caps, err := term.client.ListCapabilities()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range caps {
+			if c.Feature == "function calls" && !c.Available {
+				t.Skipf("function calls are not available: %s", c.Reason)
+			}
+		}
+		term.MustExec("break main.work")
+		term.MustExec("continue")
+		if _, err := term.Exec("trace-runtime stop"); err == nil {
+			t.Error("no error stopping a runtime trace that was not started")
+		}
+		term.AssertExec("trace-runtime start "+out, fmt.Sprintf("Runtime trace started, writing to %s\n", out))
+		if _, err := term.Exec("trace-runtime start " + out); err == nil {
+			t.Error("no error starting the runtime trace twice")
+		}
+		term.MustExec("continue")
+		term.MustExec("continue")
+		term.AssertExec("trace-runtime stop", fmt.Sprintf("Runtime trace saved to %s, 2 stops logged, see 'go tool trace %s'\n", out, out))
+		data, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, []byte("go 1.")) {
+			t.Errorf("%s is not a runtime trace", out)
+		}
+		if !bytes.Contains(data, []byte("main.work")) {
+			t.Error("main.work not in the runtime trace")
+		}
+	})
+}
+
+func TestTimelineCommand(t *testing.T) {
+	out := filepath.Join(os.TempDir(), fmt.Sprintf("timeline%d.json", os.Getpid()))
+	defer os.Remove(out)
+	withTestTerminal("runtimetrace", t, func(term *FakeTerminal) {
+		term.MustExec("timeline eval i")
+		term.MustExec("timeline eval nosuchvar")
+		term.AssertExec("timeline eval", "i\nnosuchvar\n")
+		term.MustExec("break runtimetrace.go:28")
+		term.MustExec("continue")
+		term.MustExec("continue")
+		term.MustExec("next")
+		term.MustExec("clearall")
+		if _, err := term.Exec("continue"); err == nil {
+			t.Fatal("the target did not exit")
+		}
+
+		lines := strings.Split(strings.TrimSpace(term.MustExec("timeline")), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("wrong number of stops: %q", lines)
+		}
+		for i, tgt := range []string{
+			"#1 continue: breakpoint 1 at ",
+			"#2 continue: breakpoint 1 at ",
+			"#3 next: step finished at ",
+			"#4 continue: exited with status 0",
+		} {
+			if !strings.HasPrefix(lines[i], tgt) {
+				t.Errorf("wrong stop %d, expected %q got %q", i+1, tgt, lines[i])
+			}
+		}
+		if !strings.Contains(lines[1], "main.main (goroutine 1) i = 1, nosuchvar: <") {
+			t.Errorf("wrong values at stop 2: %q", lines[1])
+		}
+		if detail := term.MustExec("timeline 2"); !strings.Contains(detail, "\ti = 1\n") {
+			t.Errorf("wrong values of stop 2: %q", detail)
+		}
+		if _, err := term.Exec("timeline 5"); err == nil {
+			t.Error("no error printing a stop not in the timeline")
+		}
+
+		term.AssertExec("timeline -o "+out, fmt.Sprintf("4 stops saved to %s\n", out))
+		data, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stops []api.TimelineStop
+		if err := json.Unmarshal(data, &stops); err != nil {
+			t.Fatal(err)
+		}
+		if len(stops) != 4 || stops[0].Line != 28 || stops[0].Values[0].Value != "0" || !stops[3].Exited {
+			t.Errorf("wrong timeline: %s", data)
+		}
+	})
+}
+
+func TestTimelineBreakpointExprs(t *testing.T) {
+	withTestTerminal("runtimetrace", t, func(term *FakeTerminal) {
+		term.MustExec("break runtimetrace.go:11")
+		term.MustExec("on 1 sample i")
+		term.MustExec("break loop runtimetrace.go:28")
+		term.MustExec("on loop print s")
+		term.MustExec("continue")
+		term.MustExec("continue")
+		term.MustExec("clear 1")
+
+		lines := strings.Split(strings.TrimSpace(term.MustExec("timeline")), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("wrong number of stops: %q", lines)
+		}
+		tgts := []string{
+			"#1 continue: breakpoint loop at ",
+			"#2 continue: sample breakpoint 1 at ",
+			"#3 continue: breakpoint loop at ",
+		}
+		for i, tgt := range tgts {
+			if !strings.HasPrefix(lines[i], tgt) {
+				t.Errorf("wrong stop %d, expected %q got %q", i+1, tgt, lines[i])
+			}
+		}
+		if !strings.HasSuffix(lines[1], "main.work (goroutine 1) i = 0") || !strings.HasSuffix(lines[2], "main.main (goroutine 1) s = 0") {
+			t.Errorf("wrong values: %q", lines)
+		}
+		if detail := term.MustExec("timeline 2"); !strings.Contains(detail, ", resumed without stopping\n") {
+			t.Errorf("sample not marked as resumed: %q", detail)
+		}
+
+		// the stops at breakpoints cleared are listed by id.
+		out := term.MustExec("timeline -bp 1")
+		if strings.Count(out, "\n") != 1 || !strings.HasPrefix(out, tgts[1]) {
+			t.Errorf("wrong stops at breakpoint 1: %q", out)
+		}
+		if out := term.MustExec("timeline -bp loop"); strings.Count(out, "\n") != 2 {
+			t.Errorf("wrong stops at breakpoint loop: %q", out)
+		}
+	})
+}
+
+func TestExamineMemoryChanges(t *testing.T) {
+	withTestTerminal("examinememory", t, func(term *FakeTerminal) {
+		term.MustExec("break examinememory.go:19")
+		term.MustExec("break examinememory.go:24")
+		term.MustExec("continue")
+		addressStr := strings.TrimSpace(term.MustExec("p bspUintptr"))
+		address, err := strconv.ParseInt(addressStr, 0, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := term.MustExec("x -display -len 12 " + addressStr)
+		if strings.Contains(res, "changed") {
+			t.Errorf("changes the first time the memory is examined: %q", res)
+		}
+		term.AssertExec("x -display", fmt.Sprintf("x0: examinemem -fmt hex -len 12 %#x\n%s", address, res))
+
+		// the memory is printed when the program stops, bs[0] changed.
+		res = term.MustExec("continue")
+		header := fmt.Sprintf("x0: examinemem -fmt hex -len 12 %#x\n%#x:   0xff   0x0b", address, address)
+		if !strings.Contains(res, header) || !strings.Contains(res, "\n1 of 12 bytes changed since the last time\n") {
+			t.Errorf("memory not printed with the changes when the program stopped: %q", res)
+		}
+		if res := term.MustExec("x -len 12 " + addressStr); strings.Contains(res, "changed") {
+			t.Errorf("changes without changes: %q", res)
+		}
+
+		term.MustExec("x -undisplay 0")
+		if _, err := term.Exec("x -undisplay 0"); err == nil {
+			t.Error("no error removing the memory display twice")
+		}
+		term.AssertExec("x -display", "")
+	})
+}
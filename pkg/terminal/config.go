@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"text/tabwriter"
@@ -27,6 +28,7 @@ func configureCmd(t *Term, ctx callContext, args string) error {
 		if t.client != nil { // only happens in tests
 			lcfg := t.loadConfig()
 			t.client.SetReturnValuesLoadConfig(&lcfg)
+			t.client.SetStepSkipPackages(t.conf.GetStepSkipPackages())
 		}
 		return nil
 	}
@@ -116,6 +118,11 @@ func configureSet(t *Term, args string) error {
 		return configureSetSubstitutePath(t, rest)
 	}
 
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+		field.Set(reflect.ValueOf(config.SplitQuotedFields(rest, '"')))
+		return nil
+	}
+
 	simpleArg := func(typ reflect.Type) (reflect.Value, error) {
 		switch typ.Kind() {
 		case reflect.Int:
@@ -155,12 +162,36 @@ func configureSet(t *Term, args string) error {
 
 func configureSetSubstitutePath(t *Term, rest string) error {
 	argv := config.SplitQuotedFields(rest, '"')
+	if len(argv) == 2 && argv[0] == "-test" {
+		for i, r := range t.conf.SubstitutePath {
+			if r.Regex && (i >= len(t.substitutePathRxs) || t.substitutePathRxs[i] == nil) {
+				fmt.Printf("rule %d: invalid regular expression %q, the rule is ignored\n", i, r.From)
+			}
+		}
+		path, how := t.substitutePathExplain(argv[1])
+		fmt.Printf("%s => %s (%s)\n", argv[1], path, how)
+		if !fileExists(path) {
+			fmt.Printf("%s does not exist\n", path)
+		}
+		return nil
+	}
+	regex := false
+	if len(argv) > 0 && argv[0] == "-regex" {
+		regex = true
+		argv = argv[1:]
+		if len(argv) == 2 {
+			if _, err := regexp.Compile(argv[0]); err != nil {
+				return fmt.Errorf("invalid regular expression %q: %v", argv[0], err)
+			}
+		}
+	}
 	switch len(argv) {
 	case 1: // delete substitute-path rule
 		for i := range t.conf.SubstitutePath {
 			if t.conf.SubstitutePath[i].From == argv[0] {
 				copy(t.conf.SubstitutePath[i:], t.conf.SubstitutePath[i+1:])
 				t.conf.SubstitutePath = t.conf.SubstitutePath[:len(t.conf.SubstitutePath)-1]
+				t.compileSubstitutePath()
 				return nil
 			}
 		}
@@ -169,12 +200,15 @@ func configureSetSubstitutePath(t *Term, rest string) error {
 		for i := range t.conf.SubstitutePath {
 			if t.conf.SubstitutePath[i].From == argv[0] {
 				t.conf.SubstitutePath[i].To = argv[1]
+				t.conf.SubstitutePath[i].Regex = regex
+				t.compileSubstitutePath()
 				return nil
 			}
 		}
-		t.conf.SubstitutePath = append(t.conf.SubstitutePath, config.SubstitutePathRule{From: argv[0], To: argv[1]})
+		t.conf.SubstitutePath = append(t.conf.SubstitutePath, config.SubstitutePathRule{From: argv[0], To: argv[1], Regex: regex})
+		t.compileSubstitutePath()
 	default:
-		return fmt.Errorf("too many arguments to \"config substitute-path\"")
+		return fmt.Errorf("wrong number of arguments to \"config substitute-path\"")
 	}
 	return nil
 }
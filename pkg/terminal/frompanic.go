@@ -0,0 +1,191 @@
+package terminal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/symbolize"
+	"github.com/go-delve/delve/service/api"
+)
+
+// parseFrameSelection parses a list of frame numbers and ranges of frame
+// numbers, like "0 2-4", for a stack trace of n frames. The list "all"
+// selects all frames.
+func parseFrameSelection(sel string, n int) ([]int, error) {
+	var r []int
+	for _, field := range strings.FieldsFunc(sel, func(c rune) bool { return c == ' ' || c == ',' }) {
+		if field == "all" {
+			r = r[:0]
+			for i := 0; i < n; i++ {
+				r = append(r, i)
+			}
+			return r, nil
+		}
+		start, end := field, field
+		if dash := strings.Index(field, "-"); dash >= 0 {
+			start, end = field[:dash], field[dash+1:]
+		}
+		a, err1 := strconv.Atoi(start)
+		b, err2 := strconv.Atoi(end)
+		if err1 != nil || err2 != nil || a > b {
+			return nil, fmt.Errorf("invalid frame selection %q", field)
+		}
+		if a < 0 || b >= n {
+			return nil, fmt.Errorf("frame %q out of range", field)
+		}
+		for i := a; i <= b; i++ {
+			r = append(r, i)
+		}
+	}
+	return r, nil
+}
+
+// findPanicFrame maps the frame of a stack trace to a location of the
+// program being debugged. The position of the frame is looked up first,
+// also removing leading directories in case the program was built in a
+// different directory, then the function. The returned string describes
+// a mismatch between the location and the frame.
+func findPanicFrame(t *Term, ctx callContext, f symbolize.TracebackFrame) (*api.Location, string) {
+	path := strings.Replace(f.File, "\\", "/", -1)
+	for {
+		locs, err := t.client.FindLocation(ctx.Scope, fmt.Sprintf("%s:%d", path, f.Line), true)
+		if err == nil && len(locs) == 1 {
+			if locs[0].Function != nil && locs[0].Function.Name() != f.Function && !f.Inlined {
+				return &locs[0], fmt.Sprintf("in %s, the source could have changed", locs[0].Function.Name())
+			}
+			return &locs[0], ""
+		}
+		slash := strings.Index(path, "/")
+		if slash < 0 {
+			break
+		}
+		path = path[slash+1:]
+	}
+	locs, err := t.client.FindLocation(ctx.Scope, f.Function, true)
+	if err == nil && len(locs) == 1 {
+		return &locs[0], "line not found, using the function"
+	}
+	return nil, "not found"
+}
+
+// readPastedPanic reads a stack trace pasted in the terminal, until an
+// empty line following a frame or the end of the input.
+func readPastedPanic() (string, error) {
+	fmt.Println("Paste the stack trace, then enter an empty line or press Ctrl-D:")
+	var buf strings.Builder
+	in := bufio.NewReader(os.Stdin)
+	for {
+		line, err := in.ReadString('\n')
+		if strings.TrimSpace(line) == "" && err == nil {
+			if frames, _ := symbolize.ParseTraceback(strings.NewReader(buf.String())); len(frames) > 0 {
+				break
+			}
+		}
+		buf.WriteString(line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+func fromPanic(t *Term, ctx callContext, args string) error {
+	var sel string
+	if args == "-b" || strings.HasPrefix(args, "-b ") {
+		v := strings.SplitN(strings.TrimSpace(args[2:]), " ", 2)
+		if v[0] == "" {
+			return errors.New("-b requires a list of frames")
+		}
+		sel = v[0]
+		args = ""
+		if len(v) > 1 {
+			args = strings.TrimSpace(v[1])
+		}
+	}
+
+	var text string
+	if args != "" {
+		buf, err := ioutil.ReadFile(args)
+		if err != nil {
+			return err
+		}
+		text = string(buf)
+	} else {
+		var err error
+		if text, err = readPastedPanic(); err != nil {
+			return err
+		}
+	}
+
+	frames, err := symbolize.ParseTraceback(strings.NewReader(text))
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		return errors.New("no stack trace found")
+	}
+
+	locs := make([]*api.Location, len(frames))
+	curg := -1
+	for i, f := range frames {
+		if f.Goroutine != curg {
+			curg = f.Goroutine
+			fmt.Printf("Goroutine %d:\n", curg)
+		}
+		var note string
+		locs[i], note = findPanicFrame(t, ctx, f)
+		prefix := ""
+		switch {
+		case f.Inlined:
+			prefix = "(inlined) "
+		case f.CreatedBy:
+			prefix = "created by "
+		}
+		fmt.Printf("%4d  %s%s\n      %s:%d\n", i, prefix, f.Function, f.File, f.Line)
+		if locs[i] != nil {
+			fmt.Printf("      => %#x %s:%d", locs[i].PC, shortenFilePath(locs[i].File), locs[i].Line)
+		} else {
+			fmt.Printf("      =>")
+		}
+		if note != "" {
+			fmt.Printf(" (%s)", note)
+		}
+		fmt.Println()
+	}
+
+	if sel == "" {
+		if t.line == nil {
+			return nil
+		}
+		sel, err = t.line.Prompt("Set breakpoints on frames (for example '0 2-3' or 'all', empty for none): ")
+		if err != nil {
+			return err
+		}
+	}
+	idxs, err := parseFrameSelection(sel, len(frames))
+	if err != nil {
+		return err
+	}
+	for _, i := range idxs {
+		if locs[i] == nil {
+			fmt.Printf("Frame %d not found in the current binary\n", i)
+			continue
+		}
+		bp, err := t.client.CreateBreakpoint(&api.Breakpoint{Addr: locs[i].PC, Addrs: locs[i].PCs})
+		if err != nil {
+			fmt.Printf("Frame %d: %v\n", i, err)
+			continue
+		}
+		fmt.Printf("%s set at %s\n", formatBreakpointName(bp, true), formatBreakpointLocation(bp))
+	}
+	return nil
+}
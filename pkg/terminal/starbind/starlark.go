@@ -78,7 +78,7 @@ func New(ctx Context) *Env {
 			argstrs[i] = string(a)
 		}
 		err := env.ctx.CallCommand(strings.Join(argstrs, " "))
-		if err != nil && strings.Contains(err.Error(), " has exited with status ") {
+		if err != nil && api.ErrorCodeOf(err) == api.ErrCodeProcessExited {
 			return env.interfaceToStarlarkValue(err), nil
 		}
 		return starlark.None, decorateError(thread, err)
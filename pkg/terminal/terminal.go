@@ -2,10 +2,13 @@ package terminal
 
 import (
 	"fmt"
+	"go/build"
 	"io"
 	"net/rpc"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -56,6 +59,24 @@ type Term struct {
 	InitFile string
 	displays []string
 
+	// memoryDisplays are the regions of memory printed every time the
+	// program stops, see examinemem -display.
+	memoryDisplays []*memoryDisplay
+	// examined are the contents of memory last printed by examinemem, by
+	// address, the bytes that changed are highlighted when the same
+	// address is examined again.
+	examined map[uintptr][]byte
+
+	// substitutePathRxs are the compiled regular expressions of the rules
+	// of conf.SubstitutePath, nil for the rules that are not regular
+	// expressions or are invalid, see compileSubstitutePath.
+	substitutePathRxs []*regexp.Regexp
+
+	// SourceRoot is a directory where the source files that do not exist
+	// locally are searched, for example the root directory of the
+	// container running the target.
+	SourceRoot string
+
 	historyFile *os.File
 
 	starlarkEnv *starbind.Env
@@ -66,6 +87,49 @@ type Term struct {
 
 	quittingMutex sync.Mutex
 	quitting      bool
+
+	// parentClient is the client of the target while a child process,
+	// debugged by the instance of Delve at targetAddr, is selected with
+	// switch-target.
+	parentClient service.Client
+	targetAddr   string
+}
+
+// selectParentTarget selects the target again, disconnecting from the
+// instance of Delve debugging the child process selected, which keeps
+// debugging it.
+func (t *Term) selectParentTarget() {
+	if t.parentClient == nil {
+		return
+	}
+	t.client.Disconnect(false)
+	t.client = t.parentClient
+	t.parentClient = nil
+	t.targetAddr = ""
+}
+
+// streamOutput prints the output of the target streamed by the server,
+// until the server reports that the target will not write more.
+func (t *Term) streamOutput() {
+	client := t.client
+	var since uint64
+	for {
+		chunks, closed, err := client.GetOutput(since, true)
+		if err != nil {
+			return
+		}
+		for _, chunk := range chunks {
+			if chunk.Stream == api.OutputStreamStderr {
+				os.Stderr.Write(chunk.Data)
+			} else {
+				os.Stdout.Write(chunk.Data)
+			}
+			since = chunk.Seq
+		}
+		if closed {
+			return
+		}
+	}
 }
 
 // New returns a new Term.
@@ -105,9 +169,14 @@ func New(client service.Client, conf *config.Config) *Term {
 		stdout: w,
 	}
 
+	for _, err := range t.compileSubstitutePath() {
+		fmt.Fprintf(os.Stderr, "%v, the rule is ignored\n", err)
+	}
+
 	if client != nil {
 		lcfg := t.loadConfig()
 		client.SetReturnValuesLoadConfig(&lcfg)
+		client.SetStepSkipPackages(conf.GetStepSkipPackages())
 	}
 
 	t.starlarkEnv = starbind.New(starlarkContext{t})
@@ -168,6 +237,21 @@ func (t *Term) sigintGuard(ch <-chan os.Signal, multiClient bool) {
 	}
 }
 
+// printUnavailableFeatures warns about the features that can not be used
+// with the target program, because of how it was built.
+func (t *Term) printUnavailableFeatures() {
+	caps, err := t.client.ListCapabilities()
+	if err != nil {
+		// the server could be an older version of delve
+		return
+	}
+	for _, c := range caps {
+		if !c.Available {
+			fmt.Fprintf(os.Stderr, "Warning: %s are not available: %s\n", c.Feature, c.Reason)
+		}
+	}
+}
+
 // Run begins running dlv in the terminal.
 func (t *Term) Run() (int, error) {
 	defer t.Close()
@@ -178,6 +262,7 @@ func (t *Term) Run() (int, error) {
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT)
 	go t.sigintGuard(ch, multiClient)
+	go t.streamOutput()
 
 	t.line.SetCompleter(func(line string) (c []string) {
 		if strings.HasPrefix(line, "break ") || strings.HasPrefix(line, "b ") {
@@ -212,6 +297,7 @@ func (t *Term) Run() (int, error) {
 	}
 
 	fmt.Println("Type 'help' for list of commands.")
+	t.printUnavailableFeatures()
 
 	if t.InitFile != "" {
 		err := t.cmds.executeFile(t, t.InitFile)
@@ -249,10 +335,9 @@ func (t *Term) Run() (int, error) {
 			if _, ok := err.(ExitRequestError); ok {
 				return t.handleExit()
 			}
-			// The type information gets lost in serialization / de-serialization,
-			// so we do a string compare on the error message to see if the process
-			// has exited, or if the command actually failed.
-			if strings.Contains(err.Error(), "exited") {
+			// Check the error code to see if the process has exited, or if
+			// the command actually failed.
+			if isErrProcessExited(err) {
 				fmt.Fprintln(os.Stderr, err.Error())
 			} else {
 				t.quittingMutex.Lock()
@@ -286,10 +371,45 @@ func (t *Term) Println(prefix, str string) {
 // If more than one substitution rule is defined, the rules are applied
 // in the order they are defined, first rule that matches is used for
 // substitution.
+//
+// If no rule matches and the file does not exist, paths inside the module
+// cache or a GOPATH of another machine, for example of a container where
+// the program was built, are mapped to the local module cache or GOPATH,
+// when the file exists there. The relative paths recorded when the program
+// is built with -trimpath are mapped to GOROOT, to the module cache or to
+// the local directories of the modules, see trimmedPath.
 func (t *Term) substitutePath(path string) string {
+	path, _ = t.substitutePathExplain(path)
+	return path
+}
+
+// compileSubstitutePath compiles the regular expressions of the
+// substitute-path rules, it must be called every time the rules change.
+// Returns the errors of the invalid regular expressions, whose rules are
+// ignored by substitutePath.
+func (t *Term) compileSubstitutePath() []error {
+	t.substitutePathRxs = make([]*regexp.Regexp, len(t.conf.SubstitutePath))
+	var errs []error
+	for i, r := range t.conf.SubstitutePath {
+		if !r.Regex {
+			continue
+		}
+		rx, err := regexp.Compile(r.From)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("substitute-path rule %d: invalid regular expression %q: %v", i, r.From, err))
+			continue
+		}
+		t.substitutePathRxs[i] = rx
+	}
+	return errs
+}
+
+// substitutePathExplain returns the result of substitutePath and a
+// description of how it was computed.
+func (t *Term) substitutePathExplain(path string) (string, string) {
 	path = crossPlatformPath(path)
 	if t.conf == nil {
-		return path
+		return path, "no substitution"
 	}
 
 	// On windows paths returned from headless server are as c:/dir/dir
@@ -299,7 +419,19 @@ func (t *Term) substitutePath(path string) string {
 	if strings.Index(path, "\\") != -1 { //dependent on the path
 		separator = "\\"
 	}
-	for _, r := range t.conf.SubstitutePath {
+	for i, r := range t.conf.SubstitutePath {
+		if r.Regex {
+			if i >= len(t.substitutePathRxs) || t.substitutePathRxs[i] == nil {
+				continue
+			}
+			rx := t.substitutePathRxs[i]
+			if m := rx.FindStringSubmatchIndex(path); m != nil {
+				dst := rx.ExpandString(nil, r.To, path, m)
+				return path[:m[0]] + string(dst) + path[m[1]:], fmt.Sprintf("rule %d: regex %q => %q", i, r.From, r.To)
+			}
+			continue
+		}
+
 		from := crossPlatformPath(r.From)
 		to := r.To
 
@@ -310,10 +442,83 @@ func (t *Term) substitutePath(path string) string {
 			to = to + separator
 		}
 		if strings.HasPrefix(path, from) {
-			return strings.Replace(path, from, to, 1)
+			return strings.Replace(path, from, to, 1), fmt.Sprintf("rule %d: %q => %q", i, r.From, r.To)
 		}
 	}
-	return path
+
+	if _, err := os.Stat(path); err == nil {
+		return path, "no substitution"
+	}
+	if t.SourceRoot != "" && filepath.IsAbs(path) {
+		local := filepath.Join(t.SourceRoot, path)
+		if _, err := os.Stat(local); err == nil {
+			return local, fmt.Sprintf("source root %q", t.SourceRoot)
+		}
+	}
+	if local, kind := localGoPath(path); local != "" {
+		return local, kind
+	}
+	if local, kind := trimmedPath(path); local != "" {
+		return local, kind
+	}
+	return path, "no substitution"
+}
+
+// localGoPath maps path, if it is inside the module cache or the src
+// directory of a GOPATH, to the same file in the local module cache or in
+// one of the local GOPATH directories. Returns an empty string if the
+// file does not exist locally.
+func localGoPath(path string) (string, string) {
+	slashPath := strings.Replace(path, "\\", "/", -1)
+	gopaths := localGoPaths()
+
+	if idx := strings.Index(slashPath, "/pkg/mod/"); idx >= 0 {
+		rest := filepath.FromSlash(slashPath[idx+len("/pkg/mod/"):])
+		if modcache := localModCache(); modcache != "" {
+			if local := filepath.Join(modcache, rest); fileExists(local) {
+				return local, "module cache"
+			}
+		}
+	}
+
+	for idx := strings.Index(slashPath, "/src/"); idx >= 0; {
+		rest := filepath.FromSlash(slashPath[idx+len("/src/"):])
+		for _, gopath := range gopaths {
+			if local := filepath.Join(gopath, "src", rest); fileExists(local) {
+				return local, "GOPATH"
+			}
+		}
+		next := strings.Index(slashPath[idx+1:], "/src/")
+		if next < 0 {
+			break
+		}
+		idx += next + 1
+	}
+	return "", ""
+}
+
+// localGoPaths returns the GOPATH directories of this machine.
+func localGoPaths() []string {
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		return filepath.SplitList(gopath)
+	}
+	return []string{build.Default.GOPATH}
+}
+
+// localModCache returns the module cache directory of this machine.
+func localModCache() string {
+	if modcache := os.Getenv("GOMODCACHE"); modcache != "" {
+		return modcache
+	}
+	if gopaths := localGoPaths(); len(gopaths) > 0 && gopaths[0] != "" {
+		return filepath.Join(gopaths[0], "pkg", "mod")
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
 }
 
 func crossPlatformPath(path string) string {
@@ -370,6 +575,7 @@ func (t *Term) handleExit() (int, error) {
 		return 0, nil
 	}
 
+	t.selectParentTarget()
 	s, err := t.client.GetState()
 	if err != nil {
 		if isErrProcessExited(err) {
@@ -484,10 +690,15 @@ func (t *Term) printDisplays() {
 
 func (t *Term) onStop() {
 	t.printDisplays()
+	t.printMemoryDisplays()
 }
 
 // isErrProcessExited returns true if `err` is an RPC error equivalent of proc.ErrProcessExited
 func isErrProcessExited(err error) bool {
+	if api.ErrorCodeOf(err) == api.ErrCodeProcessExited {
+		return true
+	}
+	// servers older than the error codes only send the message
 	rpcError, ok := err.(rpc.ServerError)
 	return ok && strings.Contains(rpcError.Error(), "has exited with status")
 }
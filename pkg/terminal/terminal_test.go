@@ -2,11 +2,15 @@ package terminal
 
 import (
 	"errors"
+	"io/ioutil"
 	"net/rpc"
+	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 
 	"github.com/go-delve/delve/pkg/config"
+	"github.com/go-delve/delve/service/api"
 )
 
 type tRule struct {
@@ -88,6 +92,168 @@ func TestSubstitutePath(t *testing.T) {
 	}
 }
 
+func TestSubstitutePathRegex(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test cases use unix paths")
+	}
+	rules := config.SubstitutePathRules{
+		{From: `^/build/(`, To: "/invalid/", Regex: true},
+		{From: `^/build/([^/]+)/src/`, To: "/home/user/$1/", Regex: true},
+		{From: "/build", To: "/other"},
+	}
+	term := New(nil, &config.Config{SubstitutePath: rules})
+	if errs := term.compileSubstitutePath(); len(errs) != 1 {
+		t.Errorf("wrong errors for the invalid rule: %v", errs)
+	}
+	for _, c := range []struct{ path, res string }{
+		{"/build/proj/src/main.go", "/home/user/proj/main.go"},
+		{"/build/proj/main.go", "/other/proj/main.go"},
+		{"/elsewhere/build/proj/src/main.go", "/elsewhere/build/proj/src/main.go"},
+	} {
+		if res := term.substitutePath(c.path); res != c.res {
+			t.Errorf("substitutePath(%q) => %q, want %q", c.path, res, c.res)
+		}
+	}
+
+	// The rules changed by the config command are compiled again.
+	if err := configureSetSubstitutePath(term, "-regex ^/elsewhere/ /here/"); err != nil {
+		t.Fatal(err)
+	}
+	if res := term.substitutePath("/elsewhere/main.go"); res != "/here/main.go" {
+		t.Errorf("substitutePath(%q) => %q after adding a rule", "/elsewhere/main.go", res)
+	}
+}
+
+func TestSubstitutePathGoPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test cases use unix paths")
+	}
+	dir, err := ioutil.TempDir("", "substitute-path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	modfile := filepath.Join(dir, "mod", "example.com", "m@v1.0.0", "m.go")
+	gopathfile := filepath.Join(dir, "gopath", "src", "example.com", "p", "p.go")
+	for _, path := range []string{modfile, gopathfile} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("GOMODCACHE", os.Getenv("GOMODCACHE"))
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOMODCACHE", filepath.Join(dir, "mod"))
+	os.Setenv("GOPATH", filepath.Join(dir, "gopath"))
+
+	term := New(nil, &config.Config{})
+	for _, c := range []struct{ path, res string }{
+		{"/root/go/pkg/mod/example.com/m@v1.0.0/m.go", modfile},
+		{"/go/src/example.com/p/p.go", gopathfile},
+		{"/go/src/example.com/p/missing.go", "/go/src/example.com/p/missing.go"},
+		{"/root/go/pkg/mod/example.com/m@v1.1.0/m.go", "/root/go/pkg/mod/example.com/m@v1.1.0/m.go"},
+	} {
+		if res := term.substitutePath(c.path); res != c.res {
+			t.Errorf("substitutePath(%q) => %q, want %q", c.path, res, c.res)
+		}
+	}
+}
+
+func TestSubstitutePathSourceRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test cases use unix paths")
+	}
+	dir, err := ioutil.TempDir("", "substitute-path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app", "main.go")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	term := New(nil, &config.Config{})
+	term.SourceRoot = dir
+	for _, c := range []struct{ path, res string }{
+		{"/app/main.go", path},
+		{"/app/missing.go", "/app/missing.go"},
+		{path, path},
+	} {
+		if res := term.substitutePath(c.path); res != c.res {
+			t.Errorf("substitutePath(%q) => %q, want %q", c.path, res, c.res)
+		}
+	}
+}
+
+func TestSubstitutePathTrimpath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test cases use unix paths")
+	}
+	dir, err := ioutil.TempDir("", "substitute-path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"main/go.mod":                        "module example.com/main\n\nrequire example.com/Dep v1.0.0\n\nreplace (\n\texample.com/lib v1.2.0 => ../lib // local copy\n\texample.com/other => example.com/fork v1.0.0\n)\n",
+		"main/main.go":                       "",
+		"main/sub/sub.go":                    "",
+		"lib/go.mod":                         "module example.com/lib\n",
+		"lib/lib.go":                         "",
+		"mod/example.com/!dep@v1.0.0/dep.go": "",
+		"goroot/src/runtime/proc.go":         "",
+		"work/go.work":                       "go 1.18\n\nuse (\n\t./a\n\t\"b\"\n)\n",
+		"work/a/go.mod":                      "module example.com/a\n",
+		"work/b/go.mod":                      "module example.com/b\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("GOMODCACHE", os.Getenv("GOMODCACHE"))
+	defer os.Setenv("GOROOT", os.Getenv("GOROOT"))
+	os.Setenv("GOMODCACHE", filepath.Join(dir, "mod"))
+	os.Setenv("GOROOT", filepath.Join(dir, "goroot"))
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(filepath.Join(dir, "main", "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	term := New(nil, &config.Config{})
+	for _, c := range []struct{ path, res string }{
+		{"example.com/main/main.go", filepath.Join(dir, "main", "main.go")},
+		{"example.com/main/sub/sub.go", filepath.Join(dir, "main", "sub", "sub.go")},
+		{"example.com/lib/lib.go", filepath.Join(dir, "lib", "lib.go")},
+		{"example.com/Dep@v1.0.0/dep.go", filepath.Join(dir, "mod", "example.com", "!dep@v1.0.0", "dep.go")},
+		{"example.com/Dep@v1.1.0/dep.go", filepath.Join(dir, "mod", "example.com", "!dep@v1.1.0", "dep.go")},
+		{"runtime/proc.go", filepath.Join(dir, "goroot", "src", "runtime", "proc.go")},
+		{"example.com/main/missing.go", "example.com/main/missing.go"},
+		{"example.com/other/other.go", "example.com/other/other.go"},
+		{"/build/main.go", "/build/main.go"},
+	} {
+		if res := term.substitutePath(c.path); res != c.res {
+			t.Errorf("substitutePath(%q) => %q, want %q", c.path, res, c.res)
+		}
+	}
+
+	mods := localModules(filepath.Join(dir, "work", "a"))
+	if len(mods) != 2 || mods["example.com/a"] != filepath.Join(dir, "work", "a") || mods["example.com/b"] != filepath.Join(dir, "work", "b") {
+		t.Errorf("wrong workspace modules %v", mods)
+	}
+}
+
 func TestIsErrProcessExited(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -96,6 +262,8 @@ func TestIsErrProcessExited(t *testing.T) {
 	}{
 		{"empty error", errors.New(""), false},
 		{"non-ServerError", errors.New("Process 33122 has exited with status 0"), false},
+		{"error code", &api.Error{Code: api.ErrCodeProcessExited, Message: "Process 33122 has exited with status 0"}, true},
+		{"other error code", &api.Error{Code: api.ErrCodeNoSuchBreakpoint, Message: "no breakpoint with id 1"}, false},
 		{"ServerError with zero status", rpc.ServerError("Process 33122 has exited with status 0"), true},
 		{"ServerError with non-zero status", rpc.ServerError("Process 2 has exited with status 25"), true},
 	}
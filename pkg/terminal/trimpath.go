@@ -0,0 +1,214 @@
+package terminal
+
+import (
+	"bufio"
+	"bytes"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/modsrc"
+)
+
+// trimmedPath maps path, a file name recorded by the go command when
+// building with -trimpath, to a local file:
+//
+//   - files of dependencies, recorded as "example.com/mod@v1.2.3/file.go",
+//     are mapped to the local module cache, even if they are not there, so
+//     that they can be fetched by modsrc
+//   - files of the main module and of the modules replaced with local
+//     directories, recorded as "example.com/mod/file.go", are mapped to
+//     the directories of the modules, found in the go.mod (and go.work)
+//     file of the current directory or of one of its parents
+//   - files of the standard library, recorded as "net/http/server.go", are
+//     mapped to the local GOROOT
+//
+// Returns an empty string if path is not a trimmed path or the file does
+// not exist locally.
+func trimmedPath(path string) (string, string) {
+	slashPath := strings.Replace(path, "\\", "/", -1)
+	if slashPath == "" || strings.HasPrefix(slashPath, "/") || filepath.IsAbs(path) || filepath.VolumeName(path) != "" || strings.HasPrefix(slashPath, ".") {
+		return "", ""
+	}
+
+	if at := strings.Index(slashPath, "@"); at > 0 {
+		slash := strings.Index(slashPath[at:], "/")
+		modcache := localModCache()
+		if slash < 0 || modcache == "" {
+			return "", ""
+		}
+		mod, version, file := slashPath[:at], slashPath[at+1:at+slash], slashPath[at+slash+1:]
+		return filepath.Join(modcache, filepath.FromSlash(modsrc.Escape(mod)+"@"+modsrc.Escape(version)), filepath.FromSlash(file)), "-trimpath: module cache"
+	}
+
+	wd, _ := os.Getwd()
+	var best, bestDir string
+	for mod, dir := range localModules(wd) {
+		if strings.HasPrefix(slashPath, mod+"/") && len(mod) > len(best) {
+			best, bestDir = mod, dir
+		}
+	}
+	if best != "" {
+		if local := filepath.Join(bestDir, filepath.FromSlash(slashPath[len(best)+1:])); fileExists(local) {
+			return local, "-trimpath: module " + best
+		}
+	}
+
+	if first := strings.SplitN(slashPath, "/", 2)[0]; !strings.Contains(first, ".") {
+		goroot := os.Getenv("GOROOT")
+		if goroot == "" {
+			goroot = build.Default.GOROOT
+		}
+		if local := filepath.Join(goroot, "src", filepath.FromSlash(slashPath)); goroot != "" && fileExists(local) {
+			return local, "-trimpath: GOROOT"
+		}
+	}
+	return "", ""
+}
+
+// localModules returns the directories of the modules that the go command
+// would use when building in dir: the main module, whose go.mod file is in
+// dir or in the nearest parent directory containing one, and the modules
+// it replaces with local directories. If there is a go.work file in dir or
+// one of its parents it is used instead, with the modules used by the
+// workspace.
+func localModules(dir string) map[string]string {
+	r := make(map[string]string)
+	if dir == "" {
+		return r
+	}
+	for d := dir; ; {
+		if data, err := ioutil.ReadFile(filepath.Join(d, "go.work")); err == nil {
+			uses, replaces := parseModFile(data)
+			for _, use := range uses {
+				use = localModDir(d, use)
+				if data, err := ioutil.ReadFile(filepath.Join(use, "go.mod")); err == nil {
+					addModule(r, use, data)
+				}
+			}
+			addReplaces(r, d, replaces)
+			return r
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	for d := dir; ; {
+		if data, err := ioutil.ReadFile(filepath.Join(d, "go.mod")); err == nil {
+			addModule(r, d, data)
+			return r
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	return r
+}
+
+// addModule adds to r the module whose go.mod file, in dir, has contents
+// data, and the modules it replaces with local directories.
+func addModule(r map[string]string, dir string, data []byte) {
+	module, replaces := parseModFile(data)
+	if len(module) > 0 {
+		r[module[0]] = dir
+	}
+	addReplaces(r, dir, replaces)
+}
+
+func addReplaces(r map[string]string, dir string, replaces map[string]string) {
+	for mod, repl := range replaces {
+		r[mod] = localModDir(dir, repl)
+	}
+}
+
+func localModDir(dir, path string) string {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// parseModFile parses the module (or use, for go.work files) directives and
+// the replace directives of a go.mod or go.work file, returning the
+// arguments of the first and the local directories of the replacements,
+// indexed by the replaced module path.
+func parseModFile(data []byte) ([]string, map[string]string) {
+	var modules []string
+	replaces := make(map[string]string)
+	block := ""
+	scan := bufio.NewScanner(bytes.NewReader(data))
+	for scan.Scan() {
+		line := scan.Text()
+		if comment := strings.Index(line, "//"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := modFields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		switch fields[0] {
+		case "module", "use":
+			if len(fields) >= 2 {
+				modules = append(modules, fields[1])
+			}
+		case "replace":
+			// replace mod [version] => path [version]
+			for i := range fields {
+				if fields[i] == "=>" && i+1 < len(fields) && i >= 2 {
+					repl := fields[i+1]
+					if strings.HasPrefix(repl, "./") || strings.HasPrefix(repl, "../") || strings.HasPrefix(repl, ".\\") || strings.HasPrefix(repl, "..\\") || filepath.IsAbs(repl) || strings.HasPrefix(repl, "/") {
+						replaces[fields[1]] = repl
+					}
+					break
+				}
+			}
+		}
+	}
+	return modules, replaces
+}
+
+// modFields splits a line of a go.mod file into its tokens, unquoting
+// quoted strings.
+func modFields(line string) []string {
+	var r []string
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] == '"' || line[0] == '`' {
+			end := strings.IndexByte(line[1:], line[0])
+			if end < 0 {
+				return r
+			}
+			s, err := strconv.Unquote(line[:end+2])
+			if err != nil {
+				return r
+			}
+			r = append(r, s)
+			line = line[end+2:]
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		r = append(r, line[:end])
+		line = line[end:]
+	}
+	return r
+}
@@ -0,0 +1,400 @@
+// Package wsl debugs executables on the other side of the Windows Subsystem
+// for Linux: windows executables from a dlv running in a WSL distribution
+// and linux executables from a dlv running on windows. A headless instance
+// of Delve is started on the other side, using the interoperability of WSL,
+// and its port is reachable from this side.
+package wsl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/go-delve/delve/pkg/config"
+)
+
+// MountRoot is the directory where WSL mounts the drives of windows.
+const MountRoot = "/mnt/"
+
+// startTimeout is how long Launch waits for the headless instance of Delve
+// to start.
+const startTimeout = time.Minute
+
+// Options describes the executable to debug on the other side.
+type Options struct {
+	// Dlv is the dlv executable on the other side, dlv.exe or dlv in the
+	// PATH of the other side if empty.
+	Dlv string
+	// Distro is the WSL distribution, used when running on windows, the
+	// default distribution if empty.
+	Distro string
+	// Exe is the path of the executable, on this side, and Args are its
+	// arguments.
+	Exe  string
+	Args []string
+	// WorkingDir is the working directory of the executable, on this side,
+	// the working directory of the headless instance of Delve if empty.
+	WorkingDir string
+	// DlvArgs are additional arguments of dlv exec, for example "--continue".
+	DlvArgs []string
+	// Output receives the output of the headless instance of Delve and of
+	// the executable, os.Stderr if nil.
+	Output io.Writer
+}
+
+// Session is a headless instance of Delve running on the other side.
+type Session struct {
+	// Addr is the address of the headless instance of Delve, reachable
+	// from this side.
+	Addr string
+	// SubstitutePath are the rules translating the paths of the source
+	// files of the other side to this side.
+	SubstitutePath config.SubstitutePathRules
+
+	dlv *exec.Cmd
+}
+
+// Inside returns true if the calling process is running in a WSL
+// distribution.
+func Inside() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if _, err := os.Stat("/proc/sys/fs/binfmt_misc/WSLInterop"); err == nil {
+		return true
+	}
+	return Version() != 0
+}
+
+// Version returns the version of WSL, 1 or 2, the calling process is
+// running in, 0 if it is not running in a WSL distribution.
+func Version() int {
+	buf, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return 0
+	}
+	release := strings.ToLower(string(buf))
+	switch {
+	case strings.Contains(release, "microsoft-standard") || strings.Contains(release, "wsl2"):
+		return 2
+	case strings.Contains(release, "microsoft"):
+		return 1
+	}
+	return 0
+}
+
+// WindowsPath translates path, an absolute path of the WSL distribution
+// distro, to the corresponding windows path: the paths of the drives
+// mounted in MountRoot to the paths of the drives and the other paths to
+// paths of the \\wsl$ share of the distribution.
+func WindowsPath(path, distro string) (string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("%q is not an absolute path", path)
+	}
+	if rest := strings.TrimPrefix(path, MountRoot); len(rest) > 0 && rest != path && isDrive(rest[0]) && (len(rest) == 1 || rest[1] == '/') {
+		return strings.ToUpper(rest[:1]) + `:\` + strings.Replace(strings.TrimPrefix(rest[1:], "/"), "/", `\`, -1), nil
+	}
+	if distro == "" {
+		return "", fmt.Errorf("can not translate %q without the name of the WSL distribution", path)
+	}
+	return `\\wsl$\` + distro + strings.Replace(path, "/", `\`, -1), nil
+}
+
+// LinuxPath translates path, an absolute windows path, to the
+// corresponding path in a WSL distribution: the paths of the drives to
+// the paths of the drives mounted in MountRoot and the paths of the
+// \\wsl$ (or \\wsl.localhost) share of the distribution to the paths of
+// the distribution.
+func LinuxPath(path string) (string, error) {
+	slashPath := strings.Replace(path, `\`, "/", -1)
+	if len(slashPath) >= 2 && isDrive(slashPath[0]) && slashPath[1] == ':' {
+		return MountRoot + strings.ToLower(slashPath[:1]) + slashPath[2:], nil
+	}
+	for _, share := range []string{"//wsl$/", "//wsl.localhost/"} {
+		if len(slashPath) > len(share) && strings.EqualFold(slashPath[:len(share)], share) {
+			rest := slashPath[len(share):]
+			if slash := strings.Index(rest, "/"); slash >= 0 {
+				return rest[slash:], nil
+			}
+			return "/", nil
+		}
+	}
+	return "", fmt.Errorf("can not translate %q to a path of the WSL distribution", path)
+}
+
+func isDrive(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// substitutePath returns the rules translating the paths of the other
+// side to this side, drives are the letters of the drives of windows and
+// distro is the WSL distribution.
+func substitutePath(goos string, drives []byte, distro string) config.SubstitutePathRules {
+	var rules config.SubstitutePathRules
+	switch goos {
+	case "linux":
+		// debugging windows executables, the paths recorded by the windows
+		// go command use forward slashes
+		for _, drive := range drives {
+			to := MountRoot + strings.ToLower(string(drive)) + "/"
+			rules = append(rules,
+				config.SubstitutePathRule{From: strings.ToUpper(string(drive)) + ":/", To: to},
+				config.SubstitutePathRule{From: strings.ToLower(string(drive)) + ":/", To: to})
+		}
+		if distro != "" {
+			rules = append(rules,
+				config.SubstitutePathRule{From: "//wsl$/" + distro + "/", To: "/"},
+				config.SubstitutePathRule{From: "//wsl.localhost/" + distro + "/", To: "/"})
+		}
+	case "windows":
+		// debugging linux executables
+		for _, drive := range drives {
+			rules = append(rules, config.SubstitutePathRule{From: MountRoot + strings.ToLower(string(drive)) + "/", To: strings.ToUpper(string(drive)) + ":/"})
+		}
+		if distro != "" {
+			rules = append(rules, config.SubstitutePathRule{From: "/", To: "//wsl$/" + distro + "/"})
+		}
+	}
+	return rules
+}
+
+// drives returns the letters of the drives of windows.
+func drives() []byte {
+	var r []byte
+	if runtime.GOOS == "windows" {
+		for c := byte('A'); c <= 'Z'; c++ {
+			if _, err := os.Stat(string(c) + `:\`); err == nil {
+				r = append(r, c)
+			}
+		}
+		return r
+	}
+	fis, _ := ioutil.ReadDir(MountRoot)
+	for _, fi := range fis {
+		if name := fi.Name(); fi.IsDir() && len(name) == 1 && isDrive(name[0]) {
+			r = append(r, name[0])
+		}
+	}
+	return r
+}
+
+// windowsHost returns the addresses of windows, from the WSL distribution,
+// that the headless instance of Delve can listen at: with WSL2 the
+// distribution runs in a virtual machine that reaches windows through its
+// default gateway, unless the networking of WSL is mirrored.
+func windowsHost() []string {
+	if Version() != 2 {
+		return []string{"127.0.0.1"}
+	}
+	if gw := defaultGateway(); gw != "" {
+		return []string{gw, "127.0.0.1"}
+	}
+	return []string{"127.0.0.1"}
+}
+
+// defaultGateway returns the default gateway, read from /proc/net/route.
+func defaultGateway() string {
+	buf, err := ioutil.ReadFile("/proc/net/route")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(buf), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gw, err := hex.DecodeString(fields[2])
+		if err != nil || len(gw) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(gw))
+		return ip.String()
+	}
+	return ""
+}
+
+// dlvArgs returns the arguments of the headless instance of Delve,
+// listening at host, exe and wd are paths on the other side.
+func (opts *Options) dlvArgs(host, exe, wd string) []string {
+	args := []string{"exec", exe, "--headless", "--accept-multiclient", "--api-version=2", "--listen=" + host + ":0"}
+	if wd != "" {
+		args = append(args, "--wd", wd)
+	}
+	args = append(args, opts.DlvArgs...)
+	if len(opts.Args) > 0 {
+		args = append(append(args, "--"), opts.Args...)
+	}
+	return args
+}
+
+// command returns the command starting the headless instance of Delve,
+// listening at host, on the other side.
+func (opts *Options) command(host string) (*exec.Cmd, error) {
+	exe, err := filepath.Abs(opts.Exe)
+	if err != nil {
+		return nil, err
+	}
+	wd := opts.WorkingDir
+	if wd != "" {
+		if wd, err = filepath.Abs(wd); err != nil {
+			return nil, err
+		}
+	}
+	dlv := opts.Dlv
+	if runtime.GOOS == "windows" {
+		if exe, err = LinuxPath(exe); err != nil {
+			return nil, err
+		}
+		if wd != "" {
+			if wd, err = LinuxPath(wd); err != nil {
+				return nil, err
+			}
+		}
+		if dlv == "" {
+			dlv = "dlv"
+		}
+		var args []string
+		if opts.Distro != "" {
+			args = append(args, "-d", opts.Distro)
+		}
+		args = append(append(args, "--", dlv), opts.dlvArgs(host, exe, wd)...)
+		return exec.Command("wsl.exe", args...), nil
+	}
+	distro := os.Getenv("WSL_DISTRO_NAME")
+	if exe, err = WindowsPath(exe, distro); err != nil {
+		return nil, err
+	}
+	if wd != "" {
+		if wd, err = WindowsPath(wd, distro); err != nil {
+			return nil, err
+		}
+	}
+	if dlv == "" {
+		dlv = "dlv.exe"
+	}
+	return exec.Command(dlv, opts.dlvArgs(host, exe, wd)...), nil
+}
+
+// distro returns the name of the distribution of the headless instance of
+// Delve.
+func (opts *Options) distro() string {
+	if runtime.GOOS != "windows" {
+		return os.Getenv("WSL_DISTRO_NAME")
+	}
+	if opts.Distro != "" {
+		return opts.Distro
+	}
+	out, err := exec.Command("wsl.exe", "-e", "printenv", "WSL_DISTRO_NAME").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// ErrNotWSL is returned by Launch when it is not running in a WSL
+// distribution or on windows.
+var ErrNotWSL = errors.New("not running in a WSL distribution or on windows")
+
+// Launch starts a headless instance of Delve executing the executable
+// described by opts on the other side.
+func Launch(opts *Options) (*Session, error) {
+	hosts := []string{"127.0.0.1"}
+	switch {
+	case runtime.GOOS == "windows":
+		if _, err := exec.LookPath("wsl.exe"); err != nil {
+			return nil, fmt.Errorf("could not find wsl.exe, is WSL installed? %v", err)
+		}
+	case Inside():
+		hosts = windowsHost()
+	default:
+		return nil, ErrNotWSL
+	}
+	output := opts.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	var err error
+	for _, host := range hosts {
+		s := &Session{}
+		if s.dlv, err = opts.command(host); err != nil {
+			return nil, err
+		}
+		var m []string
+		m, err = start(s.dlv, output, regexp.MustCompile(`^API server listening at: (\S+)`))
+		if err != nil {
+			continue
+		}
+		s.Addr = m[1]
+		s.SubstitutePath = substitutePath(runtime.GOOS, drives(), opts.distro())
+		return s, nil
+	}
+	return nil, fmt.Errorf("could not start delve on the other side of WSL: %v", err)
+}
+
+// start starts cmd and waits for it to write a line matching rx to its
+// standard output, returning the submatches. The other lines are copied to
+// output, along with the standard error of cmd.
+func start(cmd *exec.Cmd, output io.Writer, rx *regexp.Regexp) ([]string, error) {
+	cmd.Stderr = output
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	found := make(chan []string, 1)
+	go func() {
+		defer io.Copy(ioutil.Discard, stdout)
+		scan := bufio.NewScanner(stdout)
+		matched := false
+		for scan.Scan() {
+			line := scan.Text()
+			if m := rx.FindStringSubmatch(line); m != nil && !matched {
+				matched = true
+				found <- m
+				continue
+			}
+			fmt.Fprintln(output, line)
+		}
+		if !matched {
+			close(found)
+		}
+	}()
+	select {
+	case m, ok := <-found:
+		if !ok {
+			cmd.Wait()
+			return nil, errors.New("dlv exited")
+		}
+		return m, nil
+	case <-time.After(startTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, errors.New("timed out")
+	}
+}
+
+// Close stops the headless instance of Delve.
+func (s *Session) Close() error {
+	if s.dlv == nil || s.dlv.Process == nil {
+		return nil
+	}
+	s.dlv.Process.Kill()
+	s.dlv.Wait()
+	return nil
+}
@@ -0,0 +1,89 @@
+package wsl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-delve/delve/pkg/config"
+)
+
+func TestWindowsPath(t *testing.T) {
+	for _, tc := range []struct {
+		path, distro, expected string
+	}{
+		{"/mnt/c/Users/me/app.exe", "", `C:\Users\me\app.exe`},
+		{"/mnt/d", "", `D:\`},
+		{"/home/me/app.exe", "Ubuntu", `\\wsl$\Ubuntu\home\me\app.exe`},
+		{"/mnt/data/app.exe", "Ubuntu", `\\wsl$\Ubuntu\mnt\data\app.exe`},
+		{"/home/me/app.exe", "", ""},
+		{"app.exe", "Ubuntu", ""},
+	} {
+		got, err := WindowsPath(tc.path, tc.distro)
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", tc.path, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.expected {
+			t.Errorf("%q: got %q %v, expected %q", tc.path, got, err, tc.expected)
+		}
+	}
+}
+
+func TestLinuxPath(t *testing.T) {
+	for _, tc := range []struct {
+		path, expected string
+	}{
+		{`C:\Users\me\app`, "/mnt/c/Users/me/app"},
+		{`d:/src`, "/mnt/d/src"},
+		{`\\wsl$\Ubuntu\home\me\app`, "/home/me/app"},
+		{`\\wsl.localhost\Ubuntu\home\me\app`, "/home/me/app"},
+		{`\\wsl$\Ubuntu`, "/"},
+		{`\\server\share\app`, ""},
+	} {
+		got, err := LinuxPath(tc.path)
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", tc.path, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.expected {
+			t.Errorf("%q: got %q %v, expected %q", tc.path, got, err, tc.expected)
+		}
+	}
+}
+
+func TestSubstitutePath(t *testing.T) {
+	rules := substitutePath("linux", []byte("c"), "Ubuntu")
+	expected := config.SubstitutePathRules{
+		{From: "C:/", To: "/mnt/c/"},
+		{From: "c:/", To: "/mnt/c/"},
+		{From: "//wsl$/Ubuntu/", To: "/"},
+		{From: "//wsl.localhost/Ubuntu/", To: "/"},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("got %v, expected %v", rules, expected)
+	}
+
+	rules = substitutePath("windows", []byte("CD"), "Ubuntu")
+	expected = config.SubstitutePathRules{
+		{From: "/mnt/c/", To: "C:/"},
+		{From: "/mnt/d/", To: "D:/"},
+		{From: "/", To: "//wsl$/Ubuntu/"},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("got %v, expected %v", rules, expected)
+	}
+}
+
+func TestDlvArgs(t *testing.T) {
+	opts := &Options{Args: []string{"-v", "input"}, DlvArgs: []string{"--continue"}}
+	got := strings.Join(opts.dlvArgs("172.20.0.1", `C:\src\app.exe`, `C:\src`), " ")
+	expected := `exec C:\src\app.exe --headless --accept-multiclient --api-version=2 --listen=172.20.0.1:0 --wd C:\src --continue -- -v input`
+	if got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"go/token"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/go-delve/delve/pkg/dwarf/godwarf"
 	"github.com/go-delve/delve/pkg/dwarf/op"
@@ -29,11 +30,15 @@ func ConvertBreakpoint(bp *proc.Breakpoint) *Breakpoint {
 		Stacktrace:    bp.Stacktrace,
 		Goroutine:     bp.Goroutine,
 		Variables:     bp.Variables,
+		Sample:        bp.Sample,
+		ErrorReturn:   bp.ErrorReturn,
+		AtExit:        bp.AtExit,
 		LoadArgs:      LoadConfigFromProc(bp.LoadArgs),
 		LoadLocals:    LoadConfigFromProc(bp.LoadLocals),
 		TotalHitCount: bp.TotalHitCount,
 		Addrs:         []uint64{bp.Addr},
 	}
+	b.StackContains, b.StackContainsDepth = bp.StackContains, bp.StackContainsDepth
 
 	b.HitCount = map[string]uint64{}
 	for idx := range bp.HitCount {
@@ -44,9 +49,27 @@ func ConvertBreakpoint(bp *proc.Breakpoint) *Breakpoint {
 	printer.Fprint(&buf, token.NewFileSet(), bp.Cond)
 	b.Cond = buf.String()
 
+	addBreakpointStats(b, bp)
+
 	return b
 }
 
+func addBreakpointStats(b *Breakpoint, bp *proc.Breakpoint) {
+	if bp.Stats.CondEvals == 0 {
+		return
+	}
+	if b.Stats == nil {
+		b.Stats = &BreakpointStats{}
+	}
+	b.Stats.CondEvals += bp.Stats.CondEvals
+	b.Stats.CondTime += bp.Stats.CondTime
+	b.Stats.FalseHits += bp.Stats.FalseHits
+	if bp.Stats.MaxRate > b.Stats.MaxRate {
+		b.Stats.MaxRate = bp.Stats.MaxRate
+		b.Stats.Hot = bp.Stats.Hot()
+	}
+}
+
 // ConvertBreakpoints converts a slice of physical breakpoints into a slice
 // of logical breakpoints.
 // The input must be sorted by increasing LogicalID
@@ -59,6 +82,7 @@ func ConvertBreakpoints(bps []*proc.Breakpoint) []*Breakpoint {
 		if len(r) > 0 {
 			if r[len(r)-1].ID == bp.LogicalID {
 				r[len(r)-1].Addrs = append(r[len(r)-1].Addrs, bp.Addr)
+				addBreakpointStats(r[len(r)-1], bp)
 				continue
 			} else if r[len(r)-1].ID > bp.LogicalID {
 				panic("input not sorted")
@@ -97,6 +121,7 @@ func ConvertThread(th proc.Thread) *Thread {
 	if g, _ := proc.GetG(th); g != nil {
 		gid = g.ID
 	}
+	m, p := proc.ThreadMP(th)
 
 	return &Thread{
 		ID:          th.ThreadID(),
@@ -105,10 +130,96 @@ func ConvertThread(th proc.Thread) *Thread {
 		Line:        line,
 		Function:    function,
 		GoroutineID: gid,
+		M:           m,
+		P:           p,
 		Breakpoint:  bp,
+		Syscall:     ConvertSyscallEvent(th, proc.ThreadSyscallEvent(th)),
+	}
+}
+
+// ConvertSyscallEvent converts ev, the system call th stopped at, to an
+// api.SyscallEvent, reading its arguments from the memory of th.
+func ConvertSyscallEvent(th proc.Thread, ev *proc.SyscallEvent) *SyscallEvent {
+	if ev == nil {
+		return nil
+	}
+	return &SyscallEvent{
+		Name:   ev.Name,
+		Number: ev.Number,
+		Exit:   ev.Exit,
+		Args:   proc.FormatSyscallArgs(th, ev),
+		Ret:    proc.FormatSyscallRet(ev),
+	}
+}
+
+// ConvertContext converts c, a context in the chain of a context.Context,
+// to an api.Context.
+func ConvertContext(c *proc.Context) Context {
+	r := Context{
+		Type:        c.Type,
+		Addr:        c.Addr,
+		Cancellable: c.Cancellable,
+		Waiters:     c.Waiters,
+	}
+	if c.Key != nil {
+		r.Key = ConvertVar(c.Key)
+	}
+	if c.Value != nil {
+		r.Value = ConvertVar(c.Value)
+	}
+	if !c.Deadline.IsZero() {
+		r.Deadline = c.Deadline.Format(time.RFC3339Nano)
+	}
+	if c.Err != nil {
+		r.Err = ConvertVar(c.Err)
+	}
+	return r
+}
+
+// ConvertWorkerGroup converts wg to an api.WorkerGroup.
+func ConvertWorkerGroup(wg *proc.WorkerGroup) *WorkerGroup {
+	r := &WorkerGroup{
+		Kind:    wg.Kind,
+		Workers: make([]Worker, len(wg.Workers)),
+		Limit:   wg.Limit,
+		Active:  wg.Active,
+	}
+	for i, w := range wg.Workers {
+		r.Workers[i] = Worker{Goroutine: ConvertGoroutine(w.G), Role: w.Role, Func: w.Func}
+	}
+	if wg.Err != nil {
+		r.Err = ConvertVar(wg.Err)
+	}
+	return r
+}
+
+// ConvertTimer converts a timer of the runtime to an api.Timer.
+func ConvertTimer(t *proc.Timer) Timer {
+	return Timer{
+		Addr:     t.Addr,
+		When:     t.When,
+		Period:   t.Period,
+		Kind:     t.Kind,
+		Func:     t.Func,
+		Callback: t.Callback,
+		Waiters:  t.Waiters,
+		P:        t.P,
 	}
 }
 
+// ConvertFinalizerState converts the state of the finalizers of the target
+// to an api.FinalizerState.
+func ConvertFinalizerState(fs *proc.FinalizerState) *FinalizerState {
+	r := &FinalizerState{Finalizers: make([]Finalizer, len(fs.Finalizers)), Running: fs.Running}
+	for i, f := range fs.Finalizers {
+		r.Finalizers[i] = Finalizer{Obj: f.Obj, Type: f.Type, Func: f.Func, Cleanup: f.Cleanup, Queued: f.Queued}
+	}
+	if fs.G != nil {
+		r.Goroutine = ConvertGoroutine(fs.G)
+	}
+	return r
+}
+
 func prettyTypeName(typ godwarf.Type) string {
 	if typ == nil {
 		return ""
@@ -227,6 +338,8 @@ func ConvertVar(v *proc.Variable) *Variable {
 		}
 	}
 
+	r.Truncated = limitTruncation(&r)
+
 	return &r
 }
 
@@ -258,15 +371,20 @@ func ConvertGoroutine(g *proc.G) *Goroutine {
 		tid = th.ThreadID()
 	}
 	if g.Unreadable != nil {
-		return &Goroutine{Unreadable: g.Unreadable.Error()}
+		return &Goroutine{Unreadable: g.Unreadable.Error(), M: -1, P: -1}
 	}
+	m, p := g.MP()
 	return &Goroutine{
 		ID:             g.ID,
+		Name:           g.Name,
 		CurrentLoc:     ConvertLocation(g.CurrentLoc),
 		UserCurrentLoc: ConvertLocation(g.UserCurrent()),
 		GoStatementLoc: ConvertLocation(g.Go()),
 		StartLoc:       ConvertLocation(g.StartLoc()),
 		ThreadID:       tid,
+		M:              m,
+		P:              p,
+		Status:         g.Status,
 		Labels:         g.Labels(),
 	}
 }
@@ -355,3 +473,8 @@ func ConvertCheckpoint(in proc.Checkpoint) (out Checkpoint) {
 func ConvertImage(image *proc.Image) Image {
 	return Image{Path: image.Path, Address: image.StaticBase}
 }
+
+// ConvertCapability converts proc.Capability to api.Capability.
+func ConvertCapability(c proc.Capability) Capability {
+	return Capability{Feature: string(c.Feature), Available: c.Available, Reason: c.Reason}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"go/scanner"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// ErrorCode identifies the kind of an error returned by the server, so
+// that clients can handle it without matching its message, which is meant
+// for the user and may change.
+type ErrorCode string
+
+// Error codes returned by the server. Errors of other kinds have no code.
+const (
+	// ErrCodeProcessExited is returned when the target process exited.
+	ErrCodeProcessExited ErrorCode = "ProcessExited"
+	// ErrCodeProcessDetached is returned when the debugger detached from
+	// the target process.
+	ErrCodeProcessDetached ErrorCode = "ProcessDetached"
+	// ErrCodeNoSuchBreakpoint is returned when the breakpoint of a request
+	// does not exist.
+	ErrCodeNoSuchBreakpoint ErrorCode = "NoSuchBreakpoint"
+	// ErrCodeBreakpointExists is returned when creating a breakpoint at the
+	// address of an existing one.
+	ErrCodeBreakpointExists ErrorCode = "BreakpointExists"
+	// ErrCodeExpressionParse is returned when an expression, or the
+	// condition of a breakpoint, is not valid Go syntax.
+	ErrCodeExpressionParse ErrorCode = "ExpressionParseError"
+	// ErrCodeUnsupportedOnArch is returned when the architecture of the
+	// target is not supported, or an operation is not implemented for it.
+	ErrCodeUnsupportedOnArch ErrorCode = "UnsupportedOnArch"
+	// ErrCodeFeatureUnavailable is returned when an operation needs a
+	// feature that is not available for the target program, see
+	// GetCapabilities.
+	ErrCodeFeatureUnavailable ErrorCode = "FeatureUnavailable"
+	// ErrCodeInternal is returned when the debugger panics or finds an
+	// inconsistency in its own state, which indicates a bug of Delve.
+	ErrCodeInternal ErrorCode = "InternalError"
+)
+
+// Error is an error returned by the server along with its code.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	// Err is the error wrapped by Error, if any. The errors with a code
+	// returned by rpc2.RPCClient wrap the rpc.ServerError returned by
+	// net/rpc.
+	Err error
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+// Unwrap returns the error wrapped by err.
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Errorf returns an error with code and a message formatted like
+// fmt.Sprintf.
+func Errorf(code ErrorCode, format string, args ...interface{}) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorCodeOf returns the code of err, or of the errors it wraps, or the
+// empty string if err has no code.
+func ErrorCodeOf(err error) ErrorCode {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	if errors.Is(err, proc.ErrProcessDetached) {
+		return ErrCodeProcessDetached
+	}
+	codes := []struct {
+		target interface{}
+		code   ErrorCode
+	}{
+		{new(proc.ErrProcessExited), ErrCodeProcessExited},
+		{new(*proc.ErrProcessExited), ErrCodeProcessExited},
+		{new(proc.NoBreakpointError), ErrCodeNoSuchBreakpoint},
+		{new(*proc.NoBreakpointError), ErrCodeNoSuchBreakpoint},
+		{new(proc.BreakpointExistsError), ErrCodeBreakpointExists},
+		{new(*proc.BreakpointExistsError), ErrCodeBreakpointExists},
+		{new(scanner.ErrorList), ErrCodeExpressionParse},
+		{new(*scanner.Error), ErrCodeExpressionParse},
+		{new(*proc.ErrUnsupportedArch), ErrCodeUnsupportedOnArch},
+		{new(*proc.ErrUnsupportedOnArch), ErrCodeUnsupportedOnArch},
+		{new(*proc.ErrFeatureUnavailable), ErrCodeFeatureUnavailable},
+		{new(*proc.ErrInternal), ErrCodeInternal},
+	}
+	for _, c := range codes {
+		if errors.As(err, c.target) {
+			return c.code
+		}
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"go/parser"
+	"net/rpc"
+	"testing"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+func TestErrorCodeOf(t *testing.T) {
+	_, parseErr := parser.ParseExpr("1 +")
+	tests := []struct {
+		err  error
+		code ErrorCode
+	}{
+		{errors.New("some error"), ""},
+		{Errorf(ErrCodeNoSuchBreakpoint, "no breakpoint with id %d", 1), ErrCodeNoSuchBreakpoint},
+		{proc.ErrProcessExited{Pid: 1, Status: 2}, ErrCodeProcessExited},
+		{proc.ErrProcessDetached, ErrCodeProcessDetached},
+		{proc.BreakpointExistsError{File: "main.go", Line: 1}, ErrCodeBreakpointExists},
+		{proc.NoBreakpointError{Addr: 0x100}, ErrCodeNoSuchBreakpoint},
+		{parseErr, ErrCodeExpressionParse},
+		{&proc.ErrUnsupportedOnArch{Operation: "function calls", Arch: "arm64"}, ErrCodeUnsupportedOnArch},
+		{fmt.Errorf("could not continue: %w", proc.ErrProcessExited{Pid: 1}), ErrCodeProcessExited},
+		{fmt.Errorf("could not detach: %w", proc.ErrProcessDetached), ErrCodeProcessDetached},
+		{&Error{Code: ErrCodeInternal, Message: "internal error", Err: rpc.ServerError("internal error")}, ErrCodeInternal},
+	}
+	for _, test := range tests {
+		if code := ErrorCodeOf(test.err); code != test.code {
+			t.Errorf("wrong code for %v: %q, expected %q", test.err, code, test.code)
+		}
+	}
+
+	var serr rpc.ServerError
+	if err := tests[len(tests)-1].err; !errors.As(err, &serr) || serr != "internal error" {
+		t.Errorf("rpc.ServerError not wrapped by %#v", err)
+	}
+}
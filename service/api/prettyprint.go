@@ -108,16 +108,22 @@ func (v *Variable) writeTo(buf io.Writer, top, newlines, includeType bool, inden
 				fmt.Fprint(buf, "...")
 			} else if data.Children[0].Addr == 0 {
 				fmt.Fprint(buf, "nil")
-			} else if data.Children[0].OnlyAddr {
+			} else if data.Children[0].OnlyAddr && includeType {
 				fmt.Fprintf(buf, "0x%x", v.Children[0].Addr)
 			} else {
+				// when the type of the interface is not printed the dynamic type
+				// is printed along with the value
 				v.Children[0].writeTo(buf, false, newlines, !includeType, indent)
 			}
 		} else if data.OnlyAddr {
-			if strings.Contains(v.Type, "/") {
-				fmt.Fprintf(buf, "*(*%q)(%#x)", v.Type, v.Addr)
+			typ, addr := v.Type, v.Addr
+			if !includeType {
+				typ, addr = data.Type, data.Addr
+			}
+			if strings.Contains(typ, "/") {
+				fmt.Fprintf(buf, "*(*%q)(%#x)", typ, addr)
 			} else {
-				fmt.Fprintf(buf, "*(*%s)(%#x)", v.Type, v.Addr)
+				fmt.Fprintf(buf, "*(*%s)(%#x)", typ, addr)
 			}
 		} else {
 			v.Children[0].writeTo(buf, false, newlines, !includeType, indent)
@@ -361,6 +367,14 @@ func (v *Variable) writeSliceOrArrayTo(buf io.Writer, newlines bool, indent stri
 }
 
 func PrettyExamineMemory(address uintptr, memArea []byte, format byte) string {
+	return PrettyExamineMemoryFunc(address, memArea, format, nil)
+}
+
+// PrettyExamineMemoryFunc formats memArea like PrettyExamineMemory, the
+// formatted value of the byte at offset i of memArea is replaced with
+// decorate(i, value), for example to highlight it. To keep the columns
+// aligned decorate must add the same number of characters to every byte.
+func PrettyExamineMemoryFunc(address uintptr, memArea []byte, format byte, decorate func(i int, value string) string) string {
 
 	var (
 		cols      int
@@ -387,7 +401,6 @@ func PrettyExamineMemory(address uintptr, memArea []byte, format byte) string {
 	default:
 		return fmt.Sprintf("not supprted format %q\n", string(format))
 	}
-	colFormat += "\t"
 
 	l := len(memArea)
 	rows := l / cols
@@ -406,7 +419,11 @@ func PrettyExamineMemory(address uintptr, memArea []byte, format byte) string {
 	for i := 0; i < rows; i++ {
 		fmt.Fprintf(w, addrFmt, address)
 		for j := 0; j < cols && i*cols+j < l; j++ {
-			fmt.Fprintf(w, colFormat, memArea[i*cols+j])
+			value := fmt.Sprintf(colFormat, memArea[i*cols+j])
+			if decorate != nil {
+				value = decorate(i*cols+j, value)
+			}
+			fmt.Fprintf(w, "%s\t", value)
 		}
 		fmt.Fprintln(w, "")
 		address += uintptr(cols)
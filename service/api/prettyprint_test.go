@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -32,3 +33,40 @@ func TestPrettyExamineMemory(t *testing.T) {
 		}
 	}
 }
+
+func TestPrettyExamineMemoryFunc(t *testing.T) {
+	memArea := []byte{1, 2, 3}
+	res := PrettyExamineMemoryFunc(0x10, memArea, 'x', func(i int, value string) string {
+		if i == 1 {
+			return "[" + value + "]"
+		}
+		return " " + value + " "
+	})
+	if expected := "0x10:    0x01    [0x02]    0x03    \n"; res != expected {
+		t.Errorf("wrong output, expected %q got %q", expected, res)
+	}
+}
+
+func TestPrettyInterfaceElements(t *testing.T) {
+	ptrElem := Variable{Type: "error", Kind: reflect.Interface, Addr: 0xc000010000, Children: []Variable{
+		{Type: "*main.astruct", Kind: reflect.Ptr, Addr: 0xc000010008, Children: []Variable{
+			{Type: "main.astruct", Kind: reflect.Struct, Addr: 0xc000020000, OnlyAddr: true},
+		}},
+	}}
+	structElem := Variable{Type: "interface {}", Kind: reflect.Interface, Addr: 0xc000010010, Children: []Variable{
+		{Type: "main.astruct", Kind: reflect.Struct, Addr: 0xc000030000, OnlyAddr: true},
+	}}
+	stringElem := Variable{Type: "interface {}", Kind: reflect.Interface, Addr: 0xc000010020, Children: []Variable{
+		{Type: "string", Kind: reflect.String, Addr: 0xc000040000, Value: "test", Len: 4},
+	}}
+	slice := Variable{Type: "[]interface {}", Kind: reflect.Slice, Len: 3, Cap: 3, Children: []Variable{ptrElem, structElem, stringElem}}
+
+	expected := `[]interface {} len: 3, cap: 3, [(*main.astruct)(0xc000020000),*(*main.astruct)(0xc000030000),"test"]`
+	if out := slice.SinglelineString(); out != expected {
+		t.Errorf("wrong output for slice of interfaces:\n%s\nexpected:\n%s", out, expected)
+	}
+	expected = `error(*main.astruct) 0xc000010008`
+	if out := ptrElem.SinglelineString(); out != expected {
+		t.Errorf("wrong output for interface:\n%s\nexpected:\n%s", out, expected)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// variableOverhead is the approximate size of the JSON encoding of a
+// Variable, without its strings and children.
+const variableOverhead = 180
+
+// limitTruncation returns the truncation of v caused by the limits of the
+// LoadConfig, or nil.
+func limitTruncation(v *Variable) *Truncation {
+	if v.Unreadable != "" {
+		return nil
+	}
+	var loaded int64
+	switch v.Kind {
+	case reflect.String:
+		loaded = int64(len(v.Value))
+	case reflect.Array, reflect.Slice, reflect.Struct:
+		loaded = int64(len(v.Children))
+	case reflect.Map:
+		loaded = int64(len(v.Children) / 2)
+	default:
+		// pointers and interfaces whose value was not loaded
+		if v.OnlyAddr && v.Addr != 0 {
+			return &Truncation{Reason: TruncatedLimit, More: moreExpr(v, 0)}
+		}
+		return nil
+	}
+	if v.Len <= loaded {
+		return nil
+	}
+	return &Truncation{Reason: TruncatedLimit, Loaded: loaded, More: moreExpr(v, loaded)}
+}
+
+// moreExpr returns the expression loading the part of v after the first
+// loaded elements, see Truncation.More.
+func moreExpr(v *Variable, loaded int64) string {
+	if v.Addr == 0 || v.Type == "" {
+		return ""
+	}
+	switch v.Kind {
+	case reflect.String, reflect.Array, reflect.Slice, reflect.Map:
+		return fmt.Sprintf("(*(*%q)(%#x))[%d:]", v.Type, v.Addr, loaded)
+	default:
+		return fmt.Sprintf("*(*%q)(%#x)", v.Type, v.Addr)
+	}
+}
+
+// size returns the approximate size of the JSON encoding of v, without
+// its children.
+func (v *Variable) size() int {
+	return variableOverhead + len(v.Name) + len(v.Type) + len(v.RealType) + len(v.Value) + len(v.Unreadable) + len(v.LocationExpr)
+}
+
+// TruncateVariables cuts the variables of lists so that the size of their
+// JSON encoding is approximately maxBytes, setting the Truncated field of
+// the variables that lost part of their value. Nothing is cut if maxBytes
+// is 0.
+//
+// The variables directly in lists are always kept, so that all their
+// names are returned, cutting the value of strings that do not fit.
+// Their children are then kept in breadth first order, entries of maps as
+// a whole, until the first one does not fit: all the following ones are
+// dropped, so that the same values always produce the same response.
+func TruncateVariables(maxBytes int, lists ...[]Variable) {
+	if maxBytes <= 0 {
+		return
+	}
+	budget := maxBytes
+	var queue []*Variable
+	for _, vars := range lists {
+		for i := range vars {
+			v := &vars[i]
+			if sz := v.size(); sz > budget && v.Kind == reflect.String {
+				v.cutValue(len(v.Value) - (sz - budget))
+			}
+			budget -= v.size()
+			queue = append(queue, v)
+		}
+	}
+
+	exhausted := budget < 0
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		step := 1
+		if v.Kind == reflect.Map {
+			step = 2
+		}
+		kept := 0
+		for !exhausted && kept+step <= len(v.Children) {
+			sz := 0
+			for i := kept; i < kept+step; i++ {
+				sz += v.Children[i].size()
+			}
+			if sz > budget {
+				exhausted = true
+				break
+			}
+			budget -= sz
+			kept += step
+		}
+		if kept < len(v.Children) {
+			v.Children = v.Children[:kept]
+			loaded := int64(kept / step)
+			v.Truncated = &Truncation{Reason: TruncatedBudget, Loaded: loaded, More: moreExpr(v, loaded)}
+		}
+		for i := range v.Children {
+			queue = append(queue, &v.Children[i])
+		}
+	}
+}
+
+// cutValue cuts the value of the string variable v to at most n bytes,
+// without splitting a character.
+func (v *Variable) cutValue(n int) {
+	if n < 0 {
+		n = 0
+	}
+	if n >= len(v.Value) {
+		return
+	}
+	for n > 0 && !utf8.RuneStart(v.Value[n]) {
+		n--
+	}
+	v.Value = v.Value[:n]
+	v.Truncated = &Truncation{Reason: TruncatedBudget, Loaded: int64(n), More: moreExpr(v, int64(n))}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func intSlice(name string, addr uintptr, n int) Variable {
+	v := Variable{Name: name, Addr: addr, Type: "[]int", Kind: reflect.Slice, Len: int64(n)}
+	for i := 0; i < n; i++ {
+		v.Children = append(v.Children, Variable{Type: "int", Kind: reflect.Int, Value: "1"})
+	}
+	return v
+}
+
+func TestLimitTruncation(t *testing.T) {
+	v := intSlice("s", 0xc000010000, 2)
+	v.Len = 10
+	tr := limitTruncation(&v)
+	if tr == nil || tr.Reason != TruncatedLimit || tr.Loaded != 2 || tr.More != `(*(*"[]int")(0xc000010000))[2:]` {
+		t.Errorf("wrong truncation of slice: %#v", tr)
+	}
+
+	s := Variable{Addr: 0x100, Type: "string", Kind: reflect.String, Value: "abc", Len: 3}
+	if tr := limitTruncation(&s); tr != nil {
+		t.Errorf("complete string truncated: %#v", tr)
+	}
+
+	st := Variable{Addr: 0x200, Type: "main.T", Kind: reflect.Struct, Len: 2}
+	if tr := limitTruncation(&st); tr == nil || tr.More != `*(*"main.T")(0x200)` {
+		t.Errorf("wrong truncation of struct: %#v", tr)
+	}
+}
+
+func TestTruncateVariables(t *testing.T) {
+	newVars := func() []Variable {
+		return []Variable{intSlice("a", 0x100, 20), intSlice("b", 0x200, 20), {Name: "c", Addr: 0x300, Type: "string", Kind: reflect.String, Value: strings.Repeat("x", 1000), Len: 1000}}
+	}
+
+	vars := newVars()
+	TruncateVariables(0, vars)
+	if !reflect.DeepEqual(vars, newVars()) {
+		t.Fatal("variables changed without a budget")
+	}
+
+	vars = newVars()
+	TruncateVariables(5*variableOverhead, vars)
+	if len(vars) != 3 {
+		t.Fatalf("top level variables dropped: %d", len(vars))
+	}
+	// the string is cut to the budget left after the other variables
+	if tr := vars[2].Truncated; len(vars[2].Value) == 0 || len(vars[2].Value) == 1000 || tr == nil || tr.Reason != TruncatedBudget || tr.Loaded != int64(len(vars[2].Value)) {
+		t.Errorf("wrong string: %d %#v", len(vars[2].Value), tr)
+	}
+	// no budget is left for the children
+	for i, v := range vars[:2] {
+		if tr := v.Truncated; len(v.Children) != 0 || tr == nil || tr.Loaded != 0 {
+			t.Errorf("wrong truncation of %d: %d %#v", i, len(v.Children), tr)
+		}
+	}
+
+	// the budget left is spent on the children in breadth first order
+	vars = newVars()[:2]
+	TruncateVariables(5*variableOverhead, vars)
+	if len(vars[0].Children) == 0 || len(vars[0].Children) == 20 || len(vars[1].Children) != 0 {
+		t.Errorf("wrong children: %d %d", len(vars[0].Children), len(vars[1].Children))
+	}
+	for i, v := range vars {
+		tr := v.Truncated
+		if tr == nil || tr.Reason != TruncatedBudget || tr.Loaded != int64(len(v.Children)) || tr.More != moreExpr(&v, tr.Loaded) {
+			t.Errorf("wrong truncation of %d: %#v", i, tr)
+		}
+	}
+
+	// the same values are always cut in the same way
+	vars2 := newVars()[:2]
+	TruncateVariables(5*variableOverhead, vars2)
+	if !reflect.DeepEqual(vars, vars2) {
+		t.Error("truncation is not deterministic")
+	}
+}
+
+func TestTruncateMap(t *testing.T) {
+	m := Variable{Name: "m", Addr: 0x100, Type: "map[int]int", Kind: reflect.Map, Len: 10}
+	for i := 0; i < 20; i++ {
+		m.Children = append(m.Children, Variable{Type: "int", Kind: reflect.Int, Value: "1"})
+	}
+	vars := []Variable{m}
+	TruncateVariables(6*variableOverhead, vars)
+	n := len(vars[0].Children)
+	if n%2 != 0 || n == 0 || n == 20 {
+		t.Fatalf("wrong number of children %d", n)
+	}
+	if tr := vars[0].Truncated; tr == nil || tr.Loaded != int64(n/2) {
+		t.Errorf("wrong truncation %#v", tr)
+	}
+}
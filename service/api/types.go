@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"time"
 	"unicode"
 
 	"github.com/go-delve/delve/pkg/proc"
@@ -40,10 +41,120 @@ type DebuggerState struct {
 	ExitStatus int  `json:"exitStatus"`
 	// When contains a description of the current position in a recording
 	When string
+	// GC describes the state of the garbage collector of the target, it is
+	// nil if it could not be read.
+	GC *GCState `json:"gc,omitempty"`
+	// ExprWatchChanges are the changes of the values of the watched
+	// expressions found by the command that stopped the target.
+	ExprWatchChanges []ExprWatchChange `json:"exprWatchChanges,omitempty"`
 	// Filled by RPCClient.Continue, indicates an error
 	Err error `json:"-"`
 }
 
+// GCState describes the state of the garbage collector of the target
+// process.
+type GCState struct {
+	// Phase is the current phase of the garbage collector, one of "off",
+	// "mark" or "marktermination".
+	Phase string `json:"phase"`
+	// Cycles is the number of completed GC cycles.
+	Cycles uint64 `json:"cycles"`
+	// HeapLive is the number of bytes of heap considered live by the garbage
+	// collector.
+	HeapLive uint64 `json:"heapLive"`
+	// HeapGoal is the heap size at which the next GC cycle will start.
+	HeapGoal uint64 `json:"heapGoal"`
+}
+
+// TimelineStop is a stop of the target recorded in the timeline of the
+// debugging session.
+type TimelineStop struct {
+	// Index is the position of the stop in the timeline, starting from 1.
+	Index int       `json:"index"`
+	Time  time.Time `json:"time"`
+	// Command is the command that stopped the target, for example
+	// "continue", "next" or "restart".
+	Command string `json:"command"`
+	// Reason describes why the target stopped, for example "breakpoint 1",
+	// "step finished" or "exited with status 0".
+	Reason string `json:"reason"`
+	Exited bool   `json:"exited,omitempty"`
+	// Resumed is true for the hits of sample breakpoints, recorded without
+	// stopping the target.
+	Resumed bool `json:"resumed,omitempty"`
+	// BreakpointID is the ID of the breakpoint the target stopped at, or 0.
+	BreakpointID int    `json:"breakpointID,omitempty"`
+	GoroutineID  int    `json:"goroutineID,omitempty"`
+	ThreadID     int    `json:"threadID,omitempty"`
+	File         string `json:"file,omitempty"`
+	Line         int    `json:"line,omitempty"`
+	Function     string `json:"function,omitempty"`
+	// Values are the values of the expressions of the breakpoint, followed
+	// by the values of the expressions of the timeline at the stop.
+	Values []TimelineValue `json:"values,omitempty"`
+}
+
+// TimelineValue is the value of an expression of the timeline at a stop.
+type TimelineValue struct {
+	Expr  string `json:"expr"`
+	Value string `json:"value,omitempty"`
+	// Err is the error evaluating Expr, for example because a variable is
+	// not in scope.
+	Err string `json:"err,omitempty"`
+}
+
+// RuntimeTrace is a runtime execution trace written by the target, see
+// the runtime/trace package, started and stopped by the debugger.
+type RuntimeTrace struct {
+	// Path is the path of the trace file, on the machine of the target.
+	Path string `json:"path"`
+	// LogsStops is true if the stops of the target are logged in the trace,
+	// which needs runtime/trace.Log to be linked in the target.
+	LogsStops bool `json:"logsStops"`
+	// Stops is the number of stops of the target at breakpoints logged in
+	// the trace, as messages of category "delve".
+	Stops int `json:"stops"`
+}
+
+// RuntimeStats contains memory and scheduler statistics read directly
+// from the memory of the target process. The meaning of the memory
+// statistics is the same as the fields of runtime.MemStats with the same
+// name.
+type RuntimeStats struct {
+	HeapAlloc    uint64 `json:"heapAlloc"`
+	HeapSys      uint64 `json:"heapSys"`
+	HeapIdle     uint64 `json:"heapIdle"`
+	HeapInuse    uint64 `json:"heapInuse"`
+	HeapReleased uint64 `json:"heapReleased"`
+	HeapObjects  uint64 `json:"heapObjects"`
+	StackInuse   uint64 `json:"stackInuse"`
+	NextGC       uint64 `json:"nextGC"`
+	NumGC        uint64 `json:"numGC"`
+	PauseTotalNs uint64 `json:"pauseTotalNs"`
+	// PauseNs contains the durations of the most recent GC pauses, most
+	// recent first.
+	PauseNs []uint64 `json:"pauseNs,omitempty"`
+	// Goroutines is the number of goroutines that are not dead.
+	Goroutines int `json:"goroutines"`
+	// Threads is the number of threads created by the runtime that haven't
+	// exited.
+	Threads int `json:"threads"`
+	// Unavailable lists the statistics that could not be read from the
+	// target, usually because the version of Go used to build it stores them
+	// differently.
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+// RuntimeEvents maps the names of the runtime events that can be used to
+// set breakpoints to the runtime function that is called when the event
+// happens.
+var RuntimeEvents = map[string]string{
+	"gc-start":         "runtime.gcStart",
+	"gc-end":           "runtime.gcMarkTermination",
+	"goroutine-create": "runtime.newproc1",
+	"goroutine-exit":   "runtime.goexit1",
+}
+
 // Breakpoint addresses a set of locations at which process execution may be
 // suspended.
 type Breakpoint struct {
@@ -77,6 +188,26 @@ type Breakpoint struct {
 	Stacktrace int `json:"stacktrace"`
 	// expressions to evaluate
 	Variables []string `json:"variables,omitempty"`
+	// Sample flag, signifying that the target should not stop when this
+	// breakpoint is reached, instead Variables are evaluated and their values
+	// are appended to a buffer that can be retrieved with GetSamples.
+	Sample bool `json:"sample,omitempty"`
+	// ErrorReturn flag, signifying that this breakpoint is set on the return
+	// instructions of FunctionName and will only be triggered if one of the
+	// error return values of the function is not nil.
+	ErrorReturn bool `json:"errorReturn,omitempty"`
+	// AtExit flag, signifying that this breakpoint is triggered every time
+	// FunctionName returns, or is unwound by a recovered panic, instead of
+	// when it is called. The target is stopped in the caller and Cond is
+	// evaluated when the function is called.
+	AtExit bool `json:"atExit,omitempty"`
+	// StackContains, if not empty, is the name of a function that must be
+	// one of the StackContainsDepth innermost frames of the stack for the
+	// breakpoint to be triggered, for example mypkg.HandleRequest.
+	// If StackContainsDepth is zero proc.DefaultStackContainsDepth frames
+	// are searched.
+	StackContains      string `json:"stackContains,omitempty"`
+	StackContainsDepth int    `json:"stackContainsDepth,omitempty"`
 	// LoadArgs requests loading function arguments when the breakpoint is hit
 	LoadArgs *LoadConfig
 	// LoadLocals requests loading function locals when the breakpoint is hit
@@ -85,6 +216,29 @@ type Breakpoint struct {
 	HitCount map[string]uint64 `json:"hitCount"`
 	// number of times a breakpoint has been reached
 	TotalHitCount uint64 `json:"totalHitCount"`
+	// StaleSource is true if the source file of the breakpoint changed
+	// after the executable was built, its line numbers could be wrong.
+	StaleSource bool `json:"staleSource,omitempty"`
+	// Stats are the statistics of the evaluations of Cond, nil if it was
+	// never evaluated.
+	Stats *BreakpointStats `json:"stats,omitempty"`
+}
+
+// BreakpointStats are statistics of the evaluations of the condition of a
+// breakpoint.
+type BreakpointStats struct {
+	// CondEvals is the number of times the condition was evaluated and
+	// CondTime the time spent evaluating it.
+	CondEvals uint64        `json:"condEvals"`
+	CondTime  time.Duration `json:"condTime"`
+	// FalseHits is the number of evaluations that did not stop the target.
+	FalseHits uint64 `json:"falseHits"`
+	// MaxRate is the highest number of evaluations in one second, of any
+	// of the addresses of the breakpoint.
+	MaxRate uint64 `json:"maxRate"`
+	// Hot is true if MaxRate is above proc.HotBreakpointRate: the target
+	// is slowed down considerably by the evaluations of the condition.
+	Hot bool `json:"hot"`
 }
 
 // ValidBreakpointName returns an error if
@@ -121,13 +275,168 @@ type Thread struct {
 	// ID of the goroutine running on this thread
 	GoroutineID int `json:"goroutineID"`
 
+	// Name is the name of the OS thread, empty if it is not available, for
+	// example on core files. On linux it is the name in /proc/<pid>/task/<tid>/comm.
+	Name string `json:"name,omitempty"`
+	// M is the ID of the M, the OS thread of the runtime, of the thread and P
+	// is the ID of the P it holds, -1 if they are unknown.
+	M int `json:"m"`
+	P int `json:"p"`
+
 	// Breakpoint this thread is stopped at
 	Breakpoint *Breakpoint `json:"breakPoint,omitempty"`
 	// Informations requested by the current breakpoint
 	BreakpointInfo *BreakpointInfo `json:"breakPointInfo,omitempty"`
 
 	// ReturnValues contains the return values of the function we just stepped out of
+	// or, after next, of the last function called by the current line
 	ReturnValues []Variable
+	// ReturnFunction is the function that returned ReturnValues
+	ReturnFunction *Function `json:"returnFunction,omitempty"`
+
+	// Syscall is the system call the thread entered or returned from, if
+	// it stopped because of a caught system call.
+	Syscall *SyscallEvent `json:"syscall,omitempty"`
+}
+
+// HTTPRequestFilter selects the HTTP requests handled by the target that
+// stop it, see CreateHTTPBreakpoint. Empty fields match every request.
+type HTTPRequestFilter struct {
+	// Method is the method of the request, for example GET.
+	Method string `json:"method,omitempty"`
+	// Route is a pattern matching the path of the URL of the request, see
+	// the glob builtin of expressions.
+	Route string `json:"route,omitempty"`
+	// Headers maps the names of headers to patterns matching their first
+	// value, the request must have all of them.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// GRPCRequestFilter selects the gRPC calls handled by the target that stop
+// it, see CreateGRPCBreakpoint. Empty fields match every call.
+type GRPCRequestFilter struct {
+	// Method is a pattern matching the full name of the method called, for
+	// example /helloworld.Greeter/SayHello, see the glob builtin of
+	// expressions.
+	Method string `json:"method,omitempty"`
+	// Metadata maps the keys of the metadata of the call to patterns
+	// matching their first value, the call must have all of them.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Context is one of the contexts in the chain of parents of a
+// context.Context, see ExamineContext.
+type Context struct {
+	// Type is the concrete type of the context.
+	Type string `json:"type"`
+	Addr uint64 `json:"addr"`
+	// Key and Value are set for the contexts created by context.WithValue,
+	// Value is not set if it is nil.
+	Key   *Variable `json:"key,omitempty"`
+	Value *Variable `json:"value,omitempty"`
+	// Deadline is the deadline of the context in RFC 3339 format, for the
+	// contexts created by context.WithDeadline or context.WithTimeout.
+	Deadline string `json:"deadline,omitempty"`
+	// Cancellable is true if the context can be canceled independently of
+	// its parent.
+	Cancellable bool `json:"cancellable,omitempty"`
+	// Err is the error of a canceled context.
+	Err *Variable `json:"err,omitempty"`
+	// Waiters are the IDs of the goroutines blocked receiving from the Done
+	// channel of the context.
+	Waiters []int `json:"waiters,omitempty"`
+}
+
+// WorkerGroup are the goroutines working for an errgroup.Group, a
+// semaphore.Weighted or a channel, see ListWorkers.
+type WorkerGroup struct {
+	// Kind is errgroup, semaphore or channel.
+	Kind    string   `json:"kind"`
+	Workers []Worker `json:"workers"`
+	// Err is the first error returned by a function run by an
+	// errgroup.Group.
+	Err *Variable `json:"err,omitempty"`
+	// Limit is the maximum number of active goroutines of an errgroup.Group,
+	// the size of a semaphore.Weighted or the capacity of a channel.
+	Limit int64 `json:"limit"`
+	// Active is the number of active goroutines of an errgroup.Group with a
+	// limit, the weight acquired from a semaphore.Weighted or the number of
+	// values buffered in a channel.
+	Active int64 `json:"active"`
+}
+
+// Worker is one of the goroutines of a WorkerGroup.
+type Worker struct {
+	Goroutine *Goroutine `json:"goroutine"`
+	// Role is run for the goroutines of an errgroup.Group, acquire <n> for
+	// the goroutines waiting for a semaphore.Weighted, receive or send for
+	// the goroutines blocked on a channel.
+	Role string `json:"role"`
+	// Func is the function run by a goroutine of an errgroup.Group.
+	Func string `json:"func,omitempty"`
+}
+
+// Timer is a pending timer of the runtime, see ListTimers.
+type Timer struct {
+	Addr uint64 `json:"addr"`
+	// When is the time the timer fires on the monotonic clock of the
+	// target, in nanoseconds.
+	When int64 `json:"when"`
+	// Period is the period of a ticker, in nanoseconds.
+	Period int64 `json:"period,omitempty"`
+	// Kind is timer, ticker, afterfunc, sleep or runtime.
+	Kind string `json:"kind"`
+	// Func is the function called by the runtime when the timer fires.
+	Func string `json:"func"`
+	// Callback is the function passed to time.AfterFunc.
+	Callback string `json:"callback,omitempty"`
+	// Waiters are the IDs of the goroutines receiving from the channel of
+	// a timer or ticker, or of the goroutine sleeping.
+	Waiters []int `json:"waiters,omitempty"`
+	// P is the ID of the P holding the timer, -1 for the targets built by
+	// versions of Go before 1.14.
+	P int `json:"p"`
+}
+
+// Finalizer is a finalizer, or a cleanup, of an object, see
+// ListFinalizers.
+type Finalizer struct {
+	// Obj is the address of the object.
+	Obj uint64 `json:"obj"`
+	// Type is the type of the argument of the finalizer function, empty
+	// for cleanups.
+	Type string `json:"type,omitempty"`
+	Func string `json:"func"`
+	// Cleanup is true for the cleanups added with runtime.AddCleanup.
+	Cleanup bool `json:"cleanup,omitempty"`
+	// Queued is true if the object is unreachable and the finalizer waits
+	// for the finalizer goroutine to run it.
+	Queued bool `json:"queued,omitempty"`
+}
+
+// FinalizerState is the state of the finalizers of the target, see
+// ListFinalizers.
+type FinalizerState struct {
+	Finalizers []Finalizer `json:"finalizers"`
+	// Goroutine is the goroutine running the finalizers, nil if no
+	// finalizer was ever set or if it did not start yet.
+	Goroutine *Goroutine `json:"goroutine,omitempty"`
+	// Running is true if Goroutine is running a finalizer.
+	Running bool `json:"running"`
+}
+
+// SyscallEvent is the entry or the exit of a caught system call.
+type SyscallEvent struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+	// Exit is true if the thread is returning from the system call.
+	Exit bool `json:"exit"`
+	// Args are the arguments of the system call, decoded for the most
+	// common system calls, set at its entry.
+	Args []string `json:"args,omitempty"`
+	// Ret is the value returned by the system call, with the error it
+	// represents if it failed, set at its exit.
+	Ret string `json:"ret,omitempty"`
 }
 
 // Location holds program location information.
@@ -141,6 +450,9 @@ type Location struct {
 	Line     int       `json:"line"`
 	Function *Function `json:"function,omitempty"`
 	PCs      []uint64  `json:"pcs,omitempty"`
+	// StaleSource is true if File changed after the executable was built,
+	// Line could be wrong.
+	StaleSource bool `json:"staleSource,omitempty"`
 }
 
 // Stackframe describes one frame in a stack trace.
@@ -156,6 +468,10 @@ type Stackframe struct {
 
 	Bottom bool `json:"Bottom,omitempty"` // Bottom is true if this is the bottom frame of the stack
 
+	// Hidden is the number of frames immediately preceding this one that
+	// were removed from the stacktrace by the frame filters of the debugger.
+	Hidden int `json:"Hidden,omitempty"`
+
 	Err string
 }
 
@@ -167,6 +483,23 @@ type Defer struct {
 	Unreadable  string
 }
 
+// DeferredCall describes a pending deferred call of a goroutine.
+type DeferredCall struct {
+	Defer
+	// Frame is the index of the stack frame that deferred the call.
+	Frame int
+	// Function is the function called by the deferred call, for defer
+	// statements with arguments it can be different from
+	// DeferredLoc.Function, which is a closure generated by the compiler.
+	Function *Function
+	// Arguments of the deferred call, or variables captured by the deferred
+	// closure.
+	Arguments []Variable
+	// Recovers is true if the deferred call will recover the panic the
+	// goroutine is currently in.
+	Recovers bool
+}
+
 // Var will return the variable described by 'name' within
 // this stack frame.
 func (frame *Stackframe) Var(name string) *Variable {
@@ -202,6 +535,28 @@ func (fn *Function) Name() string {
 	return fn.Name_
 }
 
+// SymbolKind is the kind of a symbol found by a symbol search, kinds can
+// be combined to search for more than one kind of symbol.
+type SymbolKind uint8
+
+const (
+	SymbolFunction SymbolKind = 1 << iota
+	SymbolType
+	SymbolVariable
+)
+
+// Symbol is a function, type or package variable found by a symbol search.
+type Symbol struct {
+	Name string     `json:"name"`
+	Kind SymbolKind `json:"kind"`
+	// Score is the ranking of the symbol, higher is better.
+	Score int `json:"score"`
+	// File, Line and PC are the entry point of functions.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	PC   uint64 `json:"pc,omitempty"`
+}
+
 // VariableFlags is the type of the Flags field of Variable.
 type VariableFlags uint16
 
@@ -281,6 +636,36 @@ type Variable struct {
 	LocationExpr string
 	// DeclLine is the line number of this variable's declaration
 	DeclLine int64
+
+	// Truncated describes the part of the value missing from Value or
+	// Children, nil if the value was loaded completely
+	Truncated *Truncation `json:"truncated,omitempty"`
+}
+
+// Reasons of a Truncation.
+const (
+	// TruncatedLimit is the reason of a value cut by the limits of the
+	// LoadConfig: MaxStringLen, MaxArrayValues, MaxStructFields or
+	// MaxVariableRecurse.
+	TruncatedLimit = "limit"
+	// TruncatedBudget is the reason of a value cut to respect
+	// LoadConfig.MaxResponseBytes.
+	TruncatedBudget = "budget"
+)
+
+// Truncation describes the part of the value of a variable that is missing
+// from a response.
+type Truncation struct {
+	// Reason is TruncatedLimit or TruncatedBudget
+	Reason string `json:"reason"`
+	// Loaded is the number of bytes of strings, elements of arrays and
+	// slices, entries of maps or fields of structs included in the response
+	Loaded int64 `json:"loaded"`
+	// More is an expression, to evaluate in the same scope, returning the
+	// missing part of the value: the elements starting at Loaded for
+	// strings, arrays, slices and maps, the whole value otherwise. It is
+	// empty if the address of the variable is not known.
+	More string `json:"more,omitempty"`
 }
 
 // LoadConfig describes how to load values from target's memory
@@ -295,6 +680,10 @@ type LoadConfig struct {
 	MaxArrayValues int
 	// MaxStructFields is the maximum number of fields read from a struct, -1 will read all fields.
 	MaxStructFields int
+	// MaxResponseBytes is the approximate size, in bytes of JSON, of the
+	// variables returned by a request, the values that do not fit are cut
+	// (see TruncateVariables). 0 means no limit.
+	MaxResponseBytes int
 }
 
 // Goroutine represents the information relevant to Delve from the runtime's
@@ -302,6 +691,8 @@ type LoadConfig struct {
 type Goroutine struct {
 	// ID is a unique identifier for the goroutine.
 	ID int `json:"id"`
+	// Name of the goroutine, for the threads of interest of flavors
+	Name string `json:"name,omitempty"`
 	// Current location of the goroutine
 	CurrentLoc Location `json:"currentLoc"`
 	// Current location of the goroutine, excluding calls inside runtime
@@ -311,12 +702,41 @@ type Goroutine struct {
 	// Location of the starting function
 	StartLoc Location `json:"startLoc"`
 	// ID of the associated thread for running goroutines
-	ThreadID   int    `json:"threadID"`
+	ThreadID int `json:"threadID"`
+	// ThreadName is the name of the associated thread, see Thread.Name.
+	ThreadName string `json:"threadName,omitempty"`
+	// M is the ID of the M running the goroutine and P the ID of the P it
+	// holds, -1 if the goroutine is not running or the M does not hold a P.
+	M int `json:"m"`
+	P int `json:"p"`
+	// Status of the goroutine, one of the G status constants of proc
+	Status     uint64 `json:"status"`
 	Unreadable string `json:"unreadable"`
 	// Goroutine's pprof labels
 	Labels map[string]string `json:"labels,omitempty"`
 }
 
+// StatusString returns the name of the status of g.
+func (g *Goroutine) StatusString() string {
+	switch g.Status {
+	case proc.Gidle:
+		return "idle"
+	case proc.Grunnable:
+		return "runnable"
+	case proc.Grunning:
+		return "running"
+	case proc.Gsyscall:
+		return "syscall"
+	case proc.Gwaiting:
+		return "waiting"
+	case proc.Gdead:
+		return "dead"
+	case proc.Gcopystack:
+		return "copystack"
+	}
+	return fmt.Sprintf("status %d", g.Status)
+}
+
 // DebuggerCommand is a command which changes the debugger's execution state.
 type DebuggerCommand struct {
 	// Name is the command to run.
@@ -347,6 +767,16 @@ type DebuggerCommand struct {
 	// violate the rules about stack objects you can disable this safety check
 	// by setting UnsafeCall to true.
 	UnsafeCall bool `json:"unsafeCall,omitempty"`
+
+	// FollowChannel is used with the Step command: if the current line sends
+	// a value on a channel the step will end in the goroutine receiving it,
+	// if one is waiting.
+	FollowChannel bool `json:"followChannel,omitempty"`
+
+	// SkipPackages is used with the Step command: it is the list of packages
+	// that the step will not stop in, continuing to the first frame that
+	// doesn't belong to them.
+	SkipPackages []string `json:"skipPackages,omitempty"`
 }
 
 // BreakpointInfo contains informations about the current breakpoint
@@ -356,6 +786,171 @@ type BreakpointInfo struct {
 	Variables  []Variable   `json:"variables,omitempty"`
 	Arguments  []Variable   `json:"arguments,omitempty"`
 	Locals     []Variable   `json:"locals,omitempty"`
+	// ErrorChain is the chain of errors wrapped by the panic value, set
+	// when the unrecovered-panic breakpoint is reached with an error.
+	ErrorChain []WrappedError `json:"errorChain,omitempty"`
+}
+
+// WrappedError describes one error of a chain of wrapped errors.
+type WrappedError struct {
+	// Type is the concrete type of the error.
+	Type string `json:"type"`
+	// Message is the message of the error, if it could be determined
+	// without calling its Error method.
+	Message string `json:"message,omitempty"`
+	// Value is the value of the error, set when Message could not be
+	// determined.
+	Value string `json:"value,omitempty"`
+	// Depth is the number of errors wrapping this error.
+	Depth int `json:"depth"`
+}
+
+// Sample contains the values of the expressions of a sample breakpoint,
+// collected when the breakpoint was reached.
+type Sample struct {
+	// ID of the logical breakpoint that collected this sample.
+	BreakpointID int `json:"breakpointID"`
+	// ID of the goroutine that reached the breakpoint.
+	GoroutineID int `json:"goroutineID"`
+	// Time at which the sample was collected.
+	Time time.Time `json:"time"`
+	// Values of the expressions of the breakpoint, in the same order as
+	// Breakpoint.Variables.
+	Variables []Variable `json:"variables,omitempty"`
+}
+
+// CallerStack is a unique stack of callers of a function, recorded by
+// RecordCallers.
+type CallerStack struct {
+	// Frames are the callers, innermost first.
+	Frames []CallerFrame `json:"frames"`
+	// Count is the number of calls made through this stack of callers.
+	Count int `json:"count"`
+}
+
+// CallerFrame is the call site of a caller in a CallerStack.
+type CallerFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// ExprWatch is an expression watched by the debugger, the target stops
+// when its value changes.
+type ExprWatch struct {
+	ID   int    `json:"id"`
+	Expr string `json:"expr"`
+	// Locations are the locations where Expr is evaluated, if empty it is
+	// evaluated every time the target stops.
+	Locations []string `json:"locations,omitempty"`
+	// Value is the value of Expr at the previous evaluation.
+	Value string `json:"value"`
+}
+
+// ExprWatchChange is a change of the value of an ExprWatch.
+type ExprWatchChange struct {
+	ID   int    `json:"id"`
+	Expr string `json:"expr"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// BisectResult is the result of Bisect.
+type BisectResult struct {
+	// Statement is the statement that made the predicate true.
+	Statement Location `json:"statement"`
+	// Iteration is the iteration the statement was executed in, counting
+	// from 1, of the Iterations executed from the start location to the end
+	// location.
+	Iteration  int `json:"iteration"`
+	Iterations int `json:"iterations"`
+	// Steps is the number of statements executed in the iteration, up to
+	// and including Statement.
+	Steps int `json:"steps"`
+	// Runs is the number of times the target was restarted.
+	Runs int `json:"runs"`
+}
+
+// Target is a process debugged by Delve: the target of the debugger or one
+// of its child processes, debugged by another instance of Delve when
+// child processes are followed. Pid and Path are not set for the target of
+// the debugger while it is running.
+type Target struct {
+	Pid  int    `json:"pid"`
+	Path string `json:"path"`
+	// Addr is the address of the headless instance of Delve debugging the
+	// child process, empty for the target of the debugger.
+	Addr string `json:"addr,omitempty"`
+	// Running is true if the child process is running.
+	Running bool `json:"running"`
+	Exited  bool `json:"exited"`
+	// ExitStatus is the exit status of the child process, if it exited.
+	ExitStatus int `json:"exitStatus"`
+	// Err is why the process can not be debugged, empty if it can.
+	Err string `json:"err,omitempty"`
+}
+
+// CoverageLine is a source line tracked by line coverage.
+type CoverageLine struct {
+	// Function is the name of the function the line belongs to.
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	// Executed is true if the line was executed at least once since line
+	// coverage of its function was started.
+	Executed bool `json:"executed"`
+}
+
+// OutputChunk is a piece of the output of the target streamed to clients.
+type OutputChunk struct {
+	// Seq is the sequence number of the chunk, starting at 1. Chunks are
+	// discarded when too much output accumulates, missing sequence numbers
+	// are discarded chunks.
+	Seq uint64 `json:"seq"`
+	// Stream is the stream the chunk was written to: OutputStreamStdout,
+	// OutputStreamStderr or OutputStreamTTY.
+	Stream string `json:"stream"`
+	Data   []byte `json:"data"`
+}
+
+// Streams of OutputChunk.
+const (
+	OutputStreamStdout = "stdout"
+	OutputStreamStderr = "stderr"
+	// OutputStreamTTY is the pseudo-terminal allocated for the target,
+	// both its standard output and error.
+	OutputStreamTTY = "tty"
+)
+
+// StopTime is how long the target was stopped by the debugger, from when a
+// command stopped it to when the next one resumed it.
+type StopTime struct {
+	// Total is the time the target spent stopped, including the current
+	// stop.
+	Total time.Duration `json:"total"`
+	// Stopped is true if the target is stopped, for Current, since Command
+	// stopped it.
+	Stopped bool          `json:"stopped"`
+	Current time.Duration `json:"current"`
+	Command string        `json:"command"`
+	// Alarm is how long the target can stay stopped before the debugger
+	// warns about it, zero if there is no alarm. Alarms is the number of
+	// stops that lasted longer.
+	Alarm  time.Duration `json:"alarm"`
+	Alarms int           `json:"alarms"`
+	// Commands are the completed stops by the command that stopped the
+	// target, sorted by command.
+	Commands []CommandStopTime `json:"commands"`
+}
+
+// CommandStopTime is the time the target was stopped by a command, the
+// name of a DebuggerCommand or launch, attach and restart for the stop
+// of a new process.
+type CommandStopTime struct {
+	Command string        `json:"command"`
+	Count   int           `json:"count"`
+	Total   time.Duration `json:"total"`
+	Max     time.Duration `json:"max"`
 }
 
 // EvalScope is the scope a command should
@@ -455,6 +1050,20 @@ type SetAPIVersionIn struct {
 type SetAPIVersionOut struct {
 }
 
+// SetEncodingIn is the input for SetEncoding, which must be the first
+// request on a connection: the messages following its response are
+// encoded and compressed as specified.
+type SetEncodingIn struct {
+	// Encoding is "json", the default, or "gob".
+	Encoding string
+	// Compression is empty, the default, or "flate".
+	Compression string
+}
+
+// SetEncodingOut is the output for SetEncoding.
+type SetEncodingOut struct {
+}
+
 // Register holds information on a CPU register.
 type Register struct {
 	Name        string
@@ -495,12 +1104,38 @@ type Checkpoint struct {
 	Where string
 }
 
+// Snapshot is a frozen copy of the state of the target, that can be
+// inspected after the target resumes or exits.
+type Snapshot struct {
+	ID   int
+	When time.Time
+	Note string
+	// Selected is true if the snapshot replaces the target.
+	Selected bool
+}
+
 // Image represents a loaded shared object (go plugin or shared library)
 type Image struct {
 	Path    string
 	Address uint64
 }
 
+// Capability describes whether a feature that depends on the debug
+// information of the runtime is available for the target program.
+type Capability struct {
+	Feature   string
+	Available bool
+	// Reason is the reason why the feature is not available.
+	Reason string `json:",omitempty"`
+}
+
+// LogLevel is the log level of a component of Delve, see 'dlv help log'.
+type LogLevel struct {
+	Subsystem   string
+	Description string
+	Level       string
+}
+
 // Ancestor represents a goroutine ancestor
 type Ancestor struct {
 	ID    int64
@@ -526,6 +1161,10 @@ const (
 	// StacktraceG requests a stacktrace starting with the register
 	// values saved in the runtime.g structure.
 	StacktraceG
+
+	// StacktraceShowHidden requests a stacktrace including the frames hidden
+	// by the frame filters of the debugger.
+	StacktraceShowHidden
 )
 
 // ImportPathToDirectoryPath maps an import path to a directory path.
@@ -0,0 +1,78 @@
+// Package audit implements the audit log of the servers, which records
+// every operation that changes the state of the target, such as resuming
+// it, setting variables, calling functions or writing its memory.
+//
+// The log is a sequence of JSON objects, one per line. Entries are written
+// when the server receives the operation, before it runs, so that
+// operations that never complete are also recorded.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is an entry of the audit log.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Client identifies the client that requested the operation, by its
+	// address and, if it reported one, its name.
+	Client string `json:"client"`
+	// API is the API used by the client: "rpc1", "rpc2", "rpc3" or "dap".
+	API string `json:"api"`
+	// Operation is the name of the method or of the request.
+	Operation string `json:"operation"`
+	// Args are the arguments of the operation.
+	Args interface{} `json:"args,omitempty"`
+}
+
+// Log writes the entries of an audit log. A nil *Log discards them.
+type Log struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// New returns a Log writing entries to w.
+func New(w io.Writer) *Log {
+	return &Log{w: w, enc: json.NewEncoder(w)}
+}
+
+// Open returns a Log appending entries to the file at path, which is
+// created if it does not exist.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return New(f), nil
+}
+
+// Record writes e to the log, setting its time if it is not set.
+func (l *Log) Record(e Entry) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(e)
+}
+
+// Close closes the underlying writer, if it is an io.Closer.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	var nilLog *Log
+	nilLog.Record(Entry{Operation: "Command"})
+
+	var buf bytes.Buffer
+	l := New(&buf)
+	now := time.Date(2020, 11, 2, 10, 0, 0, 0, time.UTC)
+	l.Record(Entry{Time: now, Client: "127.0.0.1:4000", API: "rpc2", Operation: "Set", Args: map[string]string{"Symbol": "a", "Value": "1"}})
+	l.Record(Entry{Client: "127.0.0.1:4001", API: "dap", Operation: "continue"})
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.Bytes())
+	}
+	const want0 = `{"time":"2020-11-02T10:00:00Z","client":"127.0.0.1:4000","api":"rpc2","operation":"Set","args":{"Symbol":"a","Value":"1"}}`
+	if string(lines[0]) != want0 {
+		t.Errorf("got %s, want %s", lines[0], want0)
+	}
+	var e Entry
+	if err := json.Unmarshal(lines[1], &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Time.IsZero() || e.Operation != "continue" || e.Args != nil {
+		t.Errorf("wrong entry %#v", e)
+	}
+}
@@ -40,6 +40,9 @@ type Client interface {
 	ReverseNext() (*api.DebuggerState, error)
 	// Step continues to the next source line, entering function calls.
 	Step() (*api.DebuggerState, error)
+	// StepFollowChannel is like Step but if the current line sends a value on
+	// a channel it continues to the goroutine receiving it.
+	StepFollowChannel() (*api.DebuggerState, error)
 	// ReverseStep continues backward to the previous line of source code, entering function calls.
 	ReverseStep() (*api.DebuggerState, error)
 	// StepOut continues to the return address of the current function.
@@ -87,6 +90,21 @@ type Client interface {
 	ListPackageVariables(filter string, cfg api.LoadConfig) ([]api.Variable, error)
 	// EvalVariable returns a variable in the context of the current thread.
 	EvalVariable(scope api.EvalScope, symbol string, cfg api.LoadConfig) (*api.Variable, error)
+	// ExamineContext returns the chain of parents of the context.Context
+	// resulting from evaluating expr.
+	ExamineContext(scope api.EvalScope, expr string, cfg api.LoadConfig) ([]api.Context, error)
+	// ListWorkers returns the goroutines working for the errgroup.Group,
+	// semaphore.Weighted or channel resulting from evaluating expr.
+	ListWorkers(scope api.EvalScope, expr string, cfg api.LoadConfig) (*api.WorkerGroup, error)
+
+	// ListTimers returns the pending timers of the runtime, sorted by the
+	// time they fire, and the current time of the monotonic clock of the
+	// target, 0 if it is not known.
+	ListTimers() ([]api.Timer, int64, error)
+
+	// ListFinalizers returns the finalizers of the target and the state of
+	// the goroutine running them.
+	ListFinalizers() (*api.FinalizerState, error)
 
 	// SetVariable sets the value of a variable
 	SetVariable(scope api.EvalScope, symbol, value string) error
@@ -97,6 +115,9 @@ type Client interface {
 	ListFunctions(filter string) ([]string, error)
 	// ListTypes lists all types in the process matching filter.
 	ListTypes(filter string) ([]string, error)
+	// SearchSymbols returns the functions, types and package variables whose
+	// name matches query, ranked by how well they match.
+	SearchSymbols(query string, kinds api.SymbolKind, limit int) ([]api.Symbol, error)
 	// ListLocals lists all local variables in scope.
 	ListLocalVariables(scope api.EvalScope, cfg api.LoadConfig) ([]api.Variable, error)
 	// ListFunctionArgs lists all arguments to the current function.
@@ -112,6 +133,13 @@ type Client interface {
 	// Returns stacktrace
 	Stacktrace(goroutineID int, depth int, opts api.StacktraceOptions, cfg *api.LoadConfig) ([]api.Stackframe, error)
 
+	// ListReturnValues returns the values returned by the last function
+	// stepped out of, or over, and the function that returned them.
+	ListReturnValues(cfg api.LoadConfig) ([]api.Variable, *api.Function, error)
+
+	// Returns the pending deferred calls of a goroutine
+	ListDeferredCalls(goroutineID int, depth int, cfg *api.LoadConfig) ([]api.DeferredCall, error)
+
 	// Returns ancestor stacktraces
 	Ancestors(goroutineID int, numAncestors int, depth int) ([]api.Ancestor, error)
 
@@ -148,8 +176,20 @@ type Client interface {
 	// ClearCheckpoint removes a checkpoint
 	ClearCheckpoint(id int) error
 
+	// Snapshot captures the state of the stopped target into a snapshot
+	// that can be inspected after the target resumes or exits.
+	Snapshot(note string) (int, error)
+	// ListSnapshots gets all snapshots.
+	ListSnapshots() ([]api.Snapshot, error)
+	// SwitchSnapshot selects a snapshot, 0 selects the process.
+	SwitchSnapshot(id int) error
+	// ClearSnapshot removes a snapshot.
+	ClearSnapshot(id int) error
+
 	// SetReturnValuesLoadConfig sets the load configuration for return values.
 	SetReturnValuesLoadConfig(*api.LoadConfig)
+	// SetStepSkipPackages sets the packages that Step will not stop in.
+	SetStepSkipPackages(pkgs []string)
 
 	// IsMulticlien returns true if the headless instance is multiclient.
 	IsMulticlient() bool
@@ -157,11 +197,116 @@ type Client interface {
 	// ListDynamicLibraries returns a list of loaded dynamic libraries.
 	ListDynamicLibraries() ([]api.Image, error)
 
+	// ListCapabilities returns the features that depend on the debug
+	// information of the runtime and whether they are available.
+	ListCapabilities() ([]api.Capability, error)
+
+	// GetLogLevels returns the log level of each component of Delve.
+	GetLogLevels() ([]api.LogLevel, error)
+	// SetLogLevel changes the log level of a component of Delve.
+	SetLogLevel(subsystem, level string) error
+	// DumpLog returns the last entries logged by Delve, oldest first.
+	DumpLog() ([]string, error)
+
 	// ExamineMemory returns the raw memory stored at the given address.
 	// The amount of data to be read is specified by length which must be less than or equal to 1000.
 	// This function will return an error if it reads less than `length` bytes.
 	ExamineMemory(address uintptr, length int) ([]byte, error)
 
+	// GetSamples returns the values collected by sample breakpoints and the
+	// number of samples discarded because the sample buffer was full.
+	// If clear is true the sample buffer is emptied.
+	GetSamples(clear bool) ([]api.Sample, uint64, error)
+
+	// AddCoverage starts recording which lines of the functions specified
+	// by specs, locations or source files, are executed. Returns the number
+	// of lines added.
+	AddCoverage(specs []string) (int, error)
+	// GetCoverage returns the lines tracked by line coverage.
+	GetCoverage() ([]api.CoverageLine, error)
+	// ClearCoverage stops recording line coverage.
+	ClearCoverage() error
+
+	// GetStopTime returns how long the target was stopped by the debugger.
+	GetStopTime() (*api.StopTime, error)
+
+	// GetTimeline returns the stops of the target recorded during the
+	// debugging session and the expressions evaluated at every stop.
+	GetTimeline() ([]api.TimelineStop, []string, error)
+	// SetTimelineExprs sets the expressions evaluated at every stop
+	// recorded in the timeline.
+	SetTimelineExprs(exprs []string) error
+
+	// GetOutput returns the output of the target streamed to clients newer
+	// than the chunk with sequence number since and whether the target
+	// will not write more output. If wait is true it waits for output if
+	// there is none yet.
+	GetOutput(since uint64, wait bool) ([]api.OutputChunk, bool, error)
+
+	// RuntimeStats returns memory and scheduler statistics read from the
+	// runtime of the target process.
+	RuntimeStats() (*api.RuntimeStats, error)
+
+	// Profile collects a profile of the target in pprof format, kind is
+	// either "cpu" or "heap". CPU profiles are collected by resuming the
+	// target for the specified duration.
+	Profile(kind string, duration time.Duration) ([]byte, error)
+
+	// ProfileCMalloc resumes the target for the specified duration and
+	// returns a heap profile in pprof format of the memory allocated by the
+	// C library, tracing the calls to malloc and free, and also the
+	// allocations of Go if mallocgc is true.
+	ProfileCMalloc(duration time.Duration, mallocgc bool) ([]byte, error)
+
+	// StartRuntimeTrace starts a runtime execution trace of the target,
+	// written to the file at path, the stops at breakpoints are logged in
+	// the trace.
+	StartRuntimeTrace(path string) (*api.RuntimeTrace, error)
+	// StopRuntimeTrace stops the runtime execution trace of the target.
+	StopRuntimeTrace() (*api.RuntimeTrace, error)
+
+	// RecordCallers resumes the target for the specified duration and
+	// returns the unique stacks of callers of the calls to the specified
+	// function made in the meantime, with their counts.
+	RecordCallers(fn string, duration time.Duration) ([]api.CallerStack, error)
+
+	// Bisect finds the statement that makes predicate true between the
+	// start and end locations, restarting the target repeatedly.
+	Bisect(predicate, start, end string) (*api.BisectResult, error)
+
+	// CreateExprWatch starts watching the value of expr, the target stops
+	// when it changes. Expr is evaluated at the specified locations, or
+	// every time the target stops if there are none.
+	CreateExprWatch(expr string, locations []string) (*api.ExprWatch, error)
+	// ListExprWatches returns the watched expressions.
+	ListExprWatches() ([]api.ExprWatch, error)
+	// ClearExprWatch stops watching the expression with the specified ID.
+	ClearExprWatch(id int) error
+
+	// CatchSyscalls makes the target stop when it enters or returns from
+	// one of syscalls, replacing the system calls caught before, and returns
+	// the caught system calls.
+	CatchSyscalls(syscalls []string) ([]string, error)
+	// ListCaughtSyscalls returns the system calls caught.
+	ListCaughtSyscalls() ([]string, error)
+	// CreateCatchpoint creates the breakpoints stopping the target when it
+	// opens a file, dials an address or sends an HTTP request to a URL
+	// matching pattern, for kind "open", "dial" and "http" respectively.
+	CreateCatchpoint(kind, pattern string) ([]*api.Breakpoint, error)
+	// CreateHTTPBreakpoint creates the breakpoints stopping the target when
+	// it starts serving an HTTP request matching filter.
+	CreateHTTPBreakpoint(filter api.HTTPRequestFilter) ([]*api.Breakpoint, error)
+	// CreateGRPCBreakpoint creates the breakpoints stopping the target when
+	// it starts serving a gRPC call matching filter.
+	CreateGRPCBreakpoint(filter api.GRPCRequestFilter) ([]*api.Breakpoint, error)
+	// CreateFinalizerBreakpoint creates the breakpoints stopping the target
+	// when a finalizer of an object of type typ runs.
+	CreateFinalizerBreakpoint(typ string) ([]*api.Breakpoint, error)
+
+	// ListTargets returns the target of the debugger followed by its child
+	// processes, debugged by other instances of Delve.
+	ListTargets() ([]api.Target, error)
+
 	// StopRecording stops a recording if one is in progress.
 	StopRecording() error
 
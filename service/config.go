@@ -3,6 +3,7 @@ package service
 import (
 	"net"
 
+	"github.com/go-delve/delve/service/audit"
 	"github.com/go-delve/delve/service/debugger"
 )
 
@@ -27,6 +28,12 @@ type Config struct {
 	// Note that the server API is not reentrant and clients will have to coordinate.
 	AcceptMulti bool
 
+	// OnDisconnect is what happens to the target when the connection to the
+	// last client is lost, because of a network error, instead of being
+	// closed: "stop" halts it and "continue" resumes it, keeping the
+	// breakpoints for the next client. Requires AcceptMulti.
+	OnDisconnect string
+
 	// APIVersion selects which version of the API to serve (default: 1).
 	APIVersion int
 
@@ -36,4 +43,13 @@ type Config struct {
 
 	// DisconnectChan will be closed by the server when the client disconnects
 	DisconnectChan chan<- struct{}
+
+	// MetricsAddr is the address of an HTTP endpoint serving the health,
+	// the status and the metrics of the server, disabled if empty. With
+	// CheckLocalConnUser the status is only served to the same user.
+	MetricsAddr string
+
+	// AuditLog records the operations that change the state of the target,
+	// disabled if nil.
+	AuditLog *audit.Log
 }
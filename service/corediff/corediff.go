@@ -0,0 +1,277 @@
+// Package corediff compares two core dumps of the same executable.
+//
+// It reports how the goroutines changed, grouped by state and by the go
+// statement that created them, which package variables changed value, and
+// how the number of live heap objects changed for each size class of the
+// allocator. This is useful to analyze a service before and after it leaks
+// goroutines or memory.
+package corediff
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/debugger"
+)
+
+// Config configures a comparison.
+type Config struct {
+	// Vars selects the compared package variables by name, all the
+	// variables outside of the runtime are compared if it is empty.
+	Vars string
+	// LoadConfig is used to load the values of the package variables.
+	LoadConfig proc.LoadConfig
+}
+
+// Report describes the differences between two core dumps.
+type Report struct {
+	GoroutinesBefore, GoroutinesAfter int
+	// ByState and ByGoStatement are the changes in the number of
+	// goroutines in each state and created by each go statement.
+	ByState       []Delta
+	ByGoStatement []Delta
+
+	// Vars are the package variables whose value changed.
+	Vars []VarChange
+
+	// HeapErr is set if the heap statistics could not be read, for
+	// example because the runtime does not record them.
+	HeapErr error
+	// HeapObjectsBefore and HeapObjectsAfter are the numbers of live
+	// heap objects.
+	HeapObjectsBefore, HeapObjectsAfter int64
+	// BySizeClass is the change in the number of live heap objects of
+	// each size class.
+	BySizeClass []Delta
+}
+
+// Delta is the change of a count between two core dumps.
+type Delta struct {
+	Key           string
+	Before, After int64
+}
+
+// VarChange is a package variable that changed value between two core dumps.
+type VarChange struct {
+	Name          string
+	Before, After string
+}
+
+// Diff compares the core dumps opened by before and after.
+func Diff(before, after *debugger.Debugger, cfg Config) (*Report, error) {
+	r := &Report{}
+	gb, err := goroutines(before)
+	if err != nil {
+		return nil, fmt.Errorf("first core: %v", err)
+	}
+	ga, err := goroutines(after)
+	if err != nil {
+		return nil, fmt.Errorf("second core: %v", err)
+	}
+	r.GoroutinesBefore, r.GoroutinesAfter = len(gb), len(ga)
+	r.ByState = deltas(countGoroutines(gb, goroutineState), countGoroutines(ga, goroutineState))
+	r.ByGoStatement = deltas(countGoroutines(gb, goStatement), countGoroutines(ga, goStatement))
+
+	vb, err := packageVars(before, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("first core: %v", err)
+	}
+	va, err := packageVars(after, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("second core: %v", err)
+	}
+	r.Vars = varChanges(vb, va)
+
+	hb, err := heapObjects(before, cfg.LoadConfig)
+	if err != nil {
+		r.HeapErr = err
+		return r, nil
+	}
+	ha, err := heapObjects(after, cfg.LoadConfig)
+	if err != nil {
+		r.HeapErr = err
+		return r, nil
+	}
+	for _, n := range hb {
+		r.HeapObjectsBefore += n
+	}
+	for _, n := range ha {
+		r.HeapObjectsAfter += n
+	}
+	r.BySizeClass = deltas(hb, ha)
+	return r, nil
+}
+
+func goroutines(d *debugger.Debugger) ([]*api.Goroutine, error) {
+	gs, _, err := d.Goroutines(0, 0)
+	return gs, err
+}
+
+func countGoroutines(gs []*api.Goroutine, key func(*api.Goroutine) string) map[string]int64 {
+	r := make(map[string]int64)
+	for _, g := range gs {
+		r[key(g)]++
+	}
+	return r
+}
+
+func goroutineState(g *api.Goroutine) string {
+	if g.Unreadable != "" {
+		return "unreadable"
+	}
+	return g.StatusString()
+}
+
+func goStatement(g *api.Goroutine) string {
+	loc := g.GoStatementLoc
+	if loc.Function == nil {
+		return "(no go statement)"
+	}
+	return fmt.Sprintf("%s %s:%d", loc.Function.Name(), loc.File, loc.Line)
+}
+
+// deltas returns the counts that differ between before and after, sorted
+// by decreasing absolute change.
+func deltas(before, after map[string]int64) []Delta {
+	var r []Delta
+	for k, n := range before {
+		if after[k] != n {
+			r = append(r, Delta{Key: k, Before: n, After: after[k]})
+		}
+	}
+	for k, n := range after {
+		if _, ok := before[k]; !ok && n != 0 {
+			r = append(r, Delta{Key: k, After: n})
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		di, dj := abs(r[i].After-r[i].Before), abs(r[j].After-r[j].Before)
+		if di != dj {
+			return di > dj
+		}
+		return r[i].Key < r[j].Key
+	})
+	return r
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func packageVars(d *debugger.Debugger, cfg Config) (map[string]string, error) {
+	state, err := d.State(false)
+	if err != nil {
+		return nil, err
+	}
+	threadID := 0
+	if state.CurrentThread != nil {
+		threadID = state.CurrentThread.ID
+	}
+	vars, err := d.PackageVariables(threadID, cfg.Vars, cfg.LoadConfig)
+	if err != nil {
+		return nil, err
+	}
+	r := make(map[string]string)
+	for i := range vars {
+		if cfg.Vars == "" && strings.HasPrefix(vars[i].Name, "runtime.") {
+			continue
+		}
+		r[vars[i].Name] = vars[i].SinglelineString()
+	}
+	return r, nil
+}
+
+// varChanges returns the variables whose value differ between before and
+// after, sorted by name. Variables present in only one of the core dumps
+// are reported with an empty value in the other.
+func varChanges(before, after map[string]string) []VarChange {
+	var r []VarChange
+	for name, v := range before {
+		if after[name] != v {
+			r = append(r, VarChange{Name: name, Before: v, After: after[name]})
+		}
+	}
+	for name, v := range after {
+		if _, ok := before[name]; !ok {
+			r = append(r, VarChange{Name: name, After: v})
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return r
+}
+
+// heapObjects returns the number of live heap objects of each size class,
+// read from the allocation statistics of the runtime.
+func heapObjects(d *debugger.Debugger, cfg proc.LoadConfig) (map[string]int64, error) {
+	cfg.MaxArrayValues = 1024
+	cfg.MaxVariableRecurse = 2
+	v, err := d.EvalVariableInScope(api.EvalScope{GoroutineID: -1}, "runtime.memstats.by_size", cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not read heap statistics: %v", err)
+	}
+	r := make(map[string]int64)
+	for i := range v.Children {
+		var size, nmalloc, nfree uint64
+		for _, field := range v.Children[i].Children {
+			n, _ := strconv.ParseUint(field.Value, 10, 64)
+			switch field.Name {
+			case "size":
+				size = n
+			case "nmalloc":
+				nmalloc = n
+			case "nfree":
+				nfree = n
+			}
+		}
+		if size == 0 || nmalloc == nfree {
+			continue
+		}
+		r[fmt.Sprintf("%d bytes", size)] += int64(nmalloc - nfree)
+	}
+	return r, nil
+}
+
+// Print writes a human readable version of the report to w.
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Goroutines: %d -> %d (%+d)\n", r.GoroutinesBefore, r.GoroutinesAfter, r.GoroutinesAfter-r.GoroutinesBefore)
+	writeDeltas(w, "By state", r.ByState)
+	writeDeltas(w, "By go statement", r.ByGoStatement)
+
+	fmt.Fprintf(w, "\nPackage variables changed: %d\n", len(r.Vars))
+	for _, v := range r.Vars {
+		fmt.Fprintf(w, "\t%s\n\t\t- %s\n\t\t+ %s\n", v.Name, v.Before, v.After)
+	}
+
+	if r.HeapErr != nil {
+		fmt.Fprintf(w, "\nHeap objects: %v\n", r.HeapErr)
+		return
+	}
+	fmt.Fprintf(w, "\nHeap objects: %d -> %d (%+d)\n", r.HeapObjectsBefore, r.HeapObjectsAfter, r.HeapObjectsAfter-r.HeapObjectsBefore)
+	writeDeltas(w, "By size class", r.BySizeClass)
+}
+
+func writeDeltas(w io.Writer, title string, ds []Delta) {
+	if len(ds) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, d := range ds {
+		fmt.Fprintf(w, "\t%+6d  %6d -> %-6d  %s\n", d.After-d.Before, d.Before, d.After, d.Key)
+	}
+}
+
+// ValidateVars returns an error if vars is not a valid filter for
+// Config.Vars, so that it can be checked before opening the core dumps.
+func ValidateVars(vars string) error {
+	_, err := regexp.Compile(vars)
+	return err
+}
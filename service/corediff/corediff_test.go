@@ -0,0 +1,32 @@
+package corediff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeltas(t *testing.T) {
+	before := map[string]int64{"waiting": 10, "running": 2, "syscall": 1}
+	after := map[string]int64{"waiting": 110, "running": 2, "runnable": 3}
+	want := []Delta{
+		{Key: "waiting", Before: 10, After: 110},
+		{Key: "runnable", Before: 0, After: 3},
+		{Key: "syscall", Before: 1, After: 0},
+	}
+	if got := deltas(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestVarChanges(t *testing.T) {
+	before := map[string]string{"main.a": "1", "main.b": "\"x\"", "main.c": "nil"}
+	after := map[string]string{"main.a": "2", "main.b": "\"x\"", "main.d": "true"}
+	want := []VarChange{
+		{Name: "main.a", Before: "1", After: "2"},
+		{Name: "main.c", Before: "nil", After: ""},
+		{Name: "main.d", Before: "", After: "true"},
+	}
+	if got := varChanges(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,327 @@
+package dap
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/google/go-dap"
+)
+
+// This file implements the 'console' launch attribute, which gives the
+// target a terminal of the client, obtained with a 'runInTerminal' reverse
+// request, or forwards input sent by the client with 'stdin' requests
+// when a terminal is not available, and the 'outputMode' launch attribute,
+// which sends the output of the target to the client as 'output' events.
+
+const (
+	// terminalTimeout is how long to wait for the command run in the
+	// terminal of the client to report the name of its terminal.
+	terminalTimeout = 10 * time.Second
+	// stdinQueueLen is the number of 'stdin' requests whose data can wait
+	// for the target to read it.
+	stdinQueueLen = 64
+)
+
+// terminalScript is the command run in the terminal of the client. It
+// puts the terminal in raw mode, so that line editing and signals are
+// handled by the pseudo-terminal of the target, writes the name of the
+// terminal to the file $0 and waits until the server removes $0.
+const terminalScript = `stty raw -echo && tty > "$0.tmp" && mv "$0.tmp" "$0" && while [ -e "$0" ]; do sleep 1; done; stty sane`
+
+// terminalRelay connects the target to a terminal of the client. The
+// target is attached to a pseudo-terminal created by the server and all
+// input and output of its master side are copied to and from the terminal
+// of the client.
+type terminalRelay struct {
+	// dir contains the file reporting the name of the terminal of the
+	// client, the command run in that terminal exits when it is removed.
+	dir string
+	// pty and tty are the master and the slave of the pseudo-terminal.
+	// tty is kept open so that the pseudo-terminal survives restarts.
+	pty, tty *os.File
+	// term is the terminal of the client.
+	term *os.File
+}
+
+func (r *terminalRelay) Close() {
+	os.RemoveAll(r.dir)
+	r.term.Close()
+	r.pty.Close()
+	r.tty.Close()
+}
+
+// runInTerminal asks the client to run terminalScript in a terminal of
+// the specified kind ("integrated" or "external") and returns a relay to
+// that terminal.
+func (s *Server) runInTerminal(kind, cwd string) (*terminalRelay, error) {
+	dir, err := ioutil.TempDir("", "dlv-dap")
+	if err != nil {
+		return nil, err
+	}
+	ttyFile := filepath.Join(dir, "tty")
+
+	request := &dap.RunInTerminalRequest{Request: *s.newReverseRequest("runInTerminal")}
+	request.Arguments = dap.RunInTerminalRequestArguments{
+		Kind:  kind,
+		Title: "Go Debug Console",
+		Cwd:   cwd,
+		Args:  []string{"/bin/sh", "-c", terminalScript, ttyFile},
+	}
+	s.send(request)
+	response, err := s.waitForRunInTerminalResponse(request.Seq)
+	if err == nil && !response.Success {
+		err = errors.New(response.Message)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	var term []byte
+	for start := time.Now(); ; time.Sleep(100 * time.Millisecond) {
+		if term, err = ioutil.ReadFile(ttyFile); err == nil {
+			break
+		}
+		if time.Since(start) > terminalTimeout {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("the terminal did not start within %v", terminalTimeout)
+		}
+	}
+	relay, err := newTerminalRelay(dir, strings.TrimSpace(string(term)))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return relay, nil
+}
+
+// newReverseRequest returns a request sent from the server to the client.
+func (s *Server) newReverseRequest(command string) *dap.Request {
+	s.reverseSeq++
+	return &dap.Request{
+		ProtocolMessage: dap.ProtocolMessage{
+			Seq:  s.reverseSeq,
+			Type: "request",
+		},
+		Command: command,
+	}
+}
+
+// waitForRunInTerminalResponse reads messages until the response to the
+// 'runInTerminal' request seq arrives. Requests received in the meantime
+// are handled afterwards.
+func (s *Server) waitForRunInTerminalResponse(seq int) (*dap.RunInTerminalResponse, error) {
+	for {
+		message, ok := <-s.messages
+		if !ok {
+			return nil, errors.New("client connection closed")
+		}
+		if response, ok := message.(*dap.RunInTerminalResponse); ok && response.RequestSeq == seq {
+			return response, nil
+		}
+		s.deferred = append(s.deferred, message)
+	}
+}
+
+// stdinForwarder forwards the data of 'stdin' requests to the target,
+// through a named pipe used as its standard input.
+type stdinForwarder struct {
+	dir  string
+	path string
+
+	mu sync.Mutex
+	w  *os.File
+	// data is the queue of the writer goroutine, nil after the client
+	// sent an end of file.
+	data chan []byte
+}
+
+func newStdinForwarder() (*stdinForwarder, error) {
+	dir, err := ioutil.TempDir("", "dlv-dap")
+	if err != nil {
+		return nil, err
+	}
+	f := &stdinForwarder{dir: dir, path: filepath.Join(dir, "stdin")}
+	if err := mkfifo(f.path); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the pipe and starts the writer goroutine, if the client sent
+// an end of file since the last call.
+func (f *stdinForwarder) open() error {
+	if f.data != nil {
+		return nil
+	}
+	// Opening the pipe for reading and writing does not block and allows
+	// the target to open it for reading without blocking.
+	w, err := os.OpenFile(f.path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	data := make(chan []byte, stdinQueueLen)
+	f.w, f.data = w, data
+	go func() {
+		defer w.Close()
+		for b := range data {
+			if _, err := w.Write(b); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// reopen makes sure that a restarted target can read its standard input.
+func (f *stdinForwarder) reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.open()
+}
+
+// write queues data for the target and closes the pipe after it if eof is
+// set. It does not block if the target is not reading.
+func (f *stdinForwarder) write(data []byte, eof bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.data == nil {
+		return errors.New("standard input of the program is closed")
+	}
+	if len(data) > 0 {
+		select {
+		case f.data <- data:
+		default:
+			return errors.New("too much input waiting to be read by the program")
+		}
+	}
+	if eof {
+		close(f.data)
+		f.data = nil
+	}
+	return nil
+}
+
+func (f *stdinForwarder) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.data != nil {
+		close(f.data)
+		f.data = nil
+	}
+	// unblocks the writer goroutine if the target is not reading
+	f.w.Close()
+	os.RemoveAll(f.dir)
+}
+
+// setupConsole gives the target a terminal of the client, or forwards
+// 'stdin' requests to it if the client can not provide one.
+func (s *Server) setupConsole(kind, cwd string) {
+	if s.supportsRunInTerminal {
+		relay, err := s.runInTerminal(kind, cwd)
+		if err == nil {
+			s.terminal = relay
+			s.config.Debugger.TTY = relay.tty.Name()
+			return
+		}
+		s.log.Error("runInTerminal: ", err)
+		s.send(&dap.OutputEvent{
+			Event: *newEvent("output"),
+			Body: dap.OutputEventBody{
+				Output:   fmt.Sprintf("Could not run the program in a terminal: %v\n", err),
+				Category: "stderr",
+			}})
+	}
+	forwarder, err := newStdinForwarder()
+	if err != nil {
+		s.send(&dap.OutputEvent{
+			Event: *newEvent("output"),
+			Body: dap.OutputEventBody{
+				Output:   fmt.Sprintf("Could not forward input to the program: %v\n", err),
+				Category: "stderr",
+			}})
+		return
+	}
+	s.stdinMu.Lock()
+	s.stdin = forwarder
+	s.stdinMu.Unlock()
+	s.config.Debugger.Redirects[0] = forwarder.path
+	s.send(&dap.OutputEvent{
+		Event: *newEvent("output"),
+		Body: dap.OutputEventBody{
+			Output:   "Input for the program can be sent with 'stdin' requests.\n",
+			Category: "console",
+		}})
+}
+
+// closeConsole releases the terminal or the standard input of the target.
+func (s *Server) closeConsole() {
+	if s.terminal != nil {
+		s.terminal.Close()
+		s.terminal = nil
+	}
+	s.stdinMu.Lock()
+	defer s.stdinMu.Unlock()
+	if s.stdin != nil {
+		s.stdin.Close()
+		s.stdin = nil
+	}
+}
+
+// onStdinRequest handles 'stdin' requests. It is called by the goroutine
+// reading messages from the client, so that input reaches the target
+// while it is running.
+func (s *Server) onStdinRequest(request *StdinRequest) {
+	s.stdinMu.Lock()
+	forwarder := s.stdin
+	s.stdinMu.Unlock()
+	if forwarder == nil {
+		s.sendErrorResponse(request.Request, UnableToForwardStdin, "Unable to forward input",
+			"the program was not launched with a 'console' attribute or runs in a terminal")
+		return
+	}
+	if err := forwarder.write([]byte(request.Arguments.Data), request.Arguments.EOF); err != nil {
+		s.sendErrorResponseErr(request.Request, UnableToForwardStdin, "Unable to forward input", err)
+		return
+	}
+	s.send(&StdinResponse{Response: *newResponse(request.Request)})
+}
+
+// forwardOutput sends the output of the target streamed by the debugger,
+// see debugger.Config.StreamOutput, to the client as 'output' events
+// until the debugger detaches from the target or the server stops.
+func (s *Server) forwardOutput() {
+	var since uint64
+	for {
+		chunks, closed := s.debugger.Output(since, s.stopChan)
+		for _, chunk := range chunks {
+			category := "stdout"
+			if chunk.Stream == api.OutputStreamStderr {
+				category = "stderr"
+			}
+			s.send(&dap.OutputEvent{
+				Event: *newEvent("output"),
+				Body: dap.OutputEventBody{
+					Output:   string(chunk.Data),
+					Category: category,
+				}})
+			since = chunk.Seq
+		}
+		if closed || len(chunks) == 0 {
+			// Output only returns nothing when stopChan is closed.
+			return
+		}
+	}
+}
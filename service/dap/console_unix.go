@@ -0,0 +1,30 @@
+//+build !windows
+
+package dap
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+func newTerminalRelay(dir, term string) (*terminalRelay, error) {
+	t, err := os.OpenFile(term, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	ptm, pts, err := pty.Open()
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	go io.Copy(t, ptm)
+	go io.Copy(ptm, t)
+	return &terminalRelay{dir: dir, pty: ptm, tty: pts, term: t}, nil
+}
+
+func mkfifo(path string) error {
+	return syscall.Mkfifo(path, 0600)
+}
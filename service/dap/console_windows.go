@@ -0,0 +1,11 @@
+package dap
+
+import "errors"
+
+func newTerminalRelay(dir, term string) (*terminalRelay, error) {
+	return nil, errors.New("running the program in a terminal is not supported on windows")
+}
+
+func mkfifo(path string) error {
+	return errors.New("forwarding input to the program is not supported on windows")
+}
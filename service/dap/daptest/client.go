@@ -4,6 +4,8 @@ package daptest
 
 import (
 	"bufio"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
@@ -132,6 +134,83 @@ func (c *Client) ExpectLaunchResponse(t *testing.T) *dap.LaunchResponse {
 	return c.expectReadProtocolMessage(t).(*dap.LaunchResponse)
 }
 
+func (c *Client) ExpectAttachResponse(t *testing.T) *dap.AttachResponse {
+	t.Helper()
+	return c.expectReadProtocolMessage(t).(*dap.AttachResponse)
+}
+
+// ListProcessesResponse mirrors the response to the custom 'listProcesses'
+// request, which go-dap does not know how to decode.
+type ListProcessesResponse struct {
+	dap.Response
+
+	Body struct {
+		Processes []struct {
+			Pid       int    `json:"pid"`
+			Name      string `json:"name"`
+			Cmdline   string `json:"cmdline"`
+			GoVersion string `json:"goVersion"`
+		} `json:"processes"`
+	} `json:"body"`
+}
+
+func (c *Client) ExpectListProcessesResponse(t *testing.T) *ListProcessesResponse {
+	t.Helper()
+	var r ListProcessesResponse
+	c.expectCustomResponse(t, "listProcesses", &r)
+	return &r
+}
+
+// WriteMemoryResponse mirrors the response to a 'writeMemory' request,
+// which go-dap does not know how to decode.
+type WriteMemoryResponse struct {
+	dap.Response
+
+	Body struct {
+		Offset       int `json:"offset"`
+		BytesWritten int `json:"bytesWritten"`
+	} `json:"body"`
+}
+
+func (c *Client) ExpectWriteMemoryResponse(t *testing.T) *WriteMemoryResponse {
+	t.Helper()
+	var r WriteMemoryResponse
+	c.expectCustomResponse(t, "writeMemory", &r)
+	return &r
+}
+
+func (c *Client) ExpectStdinResponse(t *testing.T) *dap.Response {
+	t.Helper()
+	var r dap.Response
+	c.expectCustomResponse(t, "stdin", &r)
+	return &r
+}
+
+func (c *Client) ExpectRunInTerminalRequest(t *testing.T) *dap.RunInTerminalRequest {
+	t.Helper()
+	return c.expectReadProtocolMessage(t).(*dap.RunInTerminalRequest)
+}
+
+// expectCustomResponse reads a successful response to command, which
+// go-dap does not know how to decode, into r.
+func (c *Client) expectCustomResponse(t *testing.T, command string, r interface{}) {
+	t.Helper()
+	content, err := dap.ReadBaseMessage(c.reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp dap.Response
+	if err := json.Unmarshal(content, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Command != command {
+		t.Fatalf("got %s, want successful %s response", content, command)
+	}
+	if err := json.Unmarshal(content, r); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func (c *Client) ExpectSetExceptionBreakpointsResponse(t *testing.T) *dap.SetExceptionBreakpointsResponse {
 	t.Helper()
 	return c.expectReadProtocolMessage(t).(*dap.SetExceptionBreakpointsResponse)
@@ -314,13 +393,59 @@ func (c *Client) LaunchRequestWithArgs(arguments map[string]interface{}) {
 	c.send(request)
 }
 
-// AttachRequest sends an 'attach' request.
-func (c *Client) AttachRequest() {
-	request := &dap.AttachRequest{Request: *c.newRequest("attach")}
-	// TODO(polina): populate meaningful arguments
+// AttachRequest sends an 'attach' request with the specified args.
+func (c *Client) AttachRequest(mode string, processID int, stopOnEntry bool) {
+	c.AttachRequestWithArgs(map[string]interface{}{
+		"request":     "attach",
+		"mode":        mode,
+		"processId":   processID,
+		"stopOnEntry": stopOnEntry,
+	})
+}
+
+// AttachRequestWithArgs takes a map of untyped implementation-specific
+// arguments to send an 'attach' request. This version can be used to
+// test for values of unexpected types or unspecified values.
+func (c *Client) AttachRequestWithArgs(arguments map[string]interface{}) {
+	request := &struct {
+		dap.Request
+		Arguments map[string]interface{} `json:"arguments"`
+	}{Request: *c.newRequest("attach"), Arguments: arguments}
+	c.send(request)
+}
+
+// ListProcessesRequest sends a custom 'listProcesses' request.
+func (c *Client) ListProcessesRequest(goOnly bool) {
+	request := &struct {
+		dap.Request
+		Arguments map[string]interface{} `json:"arguments"`
+	}{Request: *c.newRequest("listProcesses"), Arguments: map[string]interface{}{"goOnly": goOnly}}
+	c.send(request)
+}
+
+// StdinRequest sends a custom 'stdin' request.
+func (c *Client) StdinRequest(data string, eof bool) {
+	request := &struct {
+		dap.Request
+		Arguments map[string]interface{} `json:"arguments"`
+	}{Request: *c.newRequest("stdin"), Arguments: map[string]interface{}{"data": data, "eof": eof}}
 	c.send(request)
 }
 
+// RunInTerminalResponse sends the response to the 'runInTerminal' request
+// with sequence number seq, with the error message if it is not empty.
+func (c *Client) RunInTerminalResponse(seq int, message string) {
+	response := &dap.RunInTerminalResponse{}
+	response.Type = "response"
+	response.Command = "runInTerminal"
+	response.Seq = c.seq
+	c.seq++
+	response.RequestSeq = seq
+	response.Success = message == ""
+	response.Message = message
+	c.send(response)
+}
+
 // DisconnectRequest sends a 'disconnect' request.
 func (c *Client) DisconnectRequest() {
 	request := &dap.DisconnectRequest{Request: *c.newRequest("disconnect")}
@@ -345,8 +470,22 @@ func (c *Client) SetBreakpointsRequest(file string, lines []int) {
 }
 
 // SetExceptionBreakpointsRequest sends a 'setExceptionBreakpoints' request.
-func (c *Client) SetExceptionBreakpointsRequest() {
-	request := &dap.SetBreakpointsRequest{Request: *c.newRequest("setExceptionBreakpoints")}
+func (c *Client) SetExceptionBreakpointsRequest(filters ...string) {
+	request := &dap.SetExceptionBreakpointsRequest{Request: *c.newRequest("setExceptionBreakpoints")}
+	request.Arguments.Filters = filters
+	c.send(request)
+}
+
+// SetExceptionBreakpointsRequestWithCondition sends a 'setExceptionBreakpoints'
+// request enabling only filterID, with the specified condition.
+func (c *Client) SetExceptionBreakpointsRequestWithCondition(filterID, condition string) {
+	request := &struct {
+		dap.Request
+		Arguments map[string]interface{} `json:"arguments"`
+	}{Request: *c.newRequest("setExceptionBreakpoints"), Arguments: map[string]interface{}{
+		"filters":       []string{},
+		"filterOptions": []map[string]string{{"filterId": filterID, "condition": condition}},
+	}}
 	c.send(request)
 }
 
@@ -496,8 +635,10 @@ func (c *Client) CompletionsRequest() {
 }
 
 // ExceptionInfoRequest sends a 'exceptionInfo' request.
-func (c *Client) ExceptionInfoRequest() {
-	c.send(&dap.ExceptionInfoRequest{Request: *c.newRequest("exceptionInfo")})
+func (c *Client) ExceptionInfoRequest(threadID int) {
+	request := &dap.ExceptionInfoRequest{Request: *c.newRequest("exceptionInfo")}
+	request.Arguments.ThreadId = threadID
+	c.send(request)
 }
 
 // LoadedSourcesRequest sends a 'loadedSources' request.
@@ -506,28 +647,57 @@ func (c *Client) LoadedSourcesRequest() {
 }
 
 // DataBreakpointInfoRequest sends a 'dataBreakpointInfo' request.
-func (c *Client) DataBreakpointInfoRequest() {
-	c.send(&dap.DataBreakpointInfoRequest{Request: *c.newRequest("dataBreakpointInfo")})
+func (c *Client) DataBreakpointInfoRequest(variablesReference int, name string) {
+	request := &dap.DataBreakpointInfoRequest{Request: *c.newRequest("dataBreakpointInfo")}
+	request.Arguments.VariablesReference = variablesReference
+	request.Arguments.Name = name
+	c.send(request)
 }
 
 // SetDataBreakpointsRequest sends a 'setDataBreakpoints' request.
-func (c *Client) SetDataBreakpointsRequest() {
-	c.send(&dap.SetDataBreakpointsRequest{Request: *c.newRequest("setDataBreakpoints")})
+func (c *Client) SetDataBreakpointsRequest(breakpoints []dap.DataBreakpoint) {
+	request := &dap.SetDataBreakpointsRequest{Request: *c.newRequest("setDataBreakpoints")}
+	request.Arguments.Breakpoints = breakpoints
+	c.send(request)
 }
 
 // ReadMemoryRequest sends a 'readMemory' request.
-func (c *Client) ReadMemoryRequest() {
-	c.send(&dap.ReadMemoryRequest{Request: *c.newRequest("readMemory")})
+func (c *Client) ReadMemoryRequest(memoryReference string, offset, count int) {
+	request := &dap.ReadMemoryRequest{Request: *c.newRequest("readMemory")}
+	request.Arguments.MemoryReference = memoryReference
+	request.Arguments.Offset = offset
+	request.Arguments.Count = count
+	c.send(request)
+}
+
+// WriteMemoryRequest sends a 'writeMemory' request.
+func (c *Client) WriteMemoryRequest(memoryReference string, offset int, data []byte) {
+	request := &struct {
+		dap.Request
+		Arguments map[string]interface{} `json:"arguments"`
+	}{Request: *c.newRequest("writeMemory"), Arguments: map[string]interface{}{
+		"memoryReference": memoryReference,
+		"offset":          offset,
+		"data":            base64.StdEncoding.EncodeToString(data),
+	}}
+	c.send(request)
 }
 
 // DisassembleRequest sends a 'disassemble' request.
-func (c *Client) DisassembleRequest() {
-	c.send(&dap.DisassembleRequest{Request: *c.newRequest("disassemble")})
+func (c *Client) DisassembleRequest(memoryReference string, instructionOffset, instructionCount int) {
+	request := &dap.DisassembleRequest{Request: *c.newRequest("disassemble")}
+	request.Arguments.MemoryReference = memoryReference
+	request.Arguments.InstructionOffset = instructionOffset
+	request.Arguments.InstructionCount = instructionCount
+	request.Arguments.ResolveSymbols = true
+	c.send(request)
 }
 
 // CancelRequest sends a 'cancel' request.
-func (c *Client) CancelRequest() {
-	c.send(&dap.CancelRequest{Request: *c.newRequest("cancel")})
+func (c *Client) CancelRequest(requestID int) {
+	request := &dap.CancelRequest{Request: *c.newRequest("cancel")}
+	request.Arguments.RequestId = requestID
+	c.send(request)
 }
 
 // BreakpointLocationsRequest sends a 'breakpointLocations' request.
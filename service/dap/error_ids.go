@@ -12,11 +12,20 @@ const (
 	// values below are inspired the original vscode-go debug adaptor.
 	FailedToLaunch            = 3000
 	FailedtoAttach            = 3001
+	FailedToRestart           = 3002
 	UnableToDisplayThreads    = 2003
 	UnableToProduceStackTrace = 2004
 	UnableToListLocals        = 2005
 	UnableToListArgs          = 2006
 	UnableToListGlobals       = 2007
 	UnableToLookupVariable    = 2008
+	UnableToListProcesses     = 2009
+	UnableToReadMemory        = 2010
+	UnableToWriteMemory       = 2011
+	UnableToDisassemble       = 2012
+	UnableToSetExceptionBPs   = 2013
+	UnableToGetExceptionInfo  = 2014
+	UnableToForwardStdin      = 2015
+	UnableToSetDataBPs        = 2016
 	// Add more codes as we support more requests
 )
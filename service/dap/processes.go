@@ -0,0 +1,12 @@
+//+build !linux
+
+package dap
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func listProcesses(goOnly bool) ([]Process, error) {
+	return nil, fmt.Errorf("listing processes is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,122 @@
+package dap
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// listProcesses returns the processes visible in /proc, excluding the
+// process of the server itself.
+func listProcesses(goOnly bool) ([]Process, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var r []Process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		dir := filepath.Join("/proc", entry.Name())
+		comm, err := ioutil.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil {
+			// the process exited while we were listing
+			continue
+		}
+		p := Process{Pid: pid, Name: strings.TrimSpace(string(comm))}
+		if cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+			p.Cmdline = strings.Join(strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"), " ")
+		}
+		p.GoVersion = readGoVersion(filepath.Join(dir, "exe"))
+		if goOnly && p.GoVersion == "" {
+			continue
+		}
+		r = append(r, p)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Pid < r[j].Pid })
+	return r, nil
+}
+
+var buildInfoMagic = []byte("\xff Go buildinf:")
+
+// maxGoVersionLen is the maximum length of a version string read by
+// readGoVersion, it protects against corrupted executables.
+const maxGoVersionLen = 128
+
+// readGoVersion returns the Go version recorded in the .go.buildinfo
+// section of the executable at path, or the empty string if the
+// executable was not built by Go 1.13 or later or can not be read.
+func readGoVersion(path string) string {
+	f, err := elf.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sec := f.Section(".go.buildinfo")
+	if sec == nil {
+		return ""
+	}
+	data, err := sec.Data()
+	if err != nil || len(data) < 32 || !bytes.HasPrefix(data, buildInfoMagic) {
+		return ""
+	}
+	ptrSize, flags := int(data[14]), data[15]
+
+	if flags&2 != 0 {
+		// Go 1.18 and later store the version inline, after the header,
+		// prefixed by its length.
+		n, k := binary.Uvarint(data[32:])
+		if k <= 0 || n > maxGoVersionLen || int(n) > len(data)-32-k {
+			return ""
+		}
+		return string(data[32+k : 32+k+int(n)])
+	}
+
+	// Older versions store a pointer to the string header of the version.
+	var bo binary.ByteOrder = binary.LittleEndian
+	if flags&1 != 0 {
+		bo = binary.BigEndian
+	}
+	readPtr := func(b []byte) uint64 {
+		if ptrSize == 4 {
+			return uint64(bo.Uint32(b))
+		}
+		return bo.Uint64(b)
+	}
+	if ptrSize != 4 && ptrSize != 8 {
+		return ""
+	}
+	hdr := readELFMemory(f, readPtr(data[16:]), uint64(2*ptrSize))
+	if hdr == nil {
+		return ""
+	}
+	n := readPtr(hdr[ptrSize:])
+	if n > maxGoVersionLen {
+		return ""
+	}
+	return string(readELFMemory(f, readPtr(hdr), n))
+}
+
+// readELFMemory reads size bytes at virtual address addr of the program
+// loaded from f.
+func readELFMemory(f *elf.File, addr, size uint64) []byte {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || addr < prog.Vaddr || addr+size > prog.Vaddr+prog.Filesz {
+			continue
+		}
+		b := make([]byte, size)
+		if _, err := prog.ReadAt(b, int64(addr-prog.Vaddr)); err != nil {
+			return nil
+		}
+		return b
+	}
+	return nil
+}
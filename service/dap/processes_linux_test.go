@@ -0,0 +1,20 @@
+package dap
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestReadGoVersion(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := readGoVersion(exe); v != runtime.Version() {
+		t.Errorf("got %q, want %q", v, runtime.Version())
+	}
+	if v := readGoVersion("/proc/self/cmdline"); v != "" {
+		t.Errorf("got %q for a file that is not an executable", v)
+	}
+}
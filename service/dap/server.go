@@ -10,19 +10,29 @@ package dap
 
 import (
 	"bufio"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
 	"reflect"
-
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-delve/delve/pkg/config"
 	"github.com/go-delve/delve/pkg/gobuild"
 	"github.com/go-delve/delve/pkg/logflags"
 	"github.com/go-delve/delve/pkg/proc"
 	"github.com/go-delve/delve/service"
 	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/audit"
 	"github.com/go-delve/delve/service/debugger"
 	"github.com/google/go-dap"
 	"github.com/sirupsen/logrus"
@@ -34,8 +44,11 @@ import (
 // (1) Main goroutine where the server is created via NewServer(),
 // started via Run() and stopped via Stop().
 // (2) Run goroutine started from Run() that accepts a client connection,
-// reads, decodes and processes each request, issuing commands to the
+// and processes each request, issuing commands to the
 // underlying debugger and sending back events and responses.
+// (3) Read goroutine that reads and decodes messages from the connection,
+// handling 'stdin' and 'cancel' requests directly so that they take effect
+// while other requests are being handled.
 // TODO(polina): make it asynchronous (i.e. launch goroutine per request)
 type Server struct {
 	// config is all the information necessary to start the debugger and server.
@@ -49,6 +62,35 @@ type Server struct {
 	stopChan chan struct{}
 	// reader is used to read requests from the connection.
 	reader *bufio.Reader
+	// messages receives the messages read from the connection, other
+	// than 'stdin' requests, and is closed when reading fails.
+	messages chan dap.Message
+	// deferred are the requests received while waiting for the response
+	// to a reverse request, to be handled next.
+	deferred []dap.Message
+	// sendMu serializes writes to the connection.
+	sendMu sync.Mutex
+	// reverseSeq is the sequence number of the last request sent to the client.
+	reverseSeq int
+	// supportsRunInTerminal is set if the client supports 'runInTerminal' requests.
+	supportsRunInTerminal bool
+	// terminal relays the terminal of the client used by the target, if any.
+	terminal *terminalRelay
+	// stdinMu guards stdin, which is also used by the goroutine reading
+	// from the connection.
+	stdinMu sync.Mutex
+	// stdin forwards 'stdin' requests to the target, if it was launched
+	// with a 'console' attribute but did not get a terminal.
+	stdin *stdinForwarder
+	// cancelMu guards the fields below, which are also used by the
+	// goroutine reading from the connection to handle 'cancel' requests.
+	cancelMu sync.Mutex
+	// currentSeq is the sequence number of the request being handled.
+	currentSeq int
+	// currentCancel is closed to cancel the request being handled.
+	currentCancel chan struct{}
+	// cancelled are the requests cancelled before being handled.
+	cancelled map[int]bool
 	// debugger is the underlying debugger service.
 	debugger *debugger.Debugger
 	// log is used for structured logging.
@@ -60,6 +102,9 @@ type Server struct {
 	// variableHandles maps compound variables to unique references within their stack frame.
 	// See also comment for convertVariable.
 	variableHandles *handlesMap
+	// dataBreakpoints are the IDs of the expression watches implementing
+	// the data breakpoints of the last 'setDataBreakpoints' request.
+	dataBreakpoints []int
 	// args tracks special settings for handling debug session requests.
 	args launchAttachArgs
 }
@@ -71,14 +116,38 @@ type launchAttachArgs struct {
 	stopOnEntry bool
 	// stackTraceDepth is the maximum length of the returned list of stack frames.
 	stackTraceDepth int
+	// maxGoroutines is the maximum number of goroutines returned by a
+	// threads request, so that targets with a huge number of goroutines
+	// do not overwhelm the client.
+	maxGoroutines int
+	// hideSystemGoroutines is set to omit the goroutines started by the
+	// runtime from threads responses.
+	hideSystemGoroutines bool
+	// onlyRunningGoroutines is set to omit the goroutines that were not
+	// running on a thread when the target stopped from threads responses.
+	onlyRunningGoroutines bool
+	// requestTimeout, if not zero, is how long requests can load variables
+	// before they are cancelled.
+	requestTimeout time.Duration
+	// stepSkipPackages are the packages that stepIn requests do not stop in,
+	// set by the stepSkipPackages and stepInstructionsSkipRuntime arguments.
+	stepSkipPackages []string
+	// showHiddenFrames is set to include the frames hidden by the frame
+	// filters of the debugger in stackTrace responses.
+	showHiddenFrames bool
 }
 
 // defaultArgs borrows the defaults for the arguments from the original vscode-go adapter.
 var defaultArgs = launchAttachArgs{
 	stopOnEntry:     false,
 	stackTraceDepth: 50,
+	maxGoroutines:   1 << 10,
 }
 
+// goroutinesPageSize is the number of goroutines loaded at a time while
+// handling a threads request.
+const goroutinesPageSize = 1 << 8
+
 // NewServer creates a new DAP Server. It takes an opened Listener
 // via config and assumes its ownership. config.disconnectChan has to be set;
 // it will be closed by the server when the client disconnects or requests
@@ -95,6 +164,7 @@ func NewServer(config *service.Config) *Server {
 		stackFrameHandles: newHandlesMap(),
 		variableHandles:   newHandlesMap(),
 		args:              defaultArgs,
+		cancelled:         make(map[int]bool),
 	}
 }
 
@@ -147,6 +217,7 @@ func (s *Server) signalDisconnect() {
 	if s.binaryToRemove != "" {
 		gobuild.Remove(s.binaryToRemove)
 	}
+	s.closeConsole()
 }
 
 // Run launches a new goroutine where it accepts a client connection
@@ -179,8 +250,97 @@ func (s *Server) Run() {
 func (s *Server) serveDAPCodec() {
 	defer s.signalDisconnect()
 	s.reader = bufio.NewReader(s.conn)
+	s.messages = make(chan dap.Message)
+	go s.readMessages()
+	for {
+		var request dap.Message
+		if len(s.deferred) > 0 {
+			request, s.deferred = s.deferred[0], s.deferred[1:]
+		} else {
+			var ok bool
+			if request, ok = <-s.messages; !ok {
+				return
+			}
+		}
+		if !s.startRequest(request) {
+			continue
+		}
+		s.handleRequest(request)
+		s.endRequest()
+	}
+}
+
+// startRequest makes request the request being handled, so that it can be
+// cancelled. If it was already cancelled it responds with an error and
+// returns false.
+func (s *Server) startRequest(message dap.Message) bool {
+	s.cancelMu.Lock()
+	defer s.cancelMu.Unlock()
+	seq := message.GetSeq()
+	if s.cancelled[seq] {
+		delete(s.cancelled, seq)
+		if request := reflect.ValueOf(message).Elem().FieldByName("Request"); request.IsValid() {
+			s.sendCancelledResponse(request.Interface().(dap.Request))
+		}
+		return false
+	}
+	s.currentSeq = seq
+	s.currentCancel = make(chan struct{})
+	if s.args.requestTimeout > 0 {
+		cancel := s.currentCancel
+		time.AfterFunc(s.args.requestTimeout, func() { s.cancel(seq, cancel) })
+	}
+	return true
+}
+
+func (s *Server) endRequest() {
+	s.cancelMu.Lock()
+	defer s.cancelMu.Unlock()
+	s.currentSeq = 0
+	s.currentCancel = nil
+}
+
+// cancel closes the channel of the request seq, if it is being handled.
+func (s *Server) cancel(seq int, cancel chan struct{}) {
+	s.cancelMu.Lock()
+	defer s.cancelMu.Unlock()
+	if s.currentSeq == seq && s.currentCancel == cancel {
+		close(cancel)
+		s.currentCancel = nil
+	}
+}
+
+// loadConfig returns cfg, cancelled along with the request being handled.
+func (s *Server) loadConfig(cfg proc.LoadConfig) proc.LoadConfig {
+	s.cancelMu.Lock()
+	defer s.cancelMu.Unlock()
+	if s.currentCancel != nil {
+		cfg.Cancel = s.currentCancel
+	} else {
+		// the request was already cancelled
+		cancelled := make(chan struct{})
+		close(cancelled)
+		cfg.Cancel = cancelled
+	}
+	return cfg
+}
+
+// requestCancelled returns true if seq is the request being handled and
+// it was cancelled.
+func (s *Server) requestCancelled(seq int) bool {
+	s.cancelMu.Lock()
+	defer s.cancelMu.Unlock()
+	return seq == s.currentSeq && s.currentCancel == nil
+}
+
+// readMessages reads and decodes messages from the connection, sending
+// them to s.messages, until it encounters an error or EOF, when it closes
+// s.messages.
+func (s *Server) readMessages() {
+	defer close(s.messages)
+	client := s.conn.RemoteAddr().String()
 	for {
-		request, err := dap.ReadProtocolMessage(s.reader)
+		message, err := s.readProtocolMessage()
 		// TODO(polina): Differentiate between errors and handle them
 		// gracefully. For example,
 		// -- "Request command 'foo' is not supported" means we
@@ -200,21 +360,93 @@ func (s *Server) serveDAPCodec() {
 			}
 			return
 		}
-		s.handleRequest(request)
+		if request, ok := message.(*dap.InitializeRequest); ok && request.Arguments.ClientID != "" {
+			client = fmt.Sprintf("%s (%s)", s.conn.RemoteAddr(), request.Arguments.ClientID)
+		}
+		s.auditRequest(client, message)
+		switch request := message.(type) {
+		case *StdinRequest:
+			s.onStdinRequest(request)
+			continue
+		case *dap.CancelRequest:
+			s.onCancelRequest(request)
+			continue
+		}
+		s.messages <- message
 	}
 }
 
+// auditedRequests are the requests recorded in the audit log because they
+// change the state of the target.
+var auditedRequests = map[string]bool{
+	"attach":                  true,
+	"configurationDone":       true,
+	"continue":                true,
+	"disconnect":              true,
+	"launch":                  true,
+	"next":                    true,
+	"pause":                   true,
+	"restart":                 true,
+	"setBreakpoints":          true,
+	"setDataBreakpoints":      true,
+	"setExceptionBreakpoints": true,
+	"setFunctionBreakpoints":  true,
+	"setVariable":             true,
+	"stdin":                   true,
+	"stepIn":                  true,
+	"stepOut":                 true,
+	"terminate":               true,
+	"writeMemory":             true,
+}
+
+// auditRequest records message in the audit log, if it is one of
+// auditedRequests.
+func (s *Server) auditRequest(client string, message dap.Message) {
+	if s.config.AuditLog == nil {
+		return
+	}
+	v := reflect.ValueOf(message).Elem()
+	field := v.FieldByName("Request")
+	if !field.IsValid() {
+		// a response to a reverse request
+		return
+	}
+	request, ok := field.Interface().(dap.Request)
+	if !ok || !auditedRequests[request.Command] {
+		return
+	}
+	e := audit.Entry{Client: client, API: "dap", Operation: request.Command}
+	if args := v.FieldByName("Arguments"); args.IsValid() {
+		e.Args = args.Interface()
+	}
+	s.config.AuditLog.Record(e)
+}
+
+// readProtocolMessage reads a message from the connection and decodes it,
+// including the requests that go-dap does not decode fully.
+func (s *Server) readProtocolMessage() (dap.Message, error) {
+	content, err := dap.ReadBaseMessage(s.reader)
+	if err != nil {
+		return nil, err
+	}
+	return decodeProtocolMessage(content)
+}
+
 func (s *Server) handleRequest(request dap.Message) {
 	defer func() {
 		// In case a handler panics, we catch the panic and send an error response
 		// back to the client.
 		if ierr := recover(); ierr != nil {
-			s.sendInternalErrorResponse(request.GetSeq(), fmt.Sprintf("%v", ierr))
+			details := fmt.Sprintf("%v", ierr)
+			s.sendInternalErrorResponse(request.GetSeq(), details+s.reportInternalError(details, string(debug.Stack())))
 		}
 	}()
 
 	jsonmsg, _ := json.Marshal(request)
 	s.log.Debug("[<- from client]", string(jsonmsg))
+	if s.debugger != nil {
+		s.debugger.RecordRequest(string(jsonmsg))
+	}
 
 	switch request := request.(type) {
 	case *dap.InitializeRequest:
@@ -223,9 +455,8 @@ func (s *Server) handleRequest(request dap.Message) {
 	case *dap.LaunchRequest:
 		// Required
 		s.onLaunchRequest(request)
-	case *dap.AttachRequest:
+	case *attachRequest:
 		// Required
-		// TODO: implement this request in V0
 		s.onAttachRequest(request)
 	case *dap.DisconnectRequest:
 		// Required
@@ -245,7 +476,7 @@ func (s *Server) handleRequest(request dap.Message) {
 		// Optional (capability ‘supportsFunctionBreakpoints’)
 		// TODO: implement this request in V1
 		s.onSetFunctionBreakpointsRequest(request)
-	case *dap.SetExceptionBreakpointsRequest:
+	case *setExceptionBreakpointsRequest:
 		// Optional (capability ‘exceptionBreakpointFilters’)
 		s.onSetExceptionBreakpointsRequest(request)
 	case *dap.ConfigurationDoneRequest:
@@ -326,25 +557,22 @@ func (s *Server) handleRequest(request dap.Message) {
 		s.sendUnsupportedErrorResponse(request.Request)
 	case *dap.ExceptionInfoRequest:
 		// Optional (capability ‘supportsExceptionInfoRequest’)
-		// TODO: does this request make sense for delve?
-		s.sendUnsupportedErrorResponse(request.Request)
+		s.onExceptionInfoRequest(request)
 	case *dap.LoadedSourcesRequest:
 		// Optional (capability ‘supportsLoadedSourcesRequest’)
 		// TODO: implement this request in V1
 		s.onLoadedSourcesRequest(request)
 	case *dap.DataBreakpointInfoRequest:
 		// Optional (capability ‘supportsDataBreakpoints’)
-		s.sendUnsupportedErrorResponse(request.Request)
+		s.onDataBreakpointInfoRequest(request)
 	case *dap.SetDataBreakpointsRequest:
 		// Optional (capability ‘supportsDataBreakpoints’)
-		s.sendUnsupportedErrorResponse(request.Request)
+		s.onSetDataBreakpointsRequest(request)
 	case *dap.ReadMemoryRequest:
 		// Optional (capability ‘supportsReadMemoryRequest‘)
-		// TODO: implement this request in V1
 		s.onReadMemoryRequest(request)
 	case *dap.DisassembleRequest:
 		// Optional (capability ‘supportsDisassembleRequest’)
-		// TODO: implement this request in V1
 		s.onDisassembleRequest(request)
 	case *dap.CancelRequest:
 		// Optional (capability ‘supportsCancelRequest’)
@@ -357,6 +585,12 @@ func (s *Server) handleRequest(request dap.Message) {
 		// Optional (capability ‘supportsModulesRequest’)
 		// TODO: does this request make sense for delve?
 		s.sendUnsupportedErrorResponse(request.Request)
+	case *WriteMemoryRequest:
+		// Optional (capability ‘supportsWriteMemoryRequest’)
+		s.onWriteMemoryRequest(request)
+	case *ListProcessesRequest:
+		// Custom request, not part of DAP
+		s.onListProcessesRequest(request)
 	default:
 		// This is a DAP message that go-dap has a struct for, so
 		// decoding succeeded, but this function does not know how
@@ -368,25 +602,34 @@ func (s *Server) handleRequest(request dap.Message) {
 func (s *Server) send(message dap.Message) {
 	jsonmsg, _ := json.Marshal(message)
 	s.log.Debug("[-> to client]", string(jsonmsg))
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
 	dap.WriteProtocolMessage(s.conn, message)
 }
 
 func (s *Server) onInitializeRequest(request *dap.InitializeRequest) {
 	// TODO(polina): Respond with an error if debug session is in progress?
-	response := &dap.InitializeResponse{Response: *newResponse(request.Request)}
+	s.supportsRunInTerminal = request.Arguments.SupportsRunInTerminalRequest
+	response := &initializeResponse{Response: *newResponse(request.Request)}
 	response.Body.SupportsConfigurationDoneRequest = true
+	response.Body.SupportsDelayedStackTraceLoading = true
+	response.Body.SupportsExceptionInfoRequest = true
+	response.Body.SupportsExceptionFilterOptions = true
+	response.Body.ExceptionBreakpointFilters = exceptionFilters
 	// TODO(polina): support this to match vscode-go functionality
 	response.Body.SupportsSetVariable = false
 	// TODO(polina): support these requests in addition to vscode-go feature parity
 	response.Body.SupportsTerminateRequest = false
-	response.Body.SupportsRestartRequest = false
+	response.Body.SupportsRestartRequest = true
 	response.Body.SupportsFunctionBreakpoints = false
 	response.Body.SupportsStepBack = false
 	response.Body.SupportsSetExpression = false
 	response.Body.SupportsLoadedSourcesRequest = false
-	response.Body.SupportsReadMemoryRequest = false
-	response.Body.SupportsDisassembleRequest = false
-	response.Body.SupportsCancelRequest = false
+	response.Body.SupportsReadMemoryRequest = true
+	response.Body.SupportsWriteMemoryRequest = !s.config.Debugger.ReadOnly
+	response.Body.SupportsDisassembleRequest = true
+	response.Body.SupportsCancelRequest = true
+	response.Body.SupportsDataBreakpoints = true
 	s.send(response)
 }
 
@@ -444,8 +687,18 @@ func (s *Server) onLaunchRequest(request *dap.LaunchRequest) {
 				fmt.Sprintf("Build error: %s", err.Error()))
 			return
 		}
+		// Record how the binary was built, so that it can be rebuilt
+		// by a restart request.
+		s.config.Debugger.ExecuteKind = debugger.ExecutingGeneratedFile
+		if mode == "test" {
+			s.config.Debugger.ExecuteKind = debugger.ExecutingGeneratedTest
+		}
+		s.config.Debugger.Packages = []string{program}
+		s.config.Debugger.BuildFlags = buildFlags
 		program = debugname
 		s.binaryToRemove = debugname
+	} else {
+		s.config.Debugger.ExecuteKind = debugger.ExecutingExistingFile
 	}
 
 	// TODO(polina): support "remote" mode
@@ -456,13 +709,7 @@ func (s *Server) onLaunchRequest(request *dap.LaunchRequest) {
 		return
 	}
 
-	stop, ok := request.Arguments["stopOnEntry"]
-	s.args.stopOnEntry = ok && stop == true
-
-	depth, ok := request.Arguments["stackTraceDepth"].(float64)
-	if ok && depth > 0 {
-		s.args.stackTraceDepth = int(depth)
-	}
+	s.setLaunchAttachArgs(request.Arguments)
 
 	var targetArgs []string
 	args, ok := request.Arguments["args"]
@@ -488,14 +735,53 @@ func (s *Server) onLaunchRequest(request *dap.LaunchRequest) {
 
 	s.config.ProcessArgs = append([]string{program}, targetArgs...)
 	s.config.Debugger.WorkingDir = filepath.Dir(program)
+	if cwd, ok := request.Arguments["cwd"].(string); ok && cwd != "" {
+		s.config.Debugger.WorkingDir = cwd
+	}
 
-	var err error
-	if s.debugger, err = debugger.New(&s.config.Debugger, s.config.ProcessArgs); err != nil {
+	sandbox, err := parseSandboxArgs(request.Arguments)
+	if err != nil {
+		s.sendErrorResponseErr(request.Request,
+			FailedToLaunch, "Failed to launch", err)
+		return
+	}
+	s.config.Debugger.Sandbox = sandbox
+
+	switch outputMode, _ := request.Arguments["outputMode"].(string); outputMode {
+	case "", "local":
+	case "remote":
+		s.config.Debugger.StreamOutput = true
+	default:
 		s.sendErrorResponse(request.Request,
-			FailedToLaunch, "Failed to launch", err.Error())
+			FailedToLaunch, "Failed to launch",
+			fmt.Sprintf("Unsupported 'outputMode' value %q in debug configuration.", outputMode))
 		return
 	}
 
+	console, ok := request.Arguments["console"]
+	if ok && console != "internalConsole" {
+		switch console {
+		case "integratedTerminal":
+			s.setupConsole("integrated", s.config.Debugger.WorkingDir)
+		case "externalTerminal":
+			s.setupConsole("external", s.config.Debugger.WorkingDir)
+		default:
+			s.sendErrorResponse(request.Request,
+				FailedToLaunch, "Failed to launch",
+				fmt.Sprintf("Unsupported 'console' value %v in debug configuration.", console))
+			return
+		}
+	}
+
+	if s.debugger, err = debugger.New(&s.config.Debugger, s.config.ProcessArgs); err != nil {
+		s.sendErrorResponseErr(request.Request,
+			FailedToLaunch, "Failed to launch", err)
+		return
+	}
+	if s.config.Debugger.StreamOutput {
+		go s.forwardOutput()
+	}
+
 	// Notify the client that the debugger is ready to start accepting
 	// configuration requests for setting breakpoints, etc. The client
 	// will end the configuration sequence with 'configurationDone'.
@@ -503,6 +789,167 @@ func (s *Server) onLaunchRequest(request *dap.LaunchRequest) {
 	s.send(&dap.LaunchResponse{Response: *newResponse(request.Request)})
 }
 
+// parseSandboxArgs returns the sandbox of the process specified by the
+// arguments of a launch request, nil if they do not specify any:
+//   - env, an object mapping names to values, adds variables to the
+//     environment of the process
+//   - envMode, "inherit", "clear" or "allowlist", and envAllow, a list of
+//     names, select the variables it inherits from the environment of Delve
+//   - rlimits, an object mapping resources to limits, as "soft[:hard]"
+//     strings or numbers, sets its resource limits
+//   - user and group set its credentials
+//   - unshare, a list of namespaces, creates new namespaces for it
+func parseSandboxArgs(args map[string]interface{}) (*proc.Sandbox, error) {
+	sandbox := &proc.Sandbox{}
+	stringList := func(name string) ([]string, error) {
+		v, ok := args[name]
+		if !ok {
+			return nil, nil
+		}
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'%s' attribute '%v' in debug configuration is not an array.", name, v)
+		}
+		r := make([]string, 0, len(list))
+		for _, elem := range list {
+			str, ok := elem.(string)
+			if !ok {
+				return nil, fmt.Errorf("value '%v' in '%s' attribute in debug configuration is not a string.", elem, name)
+			}
+			r = append(r, str)
+		}
+		return r, nil
+	}
+	stringMap := func(name string) (map[string]interface{}, error) {
+		v, ok := args[name]
+		if !ok || v == nil {
+			return nil, nil
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'%s' attribute '%v' in debug configuration is not an object.", name, v)
+		}
+		return m, nil
+	}
+
+	env, err := stringMap("env")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, ok := env[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("value '%v' of '%s' in 'env' attribute in debug configuration is not a string.", env[name], name)
+		}
+		sandbox.Env = append(sandbox.Env, name+"="+value)
+	}
+
+	if mode, ok := args["envMode"].(string); ok {
+		sandbox.EnvMode = proc.EnvMode(mode)
+		switch sandbox.EnvMode {
+		case "", proc.EnvInherit, proc.EnvClear, proc.EnvAllowlist:
+		default:
+			return nil, fmt.Errorf("Unsupported 'envMode' value %q in debug configuration.", mode)
+		}
+	}
+	if sandbox.EnvAllow, err = stringList("envAllow"); err != nil {
+		return nil, err
+	}
+
+	rlimits, err := stringMap("rlimits")
+	if err != nil {
+		return nil, err
+	}
+	for resource, v := range rlimits {
+		var limit string
+		switch v := v.(type) {
+		case string:
+			limit = v
+		case float64:
+			limit = strconv.FormatUint(uint64(v), 10)
+		default:
+			return nil, fmt.Errorf("value '%v' of '%s' in 'rlimits' attribute in debug configuration is not a string or a number.", v, resource)
+		}
+		r, err := proc.ParseRlimit(resource + "=" + limit)
+		if err != nil {
+			return nil, err
+		}
+		sandbox.Rlimits = append(sandbox.Rlimits, r)
+	}
+	sort.Slice(sandbox.Rlimits, func(i, j int) bool { return sandbox.Rlimits[i].Resource < sandbox.Rlimits[j].Resource })
+
+	sandbox.User, _ = args["user"].(string)
+	sandbox.Group, _ = args["group"].(string)
+	if sandbox.Namespaces, err = stringList("unshare"); err != nil {
+		return nil, err
+	}
+
+	if sandbox.Empty() {
+		return nil, nil
+	}
+	return sandbox, nil
+}
+
+// setLaunchAttachArgs sets s.args, and the frame filters of the debugger,
+// from the arguments of a launch or attach request, values of the wrong
+// type are ignored.
+func (s *Server) setLaunchAttachArgs(args map[string]interface{}) {
+	stop, ok := args["stopOnEntry"]
+	s.args.stopOnEntry = ok && stop == true
+
+	depth, ok := args["stackTraceDepth"].(float64)
+	if ok && depth > 0 {
+		s.args.stackTraceDepth = int(depth)
+	}
+
+	maxGoroutines, ok := args["maxGoroutines"].(float64)
+	if ok && maxGoroutines > 0 {
+		s.args.maxGoroutines = int(maxGoroutines)
+	}
+
+	hide, ok := args["hideSystemGoroutines"]
+	s.args.hideSystemGoroutines = ok && hide == true
+
+	running, ok := args["onlyRunningGoroutines"]
+	s.args.onlyRunningGoroutines = ok && running == true
+
+	timeout, ok := args["requestTimeout"].(float64)
+	if ok && timeout > 0 {
+		s.args.requestTimeout = time.Duration(timeout) * time.Millisecond
+	}
+
+	show, ok := args["showHiddenFrames"]
+	s.args.showHiddenFrames = ok && show == true
+
+	s.args.stepSkipPackages = nil
+	if skip, ok := args["stepInstructionsSkipRuntime"]; ok && skip == true {
+		s.args.stepSkipPackages = append(s.args.stepSkipPackages, config.RuntimePackages...)
+	}
+	s.args.stepSkipPackages = append(s.args.stepSkipPackages, stringsArg(args, "stepSkipPackages")...)
+
+	if filters := stringsArg(args, "frameFilters"); filters != nil {
+		s.config.Debugger.FrameFilters = filters
+	}
+}
+
+// stringsArg returns the strings in the array argument name of a launch or
+// attach request, ignoring the values of the wrong type.
+func stringsArg(args map[string]interface{}, name string) []string {
+	list, _ := args[name].([]interface{})
+	var r []string
+	for _, v := range list {
+		if str, ok := v.(string); ok {
+			r = append(r, str)
+		}
+	}
+	return r
+}
+
 // onDisconnectRequest handles the DisconnectRequest. Per the DAP spec,
 // it disconnects the debuggee and signals that the debug adaptor
 // (in our case this TCP server) can be terminated.
@@ -548,12 +995,141 @@ func (s *Server) onSetBreakpointsRequest(request *dap.SetBreakpointsRequest) {
 	s.send(response)
 }
 
-func (s *Server) onSetExceptionBreakpointsRequest(request *dap.SetExceptionBreakpointsRequest) {
-	// Unlike what DAP documentation claims, this request is always sent
-	// even though we specified no filters at initialization. Handle as no-op.
+// exceptionFilters are the exception breakpoint filters advertised in the
+// 'initialize' response, each one controls the proc-level breakpoint of
+// the same index in exceptionBreakpoints.
+var exceptionFilters = []exceptionBreakpointsFilter{
+	{
+		ExceptionBreakpointsFilter: dap.ExceptionBreakpointsFilter{Filter: "panic", Label: "Unrecovered panics", Default: true},
+		SupportsCondition:          true,
+		ConditionDescription:       "Expression evaluated when the program panics, the panic value is runtime.curg._panic.arg. E.g. runtime.curg._panic.arg.(string) == \"boom\"",
+	},
+	{
+		ExceptionBreakpointsFilter: dap.ExceptionBreakpointsFilter{Filter: "fatal", Label: "Fatal runtime errors", Default: true},
+	},
+}
+
+var exceptionBreakpoints = []string{proc.UnrecoveredPanic, proc.FatalThrow}
+
+// onSetExceptionBreakpointsRequest handles 'setExceptionBreakpoints'
+// requests by setting the condition of the unrecovered-panic and
+// fatal-throw breakpoints. The breakpoints of disabled filters get an
+// always false condition.
+func (s *Server) onSetExceptionBreakpointsRequest(request *setExceptionBreakpointsRequest) {
+	if s.debugger == nil {
+		s.sendErrorResponse(request.Request, UnableToSetExceptionBPs, "Unable to set exception breakpoints", "debugger is nil")
+		return
+	}
+	for i, filter := range exceptionFilters {
+		enabled, cond := false, ""
+		for _, f := range request.Arguments.Filters {
+			enabled = enabled || f == filter.Filter
+		}
+		for _, opt := range request.Arguments.FilterOptions {
+			if opt.FilterId == filter.Filter {
+				enabled, cond = true, opt.Condition
+			}
+		}
+		if !enabled {
+			cond = "false"
+		}
+		bp := s.debugger.FindBreakpointByName(exceptionBreakpoints[i])
+		if bp == nil {
+			// Not all the runtime functions are present, for example in
+			// programs built with an old version of Go.
+			continue
+		}
+		bp.Cond = cond
+		if err := s.debugger.AmendBreakpoint(bp); err != nil {
+			s.sendErrorResponseWithCode(request.Request, UnableToSetExceptionBPs, "Unable to set exception breakpoints",
+				fmt.Sprintf("invalid condition for %q: %v", filter.Filter, err), api.ErrorCodeOf(err))
+			return
+		}
+	}
 	s.send(&dap.SetExceptionBreakpointsResponse{Response: *newResponse(request.Request)})
 }
 
+// onExceptionInfoRequest handles 'exceptionInfo' requests.
+// Capability 'supportsExceptionInfoRequest' is set in 'initialize' response.
+// It describes the panic or fatal error that stopped the goroutine.
+func (s *Server) onExceptionInfoRequest(request *dap.ExceptionInfoRequest) {
+	goroutineID := request.Arguments.ThreadId
+	bpName := s.exceptionBreakpoint(goroutineID)
+	if bpName == "" {
+		s.sendErrorResponse(request.Request, UnableToGetExceptionInfo, "Unable to get exception info",
+			fmt.Sprintf("goroutine %d is not stopped by a panic or a fatal error", goroutineID))
+		return
+	}
+
+	body := dap.ExceptionInfoResponseBody{BreakMode: "unhandled"}
+	cfg := s.loadConfig(proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 256, MaxArrayValues: 16, MaxStructFields: -1})
+	frames, err := s.debugger.Stacktrace(goroutineID, s.args.stackTraceDepth, 0, nil)
+	switch bpName {
+	case proc.UnrecoveredPanic:
+		body.ExceptionId = "panic"
+		v, err := s.debugger.EvalVariableInScope(api.EvalScope{GoroutineID: goroutineID}, "runtime.curg._panic.arg", cfg)
+		if err != nil {
+			body.Description = fmt.Sprintf("unreadable panic value: %v", err)
+			break
+		}
+		body.Description = v.SinglelineString()
+		body.Details.EvaluateName = "runtime.curg._panic.arg"
+		if v.Kind == reflect.Interface && len(v.Children) > 0 {
+			body.Details.TypeName = v.Children[0].Type
+		}
+	case proc.FatalThrow:
+		body.ExceptionId = "fatal error"
+		// The message is the argument of runtime.throw.
+		for i, frame := range frames {
+			if frame.Function == nil || frame.Function.Name() != "runtime.throw" {
+				continue
+			}
+			if v, err := s.debugger.EvalVariableInScope(api.EvalScope{GoroutineID: goroutineID, Frame: i}, "s", cfg); err == nil {
+				body.Description = v.Value
+			}
+			break
+		}
+	}
+	body.Details.Message = body.Description
+	body.Details.FullTypeName = body.Details.TypeName
+	if err == nil {
+		var buf strings.Builder
+		for _, frame := range frames {
+			fnname := "?"
+			if frame.Function != nil {
+				fnname = frame.Function.Name()
+			}
+			fmt.Fprintf(&buf, "%s\n\t%s:%d\n", fnname, frame.File, frame.Line)
+		}
+		body.Details.StackTrace = buf.String()
+	}
+
+	s.send(&dap.ExceptionInfoResponse{Response: *newResponse(request.Request), Body: body})
+}
+
+// exceptionBreakpoint returns the name of the exception breakpoint at which
+// the thread running the specified goroutine is stopped, if any.
+func (s *Server) exceptionBreakpoint(goroutineID int) string {
+	if s.debugger == nil {
+		return ""
+	}
+	state, err := s.debugger.State( /*nowait*/ true)
+	if err != nil {
+		return ""
+	}
+	for _, th := range state.Threads {
+		if th.GoroutineID != goroutineID || th.Breakpoint == nil {
+			continue
+		}
+		for _, name := range exceptionBreakpoints {
+			if th.Breakpoint.Name == name {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
 func (s *Server) onConfigurationDoneRequest(request *dap.ConfigurationDoneRequest) {
 	if s.args.stopOnEntry {
 		e := &dap.StoppedEvent{
@@ -580,7 +1156,7 @@ func (s *Server) onThreadsRequest(request *dap.ThreadsRequest) {
 		s.sendErrorResponse(request.Request, UnableToDisplayThreads, "Unable to display threads", "debugger is nil")
 		return
 	}
-	gs, _, err := s.debugger.Goroutines(0, 0)
+	gs, truncated, err := s.goroutines()
 	if err != nil {
 		switch err.(type) {
 		case *proc.ErrProcessExited:
@@ -588,11 +1164,20 @@ func (s *Server) onThreadsRequest(request *dap.ThreadsRequest) {
 			// A TerminatedEvent has already been sent. Ignore the err returned in this case.
 			s.send(&dap.ThreadsResponse{Response: *newResponse(request.Request)})
 		default:
-			s.sendErrorResponse(request.Request, UnableToDisplayThreads, "Unable to display threads", err.Error())
+			s.sendErrorResponseErr(request.Request, UnableToDisplayThreads, "Unable to display threads", err)
 		}
 		return
 	}
 
+	if truncated {
+		s.send(&dap.OutputEvent{
+			Event: *newEvent("output"),
+			Body: dap.OutputEventBody{
+				Output:   fmt.Sprintf("Too many goroutines, only %d are shown. Use the 'maxGoroutines' attribute in debug configuration to change the limit.\n", s.args.maxGoroutines),
+				Category: "console",
+			}})
+	}
+
 	threads := make([]dap.Thread, len(gs))
 	if len(threads) == 0 {
 		// Depending on the debug session stage, goroutines information
@@ -618,10 +1203,141 @@ func (s *Server) onThreadsRequest(request *dap.ThreadsRequest) {
 	s.send(response)
 }
 
-// onAttachRequest sends a not-yet-implemented error response.
+// goroutines returns the goroutines to report in a threads response: at
+// most s.args.maxGoroutines of the goroutines not excluded by the filters
+// in s.args, loaded one page at a time, followed by the selected goroutine
+// and the goroutines stopped at a breakpoint, which are always reported.
+// truncated is set if some goroutines were not loaded because of the limit.
+func (s *Server) goroutines() (gs []*api.Goroutine, truncated bool, err error) {
+	seen := make(map[int]bool)
+	for start := 0; start >= 0 && len(gs) < s.args.maxGoroutines; {
+		var page []*api.Goroutine
+		page, start, err = s.debugger.Goroutines(start, goroutinesPageSize)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, g := range page {
+			if !s.showGoroutine(g) {
+				continue
+			}
+			if len(gs) >= s.args.maxGoroutines {
+				truncated = true
+				break
+			}
+			gs = append(gs, g)
+			seen[g.ID] = true
+		}
+		if start >= 0 && len(gs) >= s.args.maxGoroutines {
+			truncated = true
+		}
+	}
+
+	state, err := s.debugger.State(true)
+	if err != nil {
+		// The threads request is answered even if the state is not
+		// available, for example because the target exited.
+		return gs, truncated, nil
+	}
+	if g := state.SelectedGoroutine; g != nil && !seen[g.ID] {
+		gs = append(gs, g)
+		seen[g.ID] = true
+	}
+	for _, th := range state.Threads {
+		if th.Breakpoint == nil || th.GoroutineID == 0 || seen[th.GoroutineID] {
+			continue
+		}
+		if g, err := s.debugger.FindGoroutine(th.GoroutineID); err == nil && g != nil {
+			gs = append(gs, g)
+			seen[g.ID] = true
+		}
+	}
+	return gs, truncated, nil
+}
+
+// showGoroutine returns false if g is excluded from threads responses by
+// the filters in s.args.
+func (s *Server) showGoroutine(g *api.Goroutine) bool {
+	if s.args.hideSystemGoroutines && isSystemGoroutine(g) {
+		return false
+	}
+	if s.args.onlyRunningGoroutines && g.ThreadID == 0 {
+		return false
+	}
+	return true
+}
+
+// isSystemGoroutine returns true if g was started by the runtime, other
+// than the main goroutine.
+func isSystemGoroutine(g *api.Goroutine) bool {
+	fn := g.StartLoc.Function
+	return fn != nil && strings.HasPrefix(fn.Name(), "runtime.") && fn.Name() != "runtime.main"
+}
+
+// onAttachRequest handles 'attach' request.
 // This is a mandatory request to support.
-func (s *Server) onAttachRequest(request *dap.AttachRequest) { // TODO V0
-	s.sendNotYetImplementedErrorResponse(request.Request)
+// Only the "local" mode is supported, which attaches to the process with
+// the specified processId running on the same machine as the server. A
+// remote client can choose a process from those reported by the
+// 'listProcesses' request.
+func (s *Server) onAttachRequest(request *attachRequest) {
+	// TODO(polina): Respond with an error if debug session is in progress?
+
+	mode, ok := request.Arguments["mode"]
+	if !ok || mode == "" {
+		mode = "local"
+	}
+	if mode != "local" {
+		s.sendErrorResponse(request.Request,
+			FailedtoAttach, "Failed to attach",
+			fmt.Sprintf("Unsupported 'mode' value %q in debug configuration.", mode))
+		return
+	}
+
+	var pid int
+	switch processID := request.Arguments["processId"].(type) {
+	case float64:
+		pid = int(processID)
+	case string:
+		// VS Code process pickers return the pid as a string.
+		pid, _ = strconv.Atoi(processID)
+	}
+	if pid <= 0 {
+		s.sendErrorResponse(request.Request,
+			FailedtoAttach, "Failed to attach",
+			"The 'processId' attribute is missing in debug configuration.")
+		return
+	}
+
+	s.setLaunchAttachArgs(request.Arguments)
+
+	s.config.Debugger.AttachPid = pid
+	var err error
+	if s.debugger, err = debugger.New(&s.config.Debugger, nil); err != nil {
+		s.config.Debugger.AttachPid = 0
+		s.sendErrorResponseErr(request.Request,
+			FailedtoAttach, "Failed to attach", err)
+		return
+	}
+
+	// Notify the client that the debugger is ready to start accepting
+	// configuration requests for setting breakpoints, etc. The client
+	// will end the configuration sequence with 'configurationDone'.
+	s.send(&dap.InitializedEvent{Event: *newEvent("initialized")})
+	s.send(&dap.AttachResponse{Response: *newResponse(request.Request)})
+}
+
+// onListProcessesRequest handles the custom 'listProcesses' request.
+func (s *Server) onListProcessesRequest(request *ListProcessesRequest) {
+	processes, err := listProcesses(request.Arguments.GoOnly)
+	if err != nil {
+		s.sendErrorResponseErr(request.Request, UnableToListProcesses, "Unable to list processes", err)
+		return
+	}
+	response := &ListProcessesResponse{
+		Response: *newResponse(request.Request),
+		Body:     ListProcessesResponseBody{Processes: processes},
+	}
+	s.send(response)
 }
 
 // onNextRequest handles 'next' request.
@@ -668,21 +1384,37 @@ type stackFrame struct {
 // This is a mandatory request to support.
 func (s *Server) onStackTraceRequest(request *dap.StackTraceRequest) {
 	goroutineID := request.Arguments.ThreadId
-	locs, err := s.debugger.Stacktrace(goroutineID, s.args.stackTraceDepth, 0, nil /*skip locals & args*/)
+	// Only load the frames requested, plus one to tell the client whether
+	// there are more. Clients supporting delayed stack trace loading can
+	// request the remaining frames later.
+	depth := s.args.stackTraceDepth
+	if levels := request.Arguments.Levels; levels > 0 && max(request.Arguments.StartFrame, 0)+levels < depth {
+		depth = max(request.Arguments.StartFrame, 0) + levels + 1
+	}
+	var opts api.StacktraceOptions
+	if s.args.showHiddenFrames {
+		opts |= api.StacktraceShowHidden
+	}
+	locs, err := s.debugger.Stacktrace(goroutineID, depth, opts, nil /*skip locals & args*/)
 	if err != nil {
-		s.sendErrorResponse(request.Request, UnableToProduceStackTrace, "Unable to produce stack trace", err.Error())
+		s.sendErrorResponseErr(request.Request, UnableToProduceStackTrace, "Unable to produce stack trace", err)
 		return
 	}
 
 	stackFrames := make([]dap.StackFrame, len(locs))
+	frameIndex := -1
 	for i, loc := range locs {
-		uniqueStackFrameID := s.stackFrameHandles.create(stackFrame{goroutineID, i})
+		// frames hidden by the frame filters of the debugger still count
+		// when selecting a frame by index
+		frameIndex += 1 + loc.Hidden
+		uniqueStackFrameID := s.stackFrameHandles.create(stackFrame{goroutineID, frameIndex})
 		stackFrames[i] = dap.StackFrame{Id: uniqueStackFrameID, Line: loc.Line}
 		stackFrames[i].Name = loc.Function.Name()
 		if loc.File != "<autogenerated>" {
 			stackFrames[i].Source = dap.Source{Name: filepath.Base(loc.File), Path: loc.File}
 		}
 		stackFrames[i].Column = 0
+		stackFrames[i].InstructionPointerReference = fmt.Sprintf("%#x", loc.PC)
 	}
 	if request.Arguments.StartFrame > 0 {
 		stackFrames = stackFrames[min(request.Arguments.StartFrame, len(stackFrames)):]
@@ -708,12 +1440,12 @@ func (s *Server) onScopesRequest(request *dap.ScopesRequest) {
 
 	scope := api.EvalScope{GoroutineID: sf.(stackFrame).goroutineID, Frame: sf.(stackFrame).frameIndex}
 	// TODO(polina): Support setting config via launch/attach args
-	cfg := proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1}
+	cfg := s.loadConfig(proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1})
 
 	// Retrieve arguments
 	args, err := s.debugger.FunctionArguments(scope, cfg)
 	if err != nil {
-		s.sendErrorResponse(request.Request, UnableToListArgs, "Unable to list args", err.Error())
+		s.sendErrorResponseErr(request.Request, UnableToListArgs, "Unable to list args", err)
 		return
 	}
 	argScope := api.Variable{Name: "Arguments", Children: args}
@@ -721,7 +1453,7 @@ func (s *Server) onScopesRequest(request *dap.ScopesRequest) {
 	// Retrieve local variables
 	locals, err := s.debugger.LocalVariables(scope, cfg)
 	if err != nil {
-		s.sendErrorResponse(request.Request, UnableToListLocals, "Unable to list local vars", err.Error())
+		s.sendErrorResponseErr(request.Request, UnableToListLocals, "Unable to list local vars", err)
 		return
 	}
 	locScope := api.Variable{Name: "Locals", Children: locals}
@@ -769,17 +1501,20 @@ func (s *Server) onVariablesRequest(request *dap.VariablesRequest) {
 					Name:               fmt.Sprintf("[key %d]", kvIndex),
 					Value:              key,
 					VariablesReference: keyref,
+					MemoryReference:    memoryReference(v.Children[i]),
 				}
 				valvar := dap.Variable{
 					Name:               fmt.Sprintf("[val %d]", kvIndex),
 					Value:              val,
 					VariablesReference: valref,
+					MemoryReference:    memoryReference(v.Children[i+1]),
 				}
 				children = append(children, keyvar, valvar)
 			} else { // At least one is a scalar
 				kvvar := dap.Variable{
-					Name:  key,
-					Value: val,
+					Name:            key,
+					Value:           val,
+					MemoryReference: memoryReference(v.Children[i+1]),
 				}
 				if keyref != 0 { // key is a type to be expanded
 					kvvar.Name = fmt.Sprintf("%s[%d]", kvvar.Name, kvIndex) // Make the name unique
@@ -798,6 +1533,7 @@ func (s *Server) onVariablesRequest(request *dap.VariablesRequest) {
 				Name:               fmt.Sprintf("[%d]", i),
 				Value:              value,
 				VariablesReference: varref,
+				MemoryReference:    memoryReference(c),
 			}
 		}
 	default:
@@ -808,6 +1544,7 @@ func (s *Server) onVariablesRequest(request *dap.VariablesRequest) {
 				Name:               c.Name,
 				Value:              value,
 				VariablesReference: variablesReference,
+				MemoryReference:    memoryReference(c),
 			}
 		}
 	}
@@ -907,6 +1644,26 @@ func (s *Server) convertVariable(v api.Variable) (value string, variablesReferen
 	return
 }
 
+// memoryReference returns the reference to the memory of v, which can
+// be used in 'readMemory' and 'writeMemory' requests, or the empty string
+// if v does not live in memory.
+func memoryReference(v api.Variable) string {
+	if v.Addr == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%#x", v.Addr)
+}
+
+// parseMemoryReference returns the address referenced by ref, a memory
+// reference sent to the client, plus offset.
+func parseMemoryReference(ref string, offset int) (uintptr, error) {
+	addr, err := strconv.ParseUint(ref, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory reference %q", ref)
+	}
+	return uintptr(int64(addr) + int64(offset)), nil
+}
+
 // onEvaluateRequest sends a not-yet-implemented error response.
 // This is a mandatory request to support.
 func (s *Server) onEvaluateRequest(request *dap.EvaluateRequest) { // TODO V0
@@ -919,10 +1676,47 @@ func (s *Server) onTerminateRequest(request *dap.TerminateRequest) {
 	s.sendNotYetImplementedErrorResponse(request.Request)
 }
 
-// onRestartRequest sends a not-yet-implemented error response
-// Capability 'supportsRestartRequest' is not set in 'initialize' response.
+// onRestartRequest restarts the target process, keeping the debug session
+// and its breakpoints. In debug and test modes the program is rebuilt
+// first, so that the restarted process runs the current sources.
+// Breakpoints that can no longer be set are reported via output events.
 func (s *Server) onRestartRequest(request *dap.RestartRequest) {
-	s.sendNotYetImplementedErrorResponse(request.Request)
+	if s.debugger == nil {
+		s.sendErrorResponse(request.Request, FailedToRestart, "Failed to restart", "no debug session in progress")
+		return
+	}
+	s.stdinMu.Lock()
+	if s.stdin != nil {
+		if err := s.stdin.reopen(); err != nil {
+			s.log.Error(err)
+		}
+	}
+	s.stdinMu.Unlock()
+	rebuild := s.config.Debugger.ExecuteKind != debugger.ExecutingExistingFile
+	discarded, err := s.debugger.Restart(false, "", false, nil, [3]string{}, rebuild)
+	if err != nil {
+		s.sendErrorResponseErr(request.Request, FailedToRestart, "Failed to restart", err)
+		return
+	}
+	s.stackFrameHandles.reset()
+	s.variableHandles.reset()
+	for _, dbp := range discarded {
+		s.send(&dap.OutputEvent{
+			Event: *newEvent("output"),
+			Body: dap.OutputEventBody{
+				Output:   fmt.Sprintf("Discarded breakpoint at %s:%d: %s\n", dbp.Breakpoint.File, dbp.Breakpoint.Line, dbp.Reason),
+				Category: "stderr",
+			}})
+	}
+	s.send(&dap.RestartResponse{Response: *newResponse(request.Request)})
+	if s.args.stopOnEntry {
+		s.send(&dap.StoppedEvent{
+			Event: *newEvent("stopped"),
+			Body:  dap.StoppedEventBody{Reason: "entry", ThreadId: 1, AllThreadsStopped: true},
+		})
+		return
+	}
+	s.doCommand(api.Continue)
 }
 
 // onSetFunctionBreakpointsRequest sends a not-yet-implemented error response.
@@ -961,25 +1755,384 @@ func (s *Server) onLoadedSourcesRequest(request *dap.LoadedSourcesRequest) {
 	s.sendNotYetImplementedErrorResponse(request.Request)
 }
 
-// onReadMemoryRequest sends a not-yet-implemented error response.
-// Capability 'supportsReadMemoryRequest' is not set 'initialize' response.
+// dataBreakpointID is the dataId of a data breakpoint, sent to the client
+// JSON encoded, it identifies the memory watched and the function the
+// value is compared in.
+type dataBreakpointID struct {
+	Expr     string `json:"expr"`
+	Function string `json:"function"`
+}
+
+// onDataBreakpointInfoRequest handles 'dataBreakpointInfo' requests.
+// Capability 'supportsDataBreakpoints' is set in 'initialize' response.
+// Data breakpoints are expression watches of the memory of a variable,
+// dereferenced by address so that they can be evaluated on any goroutine.
+// Since they are not hardware watchpoints, the value is only compared
+// at every line of the function the target is stopped in.
+func (s *Server) onDataBreakpointInfoRequest(request *dap.DataBreakpointInfoRequest) {
+	response := &dap.DataBreakpointInfoResponse{Response: *newResponse(request.Request)}
+	v, ok := s.variableHandles.get(request.Arguments.VariablesReference)
+	if !ok {
+		s.sendErrorResponse(request.Request, UnableToLookupVariable, "Unable to lookup variable", fmt.Sprintf("unknown reference %d", request.Arguments.VariablesReference))
+		return
+	}
+	child, ok := dataBreakpointChild(v.(api.Variable), request.Arguments.Name)
+	if !ok || child.Addr == 0 {
+		response.Body.Description = fmt.Sprintf("%s is not addressable", request.Arguments.Name)
+		s.send(response)
+		return
+	}
+	expr := fmt.Sprintf("*(*%q)(%#x)", child.Type, child.Addr)
+	if _, err := s.debugger.EvalVariableInScope(api.EvalScope{GoroutineID: -1}, expr, proc.LoadConfig{}); err != nil {
+		response.Body.Description = fmt.Sprintf("%s can not be watched: %v", request.Arguments.Name, err)
+		s.send(response)
+		return
+	}
+	state, err := s.debugger.State( /*nowait*/ true)
+	if err != nil {
+		s.sendErrorResponseErr(request.Request, UnableToLookupVariable, "Unable to lookup variable", err)
+		return
+	}
+	var fn *api.Function
+	if state.SelectedGoroutine != nil {
+		fn = state.SelectedGoroutine.CurrentLoc.Function
+	} else if state.CurrentThread != nil {
+		fn = state.CurrentThread.Function
+	}
+	if fn == nil {
+		response.Body.Description = "the current location does not belong to any function"
+		s.send(response)
+		return
+	}
+	id, _ := json.Marshal(dataBreakpointID{Expr: expr, Function: fn.Name()})
+	response.Body.DataId = string(id)
+	response.Body.Description = fmt.Sprintf("%s, compared at every line of %s", request.Arguments.Name, fn.Name())
+	response.Body.AccessTypes = []dap.DataBreakpointAccessType{"write"}
+	s.send(response)
+}
+
+// dataBreakpointChild returns the child of v named name in 'variables'
+// responses. The elements of maps are moved when the map grows, they
+// can not be watched.
+func dataBreakpointChild(v api.Variable, name string) (api.Variable, bool) {
+	if v.Kind == reflect.Map {
+		return api.Variable{}, false
+	}
+	for i, c := range v.Children {
+		switch v.Kind {
+		case reflect.Slice, reflect.Array:
+			if fmt.Sprintf("[%d]", i) == name {
+				return c, true
+			}
+		default:
+			if c.Name == name {
+				return c, true
+			}
+		}
+	}
+	return api.Variable{}, false
+}
+
+// onSetDataBreakpointsRequest handles 'setDataBreakpoints' requests.
+// Capability 'supportsDataBreakpoints' is set in 'initialize' response.
+// The expression watches of the previous request are cleared and one is
+// created for each data breakpoint, at the lines of its function that do
+// not have a breakpoint already.
+func (s *Server) onSetDataBreakpointsRequest(request *dap.SetDataBreakpointsRequest) {
+	for len(s.dataBreakpoints) > 0 {
+		if err := s.debugger.ClearExprWatch(s.dataBreakpoints[0]); err != nil {
+			s.sendErrorResponseErr(request.Request, UnableToSetDataBPs, "Unable to set data breakpoints", err)
+			return
+		}
+		s.dataBreakpoints = s.dataBreakpoints[1:]
+	}
+	response := &dap.SetDataBreakpointsResponse{Response: *newResponse(request.Request)}
+	response.Body.Breakpoints = make([]dap.Breakpoint, len(request.Arguments.Breakpoints))
+	for i, b := range request.Arguments.Breakpoints {
+		w, err := s.createDataBreakpoint(b)
+		if err != nil {
+			response.Body.Breakpoints[i].Message = err.Error()
+			continue
+		}
+		s.dataBreakpoints = append(s.dataBreakpoints, w.ID)
+		response.Body.Breakpoints[i].Id = w.ID
+		response.Body.Breakpoints[i].Verified = true
+	}
+	s.send(response)
+}
+
+// createDataBreakpoint creates the expression watch implementing b.
+func (s *Server) createDataBreakpoint(b dap.DataBreakpoint) (*api.ExprWatch, error) {
+	if b.AccessType != "" && b.AccessType != "write" {
+		return nil, fmt.Errorf("access type %q is not supported", b.AccessType)
+	}
+	if b.Condition != "" || b.HitCondition != "" {
+		return nil, errors.New("conditions are not supported")
+	}
+	var id dataBreakpointID
+	if err := json.Unmarshal([]byte(b.DataId), &id); err != nil || id.Expr == "" {
+		return nil, fmt.Errorf("invalid dataId %q", b.DataId)
+	}
+	locs, err := s.debugger.FindLocation(api.EvalScope{GoroutineID: -1}, id.Function, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(locs) != 1 || locs[0].Function == nil {
+		return nil, fmt.Errorf("could not find function %s", id.Function)
+	}
+	insts, err := s.debugger.Disassemble(-1, locs[0].PC, 0, api.GoFlavour)
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[string]bool)
+	for _, bp := range s.debugger.Breakpoints() {
+		taken[fmt.Sprintf("%s:%d", bp.File, bp.Line)] = true
+	}
+	var locations []string
+	for _, inst := range insts {
+		loc := fmt.Sprintf("%s:%d", inst.Loc.File, inst.Loc.Line)
+		if inst.Loc.File != locs[0].File || taken[loc] {
+			continue
+		}
+		taken[loc] = true
+		locations = append(locations, loc)
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("all the lines of %s have breakpoints", id.Function)
+	}
+	return s.debugger.CreateGlobalExprWatch(id.Expr, locations)
+}
+
+const (
+	// maxReadMemory is the maximum number of bytes returned by a
+	// 'readMemory' request, clients can issue more requests to read more.
+	maxReadMemory = 1 << 20
+	// memoryPageSize is the granularity used to find unreadable memory.
+	memoryPageSize = 4096
+	// maxDisassembleInstructions is the maximum number of instructions
+	// returned by a 'disassemble' request, and the maximum distance of
+	// the first one from the memory reference.
+	maxDisassembleInstructions = 10000
+)
+
+// onReadMemoryRequest handles 'readMemory' requests.
+// Capability 'supportsReadMemoryRequest' is set in 'initialize' response.
+// Memory is read one page at a time, bytes after the first page that can
+// not be read are reported as unreadable.
 func (s *Server) onReadMemoryRequest(request *dap.ReadMemoryRequest) {
-	s.sendNotYetImplementedErrorResponse(request.Request)
+	addr, err := parseMemoryReference(request.Arguments.MemoryReference, request.Arguments.Offset)
+	if err != nil {
+		s.sendErrorResponseErr(request.Request, UnableToReadMemory, "Unable to read memory", err)
+		return
+	}
+	count := request.Arguments.Count
+	if count > maxReadMemory {
+		count = maxReadMemory
+	}
+	data := make([]byte, 0, count)
+	for len(data) < count {
+		cur := addr + uintptr(len(data))
+		n := min(count-len(data), memoryPageSize-int(cur%memoryPageSize))
+		buf, err := s.debugger.ExamineMemory(cur, n)
+		if err != nil {
+			break
+		}
+		data = append(data, buf...)
+	}
+	response := &dap.ReadMemoryResponse{
+		Response: *newResponse(request.Request),
+		Body: dap.ReadMemoryResponseBody{
+			Address:         fmt.Sprintf("%#x", addr),
+			UnreadableBytes: count - len(data),
+			Data:            base64.StdEncoding.EncodeToString(data),
+		},
+	}
+	s.send(response)
 }
 
-// onDisassembleRequest sends a not-yet-implemented error response.
-// Capability 'supportsDisassembleRequest' is not set 'initialize' response.
+// onWriteMemoryRequest handles 'writeMemory' requests.
+// Capability 'supportsWriteMemoryRequest' is set in 'initialize' response.
+func (s *Server) onWriteMemoryRequest(request *WriteMemoryRequest) {
+	addr, err := parseMemoryReference(request.Arguments.MemoryReference, request.Arguments.Offset)
+	if err != nil {
+		s.sendErrorResponseErr(request.Request, UnableToWriteMemory, "Unable to write memory", err)
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(request.Arguments.Data)
+	if err != nil {
+		s.sendErrorResponseErr(request.Request, UnableToWriteMemory, "Unable to write memory", err)
+		return
+	}
+	n, err := s.debugger.WriteMemory(addr, data)
+	if err != nil && (n == 0 || !request.Arguments.AllowPartial) {
+		s.sendErrorResponseErr(request.Request, UnableToWriteMemory, "Unable to write memory", err)
+		return
+	}
+	response := &WriteMemoryResponse{
+		Response: *newResponse(request.Request),
+		Body:     WriteMemoryResponseBody{BytesWritten: n},
+	}
+	s.send(response)
+}
+
+// onDisassembleRequest handles 'disassemble' requests.
+// Capability 'supportsDisassembleRequest' is set in 'initialize' response.
+// The function containing the requested address is disassembled, along
+// with the functions before and after it as needed to return the requested
+// number of instructions. Addresses that do not belong to any function are
+// returned as invalid instructions.
 func (s *Server) onDisassembleRequest(request *dap.DisassembleRequest) {
-	s.sendNotYetImplementedErrorResponse(request.Request)
+	addr, err := parseMemoryReference(request.Arguments.MemoryReference, request.Arguments.Offset)
+	if err != nil {
+		s.sendErrorResponseErr(request.Request, UnableToDisassemble, "Unable to disassemble", err)
+		return
+	}
+	count := request.Arguments.InstructionCount
+	if count <= 0 {
+		s.sendErrorResponse(request.Request, UnableToDisassemble, "Unable to disassemble", "instructionCount must be positive")
+		return
+	}
+	if count > maxDisassembleInstructions {
+		count = maxDisassembleInstructions
+	}
+	if off := request.Arguments.InstructionOffset; off < -maxDisassembleInstructions || off > maxDisassembleInstructions {
+		s.sendErrorResponse(request.Request, UnableToDisassemble, "Unable to disassemble", fmt.Sprintf("instructionOffset must be between %d and %d", -maxDisassembleInstructions, maxDisassembleInstructions))
+		return
+	}
+
+	insts, err := s.debugger.Disassemble(-1, uint64(addr), 0, api.GoFlavour)
+	if err != nil {
+		// Not in a function, all the instructions are invalid.
+		insts = nil
+	}
+	// start is the index in insts of the first instruction to return.
+	start := len(insts)
+	for i := range insts {
+		if insts[i].Loc.PC >= uint64(addr) {
+			start = i
+			break
+		}
+	}
+	start += request.Arguments.InstructionOffset
+
+	for start < 0 && len(insts) > 0 {
+		prev, err := s.debugger.Disassemble(-1, insts[0].Loc.PC-1, 0, api.GoFlavour)
+		if err != nil || len(prev) == 0 {
+			break
+		}
+		insts = append(prev, insts...)
+		start += len(prev)
+	}
+	for start+count > len(insts) && len(insts) > 0 {
+		last := insts[len(insts)-1]
+		next, err := s.debugger.Disassemble(-1, last.Loc.PC+uint64(len(last.Bytes)), 0, api.GoFlavour)
+		if err != nil || len(next) == 0 {
+			break
+		}
+		insts = append(insts, next...)
+	}
+
+	instructions := make([]dap.DisassembledInstruction, count)
+	for i := range instructions {
+		j := start + i
+		if j < 0 || j >= len(insts) {
+			instructions[i] = invalidInstruction(insts, j, addr)
+			continue
+		}
+		inst := insts[j]
+		instructions[i] = dap.DisassembledInstruction{
+			Address:          fmt.Sprintf("%#x", inst.Loc.PC),
+			InstructionBytes: fmt.Sprintf("%x", inst.Bytes),
+			Instruction:      inst.Text,
+			Line:             inst.Loc.Line,
+		}
+		if inst.Loc.File != "" && inst.Loc.File != "<autogenerated>" {
+			instructions[i].Location = dap.Source{Name: filepath.Base(inst.Loc.File), Path: inst.Loc.File}
+		}
+		if request.Arguments.ResolveSymbols && inst.Loc.Function != nil && (j == 0 || insts[j-1].Loc.Function == nil || insts[j-1].Loc.Function.Name() != inst.Loc.Function.Name()) {
+			instructions[i].Symbol = inst.Loc.Function.Name()
+		}
+	}
+	response := &dap.DisassembleResponse{
+		Response: *newResponse(request.Request),
+		Body:     dap.DisassembleResponseBody{Instructions: instructions},
+	}
+	s.send(response)
 }
 
-// onCancelRequest sends a not-yet-implemented error response.
-// Capability 'supportsCancelRequest' is not set 'initialize' response.
+// invalidInstruction returns the placeholder for the j-th instruction,
+// which lies out of insts. Its address is guessed by assuming the missing
+// instructions are one byte long.
+func invalidInstruction(insts api.AsmInstructions, j int, addr uintptr) dap.DisassembledInstruction {
+	pc := uint64(addr) + uint64(j)
+	switch {
+	case len(insts) == 0:
+	case j < 0:
+		pc = insts[0].Loc.PC + uint64(j)
+	default:
+		last := insts[len(insts)-1]
+		pc = last.Loc.PC + uint64(len(last.Bytes)) + uint64(j-len(insts))
+	}
+	return dap.DisassembledInstruction{Address: fmt.Sprintf("%#x", pc), Instruction: "(bad)"}
+}
+
+// onCancelRequest handles 'cancel' requests. It is called by the goroutine
+// reading messages from the client. Requests that are being handled stop
+// loading variables and fail, those that were not handled yet fail
+// immediately. Both respond with a "cancelled" error.
 func (s *Server) onCancelRequest(request *dap.CancelRequest) {
-	s.sendNotYetImplementedErrorResponse(request.Request)
+	s.cancelMu.Lock()
+	seq := request.Arguments.RequestId
+	if seq == s.currentSeq {
+		if s.currentCancel != nil {
+			close(s.currentCancel)
+			s.currentCancel = nil
+		}
+	} else if seq > s.currentSeq {
+		s.cancelled[seq] = true
+	}
+	s.cancelMu.Unlock()
+	s.send(&dap.CancelResponse{Response: *newResponse(request.Request)})
 }
 
 func (s *Server) sendErrorResponse(request dap.Request, id int, summary, details string) {
+	s.sendErrorResponseWithCode(request, id, summary, details, "")
+}
+
+// sendErrorResponseErr sends an error response with err as details and
+// the code of err.
+func (s *Server) sendErrorResponseErr(request dap.Request, id int, summary string, err error) {
+	details := err.Error()
+	if ierr, ok := err.(*proc.ErrInternal); ok {
+		details += s.reportInternalError(ierr.Msg, ierr.Stack)
+	}
+	s.sendErrorResponseWithCode(request, id, summary, details, api.ErrorCodeOf(err))
+}
+
+// reportInternalError writes the report of an internal error of the
+// debugger, see Debugger.ReportInternalError, and returns the sentence
+// appended to the error message sent to the client.
+func (s *Server) reportInternalError(reason, stack string) string {
+	if s.debugger == nil {
+		return ""
+	}
+	path, err := s.debugger.ReportInternalError(reason, stack)
+	if err != nil {
+		s.log.Errorf("could not write the report of an internal error: %v", err)
+		return ""
+	}
+	fmt.Fprintf(os.Stderr, "Delve internal error, report written to %s\n", path)
+	return "\nA report of the internal error was written to " + path
+}
+
+// sendErrorResponseWithCode sends an error response, with code, if it is
+// not empty, in the "code" variable of the error message, so that
+// clients can handle the error without matching the message.
+func (s *Server) sendErrorResponseWithCode(request dap.Request, id int, summary, details string, code api.ErrorCode) {
+	if s.requestCancelled(request.Seq) {
+		s.sendCancelledResponse(request)
+		return
+	}
 	er := &dap.ErrorResponse{}
 	er.Type = "response"
 	er.Command = request.Command
@@ -988,10 +2141,24 @@ func (s *Server) sendErrorResponse(request dap.Request, id int, summary, details
 	er.Message = summary
 	er.Body.Error.Id = id
 	er.Body.Error.Format = fmt.Sprintf("%s: %s", summary, details)
+	if code != "" {
+		er.Body.Error.Variables = map[string]string{"code": string(code)}
+	}
 	s.log.Error(er.Body.Error.Format)
 	s.send(er)
 }
 
+// sendCancelledResponse sends the response to a cancelled request.
+func (s *Server) sendCancelledResponse(request dap.Request) {
+	er := &dap.ErrorResponse{}
+	er.Type = "response"
+	er.Command = request.Command
+	er.RequestSeq = request.Seq
+	er.Success = false
+	er.Message = "cancelled"
+	s.send(er)
+}
+
 // sendInternalErrorResponse sends an "internal error" response back to the client.
 // We only take a seq here because we don't want to make assumptions about the
 // kind of message received by the server that this error is a reply to.
@@ -1050,7 +2217,11 @@ func (s *Server) doCommand(command string) {
 		return
 	}
 
-	state, err := s.debugger.Command(&api.DebuggerCommand{Name: command})
+	cmd := &api.DebuggerCommand{Name: command}
+	if command == api.Step {
+		cmd.SkipPackages = s.args.stepSkipPackages
+	}
+	state, err := s.debugger.Command(cmd)
 	if _, isexited := err.(proc.ErrProcessExited); isexited || err == nil && state.Exited {
 		e := &dap.TerminatedEvent{Event: *newEvent("terminated")}
 		s.send(e)
@@ -1071,6 +2242,23 @@ func (s *Server) doCommand(command string) {
 		default:
 			stopped.Body.Reason = "breakpoint"
 		}
+		if state.CurrentThread != nil && state.CurrentThread.Breakpoint != nil {
+			bp := state.CurrentThread.Breakpoint
+			switch bp.Name {
+			case proc.UnrecoveredPanic:
+				stopped.Body.Reason = "exception"
+				stopped.Body.Description = "Paused on panic"
+			case proc.FatalThrow:
+				stopped.Body.Reason = "exception"
+				stopped.Body.Description = "Paused on fatal error"
+			}
+		}
+		if len(state.ExprWatchChanges) > 0 {
+			c := state.ExprWatchChanges[0]
+			stopped.Body.Reason = "data breakpoint"
+			stopped.Body.Description = "Paused on data change"
+			stopped.Body.Text = fmt.Sprintf("%s changed from %s to %s", c.Expr, c.Old, c.New)
+		}
 		s.send(stopped)
 	} else {
 		s.log.Error("runtime error: ", err)
@@ -5,19 +5,23 @@ import (
 	"io"
 	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/go-delve/delve/pkg/goversion"
 	"github.com/go-delve/delve/pkg/logflags"
+	"github.com/go-delve/delve/pkg/proc"
 	protest "github.com/go-delve/delve/pkg/proc/test"
 	"github.com/go-delve/delve/service"
+	"github.com/go-delve/delve/service/api"
 	"github.com/go-delve/delve/service/dap/daptest"
 	"github.com/go-delve/delve/service/debugger"
 	"github.com/google/go-dap"
@@ -33,7 +37,7 @@ func TestMain(m *testing.M) {
 	var logOutput string
 	flag.StringVar(&logOutput, "log-output", "", "configures log output")
 	flag.Parse()
-	logflags.Setup(logOutput != "", logOutput, "")
+	logflags.Setup(logOutput != "", logOutput, "", "")
 	protest.DefaultTestBackend(&testBackend)
 	os.Exit(protest.RunTestsWithFixtures(m))
 }
@@ -549,6 +553,59 @@ func TestStackTraceRequest(t *testing.T) {
 	})
 }
 
+// TestThreadsRequestWithFilters executes to a breakpoint in a program
+// with many goroutines and checks that the goroutines in the threads
+// response are limited and filtered as specified in the launch request.
+func TestThreadsRequestWithFilters(t *testing.T) {
+	runTest(t, "goroutinestackprog", func(client *daptest.Client, fixture protest.Fixture) {
+		runDebugSessionWithBPs(t, client,
+			// Launch
+			func() {
+				client.LaunchRequestWithArgs(map[string]interface{}{
+					"mode": "exec", "program": fixture.Path, "maxGoroutines": 1})
+			},
+			// Set breakpoints
+			fixture.Source, []int{15},
+			[]onBreakpoint{{
+				// Stop at line 15
+				execute: func() {
+					client.ThreadsRequest()
+					oe := client.ExpectOutputEvent(t)
+					if !strings.HasPrefix(oe.Body.Output, "Too many goroutines, only 1 are shown.") {
+						t.Errorf("got %#v, want Output=\"Too many goroutines, only 1 are shown...\"", oe)
+					}
+					tResp := client.ExpectThreadsResponse(t)
+					if len(tResp.Body.Threads) != 1 || tResp.Body.Threads[0].Id != 1 {
+						t.Errorf("got %#v, want only the main goroutine", tResp.Body.Threads)
+					}
+				},
+				disconnect: true,
+			}})
+	})
+	runTest(t, "goroutinestackprog", func(client *daptest.Client, fixture protest.Fixture) {
+		runDebugSessionWithBPs(t, client,
+			// Launch
+			func() {
+				client.LaunchRequestWithArgs(map[string]interface{}{
+					"mode": "exec", "program": fixture.Path, "hideSystemGoroutines": true})
+			},
+			// Set breakpoints
+			fixture.Source, []int{15},
+			[]onBreakpoint{{
+				// Stop at line 15
+				execute: func() {
+					client.ThreadsRequest()
+					tResp := client.ExpectThreadsResponse(t)
+					// main and the 10 instances of agoroutine
+					if len(tResp.Body.Threads) != 11 {
+						t.Errorf("got %#v, want 11 user goroutines", tResp.Body.Threads)
+					}
+				},
+				disconnect: true,
+			}})
+	})
+}
+
 // TestScopesAndVariablesRequests executes to a breakpoint and tests different
 // configurations of 'scopes' and 'variables' requests.
 func TestScopesAndVariablesRequests(t *testing.T) {
@@ -1022,6 +1079,143 @@ func TestScopesAndVariablesRequests2(t *testing.T) {
 
 // Tests that 'stackTraceDepth' from LaunchRequest is parsed and passed to
 // stacktrace requests handlers.
+// TestMemoryAndDisassembleRequests executes to a breakpoint and reads,
+// writes and disassembles memory referenced by variables and stack frames.
+func TestMemoryAndDisassembleRequests(t *testing.T) {
+	runTest(t, "increment", func(client *daptest.Client, fixture protest.Fixture) {
+		runDebugSessionWithBPs(t, client,
+			// Launch
+			func() {
+				client.LaunchRequest("exec", fixture.Path, !stopOnEntry)
+			},
+			// Set breakpoints
+			fixture.Source, []int{8},
+			[]onBreakpoint{{
+				// Stop at line 8
+				execute: func() {
+					client.StackTraceRequest(1, 0, 1)
+					stResp := client.ExpectStackTraceResponse(t)
+					expectStackFrames(t, stResp, 8, 1000, 1, 6)
+					pc := stResp.Body.StackFrames[0].InstructionPointerReference
+
+					client.ScopesRequest(1000)
+					client.ExpectScopesResponse(t)
+					client.VariablesRequest(1000)
+					args := client.ExpectVariablesResponse(t)
+					expectVarExact(t, args, 0, "y", "0", noChildren)
+					ref := args.Body.Variables[0].MemoryReference
+					if ref == "" {
+						t.Fatalf("no memory reference for %#v", args.Body.Variables[0])
+					}
+
+					client.ReadMemoryRequest(ref, 0, 8)
+					mem := client.ExpectReadMemoryResponse(t)
+					if mem.Body.Address != ref || mem.Body.UnreadableBytes != 0 || mem.Body.Data != "AAAAAAAAAAA=" {
+						t.Errorf("got %#v, want 8 zero bytes at %s", mem.Body, ref)
+					}
+
+					client.ReadMemoryRequest("0x0", 0, 16)
+					mem = client.ExpectReadMemoryResponse(t)
+					if mem.Body.UnreadableBytes != 16 || mem.Body.Data != "" {
+						t.Errorf("got %#v, want 16 unreadable bytes", mem.Body)
+					}
+
+					client.WriteMemoryRequest(ref, 0, make([]byte, 8))
+					if got := client.ExpectWriteMemoryResponse(t); got.Body.BytesWritten != 8 {
+						t.Errorf("got %#v, want BytesWritten=8", got.Body)
+					}
+
+					client.DisassembleRequest(pc, -2, 5)
+					dis := client.ExpectDisassembleResponse(t)
+					if len(dis.Body.Instructions) != 5 {
+						t.Fatalf("got %d instructions, want 5", len(dis.Body.Instructions))
+					}
+					if inst := dis.Body.Instructions[2]; inst.Address != pc || inst.Line != 8 || inst.Instruction == "(bad)" {
+						t.Errorf("got %#v, want instruction at %s on line 8", inst, pc)
+					}
+
+					client.DisassembleRequest(pc, 0, -1)
+					if er := client.ExpectErrorResponse(t); er.Body.Error.Id != UnableToDisassemble {
+						t.Errorf("got %#v, want error for a negative count", er.Body.Error)
+					}
+					client.DisassembleRequest(pc, 0, 1<<30)
+					if dis := client.ExpectDisassembleResponse(t); len(dis.Body.Instructions) != maxDisassembleInstructions {
+						t.Errorf("got %d instructions, want %d", len(dis.Body.Instructions), maxDisassembleInstructions)
+					}
+				},
+				disconnect: true,
+			}})
+	})
+}
+
+// TestDataBreakpoints executes to a breakpoint, sets a data breakpoint on
+// a local variable and continues until its value changes.
+func TestDataBreakpoints(t *testing.T) {
+	runTest(t, "exprwatch", func(client *daptest.Client, fixture protest.Fixture) {
+		client.InitializeRequest()
+		if initResp := client.ExpectInitializeResponse(t); !initResp.Body.SupportsDataBreakpoints {
+			t.Errorf("got %#v, want SupportsDataBreakpoints=true", initResp.Body)
+		}
+		client.LaunchRequest("exec", fixture.Path, !stopOnEntry)
+		client.ExpectInitializedEvent(t)
+		client.ExpectLaunchResponse(t)
+		client.SetBreakpointsRequest(fixture.Source, []int{22})
+		client.ExpectSetBreakpointsResponse(t)
+		client.ConfigurationDoneRequest()
+		client.ExpectConfigurationDoneResponse(t)
+
+		// Stop at line 22, i == 1
+		client.ExpectStoppedEvent(t)
+		client.StackTraceRequest(1, 0, 1)
+		client.ExpectStackTraceResponse(t)
+		client.ScopesRequest(1000)
+		locals := client.ExpectScopesResponse(t).Body.Scopes[1].VariablesReference
+
+		client.DataBreakpointInfoRequest(locals, "nosuchvar")
+		if info := client.ExpectDataBreakpointInfoResponse(t); info.Body.DataId != nil {
+			t.Errorf("got %#v, want no dataId", info.Body)
+		}
+		client.DataBreakpointInfoRequest(locals, "i")
+		info := client.ExpectDataBreakpointInfoResponse(t)
+		dataID, _ := info.Body.DataId.(string)
+		if dataID == "" || !strings.Contains(info.Body.Description, "main.main") {
+			t.Fatalf("got %#v, want a dataId for i in main.main", info.Body)
+		}
+
+		client.SetDataBreakpointsRequest([]dap.DataBreakpoint{
+			{DataId: dataID, AccessType: "read"},
+			{DataId: dataID},
+		})
+		bps := client.ExpectSetDataBreakpointsResponse(t).Body.Breakpoints
+		if len(bps) != 2 || bps[0].Verified || bps[0].Message == "" || !bps[1].Verified {
+			t.Errorf("got %#v, want an unverified read breakpoint and a verified one", bps)
+		}
+
+		// Stop when i changes, before reaching line 22 again
+		client.ContinueRequest(1)
+		client.ExpectContinueResponse(t)
+		stopped := client.ExpectStoppedEvent(t)
+		if stopped.Body.Reason != "data breakpoint" || !strings.HasSuffix(stopped.Body.Text, "changed from 1 to 2") {
+			t.Errorf("got %#v, want a stop for i changing from 1 to 2", stopped.Body)
+		}
+
+		client.SetDataBreakpointsRequest(nil)
+		if bps := client.ExpectSetDataBreakpointsResponse(t).Body.Breakpoints; len(bps) != 0 {
+			t.Errorf("got %#v, want no data breakpoints", bps)
+		}
+
+		// Stop at line 22, i == 2
+		client.ContinueRequest(1)
+		client.ExpectContinueResponse(t)
+		if stopped := client.ExpectStoppedEvent(t); stopped.Body.Reason != "breakpoint" {
+			t.Errorf("got %#v, want a stop at the breakpoint", stopped.Body)
+		}
+
+		client.DisconnectRequest()
+		client.ExpectDisconnectResponse(t)
+	})
+}
+
 func TestLaunchRequestWithStackTraceDepth(t *testing.T) {
 	runTest(t, "increment", func(client *daptest.Client, fixture protest.Fixture) {
 		var stResp *dap.StackTraceResponse
@@ -1256,6 +1450,59 @@ func TestLaunchTestRequest(t *testing.T) {
 	})
 }
 
+// TestRestartRequest checks that a restart request rebuilds and restarts
+// the program launched in debug mode, keeping its breakpoints.
+func TestRestartRequest(t *testing.T) {
+	runTest(t, "increment", func(client *daptest.Client, fixture protest.Fixture) {
+		client.InitializeRequest()
+		initResp := client.ExpectInitializeResponse(t)
+		if !initResp.Body.SupportsRestartRequest {
+			t.Errorf("got %#v, want SupportsRestartRequest=true", initResp.Body)
+		}
+
+		client.LaunchRequestWithArgs(map[string]interface{}{
+			"mode": "debug", "program": fixture.Source})
+		client.ExpectInitializedEvent(t)
+		client.ExpectLaunchResponse(t)
+
+		client.SetBreakpointsRequest(fixture.Source, []int{8})
+		client.ExpectSetBreakpointsResponse(t)
+
+		client.ConfigurationDoneRequest()
+		client.ExpectConfigurationDoneResponse(t)
+		if se := client.ExpectStoppedEvent(t); se.Body.Reason != "breakpoint" {
+			t.Errorf("got %#v, want Reason=\"breakpoint\"", se)
+		}
+
+		// The breakpoint must be hit again after each restart.
+		for i := 0; i < 2; i++ {
+			client.RestartRequest()
+			client.ExpectRestartResponse(t)
+			if se := client.ExpectStoppedEvent(t); se.Body.Reason != "breakpoint" || se.Body.ThreadId != 1 {
+				t.Errorf("got %#v, want Reason=\"breakpoint\" ThreadId=1", se)
+			}
+			client.StackTraceRequest(1, 0, 1)
+			st := client.ExpectStackTraceResponse(t)
+			if len(st.Body.StackFrames) != 1 || st.Body.StackFrames[0].Line != 8 {
+				t.Errorf("got %#v, want one frame at line 8", st.Body.StackFrames)
+			}
+		}
+
+		client.DisconnectRequest()
+		client.ExpectDisconnectResponse(t)
+	})
+}
+
+func TestBadRestartRequest(t *testing.T) {
+	runTest(t, "increment", func(client *daptest.Client, fixture protest.Fixture) {
+		client.RestartRequest()
+		er := client.ExpectErrorResponse(t)
+		if er.Body.Error.Id != 3002 || er.Body.Error.Format != "Failed to restart: no debug session in progress" {
+			t.Errorf("got %#v, want Id=3002 Format=\"Failed to restart: no debug session in progress\"", er)
+		}
+	})
+}
+
 // Tests that 'args' from LaunchRequest are parsed and passed to the target
 // program. The target program exits without an error on success, and
 // panics on error, causing an unexpected StoppedEvent instead of
@@ -1320,15 +1567,6 @@ func TestUnupportedCommandResponses(t *testing.T) {
 		client.CompletionsRequest()
 		expectUnsupportedCommand("completions")
 
-		client.ExceptionInfoRequest()
-		expectUnsupportedCommand("exceptionInfo")
-
-		client.DataBreakpointInfoRequest()
-		expectUnsupportedCommand("dataBreakpointInfo")
-
-		client.SetDataBreakpointsRequest()
-		expectUnsupportedCommand("setDataBreakpoints")
-
 		client.BreakpointLocationsRequest()
 		expectUnsupportedCommand("breakpointLocations")
 
@@ -1337,6 +1575,88 @@ func TestUnupportedCommandResponses(t *testing.T) {
 	})
 }
 
+// TestExceptionBreakpoints checks that panics stop the program with an
+// "exception" stopped event, described by the 'exceptionInfo' request, only
+// if the panic filter is enabled and its condition is true.
+func TestExceptionBreakpoints(t *testing.T) {
+	runExceptionSession := func(setExceptionBreakpoints func(client *daptest.Client), wantStop bool) {
+		t.Helper()
+		runTest(t, "panic", func(client *daptest.Client, fixture protest.Fixture) {
+			client.InitializeRequest()
+			initResp := client.ExpectInitializeResponse(t)
+			if !initResp.Body.SupportsExceptionInfoRequest {
+				t.Errorf("got %#v, want SupportsExceptionInfoRequest=true", initResp.Body)
+			}
+
+			client.LaunchRequest("exec", fixture.Path, !stopOnEntry)
+			client.ExpectInitializedEvent(t)
+			client.ExpectLaunchResponse(t)
+
+			setExceptionBreakpoints(client)
+			client.ExpectSetExceptionBreakpointsResponse(t)
+
+			client.ConfigurationDoneRequest()
+			client.ExpectConfigurationDoneResponse(t)
+
+			if !wantStop {
+				client.ExpectTerminatedEvent(t)
+				client.DisconnectRequest()
+				client.ExpectDisconnectResponse(t)
+				return
+			}
+
+			se := client.ExpectStoppedEvent(t)
+			if se.Body.Reason != "exception" || se.Body.ThreadId != 1 {
+				t.Errorf("got %#v, want Reason=\"exception\" ThreadId=1", se)
+			}
+
+			client.ExceptionInfoRequest(1)
+			info := client.ExpectExceptionInfoResponse(t)
+			if info.Body.ExceptionId != "panic" || !strings.Contains(info.Body.Description, "BOOM!") || info.Body.Details.TypeName != "string" {
+				t.Errorf("got %#v, want ExceptionId=\"panic\" Description containing \"BOOM!\" TypeName=\"string\"", info.Body)
+			}
+
+			client.DisconnectRequest()
+			client.ExpectDisconnectResponse(t)
+		})
+	}
+
+	runExceptionSession(func(client *daptest.Client) {
+		client.SetExceptionBreakpointsRequest("panic", "fatal")
+	}, true)
+	runExceptionSession(func(client *daptest.Client) {
+		client.SetExceptionBreakpointsRequest()
+	}, false)
+	runExceptionSession(func(client *daptest.Client) {
+		client.SetExceptionBreakpointsRequestWithCondition("panic", `runtime.curg._panic.arg.(string) == "BOOM!"`)
+	}, true)
+	runExceptionSession(func(client *daptest.Client) {
+		client.SetExceptionBreakpointsRequestWithCondition("panic", `runtime.curg._panic.arg.(string) == "other"`)
+	}, false)
+}
+
+// TestExceptionBreakpointsBadCondition checks that the code of the error
+// is sent along with the message when the condition can not be parsed.
+func TestExceptionBreakpointsBadCondition(t *testing.T) {
+	runTest(t, "panic", func(client *daptest.Client, fixture protest.Fixture) {
+		client.InitializeRequest()
+		client.ExpectInitializeResponse(t)
+
+		client.LaunchRequest("exec", fixture.Path, !stopOnEntry)
+		client.ExpectInitializedEvent(t)
+		client.ExpectLaunchResponse(t)
+
+		client.SetExceptionBreakpointsRequestWithCondition("panic", "1 +")
+		er := client.ExpectErrorResponse(t)
+		if er.Body.Error.Id != UnableToSetExceptionBPs || er.Body.Error.Variables["code"] != string(api.ErrCodeExpressionParse) {
+			t.Errorf("got %#v, want Id=%d Variables[code]=%q", er.Body.Error, UnableToSetExceptionBPs, api.ErrCodeExpressionParse)
+		}
+
+		client.DisconnectRequest()
+		client.ExpectDisconnectResponse(t)
+	})
+}
+
 func TestRequiredNotYetImplementedResponses(t *testing.T) {
 	var got *dap.ErrorResponse
 	runTest(t, "increment", func(client *daptest.Client, fixture protest.Fixture) {
@@ -1350,9 +1670,6 @@ func TestRequiredNotYetImplementedResponses(t *testing.T) {
 			seqCnt++
 		}
 
-		client.AttachRequest()
-		expectNotYetImplemented("attach")
-
 		client.PauseRequest()
 		expectNotYetImplemented("pause")
 
@@ -1377,9 +1694,6 @@ func TestOptionalNotYetImplementedResponses(t *testing.T) {
 		client.TerminateRequest()
 		expectNotYetImplemented("terminate")
 
-		client.RestartRequest()
-		expectNotYetImplemented("restart")
-
 		client.SetFunctionBreakpointsRequest()
 		expectNotYetImplemented("setFunctionBreakpoints")
 
@@ -1397,15 +1711,37 @@ func TestOptionalNotYetImplementedResponses(t *testing.T) {
 
 		client.LoadedSourcesRequest()
 		expectNotYetImplemented("loadedSources")
+	})
+}
 
-		client.ReadMemoryRequest()
-		expectNotYetImplemented("readMemory")
+// TestCancelRequest checks that requests cancelled before being handled
+// fail with a "cancelled" error.
+func TestCancelRequest(t *testing.T) {
+	runTest(t, "increment", func(client *daptest.Client, fixture protest.Fixture) {
+		client.InitializeRequest()
+		initResp := client.ExpectInitializeResponse(t)
+		if !initResp.Body.SupportsCancelRequest {
+			t.Errorf("got %#v, want SupportsCancelRequest=true", initResp.Body)
+		}
 
-		client.DisassembleRequest()
-		expectNotYetImplemented("disassemble")
+		// The threads request, with sequence number 3, is cancelled
+		// before it is sent.
+		client.CancelRequest(3)
+		client.ExpectCancelResponse(t)
+		client.ThreadsRequest()
+		er := client.ExpectErrorResponse(t)
+		if er.RequestSeq != 3 || er.Command != "threads" || er.Message != "cancelled" {
+			t.Errorf("got %#v, want RequestSeq=3 Command=\"threads\" Message=\"cancelled\"", er)
+		}
 
-		client.CancelRequest()
-		expectNotYetImplemented("cancel")
+		// Cancelling a request that was already handled has no effect.
+		client.CancelRequest(1)
+		client.ExpectCancelResponse(t)
+		client.ThreadsRequest()
+		er = client.ExpectErrorResponse(t)
+		if er.RequestSeq != 5 || er.Message != "Unable to display threads" {
+			t.Errorf("got %#v, want RequestSeq=5 Message=\"Unable to display threads\"", er)
+		}
 	})
 }
 
@@ -1504,6 +1840,140 @@ func TestBadLaunchRequests(t *testing.T) {
 	})
 }
 
+// TestAttachRequest lists the processes that can be attached to, looking
+// for a running fixture, then attaches to it and detaches without killing it.
+func TestParseSandboxArgs(t *testing.T) {
+	sandbox, err := parseSandboxArgs(map[string]interface{}{
+		"env":      map[string]interface{}{"B": "2", "A": "1"},
+		"envMode":  "allowlist",
+		"envAllow": []interface{}{"HOME"},
+		"rlimits":  map[string]interface{}{"nofile": float64(1024), "core": "unlimited"},
+		"user":     "nobody",
+		"unshare":  []interface{}{"pid"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &proc.Sandbox{
+		EnvMode:    proc.EnvAllowlist,
+		EnvAllow:   []string{"HOME"},
+		Env:        []string{"A=1", "B=2"},
+		Rlimits:    []proc.Rlimit{{Resource: "core", Soft: proc.RlimInfinity, Hard: proc.RlimInfinity}, {Resource: "nofile", Soft: 1024, Hard: 1024}},
+		User:       "nobody",
+		Namespaces: []string{"pid"},
+	}
+	if !reflect.DeepEqual(sandbox, expected) {
+		t.Errorf("got %#v\nexpected %#v", sandbox, expected)
+	}
+
+	if sandbox, err := parseSandboxArgs(map[string]interface{}{"program": "x", "envMode": "inherit"}); sandbox != nil || err != nil {
+		t.Errorf("got %#v %v for no sandbox", sandbox, err)
+	}
+	for _, args := range []map[string]interface{}{
+		{"env": []interface{}{"A=1"}},
+		{"env": map[string]interface{}{"A": 1.0}},
+		{"envMode": "some"},
+		{"envAllow": "HOME"},
+		{"rlimits": map[string]interface{}{"nofile": true}},
+		{"rlimits": map[string]interface{}{"nofile": "2:1"}},
+		{"unshare": []interface{}{1.0}},
+	} {
+		if _, err := parseSandboxArgs(args); err == nil {
+			t.Errorf("no error for %v", args)
+		}
+	}
+}
+
+func TestAttachRequest(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("listProcesses is only supported on linux")
+	}
+	runTest(t, "loopprog", func(client *daptest.Client, fixture protest.Fixture) {
+		cmd := exec.Command(fixture.Path)
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+
+		client.InitializeRequest()
+		client.ExpectInitializeResponse(t)
+
+		client.ListProcessesRequest(true)
+		found := false
+		for _, p := range client.ExpectListProcessesResponse(t).Body.Processes {
+			if p.Pid == cmd.Process.Pid {
+				found = true
+				if p.GoVersion == "" || !strings.Contains(p.Cmdline, filepath.Base(fixture.Path)) {
+					t.Errorf("got %#v, want Go process running %s", p, fixture.Path)
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("process %d not listed", cmd.Process.Pid)
+		}
+
+		client.AttachRequest("local", cmd.Process.Pid, stopOnEntry)
+		client.ExpectInitializedEvent(t)
+		client.ExpectAttachResponse(t)
+
+		client.ConfigurationDoneRequest()
+		client.ExpectStoppedEvent(t)
+		client.ExpectConfigurationDoneResponse(t)
+
+		client.DisconnectRequest()
+		client.ExpectDisconnectResponse(t)
+
+		time.Sleep(100 * time.Millisecond)
+		if err := cmd.Process.Signal(syscall.Signal(0)); err != nil {
+			t.Errorf("target killed on disconnect: %v", err)
+		}
+	})
+}
+
+func TestBadAttachRequests(t *testing.T) {
+	runTest(t, "increment", func(client *daptest.Client, fixture protest.Fixture) {
+		seqCnt := 1
+		expectFailedToAttachWithMessage := func(response *dap.ErrorResponse, errmsg string) {
+			t.Helper()
+			if response.RequestSeq != seqCnt {
+				t.Errorf("RequestSeq got %d, want %d", seqCnt, response.RequestSeq)
+			}
+			if response.Command != "attach" {
+				t.Errorf("Command got %q, want \"attach\"", response.Command)
+			}
+			if response.Body.Error.Id != 3001 {
+				t.Errorf("Id got %d, want 3001", response.Body.Error.Id)
+			}
+			if response.Body.Error.Format != errmsg {
+				t.Errorf("\ngot  %q\nwant %q", response.Body.Error.Format, errmsg)
+			}
+			seqCnt++
+		}
+
+		client.AttachRequestWithArgs(map[string]interface{}{})
+		expectFailedToAttachWithMessage(client.ExpectErrorResponse(t),
+			"Failed to attach: The 'processId' attribute is missing in debug configuration.")
+
+		client.AttachRequestWithArgs(map[string]interface{}{"mode": "local", "processId": "notapid"})
+		expectFailedToAttachWithMessage(client.ExpectErrorResponse(t),
+			"Failed to attach: The 'processId' attribute is missing in debug configuration.")
+
+		client.AttachRequest("remote", 1, stopOnEntry)
+		expectFailedToAttachWithMessage(client.ExpectErrorResponse(t),
+			"Failed to attach: Unsupported 'mode' value \"remote\" in debug configuration.")
+
+		// We failed to attach. Make sure shutdown still works.
+		client.DisconnectRequest()
+		dresp := client.ExpectDisconnectResponse(t)
+		if dresp.RequestSeq != seqCnt {
+			t.Errorf("got %#v, want RequestSeq=%d", dresp, seqCnt)
+		}
+	})
+}
+
 func TestBadlyFormattedMessageToServer(t *testing.T) {
 	runTest(t, "increment", func(client *daptest.Client, fixture protest.Fixture) {
 		// Send a badly formatted message to the server, and expect it to close the
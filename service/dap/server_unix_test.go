@@ -0,0 +1,129 @@
+// +build !windows
+
+package dap
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	protest "github.com/go-delve/delve/pkg/proc/test"
+	"github.com/go-delve/delve/service/dap/daptest"
+)
+
+// TestLaunchConsoleStdinForwarding checks that when the terminal requested
+// with the 'console' attribute can not be started, input is forwarded to
+// the program with 'stdin' requests, while the program runs.
+func TestLaunchConsoleStdinForwarding(t *testing.T) {
+	runTest(t, "redirect", func(client *daptest.Client, fixture protest.Fixture) {
+		client.InitializeRequest()
+		client.ExpectInitializeResponse(t)
+
+		client.LaunchRequestWithArgs(map[string]interface{}{
+			"mode": "exec", "program": fixture.Path, "console": "integratedTerminal"})
+		rit := client.ExpectRunInTerminalRequest(t)
+		if rit.Arguments.Kind != "integrated" || len(rit.Arguments.Args) == 0 || rit.Arguments.Args[0] != "/bin/sh" {
+			t.Errorf("got %#v, want Kind=\"integrated\" Args=[/bin/sh ...]", rit.Arguments)
+		}
+		client.RunInTerminalResponse(rit.Seq, "no terminal")
+		if oe := client.ExpectOutputEvent(t); !strings.Contains(oe.Body.Output, "no terminal") {
+			t.Errorf("got %#v, want Output containing \"no terminal\"", oe)
+		}
+		if oe := client.ExpectOutputEvent(t); !strings.Contains(oe.Body.Output, "'stdin' requests") {
+			t.Errorf("got %#v, want Output containing \"'stdin' requests\"", oe)
+		}
+		client.ExpectInitializedEvent(t)
+		client.ExpectLaunchResponse(t)
+
+		client.ConfigurationDoneRequest()
+		client.ExpectConfigurationDoneResponse(t)
+
+		// The program reads its standard input until EOF, it can only
+		// terminate if the request is handled while it runs.
+		client.StdinRequest("hello", true)
+		client.ExpectStdinResponse(t)
+		client.ExpectTerminatedEvent(t)
+
+		client.StdinRequest("hello again", false)
+		er := client.ExpectErrorResponse(t)
+		if er.Body.Error.Id != 2015 {
+			t.Errorf("got %#v, want Id=2015", er)
+		}
+
+		client.DisconnectRequest()
+		client.ExpectDisconnectResponse(t)
+	})
+}
+
+// TestLaunchConsoleRunInTerminal checks that the program uses the terminal
+// started by a 'runInTerminal' request, emulated by a pseudo-terminal.
+func TestLaunchConsoleRunInTerminal(t *testing.T) {
+	runTest(t, "redirect", func(client *daptest.Client, fixture protest.Fixture) {
+		client.InitializeRequest()
+		client.ExpectInitializeResponse(t)
+
+		client.LaunchRequestWithArgs(map[string]interface{}{
+			"mode": "exec", "program": fixture.Path, "console": "externalTerminal"})
+		rit := client.ExpectRunInTerminalRequest(t)
+		if rit.Arguments.Kind != "external" {
+			t.Errorf("got %#v, want Kind=\"external\"", rit.Arguments)
+		}
+		cmd := exec.Command(rit.Arguments.Args[0], rit.Arguments.Args[1:]...)
+		cmd.Dir = rit.Arguments.Cwd
+		term, tty, err := pty.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer term.Close()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+		err = cmd.Start()
+		tty.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.RunInTerminalResponse(rit.Seq, "")
+		client.ExpectInitializedEvent(t)
+		client.ExpectLaunchResponse(t)
+
+		output := make(chan []byte)
+		go func() {
+			var buf bytes.Buffer
+			b := make([]byte, 100)
+			for {
+				n, err := term.Read(b)
+				buf.Write(b[:n])
+				if err != nil || bytes.Contains(buf.Bytes(), []byte("hello")) {
+					output <- buf.Bytes()
+					return
+				}
+			}
+		}()
+
+		client.ConfigurationDoneRequest()
+		client.ExpectConfigurationDoneResponse(t)
+		// ^D ends the input of the program.
+		term.Write([]byte("hello\n\x04"))
+		client.ExpectTerminatedEvent(t)
+
+		select {
+		case out := <-output:
+			if !bytes.Contains(out, []byte("hello")) {
+				t.Errorf("got output %q, want \"hello\"", out)
+			}
+		case <-time.After(10 * time.Second):
+			t.Error("timed out waiting for the output of the program")
+		}
+
+		client.DisconnectRequest()
+		client.ExpectDisconnectResponse(t)
+		// The command run in the terminal exits at the end of the session.
+		if err := cmd.Wait(); err != nil {
+			t.Error(err)
+		}
+	})
+}
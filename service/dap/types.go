@@ -0,0 +1,176 @@
+package dap
+
+import (
+	"encoding/json"
+
+	"github.com/google/go-dap"
+)
+
+// This file contains messages that are not part of DAP or that go-dap
+// does not decode fully.
+
+// attachRequest is an 'attach' request decoded along with its
+// implementation specific arguments, which dap.AttachRequest drops.
+type attachRequest struct {
+	dap.Request
+
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// ListProcessesRequest is a custom request, not part of DAP, listing the
+// processes that can be attached to on the machine where the server runs.
+// It allows clients of a remote server to offer a process picker.
+type ListProcessesRequest struct {
+	dap.Request
+
+	Arguments ListProcessesArguments `json:"arguments"`
+}
+
+// ListProcessesArguments are the arguments of a 'listProcesses' request.
+type ListProcessesArguments struct {
+	// GoOnly restricts the list to processes running a Go executable.
+	GoOnly bool `json:"goOnly,omitempty"`
+}
+
+// ListProcessesResponse is the response to a 'listProcesses' request.
+type ListProcessesResponse struct {
+	dap.Response
+
+	Body ListProcessesResponseBody `json:"body"`
+}
+
+// ListProcessesResponseBody is the body of a ListProcessesResponse.
+type ListProcessesResponseBody struct {
+	Processes []Process `json:"processes"`
+}
+
+// Process describes a process that can be attached to.
+type Process struct {
+	Pid     int    `json:"pid"`
+	Name    string `json:"name"`
+	Cmdline string `json:"cmdline"`
+	// GoVersion is the version of Go used to build the executable of the
+	// process, empty if it is not a Go executable or could not be read.
+	GoVersion string `json:"goVersion,omitempty"`
+}
+
+// WriteMemoryRequest is the 'writeMemory' request, which go-dap does not
+// define yet.
+type WriteMemoryRequest struct {
+	dap.Request
+
+	Arguments WriteMemoryArguments `json:"arguments"`
+}
+
+// WriteMemoryArguments are the arguments of a 'writeMemory' request.
+type WriteMemoryArguments struct {
+	MemoryReference string `json:"memoryReference"`
+	Offset          int    `json:"offset,omitempty"`
+	AllowPartial    bool   `json:"allowPartial,omitempty"`
+	// Data is the base64 encoded bytes to write.
+	Data string `json:"data"`
+}
+
+// WriteMemoryResponse is the response to a 'writeMemory' request.
+type WriteMemoryResponse struct {
+	dap.Response
+
+	Body WriteMemoryResponseBody `json:"body"`
+}
+
+// WriteMemoryResponseBody is the body of a WriteMemoryResponse.
+type WriteMemoryResponseBody struct {
+	Offset       int `json:"offset,omitempty"`
+	BytesWritten int `json:"bytesWritten"`
+}
+
+// StdinRequest is a custom request, not part of DAP, sending input to a
+// target launched with a 'console' attribute that did not get a terminal.
+// It can be sent while the target is running.
+type StdinRequest struct {
+	dap.Request
+
+	Arguments StdinArguments `json:"arguments"`
+}
+
+// StdinArguments are the arguments of a 'stdin' request.
+type StdinArguments struct {
+	Data string `json:"data"`
+	// EOF closes the standard input of the target after Data.
+	EOF bool `json:"eof,omitempty"`
+}
+
+// StdinResponse is the response to a 'stdin' request.
+type StdinResponse struct {
+	dap.Response
+}
+
+// setExceptionBreakpointsRequest is a 'setExceptionBreakpoints' request
+// decoded along with the filterOptions argument, which go-dap does not
+// define yet.
+type setExceptionBreakpointsRequest struct {
+	dap.Request
+
+	Arguments setExceptionBreakpointsArguments `json:"arguments"`
+}
+
+type setExceptionBreakpointsArguments struct {
+	Filters       []string                 `json:"filters"`
+	FilterOptions []exceptionFilterOptions `json:"filterOptions,omitempty"`
+}
+
+// exceptionFilterOptions enables the exception breakpoint filter FilterId,
+// with an optional condition.
+type exceptionFilterOptions struct {
+	FilterId  string `json:"filterId"`
+	Condition string `json:"condition,omitempty"`
+}
+
+// exceptionBreakpointsFilter extends dap.ExceptionBreakpointsFilter with
+// the fields needed to support conditions.
+type exceptionBreakpointsFilter struct {
+	dap.ExceptionBreakpointsFilter
+	SupportsCondition    bool   `json:"supportsCondition,omitempty"`
+	ConditionDescription string `json:"conditionDescription,omitempty"`
+}
+
+// capabilities extends dap.Capabilities with the capabilities that go-dap
+// does not define yet.
+type capabilities struct {
+	dap.Capabilities
+	SupportsWriteMemoryRequest     bool                         `json:"supportsWriteMemoryRequest,omitempty"`
+	SupportsExceptionFilterOptions bool                         `json:"supportsExceptionFilterOptions,omitempty"`
+	ExceptionBreakpointFilters     []exceptionBreakpointsFilter `json:"exceptionBreakpointFilters,omitempty"`
+}
+
+// initializeResponse is a dap.InitializeResponse reporting capabilities.
+type initializeResponse struct {
+	dap.Response
+
+	Body capabilities `json:"body,omitempty"`
+}
+
+// customRequestCtor maps the commands of the requests decoded by the
+// server instead of go-dap to the corresponding struct constructors.
+var customRequestCtor = map[string]func() dap.Message{
+	"attach":                  func() dap.Message { return &attachRequest{} },
+	"listProcesses":           func() dap.Message { return &ListProcessesRequest{} },
+	"setExceptionBreakpoints": func() dap.Message { return &setExceptionBreakpointsRequest{} },
+	"stdin":                   func() dap.Message { return &StdinRequest{} },
+	"writeMemory":             func() dap.Message { return &WriteMemoryRequest{} },
+}
+
+// decodeProtocolMessage is like dap.DecodeProtocolMessage but also decodes
+// the requests in customRequestCtor.
+func decodeProtocolMessage(data []byte) (dap.Message, error) {
+	var r dap.Request
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if ctor, ok := customRequestCtor[r.Command]; ok && r.Type == "request" {
+		request := ctor()
+		err := json.Unmarshal(data, request)
+		return request, err
+	}
+	return dap.DecodeProtocolMessage(data)
+}
@@ -8,3 +8,12 @@ func min(i, j int) int {
 	}
 	return j
 }
+
+// max returns the highest-valued integer
+// between the two passed into it.
+func max(i, j int) int {
+	if i > j {
+		return i
+	}
+	return j
+}
@@ -0,0 +1,275 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"reflect"
+
+	"github.com/go-delve/delve/pkg/locspec"
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// maxBisectSteps is the maximum number of statements executed by Bisect
+// while looking for the statement that makes the predicate true.
+const maxBisectSteps = 10000
+
+// Bisect finds the statement that makes the boolean expression predicate
+// true, running the target from the location start to the location end.
+//
+// Every time the target reaches start is an iteration, for example of the
+// loop containing start, the predicate must be false at the first
+// iteration and true when the target reaches end. The first iteration
+// where the predicate is true is found with a binary search, restarting
+// the target, or replaying the recording, for every iteration evaluated.
+// The target is then run to the iteration before and stepped, with next,
+// until the predicate is true, it is left stopped after the statement.
+// The predicate is evaluated in the scope of the goroutine that reached
+// start or end, other breakpoints are ignored while bisecting.
+// The target must behave the same way every time it runs, which is always
+// true for recordings.
+// Bisect restarts the target and creates breakpoints, it is not allowed in
+// read-only mode.
+func (d *Debugger) Bisect(predicate, start, end string) (*api.BisectResult, error) {
+	if d.config.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+	startAddrs, err := findLocationAddrs(d.target, start)
+	if err != nil {
+		return nil, err
+	}
+	endAddrs, err := findLocationAddrs(d.target, end)
+	if err != nil {
+		return nil, err
+	}
+
+	d.setRunning(true)
+	defer d.setRunning(false)
+
+	b := &bisector{d: d, predicate: predicate, startAddrs: startAddrs, endAddrs: endAddrs}
+	defer b.clearBreakpoints()
+
+	// count the iterations, iteration n+1 is end
+	n, err := b.run(-1)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("%s was not reached before %s", start, end)
+	}
+	lo, hi := 1, n+1
+	if ok, err := b.probe(lo); err != nil || ok {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s is already true at the first iteration", predicate)
+	}
+	if ok, err := b.probe(hi); err != nil || !ok {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s is still false when %s is reached", predicate, end)
+	}
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := b.probe(mid)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	// lo is the last iteration where the predicate is false, step through it.
+	if _, err := b.run(lo); err != nil {
+		return nil, err
+	}
+	if err := b.clearBreakpoints(); err != nil {
+		return nil, err
+	}
+	r := &api.BisectResult{Iteration: lo, Iterations: n, Runs: b.runs}
+	for r.Steps < maxBisectSteps {
+		loc, err := d.target.CurrentThread().Location()
+		if err != nil {
+			return nil, err
+		}
+		if err := d.target.Next(); err != nil {
+			return nil, err
+		}
+		if d.target.StopReason != proc.StopNextFinished {
+			return nil, errors.New("stepping interrupted before the predicate became true")
+		}
+		r.Steps++
+		ok, err := b.eval()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			r.Statement = api.ConvertLocation(*loc)
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%s still false after %d statements of iteration %d", predicate, maxBisectSteps, lo)
+}
+
+// bisector runs the target for Bisect.
+type bisector struct {
+	d                    *Debugger
+	predicate            string
+	startAddrs, endAddrs []uint64
+	bps                  []uint64 // addresses of the breakpoints created by the current run
+	runs                 int      // number of times the target was run
+}
+
+// run restarts the target and runs it to the n-th time start is reached
+// or, if it comes first, to end. If n is negative the target is run to
+// end. Returns the number of times start was reached.
+func (b *bisector) run(n int) (int, error) {
+	d := b.d
+	if err := b.clearBreakpoints(); err != nil {
+		return 0, err
+	}
+	if _, err := d.restart(false, "", false, nil, [3]string{}, false); err != nil {
+		return 0, err
+	}
+	b.runs++
+	if err := b.setBreakpoints(b.startAddrs); err != nil {
+		return 0, fmt.Errorf("could not create a breakpoint on the start location: %v", err)
+	}
+	if err := b.setBreakpoints(b.endAddrs); err != nil {
+		return 0, fmt.Errorf("could not create a breakpoint on the end location: %v", err)
+	}
+
+	hits := 0
+	for {
+		if err := d.target.Continue(); err != nil {
+			if _, exited := err.(proc.ErrProcessExited); exited {
+				return 0, errors.New("the target exited before reaching the end location")
+			}
+			return 0, err
+		}
+		switch d.target.StopReason {
+		case proc.StopManual:
+			return 0, errors.New("bisect interrupted")
+		case proc.StopBreakpoint:
+		default:
+			continue
+		}
+		bp := d.target.CurrentThread().Breakpoint()
+		if bp.Breakpoint == nil || !bp.Active || !bp.IsUser() {
+			continue
+		}
+		switch {
+		case containsAddr(b.endAddrs, bp.Addr):
+			return hits, nil
+		case containsAddr(b.startAddrs, bp.Addr):
+			hits++
+			if hits == n {
+				return hits, nil
+			}
+		}
+	}
+}
+
+// setBreakpoints sets user breakpoints on addrs, reusing the ones that are
+// already set.
+func (b *bisector) setBreakpoints(addrs []uint64) error {
+	bpmap := b.d.target.Breakpoints()
+	var missing []uint64
+	for _, addr := range addrs {
+		if bp := bpmap.M[addr]; bp == nil || !bp.IsUser() {
+			missing = append(missing, addr)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	bp, err := createLogicalBreakpoint(b.d.target, missing, &api.Breakpoint{})
+	if err != nil {
+		return err
+	}
+	b.bps = append(b.bps, bp.Addrs...)
+	return nil
+}
+
+func containsAddr(addrs []uint64, addr uint64) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// probe returns the value of the predicate at iteration n, n is one more
+// than the number of iterations for end.
+func (b *bisector) probe(n int) (bool, error) {
+	if _, err := b.run(n); err != nil {
+		return false, err
+	}
+	return b.eval()
+}
+
+// eval evaluates the predicate in the scope of the current goroutine.
+func (b *bisector) eval() (bool, error) {
+	scope, err := proc.GoroutineScope(b.d.target.CurrentThread())
+	if err != nil {
+		return false, err
+	}
+	v, err := scope.EvalExpression(b.predicate, proc.LoadConfig{})
+	if err != nil {
+		return false, fmt.Errorf("could not evaluate %s: %v", b.predicate, err)
+	}
+	if v.Unreadable != nil {
+		return false, fmt.Errorf("could not evaluate %s: %v", b.predicate, v.Unreadable)
+	}
+	if v.Kind != reflect.Bool || v.Value == nil {
+		return false, fmt.Errorf("%s is not a boolean expression", b.predicate)
+	}
+	return constant.BoolVal(v.Value), nil
+}
+
+// clearBreakpoints clears the breakpoints created by the current run.
+func (b *bisector) clearBreakpoints() error {
+	bps := b.bps
+	b.bps = nil
+	return clearTemporaryBreakpoints(b.d.target, bps)
+}
+
+// findLocationAddrs returns the addresses of the location spec.
+func findLocationAddrs(p *proc.Target, spec string) ([]uint64, error) {
+	loc, err := locspec.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := proc.ConvertEvalScope(p, -1, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	locs, err := loc.Find(p, nil, scope, spec, false)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []uint64
+	for _, loc := range locs {
+		if len(loc.PCs) > 0 {
+			addrs = append(addrs, loc.PCs...)
+		} else if loc.PC != 0 {
+			addrs = append(addrs, loc.PC)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("location %q not found", spec)
+	}
+	return addrs, nil
+}
@@ -0,0 +1,134 @@
+package debugger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// maxCallersStackDepth is the maximum number of callers recorded for each
+// call by RecordCallers.
+const maxCallersStackDepth = 64
+
+// RecordCallers resumes the target for the specified duration, recording
+// the stack of callers of every call to the function fnName, including
+// its inlined calls. Calls are intercepted by a temporary breakpoint on
+// the entry of the function, which is cleared when recording ends.
+// Returns the unique stacks of callers recorded, with the number of calls
+// made through each one, most frequent first.
+// Recording ends early if the target stops for any other reason or exits.
+func (d *Debugger) RecordCallers(fnName string, duration time.Duration) ([]api.CallerStack, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if d.config.ReadOnly && !d.config.AllowTracepoints {
+		return nil, ErrReadOnly
+	}
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+
+	addrs, err := proc.FindFunctionLocation(d.target, fnName, 0)
+	if err != nil {
+		return nil, err
+	}
+	bp, err := createLogicalBreakpoint(d.target, addrs, &api.Breakpoint{})
+	if err != nil {
+		if isBreakpointExistsErr(err) {
+			return nil, fmt.Errorf("could not record the callers of %s: %v", fnName, err)
+		}
+		return nil, err
+	}
+	defer func() {
+		if err := clearTemporaryBreakpoints(d.target, bp.Addrs); err != nil {
+			d.log.Errorf("could not clear the breakpoint recording the callers of %s: %v", fnName, err)
+		}
+	}()
+
+	d.setRunning(true)
+	defer d.setRunning(false)
+
+	stacks := map[string]*api.CallerStack{}
+	start := time.Now()
+	for time.Since(start) < duration {
+		cancel := d.stopAfter(duration - time.Since(start))
+		err := d.target.Continue()
+		cancel()
+		if err != nil {
+			if _, exited := err.(proc.ErrProcessExited); exited {
+				break
+			}
+			return nil, err
+		}
+		if d.target.StopReason != proc.StopBreakpoint || !d.recordCallers(bp.ID, stacks) {
+			break
+		}
+	}
+
+	r := make([]api.CallerStack, 0, len(stacks))
+	for _, stack := range stacks {
+		r = append(r, *stack)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Count != r[j].Count {
+			return r[i].Count > r[j].Count
+		}
+		return callersKey(r[i].Frames) < callersKey(r[j].Frames)
+	})
+	return r, nil
+}
+
+// recordCallers adds the stack of callers of every thread stopped at the
+// breakpoint id to stacks. Returns false, without recording anything, if
+// any thread is stopped at another breakpoint.
+func (d *Debugger) recordCallers(id int, stacks map[string]*api.CallerStack) bool {
+	var threads []proc.Thread
+	for _, thread := range d.target.ThreadList() {
+		bp := thread.Breakpoint()
+		if bp.Breakpoint == nil || !bp.Active {
+			continue
+		}
+		if !bp.IsUser() || bp.LogicalID != id {
+			return false
+		}
+		threads = append(threads, thread)
+	}
+	if len(threads) == 0 {
+		return false
+	}
+	for _, thread := range threads {
+		frames, err := proc.ThreadStacktrace(thread, maxCallersStackDepth)
+		if err != nil || len(frames) == 0 {
+			d.log.Warnf("could not read the callers of thread %d: %v", thread.ThreadID(), err)
+			continue
+		}
+		callers := make([]api.CallerFrame, 0, len(frames)-1)
+		for _, frame := range frames[1:] {
+			cf := api.CallerFrame{Function: "?", File: frame.Call.File, Line: frame.Call.Line}
+			if frame.Call.Fn != nil {
+				cf.Function = frame.Call.Fn.Name
+			}
+			callers = append(callers, cf)
+		}
+		key := callersKey(callers)
+		stack := stacks[key]
+		if stack == nil {
+			stack = &api.CallerStack{Frames: callers}
+			stacks[key] = stack
+		}
+		stack.Count++
+	}
+	return true
+}
+
+func callersKey(frames []api.CallerFrame) string {
+	var buf strings.Builder
+	for _, frame := range frames {
+		fmt.Fprintf(&buf, "%s %s:%d\n", frame.Function, frame.File, frame.Line)
+	}
+	return buf.String()
+}
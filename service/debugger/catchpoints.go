@@ -0,0 +1,251 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/goversion"
+	"github.com/go-delve/delve/service/api"
+)
+
+// stdlibCatchpoint is a kind of activity of the target, for example
+// opening files, caught by breakpoints on the functions of the standard
+// library that perform it, with a condition matching one of their
+// arguments against a pattern.
+type stdlibCatchpoint struct {
+	// args are the arguments of the glob builtin, following the pattern,
+	// in the condition of the breakpoints. They must be valid in all fns.
+	args string
+	fns  []catchpointFunc
+}
+
+// catchpointFunc is a function of the standard library performing the
+// activity of a catchpoint in the versions of Go from since, included, to
+// until, excluded. A zero version is unbounded.
+type catchpointFunc struct {
+	since, until goVersion
+	name         string
+}
+
+// goVersion is the major and minor number of a version of Go.
+type goVersion struct{ major, minor int }
+
+// inRange returns true if the version of Go that produced the target is
+// between since and until, or is unknown.
+func (fn catchpointFunc) inRange(producer string) bool {
+	if producer == "" {
+		return true
+	}
+	if fn.since.major > 0 && !goversion.ProducerAfterOrEqual(producer, fn.since.major, fn.since.minor) {
+		return false
+	}
+	if fn.until.major > 0 && goversion.ProducerAfterOrEqual(producer, fn.until.major, fn.until.minor) {
+		return false
+	}
+	return true
+}
+
+// stdlibCatchpoints are the kinds of catchpoints created by
+// CreateCatchpoint. The functions are the innermost ones called by all the
+// functions of the API, so that they are not inlined, and must be updated
+// when a new version of Go moves the work to a different function.
+var stdlibCatchpoints = map[string]stdlibCatchpoint{
+	// os.Open, os.Create, os.ReadFile and os.WriteFile call os.OpenFile.
+	"open": {"name", []catchpointFunc{
+		{name: "os.OpenFile"},
+		{since: goVersion{1, 24}, name: "os.(*Root).OpenFile"},
+	}},
+	// net.Dial, net.DialTimeout and (*net.Dialer).Dial call DialContext.
+	"dial": {"address", []catchpointFunc{
+		{name: "net.(*Dialer).DialContext"},
+	}},
+	// Every request sent by a http.Client, including redirects, reaches
+	// (*http.Transport).RoundTrip, which only calls roundTrip since Go 1.14.
+	// The query of the URL is not matched.
+	"http": {`req.URL.Scheme, "://", req.URL.Host, req.URL.Path`, []catchpointFunc{
+		{until: goVersion{1, 14}, name: "net/http.(*Transport).RoundTrip"},
+		{since: goVersion{1, 14}, name: "net/http.(*Transport).roundTrip"},
+	}},
+}
+
+// CatchpointKinds returns the kinds of catchpoints accepted by
+// CreateCatchpoint, sorted.
+func CatchpointKinds() []string {
+	kinds := make([]string, 0, len(stdlibCatchpoints))
+	for kind := range stdlibCatchpoints {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// CreateCatchpoint creates the breakpoints stopping the target when it
+// performs the activity kind, one of CatchpointKinds, on a file name,
+// network address or URL matching pattern, see the glob builtin: a
+// breakpoint for each function of the standard library performing it, in
+// the version of Go used to build the target, conditioned on the argument
+// matching pattern.
+func (d *Debugger) CreateCatchpoint(kind, pattern string) ([]*api.Breakpoint, error) {
+	cp, ok := stdlibCatchpoints[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown catchpoint %q, must be one of %s", kind, strings.Join(CatchpointKinds(), ", "))
+	}
+	if pattern == "" {
+		return nil, errors.New("catchpoints require a pattern")
+	}
+
+	fns := d.catchpointFuncs(cp.fns)
+	if len(fns) == 0 {
+		return nil, fmt.Errorf("the target does not call any of the functions of the %s catchpoint", kind)
+	}
+	return d.createCatchpointBreakpoints(fns, fmt.Sprintf("glob(%q, %s)", pattern, cp.args))
+}
+
+// catchpointFuncs returns the names of the functions in fns that are in
+// the target and in the range of versions of the Go compiler that built it.
+func (d *Debugger) catchpointFuncs(fns []catchpointFunc) []string {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+	bi := d.target.BinInfo()
+	producer := bi.Producer()
+	var r []string
+	for _, fn := range fns {
+		if fn.inRange(producer) && bi.LookupFunc[fn.name] != nil {
+			r = append(r, fn.name)
+		}
+	}
+	return r
+}
+
+// createCatchpointBreakpoints creates a breakpoint with condition cond on
+// each function of fns, or none of them if one fails.
+func (d *Debugger) createCatchpointBreakpoints(fns []string, cond string) ([]*api.Breakpoint, error) {
+	bps := make([]*api.Breakpoint, 0, len(fns))
+	for _, fn := range fns {
+		bp, err := d.CreateBreakpoint(&api.Breakpoint{FunctionName: fn, Cond: cond})
+		if err != nil {
+			for _, bp := range bps {
+				d.ClearBreakpoint(bp)
+			}
+			return nil, fmt.Errorf("could not create breakpoint on %s: %v", fn, err)
+		}
+		bps = append(bps, bp)
+	}
+	return bps, nil
+}
+
+// httpServerFuncs are the functions of the standard library called, with
+// the request as their req argument, for every HTTP request served by a
+// http.Server, over HTTP/1 and HTTP/2, before any handler of the program,
+// and therefore for every router built on net/http.
+var httpServerFuncs = []catchpointFunc{
+	{name: "net/http.serverHandler.ServeHTTP"},
+}
+
+// CreateHTTPBreakpoint creates the breakpoints stopping the target when it
+// starts serving an HTTP request matching filter. The target stops in
+// net/http, before calling the handlers of the program, with the request
+// in the req variable.
+func (d *Debugger) CreateHTTPBreakpoint(filter api.HTTPRequestFilter) ([]*api.Breakpoint, error) {
+	fns := d.catchpointFuncs(httpServerFuncs)
+	if len(fns) == 0 {
+		return nil, errors.New("the target does not serve HTTP requests with net/http")
+	}
+
+	var conds []string
+	if filter.Method != "" {
+		conds = append(conds, fmt.Sprintf("req.Method == %q", strings.ToUpper(filter.Method)))
+	}
+	if filter.Route != "" {
+		conds = append(conds, fmt.Sprintf("glob(%q, req.URL.Path)", filter.Route))
+	}
+	names := make([]string, 0, len(filter.Headers))
+	for name := range filter.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// the server stores the headers with their canonical names, a
+		// missing header is an error when indexing the map.
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		conds = append(conds, fmt.Sprintf("haskey(req.Header, %q) && glob(%q, req.Header[%q][0])", key, filter.Headers[name], key))
+	}
+	return d.createCatchpointBreakpoints(fns, strings.Join(conds, " && "))
+}
+
+// grpcServerFuncs are the functions of google.golang.org/grpc called, with
+// the transport stream of the call as their stream argument, for every
+// call served by a grpc.Server, before the interceptors and the handlers
+// of the program.
+var grpcServerFuncs = []catchpointFunc{
+	{name: "google.golang.org/grpc.(*Server).handleStream"},
+}
+
+// grpcIncomingMetadata is the metadata received by the server, stored in
+// the context of the stream by its transport.
+const grpcIncomingMetadata = `ctxvalue(stream.ctx, "google.golang.org/grpc/metadata.mdIncomingKey")`
+
+// CreateGRPCBreakpoint creates the breakpoints stopping the target when it
+// starts serving a gRPC call matching filter. The target stops in the
+// grpc package, before calling the interceptors and the handlers of the
+// program, with the stream of the call in the stream variable.
+func (d *Debugger) CreateGRPCBreakpoint(filter api.GRPCRequestFilter) ([]*api.Breakpoint, error) {
+	fns := d.catchpointFuncs(grpcServerFuncs)
+	if len(fns) == 0 {
+		return nil, errors.New("the target does not serve gRPC calls with google.golang.org/grpc")
+	}
+
+	var conds []string
+	if method := filter.Method; method != "" {
+		// full method names start with a slash, which is easily forgotten.
+		if method[0] != '/' && method[0] != '*' {
+			method = "/" + method
+		}
+		conds = append(conds, fmt.Sprintf("glob(%q, stream.method)", method))
+	}
+	keys := make([]string, 0, len(filter.Metadata))
+	for key := range filter.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// the keys of metadata are lower case.
+		k := strings.ToLower(key)
+		conds = append(conds, fmt.Sprintf("haskey(%s, %q) && glob(%q, %s[%q][0])", grpcIncomingMetadata, k, filter.Metadata[key], grpcIncomingMetadata, k))
+	}
+	return d.createCatchpointBreakpoints(fns, strings.Join(conds, " && "))
+}
+
+// CreateFinalizerBreakpoint creates the breakpoints stopping the target
+// when the finalizer goroutine runs a finalizer of an object of type typ,
+// with or without the leading '*' of the pointer types: a breakpoint on
+// each function set as the finalizer of such an object, conditioned on
+// running in the finalizer goroutine, so that the target does not stop
+// when the program calls them. Only the functions of the finalizers
+// already set are known.
+func (d *Debugger) CreateFinalizerBreakpoint(typ string) ([]*api.Breakpoint, error) {
+	fs, err := d.ListFinalizers()
+	if err != nil {
+		return nil, err
+	}
+	var fns []string
+	seen := make(map[string]bool)
+	for _, f := range fs.Finalizers {
+		if f.Cleanup || (f.Type != typ && f.Type != "*"+typ) || seen[f.Func] {
+			continue
+		}
+		seen[f.Func] = true
+		fns = append(fns, f.Func)
+	}
+	if len(fns) == 0 {
+		return nil, fmt.Errorf("no finalizer is set on the objects of type %s", typ)
+	}
+	if fs.Goroutine == nil {
+		return nil, errors.New("the finalizer goroutine did not start yet")
+	}
+	sort.Strings(fns)
+	return d.createCatchpointBreakpoints(fns, fmt.Sprintf("runtime.curg.goid == %d", fs.Goroutine.ID))
+}
@@ -0,0 +1,321 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// cAllocFuncs are the functions of the C library traced by ProfileCMalloc.
+var cAllocFuncs = []string{"malloc", "calloc", "realloc", "free"}
+
+// mallocgcFunc is the function allocating the memory of Go, traced by
+// ProfileCMalloc for comparison.
+const mallocgcFunc = "runtime.mallocgc"
+
+// cAllocStack is the memory allocated by the calls to the allocation
+// functions through a stack.
+type cAllocStack struct {
+	stack                    []profileFrame
+	allocObjects, allocBytes int64
+	freedObjects, freedBytes int64
+}
+
+// cAlloc is a block of memory allocated by the C library and not yet
+// freed.
+type cAlloc struct {
+	size  int64
+	stack *cAllocStack
+}
+
+// cAllocCall is a call to malloc, calloc or realloc in progress on a
+// thread, waiting for the pointer it returns.
+type cAllocCall struct {
+	fn    string
+	size  int64
+	old   uint64 // pointer reallocated by realloc
+	sp    uint64 // stack pointer after the call returns
+	stack *cAllocStack
+}
+
+// cMallocTracer records the calls to the allocation functions for
+// ProfileCMalloc.
+type cMallocTracer struct {
+	d        *Debugger
+	entries  map[uint64]string // entry point of the functions traced
+	returns  map[uint64]bool   // return addresses of the calls
+	calls    map[int]*cAllocCall
+	live     map[uint64]cAlloc
+	stacks   map[string]*cAllocStack
+	mallocgc *proc.Function
+	addrs    []uint64 // addresses of all the breakpoints created
+}
+
+// ProfileCMalloc resumes the target for the specified duration, tracing
+// every call to malloc, calloc, realloc and free of the C library, and to
+// runtime.mallocgc if mallocgc is true, with temporary breakpoints.
+// Returns a heap profile in pprof format of the memory allocated through
+// each stack, and of the memory still in use, to find the leaks of the C
+// code called with cgo. The memory allocated by Go is freed by the garbage
+// collector without calling any function, it is only counted as
+// allocated. The target is stopped twice for every allocation, profiling
+// ends early if the target stops for any other reason or exits.
+func (d *Debugger) ProfileCMalloc(duration time.Duration, mallocgc bool) ([]byte, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if d.config.ReadOnly && !d.config.AllowTracepoints {
+		return nil, ErrReadOnly
+	}
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+
+	tr := &cMallocTracer{
+		d:       d,
+		entries: make(map[uint64]string),
+		returns: make(map[uint64]bool),
+		calls:   make(map[int]*cAllocCall),
+		live:    make(map[uint64]cAlloc),
+		stacks:  make(map[string]*cAllocStack),
+	}
+	defer func() {
+		if err := clearTemporaryBreakpoints(d.target, tr.addrs); err != nil {
+			d.log.Errorf("could not clear the breakpoints tracing the allocations: %v", err)
+		}
+	}()
+	for _, name := range cAllocFuncs {
+		addr, err := proc.FindCFunction(d.target, name)
+		if err != nil {
+			if name == "malloc" {
+				return nil, errors.New("could not find malloc, the target does not use the C library")
+			}
+			continue
+		}
+		if err := tr.setBreakpoint(addr); err != nil {
+			return nil, fmt.Errorf("could not trace %s: %v", name, err)
+		}
+		tr.entries[addr] = name
+	}
+	if mallocgc {
+		// the arguments are read at the entry point, before the prologue.
+		tr.mallocgc = d.target.BinInfo().LookupFunc[mallocgcFunc]
+		if tr.mallocgc == nil {
+			return nil, fmt.Errorf("could not find %s", mallocgcFunc)
+		}
+		if err := tr.setBreakpoint(tr.mallocgc.Entry); err != nil {
+			return nil, fmt.Errorf("could not trace %s: %v", mallocgcFunc, err)
+		}
+		tr.entries[tr.mallocgc.Entry] = mallocgcFunc
+	}
+
+	d.setRunning(true)
+	defer d.setRunning(false)
+
+	pb := &profileBuilder{
+		sampleTypes: [][2]string{{"alloc_objects", "count"}, {"alloc_space", "bytes"}, {"inuse_objects", "count"}, {"inuse_space", "bytes"}},
+		periodType:  [2]string{"space", "bytes"},
+		period:      1,
+		start:       time.Now(),
+	}
+	for time.Since(pb.start) < duration {
+		cancel := d.stopAfter(duration - time.Since(pb.start))
+		err := d.target.Continue()
+		cancel()
+		if err != nil {
+			if _, exited := err.(proc.ErrProcessExited); exited {
+				break
+			}
+			return nil, err
+		}
+		if d.target.StopReason != proc.StopBreakpoint || !tr.record() {
+			break
+		}
+	}
+	pb.duration = time.Since(pb.start)
+
+	for _, s := range tr.stacks {
+		pb.add(s.stack, s.allocObjects, s.allocBytes, s.allocObjects-s.freedObjects, s.allocBytes-s.freedBytes)
+	}
+	return pb.encode(), nil
+}
+
+// setBreakpoint creates a temporary breakpoint at addr.
+func (tr *cMallocTracer) setBreakpoint(addr uint64) error {
+	if _, err := createLogicalBreakpoint(tr.d.target, []uint64{addr}, &api.Breakpoint{}); err != nil {
+		return err
+	}
+	tr.addrs = append(tr.addrs, addr)
+	return nil
+}
+
+// record records the calls of the threads stopped at the breakpoints of
+// tr. Returns false, without recording anything, if any thread is stopped
+// at another breakpoint.
+func (tr *cMallocTracer) record() bool {
+	var threads []proc.Thread
+	for _, thread := range tr.d.target.ThreadList() {
+		bp := thread.Breakpoint()
+		if bp.Breakpoint == nil || !bp.Active {
+			continue
+		}
+		if _, ok := tr.entries[bp.Addr]; !ok && !tr.returns[bp.Addr] {
+			return false
+		}
+		threads = append(threads, thread)
+	}
+	if len(threads) == 0 {
+		return false
+	}
+	for _, thread := range threads {
+		addr := thread.Breakpoint().Addr
+		if name, ok := tr.entries[addr]; ok {
+			if err := tr.entry(thread, name); err != nil {
+				tr.d.log.Warnf("could not trace the call to %s of thread %d: %v", name, thread.ThreadID(), err)
+			}
+		}
+		// the entry point of a function can also be the return address of
+		// a call.
+		if tr.returns[addr] {
+			if err := tr.ret(thread); err != nil {
+				tr.d.log.Warnf("could not trace the return of thread %d: %v", thread.ThreadID(), err)
+			}
+		}
+	}
+	return true
+}
+
+// entry records the call to the function name of thread.
+func (tr *cMallocTracer) entry(thread proc.Thread, name string) error {
+	if name == mallocgcFunc {
+		args, err := proc.EntryIntArgs(thread, tr.mallocgc, 1)
+		if err != nil {
+			return err
+		}
+		s := tr.stack(thread, name)
+		s.allocObjects++
+		s.allocBytes += int64(args[0])
+		return nil
+	}
+	if tr.calls[thread.ThreadID()] != nil {
+		// called by the function in progress, for example realloc calling
+		// malloc.
+		return nil
+	}
+	args, err := proc.EntryIntArgs(thread, nil, 2)
+	if err != nil {
+		return err
+	}
+	call := &cAllocCall{fn: name}
+	switch name {
+	case "free":
+		tr.free(args[0])
+		return nil
+	case "malloc":
+		call.size = int64(args[0])
+	case "calloc":
+		call.size = int64(args[0] * args[1])
+	case "realloc":
+		call.old, call.size = args[0], int64(args[1])
+	}
+
+	retaddr, sp, err := proc.EntryReturnAddr(thread)
+	if err != nil {
+		return err
+	}
+	if !tr.returns[retaddr] {
+		if err := tr.setBreakpoint(retaddr); err != nil {
+			return fmt.Errorf("could not create a breakpoint at the return address %#x: %v", retaddr, err)
+		}
+		tr.returns[retaddr] = true
+	}
+	call.sp = sp
+	call.stack = tr.stack(thread, name)
+	tr.calls[thread.ThreadID()] = call
+	return nil
+}
+
+// ret records the pointer returned by the call in progress on thread, if
+// it is stopped at its return address.
+func (tr *cMallocTracer) ret(thread proc.Thread) error {
+	call := tr.calls[thread.ThreadID()]
+	if call == nil {
+		return nil
+	}
+	regs, err := thread.Registers()
+	if err != nil {
+		return err
+	}
+	if regs.SP() != call.sp {
+		// a different call returning to the same address, for example a
+		// recursive one.
+		return nil
+	}
+	delete(tr.calls, thread.ThreadID())
+	ptr, err := proc.CReturnValue(thread)
+	if err != nil {
+		return err
+	}
+	if call.fn == "realloc" {
+		// realloc of 0 bytes frees the memory and can return nil.
+		if call.old != 0 && (ptr != 0 || call.size == 0) {
+			tr.free(call.old)
+		}
+		if call.size == 0 {
+			return nil
+		}
+	}
+	if ptr != 0 {
+		tr.live[ptr] = cAlloc{size: call.size, stack: call.stack}
+		call.stack.allocObjects++
+		call.stack.allocBytes += call.size
+	}
+	return nil
+}
+
+// free records that the memory at ptr was freed.
+func (tr *cMallocTracer) free(ptr uint64) {
+	a, ok := tr.live[ptr]
+	if !ok {
+		// allocated before profiling started.
+		return
+	}
+	delete(tr.live, ptr)
+	a.stack.freedObjects++
+	a.stack.freedBytes += a.size
+}
+
+// stack returns the record of the stack of thread, which is stopped at
+// the entry point of the function name.
+func (tr *cMallocTracer) stack(thread proc.Thread, name string) *cAllocStack {
+	var frames []proc.Stackframe
+	var err error
+	if name == mallocgcFunc {
+		frames, err = proc.ThreadStacktrace(thread, maxProfileStackDepth)
+	} else {
+		// the functions of the C library usually have no debug symbols, the
+		// stack is unwound from their caller.
+		frames, err = proc.EntryStacktrace(thread, maxProfileStackDepth-1)
+	}
+	if err != nil {
+		tr.d.log.Warnf("could not read the stack of thread %d: %v", thread.ThreadID(), err)
+	}
+	stack := profileStack(frames)
+	if name != mallocgcFunc {
+		stack = append([]profileFrame{{PC: thread.Breakpoint().Addr, Fn: name}}, stack...)
+	}
+	var key strings.Builder
+	for _, frame := range stack {
+		fmt.Fprintf(&key, "%#x %s\n", frame.PC, frame.Fn)
+	}
+	s := tr.stacks[key.String()]
+	if s == nil {
+		s = &cAllocStack{stack: stack}
+		tr.stacks[key.String()] = s
+	}
+	return s
+}
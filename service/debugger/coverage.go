@@ -0,0 +1,122 @@
+package debugger
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/locspec"
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// AddCoverage starts recording which lines of the functions specified by
+// specs are executed, see proc.Target.AddCoverage. Each spec is either a
+// location, all the functions it resolves to are tracked (for example a
+// function name or a regular expression), or the path of a source file,
+// ending in .go, all its functions are tracked.
+// Line coverage lasts until ClearCoverage is called, when the target is
+// restarted it starts over.
+// Returns the number of lines added.
+func (d *Debugger) AddCoverage(specs []string) (int, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if d.config.ReadOnly && !d.config.AllowTracepoints {
+		return 0, ErrReadOnly
+	}
+	if _, err := d.target.Valid(); err != nil {
+		return 0, err
+	}
+	n, err := addCoverage(d.target, specs)
+	if err != nil {
+		return n, err
+	}
+	d.coverageSpecs = append(d.coverageSpecs, specs...)
+	return n, nil
+}
+
+func addCoverage(p *proc.Target, specs []string) (int, error) {
+	var fns []*proc.Function
+	for _, spec := range specs {
+		specfns, err := coverageFunctions(p, spec)
+		if err != nil {
+			return 0, err
+		}
+		fns = append(fns, specfns...)
+	}
+	return p.AddCoverage(fns)
+}
+
+// coverageFunctions returns the functions of p specified by spec, see
+// AddCoverage.
+func coverageFunctions(p *proc.Target, spec string) ([]*proc.Function, error) {
+	bi := p.BinInfo()
+	var fns []*proc.Function
+	if strings.HasSuffix(spec, ".go") {
+		for i := range bi.Functions {
+			fn := &bi.Functions[i]
+			if fn.Entry == 0 {
+				continue
+			}
+			if file, _, _ := bi.PCToLine(fn.Entry); file == spec || strings.HasSuffix(file, "/"+spec) {
+				fns = append(fns, fn)
+			}
+		}
+		if len(fns) == 0 {
+			return nil, fmt.Errorf("no functions in %s", spec)
+		}
+		return fns, nil
+	}
+	loc, err := locspec.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := proc.ConvertEvalScope(p, -1, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	locs, err := loc.Find(p, nil, scope, spec, false)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[*proc.Function]bool{}
+	for _, loc := range locs {
+		pcs := loc.PCs
+		if len(pcs) == 0 {
+			pcs = []uint64{loc.PC}
+		}
+		for _, pc := range pcs {
+			if fn := bi.PCToInlineFunc(pc); fn != nil && !seen[fn] {
+				seen[fn] = true
+				fns = append(fns, fn)
+			}
+		}
+	}
+	if len(fns) == 0 {
+		return nil, fmt.Errorf("location %q not found", spec)
+	}
+	return fns, nil
+}
+
+// Coverage returns the lines tracked by line coverage, sorted by file and
+// line.
+func (d *Debugger) Coverage() []api.CoverageLine {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	lines := d.target.Coverage()
+	r := make([]api.CoverageLine, len(lines))
+	for i := range lines {
+		r[i] = api.CoverageLine{Function: lines[i].Function, File: lines[i].File, Line: lines[i].Line, Executed: lines[i].Executed}
+	}
+	return r
+}
+
+// ClearCoverage stops recording line coverage.
+func (d *Debugger) ClearCoverage() error {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	d.coverageSpecs = nil
+	return d.target.ClearCoverage()
+}
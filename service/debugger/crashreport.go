@@ -0,0 +1,146 @@
+package debugger
+
+import (
+	"fmt"
+	"go/constant"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// crashReportStackDepth is the maximum number of frames of each goroutine
+// included in a crash report.
+const crashReportStackDepth = 50
+
+// maxPanicChain is the maximum number of nested panics and wrapped errors
+// included in a crash report.
+const maxPanicChain = 20
+
+var crashReportLoadConfig = proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 8, MaxStringLen: 256, MaxArrayValues: 16, MaxStructFields: -1}
+
+// isCrashBreakpoint returns true if bp is one of the breakpoints reached
+// by a target that is about to die.
+func isCrashBreakpoint(bp *proc.Breakpoint) bool {
+	switch bp.Name {
+	case proc.UnrecoveredPanic, proc.FatalThrow, proc.OSExit, proc.LogFatal:
+		return true
+	}
+	return false
+}
+
+// writeCrashReport appends a report of the state of the target to the
+// file specified by Config.CrashReport, if the target is stopped on one of
+// the breakpoints reached by a dying target.
+func (d *Debugger) writeCrashReport() error {
+	if d.config.CrashReport == "" {
+		return nil
+	}
+	var thread proc.Thread
+	for _, th := range d.target.ThreadList() {
+		if bp := th.Breakpoint(); bp.Breakpoint != nil && bp.Active && isCrashBreakpoint(bp.Breakpoint) {
+			thread = th
+			break
+		}
+	}
+	if thread == nil {
+		return nil
+	}
+
+	fh, err := os.OpenFile(d.config.CrashReport, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	bp := thread.Breakpoint().Breakpoint
+	fmt.Fprintf(fh, "%s: target stopped at %s\n", time.Now().Format(time.RFC3339), bp.Name)
+	if loc, err := thread.Location(); err == nil {
+		fnname := "?"
+		if loc.Fn != nil {
+			fnname = loc.Fn.Name
+		}
+		fmt.Fprintf(fh, "Thread %d at %s:%d %s\n", thread.ThreadID(), loc.File, loc.Line, fnname)
+	}
+
+	if scope, err := proc.GoroutineScope(thread); err == nil {
+		switch bp.Name {
+		case proc.UnrecoveredPanic:
+			writePanicChain(fh, scope)
+		case proc.OSExit:
+			if v, err := scope.EvalVariable("code", crashReportLoadConfig); err == nil {
+				fmt.Fprintf(fh, "Exit code: %s\n", api.ConvertVar(v).SinglelineString())
+			}
+		}
+	}
+
+	gs, _, err := proc.GoroutinesInfo(d.target, 0, 0)
+	if err != nil {
+		fmt.Fprintf(fh, "could not list goroutines: %v\n\n", err)
+		return nil
+	}
+	for _, g := range gs {
+		writeGoroutineStack(fh, g)
+	}
+	fmt.Fprintln(fh)
+	return nil
+}
+
+// writePanicChain writes the arguments of all the panics active on the
+// current goroutine, along with the chain of errors each one wraps.
+func writePanicChain(w io.Writer, scope *proc.EvalScope) {
+	fmt.Fprintf(w, "Panics:\n")
+	expr := "runtime.curg._panic"
+	for i := 0; i < maxPanicChain; i++ {
+		isnil, err := scope.EvalVariable(expr+" == nil", proc.LoadConfig{})
+		if err != nil || isnil.Value == nil || constant.BoolVal(isnil.Value) {
+			return
+		}
+		v, err := scope.EvalVariable(expr+".arg", crashReportLoadConfig)
+		if err != nil {
+			fmt.Fprintf(w, "\tpanic %d: %v\n", i, err)
+		} else {
+			arg := api.ConvertVar(v)
+			fmt.Fprintf(w, "\tpanic %d: %s\n", i, arg.SinglelineString())
+			for j, wrapped := 0, unwrapError(arg); wrapped != nil && j < maxPanicChain; j, wrapped = j+1, unwrapError(wrapped) {
+				fmt.Fprintf(w, "\t\twraps: %s\n", wrapped.SinglelineString())
+			}
+		}
+		expr += ".link"
+	}
+}
+
+// unwrapError returns the first error wrapped by the error contained in
+// the interface variable v (see unwrapErrors). Returns nil if v does not
+// wrap any error.
+func unwrapError(v *api.Variable) *api.Variable {
+	if wrapped := unwrapErrors(v); len(wrapped) > 0 {
+		return wrapped[0]
+	}
+	return nil
+}
+
+func writeGoroutineStack(w io.Writer, g *proc.G) {
+	fmt.Fprintf(w, "Goroutine %d", g.ID)
+	if g.Thread != nil {
+		fmt.Fprintf(w, " (thread %d)", g.Thread.ThreadID())
+	}
+	fmt.Fprintf(w, ":\n")
+	frames, err := g.Stacktrace(crashReportStackDepth, 0)
+	if err != nil {
+		fmt.Fprintf(w, "\tcould not read stack: %v\n", err)
+		return
+	}
+	for i, frame := range frames {
+		fnname := "?"
+		if frame.Call.Fn != nil {
+			fnname = frame.Call.Fn.Name
+		}
+		fmt.Fprintf(w, "\t%d  %#016x in %s\n\t    at %s:%d\n", i, frame.Call.PC, fnname, frame.Call.File, frame.Call.Line)
+		if frame.Err != nil {
+			fmt.Fprintf(w, "\t    error: %v\n", frame.Err)
+		}
+	}
+}
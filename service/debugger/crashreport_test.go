@@ -0,0 +1,37 @@
+package debugger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func TestUnwrapError(t *testing.T) {
+	errorString := func(s string) api.Variable {
+		return api.Variable{Type: "error", Kind: reflect.Interface, Children: []api.Variable{
+			{Type: "*errors.errorString", Kind: reflect.Ptr, Children: []api.Variable{
+				{Type: "errors.errorString", Kind: reflect.Struct, Children: []api.Variable{
+					{Name: "s", Type: "string", Kind: reflect.String, Value: s},
+				}},
+			}},
+		}}
+	}
+	inner := errorString("inner")
+	outer := api.Variable{Type: "error", Kind: reflect.Interface, Children: []api.Variable{
+		{Type: "*fmt.wrapError", Kind: reflect.Ptr, Children: []api.Variable{
+			{Type: "fmt.wrapError", Kind: reflect.Struct, Children: []api.Variable{
+				{Name: "msg", Type: "string", Kind: reflect.String, Value: "outer: inner"},
+				inner,
+			}},
+		}},
+	}}
+
+	wrapped := unwrapError(&outer)
+	if wrapped == nil || !reflect.DeepEqual(*wrapped, inner) {
+		t.Fatalf("wrong wrapped error: %v", wrapped)
+	}
+	if wrapped := unwrapError(wrapped); wrapped != nil {
+		t.Fatalf("unexpected wrapped error: %v", wrapped)
+	}
+}
@@ -16,6 +16,8 @@ import (
 	"time"
 
 	"github.com/go-delve/delve/pkg/dwarf/op"
+	"github.com/go-delve/delve/pkg/findproc"
+	"github.com/go-delve/delve/pkg/fuzzy"
 	"github.com/go-delve/delve/pkg/gobuild"
 	"github.com/go-delve/delve/pkg/goversion"
 	"github.com/go-delve/delve/pkg/locspec"
@@ -25,6 +27,7 @@ import (
 	"github.com/go-delve/delve/pkg/proc/gdbserial"
 	"github.com/go-delve/delve/pkg/proc/native"
 	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/metrics"
 	"github.com/sirupsen/logrus"
 )
 
@@ -37,6 +40,10 @@ var (
 	// ErrNotRecording is returned when StopRecording is called while the
 	// debugger is not recording the target.
 	ErrNotRecording = errors.New("debugger is not recording")
+
+	// ErrReadOnly is returned by the operations that would change the state
+	// of the target when the debugger is read-only, see Config.ReadOnly.
+	ErrReadOnly = errors.New("not allowed: the debugger is read-only")
 )
 
 // Debugger service.
@@ -61,7 +68,78 @@ type Debugger struct {
 	runningMutex sync.Mutex
 
 	stopRecording func() error
-	recordMutex   sync.Mutex
+	// waitCancel interrupts reattach and waitRestart, protected by
+	// recordMutex like stopRecording.
+	waitCancel chan struct{}
+	// haltRequested is set by halt commands, so that ProfileCPU does not
+	// take the stop they cause for one of its own, protected by
+	// recordMutex.
+	haltRequested bool
+	// watchRestart is set by sourcesChanged to request a restart of the
+	// target, protected by recordMutex.
+	watchRestart bool
+	// watchStop stops the watch of the source files, see Config.Watch.
+	watchStop   chan struct{}
+	recordMutex sync.Mutex
+
+	samples sampleBuffer
+
+	// requests are the last requests of the clients, see RecordRequest.
+	requests requestLog
+
+	// coverageSpecs are the functions and files tracked by line coverage,
+	// see AddCoverage.
+	coverageSpecs []string
+
+	// exprWatches are the expressions watched, see CreateExprWatch.
+	exprWatches      []*exprWatch
+	exprWatchCounter int
+	// exprWatchChanges are the changes of the values of exprWatches found
+	// by the command being executed.
+	exprWatchChanges []api.ExprWatchChange
+
+	// stopTimes measures how long the target is stopped, see StopTime.
+	stopTimes stopTimes
+
+	// stdio streams the output of the launched processes, see
+	// Config.StreamOutput and Config.PTY, nil if it is not streamed.
+	stdio *stdio
+
+	// snapshots are the snapshots taken with Snapshot, by ID.
+	snapshots      map[int]*snapshot
+	lastSnapshotID int
+	// selectedSnapshot is the ID of the snapshot selected with
+	// SwitchSnapshot, which replaces target, liveTarget is then the
+	// target of the process.
+	selectedSnapshot int
+	liveTarget       *proc.Target
+
+	// flavor is the flavor of the target, see Config.Flavor.
+	flavor proc.Flavor
+
+	// subtestBreakpoint is the ID of the breakpoint created at the first
+	// line of the function of Config.Subtest or Config.Fuzz, which is only
+	// valid for the goroutine that reached it and is created again after a
+	// restart.
+	subtestBreakpoint int
+
+	// frameFilters hide frames from stacktraces, see Config.FrameFilters.
+	frameFilters *frameFilters
+
+	// caughtSyscalls are the system calls caught, see CatchSyscalls.
+	caughtSyscalls []string
+
+	// children are the child processes of the target debugged by other
+	// instances of Delve, see Config.FollowExec.
+	children      []*childTarget
+	childrenMutex sync.Mutex
+
+	// runtimeTrace is the runtime execution trace being written by the
+	// target, see StartRuntimeTrace.
+	runtimeTrace *runtimeTrace
+
+	// timeline records the stops of the target, see Timeline.
+	timeline timeline
 }
 
 type ExecuteKind int
@@ -120,6 +198,102 @@ type Config struct {
 
 	// Redirects specifies redirect rules for stdin, stdout and stderr
 	Redirects [3]string
+
+	// PTY allocates a pseudo-terminal for the launched processes, used as
+	// their controlling terminal, standard input, output and error, whose
+	// output is streamed to clients, see Output. Replaces TTY.
+	PTY bool
+	// StreamOutput streams the standard output and error of the launched
+	// processes that are not redirected to files to clients, see Output,
+	// instead of writing them to the outputs of Delve.
+	StreamOutput bool
+
+	// StopOnExit is true if the debugger should stop the target when it calls
+	// os.Exit or log.Fatal.
+	StopOnExit bool
+
+	// CrashReport is the path of a file to which a report of the state of
+	// the target is appended every time it stops because of an unrecovered
+	// panic, a fatal runtime error, a call to os.Exit or log.Fatal.
+	CrashReport string
+
+	// ReadOnly rejects the operations that change the state of the target:
+	// setting variables, calling functions, writing memory, restarting or
+	// killing it and creating breakpoints. Resuming and stepping are
+	// allowed.
+	ReadOnly bool
+
+	// AllowTracepoints allows creating tracepoints when ReadOnly is set.
+	AllowTracepoints bool
+
+	// StubAddr is the address of the gdb remote protocol stub used by the
+	// gdbstub backend.
+	StubAddr string
+
+	// Sandbox restricts the environment, the resources and the privileges
+	// of the launched processes, only supported by the native backend.
+	Sandbox *proc.Sandbox
+
+	// AttachName is the name of the executable of the process attached to,
+	// used to find the new process when Reattach is set.
+	AttachName string
+	// Reattach is true if the debugger should attach to the new process
+	// called AttachName when the target exits while it is continued, for
+	// example because it is restarted, keeping the breakpoints.
+	Reattach bool
+
+	// Flavor is the name of the flavor of the target, registered with
+	// proc.RegisterFlavor, which lists its threads of interest as
+	// goroutines.
+	Flavor string
+
+	// Subtest is the name of a test or subtest of the target, a test
+	// executable, as reported by go test -v. The debugger stops the target
+	// at the first line of its function, the closure passed to t.Run for
+	// subtests, when it starts running.
+	Subtest string
+	// Fuzz is the name of a fuzz test of the target, a test executable. The
+	// debugger stops the target at the first line of its fuzz function,
+	// with the arguments decoded from an input of the corpus, when it
+	// starts running.
+	Fuzz string
+
+	// Watch are the directories of the source files of the target, built
+	// by Delve, which is rebuilt and restarted when they change, keeping
+	// the breakpoints. If the target is running the new process is
+	// continued, if it exited the debugger waits for the next change.
+	Watch []string
+	// WatchDebounce is how long the source files must stay unchanged
+	// before the target is rebuilt, DefaultWatchDebounce if zero.
+	WatchDebounce time.Duration
+
+	// StopTimeAlarm is how long the target can stay stopped by the
+	// debugger before a warning is logged, see StopTime. Zero disables
+	// the warning.
+	StopTimeAlarm time.Duration
+
+	// CompileConditions enables the compilation of simple breakpoint
+	// conditions, comparisons of integer variables with constants, to
+	// code evaluated by the target without stopping. Only supported by the
+	// native backend on linux/amd64.
+	CompileConditions bool
+
+	// FrameFilters are patterns of packages and files whose frames are
+	// hidden from stacktraces unless api.StacktraceShowHidden is requested.
+	// Patterns containing '*', '?' or '[' are matched against the base name
+	// and the full path of files, for example "*.pb.go", the others are
+	// import paths where "..." matches any string, for example
+	// ".../vendor/...".
+	FrameFilters []string
+
+	// FollowExec is true if the debugger should debug the child processes
+	// of the target that run Go executables, for example the servers
+	// started by a test: each one is debugged by a new headless instance
+	// of Delve, listed by Targets, which is created with the breakpoints
+	// of the target set on lines and functions, and receives the ones
+	// created and cleared afterwards, if its executable contains their
+	// locations. Only supported by the native backend on linux.
+	FollowExec bool
 }
 
 // New creates a new Debugger. ProcessArgs specify the commandline arguments for the
@@ -131,6 +305,22 @@ func New(config *Config, processArgs []string) (*Debugger, error) {
 		processArgs: processArgs,
 		log:         logger,
 	}
+	d.stopTimes.alarm = config.StopTimeAlarm
+	d.stopTimes.log = logger
+
+	frameFilters, err := newFrameFilters(config.FrameFilters)
+	if err != nil {
+		return nil, err
+	}
+	d.frameFilters = frameFilters
+
+	if d.config.Flavor != "" {
+		flavor, err := proc.FindFlavor(d.config.Flavor)
+		if err != nil {
+			return nil, err
+		}
+		d.flavor = flavor
+	}
 
 	// Create the process by either attaching or launching.
 	switch {
@@ -169,9 +359,17 @@ func New(config *Config, processArgs []string) (*Debugger, error) {
 		}
 
 	default:
+		if d.config.PTY || d.config.StreamOutput {
+			stdio, err := newStdio(d.config)
+			if err != nil {
+				return nil, err
+			}
+			d.stdio = stdio
+		}
 		d.log.Infof("launching process with args: %v", d.processArgs)
 		p, err := d.Launch(d.processArgs, d.config.WorkingDir)
 		if err != nil {
+			d.closeStdio()
 			if _, ok := err.(*proc.ErrUnsupportedArch); !ok {
 				err = go11DecodeErrorCheck(err)
 				err = fmt.Errorf("could not launch process: %s", err)
@@ -184,9 +382,41 @@ func New(config *Config, processArgs []string) (*Debugger, error) {
 		}
 		if err := d.checkGoVersion(); err != nil {
 			d.target.Detach(true)
+			d.closeStdio()
 			return nil, err
 		}
 	}
+	if d.config.StopOnExit && d.target != nil {
+		d.target.SetExitBreakpoints()
+	}
+	if d.target != nil {
+		if err := d.setTestBreakpoints(d.target); err != nil {
+			d.target.Detach(true)
+			d.closeStdio()
+			return nil, err
+		}
+	}
+	if d.flavor != nil && d.target != nil {
+		d.target.SetFlavor(d.flavor)
+	}
+	if d.target != nil && d.config.CoreFile == "" {
+		d.followExec(d.target)
+	}
+	if d.target != nil && d.config.CoreFile == "" {
+		if d.config.AttachPid > 0 {
+			d.stopTimes.stop("attach")
+		} else {
+			d.stopTimes.stop("launch")
+		}
+	}
+	if len(d.config.Watch) > 0 {
+		if d.config.ExecuteKind != ExecutingGeneratedFile && d.config.ExecuteKind != ExecutingGeneratedTest {
+			d.Detach(true)
+			return nil, errors.New("can not watch the source files of an executable not built by Delve")
+		}
+		d.watchStop = make(chan struct{})
+		go d.watch(d.watchStop)
+	}
 	return d, nil
 }
 
@@ -197,6 +427,8 @@ func (d *Debugger) canRestart() bool {
 		return false
 	case d.config.CoreFile != "":
 		return false
+	case d.config.Backend == "gdbstub":
+		return false
 	default:
 		return true
 	}
@@ -211,7 +443,9 @@ func (d *Debugger) checkGoVersion() error {
 		return nil
 	}
 	producer := d.target.BinInfo().Producer()
-	if producer == "" {
+	if producer == "" || d.target.BinInfo().TinyGo() || d.target.BinInfo().Gccgo() {
+		// TinyGo and gccgo have their own versioning, the version of Go
+		// they support is not recorded.
 		return nil
 	}
 	return goversion.Compatible(producer)
@@ -219,21 +453,34 @@ func (d *Debugger) checkGoVersion() error {
 
 // Launch will start a process with the given args and working directory.
 func (d *Debugger) Launch(processArgs []string, wd string) (*proc.Target, error) {
+	// Only the native backend can launch processes in a sandbox.
+	if !d.config.Sandbox.Empty() && d.config.Backend != "native" && (d.config.Backend != "default" || runtime.GOOS == "darwin") {
+		return nil, proc.ErrSandboxUnsupported
+	}
+	if d.config.Backend == "gdbstub" {
+		// The executable is run by the stub, possibly on a different machine
+		// or operating system.
+		return gdbserial.StubAttach(d.config.StubAddr, processArgs[0], d.config.DebugInfoDirectories)
+	}
+	if d.config.Backend == "ios" {
+		// The executable is built for the device, not for the host.
+		return gdbserial.IOSLaunch(processArgs, d.config.DebugInfoDirectories)
+	}
 	if err := verifyBinaryFormat(processArgs[0]); err != nil {
 		return nil, err
 	}
 	switch d.config.Backend {
 	case "native":
-		return native.Launch(processArgs, wd, d.config.Foreground, d.config.DebugInfoDirectories, d.config.TTY, d.config.Redirects)
+		return d.compileConditions(native.Launch(processArgs, wd, d.config.Foreground, d.config.DebugInfoDirectories, d.tty(), d.redirects(), d.config.Sandbox))
 	case "lldb":
-		return betterGdbserialLaunchError(gdbserial.LLDBLaunch(processArgs, wd, d.config.Foreground, d.config.DebugInfoDirectories, d.config.TTY, d.config.Redirects))
+		return betterGdbserialLaunchError(gdbserial.LLDBLaunch(processArgs, wd, d.config.Foreground, d.config.DebugInfoDirectories, d.tty(), d.redirects()))
 	case "rr":
 		if d.target != nil {
 			// restart should not call us if the backend is 'rr'
 			panic("internal error: call to Launch with rr backend and target already exists")
 		}
 
-		run, stop, err := gdbserial.RecordAsync(processArgs, wd, false, d.config.Redirects)
+		run, stop, err := gdbserial.RecordAsync(processArgs, wd, false, d.redirects())
 		if err != nil {
 			return nil, err
 		}
@@ -266,11 +513,21 @@ func (d *Debugger) Launch(processArgs []string, wd string) (*proc.Target, error)
 		}()
 		return nil, nil
 
+	case "wine":
+		return gdbserial.WineLaunch(processArgs, wd, d.config.DebugInfoDirectories, d.redirects())
 	case "default":
+		if runtime.GOOS != "windows" {
+			if goos, _ := proc.ExecutableOS(processArgs[0]); goos == "windows" {
+				if !d.config.Sandbox.Empty() {
+					return nil, proc.ErrSandboxUnsupported
+				}
+				return gdbserial.WineLaunch(processArgs, wd, d.config.DebugInfoDirectories, d.redirects())
+			}
+		}
 		if runtime.GOOS == "darwin" {
-			return betterGdbserialLaunchError(gdbserial.LLDBLaunch(processArgs, wd, d.config.Foreground, d.config.DebugInfoDirectories, d.config.TTY, d.config.Redirects))
+			return betterGdbserialLaunchError(gdbserial.LLDBLaunch(processArgs, wd, d.config.Foreground, d.config.DebugInfoDirectories, d.tty(), d.redirects()))
 		}
-		return native.Launch(processArgs, wd, d.config.Foreground, d.config.DebugInfoDirectories, d.config.TTY, d.config.Redirects)
+		return d.compileConditions(native.Launch(processArgs, wd, d.config.Foreground, d.config.DebugInfoDirectories, d.tty(), d.redirects(), d.config.Sandbox))
 	default:
 		return nil, fmt.Errorf("unknown backend %q", d.config.Backend)
 	}
@@ -307,19 +564,31 @@ func (d *Debugger) recordingRun(run func() (string, error)) (*proc.Target, error
 func (d *Debugger) Attach(pid int, path string) (*proc.Target, error) {
 	switch d.config.Backend {
 	case "native":
-		return native.Attach(pid, d.config.DebugInfoDirectories)
+		return d.compileConditions(native.Attach(pid, d.config.DebugInfoDirectories))
 	case "lldb":
 		return betterGdbserialLaunchError(gdbserial.LLDBAttach(pid, path, d.config.DebugInfoDirectories))
 	case "default":
 		if runtime.GOOS == "darwin" {
 			return betterGdbserialLaunchError(gdbserial.LLDBAttach(pid, path, d.config.DebugInfoDirectories))
 		}
-		return native.Attach(pid, d.config.DebugInfoDirectories)
+		return d.compileConditions(native.Attach(pid, d.config.DebugInfoDirectories))
 	default:
 		return nil, fmt.Errorf("unknown backend %q", d.config.Backend)
 	}
 }
 
+// compileConditions enables the compilation of breakpoint conditions in p
+// if Config.CompileConditions is set.
+func (d *Debugger) compileConditions(p *proc.Target, err error) (*proc.Target, error) {
+	if err != nil || !d.config.CompileConditions {
+		return p, err
+	}
+	if !p.CompileConditions(true) {
+		d.log.Warnf("breakpoint conditions can not be compiled on %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	return p, nil
+}
+
 var errMacOSBackendUnavailable = errors.New("debugserver or lldb-server not found: install Xcode's command line tools or lldb-server")
 
 func betterGdbserialLaunchError(p *proc.Target, err error) (*proc.Target, error) {
@@ -358,10 +627,13 @@ func (d *Debugger) FunctionReturnLocations(fnName string) ([]uint64, error) {
 	d.targetMutex.Lock()
 	defer d.targetMutex.Unlock()
 
-	var (
-		p = d.target
-		g = p.SelectedGoroutine()
-	)
+	return functionReturnLocations(d.target, fnName, true)
+}
+
+// functionReturnLocations returns the addresses of all RET instructions of
+// fnName and, if deferReturns is true, of all its calls to runtime.deferreturn.
+func functionReturnLocations(p *proc.Target, fnName string, deferReturns bool) ([]uint64, error) {
+	g := p.SelectedGoroutine()
 
 	fn, ok := p.BinInfo().LookupFunc[fnName]
 	if !ok {
@@ -385,7 +657,9 @@ func (d *Debugger) FunctionReturnLocations(fnName string) ([]uint64, error) {
 			addrs = append(addrs, instruction.Loc.PC)
 		}
 	}
-	addrs = append(addrs, proc.FindDeferReturnCalls(instructions)...)
+	if deferReturns {
+		addrs = append(addrs, proc.FindDeferReturnCalls(instructions)...)
+	}
 
 	return addrs, nil
 }
@@ -397,7 +671,27 @@ func (d *Debugger) Detach(kill bool) error {
 	d.targetMutex.Lock()
 	defer d.targetMutex.Unlock()
 
-	return d.detach(kill)
+	if kill && d.config.ReadOnly && d.config.AttachPid != 0 {
+		return ErrReadOnly
+	}
+	d.clearSnapshots()
+	d.detachChildren(kill)
+
+	err := d.detach(kill)
+	d.stopTimes.resume()
+	d.closeStdio()
+	if d.watchStop != nil {
+		close(d.watchStop)
+		d.watchStop = nil
+	}
+	return err
+}
+
+// closeStdio stops streaming the output of the target, see Config.StreamOutput.
+func (d *Debugger) closeStdio() {
+	if d.stdio != nil {
+		d.stdio.close()
+	}
 }
 
 func (d *Debugger) detach(kill bool) error {
@@ -415,6 +709,11 @@ func (d *Debugger) detach(kill bool) error {
 func (d *Debugger) Restart(rerecord bool, pos string, resetArgs bool, newArgs []string, newRedirects [3]string, rebuild bool) ([]api.DiscardedBreakpoint, error) {
 	d.targetMutex.Lock()
 	defer d.targetMutex.Unlock()
+	return d.restart(rerecord, pos, resetArgs, newArgs, newRedirects, rebuild)
+}
+
+func (d *Debugger) restart(rerecord bool, pos string, resetArgs bool, newArgs []string, newRedirects [3]string, rebuild bool) ([]api.DiscardedBreakpoint, error) {
+	d.selectProcess()
 
 	recorded, _ := d.target.Recorded()
 	if recorded && !rerecord {
@@ -425,19 +724,57 @@ func (d *Debugger) Restart(rerecord bool, pos string, resetArgs bool, newArgs []
 		return nil, proc.ErrNotRecorded
 	}
 
+	if d.config.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
 	if !d.canRestart() {
 		return nil, ErrCanNotRestart
 	}
 
+	var rebuilt string
+	if rebuild {
+		// The executable is built, next to the running one, before killing
+		// the target so that the session survives compilation errors. Go
+		// caches the packages that did not change, only the ones that did
+		// are compiled again.
+		rebuilt = d.processArgs[0] + ".rebuild"
+		var err error
+		switch d.config.ExecuteKind {
+		case ExecutingGeneratedFile:
+			err = gobuild.GoBuild(rebuilt, d.config.Packages, d.config.BuildFlags)
+		case ExecutingGeneratedTest:
+			err = gobuild.GoTestBuild(rebuilt, d.config.Packages, d.config.BuildFlags)
+		default:
+			// We cannot build a process that we didn't start, because we don't know how it was built.
+			return nil, fmt.Errorf("cannot rebuild a binary")
+		}
+		if err != nil {
+			os.Remove(rebuilt)
+			return nil, fmt.Errorf("could not rebuild process: %s", err)
+		}
+	}
+
 	if valid, _ := d.target.Valid(); valid && !recorded {
 		// Ensure the process is in a PTRACE_STOP.
 		if err := stopProcess(d.target.Pid()); err != nil {
 			return nil, err
 		}
 	}
+	var offsets map[int]int
+	if rebuild {
+		offsets = breakpointOffsets(d.target, d.breakpoints())
+	}
 	if err := d.detach(true); err != nil {
 		return nil, err
 	}
+	d.stopTimes.resume()
+	if rebuilt != "" {
+		if err := os.Rename(rebuilt, d.processArgs[0]); err != nil {
+			os.Remove(rebuilt)
+			return nil, fmt.Errorf("could not rebuild process: %s", err)
+		}
+	}
 	if resetArgs {
 		d.processArgs = append([]string{d.processArgs[0]}, newArgs...)
 		d.config.Redirects = newRedirects
@@ -445,26 +782,8 @@ func (d *Debugger) Restart(rerecord bool, pos string, resetArgs bool, newArgs []
 	var p *proc.Target
 	var err error
 
-	if rebuild {
-		switch d.config.ExecuteKind {
-		case ExecutingGeneratedFile:
-			err = gobuild.GoBuild(d.processArgs[0], d.config.Packages, d.config.BuildFlags)
-			if err != nil {
-				return nil, fmt.Errorf("could not rebuild process: %s", err)
-			}
-		case ExecutingGeneratedTest:
-			err = gobuild.GoTestBuild(d.processArgs[0], d.config.Packages, d.config.BuildFlags)
-			if err != nil {
-				return nil, fmt.Errorf("could not rebuild process: %s", err)
-			}
-		default:
-			// We cannot build a process that we didn't start, because we don't know how it was built.
-			return nil, fmt.Errorf("cannot rebuild a binary")
-		}
-	}
-
 	if recorded {
-		run, stop, err2 := gdbserial.RecordAsync(d.processArgs, d.config.WorkingDir, false, d.config.Redirects)
+		run, stop, err2 := gdbserial.RecordAsync(d.processArgs, d.config.WorkingDir, false, d.redirects())
 		if err2 != nil {
 			return nil, err2
 		}
@@ -479,13 +798,48 @@ func (d *Debugger) Restart(rerecord bool, pos string, resetArgs bool, newArgs []
 		return nil, fmt.Errorf("could not launch process: %s", err)
 	}
 
+	discarded, err := d.restoreTarget(p, rebuild, offsets)
+	if err != nil {
+		return nil, err
+	}
+	d.target = p
+	// the runtime trace of the old process is lost.
+	d.runtimeTrace = nil
+	if !d.isRunning() {
+		// Not restarted while continuing the target, see Config.Watch.
+		d.stopTimes.stop("restart")
+		d.recordTimelineStop("restart", nil)
+	}
+	return discarded, nil
+}
+
+// restoreTarget configures p, the target replacing d.target, like
+// d.target: the breakpoints of d.target are created in p, the ones that
+// can not be created are returned.
+// If rebuild is set p runs a new build of the executable: the breakpoints
+// in offsets, see breakpointOffsets, are moved with their functions and
+// the ones set on addresses are discarded.
+func (d *Debugger) restoreTarget(p *proc.Target, rebuild bool, offsets map[int]int) ([]api.DiscardedBreakpoint, error) {
 	discarded := []api.DiscardedBreakpoint{}
 	for _, oldBp := range api.ConvertBreakpoints(d.breakpoints()) {
-		if oldBp.ID < 0 {
+		if oldBp.ID < 0 || (oldBp.ID == d.subtestBreakpoint && (d.config.Subtest != "" || d.config.Fuzz != "")) {
 			continue
 		}
-		if len(oldBp.File) > 0 {
-			addrs, err := proc.FindFileLocation(p, oldBp.File, oldBp.Line)
+		if oldBp.ErrorReturn {
+			addrs, err := functionReturnLocations(p, oldBp.FunctionName, false)
+			if err != nil {
+				discarded = append(discarded, api.DiscardedBreakpoint{Breakpoint: oldBp, Reason: err.Error()})
+				continue
+			}
+			createLogicalBreakpoint(p, addrs, oldBp)
+		} else if len(oldBp.File) > 0 {
+			var addrs []uint64
+			var err error
+			if offset, ok := offsets[oldBp.ID]; ok {
+				addrs, err = d.remapBreakpoint(p, oldBp, offset)
+			} else {
+				addrs, err = proc.FindFileLocation(p, oldBp.File, oldBp.Line)
+			}
 			if err != nil {
 				discarded = append(discarded, api.DiscardedBreakpoint{Breakpoint: oldBp, Reason: err.Error()})
 				continue
@@ -505,10 +859,140 @@ func (d *Debugger) Restart(rerecord bool, pos string, resetArgs bool, newArgs []
 			}
 		}
 	}
-	d.target = p
+	if d.config.StopOnExit {
+		p.SetExitBreakpoints()
+	}
+	d.resetExprWatches()
+	if len(d.coverageSpecs) > 0 {
+		if _, err := addCoverage(p, d.coverageSpecs); err != nil {
+			d.log.Warnf("could not restore line coverage: %v", err)
+		}
+	}
+	if err := d.setTestBreakpoints(p); err != nil {
+		return nil, err
+	}
+	if d.flavor != nil {
+		p.SetFlavor(d.flavor)
+	}
+	d.followExec(p)
+	d.catchSyscalls(p)
 	return discarded, nil
 }
 
+// breakpointOffsets returns the number of lines between the user
+// breakpoints of p, set on a line of a function, and the entry point of
+// their function, indexed by logical ID. Restarting a rebuilt executable
+// they are set at the same offset from the new entry point, following
+// their function when the lines above it change.
+func breakpointOffsets(p *proc.Target, bps []*proc.Breakpoint) map[int]int {
+	offsets := map[int]int{}
+	bi := p.BinInfo()
+	for _, bp := range bps {
+		if bp.LogicalID < 0 || bp.File == "" || bp.FunctionName == "" {
+			continue
+		}
+		if _, ok := offsets[bp.LogicalID]; ok {
+			continue
+		}
+		fn := bi.LookupFunc[bp.FunctionName]
+		if fn == nil {
+			continue
+		}
+		file, line, _ := bi.PCToLine(fn.Entry)
+		if file != bp.File || line > bp.Line {
+			continue
+		}
+		offsets[bp.LogicalID] = bp.Line - line
+	}
+	return offsets
+}
+
+// remapBreakpoint returns the addresses of the line offset lines after
+// the entry point of the function of bp in p.
+func (d *Debugger) remapBreakpoint(p *proc.Target, bp *api.Breakpoint, offset int) ([]uint64, error) {
+	bi := p.BinInfo()
+	fn := bi.LookupFunc[bp.FunctionName]
+	if fn == nil {
+		return nil, fmt.Errorf("function %s not found in the new executable", bp.FunctionName)
+	}
+	file, line, _ := bi.PCToLine(fn.Entry)
+	line += offset
+	addrs, err := proc.FindFileLocation(p, file, line)
+	if err != nil {
+		return nil, err
+	}
+	// The other addresses can be inlined calls of the function.
+	found := false
+	for _, addr := range addrs {
+		if addr >= fn.Entry && addr < fn.End {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("line %s:%d is not in function %s anymore", file, line, bp.FunctionName)
+	}
+	if file != bp.File || line != bp.Line {
+		d.log.Debugf("breakpoint %d moved from %s:%d to %s:%d", bp.ID, bp.File, bp.Line, file, line)
+	}
+	return addrs, nil
+}
+
+// setTestBreakpoints creates the breakpoints finding the functions of
+// Config.Subtest and Config.Fuzz, see breakInSubtest.
+func (d *Debugger) setTestBreakpoints(p *proc.Target) error {
+	if d.config.Subtest != "" {
+		if err := p.SetSubtestBreakpoint(d.config.Subtest); err != nil {
+			return fmt.Errorf("could not set a breakpoint for test %s: %v", d.config.Subtest, err)
+		}
+	}
+	if d.config.Fuzz != "" {
+		if err := p.SetFuzzBreakpoint(d.config.Fuzz); err != nil {
+			return fmt.Errorf("could not set a breakpoint for fuzz test %s: %v", d.config.Fuzz, err)
+		}
+	}
+	return nil
+}
+
+// reattach waits for a new process called d.config.AttachName, after the
+// target exited, and attaches to it, keeping the breakpoints. Waiting is
+// interrupted by a halt request.
+func (d *Debugger) reattach() error {
+	cancel := make(chan struct{})
+	d.recordMutex.Lock()
+	d.waitCancel = cancel
+	d.recordMutex.Unlock()
+	defer func() {
+		d.recordMutex.Lock()
+		d.waitCancel = nil
+		d.recordMutex.Unlock()
+	}()
+
+	d.log.Infof("waiting for a new process called %s", d.config.AttachName)
+	pid, err := findproc.Wait(d.config.AttachName, cancel)
+	if err != nil {
+		return err
+	}
+	d.log.Infof("attaching to pid %d", pid)
+	if err := d.detach(false); err != nil {
+		d.log.Debugf("could not detach from the exited target: %v", err)
+	}
+	p, err := d.Attach(pid, "")
+	if err != nil {
+		return attachErrorMessage(pid, err)
+	}
+	discarded, err := d.restoreTarget(p, false, nil)
+	if err != nil {
+		p.Detach(false)
+		return err
+	}
+	for _, bp := range discarded {
+		d.log.Warnf("breakpoint %d discarded: %s", bp.Breakpoint.ID, bp.Reason)
+	}
+	d.config.AttachPid = pid
+	d.target = p
+	return nil
+}
+
 // State returns the current state of the debugger.
 func (d *Debugger) State(nowait bool) (*api.DebuggerState, error) {
 	if d.isRunning() && nowait {
@@ -535,7 +1019,7 @@ func (d *Debugger) state(retLoadCfg *proc.LoadConfig) (*api.DebuggerState, error
 	)
 
 	if d.target.SelectedGoroutine() != nil {
-		goroutine = api.ConvertGoroutine(d.target.SelectedGoroutine())
+		goroutine = d.convertGoroutine(d.target.SelectedGoroutine())
 	}
 
 	exited := false
@@ -549,10 +1033,11 @@ func (d *Debugger) state(retLoadCfg *proc.LoadConfig) (*api.DebuggerState, error
 	}
 
 	for _, thread := range d.target.ThreadList() {
-		th := api.ConvertThread(thread)
+		th := d.convertThread(thread)
 
 		if retLoadCfg != nil {
 			th.ReturnValues = convertVars(thread.Common().ReturnValues(*retLoadCfg))
+			th.ReturnFunction = api.ConvertFunction(thread.Common().ReturnFunction())
 		}
 
 		state.Threads = append(state.Threads, th)
@@ -567,6 +1052,8 @@ func (d *Debugger) state(retLoadCfg *proc.LoadConfig) (*api.DebuggerState, error
 		state.When, _ = d.target.When()
 	}
 
+	state.GC = d.gcState()
+
 	return state, nil
 }
 
@@ -575,6 +1062,10 @@ func (d *Debugger) CreateBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoin
 	d.targetMutex.Lock()
 	defer d.targetMutex.Unlock()
 
+	if err := d.checkReadOnlyBreakpoint(requestedBp); err != nil {
+		return nil, err
+	}
+
 	var (
 		addrs []uint64
 		err   error
@@ -590,6 +1081,14 @@ func (d *Debugger) CreateBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoin
 	}
 
 	switch {
+	case requestedBp.ErrorReturn:
+		if requestedBp.FunctionName == "" {
+			return nil, errors.New("breakpoints on error return require a function name")
+		}
+		addrs, err = functionReturnLocations(d.target, requestedBp.FunctionName, false)
+		if err == nil && len(addrs) == 0 {
+			err = fmt.Errorf("could not find return instructions of %s", requestedBp.FunctionName)
+		}
 	case requestedBp.TraceReturn:
 		addrs = []uint64{requestedBp.Addr}
 	case len(requestedBp.File) > 0:
@@ -621,7 +1120,9 @@ func (d *Debugger) CreateBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoin
 	if err != nil {
 		return nil, err
 	}
+	createdBp.StaleSource = d.target.BinInfo().SourceIsStale(createdBp.File)
 	d.log.Infof("created breakpoint: %#v", createdBp)
+	d.forwardBreakpoint(createdBp)
 	return createdBp, nil
 }
 
@@ -662,11 +1163,47 @@ func createLogicalBreakpoint(p *proc.Target, addrs []uint64, requestedBp *api.Br
 	return createdBp[0], nil // we created a single logical breakpoint, the slice here will always have len == 1
 }
 
+// clearTemporaryBreakpoints clears the user breakpoints on addrs, created
+// by an operation of the debugger for its own use. If the target exited
+// they are only removed, they must not be restored by restart.
+func clearTemporaryBreakpoints(p *proc.Target, addrs []uint64) error {
+	if _, err := p.Valid(); err != nil {
+		bpmap := p.Breakpoints()
+		for _, addr := range addrs {
+			if bp := bpmap.M[addr]; bp != nil {
+				bp.Kind &^= proc.UserBreakpoint
+				if bp.Kind == 0 {
+					delete(bpmap.M, addr)
+				}
+			}
+		}
+		return nil
+	}
+	for _, addr := range addrs {
+		if _, err := p.ClearBreakpoint(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func isBreakpointExistsErr(err error) bool {
 	_, r := err.(proc.BreakpointExistsError)
 	return r
 }
 
+// checkReadOnlyBreakpoint returns ErrReadOnly if bp can not be created
+// because the debugger is read-only.
+func (d *Debugger) checkReadOnlyBreakpoint(bp *api.Breakpoint) error {
+	if !d.config.ReadOnly {
+		return nil
+	}
+	if d.config.AllowTracepoints && (bp.Tracepoint || bp.TraceReturn) {
+		return nil
+	}
+	return ErrReadOnly
+}
+
 // AmendBreakpoint will update the breakpoint with the matching ID.
 func (d *Debugger) AmendBreakpoint(amend *api.Breakpoint) error {
 	d.targetMutex.Lock()
@@ -674,10 +1211,21 @@ func (d *Debugger) AmendBreakpoint(amend *api.Breakpoint) error {
 
 	originals := d.findBreakpoint(amend.ID)
 	if originals == nil {
-		return fmt.Errorf("no breakpoint with ID %d", amend.ID)
+		return api.Errorf(api.ErrCodeNoSuchBreakpoint, "no breakpoint with ID %d", amend.ID)
 	}
-	if err := api.ValidBreakpointName(amend.Name); err != nil {
-		return err
+	// Amending a breakpoint does not change the target, but a tracepoint
+	// must not become a breakpoint that would keep the target stopped.
+	if originals[0].Tracepoint || originals[0].TraceReturn {
+		if err := d.checkReadOnlyBreakpoint(amend); err != nil {
+			return err
+		}
+	}
+	// The names of the breakpoints created by the debugger, like
+	// unrecovered-panic, are not valid user names but can be kept.
+	if amend.Name != originals[0].Name {
+		if err := api.ValidBreakpointName(amend.Name); err != nil {
+			return err
+		}
 	}
 	for _, original := range originals {
 		if err := copyBreakpointInfo(original, amend); err != nil {
@@ -702,6 +1250,20 @@ func copyBreakpointInfo(bp *proc.Breakpoint, requested *api.Breakpoint) (err err
 	bp.Goroutine = requested.Goroutine
 	bp.Stacktrace = requested.Stacktrace
 	bp.Variables = requested.Variables
+	bp.Sample = requested.Sample
+	bp.ErrorReturn = requested.ErrorReturn
+	bp.AtExit = requested.AtExit
+	bp.StackContains = requested.StackContains
+	bp.StackContainsDepth = requested.StackContainsDepth
+	if bp.Sample && len(bp.Variables) == 0 {
+		return errors.New("sample breakpoints must specify at least one expression")
+	}
+	if bp.AtExit && bp.ErrorReturn {
+		return errors.New("breakpoints on error return can not be triggered at function exit")
+	}
+	if bp.StackContainsDepth < 0 {
+		return errors.New("negative stack depth")
+	}
 	bp.LoadArgs = api.LoadConfigToProc(requested.LoadArgs)
 	bp.LoadLocals = api.LoadConfigToProc(requested.LoadLocals)
 	bp.Cond = nil
@@ -760,6 +1322,7 @@ func (d *Debugger) ClearBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoint
 		return nil, nil
 	}
 	d.log.Infof("cleared breakpoint: %#v", clearedBp)
+	d.forwardClearBreakpoint(clearedBp[0].ID)
 	return clearedBp[0], nil
 }
 
@@ -767,7 +1330,16 @@ func (d *Debugger) ClearBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoint
 func (d *Debugger) Breakpoints() []*api.Breakpoint {
 	d.targetMutex.Lock()
 	defer d.targetMutex.Unlock()
-	return api.ConvertBreakpoints(d.breakpoints())
+	return d.markStaleBreakpoints(api.ConvertBreakpoints(d.breakpoints()))
+}
+
+// markStaleBreakpoints sets the StaleSource field of bps and returns them.
+func (d *Debugger) markStaleBreakpoints(bps []*api.Breakpoint) []*api.Breakpoint {
+	bi := d.target.BinInfo()
+	for _, bp := range bps {
+		bp.StaleSource = bi.SourceIsStale(bp.File)
+	}
+	return bps
 }
 
 func (d *Debugger) breakpoints() []*proc.Breakpoint {
@@ -785,7 +1357,7 @@ func (d *Debugger) breakpoints() []*proc.Breakpoint {
 func (d *Debugger) FindBreakpoint(id int) *api.Breakpoint {
 	d.targetMutex.Lock()
 	defer d.targetMutex.Unlock()
-	bps := api.ConvertBreakpoints(d.findBreakpoint(id))
+	bps := d.markStaleBreakpoints(api.ConvertBreakpoints(d.findBreakpoint(id)))
 	if len(bps) <= 0 {
 		return nil
 	}
@@ -795,7 +1367,8 @@ func (d *Debugger) FindBreakpoint(id int) *api.Breakpoint {
 func (d *Debugger) findBreakpoint(id int) []*proc.Breakpoint {
 	var bps []*proc.Breakpoint
 	for _, bp := range d.target.Breakpoints().M {
-		if bp.LogicalID == id {
+		// internal breakpoints have their own IDs
+		if bp.IsUser() && bp.LogicalID == id {
 			bps = append(bps, bp)
 		}
 	}
@@ -820,7 +1393,7 @@ func (d *Debugger) findBreakpointByName(name string) *api.Breakpoint {
 		return nil
 	}
 	sort.Sort(breakpointsByLogicalID(bps))
-	r := api.ConvertBreakpoints(bps)
+	r := d.markStaleBreakpoints(api.ConvertBreakpoints(bps))
 	return r[0] // there can only be one logical breakpoint with the same name
 }
 
@@ -835,11 +1408,54 @@ func (d *Debugger) Threads() ([]*api.Thread, error) {
 
 	threads := []*api.Thread{}
 	for _, th := range d.target.ThreadList() {
-		threads = append(threads, api.ConvertThread(th))
+		threads = append(threads, d.convertThread(th))
 	}
 	return threads, nil
 }
 
+// convertThread converts th to an api.Thread, with the name of the thread
+// if the target is a process of this machine.
+func (d *Debugger) convertThread(th proc.Thread) *api.Thread {
+	r := api.ConvertThread(th)
+	if d.localProcess() {
+		r.Name = threadName(d.target.Pid(), r.ID)
+	}
+	return r
+}
+
+// convertGoroutine converts g to an api.Goroutine, with the name of its
+// thread if the target is a process of this machine.
+func (d *Debugger) convertGoroutine(g *proc.G) *api.Goroutine {
+	r := api.ConvertGoroutine(g)
+	if r.ThreadID != 0 && d.localProcess() {
+		r.ThreadName = threadName(d.target.Pid(), r.ThreadID)
+	}
+	return r
+}
+
+// localProcess returns true if the target is a process running on this
+// machine, whose state can be read from the operating system, false for
+// core files, recordings and processes debugged through a remote stub.
+func (d *Debugger) localProcess() bool {
+	recorded, _ := d.target.Recorded()
+	return d.config.CoreFile == "" && !recorded && d.config.Backend != "gdbstub" && d.config.Backend != "ios"
+}
+
+// ReturnValues returns the values returned by the last function that the
+// current thread stepped out of, or over with next, and the function that
+// returned them.
+func (d *Debugger) ReturnValues(cfg proc.LoadConfig) ([]api.Variable, *api.Function, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if _, err := d.target.Valid(); err != nil {
+		return nil, nil, err
+	}
+
+	thread := d.target.CurrentThread()
+	return convertVars(thread.Common().ReturnValues(cfg)), api.ConvertFunction(thread.Common().ReturnFunction()), nil
+}
+
 // FindThread returns the thread for the given 'id'.
 func (d *Debugger) FindThread(id int) (*api.Thread, error) {
 	d.targetMutex.Lock()
@@ -851,12 +1467,28 @@ func (d *Debugger) FindThread(id int) (*api.Thread, error) {
 
 	for _, th := range d.target.ThreadList() {
 		if th.ThreadID() == id {
-			return api.ConvertThread(th), nil
+			return d.convertThread(th), nil
 		}
 	}
 	return nil, nil
 }
 
+// FindGoroutine returns the goroutine for the given 'id'.
+func (d *Debugger) FindGoroutine(id int) (*api.Goroutine, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+
+	g, err := proc.FindGoroutine(d.target, id)
+	if err != nil || g == nil {
+		return nil, err
+	}
+	return d.convertGoroutine(g), nil
+}
+
 func (d *Debugger) setRunning(running bool) {
 	d.runningMutex.Lock()
 	d.running = running
@@ -873,36 +1505,67 @@ func (d *Debugger) isRunning() bool {
 func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, error) {
 	var err error
 
+	if command.Name == api.Call && d.config.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
 	if command.Name == api.Halt {
 		// RequestManualStop does not invoke any ptrace syscalls, so it's safe to
 		// access the process directly.
 		d.log.Debug("halting")
 
 		d.recordMutex.Lock()
-		if d.stopRecording == nil {
+		if d.waitCancel != nil {
+			close(d.waitCancel)
+			d.waitCancel = nil
+		} else if d.stopRecording == nil {
+			d.haltRequested = true
 			err = d.target.RequestManualStop()
 		}
 		d.recordMutex.Unlock()
 	}
 
 	withBreakpointInfo := true
+	crashReport := false
 
 	d.targetMutex.Lock()
 	defer d.targetMutex.Unlock()
 
+	if d.liveTarget != nil && command.Name != api.SwitchThread && command.Name != api.SwitchGoroutine && command.Name != api.Halt {
+		return nil, ErrSnapshotSelected
+	}
+
 	d.setRunning(true)
 	defer d.setRunning(false)
 
+	resumed := command.Name != api.SwitchThread && command.Name != api.SwitchGoroutine && command.Name != api.Halt
+	d.exprWatchChanges = nil
+
+	if resumed && command.Name != api.Call {
+		d.logRuntimeTraceStop()
+	}
+
+	if resumed && d.config.CoreFile == "" {
+		d.stopTimes.resume()
+		defer func() {
+			if valid, _ := d.target.Valid(); valid {
+				d.stopTimes.stop(command.Name)
+			}
+		}()
+	}
+
 	switch command.Name {
 	case api.Continue:
 		d.log.Debug("continuing")
 		if err := d.target.ChangeDirection(proc.Forward); err != nil {
 			return nil, err
 		}
-		err = d.target.Continue()
+		err = d.continueSampling()
+		crashReport = true
 	case api.DirectionCongruentContinue:
 		d.log.Debug("continuing (direction congruent)")
-		err = d.target.Continue()
+		err = d.continueSampling()
+		crashReport = true
 	case api.Call:
 		d.log.Debugf("function call %s", command.Expr)
 		if err := d.target.ChangeDirection(proc.Forward); err != nil {
@@ -942,7 +1605,12 @@ func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, er
 		if err := d.target.ChangeDirection(proc.Forward); err != nil {
 			return nil, err
 		}
-		err = d.target.Step()
+		d.target.SetStepSkipPackages(command.SkipPackages)
+		if command.FollowChannel {
+			err = d.target.StepFollowChannel()
+		} else {
+			err = d.target.Step()
+		}
 	case api.ReverseStep:
 		d.log.Debug("reverse stepping")
 		if err := d.target.ChangeDirection(proc.Backward); err != nil {
@@ -991,6 +1659,7 @@ func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, er
 
 	if err != nil {
 		if exitedErr, exited := err.(proc.ErrProcessExited); command.Name != api.SwitchGoroutine && command.Name != api.SwitchThread && exited {
+			d.recordTimelineStop(command.Name, &exitedErr)
 			state := &api.DebuggerState{}
 			state.Exited = true
 			state.ExitStatus = exitedErr.Status
@@ -999,15 +1668,28 @@ func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, er
 		}
 		return nil, err
 	}
+	if resumed {
+		d.evalExprWatches()
+	}
 	state, stateErr := d.state(api.LoadConfigToProc(command.ReturnInfoLoadConfig))
 	if stateErr != nil {
 		return state, stateErr
 	}
+	state.ExprWatchChanges = d.exprWatchChanges
+	d.recordRuntimeTraceStop(state)
+	if resumed {
+		d.recordTimelineStop(command.Name, nil)
+	}
 	if withBreakpointInfo {
 		err = d.collectBreakpointInformation(state)
 	}
+	if crashReport {
+		if err := d.writeCrashReport(); err != nil {
+			d.log.Errorf("could not write crash report: %v", err)
+		}
+	}
 	for _, th := range state.Threads {
-		if th.Breakpoint != nil && th.Breakpoint.TraceReturn {
+		if th.Breakpoint != nil && (th.Breakpoint.TraceReturn || th.Breakpoint.ErrorReturn) {
 			for _, v := range th.BreakpointInfo.Arguments {
 				if (v.Flags & api.VariableReturnArgument) != 0 {
 					th.ReturnValues = append(th.ReturnValues, v)
@@ -1018,6 +1700,148 @@ func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, er
 	return state, err
 }
 
+// continueSampling resumes the target, every time the target stops only
+// because of sample breakpoints the values of their expressions are
+// recorded and the target is resumed again, the same happens for the
+// breakpoints of watches unless the value of a watch changed.
+func (d *Debugger) continueSampling() error {
+	for {
+		if err := d.target.Continue(); err != nil {
+			if _, exited := err.(proc.ErrProcessExited); exited {
+				if d.config.Reattach && d.reattach() == nil {
+					continue
+				}
+				if len(d.config.Watch) > 0 && d.waitRestart() {
+					continue
+				}
+			}
+			return err
+		}
+		if d.target.StopReason == proc.StopManual && d.takeWatchRestart() {
+			// If the executable can not be built the old process is
+			// continued.
+			d.restartWatched()
+			continue
+		}
+		if d.target.StopReason != proc.StopBreakpoint {
+			return nil
+		}
+		if d.collectSamples() || d.atExprWatchBreakpoints() {
+			// the target is resumed unless the value of a watch changed
+			if d.evalExprWatches() {
+				return nil
+			}
+			continue
+		}
+		if !d.breakInSubtest() {
+			return nil
+		}
+	}
+}
+
+// breakInSubtest creates a breakpoint at the first line of the function of
+// Config.Subtest, for the goroutine of the thread stopped at the
+// subtest-runner breakpoint, or of the fuzz function of Config.Fuzz, and
+// clears the breakpoint the thread is stopped at. Returns false, without
+// doing anything, if any thread is stopped at another breakpoint.
+func (d *Debugger) breakInSubtest() bool {
+	var runner proc.Thread
+	for _, thread := range d.target.ThreadList() {
+		bp := thread.Breakpoint()
+		if bp.Breakpoint == nil || !bp.Active {
+			continue
+		}
+		if bp.Name != proc.SubtestRunner && bp.Name != proc.FuzzRunner {
+			return false
+		}
+		runner = thread
+	}
+	if runner == nil {
+		return false
+	}
+	fn, g, err := proc.SubtestFunction(runner)
+	if err != nil {
+		d.log.Errorf("could not find the function of the test: %v", err)
+		return false
+	}
+	pc, err := proc.FirstPCAfterPrologue(d.target, fn, false)
+	if err != nil {
+		d.log.Errorf("could not find the first line of %s: %v", fn.Name, err)
+		return false
+	}
+	requested := &api.Breakpoint{}
+	if g != nil {
+		// The function of table driven tests runs for every case.
+		requested.Cond = fmt.Sprintf("runtime.curg.goid == %d", g.ID)
+	}
+	bp, err := createLogicalBreakpoint(d.target, []uint64{pc}, requested)
+	switch {
+	case err == nil:
+		d.subtestBreakpoint = bp.ID
+	case isBreakpointExistsErr(err):
+		// the user already created a breakpoint there
+	default:
+		d.log.Errorf("could not create a breakpoint on %s: %v", fn.Name, err)
+		return false
+	}
+	if _, err := d.target.ClearBreakpoint(runner.Breakpoint().Addr); err != nil {
+		d.log.Errorf("could not clear the %s breakpoint: %v", runner.Breakpoint().Name, err)
+	}
+	return true
+}
+
+// collectSamples records a sample for every thread stopped at a sample
+// breakpoint. Returns false, without recording anything, if any thread is
+// stopped at a breakpoint that isn't a sample breakpoint.
+func (d *Debugger) collectSamples() bool {
+	var threads []proc.Thread
+	for _, thread := range d.target.ThreadList() {
+		bp := thread.Breakpoint()
+		if bp.Breakpoint == nil || !bp.Active {
+			continue
+		}
+		if bp.Internal || !bp.Sample {
+			return false
+		}
+		threads = append(threads, thread)
+	}
+	if len(threads) == 0 {
+		return false
+	}
+	now := time.Now()
+	for _, thread := range threads {
+		bp := thread.Breakpoint().Breakpoint
+		sample := api.Sample{BreakpointID: bp.LogicalID, Time: now, Variables: make([]api.Variable, len(bp.Variables))}
+		if g, _ := proc.GetG(thread); g != nil {
+			sample.GoroutineID = g.ID
+		}
+		s, scopeErr := proc.GoroutineScope(thread)
+		for i := range bp.Variables {
+			if scopeErr != nil {
+				sample.Variables[i] = api.Variable{Name: bp.Variables[i], Unreadable: fmt.Sprintf("eval error: %v", scopeErr)}
+				continue
+			}
+			v, err := s.EvalVariable(bp.Variables[i], proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1})
+			if err != nil {
+				sample.Variables[i] = api.Variable{Name: bp.Variables[i], Unreadable: fmt.Sprintf("eval error: %v", err)}
+			} else {
+				sample.Variables[i] = *api.ConvertVar(v)
+			}
+		}
+		d.samples.add(sample)
+		d.recordTimelineHit(thread, &sample)
+	}
+	return true
+}
+
+// Samples returns the values collected by sample breakpoints, oldest
+// first, and the number of samples that were discarded because the sample
+// buffer was full. If clear is true the sample buffer is emptied.
+// Can be called while the target is running.
+func (d *Debugger) Samples(clear bool) ([]api.Sample, uint64) {
+	return d.samples.get(clear)
+}
+
 func (d *Debugger) collectBreakpointInformation(state *api.DebuggerState) error {
 	if state == nil {
 		return nil
@@ -1037,7 +1861,9 @@ func (d *Debugger) collectBreakpointInformation(state *api.DebuggerState) error
 			if err != nil {
 				return err
 			}
-			bpi.Goroutine = api.ConvertGoroutine(g)
+			if g != nil {
+				bpi.Goroutine = api.ConvertGoroutine(g)
+			}
 		}
 
 		if bp.Stacktrace > 0 {
@@ -1077,6 +1903,11 @@ func (d *Debugger) collectBreakpointInformation(state *api.DebuggerState) error
 				bpi.Variables[i] = *api.ConvertVar(v)
 			}
 		}
+		if bp.Name == proc.UnrecoveredPanic {
+			if v, err := s.EvalVariable("runtime.curg._panic.arg", errorChainLoadConfig); err == nil {
+				bpi.ErrorChain = errorChain(d.target.BinInfo(), api.ConvertVar(v))
+			}
+		}
 		if bp.LoadArgs != nil {
 			if vars, err := s.FunctionArguments(*api.LoadConfigToProc(bp.LoadArgs)); err == nil {
 				bpi.Arguments = convertVars(vars)
@@ -1155,6 +1986,64 @@ func (d *Debugger) Types(filter string) ([]string, error) {
 	return r, nil
 }
 
+// SearchSymbols returns the functions, types and package variables whose
+// name matches query, of the kinds specified by kinds (all of them if kinds
+// is 0), ranked by how well they match. See package fuzzy for a
+// description of the matching. If limit is greater than zero at most limit
+// symbols are returned.
+func (d *Debugger) SearchSymbols(query string, kinds api.SymbolKind, limit int) ([]api.Symbol, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if kinds == 0 {
+		kinds = api.SymbolFunction | api.SymbolType | api.SymbolVariable
+	}
+
+	bi := d.target.BinInfo()
+	var names []string
+	var symkinds []api.SymbolKind
+	add := func(kind api.SymbolKind, v []string) {
+		if kinds&kind == 0 {
+			return
+		}
+		names = append(names, v...)
+		for range v {
+			symkinds = append(symkinds, kind)
+		}
+	}
+
+	var fns []*proc.Function
+	if kinds&api.SymbolFunction != 0 {
+		fnnames := make([]string, len(bi.Functions))
+		fns = make([]*proc.Function, len(bi.Functions))
+		for i := range bi.Functions {
+			fnnames[i] = bi.Functions[i].Name
+			fns[i] = &bi.Functions[i]
+		}
+		add(api.SymbolFunction, fnnames)
+	}
+	types, err := bi.Types()
+	if err != nil {
+		return nil, err
+	}
+	add(api.SymbolType, types)
+	add(api.SymbolVariable, bi.PackageVarNames())
+
+	matches := fuzzy.Rank(query, names, limit)
+	r := make([]api.Symbol, len(matches))
+	for i, m := range matches {
+		r[i] = api.Symbol{Name: names[m.Index], Kind: symkinds[m.Index], Score: m.Score}
+		if m.Index < len(fns) {
+			fn := fns[m.Index]
+			r[i].PC = fn.Entry
+			if fn.Entry != 0 {
+				r[i].File, r[i].Line, _ = bi.PCToLine(fn.Entry)
+			}
+		}
+	}
+	return r, nil
+}
+
 // PackageVariables returns a list of package variables for the thread,
 // optionally regexp filtered using regexp described in 'filter'.
 func (d *Debugger) PackageVariables(threadID int, filter string, cfg proc.LoadConfig) ([]api.Variable, error) {
@@ -1179,6 +2068,9 @@ func (d *Debugger) PackageVariables(threadID int, filter string, cfg proc.LoadCo
 	if err != nil {
 		return nil, err
 	}
+	if cfg.Cancelled() {
+		return nil, proc.ErrCancelled
+	}
 	for _, v := range pv {
 		if regex.Match([]byte(v.Name)) {
 			vars = append(vars, *api.ConvertVar(v))
@@ -1276,6 +2168,9 @@ func (d *Debugger) LocalVariables(scope api.EvalScope, cfg proc.LoadConfig) ([]a
 	if err != nil {
 		return nil, err
 	}
+	if cfg.Cancelled() {
+		return nil, proc.ErrCancelled
+	}
 	return convertVars(pv), err
 }
 
@@ -1292,6 +2187,9 @@ func (d *Debugger) FunctionArguments(scope api.EvalScope, cfg proc.LoadConfig) (
 	if err != nil {
 		return nil, err
 	}
+	if cfg.Cancelled() {
+		return nil, proc.ErrCancelled
+	}
 	return convertVars(pv), nil
 }
 
@@ -1309,15 +2207,110 @@ func (d *Debugger) EvalVariableInScope(scope api.EvalScope, symbol string, cfg p
 	if err != nil {
 		return nil, err
 	}
+	if cfg.Cancelled() {
+		return nil, proc.ErrCancelled
+	}
 	return api.ConvertVar(v), err
 }
 
+// ExamineContext returns the chain of parents of the context.Context
+// resulting from evaluating expr in scope, see proc.ContextChain.
+func (d *Debugger) ExamineContext(scope api.EvalScope, expr string, cfg proc.LoadConfig) ([]api.Context, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	s, err := proc.ConvertEvalScope(d.target, scope.GoroutineID, scope.Frame, scope.DeferredCall)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.EvalVariable(expr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := proc.ContextChain(v, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Cancelled() {
+		return nil, proc.ErrCancelled
+	}
+	r := make([]api.Context, len(chain))
+	for i := range chain {
+		r[i] = api.ConvertContext(&chain[i])
+	}
+	return r, nil
+}
+
+// ListWorkers returns the goroutines working for the errgroup.Group,
+// semaphore.Weighted or channel resulting from evaluating expr in scope,
+// see proc.FindWorkers.
+func (d *Debugger) ListWorkers(scope api.EvalScope, expr string, cfg proc.LoadConfig) (*api.WorkerGroup, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	s, err := proc.ConvertEvalScope(d.target, scope.GoroutineID, scope.Frame, scope.DeferredCall)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.EvalVariable(expr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	wg, err := proc.FindWorkers(d.target, v, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return api.ConvertWorkerGroup(wg), nil
+}
+
+// ListTimers returns the pending timers of the runtime, sorted by the
+// time they fire, see proc.Timers, and the current time of the monotonic
+// clock of the target, or 0 if it is not known: for core files, recordings
+// and remote targets, and on the operating systems where the clock of the
+// runtime is not the one of the debugger.
+func (d *Debugger) ListTimers() ([]api.Timer, int64, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	timers, err := proc.Timers(d.target)
+	if err != nil {
+		return nil, 0, err
+	}
+	r := make([]api.Timer, len(timers))
+	for i := range timers {
+		r[i] = api.ConvertTimer(&timers[i])
+	}
+
+	var now int64
+	if d.localProcess() {
+		now, _ = monotonicNow()
+	}
+	return r, now, nil
+}
+
+// ListFinalizers returns the finalizers of the target and the state of the
+// goroutine running them, see proc.Finalizers.
+func (d *Debugger) ListFinalizers() (*api.FinalizerState, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	fs, err := proc.Finalizers(d.target)
+	if err != nil {
+		return nil, err
+	}
+	return api.ConvertFinalizerState(fs), nil
+}
+
 // SetVariableInScope will set the value of the variable represented by
 // 'symbol' to the value given, in the given scope.
 func (d *Debugger) SetVariableInScope(scope api.EvalScope, symbol, value string) error {
 	d.targetMutex.Lock()
 	defer d.targetMutex.Unlock()
 
+	if d.config.ReadOnly {
+		return ErrReadOnly
+	}
+
 	s, err := proc.ConvertEvalScope(d.target, scope.GoroutineID, scope.Frame, scope.DeferredCall)
 	if err != nil {
 		return err
@@ -1336,7 +2329,7 @@ func (d *Debugger) Goroutines(start, count int) ([]*api.Goroutine, int, error) {
 		return nil, 0, err
 	}
 	for _, g := range gs {
-		goroutines = append(goroutines, api.ConvertGoroutine(g))
+		goroutines = append(goroutines, d.convertGoroutine(g))
 	}
 	return goroutines, nextg, err
 }
@@ -1344,6 +2337,7 @@ func (d *Debugger) Goroutines(start, count int) ([]*api.Goroutine, int, error) {
 // Stacktrace returns a list of Stackframes for the given goroutine. The
 // length of the returned list will be min(stack_len, depth).
 // If 'full' is true, then local vars, function args, etc will be returned as well.
+// Loading them is abandoned if cfg.Cancel is closed.
 func (d *Debugger) Stacktrace(goroutineID, depth int, opts api.StacktraceOptions, cfg *proc.LoadConfig) ([]api.Stackframe, error) {
 	d.targetMutex.Lock()
 	defer d.targetMutex.Unlock()
@@ -1362,13 +2356,75 @@ func (d *Debugger) Stacktrace(goroutineID, depth int, opts api.StacktraceOptions
 	if g == nil {
 		rawlocs, err = proc.ThreadStacktrace(d.target.CurrentThread(), depth)
 	} else {
-		rawlocs, err = g.Stacktrace(depth, proc.StacktraceOptions(opts))
+		rawlocs, err = g.Stacktrace(depth, proc.StacktraceOptions(opts&^api.StacktraceShowHidden))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var hidden []int
+	if opts&api.StacktraceShowHidden == 0 {
+		rawlocs, hidden = d.frameFilters.filter(rawlocs)
 	}
+	locations, err := d.convertStacktrace(rawlocs, cfg)
+	if err != nil {
+		return nil, err
+	}
+	setHidden(locations, hidden)
+	return locations, nil
+}
+
+// DeferredCalls returns the pending deferred calls of the frames of
+// goroutine goroutineID, up to depth frames, in the order they will be
+// executed.
+func (d *Debugger) DeferredCalls(goroutineID, depth int, cfg *proc.LoadConfig) ([]api.DeferredCall, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+
+	g, err := proc.FindGoroutine(d.target, goroutineID)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, errors.New("no goroutine selected")
+	}
+
+	rawlocs, err := g.Stacktrace(depth, proc.StacktraceReadDefers)
 	if err != nil {
 		return nil, err
 	}
 
-	return d.convertStacktrace(rawlocs, cfg)
+	bi := d.target.BinInfo()
+	thread := d.target.CurrentThread()
+	panicking := g.Panicking()
+	r := []api.DeferredCall{}
+	for i := range rawlocs {
+		defers := d.convertDefers(rawlocs[i].Defers)
+		for j, rawdefer := range rawlocs[i].Defers {
+			call := api.DeferredCall{Defer: defers[j], Frame: i}
+			if rawdefer.Unreadable == nil {
+				call.Function = api.ConvertFunction(rawdefer.Function(bi, thread, d.target.Breakpoints()))
+				if cfg != nil {
+					args, err := rawdefer.Arguments(thread, *cfg)
+					if err != nil {
+						call.Unreadable = err.Error()
+					}
+					call.Arguments = convertVars(args)
+				}
+				if panicking && rawdefer.CallsRecover(bi, thread, d.target.Breakpoints()) {
+					// only the first deferred call calling recover stops the panic
+					call.Recovers = true
+					panicking = false
+				}
+			}
+			r = append(r, call)
+		}
+	}
+	return r, nil
 }
 
 // Ancestors returns the stacktraces for the ancestors of a goroutine.
@@ -1429,6 +2485,7 @@ func (d *Debugger) convertStacktrace(rawlocs []proc.Stackframe, cfg *proc.LoadCo
 		if rawlocs[i].Err != nil {
 			frame.Err = rawlocs[i].Err.Error()
 		}
+		frame.StaleSource = d.target.BinInfo().SourceIsStale(frame.File)
 		if cfg != nil && rawlocs[i].Current.Fn != nil {
 			var err error
 			scope := proc.FrameToScope(d.target.BinInfo(), d.target.CurrentThread(), nil, rawlocs[i:]...)
@@ -1440,6 +2497,9 @@ func (d *Debugger) convertStacktrace(rawlocs []proc.Stackframe, cfg *proc.LoadCo
 			if err != nil {
 				return nil, err
 			}
+			if cfg.Cancelled() {
+				return nil, proc.ErrCancelled
+			}
 
 			frame.Locals = convertVars(locals)
 			frame.Arguments = convertVars(arguments)
@@ -1505,6 +2565,7 @@ func (d *Debugger) FindLocation(scope api.EvalScope, locStr string, includeNonEx
 		locs[i].File = file
 		locs[i].Line = line
 		locs[i].Function = api.ConvertFunction(fn)
+		locs[i].StaleSource = d.target.BinInfo().SourceIsStale(file)
 	}
 	return locs, err
 }
@@ -1596,11 +2657,28 @@ func (d *Debugger) ListDynamicLibraries() []api.Image {
 	r := make([]api.Image, 0, len(bi.Images)-1)
 	// skips the first image because it's the executable file
 	for i := range bi.Images[1:] {
+		if bi.Images[i+1].IsSplitDwarf() {
+			continue
+		}
 		r = append(r, api.ConvertImage(bi.Images[i+1]))
 	}
 	return r
 }
 
+// ListCapabilities returns the features that depend on the debug
+// information of the runtime and whether they are available for the
+// target program.
+func (d *Debugger) ListCapabilities() []api.Capability {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+	caps := d.target.BinInfo().Capabilities()
+	r := make([]api.Capability, len(caps))
+	for i := range caps {
+		r[i] = api.ConvertCapability(caps[i])
+	}
+	return r
+}
+
 // ExamineMemory returns the raw memory stored at the given address.
 // The amount of data to be read is specified by length.
 // This function will return an error if it reads less than `length` bytes.
@@ -1617,9 +2695,26 @@ func (d *Debugger) ExamineMemory(address uintptr, length int) ([]byte, error) {
 	if length != n {
 		return nil, errors.New("the specific range has exceeded readable area")
 	}
+	metrics.MemoryReadBytes.Add(float64(n))
 	return data, nil
 }
 
+// WriteMemory writes data to the memory of the target at the given
+// address and returns the number of bytes written.
+func (d *Debugger) WriteMemory(address uintptr, data []byte) (int, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if d.config.ReadOnly {
+		return 0, ErrReadOnly
+	}
+
+	if _, err := d.target.Valid(); err != nil {
+		return 0, err
+	}
+	return d.target.CurrentThread().WriteMemory(address, data)
+}
+
 func (d *Debugger) GetVersion(out *api.GetVersionOut) error {
 	if d.config.CoreFile != "" {
 		if d.config.Backend == "rr" {
@@ -1629,7 +2724,9 @@ func (d *Debugger) GetVersion(out *api.GetVersionOut) error {
 		}
 	} else {
 		if d.config.Backend == "default" {
-			if runtime.GOOS == "darwin" {
+			if goos, _ := proc.ExecutableOS(d.target.BinInfo().Images[0].Path); goos == "windows" && runtime.GOOS != "windows" {
+				out.Backend = "wine"
+			} else if runtime.GOOS == "darwin" {
 				out.Backend = "lldb"
 			} else {
 				out.Backend = "native"
@@ -13,3 +13,19 @@ func attachErrorMessage(pid int, err error) error {
 func stopProcess(pid int) error {
 	return sys.Kill(pid, sys.SIGSTOP)
 }
+
+func resumeProcess(pid int) error {
+	return sys.Kill(pid, sys.SIGCONT)
+}
+
+// monotonicNow returns false, the clock of runtime.nanotime is not
+// available to the debugger.
+func monotonicNow() (int64, bool) {
+	return 0, false
+}
+
+// threadName returns the empty string, the names of the threads of other
+// processes are not available.
+func threadName(pid, tid int) string {
+	return ""
+}
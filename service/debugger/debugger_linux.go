@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"syscall"
 
 	sys "golang.org/x/sys/unix"
@@ -34,3 +35,27 @@ func attachErrorMessage(pid int, err error) error {
 func stopProcess(pid int) error {
 	return sys.Kill(pid, sys.SIGSTOP)
 }
+
+func resumeProcess(pid int) error {
+	return sys.Kill(pid, sys.SIGCONT)
+}
+
+// monotonicNow returns the current time of the monotonic clock used by
+// runtime.nanotime in the processes of this machine.
+func monotonicNow() (int64, bool) {
+	var ts sys.Timespec
+	if err := sys.ClockGettime(sys.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0, false
+	}
+	return ts.Nano(), true
+}
+
+// threadName returns the name of the thread tid of the process pid, set
+// with pthread_setname_np or prctl, see proc(5).
+func threadName(pid, tid int) string {
+	name, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/comm", pid, tid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(name), "\n")
+}
@@ -5,8 +5,10 @@ package debugger
 import (
 	"debug/elf"
 	"debug/macho"
+	"debug/pe"
 	"os"
 	"runtime"
+	"syscall"
 
 	"github.com/go-delve/delve/service/api"
 )
@@ -26,6 +28,11 @@ func verifyBinaryFormat(exePath string) error {
 		return api.ErrNotExecutable
 	}
 
+	// windows executables can be run under WINE with the wine backend
+	if _, err := pe.NewFile(f); err == nil {
+		return nil
+	}
+
 	// check that the binary format is what we expect for the host system
 	switch runtime.GOOS {
 	case "darwin":
@@ -40,3 +47,7 @@ func verifyBinaryFormat(exePath string) error {
 	}
 	return nil
 }
+
+func childSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"syscall"
 
 	"github.com/go-delve/delve/service/api"
 )
@@ -21,6 +22,14 @@ func stopProcess(pid int) error {
 	return nil
 }
 
+func resumeProcess(pid int) error {
+	return nil
+}
+
+func childSysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
 func verifyBinaryFormat(exePath string) error {
 	f, err := os.Open(exePath)
 	if err != nil {
@@ -40,3 +49,15 @@ func verifyBinaryFormat(exePath string) error {
 	}
 	return nil
 }
+
+// monotonicNow returns false, the clock of runtime.nanotime is not
+// available to the debugger.
+func monotonicNow() (int64, bool) {
+	return 0, false
+}
+
+// threadName returns the empty string, the names of the threads of other
+// processes are not available.
+func threadName(pid, tid int) string {
+	return ""
+}
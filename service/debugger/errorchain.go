@@ -0,0 +1,155 @@
+package debugger
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// errorChainLoadConfig is used to load panic values, it must be deep
+// enough to reach the innermost errors of long chains of wrapped errors.
+var errorChainLoadConfig = proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 32, MaxStringLen: 256, MaxArrayValues: 8, MaxStructFields: -1}
+
+// errorChain returns the chain of errors wrapped by the panic value v,
+// starting with v itself, or nil if v is not an error.
+// Errors are unwrapped following the fields of type error (the errors
+// returned by Unwrap() error) and []error (the errors returned by
+// Unwrap() []error, for example by errors.Join) of their concrete values,
+// messages are read from the fields of the errors of the standard
+// library. The Error methods of the target are never called.
+func errorChain(bi *proc.BinaryInfo, v *api.Variable) []api.WrappedError {
+	if v.Kind != reflect.Interface || len(v.Children) == 0 || v.Children[0].Kind == reflect.Invalid {
+		return nil
+	}
+	if v.Type != "error" && !hasErrorMethod(bi, v.Children[0].Type) {
+		return nil
+	}
+	var r []api.WrappedError
+	var visit func(v *api.Variable, depth int)
+	visit = func(v *api.Variable, depth int) {
+		if len(r) >= maxPanicChain {
+			return
+		}
+		concrete := &v.Children[0]
+		e := api.WrappedError{Type: concrete.Type, Message: errorMessage(v), Depth: depth}
+		if e.Message == "" {
+			e.Value = concrete.SinglelineString()
+		}
+		r = append(r, e)
+		for _, wrapped := range unwrapErrors(v) {
+			visit(wrapped, depth+1)
+		}
+	}
+	visit(v, 0)
+	return r
+}
+
+// hasErrorMethod returns true if the type called typ has an Error method.
+func hasErrorMethod(bi *proc.BinaryInfo, typ string) bool {
+	ptr := strings.HasPrefix(typ, "*")
+	typ = strings.TrimPrefix(typ, "*")
+	dot := strings.LastIndex(typ, ".")
+	if dot < 0 || dot < strings.LastIndex(typ, "/") {
+		return false
+	}
+	if bi.LookupFunc[typ+".Error"] != nil {
+		return true
+	}
+	return ptr && bi.LookupFunc[typ[:dot]+".(*"+typ[dot+1:]+").Error"] != nil
+}
+
+// concreteValue returns the concrete value of the interface variable v,
+// following pointers.
+func concreteValue(v *api.Variable) *api.Variable {
+	if v.Kind != reflect.Interface || len(v.Children) == 0 {
+		return nil
+	}
+	cur := &v.Children[0]
+	for (cur.Kind == reflect.Ptr || cur.Kind == reflect.Interface) && len(cur.Children) > 0 {
+		cur = &cur.Children[0]
+	}
+	return cur
+}
+
+// unwrapErrors returns all the errors wrapped by the error contained in
+// the interface variable v: the non-nil fields of type error and the
+// non-nil elements of the fields of type []error of its concrete value.
+func unwrapErrors(v *api.Variable) []*api.Variable {
+	cur := concreteValue(v)
+	if cur == nil || cur.Kind != reflect.Struct {
+		return nil
+	}
+	var r []*api.Variable
+	for i := range cur.Children {
+		field := &cur.Children[i]
+		switch {
+		case isError(field):
+			r = append(r, field)
+		case field.Type == "[]error" && field.Kind == reflect.Slice:
+			for j := range field.Children {
+				if isError(&field.Children[j]) {
+					r = append(r, &field.Children[j])
+				}
+			}
+		}
+	}
+	return r
+}
+
+func isError(v *api.Variable) bool {
+	return v.Type == "error" && v.Kind == reflect.Interface && len(v.Children) > 0 && v.Children[0].Kind != reflect.Invalid
+}
+
+// errorMessage returns the message of the error contained in the
+// interface variable v, if it can be determined from the fields of its
+// concrete value, or the empty string.
+func errorMessage(v *api.Variable) string {
+	cur := concreteValue(v)
+	if cur == nil {
+		return ""
+	}
+	if cur.Kind == reflect.String {
+		return cur.Value
+	}
+	if cur.Kind != reflect.Struct {
+		return ""
+	}
+	field := func(name string) *api.Variable {
+		for i := range cur.Children {
+			if cur.Children[i].Name == name {
+				return &cur.Children[i]
+			}
+		}
+		return nil
+	}
+	switch cur.Type {
+	case "io/fs.PathError", "os.PathError", "fs.PathError":
+		// Op + " " + Path + ": " + Err.Error()
+		op, path, err := field("Op"), field("Path"), field("Err")
+		if op != nil && path != nil && err != nil && isError(err) {
+			if msg := errorMessage(err); msg != "" {
+				return op.Value + " " + path.Value + ": " + msg
+			}
+		}
+		return ""
+	case "os.SyscallError":
+		// Syscall + ": " + Err.Error()
+		syscall, err := field("Syscall"), field("Err")
+		if syscall != nil && err != nil && isError(err) {
+			if msg := errorMessage(err); msg != "" {
+				return syscall.Value + ": " + msg
+			}
+		}
+		return ""
+	}
+	// errors.errorString, fmt.wrapError, fmt.wrapErrors and most errors
+	// that store their message
+	for _, name := range []string{"s", "msg"} {
+		if f := field(name); f != nil && f.Kind == reflect.String {
+			return f.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package debugger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func TestErrorChain(t *testing.T) {
+	iface := func(typ string, fields ...api.Variable) api.Variable {
+		return api.Variable{Type: "error", Kind: reflect.Interface, Children: []api.Variable{
+			{Type: "*" + typ, Kind: reflect.Ptr, Children: []api.Variable{
+				{Type: typ, Kind: reflect.Struct, Children: fields},
+			}},
+		}}
+	}
+	str := func(name, value string) api.Variable {
+		return api.Variable{Name: name, Type: "string", Kind: reflect.String, Value: value}
+	}
+	errno := api.Variable{Type: "error", Kind: reflect.Interface, Children: []api.Variable{
+		{Type: "syscall.Errno", Kind: reflect.Uint, Value: "2"},
+	}}
+	syscallErr := iface("os.SyscallError", str("Syscall", "open"), errno)
+	syscallErr.Children[0].Children[0].Children[1].Name = "Err"
+	pathErr := iface("io/fs.PathError", str("Op", "open"), str("Path", "/app.yml"), syscallErr)
+	pathErr.Children[0].Children[0].Children[2].Name = "Err"
+	custom := iface("main.configError", str("file", "app.yml"), pathErr)
+	wrapped := iface("fmt.wrapError", str("msg", "starting: config app.yml: open /app.yml: errno 2"), custom)
+	joined := iface("errors.joinError", api.Variable{Name: "errs", Type: "[]error", Kind: reflect.Slice, Children: []api.Variable{
+		wrapped,
+		iface("errors.errorString", str("s", "cleanup failed")),
+	}})
+
+	chain := errorChain(nil, &joined)
+	expected := []api.WrappedError{
+		{Type: "*errors.joinError", Value: chain[0].Value, Depth: 0},
+		{Type: "*fmt.wrapError", Message: "starting: config app.yml: open /app.yml: errno 2", Depth: 1},
+		{Type: "*main.configError", Value: chain[2].Value, Depth: 2},
+		{Type: "*io/fs.PathError", Value: chain[3].Value, Depth: 3},
+		{Type: "*os.SyscallError", Value: chain[4].Value, Depth: 4},
+		{Type: "syscall.Errno", Value: "2", Depth: 5},
+		{Type: "*errors.errorString", Message: "cleanup failed", Depth: 1},
+	}
+	if !reflect.DeepEqual(chain, expected) {
+		t.Fatalf("wrong error chain:\n%#v\nexpected:\n%#v", chain, expected)
+	}
+
+	pathErr = iface("io/fs.PathError", str("Op", "open"), str("Path", "/app.yml"), iface("errors.errorString", str("s", "not found")))
+	pathErr.Children[0].Children[0].Children[2].Name = "Err"
+	if msg := errorMessage(&pathErr); msg != "open /app.yml: not found" {
+		t.Fatalf("wrong message %q", msg)
+	}
+
+	notAnError := api.Variable{Type: "interface {}", Kind: reflect.Interface, Children: []api.Variable{
+		{Type: "string", Kind: reflect.String, Value: "boom"},
+	}}
+	if chain := errorChain(nil, &notAnError); chain != nil {
+		t.Fatalf("unexpected error chain %v", chain)
+	}
+}
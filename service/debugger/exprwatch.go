@@ -0,0 +1,208 @@
+package debugger
+
+import (
+	"fmt"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// exprWatch is an expression watched by the debugger, see CreateExprWatch.
+type exprWatch struct {
+	id        int
+	expr      string
+	locations []string
+	value     string // value of expr at the previous evaluation
+	evaluated bool   // value is set
+}
+
+// bpName returns the name of the breakpoints sampling w.
+func (w *exprWatch) bpName() string {
+	return fmt.Sprintf("watch%d", w.id)
+}
+
+// CreateExprWatch starts watching the value of the expression expr, the
+// target stops whenever it differs from the previous evaluation.
+// If locations is empty expr is evaluated every time the target stops,
+// on the current goroutine, including the stops at tracepoints and sample
+// breakpoints that do not stop the target otherwise. Otherwise expr is
+// evaluated only when the target reaches one of the locations, on the
+// goroutine that reached it, by breakpoints named after the watch that
+// do not stop the target unless the value changed.
+// Evaluations that fail, for example because a variable is not in scope,
+// are ignored. The previous values are forgotten when the target is
+// restarted.
+func (d *Debugger) CreateExprWatch(expr string, locations []string) (*api.ExprWatch, error) {
+	return d.createExprWatch(expr, locations, len(locations) == 0)
+}
+
+// CreateGlobalExprWatch is like CreateExprWatch for an expression whose
+// value does not depend on the goroutine evaluating it, for example the
+// dereference of an address: the first evaluation at the locations is
+// compared to its current value.
+func (d *Debugger) CreateGlobalExprWatch(expr string, locations []string) (*api.ExprWatch, error) {
+	return d.createExprWatch(expr, locations, true)
+}
+
+func (d *Debugger) createExprWatch(expr string, locations []string, evalNow bool) (*api.ExprWatch, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if d.config.ReadOnly && !d.config.AllowTracepoints && len(locations) > 0 {
+		return nil, ErrReadOnly
+	}
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+	d.exprWatchCounter++
+	w := &exprWatch{id: d.exprWatchCounter, expr: expr, locations: locations}
+	if d.findBreakpointByName(w.bpName()) != nil {
+		return nil, fmt.Errorf("breakpoint name %q already exists", w.bpName())
+	}
+	var created []uint64
+	for _, loc := range locations {
+		addrs, err := findLocationAddrs(d.target, loc)
+		if err == nil {
+			var bp *api.Breakpoint
+			bp, err = createLogicalBreakpoint(d.target, addrs, &api.Breakpoint{Name: w.bpName()})
+			if err == nil {
+				created = append(created, bp.Addrs...)
+			}
+		}
+		if err != nil {
+			if err1 := clearTemporaryBreakpoints(d.target, created); err1 != nil {
+				d.log.Errorf("could not clear the breakpoints of the watch: %v", err1)
+			}
+			return nil, fmt.Errorf("could not watch %s at %s: %v", expr, loc, err)
+		}
+	}
+	if evalNow {
+		// the current value is the one the next evaluation is compared to
+		w.value, w.evaluated = evalExprWatch(d.target.CurrentThread(), expr)
+	}
+	d.exprWatches = append(d.exprWatches, w)
+	return w.convert(), nil
+}
+
+// ExprWatches returns the expressions watched.
+func (d *Debugger) ExprWatches() []api.ExprWatch {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	r := make([]api.ExprWatch, 0, len(d.exprWatches))
+	for _, w := range d.exprWatches {
+		r = append(r, *w.convert())
+	}
+	return r
+}
+
+// ClearExprWatch stops watching the expression with the specified ID,
+// clearing its breakpoints.
+func (d *Debugger) ClearExprWatch(id int) error {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	for i, w := range d.exprWatches {
+		if w.id != id {
+			continue
+		}
+		var addrs []uint64
+		for _, bp := range d.breakpoints() {
+			if bp.IsUser() && bp.Name == w.bpName() {
+				addrs = append(addrs, bp.Addr)
+			}
+		}
+		if err := clearTemporaryBreakpoints(d.target, addrs); err != nil {
+			return err
+		}
+		d.exprWatches = append(d.exprWatches[:i], d.exprWatches[i+1:]...)
+		return nil
+	}
+	return fmt.Errorf("no watch with ID %d", id)
+}
+
+func (w *exprWatch) convert() *api.ExprWatch {
+	return &api.ExprWatch{ID: w.id, Expr: w.expr, Locations: w.locations, Value: w.value}
+}
+
+// exprWatchOf returns the watch sampled by the breakpoint thread is
+// stopped at, or nil.
+func (d *Debugger) exprWatchOf(thread proc.Thread) *exprWatch {
+	bp := thread.Breakpoint()
+	if bp.Breakpoint == nil || !bp.Active || !bp.IsUser() || bp.Name == "" {
+		return nil
+	}
+	for _, w := range d.exprWatches {
+		if len(w.locations) > 0 && bp.Name == w.bpName() {
+			return w
+		}
+	}
+	return nil
+}
+
+// atExprWatchBreakpoints returns true if all the threads stopped at a
+// breakpoint are stopped at the breakpoints of watches.
+func (d *Debugger) atExprWatchBreakpoints() bool {
+	found := false
+	for _, thread := range d.target.ThreadList() {
+		bp := thread.Breakpoint()
+		if bp.Breakpoint == nil || !bp.Active {
+			continue
+		}
+		if d.exprWatchOf(thread) == nil {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// evalExprWatches evaluates the watches sampled by the breakpoints the
+// threads are stopped at and the ones evaluated at every stop, recording
+// the changes in d.exprWatchChanges. Returns true if any value changed.
+func (d *Debugger) evalExprWatches() bool {
+	changed := false
+	update := func(w *exprWatch, thread proc.Thread) {
+		value, ok := evalExprWatch(thread, w.expr)
+		if !ok {
+			return
+		}
+		if w.evaluated && value != w.value {
+			d.exprWatchChanges = append(d.exprWatchChanges, api.ExprWatchChange{ID: w.id, Expr: w.expr, Old: w.value, New: value})
+			changed = true
+		}
+		w.value, w.evaluated = value, true
+	}
+	for _, thread := range d.target.ThreadList() {
+		if w := d.exprWatchOf(thread); w != nil {
+			update(w, thread)
+		}
+	}
+	for _, w := range d.exprWatches {
+		if len(w.locations) == 0 {
+			update(w, d.target.CurrentThread())
+		}
+	}
+	return changed
+}
+
+// evalExprWatch returns the value of expr on the goroutine of thread.
+func evalExprWatch(thread proc.Thread, expr string) (string, bool) {
+	scope, err := proc.GoroutineScope(thread)
+	if err != nil {
+		return "", false
+	}
+	v, err := scope.EvalExpression(expr, proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1})
+	if err != nil || v.Unreadable != nil {
+		return "", false
+	}
+	return api.ConvertVar(v).SinglelineString(), true
+}
+
+// resetExprWatches forgets the previous values of the watches, the target
+// was replaced.
+func (d *Debugger) resetExprWatches() {
+	for _, w := range d.exprWatches {
+		w.value, w.evaluated = "", false
+	}
+}
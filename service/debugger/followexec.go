@@ -0,0 +1,470 @@
+package debugger
+
+import (
+	"bufio"
+	"debug/elf"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// childStartTimeout is how long the debugger waits for the headless
+// instance of Delve debugging a child process to start listening.
+const childStartTimeout = 30 * time.Second
+
+// childTarget is a child process of the target, debugged by a headless
+// instance of Delve started by the debugger, see Config.FollowExec.
+type childTarget struct {
+	pid  int
+	path string
+
+	// opMutex serializes the changes of the breakpoints of the child.
+	opMutex sync.Mutex
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	addr   string
+	client *rpc.Client
+	// bps are the IDs of the breakpoints of the child by ID of the
+	// breakpoint of the target they were created for.
+	bps        map[int]int
+	exited     bool
+	exitStatus int
+	err        error // why the child is not debugged
+}
+
+// The arguments and results of the methods of the JSON-RPC API called on
+// the headless instances of Delve debugging the children, the same as the
+// ones defined by service/rpc2, which imports this package.
+type (
+	childStateIn struct {
+		NonBlocking bool
+	}
+	childStateOut struct {
+		State *api.DebuggerState
+	}
+	childCommandOut struct {
+		State api.DebuggerState
+	}
+	childBreakpointIn struct {
+		Breakpoint api.Breakpoint
+	}
+	childBreakpointOut struct {
+		Breakpoint api.Breakpoint
+	}
+	childClearBreakpointIn struct {
+		Id   int
+		Name string
+	}
+	childDetachIn struct {
+		Kill bool
+	}
+)
+
+// followExec starts following the children of p, if Config.FollowExec is
+// set.
+func (d *Debugger) followExec(p *proc.Target) {
+	if !d.config.FollowExec {
+		return
+	}
+	if err := p.FollowExec(d.newChildTarget); err != nil {
+		d.log.Warnf("could not follow the child processes of the target: %v", err)
+	}
+}
+
+// newChildTarget is called by the target when its child pid calls execve,
+// while the target is being continued and the child is stopped.
+// Children that run Go executables are debugged by a new headless
+// instance of Delve, started in the background, with the breakpoints of
+// the target, the others are resumed.
+func (d *Debugger) newChildTarget(pid int, path string) {
+	if !isGoExecutable(path) {
+		if err := resumeProcess(pid); err != nil {
+			d.log.Errorf("could not resume child process %d: %v", pid, err)
+		}
+		return
+	}
+	d.log.Infof("following child process %d (%s)", pid, path)
+	c := &childTarget{pid: pid, path: path, bps: make(map[int]int)}
+	// the target is not running, newChildTarget is called by Continue.
+	bps := d.followedBreakpoints()
+	d.childrenMutex.Lock()
+	d.children = append(d.children, c)
+	d.childrenMutex.Unlock()
+	go func() {
+		if err := d.startChild(c, bps); err != nil {
+			d.log.Errorf("could not debug child process %d: %v", pid, err)
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			c.shutdown(false)
+			resumeProcess(pid)
+		}
+	}()
+}
+
+// isGoExecutable returns true if path is an executable built by Go.
+func isGoExecutable(path string) bool {
+	f, err := elf.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return f.Section(".gopclntab") != nil || f.Section(".go.buildinfo") != nil
+}
+
+// followedBreakpoints returns the breakpoints of the target created in its
+// children: the ones on lines and functions, which are found again in the
+// executables of the children, excluding the ones created by the debugger
+// itself.
+func (d *Debugger) followedBreakpoints() []*api.Breakpoint {
+	var r []*api.Breakpoint
+	for _, bp := range api.ConvertBreakpoints(d.breakpoints()) {
+		if bp.ID < 0 || bp.ID == d.subtestBreakpoint || d.isExprWatchBreakpoint(bp.Name) {
+			continue
+		}
+		if cbp := followedBreakpoint(bp); cbp != nil {
+			r = append(r, cbp)
+		}
+	}
+	return r
+}
+
+// followedBreakpoint returns the breakpoint created in the children for
+// bp, or nil if it is not created in the children.
+func followedBreakpoint(bp *api.Breakpoint) *api.Breakpoint {
+	if bp.TraceReturn || (bp.File == "" && !bp.ErrorReturn) {
+		// the addresses of the target are meaningless for the children
+		return nil
+	}
+	cbp := *bp
+	cbp.Addr = 0
+	cbp.Addrs = nil
+	cbp.TotalHitCount = 0
+	cbp.HitCount = nil
+	cbp.Stats = nil
+	if !bp.ErrorReturn {
+		cbp.FunctionName = ""
+	}
+	return &cbp
+}
+
+// startChild starts the headless instance of Delve debugging c, which is
+// stopped, creates the breakpoints bps and continues it.
+func (d *Debugger) startChild(c *childTarget, bps []*api.Breakpoint) error {
+	dlv, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := []string{"attach", strconv.Itoa(c.pid), c.path, "--headless", "--accept-multiclient", "--api-version=2", "--listen=127.0.0.1:0", "--follow-exec", "--check-go-version=" + strconv.FormatBool(d.config.CheckGoVersion)}
+	cmd := exec.Command(dlv, args...)
+	cmd.Stderr = os.Stderr
+	// the interrupts of the terminal are meant for the debugger
+	cmd.SysProcAttr = childSysProcAttr()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cmd = cmd
+	c.mu.Unlock()
+
+	addrch := make(chan string, 1)
+	go func() {
+		const prefix = "API server listening at: "
+		scan := bufio.NewScanner(stdout)
+		for scan.Scan() {
+			if line := scan.Text(); strings.HasPrefix(line, prefix) {
+				addrch <- strings.TrimSpace(line[len(prefix):])
+				break
+			}
+		}
+		close(addrch)
+		io.Copy(ioutil.Discard, stdout)
+	}()
+	var addr string
+	select {
+	case a, ok := <-addrch:
+		if !ok {
+			return errors.New("delve exited before listening")
+		}
+		addr = a
+	case <-time.After(childStartTimeout):
+		return errors.New("timed out waiting for delve to listen")
+	}
+
+	client, err := jsonrpc.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.addr = addr
+	c.client = client
+	c.mu.Unlock()
+	if err := c.call("SetApiVersion", api.SetAPIVersionIn{APIVersion: 2}, &api.SetAPIVersionOut{}); err != nil {
+		return err
+	}
+	c.opMutex.Lock()
+	for _, bp := range bps {
+		c.createBreakpoint(bp)
+	}
+	c.opMutex.Unlock()
+	go c.resume()
+	return nil
+}
+
+func (c *childTarget) call(method string, args, reply interface{}) error {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return errors.New("not connected")
+	}
+	return client.Call("RPCServer."+method, args, reply)
+}
+
+// createBreakpoint creates bp, a breakpoint of the target, in the child.
+// Errors are ignored, the executable of the child may not contain the
+// location of bp.
+func (c *childTarget) createBreakpoint(bp *api.Breakpoint) {
+	id := bp.ID
+	cbp := *bp
+	cbp.ID = 0
+	var out childBreakpointOut
+	if err := c.call("CreateBreakpoint", childBreakpointIn{cbp}, &out); err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.bps[id] = out.Breakpoint.ID
+	c.mu.Unlock()
+}
+
+// resume continues the child until it stops at a breakpoint that is not
+// a tracepoint, or exits.
+func (c *childTarget) resume() {
+	for {
+		var out childCommandOut
+		if err := c.call("Command", api.DebuggerCommand{Name: api.Continue}, &out); err != nil {
+			return
+		}
+		if out.State.Exited {
+			c.setExited(out.State.ExitStatus)
+			return
+		}
+		if !atTracepoints(&out.State) {
+			return
+		}
+	}
+}
+
+// atTracepoints returns true if all the threads stopped at a breakpoint
+// are stopped at tracepoints.
+func atTracepoints(state *api.DebuggerState) bool {
+	found := false
+	for _, th := range state.Threads {
+		if th.Breakpoint == nil {
+			continue
+		}
+		if !th.Breakpoint.Tracepoint && !th.Breakpoint.TraceReturn {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// setExited records that the child exited and stops its instance of Delve.
+func (c *childTarget) setExited(status int) {
+	c.mu.Lock()
+	c.exited, c.exitStatus = true, status
+	c.mu.Unlock()
+	c.shutdown(false)
+}
+
+// shutdown stops the instance of Delve debugging the child, detaching it
+// from the child, which is killed if kill is set.
+func (c *childTarget) shutdown(kill bool) {
+	c.mu.Lock()
+	client, cmd := c.client, c.cmd
+	c.client, c.cmd = nil, nil
+	c.mu.Unlock()
+	if client != nil {
+		client.Call("RPCServer.Detach", childDetachIn{Kill: kill}, &struct{}{})
+		client.Close()
+	}
+	if cmd != nil {
+		done := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(childStartTimeout):
+			cmd.Process.Kill()
+			<-done
+		}
+	}
+}
+
+// changeBreakpoints calls fn after halting the child, if it is running,
+// and resumes it afterwards.
+func (c *childTarget) changeBreakpoints(fn func()) {
+	c.opMutex.Lock()
+	defer c.opMutex.Unlock()
+	var state childStateOut
+	if err := c.call("State", childStateIn{NonBlocking: true}, &state); err != nil || state.State == nil || state.State.Exited {
+		return
+	}
+	running := state.State.Running
+	if running {
+		var out childCommandOut
+		if err := c.call("Command", api.DebuggerCommand{Name: api.Halt}, &out); err != nil || out.State.Exited {
+			return
+		}
+	}
+	fn()
+	if running {
+		go c.resume()
+	}
+}
+
+// forwardBreakpoint creates bp, a breakpoint just created in the target,
+// in the children of the target.
+func (d *Debugger) forwardBreakpoint(bp *api.Breakpoint) {
+	if d.isExprWatchBreakpoint(bp.Name) {
+		return
+	}
+	cbp := followedBreakpoint(bp)
+	if cbp == nil {
+		return
+	}
+	for _, c := range d.liveChildren() {
+		c := c
+		go c.changeBreakpoints(func() { c.createBreakpoint(cbp) })
+	}
+}
+
+// forwardClearBreakpoint clears the breakpoints created for the breakpoint
+// id of the target, just cleared, in the children of the target.
+func (d *Debugger) forwardClearBreakpoint(id int) {
+	for _, c := range d.liveChildren() {
+		c.mu.Lock()
+		cid, ok := c.bps[id]
+		delete(c.bps, id)
+		c.mu.Unlock()
+		if !ok {
+			continue
+		}
+		c := c
+		go c.changeBreakpoints(func() {
+			c.call("ClearBreakpoint", childClearBreakpointIn{Id: cid}, &childBreakpointOut{})
+		})
+	}
+}
+
+// liveChildren returns the children that did not exit.
+func (d *Debugger) liveChildren() []*childTarget {
+	d.childrenMutex.Lock()
+	defer d.childrenMutex.Unlock()
+	var r []*childTarget
+	for _, c := range d.children {
+		c.mu.Lock()
+		if !c.exited && c.err == nil {
+			r = append(r, c)
+		}
+		c.mu.Unlock()
+	}
+	return r
+}
+
+// detachChildren stops debugging the children, they are killed if kill is
+// set.
+func (d *Debugger) detachChildren(kill bool) {
+	d.childrenMutex.Lock()
+	children := d.children
+	d.children = nil
+	d.childrenMutex.Unlock()
+	for _, c := range children {
+		c.shutdown(kill)
+	}
+}
+
+// Targets returns the target of the debugger followed by its children
+// debugged by other instances of Delve, see Config.FollowExec. Only the
+// state of the target is returned while it is running.
+func (d *Debugger) Targets() []api.Target {
+	d.childrenMutex.Lock()
+	children := append([]*childTarget(nil), d.children...)
+	d.childrenMutex.Unlock()
+
+	r := make([]api.Target, 0, len(children)+1)
+	// the children are listed while the target is running, for example
+	// waiting for a child stopped at a breakpoint.
+	t := api.Target{Running: true}
+	if !d.isRunning() {
+		d.targetMutex.Lock()
+		t = api.Target{Pid: d.target.Pid(), Path: d.target.BinInfo().Images[0].Path}
+		if _, err := d.target.Valid(); err != nil {
+			if _, exited := err.(*proc.ErrProcessExited); exited {
+				t.Exited = true
+			} else {
+				t.Err = err.Error()
+			}
+		}
+		d.targetMutex.Unlock()
+	}
+	r = append(r, t)
+
+	for _, c := range children {
+		var state childStateOut
+		err := c.call("State", childStateIn{NonBlocking: true}, &state)
+		if err == nil && state.State != nil && state.State.Exited {
+			c.setExited(state.State.ExitStatus)
+		}
+		c.mu.Lock()
+		t := api.Target{Pid: c.pid, Path: c.path, Addr: c.addr, Exited: c.exited, ExitStatus: c.exitStatus}
+		switch {
+		case c.err != nil:
+			t.Err = c.err.Error()
+		case c.exited:
+		case c.client == nil:
+			t.Err = "starting"
+		case err != nil:
+			t.Err = err.Error()
+		case state.State != nil:
+			t.Running = state.State.Running
+		}
+		c.mu.Unlock()
+		r = append(r, t)
+	}
+	return r
+}
+
+// isExprWatchBreakpoint returns true if name is the name of the
+// breakpoints of an expression watched.
+func (d *Debugger) isExprWatchBreakpoint(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, w := range d.exprWatches {
+		if name == w.bpName() {
+			return true
+		}
+	}
+	return false
+}
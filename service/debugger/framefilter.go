@@ -0,0 +1,96 @@
+package debugger
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// frameFilters hide the frames of the packages or files matching one of
+// their patterns from stacktraces, see Config.FrameFilters.
+type frameFilters struct {
+	packages []*regexp.Regexp
+	files    []string
+}
+
+// newFrameFilters parses patterns: patterns containing '*', '?' or '['
+// are file patterns, matched with filepath.Match against the base name
+// and the full path of the file of a frame, the others are package
+// patterns, import paths where "..." matches any string, like the package
+// patterns of the go command.
+func newFrameFilters(patterns []string) (*frameFilters, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	ff := &frameFilters{}
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid frame filter %q: %v", pattern, err)
+			}
+			ff.files = append(ff.files, pattern)
+			continue
+		}
+		re := "^" + strings.Replace(regexp.QuoteMeta(pattern), `\.\.\.`, `.*`, -1) + "$"
+		ff.packages = append(ff.packages, regexp.MustCompile(re))
+	}
+	return ff, nil
+}
+
+// hide returns true if frame matches one of the filters.
+func (ff *frameFilters) hide(frame *proc.Stackframe) bool {
+	if ff == nil || frame.Err != nil || frame.Call.Fn == nil {
+		return false
+	}
+	if pkg := frame.Call.Fn.PackageName(); pkg != "" {
+		for _, re := range ff.packages {
+			if re.MatchString(pkg) {
+				return true
+			}
+		}
+	}
+	file := filepath.ToSlash(frame.Call.File)
+	for _, pattern := range ff.files {
+		if ok, _ := filepath.Match(pattern, filepath.Base(file)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filter removes the frames hidden by ff from frames, the topmost and the
+// bottom frames are never hidden. It also returns, for each frame left, the
+// number of frames removed immediately before it.
+func (ff *frameFilters) filter(frames []proc.Stackframe) ([]proc.Stackframe, []int) {
+	if ff == nil || len(frames) == 0 {
+		return frames, nil
+	}
+	r := frames[:1:1]
+	hidden := []int{0}
+	n := 0
+	for i := 1; i < len(frames); i++ {
+		if !frames[i].Bottom && ff.hide(&frames[i]) {
+			n++
+			continue
+		}
+		r = append(r, frames[i])
+		hidden = append(hidden, n)
+		n = 0
+	}
+	return r, hidden
+}
+
+// setHidden sets the Hidden field of the converted frames returned by
+// filter.
+func setHidden(frames []api.Stackframe, hidden []int) {
+	for i := range hidden {
+		frames[i].Hidden = hidden[i]
+	}
+}
@@ -0,0 +1,49 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+func TestFrameFilters(t *testing.T) {
+	ff, err := newFrameFilters([]string{".../vendor/...", "*.pb.go", "github.com/a/b", "*.s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := func(fn, file string) proc.Stackframe {
+		return proc.Stackframe{Call: proc.Location{File: file, Fn: &proc.Function{Name: fn}}}
+	}
+	frames := []proc.Stackframe{
+		frame("example.com/m/vendor/github.com/x/y.F", "/src/m/vendor/github.com/x/y/y.go"),
+		frame("example.com/m/gen.(*Msg).Reset", "/src/m/gen/msg.pb.go"),
+		frame("github.com/a/b.G", "/src/b/b.go"),
+		frame("example.com/m.main", "/src/m/main.go"),
+		frame("github.com/a/b/c.H", "/src/b/c/c.go"),
+		frame("example.com/m/vendor/github.com/x/y.F", "/src/m/vendor/github.com/x/y/y.go"),
+		frame("runtime.main", "/go/src/runtime/proc.go"),
+		frame("runtime.goexit", "/go/src/runtime/asm_amd64.s"),
+	}
+	frames[len(frames)-1].Bottom = true
+	out, hidden := ff.filter(frames)
+	var names []string
+	for i := range out {
+		names = append(names, out[i].Call.Fn.Name)
+	}
+	expected := []string{"example.com/m/vendor/github.com/x/y.F", "example.com/m.main", "github.com/a/b/c.H", "runtime.main", "runtime.goexit"}
+	if len(names) != len(expected) || len(hidden) != len(expected) {
+		t.Fatalf("wrong frames %v %v", names, hidden)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("wrong frames %v", names)
+		}
+	}
+	if hidden[0] != 0 || hidden[1] != 2 || hidden[2] != 0 || hidden[3] != 1 || hidden[4] != 0 {
+		t.Fatalf("wrong hidden frames %v", hidden)
+	}
+
+	if _, err := newFrameFilters([]string{"[a-"}); err == nil {
+		t.Fatal("invalid pattern accepted")
+	}
+}
@@ -0,0 +1,58 @@
+package debugger
+
+import (
+	"go/constant"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// The names of the runtime variables describing the state of the garbage
+// collector changed between versions of Go, for each field of
+// api.GCState the expressions are tried in order until one succeeds.
+var (
+	gcCyclesExprs   = []string{"runtime.memstats.numgc"}
+	gcHeapLiveExprs = []string{"runtime.gcController.heapLive.value", "runtime.gcController.heapLive", "runtime.memstats.heap_live"}
+	gcHeapGoalExprs = []string{"runtime.gcController.heapGoal", "runtime.memstats.next_gc"}
+)
+
+// gcPhases lists the values of runtime.gcphase.
+var gcPhases = []string{"off", "mark", "marktermination"}
+
+// gcState reads the state of the garbage collector of the target, returns
+// nil if the state could not be read.
+func (d *Debugger) gcState() *api.GCState {
+	scope, err := proc.ThreadScope(d.target.CurrentThread())
+	if err != nil {
+		return nil
+	}
+	phase, err := scope.EvalVariable("runtime.gcphase", proc.LoadConfig{})
+	if err != nil || phase.Unreadable != nil || phase.Value == nil {
+		return nil
+	}
+	gc := &api.GCState{Phase: "unknown"}
+	if n, ok := constant.Uint64Val(phase.Value); ok && n < uint64(len(gcPhases)) {
+		gc.Phase = gcPhases[n]
+	}
+	gc.Cycles, _ = evalUint(scope, gcCyclesExprs)
+	gc.HeapLive, _ = evalUint(scope, gcHeapLiveExprs)
+	gc.HeapGoal, _ = evalUint(scope, gcHeapGoalExprs)
+	return gc
+}
+
+// evalUint evaluates each expression in exprs until one returns an
+// integer value.
+func evalUint(scope *proc.EvalScope, exprs []string) (uint64, bool) {
+	for _, expr := range exprs {
+		v, err := scope.EvalVariable(expr, proc.LoadConfig{})
+		if err != nil || v.Unreadable != nil || v.Value == nil || v.Value.Kind() != constant.Int {
+			continue
+		}
+		if n, ok := constant.Uint64Val(v.Value); ok {
+			return n, true
+		}
+		n, _ := constant.Int64Val(v.Value)
+		return uint64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,155 @@
+package debugger
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/go-delve/delve/pkg/logflags"
+	"github.com/go-delve/delve/pkg/version"
+	"github.com/go-delve/delve/service/api"
+)
+
+// requestLogSize is the number of requests retained by the debugger for
+// the reports of internal errors.
+const requestLogSize = 20
+
+// maxRequestLen is the maximum length of the requests retained.
+const maxRequestLen = 256
+
+// internalErrorReportTimeout is how long ReportInternalError waits for the
+// description of the target, which can not be obtained if the target is
+// locked by the operation that failed.
+const internalErrorReportTimeout = 2 * time.Second
+
+// requestLog is a ring buffer holding the last requests, see
+// RecordRequest.
+type requestLog struct {
+	mu    sync.Mutex
+	buf   []string
+	start int
+}
+
+func (rl *requestLog) add(s string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if len(rl.buf) < requestLogSize {
+		rl.buf = append(rl.buf, s)
+		return
+	}
+	rl.buf[rl.start] = s
+	rl.start = (rl.start + 1) % len(rl.buf)
+}
+
+// get returns the requests, oldest first.
+func (rl *requestLog) get() []string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	r := make([]string, 0, len(rl.buf))
+	r = append(r, rl.buf[rl.start:]...)
+	return append(r, rl.buf[:rl.start]...)
+}
+
+// RecordRequest records a request of a client, the last requests are
+// included in the reports of internal errors.
+func (d *Debugger) RecordRequest(req string) {
+	if len(req) > maxRequestLen {
+		req = req[:maxRequestLen] + "..."
+	}
+	d.requests.add(time.Now().Format("15:04:05.000") + " " + req)
+}
+
+// ReportInternalError writes a report of an internal error of the
+// debugger, a panic or an inconsistency found by proc (see
+// proc.ErrInternal), to a new file and returns its path. The report
+// contains reason and stack, the stack of the debugger, along with the
+// status of the target and the last requests, so that it can be attached
+// to a bug report.
+func (d *Debugger) ReportInternalError(reason, stack string) (string, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Delve internal error report\n\n")
+	fmt.Fprintf(&buf, "Time: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&buf, "Delve version: %s\n", version.DelveVersion)
+	fmt.Fprintf(&buf, "Built with: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&buf, "Backend: %s\n", d.config.Backend)
+	fmt.Fprintf(&buf, "Reason: %s\n", reason)
+	if stack != "" {
+		fmt.Fprintf(&buf, "\nStack:\n%s\n", stack)
+	}
+
+	fmt.Fprintf(&buf, "\nTarget:\n")
+	done := make(chan []byte, 1)
+	go func() {
+		done <- d.describeTarget()
+	}()
+	select {
+	case desc := <-done:
+		buf.Write(desc)
+	case <-time.After(internalErrorReportTimeout):
+		fmt.Fprintf(&buf, "unavailable, the target is locked\n")
+	}
+
+	fmt.Fprintf(&buf, "\nLast requests:\n")
+	for _, req := range d.requests.get() {
+		fmt.Fprintf(&buf, "%s\n", req)
+	}
+
+	fmt.Fprintf(&buf, "\nLast log entries:\n")
+	for _, entry := range logflags.Buffered() {
+		fmt.Fprintf(&buf, "%s\n", entry)
+	}
+
+	f, err := ioutil.TempFile("", "dlv-internal-error-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// describeTarget returns the description of the target for
+// ReportInternalError.
+func (d *Debugger) describeTarget() (desc []byte) {
+	var buf bytes.Buffer
+	defer func() {
+		if ierr := recover(); ierr != nil {
+			fmt.Fprintf(&buf, "panic while describing the target: %v\n", ierr)
+		}
+		desc = buf.Bytes()
+	}()
+	if d.isRunning() {
+		fmt.Fprintf(&buf, "Status: running\n")
+	}
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+	if d.target == nil {
+		fmt.Fprintf(&buf, "none\n")
+		return
+	}
+	bi := d.target.BinInfo()
+	for _, image := range bi.Images {
+		fmt.Fprintf(&buf, "Image: %s build ID %q\n", image.Path, image.BuildID)
+	}
+	fmt.Fprintf(&buf, "Producer: %s\n", bi.Producer())
+	fmt.Fprintf(&buf, "Architecture: %s\n", bi.Arch.Name)
+	fmt.Fprintf(&buf, "Pid: %d\n", d.target.Pid())
+	if _, err := d.target.Valid(); err != nil {
+		fmt.Fprintf(&buf, "Status: %v\n", err)
+		return
+	}
+	for _, thread := range d.target.ThreadList() {
+		th := api.ConvertThread(thread)
+		fn := "?"
+		if th.Function != nil {
+			fn = th.Function.Name()
+		}
+		fmt.Fprintf(&buf, "Thread %d at %#x %s %s:%d\n", th.ID, th.PC, fn, th.File, th.Line)
+	}
+	return
+}
@@ -0,0 +1,37 @@
+package debugger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReportInternalError(t *testing.T) {
+	d := &Debugger{config: &Config{Backend: "native"}}
+	for i := 0; i < requestLogSize+5; i++ {
+		d.RecordRequest(fmt.Sprintf("RPCServer.State{%d}", i))
+	}
+	d.RecordRequest(strings.Repeat("x", 2*maxRequestLen))
+	requests := d.requests.get()
+	if len(requests) != requestLogSize || !strings.HasSuffix(requests[0], "RPCServer.State{6}") || len(requests[len(requests)-1]) > maxRequestLen+20 {
+		t.Fatalf("wrong requests %q", requests)
+	}
+
+	path, err := d.ReportInternalError("runtime error: index out of range", "goroutine 1 [running]:\nmain.main()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(buf)
+	for _, s := range []string{"Reason: runtime error: index out of range", "main.main()", "Backend: native", "RPCServer.State{24}"} {
+		if !strings.Contains(report, s) {
+			t.Errorf("%q missing from the report:\n%s", s, report)
+		}
+	}
+}
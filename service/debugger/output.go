@@ -0,0 +1,210 @@
+package debugger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// outputBufferSize is the maximum number of bytes of output retained by
+// the debugger, when the buffer is full the oldest chunks are discarded.
+const outputBufferSize = 1 << 20
+
+// outputBuffer holds the output of the target streamed to clients, see
+// Config.StreamOutput and Config.PTY. Like sampleBuffer it is protected
+// by its own mutex so that clients can read it while the target is
+// running.
+type outputBuffer struct {
+	mu     sync.Mutex
+	chunks []api.OutputChunk
+	size   int
+	seq    uint64
+	closed bool
+	// changed is closed and replaced when a chunk is added or the buffer
+	// is closed, waking up the clients waiting for output.
+	changed chan struct{}
+}
+
+func (ob *outputBuffer) add(stream string, data []byte) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.closed {
+		return
+	}
+	ob.seq++
+	ob.chunks = append(ob.chunks, api.OutputChunk{Seq: ob.seq, Stream: stream, Data: append([]byte(nil), data...)})
+	ob.size += len(data)
+	for ob.size > outputBufferSize && len(ob.chunks) > 1 {
+		ob.size -= len(ob.chunks[0].Data)
+		ob.chunks = ob.chunks[1:]
+	}
+	ob.notify()
+}
+
+func (ob *outputBuffer) close() {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.closed = true
+	ob.notify()
+}
+
+func (ob *outputBuffer) notify() {
+	if ob.changed != nil {
+		close(ob.changed)
+		ob.changed = nil
+	}
+}
+
+// get returns the chunks with a sequence number greater than since. If
+// there are none and the buffer is not closed it also returns a channel
+// closed when that changes.
+func (ob *outputBuffer) get(since uint64) (chunks []api.OutputChunk, closed bool, changed <-chan struct{}) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	for i := range ob.chunks {
+		if ob.chunks[i].Seq > since {
+			chunks = append(chunks, ob.chunks[i:]...)
+			break
+		}
+	}
+	if len(chunks) > 0 || ob.closed {
+		return chunks, ob.closed, nil
+	}
+	if ob.changed == nil {
+		ob.changed = make(chan struct{})
+	}
+	return nil, false, ob.changed
+}
+
+// Output returns the output of the target with a sequence number greater
+// than since, oldest first. If there is none and cancel is not nil it
+// waits until the target writes something or cancel is closed. Closed is
+// true when the target will not produce more output, because the output
+// is not streamed or the debugger detached from the target.
+// Can be called while the target is running.
+func (d *Debugger) Output(since uint64, cancel <-chan struct{}) (chunks []api.OutputChunk, closed bool) {
+	if d.stdio == nil {
+		return nil, true
+	}
+	for {
+		chunks, closed, changed := d.stdio.output.get(since)
+		if changed == nil || cancel == nil {
+			return chunks, closed
+		}
+		select {
+		case <-changed:
+		case <-cancel:
+			return nil, false
+		}
+	}
+}
+
+// stdio are the pseudo-terminal and the pipes used to stream the output
+// of the target to clients. They outlive the target, so that restarted
+// targets can use them.
+type stdio struct {
+	dir string
+	// pty and tty are the master and the slave of the pseudo-terminal,
+	// tty is kept open so that the pseudo-terminal survives restarts.
+	pty, tty *os.File
+	// pipes are the read sides of the named pipes used as standard output
+	// and error, opened for reading and writing so that the target can
+	// open them without blocking and they are not closed when it exits.
+	pipes [3]*os.File
+	// paths are the paths of the named pipes, in the same order as
+	// Config.Redirects.
+	paths [3]string
+
+	output outputBuffer
+}
+
+// streamNames are the names of the streams of the pipes.
+var streamNames = [3]string{"stdin", api.OutputStreamStdout, api.OutputStreamStderr}
+
+// newStdio allocates the pseudo-terminal or creates the pipes specified by
+// config.
+func newStdio(config *Config) (*stdio, error) {
+	s := &stdio{}
+	if config.PTY {
+		var err error
+		if s.pty, s.tty, err = openPTY(); err != nil {
+			return nil, err
+		}
+		go s.copy(api.OutputStreamTTY, s.pty)
+		return s, nil
+	}
+	dir, err := ioutil.TempDir("", "dlv-output")
+	if err != nil {
+		return nil, err
+	}
+	s.dir = dir
+	for i := 1; i < len(s.pipes); i++ {
+		if config.Redirects[i] != "" {
+			continue
+		}
+		path := filepath.Join(dir, streamNames[i])
+		if err := mkfifo(path); err != nil {
+			s.close()
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.pipes[i], s.paths[i] = f, path
+		go s.copy(streamNames[i], f)
+	}
+	return s, nil
+}
+
+func (s *stdio) copy(stream string, f *os.File) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			s.output.add(stream, buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *stdio) close() {
+	for _, f := range []*os.File{s.pty, s.tty, s.pipes[1], s.pipes[2]} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+	s.output.close()
+}
+
+// tty returns the terminal of launched processes.
+func (d *Debugger) tty() string {
+	if d.stdio != nil && d.stdio.tty != nil {
+		return d.stdio.tty.Name()
+	}
+	return d.config.TTY
+}
+
+// redirects returns the redirects of launched processes, the streams
+// that are not redirected to files are redirected to the pipes of stdio.
+func (d *Debugger) redirects() [3]string {
+	r := d.config.Redirects
+	if d.stdio == nil {
+		return r
+	}
+	for i := range r {
+		if r[i] == "" {
+			r[i] = d.stdio.paths[i]
+		}
+	}
+	return r
+}
@@ -0,0 +1,77 @@
+package debugger
+
+import (
+	"bytes"
+	"io/ioutil"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func TestOutputBuffer(t *testing.T) {
+	var ob outputBuffer
+	chunk := make([]byte, outputBufferSize/4)
+	for i := 0; i < 6; i++ {
+		ob.add(api.OutputStreamStdout, chunk)
+	}
+	chunks, closed, changed := ob.get(0)
+	if len(chunks) != 4 || closed || changed != nil {
+		t.Fatalf("wrong result %d %v %v", len(chunks), closed, changed)
+	}
+	if chunks[0].Seq != 3 || chunks[3].Seq != 6 {
+		t.Fatalf("wrong chunks retained %d..%d", chunks[0].Seq, chunks[3].Seq)
+	}
+	chunks, _, _ = ob.get(5)
+	if len(chunks) != 1 || chunks[0].Seq != 6 {
+		t.Fatalf("wrong chunks after 5: %v", chunks)
+	}
+
+	chunks, closed, changed = ob.get(6)
+	if len(chunks) != 0 || closed || changed == nil {
+		t.Fatalf("wrong result %d %v %v", len(chunks), closed, changed)
+	}
+	ob.add(api.OutputStreamStderr, []byte("x"))
+	select {
+	case <-changed:
+	default:
+		t.Fatal("waiting clients not woken up")
+	}
+	ob.close()
+	ob.add(api.OutputStreamStderr, []byte("y"))
+	chunks, closed, changed = ob.get(6)
+	if len(chunks) != 1 || !closed || changed != nil {
+		t.Fatalf("wrong result after close %d %v %v", len(chunks), closed, changed)
+	}
+}
+
+func TestStreamOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("output streaming not supported")
+	}
+	config := &Config{StreamOutput: true, Redirects: [3]string{"", "", "/dev/null"}}
+	s, err := newStdio(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Debugger{config: config, stdio: s}
+	redirects := d.redirects()
+	if redirects[0] != "" || redirects[1] == "" || redirects[2] != "/dev/null" {
+		t.Fatalf("wrong redirects %q", redirects)
+	}
+	// The target opens the pipe like a regular file.
+	if err := ioutil.WriteFile(redirects[1], []byte("hello\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	cancel := make(chan struct{})
+	time.AfterFunc(10*time.Second, func() { close(cancel) })
+	chunks, closed := d.Output(0, cancel)
+	if len(chunks) != 1 || closed || chunks[0].Stream != api.OutputStreamStdout || !bytes.Equal(chunks[0].Data, []byte("hello\n")) {
+		t.Fatalf("wrong output %v %v", chunks, closed)
+	}
+	d.closeStdio()
+	if _, closed := d.Output(chunks[0].Seq, cancel); !closed {
+		t.Fatal("output not closed")
+	}
+}
@@ -0,0 +1,18 @@
+// +build !windows
+
+package debugger
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+func openPTY() (ptm, pts *os.File, err error) {
+	return pty.Open()
+}
+
+func mkfifo(path string) error {
+	return syscall.Mkfifo(path, 0600)
+}
@@ -0,0 +1,14 @@
+package debugger
+
+import (
+	"errors"
+	"os"
+)
+
+func openPTY() (ptm, pts *os.File, err error) {
+	return nil, nil, errors.New("allocating a pseudo-terminal for the target is not supported on windows")
+}
+
+func mkfifo(path string) error {
+	return errors.New("streaming the output of the target is not supported on windows")
+}
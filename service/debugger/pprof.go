@@ -0,0 +1,202 @@
+package debugger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"time"
+)
+
+// This file contains a minimal encoder for the pprof profile format, see
+// https://github.com/google/pprof/blob/master/proto/profile.proto
+
+// profileFrame is a single frame of the stack of a profile sample.
+type profileFrame struct {
+	PC   uint64
+	Fn   string
+	File string
+	Line int
+}
+
+// profileSample is a stack along with the values measured for it, len(values)
+// must match the number of sample types of the profile.
+type profileSample struct {
+	stack  []profileFrame
+	values []int64
+}
+
+// profileBuilder accumulates the samples of a profile and encodes it.
+type profileBuilder struct {
+	sampleTypes [][2]string // type and unit of each value
+	periodType  [2]string
+	period      int64
+	start       time.Time
+	duration    time.Duration
+
+	samples []profileSample
+}
+
+// pbuf encodes protocol buffer messages.
+type pbuf struct {
+	bytes.Buffer
+}
+
+func (b *pbuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	b.WriteByte(byte(x))
+}
+
+func (b *pbuf) uint64(field int, x uint64) {
+	b.varint(uint64(field)<<3 | 0)
+	b.varint(x)
+}
+
+func (b *pbuf) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *pbuf) bytes(field int, x []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(x)))
+	b.Write(x)
+}
+
+func (b *pbuf) string(field int, x string) {
+	b.bytes(field, []byte(x))
+}
+
+func (b *pbuf) packedUint64s(field int, xs []uint64) {
+	var p pbuf
+	for _, x := range xs {
+		p.varint(x)
+	}
+	b.bytes(field, p.Bytes())
+}
+
+const (
+	tagProfileSampleType    = 1
+	tagProfileSample        = 2
+	tagProfileLocation      = 4
+	tagProfileFunction      = 5
+	tagProfileStringTable   = 6
+	tagProfileTimeNanos     = 9
+	tagProfileDurationNanos = 10
+	tagProfilePeriodType    = 11
+	tagProfilePeriod        = 12
+
+	tagValueTypeType = 1
+	tagValueTypeUnit = 2
+
+	tagSampleLocation = 1
+	tagSampleValue    = 2
+
+	tagLocationID      = 1
+	tagLocationAddress = 3
+	tagLocationLine    = 4
+
+	tagLineFunctionID = 1
+	tagLineLine       = 2
+
+	tagFunctionID         = 1
+	tagFunctionName       = 2
+	tagFunctionSystemName = 3
+	tagFunctionFilename   = 4
+)
+
+func (pb *profileBuilder) add(stack []profileFrame, values ...int64) {
+	pb.samples = append(pb.samples, profileSample{stack: stack, values: values})
+}
+
+// encode returns the gzip compressed profile.
+func (pb *profileBuilder) encode() []byte {
+	var b pbuf
+
+	strs := []string{""}
+	stridx := map[string]int64{"": 0}
+	str := func(s string) int64 {
+		if idx, ok := stridx[s]; ok {
+			return idx
+		}
+		stridx[s] = int64(len(strs))
+		strs = append(strs, s)
+		return stridx[s]
+	}
+
+	valueType := func(field int, vt [2]string) {
+		var m pbuf
+		m.int64(tagValueTypeType, str(vt[0]))
+		m.int64(tagValueTypeUnit, str(vt[1]))
+		b.bytes(field, m.Bytes())
+	}
+
+	for _, st := range pb.sampleTypes {
+		valueType(tagProfileSampleType, st)
+	}
+
+	type fnkey struct{ name, file string }
+	fns := map[fnkey]uint64{}
+	locs := map[profileFrame]uint64{}
+	var fnbuf, locbuf pbuf
+
+	for _, sample := range pb.samples {
+		locids := make([]uint64, 0, len(sample.stack))
+		for _, frame := range sample.stack {
+			locid, ok := locs[frame]
+			if !ok {
+				k := fnkey{frame.Fn, frame.File}
+				fnid, ok := fns[k]
+				if !ok {
+					fnid = uint64(len(fns) + 1)
+					fns[k] = fnid
+					var m pbuf
+					m.uint64(tagFunctionID, fnid)
+					m.int64(tagFunctionName, str(frame.Fn))
+					m.int64(tagFunctionSystemName, str(frame.Fn))
+					m.int64(tagFunctionFilename, str(frame.File))
+					fnbuf.bytes(tagProfileFunction, m.Bytes())
+				}
+				locid = uint64(len(locs) + 1)
+				locs[frame] = locid
+				var line pbuf
+				line.uint64(tagLineFunctionID, fnid)
+				line.int64(tagLineLine, int64(frame.Line))
+				var m pbuf
+				m.uint64(tagLocationID, locid)
+				m.uint64(tagLocationAddress, frame.PC)
+				m.bytes(tagLocationLine, line.Bytes())
+				locbuf.bytes(tagProfileLocation, m.Bytes())
+			}
+			locids = append(locids, locid)
+		}
+		values := make([]uint64, len(sample.values))
+		for i := range sample.values {
+			values[i] = uint64(sample.values[i])
+		}
+		var m pbuf
+		m.packedUint64s(tagSampleLocation, locids)
+		m.packedUint64s(tagSampleValue, values)
+		b.bytes(tagProfileSample, m.Bytes())
+	}
+
+	b.Write(locbuf.Bytes())
+	b.Write(fnbuf.Bytes())
+
+	b.int64(tagProfileTimeNanos, pb.start.UnixNano())
+	b.int64(tagProfileDurationNanos, int64(pb.duration))
+	valueType(tagProfilePeriodType, pb.periodType)
+	b.int64(tagProfilePeriod, pb.period)
+
+	// the string table must be encoded last, after all strings have been
+	// interned.
+	for _, s := range strs {
+		b.string(tagProfileStringTable, s)
+	}
+
+	var out bytes.Buffer
+	zw := gzip.NewWriter(&out)
+	zw.Write(b.Bytes())
+	zw.Close()
+	return out.Bytes()
+}
@@ -0,0 +1,68 @@
+package debugger
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileBuilder(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that runs go tool pprof in short mode")
+	}
+	pb := &profileBuilder{
+		sampleTypes: [][2]string{{"samples", "count"}},
+		periodType:  [2]string{"cpu", "nanoseconds"},
+		period:      int64(10 * time.Millisecond),
+		start:       time.Now(),
+		duration:    time.Second,
+	}
+	pb.add([]profileFrame{{0x1010, "main.leaf", "/src/main.go", 10}, {0x1100, "main.main", "/src/main.go", 20}}, 3)
+	pb.add([]profileFrame{{0x1100, "main.main", "/src/main.go", 20}}, 1)
+
+	dir, err := ioutil.TempDir("", "pprof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cpu.pprof")
+	if err := ioutil.WriteFile(path, pb.encode(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command("go", "tool", "pprof", "-traces", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("could not read profile: %v\n%s", err, out)
+	}
+	t.Logf("%s", out)
+	for _, tgt := range []string{"main.leaf", "main.main", "Total samples = 4"} {
+		if !strings.Contains(string(out), tgt) {
+			t.Errorf("%q not found in profile", tgt)
+		}
+	}
+}
+
+func TestScaleHeapSample(t *testing.T) {
+	for _, tc := range []struct {
+		count, size, rate int64
+		wantCount         int64
+		wantSize          int64
+	}{
+		{0, 0, 512 * 1024, 0, 0},
+		{10, 1000, 1, 10, 1000},
+		{10, 1000, 0, 10, 1000},
+		// Allocations much larger than the rate are always recorded.
+		{1, 100 << 20, 512 * 1024, 1, 100 << 20},
+		// 1 / (1 - e^-1) = 1.582
+		{100, 100 * 512 * 1024, 512 * 1024, 158, 82941140},
+	} {
+		count, size := scaleHeapSample(tc.count, tc.size, tc.rate)
+		if count != tc.wantCount || size != tc.wantSize {
+			t.Errorf("scaleHeapSample(%d, %d, %d) = %d, %d, want %d, %d", tc.count, tc.size, tc.rate, count, size, tc.wantCount, tc.wantSize)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package debugger
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+const (
+	// profileCPUHz is the number of times per second the target is stopped
+	// to take a sample during CPU profiling.
+	profileCPUHz = 100
+	// maxProfileStackDepth is the maximum number of frames recorded for
+	// each sample.
+	maxProfileStackDepth = 64
+)
+
+// ProfileCPU resumes the target for the specified duration, stopping it
+// profileCPUHz times per second to record the stack of every thread
+// executing a goroutine. Returns a CPU profile in pprof format.
+// Profiling ends early if the target stops at a breakpoint, is halted or
+// exits.
+func (d *Debugger) ProfileCPU(duration time.Duration) ([]byte, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+
+	d.recordMutex.Lock()
+	d.haltRequested = false
+	d.recordMutex.Unlock()
+
+	d.setRunning(true)
+	defer d.setRunning(false)
+
+	period := time.Second / profileCPUHz
+	pb := &profileBuilder{
+		sampleTypes: [][2]string{{"samples", "count"}, {"cpu", "nanoseconds"}},
+		periodType:  [2]string{"cpu", "nanoseconds"},
+		period:      int64(period),
+		start:       time.Now(),
+	}
+
+	for time.Since(pb.start) < duration {
+		cancel := d.stopAfter(period)
+		err := d.target.Continue()
+		sampling := cancel()
+		if err != nil {
+			if _, exited := err.(proc.ErrProcessExited); exited {
+				break
+			}
+			return nil, err
+		}
+		if d.target.StopReason != proc.StopManual || !sampling || d.halted() {
+			break
+		}
+		for _, thread := range d.target.ThreadList() {
+			if g, _ := proc.GetG(thread); g == nil {
+				continue
+			}
+			frames, err := proc.ThreadStacktrace(thread, maxProfileStackDepth)
+			if err != nil || len(frames) == 0 {
+				continue
+			}
+			pb.add(profileStack(frames), 1, int64(period))
+		}
+	}
+	pb.duration = time.Since(pb.start)
+	return pb.encode(), nil
+}
+
+// ProfileHeap returns a heap profile in pprof format, read from the memory
+// profile maintained by the runtime of the target. The values of the
+// samples are scaled by runtime.MemProfileRate, like the heap profiles of
+// runtime/pprof.
+func (d *Debugger) ProfileHeap() ([]byte, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+
+	records, err := proc.ReadMemProfile(d.target)
+	if err != nil {
+		return nil, fmt.Errorf("could not read memory profile: %v", err)
+	}
+
+	var rate uint64
+	if scope, err := proc.ThreadScope(d.target.CurrentThread()); err == nil {
+		rate, _ = evalUint(scope, []string{"runtime.MemProfileRate"})
+	}
+
+	pb := &profileBuilder{
+		sampleTypes: [][2]string{{"alloc_objects", "count"}, {"alloc_space", "bytes"}, {"inuse_objects", "count"}, {"inuse_space", "bytes"}},
+		periodType:  [2]string{"space", "bytes"},
+		period:      int64(rate),
+		start:       time.Now(),
+	}
+	bi := d.target.BinInfo()
+	for _, rec := range records {
+		stack := make([]profileFrame, 0, len(rec.Stack))
+		for _, pc := range rec.Stack {
+			// stack contains return addresses, use the address of the call
+			// instruction to find the line.
+			file, line, fn := bi.PCToLine(pc - 1)
+			frame := profileFrame{PC: pc, File: file, Line: line, Fn: "?"}
+			if fn != nil {
+				frame.Fn = fn.Name
+			}
+			stack = append(stack, frame)
+		}
+		allocObjects, allocBytes := scaleHeapSample(rec.AllocObjects, rec.AllocBytes, int64(rate))
+		inuseObjects, inuseBytes := scaleHeapSample(rec.AllocObjects-rec.FreeObjects, rec.AllocBytes-rec.FreeBytes, int64(rate))
+		pb.add(stack, allocObjects, allocBytes, inuseObjects, inuseBytes)
+	}
+	return pb.encode(), nil
+}
+
+// scaleHeapSample estimates the number and the size of the allocations of
+// a record of the memory profile, which only records one allocation every
+// rate bytes on average, like runtime/pprof does.
+func scaleHeapSample(count, size, rate int64) (int64, int64) {
+	if count == 0 || size == 0 {
+		return 0, 0
+	}
+	if rate <= 1 {
+		// rate is 1 if every allocation is recorded, 0 if it is unknown.
+		return count, size
+	}
+	avgSize := float64(size) / float64(count)
+	scale := 1 / (1 - math.Exp(-avgSize/float64(rate)))
+	return int64(float64(count) * scale), int64(float64(size) * scale)
+}
+
+// stopAfter requests a manual stop of the target after the specified
+// duration. The returned function, which must be called once the target
+// stopped, cancels the request: if the timer already fired while the
+// target stopped for another reason the stop request is cleared, so that
+// it does not stop the target later. It returns true if the timer fired,
+// a manual stop of the target was requested by somebody else otherwise.
+func (d *Debugger) stopAfter(duration time.Duration) func() bool {
+	fired := make(chan struct{})
+	timer := time.AfterFunc(duration, func() {
+		d.target.RequestManualStop()
+		close(fired)
+	})
+	return func() bool {
+		if timer.Stop() {
+			return false
+		}
+		<-fired
+		d.target.CheckAndClearManualStopRequest()
+		return true
+	}
+}
+
+// halted returns true if the target was halted since ProfileCPU started,
+// the halt request could have stopped the target at the same time as the
+// timer of stopAfter.
+func (d *Debugger) halted() bool {
+	d.recordMutex.Lock()
+	defer d.recordMutex.Unlock()
+	return d.haltRequested
+}
+
+func profileStack(frames []proc.Stackframe) []profileFrame {
+	r := make([]profileFrame, 0, len(frames))
+	for _, frame := range frames {
+		pf := profileFrame{PC: frame.Call.PC, File: frame.Call.File, Line: frame.Call.Line, Fn: "?"}
+		if frame.Call.Fn != nil {
+			pf.Fn = frame.Call.Fn.Name
+		}
+		r = append(r, pf)
+	}
+	return r
+}
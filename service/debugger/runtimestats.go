@@ -0,0 +1,85 @@
+package debugger
+
+import (
+	"go/constant"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// maxPauseHistory is the size of runtime.memstats.pause_ns.
+const maxPauseHistory = 256
+
+// RuntimeStats reads memory and scheduler statistics from the runtime of
+// the target, it works on live processes as well as core files because
+// it only reads memory and does not call any function of the target.
+func (d *Debugger) RuntimeStats() (*api.RuntimeStats, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+
+	scope, err := proc.ThreadScope(d.target.CurrentThread())
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &api.RuntimeStats{}
+	for _, field := range []struct {
+		name  string
+		dst   *uint64
+		exprs []string
+	}{
+		{"HeapAlloc", &stats.HeapAlloc, []string{"runtime.memstats.heap_alloc"}},
+		{"HeapSys", &stats.HeapSys, []string{"runtime.memstats.heap_sys"}},
+		{"HeapIdle", &stats.HeapIdle, []string{"runtime.memstats.heap_idle"}},
+		{"HeapInuse", &stats.HeapInuse, []string{"runtime.memstats.heap_inuse"}},
+		{"HeapReleased", &stats.HeapReleased, []string{"runtime.memstats.heap_released"}},
+		{"HeapObjects", &stats.HeapObjects, []string{"runtime.memstats.heap_objects"}},
+		{"StackInuse", &stats.StackInuse, []string{"runtime.memstats.stacks_inuse"}},
+		{"NextGC", &stats.NextGC, gcHeapGoalExprs},
+		{"NumGC", &stats.NumGC, gcCyclesExprs},
+		{"PauseTotalNs", &stats.PauseTotalNs, []string{"runtime.memstats.pause_total_ns"}},
+	} {
+		var ok bool
+		*field.dst, ok = evalUint(scope, field.exprs)
+		if !ok {
+			stats.Unavailable = append(stats.Unavailable, field.name)
+		}
+	}
+
+	if pauses, err := scope.EvalVariable("runtime.memstats.pause_ns", proc.LoadConfig{MaxArrayValues: maxPauseHistory}); err == nil && pauses.Unreadable == nil && len(pauses.Children) == maxPauseHistory {
+		n := stats.NumGC
+		if n > maxPauseHistory {
+			n = maxPauseHistory
+		}
+		for i := uint64(0); i < n; i++ {
+			v := pauses.Children[(stats.NumGC+maxPauseHistory-1-i)%maxPauseHistory]
+			if v.Value == nil {
+				break
+			}
+			pause, _ := constant.Uint64Val(v.Value)
+			stats.PauseNs = append(stats.PauseNs, pause)
+		}
+	} else {
+		stats.Unavailable = append(stats.Unavailable, "PauseNs")
+	}
+
+	if gs, _, err := proc.GoroutinesInfo(d.target, 0, 0); err == nil {
+		stats.Goroutines = len(gs)
+	} else {
+		stats.Unavailable = append(stats.Unavailable, "Goroutines")
+	}
+
+	mnext, ok1 := evalUint(scope, []string{"runtime.sched.mnext"})
+	nmfreed, ok2 := evalUint(scope, []string{"runtime.sched.nmfreed"})
+	if ok1 && ok2 {
+		stats.Threads = int(mnext - nmfreed)
+	} else {
+		stats.Unavailable = append(stats.Unavailable, "Threads")
+	}
+
+	return stats, nil
+}
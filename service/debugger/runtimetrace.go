@@ -0,0 +1,201 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// runtimeTraceLoadConfig loads the values returned by the functions called
+// to control the runtime trace, including the errors they return.
+var runtimeTraceLoadConfig = proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 2, MaxStringLen: 256, MaxArrayValues: 8, MaxStructFields: -1}
+
+// runtimeTraceCategory is the category of the messages logged in the
+// runtime trace for the stops of the target.
+const runtimeTraceCategory = "delve"
+
+// runtimeTraceFuncs are the functions of the target called to write a
+// runtime trace, see StartRuntimeTrace.
+var runtimeTraceFuncs = []string{"os.OpenFile", "runtime/trace.Start", "runtime/trace.Stop"}
+
+// runtimeTraceLogFunc is the function of the target called to log the
+// stops in the runtime trace, linked if runtime/trace.Log is used.
+const runtimeTraceLogFunc = "runtime/trace.userLog"
+
+// runtimeTrace is a runtime execution trace being written by the target,
+// see StartRuntimeTrace.
+type runtimeTrace struct {
+	path string
+	// file is the address of the *os.File the trace is written to.
+	file uint64
+	// stops is the number of stops logged in the trace.
+	stops int
+	// log is true if the stops can be logged.
+	log bool
+	// pending is the last stop of the target at a breakpoint, logged when
+	// the target is resumed.
+	pending *runtimeTraceStop
+}
+
+// runtimeTraceStop is a stop of the target at a breakpoint, logged in the
+// runtime trace on the goroutine that stopped.
+type runtimeTraceStop struct {
+	goroutineID int
+	message     string
+	time        time.Time
+}
+
+// StartRuntimeTrace starts a runtime execution trace of the target, like
+// runtime/trace.Start, written to the file at path, which is relative to
+// the working directory of the debugger if the target runs on this
+// machine. The functions of os and runtime/trace are called on the selected
+// goroutine, therefore trace.Start and trace.Stop must be linked in the
+// target. While the trace is written every stop at a breakpoint is logged
+// in it, with category "delve" on the goroutine that stopped, when the
+// target is resumed, if trace.Log is also linked, see StopRuntimeTrace.
+func (d *Debugger) StartRuntimeTrace(path string) (*api.RuntimeTrace, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if d.config.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+	if d.runtimeTrace != nil {
+		return nil, fmt.Errorf("the runtime trace is already being written to %s", d.runtimeTrace.path)
+	}
+	for _, fn := range runtimeTraceFuncs {
+		if d.target.BinInfo().LookupFunc[fn] == nil {
+			return nil, fmt.Errorf("could not find %s, runtime/trace must be imported by the target (for example with import _ \"runtime/trace\")", fn)
+		}
+	}
+	if d.localProcess() {
+		var err error
+		if path, err = filepath.Abs(path); err != nil {
+			return nil, err
+		}
+	}
+
+	d.setRunning(true)
+	defer d.setRunning(false)
+
+	// os.Create is usually inlined.
+	vars, err := d.callRuntimeTraceFunc(d.target.SelectedGoroutine(), fmt.Sprintf("os.OpenFile(%q, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)", path))
+	if err != nil {
+		return nil, err
+	}
+	if len(vars) == 0 || len(vars[0].Children) == 0 {
+		return nil, errors.New("could not read the file opened by os.OpenFile")
+	}
+	rt := &runtimeTrace{path: path, file: uint64(vars[0].Children[0].Addr), log: d.target.BinInfo().LookupFunc[runtimeTraceLogFunc] != nil}
+	if _, err := d.callRuntimeTraceFunc(d.target.SelectedGoroutine(), fmt.Sprintf("\"runtime/trace\".Start((*os.File)(%#x))", rt.file)); err != nil {
+		d.closeRuntimeTraceFile(rt)
+		return nil, err
+	}
+	d.runtimeTrace = rt
+	return &api.RuntimeTrace{Path: rt.path, LogsStops: rt.log}, nil
+}
+
+// StopRuntimeTrace stops the runtime execution trace started by
+// StartRuntimeTrace, after logging the current stop, and closes its file.
+func (d *Debugger) StopRuntimeTrace() (*api.RuntimeTrace, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if _, err := d.target.Valid(); err != nil {
+		return nil, err
+	}
+	rt := d.runtimeTrace
+	if rt == nil {
+		return nil, errors.New("the runtime trace was not started")
+	}
+
+	d.setRunning(true)
+	defer d.setRunning(false)
+
+	d.logRuntimeTraceStop()
+	// trace.Stop returns once the goroutine started by trace.Start wrote
+	// the whole trace.
+	if _, err := d.callRuntimeTraceFunc(d.target.SelectedGoroutine(), "\"runtime/trace\".Stop()"); err != nil {
+		return nil, err
+	}
+	d.runtimeTrace = nil
+	d.closeRuntimeTraceFile(rt)
+	return &api.RuntimeTrace{Path: rt.path, LogsStops: rt.log, Stops: rt.stops}, nil
+}
+
+// closeRuntimeTraceFile closes the file of rt, if (*os.File).Close is
+// linked in the target, otherwise the file is left open.
+func (d *Debugger) closeRuntimeTraceFile(rt *runtimeTrace) {
+	if d.target.BinInfo().LookupFunc["os.(*File).Close"] == nil {
+		return
+	}
+	if _, err := d.callRuntimeTraceFunc(d.target.SelectedGoroutine(), fmt.Sprintf("(*os.File)(%#x).Close()", rt.file)); err != nil {
+		d.log.Warnf("could not close the runtime trace: %v", err)
+	}
+}
+
+// callRuntimeTraceFunc calls the function of expr on goroutine g, returns
+// the error it returns as its last value, if any.
+func (d *Debugger) callRuntimeTraceFunc(g *proc.G, expr string) ([]*proc.Variable, error) {
+	vars, err := proc.CallFunction(d.target, g, expr, runtimeTraceLoadConfig)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(vars); n > 0 && vars[n-1].TypeString() == "error" {
+		if v := api.ConvertVar(vars[n-1]); len(v.Children) > 0 && v.Children[0].Addr != 0 {
+			return nil, fmt.Errorf("%s failed: %s", expr, v.SinglelineString())
+		}
+	}
+	return vars, nil
+}
+
+// recordRuntimeTraceStop records the stop of state, if the target stopped
+// at a breakpoint while writing a runtime trace, to be logged in the trace
+// when the target is resumed. Calling functions of the target to log it
+// immediately would change the state of the stop.
+func (d *Debugger) recordRuntimeTraceStop(state *api.DebuggerState) {
+	rt := d.runtimeTrace
+	if rt == nil || !rt.log || state.CurrentThread == nil || state.CurrentThread.Breakpoint == nil || state.CurrentThread.GoroutineID == 0 {
+		return
+	}
+	th := state.CurrentThread
+	name := fmt.Sprintf("breakpoint %d", th.Breakpoint.ID)
+	if th.Breakpoint.Name != "" {
+		name = fmt.Sprintf("breakpoint %s", th.Breakpoint.Name)
+	}
+	rt.pending = &runtimeTraceStop{
+		goroutineID: th.GoroutineID,
+		message:     fmt.Sprintf("stopped at %s at %s:%d %s", name, th.File, th.Line, th.Function.Name()),
+		time:        time.Now(),
+	}
+}
+
+// logRuntimeTraceStop logs in the runtime trace the last stop recorded by
+// recordRuntimeTraceStop, with how long the target was stopped, on the
+// goroutine that stopped. The stop is not logged if the goroutine can not
+// call functions any more, for example because it was already resumed.
+func (d *Debugger) logRuntimeTraceStop() {
+	rt := d.runtimeTrace
+	if rt == nil || rt.pending == nil {
+		return
+	}
+	stop := rt.pending
+	rt.pending = nil
+	g, err := proc.FindGoroutine(d.target, stop.goroutineID)
+	if err != nil || g == nil {
+		return
+	}
+	msg := fmt.Sprintf("%s, for %v", stop.message, time.Since(stop.time).Round(time.Millisecond))
+	if _, err := d.callRuntimeTraceFunc(g, fmt.Sprintf("\"runtime/trace\".userLog(0, %q, %q)", runtimeTraceCategory, msg)); err != nil {
+		d.log.Warnf("could not log the stop in the runtime trace: %v", err)
+		return
+	}
+	rt.stops++
+}
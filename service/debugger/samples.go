@@ -0,0 +1,51 @@
+package debugger
+
+import (
+	"sync"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// sampleBufferSize is the maximum number of samples retained by the
+// debugger, when the buffer is full the oldest samples are discarded.
+const sampleBufferSize = 1024
+
+// sampleBuffer is a ring buffer holding the values collected by sample
+// breakpoints. It is protected by its own mutex so that clients can
+// download its contents while the target is running.
+type sampleBuffer struct {
+	mu      sync.Mutex
+	buf     []api.Sample
+	start   int
+	dropped uint64
+}
+
+func (sb *sampleBuffer) add(s api.Sample) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if len(sb.buf) < sampleBufferSize {
+		sb.buf = append(sb.buf, s)
+		return
+	}
+	sb.buf[sb.start] = s
+	sb.start = (sb.start + 1) % len(sb.buf)
+	sb.dropped++
+}
+
+// get returns the contents of the buffer, oldest sample first, and
+// the number of samples that were discarded because the buffer was
+// full. If clear is true the buffer is emptied.
+func (sb *sampleBuffer) get(clear bool) ([]api.Sample, uint64) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	r := make([]api.Sample, 0, len(sb.buf))
+	r = append(r, sb.buf[sb.start:]...)
+	r = append(r, sb.buf[:sb.start]...)
+	dropped := sb.dropped
+	if clear {
+		sb.buf = nil
+		sb.start = 0
+		sb.dropped = 0
+	}
+	return r, dropped
+}
@@ -0,0 +1,34 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func TestSampleBuffer(t *testing.T) {
+	var sb sampleBuffer
+	for i := 0; i < sampleBufferSize+10; i++ {
+		sb.add(api.Sample{BreakpointID: i})
+	}
+	samples, dropped := sb.get(false)
+	if len(samples) != sampleBufferSize {
+		t.Fatalf("wrong number of samples %d", len(samples))
+	}
+	if dropped != 10 {
+		t.Fatalf("wrong number of dropped samples %d", dropped)
+	}
+	for i := range samples {
+		if samples[i].BreakpointID != i+10 {
+			t.Fatalf("wrong sample at %d: %d", i, samples[i].BreakpointID)
+		}
+	}
+	samples, _ = sb.get(true)
+	if len(samples) != sampleBufferSize {
+		t.Fatalf("wrong number of samples %d", len(samples))
+	}
+	samples, dropped = sb.get(false)
+	if len(samples) != 0 || dropped != 0 {
+		t.Fatalf("buffer not cleared: %d %d", len(samples), dropped)
+	}
+}
@@ -0,0 +1,117 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/pkg/proc/core"
+	"github.com/go-delve/delve/service/api"
+)
+
+// ErrSnapshotSelected is returned when trying to resume the target while
+// a snapshot is selected.
+var ErrSnapshotSelected = errors.New("a snapshot is selected, switch back to the process to resume it")
+
+// snapshot is a frozen copy of the state of the target, see Snapshot.
+type snapshot struct {
+	target *proc.Target
+	when   time.Time
+	note   string
+}
+
+// Snapshot captures the state of the stopped target into a snapshot, which
+// stays inspectable after the target resumes or exits, and returns its ID.
+// The snapshot is kept in memory until ClearSnapshot is called or the
+// debugger detaches.
+func (d *Debugger) Snapshot(note string) (int, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if d.liveTarget != nil {
+		return 0, errors.New("can not take a snapshot of a snapshot")
+	}
+	t, err := core.Snapshot(d.target)
+	if err != nil {
+		return 0, err
+	}
+	if d.snapshots == nil {
+		d.snapshots = make(map[int]*snapshot)
+	}
+	d.lastSnapshotID++
+	d.snapshots[d.lastSnapshotID] = &snapshot{target: t, when: time.Now(), note: note}
+	return d.lastSnapshotID, nil
+}
+
+// Snapshots returns the list of snapshots.
+func (d *Debugger) Snapshots() []api.Snapshot {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	r := make([]api.Snapshot, 0, len(d.snapshots))
+	for id := 1; id <= d.lastSnapshotID; id++ {
+		if s, ok := d.snapshots[id]; ok {
+			r = append(r, api.Snapshot{ID: id, When: s.when, Note: s.note, Selected: id == d.selectedSnapshot})
+		}
+	}
+	return r
+}
+
+// SwitchSnapshot selects the snapshot with the given ID, all the requests
+// that inspect the target, like evaluating expressions or listing
+// goroutines, then read the snapshot. ID 0 selects the process again.
+func (d *Debugger) SwitchSnapshot(id int) error {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if id == 0 {
+		d.selectProcess()
+		return nil
+	}
+	s, ok := d.snapshots[id]
+	if !ok {
+		return fmt.Errorf("no snapshot with ID %d", id)
+	}
+	if d.liveTarget == nil {
+		d.liveTarget = d.target
+	}
+	d.target = s.target
+	d.selectedSnapshot = id
+	return nil
+}
+
+// ClearSnapshot releases the snapshot with the given ID, the process is
+// selected again if it was selected.
+func (d *Debugger) ClearSnapshot(id int) error {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	s, ok := d.snapshots[id]
+	if !ok {
+		return fmt.Errorf("no snapshot with ID %d", id)
+	}
+	if id == d.selectedSnapshot {
+		d.selectProcess()
+	}
+	delete(d.snapshots, id)
+	return s.target.Detach(false)
+}
+
+// selectProcess selects the process instead of a snapshot.
+func (d *Debugger) selectProcess() {
+	if d.liveTarget != nil {
+		d.target = d.liveTarget
+		d.liveTarget = nil
+	}
+	d.selectedSnapshot = 0
+}
+
+// clearSnapshots releases all snapshots.
+func (d *Debugger) clearSnapshots() {
+	d.selectProcess()
+	for id, s := range d.snapshots {
+		s.target.Detach(false)
+		delete(d.snapshots, id)
+	}
+}
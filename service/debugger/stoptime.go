@@ -0,0 +1,113 @@
+package debugger
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/sirupsen/logrus"
+)
+
+// stopTimes measures how long the target is stopped by the debugger, from
+// when a command stops it to when the next one resumes it, by the command
+// that stopped it. Like sampleBuffer it is protected by its own mutex so
+// that clients can read it while the target is running.
+type stopTimes struct {
+	mu       sync.Mutex
+	stopped  bool
+	since    time.Time
+	command  string
+	total    time.Duration
+	commands map[string]*api.CommandStopTime
+
+	// alarm is how long the target can stay stopped before a warning is
+	// logged, see Config.StopTimeAlarm.
+	alarm  time.Duration
+	alarms int
+	timer  *time.Timer
+	log    *logrus.Entry
+}
+
+// stop records that command stopped the target.
+func (st *stopTimes) stop(command string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.stopped {
+		return
+	}
+	st.stopped, st.since, st.command = true, time.Now(), command
+	if st.alarm > 0 {
+		since := st.since
+		st.timer = time.AfterFunc(st.alarm, func() { st.ring(since) })
+	}
+}
+
+func (st *stopTimes) ring(since time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.stopped || st.since != since {
+		return
+	}
+	st.alarms++
+	if st.log != nil {
+		st.log.Warnf("the target has been stopped by %s for more than %v", st.command, st.alarm)
+	}
+}
+
+// resume records that the target was resumed, or killed.
+func (st *stopTimes) resume() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.stopped {
+		return
+	}
+	d := time.Since(st.since)
+	st.stopped = false
+	st.total += d
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	if st.commands == nil {
+		st.commands = map[string]*api.CommandStopTime{}
+	}
+	c := st.commands[st.command]
+	if c == nil {
+		c = &api.CommandStopTime{Command: st.command}
+		st.commands[st.command] = c
+	}
+	c.Count++
+	c.Total += d
+	if d > c.Max {
+		c.Max = d
+	}
+}
+
+func (st *stopTimes) get() *api.StopTime {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	r := &api.StopTime{
+		Total:    st.total,
+		Stopped:  st.stopped,
+		Alarm:    st.alarm,
+		Alarms:   st.alarms,
+		Commands: make([]api.CommandStopTime, 0, len(st.commands)),
+	}
+	if st.stopped {
+		r.Current = time.Since(st.since)
+		r.Command = st.command
+		r.Total += r.Current
+	}
+	for _, c := range st.commands {
+		r.Commands = append(r.Commands, *c)
+	}
+	sort.Slice(r.Commands, func(i, j int) bool { return r.Commands[i].Command < r.Commands[j].Command })
+	return r
+}
+
+// StopTime returns how long the target was stopped by the debugger.
+// Can be called while the target is running.
+func (d *Debugger) StopTime() *api.StopTime {
+	return d.stopTimes.get()
+}
@@ -0,0 +1,41 @@
+package debugger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStopTimes(t *testing.T) {
+	st := stopTimes{alarm: 20 * time.Millisecond}
+	st.stop("launch")
+	st.stop("continue") // already stopped
+	time.Sleep(50 * time.Millisecond)
+	r := st.get()
+	if !r.Stopped || r.Command != "launch" || r.Current < 50*time.Millisecond || r.Total != r.Current || len(r.Commands) != 0 {
+		t.Fatalf("wrong stop time while stopped %#v", r)
+	}
+	if r.Alarms != 1 {
+		t.Fatalf("wrong number of alarms %d", r.Alarms)
+	}
+	st.resume()
+	st.resume() // already running
+	st.stop("next")
+	st.resume()
+	st.stop("next")
+	st.resume()
+
+	r = st.get()
+	if r.Stopped || r.Current != 0 || r.Alarms != 1 || len(r.Commands) != 2 {
+		t.Fatalf("wrong stop time %#v", r)
+	}
+	launch, next := r.Commands[0], r.Commands[1]
+	if launch.Command != "launch" || launch.Count != 1 || launch.Total < 50*time.Millisecond || launch.Max != launch.Total {
+		t.Fatalf("wrong launch stop time %#v", launch)
+	}
+	if next.Command != "next" || next.Count != 2 || next.Max > next.Total {
+		t.Fatalf("wrong next stop time %#v", next)
+	}
+	if r.Total != launch.Total+next.Total {
+		t.Fatalf("wrong total %v", r.Total)
+	}
+}
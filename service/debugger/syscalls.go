@@ -0,0 +1,54 @@
+package debugger
+
+import (
+	"sort"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// CatchSyscalls makes the target stop every time one of its threads
+// enters or returns from one of the system calls in names, replacing the
+// system calls caught before, and returns the caught system calls sorted
+// by name. An empty names stops catching system calls. The system calls
+// are caught again when the target is restarted.
+func (d *Debugger) CatchSyscalls(names []string) ([]string, error) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	if d.config.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	caught := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			caught = append(caught, name)
+		}
+	}
+	sort.Strings(caught)
+	if err := d.target.CatchSyscalls(caught); err != nil {
+		return nil, err
+	}
+	d.caughtSyscalls = caught
+	return append([]string(nil), caught...), nil
+}
+
+// CaughtSyscalls returns the system calls caught, sorted by name, see
+// CatchSyscalls.
+func (d *Debugger) CaughtSyscalls() []string {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+	return append([]string(nil), d.caughtSyscalls...)
+}
+
+// catchSyscalls catches the system calls caught in d.target in p, the
+// target replacing it.
+func (d *Debugger) catchSyscalls(p *proc.Target) {
+	if len(d.caughtSyscalls) == 0 {
+		return
+	}
+	if err := p.CatchSyscalls(d.caughtSyscalls); err != nil {
+		d.log.Warnf("could not catch system calls: %v", err)
+	}
+}
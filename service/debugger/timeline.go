@@ -0,0 +1,183 @@
+package debugger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// maxTimelineStops is the number of stops kept in the timeline, the oldest
+// ones are dropped first.
+const maxTimelineStops = 10000
+
+// timelineLoadConfig loads the values of the expressions of the timeline,
+// which are recorded as strings.
+var timelineLoadConfig = proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1}
+
+// timeline is the record of the stops of the target during the debugging
+// session, see Timeline.
+type timeline struct {
+	stops []api.TimelineStop
+	// count is the number of stops recorded, including the dropped ones.
+	count int
+	// exprs are the expressions evaluated at every stop.
+	exprs []string
+}
+
+// Timeline returns the stops of the target recorded during the debugging
+// session, in order, with the values of the expressions of
+// SetTimelineExprs at each stop. Every command resuming the target, and
+// every restart, records the stop it ends with, including the exit of the
+// target. The hits of sample breakpoints are also recorded, with the
+// values they collect, although the target does not stop. The timeline is
+// kept when the target is restarted, only the last 10000 stops are kept.
+func (d *Debugger) Timeline() []api.TimelineStop {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	return append([]api.TimelineStop(nil), d.timeline.stops...)
+}
+
+// TimelineExprs returns the expressions evaluated at every stop recorded
+// in the timeline.
+func (d *Debugger) TimelineExprs() []string {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	return append([]string(nil), d.timeline.exprs...)
+}
+
+// SetTimelineExprs sets the expressions evaluated on the current goroutine
+// at every stop recorded in the timeline from now on.
+func (d *Debugger) SetTimelineExprs(exprs []string) {
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+
+	d.timeline.exprs = append([]string(nil), exprs...)
+}
+
+// recordTimelineStop records in the timeline the stop of the target by
+// command, exited is the exit of the target, if it exited. The values of
+// the stop are the values of the expressions of the breakpoint the target
+// stopped at, set with 'on <breakpoint> print', followed by the values of
+// the expressions of the timeline.
+func (d *Debugger) recordTimelineStop(command string, exited *proc.ErrProcessExited) {
+	stop := api.TimelineStop{Command: command}
+	if exited != nil {
+		stop.Reason = fmt.Sprintf("exited with status %d", exited.Status)
+		stop.Exited = true
+	} else {
+		thread := d.target.CurrentThread()
+		stop.Reason = timelineStopReason(d.target.StopReason, thread.Breakpoint())
+		if g := d.target.SelectedGoroutine(); g != nil {
+			stop.GoroutineID = g.ID
+		}
+		if bp := fillTimelineStop(&stop, thread); bp != nil {
+			evalTimelineValues(&stop, thread, bp.Variables)
+		}
+		evalTimelineValues(&stop, thread, d.timeline.exprs)
+	}
+	d.addTimelineStop(stop)
+}
+
+// recordTimelineHit records in the timeline the hit of the sample
+// breakpoint thread is stopped at, with the values of its expressions
+// collected in sample. The target is resumed without stopping.
+func (d *Debugger) recordTimelineHit(thread proc.Thread, sample *api.Sample) {
+	stop := api.TimelineStop{Command: api.Continue, Resumed: true, GoroutineID: sample.GoroutineID}
+	stop.Reason = "sample " + timelineStopReason(proc.StopBreakpoint, thread.Breakpoint())
+	fillTimelineStop(&stop, thread)
+	for _, v := range sample.Variables {
+		if v.Unreadable != "" {
+			stop.Values = append(stop.Values, api.TimelineValue{Expr: v.Name, Err: v.Unreadable})
+		} else {
+			stop.Values = append(stop.Values, api.TimelineValue{Expr: v.Name, Value: v.SinglelineString()})
+		}
+	}
+	d.addTimelineStop(stop)
+}
+
+func (d *Debugger) addTimelineStop(stop api.TimelineStop) {
+	tl := &d.timeline
+	tl.count++
+	stop.Index, stop.Time = tl.count, time.Now()
+	if len(tl.stops) >= maxTimelineStops {
+		tl.stops = append(tl.stops[:0], tl.stops[1:]...)
+	}
+	tl.stops = append(tl.stops, stop)
+}
+
+// fillTimelineStop sets the thread, the location and the breakpoint of
+// stop from thread. Returns the user breakpoint thread is stopped at, or
+// nil.
+func fillTimelineStop(stop *api.TimelineStop, thread proc.Thread) *proc.Breakpoint {
+	stop.ThreadID = thread.ThreadID()
+	if loc, err := thread.Location(); err == nil {
+		stop.File, stop.Line = loc.File, loc.Line
+		if loc.Fn != nil {
+			stop.Function = loc.Fn.Name
+		}
+	}
+	bp := thread.Breakpoint()
+	if bp.Breakpoint == nil || !bp.Active || !bp.IsUser() {
+		return nil
+	}
+	stop.BreakpointID = bp.LogicalID
+	return bp.Breakpoint
+}
+
+// evalTimelineValues appends to the values of stop the values of exprs, on
+// the goroutine of thread.
+func evalTimelineValues(stop *api.TimelineStop, thread proc.Thread, exprs []string) {
+	if len(exprs) == 0 {
+		return
+	}
+	scope, err := proc.GoroutineScope(thread)
+	for _, expr := range exprs {
+		value := api.TimelineValue{Expr: expr}
+		if err != nil {
+			value.Err = err.Error()
+		} else if v, err := scope.EvalExpression(expr, timelineLoadConfig); err != nil {
+			value.Err = err.Error()
+		} else {
+			value.Value = api.ConvertVar(v).SinglelineString()
+		}
+		stop.Values = append(stop.Values, value)
+	}
+}
+
+// timelineStopReason describes why the target stopped, bp is the
+// breakpoint the current thread is stopped at.
+func timelineStopReason(reason proc.StopReason, bp *proc.BreakpointState) string {
+	switch reason {
+	case proc.StopBreakpoint:
+		switch {
+		case bp == nil || bp.Breakpoint == nil:
+			return "breakpoint"
+		case bp.Name != "":
+			return fmt.Sprintf("breakpoint %s", bp.Name)
+		default:
+			return fmt.Sprintf("breakpoint %d", bp.LogicalID)
+		}
+	case proc.StopHardcodedBreakpoint:
+		return "hardcoded breakpoint"
+	case proc.StopManual:
+		return "manual stop"
+	case proc.StopNextFinished:
+		return "step finished"
+	case proc.StopCallReturned:
+		return "call returned"
+	case proc.StopSyscall:
+		return "system call"
+	case proc.StopLaunched:
+		return "launched"
+	case proc.StopAttached:
+		return "attached"
+	case proc.StopExited:
+		return "exited"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,174 @@
+package debugger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchPollInterval is how often the source files of Config.Watch are
+// checked for changes.
+const watchPollInterval = 250 * time.Millisecond
+
+// DefaultWatchDebounce is the default value of Config.WatchDebounce.
+const DefaultWatchDebounce = 500 * time.Millisecond
+
+// sourceStamp identifies a version of a source file.
+type sourceStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// scanSources returns the versions of the source files in dirs and their
+// subdirectories. Hidden directories, vendor and testdata are skipped,
+// like the go command does.
+func scanSources(dirs []string) map[string]sourceStamp {
+	files := map[string]sourceStamp{}
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			name := info.Name()
+			if info.IsDir() {
+				if path != dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if isSourceFile(name) {
+				files[path] = sourceStamp{info.ModTime(), info.Size()}
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+func isSourceFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".go", ".s", ".c", ".h":
+		return true
+	}
+	return name == "go.mod" || name == "go.sum"
+}
+
+func sameSources(a, b map[string]sourceStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		if b[path] != stamp {
+			return false
+		}
+	}
+	return true
+}
+
+// watch polls the source files of Config.Watch until stop is closed and,
+// once they stop changing for Config.WatchDebounce, rebuilds and restarts
+// the target, see sourcesChanged.
+func (d *Debugger) watch(stop <-chan struct{}) {
+	debounce := d.config.WatchDebounce
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+	files := scanSources(d.config.Watch)
+	var lastChange time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(watchPollInterval):
+		}
+		if newFiles := scanSources(d.config.Watch); !sameSources(files, newFiles) {
+			files = newFiles
+			lastChange = time.Now()
+			continue
+		}
+		if !lastChange.IsZero() && time.Since(lastChange) >= debounce {
+			lastChange = time.Time{}
+			d.sourcesChanged()
+		}
+	}
+}
+
+// sourcesChanged requests a restart of the target with a new build of
+// the executable. If the target is running it is stopped, or its wait for
+// changes after exiting is interrupted, and continueSampling restarts it
+// and continues the new process. Otherwise it is restarted right away.
+func (d *Debugger) sourcesChanged() {
+	d.log.Infof("source files changed, restarting")
+	d.recordMutex.Lock()
+	d.watchRestart = true
+	running := d.isRunning()
+	if running {
+		if d.waitCancel != nil {
+			close(d.waitCancel)
+			d.waitCancel = nil
+		} else {
+			d.target.RequestManualStop()
+		}
+	}
+	d.recordMutex.Unlock()
+	if running {
+		return
+	}
+	d.targetMutex.Lock()
+	defer d.targetMutex.Unlock()
+	// The target could have been continued, and restarted, meanwhile.
+	if d.takeWatchRestart() {
+		d.restartWatched()
+	}
+}
+
+// takeWatchRestart returns whether sourcesChanged requested a restart and
+// clears the request.
+func (d *Debugger) takeWatchRestart() bool {
+	d.recordMutex.Lock()
+	defer d.recordMutex.Unlock()
+	r := d.watchRestart
+	d.watchRestart = false
+	return r
+}
+
+// restartWatched rebuilds and restarts the target, keeping the current
+// process if the executable can not be built.
+func (d *Debugger) restartWatched() error {
+	discarded, err := d.restart(false, "", false, nil, [3]string{}, true)
+	if err != nil {
+		d.log.Errorf("could not restart: %v", err)
+		return err
+	}
+	for _, bp := range discarded {
+		d.log.Warnf("breakpoint %d discarded: %s", bp.Breakpoint.ID, bp.Reason)
+	}
+	d.log.Infof("restarted with pid %d", d.target.Pid())
+	return nil
+}
+
+// waitRestart waits, after the target exited while being continued, until
+// sourcesChanged restarts it. Returns false if it is interrupted by a halt
+// request.
+func (d *Debugger) waitRestart() bool {
+	for {
+		cancel := make(chan struct{})
+		d.recordMutex.Lock()
+		wait := !d.watchRestart
+		if wait {
+			d.waitCancel = cancel
+		}
+		d.recordMutex.Unlock()
+		if wait {
+			d.log.Infof("waiting for changes of the source files")
+			<-cancel
+		}
+		if !d.takeWatchRestart() {
+			return false
+		}
+		if d.restartWatched() == nil {
+			return true
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package debugger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dlv-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(path, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.go", "package main")
+	write("go.mod", "module foo")
+	write("README.md", "foo")
+	write("sub/sub.go", "package sub")
+	write("testdata/fuzz/FuzzFoo/x", "go test fuzz v1")
+	write("vendor/bar/bar.go", "package bar")
+	write(".git/x.go", "package x")
+
+	files := scanSources([]string{dir})
+	if len(files) != 3 {
+		t.Fatalf("wrong files %v", files)
+	}
+	for _, path := range []string{"main.go", "go.mod", "sub/sub.go"} {
+		if _, ok := files[filepath.Join(dir, path)]; !ok {
+			t.Errorf("%s not found", path)
+		}
+	}
+
+	write("README.md", "bar")
+	write("testdata/y.go", "package y")
+	if !sameSources(files, scanSources([]string{dir})) {
+		t.Error("change of an ignored file detected")
+	}
+	write("sub/sub.go", "package sub // changed")
+	if sameSources(files, scanSources([]string{dir})) {
+		t.Error("change not detected")
+	}
+	write("sub/sub2.go", "package sub")
+	os.Remove(filepath.Join(dir, "sub", "sub.go"))
+	if sameSources(files, scanSources([]string{dir})) {
+		t.Error("rename not detected")
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-delve/delve/pkg/logflags"
+)
+
+// The handshake authenticating the connections between a headless instance
+// of Delve started with --connect and a client started with
+// 'dlv connect --reverse', both knowing the same token:
+//
+//	server -> client: dialMagic, server nonce
+//	client -> server: client nonce, HMAC(token, "client", server nonce, client nonce)
+//	server -> client: HMAC(token, "server", client nonce, server nonce)
+//
+// All the messages have a fixed size, the JSON-RPC connection starts
+// immediately after the last one.
+const (
+	dialMagic     = "DELVE-DIAL\x01"
+	dialNonceSize = 32
+	dialTimeout   = 10 * time.Second
+)
+
+var (
+	// ErrDialAuth is returned when the other end of a connection does not
+	// know the token.
+	ErrDialAuth = errors.New("authentication failed: the tokens of the client and the server differ")
+
+	errDialerClosed = errors.New("accept failed: listener closed")
+)
+
+// Delays between the attempts to connect to a client, doubled after each
+// failure.
+var (
+	minDialBackoff = time.Second
+	maxDialBackoff = 30 * time.Second
+)
+
+// DialListener returns a net.Listener whose Accept method, instead of
+// accepting incoming connections, connects to addr, where a client started
+// with 'dlv connect --reverse' is listening. This lets a headless server
+// running behind a NAT or a firewall, unable to accept incoming
+// connections, reach its client.
+// Accept retries with an exponential backoff until the connection succeeds
+// and the client authenticates with token, or the listener is closed.
+func DialListener(addr, token string) net.Listener {
+	return &dialListener{addr: addr, token: token, closech: make(chan struct{})}
+}
+
+type dialListener struct {
+	addr    string
+	token   string
+	closech chan struct{}
+	closed  bool
+	closeMu sync.Mutex
+}
+
+// Accept connects to the client, retrying until it succeeds or the listener
+// is closed.
+func (l *dialListener) Accept() (net.Conn, error) {
+	log := logflags.RPCLogger()
+	backoff := minDialBackoff
+	for {
+		conn, err := l.dial()
+		if err == nil {
+			return conn, nil
+		}
+		log.Errorf("could not connect to %s: %v, retrying in %v", l.addr, err, backoff)
+		select {
+		case <-l.closech:
+			return nil, errDialerClosed
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxDialBackoff {
+			backoff = maxDialBackoff
+		}
+	}
+}
+
+func (l *dialListener) dial() (net.Conn, error) {
+	select {
+	case <-l.closech:
+		return nil, errDialerClosed
+	default:
+	}
+	conn, err := net.DialTimeout("tcp", l.addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := serverHandshake(conn, l.token); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Close closes the listener, interrupting Accept.
+func (l *dialListener) Close() error {
+	l.closeMu.Lock()
+	defer l.closeMu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.closech)
+	}
+	return nil
+}
+
+// Addr returns the address of the client.
+func (l *dialListener) Addr() net.Addr {
+	return dialAddr(l.addr)
+}
+
+// dialAddr is the address of the client of a dialListener. It is not a
+// *net.TCPAddr, the connections to it are authenticated with the token
+// and are not subject to the same user check of local connections.
+type dialAddr string
+
+func (a dialAddr) Network() string { return "tcp" }
+func (a dialAddr) String() string  { return string(a) }
+
+// AcceptDialer accepts connections on l until a headless instance of Delve,
+// started with --connect, connects and authenticates with token, and
+// returns its connection.
+func AcceptDialer(l net.Listener, token string) (net.Conn, error) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if err := clientHandshake(conn, token); err != nil {
+			logflags.RPCLogger().Errorf("closing connection from %v: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+func serverHandshake(conn net.Conn, token string) error {
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	nonce, err := newDialNonce()
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(append([]byte(dialMagic), nonce...)); err != nil {
+		return err
+	}
+	buf := make([]byte, dialNonceSize+sha256.Size)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	clientNonce, clientMAC := buf[:dialNonceSize], buf[dialNonceSize:]
+	if !hmac.Equal(clientMAC, dialMAC(token, "client", nonce, clientNonce)) {
+		return ErrDialAuth
+	}
+	_, err = conn.Write(dialMAC(token, "server", clientNonce, nonce))
+	return err
+}
+
+func clientHandshake(conn net.Conn, token string) error {
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	buf := make([]byte, len(dialMagic)+dialNonceSize)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf[:len(dialMagic)], []byte(dialMagic)) {
+		return fmt.Errorf("not a headless instance of Delve")
+	}
+	serverNonce := buf[len(dialMagic):]
+	nonce, err := newDialNonce()
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(append(nonce, dialMAC(token, "client", serverNonce, nonce)...)); err != nil {
+		return err
+	}
+	serverMAC := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, serverMAC); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// the server closes the connection when the MAC is wrong
+			return ErrDialAuth
+		}
+		return err
+	}
+	if !hmac.Equal(serverMAC, dialMAC(token, "server", nonce, serverNonce)) {
+		return ErrDialAuth
+	}
+	return nil
+}
+
+func newDialNonce() ([]byte, error) {
+	nonce := make([]byte, dialNonceSize)
+	_, err := rand.Read(nonce)
+	return nonce, err
+}
+
+func dialMAC(token, role string, nonces ...[]byte) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(role))
+	for _, nonce := range nonces {
+		mac.Write(nonce)
+	}
+	return mac.Sum(nil)
+}
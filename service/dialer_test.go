@@ -0,0 +1,118 @@
+package service
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	dl := DialListener(l.Addr().String(), "secret")
+	defer dl.Close()
+	if dl.Addr().String() != l.Addr().String() {
+		t.Errorf("wrong address %q, expected %q", dl.Addr(), l.Addr())
+	}
+
+	clientch := make(chan net.Conn)
+	go func() {
+		conn, err := AcceptDialer(l, "secret")
+		if err != nil {
+			t.Error(err)
+		}
+		clientch <- conn
+	}()
+
+	server, err := dl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := <-clientch
+	if client == nil {
+		return
+	}
+	defer client.Close()
+
+	// the connection must be usable after the handshake in both directions
+	go server.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("read %q %v", buf, err)
+	}
+	go client.Write([]byte("pong"))
+	if _, err := io.ReadFull(server, buf); err != nil || string(buf) != "pong" {
+		t.Errorf("read %q %v", buf, err)
+	}
+}
+
+func TestDialHandshakeWrongToken(t *testing.T) {
+	server, client := net.Pipe()
+	errch := make(chan error)
+	go func() {
+		err := serverHandshake(server, "secret")
+		server.Close()
+		errch <- err
+	}()
+	if err := clientHandshake(client, "wrong"); err != ErrDialAuth {
+		t.Errorf("client: expected %v, got %v", ErrDialAuth, err)
+	}
+	if err := <-errch; err != ErrDialAuth {
+		t.Errorf("server: expected %v, got %v", ErrDialAuth, err)
+	}
+}
+
+func TestDialListenerBackoff(t *testing.T) {
+	defer func(min, max time.Duration) { minDialBackoff, maxDialBackoff = min, max }(minDialBackoff, maxDialBackoff)
+	minDialBackoff, maxDialBackoff = 10*time.Millisecond, 20*time.Millisecond
+
+	// reserve an address nobody is listening at
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	dl := DialListener(addr, "secret")
+	acceptch := make(chan error)
+	go func() {
+		_, err := dl.Accept()
+		acceptch <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("could not listen again at %s: %v", addr, err)
+	}
+	defer l.Close()
+	conn, err := AcceptDialer(l, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if err := <-acceptch; err != nil {
+		t.Fatal(err)
+	}
+
+	dl.Close()
+	go func() {
+		_, err := dl.Accept()
+		acceptch <- err
+	}()
+	select {
+	case err := <-acceptch:
+		if err != errDialerClosed {
+			t.Errorf("expected %v, got %v", errDialerClosed, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Accept did not return after Close")
+	}
+}
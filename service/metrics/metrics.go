@@ -0,0 +1,172 @@
+// Package metrics collects the metrics of the headless server and writes
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// RequestsTotal counts the API requests served, by method.
+	RequestsTotal = NewCounter("dlv_rpc_requests_total", "Number of API requests served.", "method")
+	// RequestErrorsTotal counts the API requests that returned an error, by method.
+	RequestErrorsTotal = NewCounter("dlv_rpc_request_errors_total", "Number of API requests that returned an error.", "method")
+	// RequestDuration measures the time spent serving API requests, by
+	// method. The latency of evaluations is the one of the Eval method.
+	RequestDuration = NewSummary("dlv_rpc_request_duration_seconds", "Time spent serving API requests.", "method")
+	// MemoryReadBytes counts the bytes of target memory examined by clients.
+	MemoryReadBytes = NewCounter("dlv_memory_read_bytes_total", "Bytes of target memory examined by clients.")
+)
+
+// registry lists the metrics written by WriteTo, in order.
+var registry = []metric{RequestsTotal, RequestErrorsTotal, RequestDuration, MemoryReadBytes}
+
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+// Counter is a monotonically increasing value, optionally partitioned by
+// the values of some labels.
+type Counter struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter returns a counter partitioned by the specified labels.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// Add adds v to the counter for the specified label values, which must
+// be as many as the labels of the counter.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := labelKey(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Inc adds one to the counter for the specified label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) writeTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, key, formatValue(c.values[key]))
+	}
+}
+
+// Summary records the count and the sum of observed durations, optionally
+// partitioned by the values of some labels.
+type Summary struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	counts map[string]uint64
+	sums   map[string]float64
+}
+
+// NewSummary returns a summary partitioned by the specified labels.
+func NewSummary(name, help string, labels ...string) *Summary {
+	return &Summary{name: name, help: help, labels: labels, counts: make(map[string]uint64), sums: make(map[string]float64)}
+}
+
+// Observe records d for the specified label values.
+func (s *Summary) Observe(d time.Duration, labelValues ...string) {
+	key := labelKey(s.labels, labelValues)
+	s.mu.Lock()
+	s.counts[key]++
+	s.sums[key] += d.Seconds()
+	s.mu.Unlock()
+}
+
+func (s *Summary) writeTo(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeHeader(w, s.name, s.help, "summary")
+	for _, key := range sortedKeys(s.sums) {
+		fmt.Fprintf(w, "%s_sum%s %s\n", s.name, key, formatValue(s.sums[key]))
+		fmt.Fprintf(w, "%s_count%s %d\n", s.name, key, s.counts[key])
+	}
+}
+
+// Gauge is a value computed when the metrics are written.
+type Gauge struct {
+	name, help string
+	value      func() float64
+}
+
+// NewGauge returns a gauge whose value is returned by value.
+func NewGauge(name, help string, value func() float64) *Gauge {
+	return &Gauge{name: name, help: help, value: value}
+}
+
+func (g *Gauge) writeTo(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.value()))
+}
+
+// WriteTo writes the metrics of the server followed by gauges, in the
+// Prometheus text exposition format.
+func WriteTo(w io.Writer, gauges ...*Gauge) {
+	for _, m := range registry {
+		m.writeTo(w)
+	}
+	for _, g := range gauges {
+		g.writeTo(w)
+	}
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelKey returns the label set of a metric, for example {method="Eval"}.
+func labelKey(labels, values []string) string {
+	if len(labels) != len(values) {
+		panic(fmt.Errorf("wrong number of label values %v for labels %v", values, labels))
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	var buf strings.Builder
+	buf.WriteByte('{')
+	for i := range labels {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%s=%s", labels[i], strconv.Quote(values[i]))
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
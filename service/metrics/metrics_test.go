@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteTo(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests.", "method")
+	c.Inc("RPCServer.Eval")
+	c.Add(2, "RPCServer.Command")
+	s := NewSummary("test_duration_seconds", "Durations.", "method")
+	s.Observe(1500*time.Millisecond, "RPCServer.Eval")
+	s.Observe(500*time.Millisecond, "RPCServer.Eval")
+	g := NewGauge("test_clients", "Clients.", func() float64 { return 3 })
+
+	var buf bytes.Buffer
+	for _, m := range []metric{c, s, g, NewCounter("test_bytes_total", "Bytes.")} {
+		m.writeTo(&buf)
+	}
+	const want = `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{method="RPCServer.Command"} 2
+test_requests_total{method="RPCServer.Eval"} 1
+# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds summary
+test_duration_seconds_sum{method="RPCServer.Eval"} 2
+test_duration_seconds_count{method="RPCServer.Eval"} 2
+# HELP test_clients Clients.
+# TYPE test_clients gauge
+test_clients 3
+# HELP test_bytes_total Bytes.
+# TYPE test_bytes_total counter
+test_bytes_total 0
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
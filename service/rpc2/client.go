@@ -1,22 +1,24 @@
 package rpc2
 
 import (
-	"fmt"
+	"errors"
 	"log"
 	"net"
 	"net/rpc"
-	"net/rpc/jsonrpc"
+	"strings"
 	"time"
 
 	"github.com/go-delve/delve/service"
 	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/rpccodec"
 )
 
 // Client is a RPC service.Client.
 type RPCClient struct {
 	client *rpc.Client
 
-	retValLoadCfg *api.LoadConfig
+	retValLoadCfg    *api.LoadConfig
+	stepSkipPackages []string
 }
 
 // Ensure the implementation satisfies the interface.
@@ -24,11 +26,11 @@ var _ service.Client = &RPCClient{}
 
 // NewClient creates a new RPCClient.
 func NewClient(addr string) *RPCClient {
-	client, err := jsonrpc.Dial("tcp", addr)
+	conn, err := net.Dial("tcp", addr)
 	if err != nil {
 		log.Fatal("dialing:", err)
 	}
-	return newFromRPCClient(client)
+	return NewClientFromConn(conn)
 }
 
 func newFromRPCClient(client *rpc.Client) *RPCClient {
@@ -39,7 +41,39 @@ func newFromRPCClient(client *rpc.Client) *RPCClient {
 
 // NewClientFromConn creates a new RPCClient from the given connection.
 func NewClientFromConn(conn net.Conn) *RPCClient {
-	return newFromRPCClient(jsonrpc.NewClient(conn))
+	codec, _ := rpccodec.NewClientCodec(conn, rpccodec.EncodingJSON, rpccodec.CompressionNone)
+	return newFromRPCClient(rpc.NewClientWithCodec(codec))
+}
+
+// NewClientFromConnEncoding creates a new RPCClient from the given
+// connection, switching it to the specified encoding and compression (see
+// api.SetEncodingIn). If the server does not support SetEncoding the
+// connection keeps using JSON, without compression.
+func NewClientFromConnEncoding(conn net.Conn, encoding, compression string) (*RPCClient, error) {
+	if err := rpccodec.Check(encoding, compression); err != nil {
+		return nil, err
+	}
+	codec, _ := rpccodec.NewClientCodec(conn, rpccodec.EncodingJSON, rpccodec.CompressionNone)
+	err := codec.WriteRequest(&rpc.Request{ServiceMethod: rpccodec.SetEncodingMethod}, &api.SetEncodingIn{Encoding: encoding, Compression: compression})
+	if err != nil {
+		return nil, err
+	}
+	var resp rpc.Response
+	if err := codec.ReadResponseHeader(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		codec.ReadResponseBody(nil)
+		if strings.HasPrefix(resp.Error, "unknown method") {
+			return newFromRPCClient(rpc.NewClientWithCodec(codec)), nil
+		}
+		return nil, errors.New(resp.Error)
+	}
+	if err := codec.ReadResponseBody(&api.SetEncodingOut{}); err != nil {
+		return nil, err
+	}
+	newCodec, _ := rpccodec.NewClientCodec(conn, encoding, compression)
+	return newFromRPCClient(rpc.NewClientWithCodec(newCodec)), nil
 }
 
 func (c *RPCClient) ProcessPid() int {
@@ -108,7 +142,7 @@ func (c *RPCClient) continueDir(cmd string) <-chan *api.DebuggerState {
 			}
 			if state.Exited {
 				// Error types apparently cannot be marshalled by Go correctly. Must reset error here.
-				state.Err = fmt.Errorf("Process %d has exited with status %d", c.ProcessPid(), state.ExitStatus)
+				state.Err = api.Errorf(api.ErrCodeProcessExited, "Process %d has exited with status %d", c.ProcessPid(), state.ExitStatus)
 			}
 			ch <- &state
 			if err != nil || state.Exited {
@@ -125,7 +159,7 @@ func (c *RPCClient) continueDir(cmd string) <-chan *api.DebuggerState {
 				}
 			}
 
-			if !isbreakpoint || !istracepoint {
+			if !isbreakpoint || !istracepoint || len(state.ExprWatchChanges) > 0 {
 				close(ch)
 				return
 			}
@@ -148,7 +182,13 @@ func (c *RPCClient) ReverseNext() (*api.DebuggerState, error) {
 
 func (c *RPCClient) Step() (*api.DebuggerState, error) {
 	var out CommandOut
-	err := c.call("Command", api.DebuggerCommand{Name: api.Step, ReturnInfoLoadConfig: c.retValLoadCfg}, &out)
+	err := c.call("Command", api.DebuggerCommand{Name: api.Step, ReturnInfoLoadConfig: c.retValLoadCfg, SkipPackages: c.stepSkipPackages}, &out)
+	return &out.State, err
+}
+
+func (c *RPCClient) StepFollowChannel() (*api.DebuggerState, error) {
+	var out CommandOut
+	err := c.call("Command", api.DebuggerCommand{Name: api.Step, ReturnInfoLoadConfig: c.retValLoadCfg, FollowChannel: true, SkipPackages: c.stepSkipPackages}, &out)
 	return &out.State, err
 }
 
@@ -275,7 +315,7 @@ func (c *RPCClient) GetThread(id int) (*api.Thread, error) {
 
 func (c *RPCClient) EvalVariable(scope api.EvalScope, expr string, cfg api.LoadConfig) (*api.Variable, error) {
 	var out EvalOut
-	err := c.call("Eval", EvalIn{scope, expr, &cfg}, &out)
+	err := c.call("Eval", EvalIn{scope, expr, &cfg, ""}, &out)
 	return out.Variable, err
 }
 
@@ -302,15 +342,21 @@ func (c *RPCClient) ListTypes(filter string) ([]string, error) {
 	return types.Types, err
 }
 
+func (c *RPCClient) SearchSymbols(query string, kinds api.SymbolKind, limit int) ([]api.Symbol, error) {
+	var out SearchSymbolsOut
+	err := c.call("SearchSymbols", SearchSymbolsIn{query, kinds, limit}, &out)
+	return out.Symbols, err
+}
+
 func (c *RPCClient) ListPackageVariables(filter string, cfg api.LoadConfig) ([]api.Variable, error) {
 	var out ListPackageVarsOut
-	err := c.call("ListPackageVars", ListPackageVarsIn{filter, cfg}, &out)
+	err := c.call("ListPackageVars", ListPackageVarsIn{filter, cfg, ""}, &out)
 	return out.Variables, err
 }
 
 func (c *RPCClient) ListLocalVariables(scope api.EvalScope, cfg api.LoadConfig) ([]api.Variable, error) {
 	var out ListLocalVarsOut
-	err := c.call("ListLocalVars", ListLocalVarsIn{scope, cfg}, &out)
+	err := c.call("ListLocalVars", ListLocalVarsIn{scope, cfg, ""}, &out)
 	return out.Variables, err
 }
 
@@ -328,7 +374,7 @@ func (c *RPCClient) ListScopeRegisters(scope api.EvalScope, includeFp bool) (api
 
 func (c *RPCClient) ListFunctionArgs(scope api.EvalScope, cfg api.LoadConfig) ([]api.Variable, error) {
 	var out ListFunctionArgsOut
-	err := c.call("ListFunctionArgs", ListFunctionArgsIn{scope, cfg}, &out)
+	err := c.call("ListFunctionArgs", ListFunctionArgsIn{scope, cfg, ""}, &out)
 	return out.Args, err
 }
 
@@ -340,10 +386,22 @@ func (c *RPCClient) ListGoroutines(start, count int) ([]*api.Goroutine, int, err
 
 func (c *RPCClient) Stacktrace(goroutineId, depth int, opts api.StacktraceOptions, cfg *api.LoadConfig) ([]api.Stackframe, error) {
 	var out StacktraceOut
-	err := c.call("Stacktrace", StacktraceIn{goroutineId, depth, false, false, opts, cfg}, &out)
+	err := c.call("Stacktrace", StacktraceIn{goroutineId, depth, false, false, opts, cfg, ""}, &out)
 	return out.Locations, err
 }
 
+func (c *RPCClient) ListReturnValues(cfg api.LoadConfig) ([]api.Variable, *api.Function, error) {
+	var out ListReturnValuesOut
+	err := c.call("ListReturnValues", ListReturnValuesIn{cfg}, &out)
+	return out.ReturnValues, out.Function, err
+}
+
+func (c *RPCClient) ListDeferredCalls(goroutineID int, depth int, cfg *api.LoadConfig) ([]api.DeferredCall, error) {
+	var out ListDeferredCallsOut
+	err := c.call("ListDeferredCalls", ListDeferredCallsIn{goroutineID, depth, cfg}, &out)
+	return out.DeferredCalls, err
+}
+
 func (c *RPCClient) Ancestors(goroutineID int, numAncestors int, depth int) ([]api.Ancestor, error) {
 	var out AncestorsOut
 	err := c.call("Ancestors", AncestorsIn{goroutineID, numAncestors, depth}, &out)
@@ -411,10 +469,40 @@ func (c *RPCClient) ClearCheckpoint(id int) error {
 	return err
 }
 
+// Snapshot captures the state of the stopped target into a snapshot.
+func (c *RPCClient) Snapshot(note string) (int, error) {
+	var out SnapshotOut
+	err := c.call("Snapshot", SnapshotIn{note}, &out)
+	return out.ID, err
+}
+
+// ListSnapshots gets all snapshots.
+func (c *RPCClient) ListSnapshots() ([]api.Snapshot, error) {
+	var out ListSnapshotsOut
+	err := c.call("ListSnapshots", ListSnapshotsIn{}, &out)
+	return out.Snapshots, err
+}
+
+// SwitchSnapshot selects a snapshot, 0 selects the process.
+func (c *RPCClient) SwitchSnapshot(id int) error {
+	var out SwitchSnapshotOut
+	return c.call("SwitchSnapshot", SwitchSnapshotIn{id}, &out)
+}
+
+// ClearSnapshot removes a snapshot.
+func (c *RPCClient) ClearSnapshot(id int) error {
+	var out ClearSnapshotOut
+	return c.call("ClearSnapshot", ClearSnapshotIn{id}, &out)
+}
+
 func (c *RPCClient) SetReturnValuesLoadConfig(cfg *api.LoadConfig) {
 	c.retValLoadCfg = cfg
 }
 
+func (c *RPCClient) SetStepSkipPackages(pkgs []string) {
+	c.stepSkipPackages = pkgs
+}
+
 func (c *RPCClient) FunctionReturnLocations(fnName string) ([]uint64, error) {
 	var out FunctionReturnLocationsOut
 	err := c.call("FunctionReturnLocations", FunctionReturnLocationsIn{fnName}, &out)
@@ -441,6 +529,29 @@ func (c *RPCClient) ListDynamicLibraries() ([]api.Image, error) {
 	return out.List, nil
 }
 
+func (c *RPCClient) ListCapabilities() ([]api.Capability, error) {
+	var out ListCapabilitiesOut
+	err := c.call("ListCapabilities", ListCapabilitiesIn{}, &out)
+	return out.Capabilities, err
+}
+
+func (c *RPCClient) GetLogLevels() ([]api.LogLevel, error) {
+	var out GetLogLevelsOut
+	err := c.call("GetLogLevels", GetLogLevelsIn{}, &out)
+	return out.Levels, err
+}
+
+func (c *RPCClient) SetLogLevel(subsystem, level string) error {
+	var out SetLogLevelOut
+	return c.call("SetLogLevel", SetLogLevelIn{Subsystem: subsystem, Level: level}, &out)
+}
+
+func (c *RPCClient) DumpLog() ([]string, error) {
+	var out DumpLogOut
+	err := c.call("DumpLog", DumpLogIn{}, &out)
+	return out.Entries, err
+}
+
 func (c *RPCClient) ExamineMemory(address uintptr, count int) ([]byte, error) {
 	out := &ExaminedMemoryOut{}
 
@@ -452,12 +563,187 @@ func (c *RPCClient) ExamineMemory(address uintptr, count int) ([]byte, error) {
 	return out.Mem, nil
 }
 
+func (c *RPCClient) GetSamples(clear bool) ([]api.Sample, uint64, error) {
+	var out GetSamplesOut
+	err := c.call("GetSamples", GetSamplesIn{Clear: clear}, &out)
+	return out.Samples, out.Dropped, err
+}
+
+func (c *RPCClient) AddCoverage(specs []string) (int, error) {
+	var out AddCoverageOut
+	err := c.call("AddCoverage", AddCoverageIn{Specs: specs}, &out)
+	return out.Lines, err
+}
+
+func (c *RPCClient) GetCoverage() ([]api.CoverageLine, error) {
+	var out GetCoverageOut
+	err := c.call("GetCoverage", GetCoverageIn{}, &out)
+	return out.Lines, err
+}
+
+func (c *RPCClient) ClearCoverage() error {
+	return c.call("ClearCoverage", ClearCoverageIn{}, &ClearCoverageOut{})
+}
+
+func (c *RPCClient) GetStopTime() (*api.StopTime, error) {
+	var out GetStopTimeOut
+	err := c.call("GetStopTime", GetStopTimeIn{}, &out)
+	return &out.StopTime, err
+}
+
+func (c *RPCClient) GetTimeline() ([]api.TimelineStop, []string, error) {
+	var out GetTimelineOut
+	err := c.call("GetTimeline", GetTimelineIn{}, &out)
+	return out.Stops, out.Exprs, err
+}
+
+func (c *RPCClient) SetTimelineExprs(exprs []string) error {
+	return c.call("SetTimelineExprs", SetTimelineExprsIn{Exprs: exprs}, &SetTimelineExprsOut{})
+}
+
+func (c *RPCClient) GetOutput(since uint64, wait bool) ([]api.OutputChunk, bool, error) {
+	var out GetOutputOut
+	err := c.call("GetOutput", GetOutputIn{Since: since, Wait: wait}, &out)
+	return out.Chunks, out.Closed, err
+}
+
+func (c *RPCClient) RuntimeStats() (*api.RuntimeStats, error) {
+	var out RuntimeStatsOut
+	err := c.call("RuntimeStats", RuntimeStatsIn{}, &out)
+	return &out.Stats, err
+}
+
+func (c *RPCClient) Profile(kind string, duration time.Duration) ([]byte, error) {
+	var out ProfileOut
+	err := c.call("Profile", ProfileIn{Kind: kind, Duration: duration}, &out)
+	return out.Data, err
+}
+
+func (c *RPCClient) ProfileCMalloc(duration time.Duration, mallocgc bool) ([]byte, error) {
+	var out ProfileOut
+	err := c.call("Profile", ProfileIn{Kind: "cmalloc", Duration: duration, MallocGC: mallocgc}, &out)
+	return out.Data, err
+}
+
+func (c *RPCClient) StartRuntimeTrace(path string) (*api.RuntimeTrace, error) {
+	var out StartRuntimeTraceOut
+	err := c.call("StartRuntimeTrace", StartRuntimeTraceIn{Path: path}, &out)
+	return &out.Trace, err
+}
+
+func (c *RPCClient) StopRuntimeTrace() (*api.RuntimeTrace, error) {
+	var out StopRuntimeTraceOut
+	err := c.call("StopRuntimeTrace", StopRuntimeTraceIn{}, &out)
+	return &out.Trace, err
+}
+
+func (c *RPCClient) RecordCallers(fn string, duration time.Duration) ([]api.CallerStack, error) {
+	var out RecordCallersOut
+	err := c.call("RecordCallers", RecordCallersIn{Function: fn, Duration: duration}, &out)
+	return out.Stacks, err
+}
+
+func (c *RPCClient) Bisect(predicate, start, end string) (*api.BisectResult, error) {
+	var out BisectOut
+	err := c.call("Bisect", BisectIn{Predicate: predicate, Start: start, End: end}, &out)
+	return &out.Result, err
+}
+
+func (c *RPCClient) CreateExprWatch(expr string, locations []string) (*api.ExprWatch, error) {
+	var out CreateExprWatchOut
+	err := c.call("CreateExprWatch", CreateExprWatchIn{Expr: expr, Locations: locations}, &out)
+	return &out.Watch, err
+}
+
+func (c *RPCClient) ListExprWatches() ([]api.ExprWatch, error) {
+	var out ListExprWatchesOut
+	err := c.call("ListExprWatches", ListExprWatchesIn{}, &out)
+	return out.Watches, err
+}
+
+func (c *RPCClient) ClearExprWatch(id int) error {
+	return c.call("ClearExprWatch", ClearExprWatchIn{ID: id}, &ClearExprWatchOut{})
+}
+
+func (c *RPCClient) CatchSyscalls(syscalls []string) ([]string, error) {
+	var out CatchSyscallsOut
+	err := c.call("CatchSyscalls", CatchSyscallsIn{Syscalls: syscalls}, &out)
+	return out.Syscalls, err
+}
+
+func (c *RPCClient) ListCaughtSyscalls() ([]string, error) {
+	var out ListCaughtSyscallsOut
+	err := c.call("ListCaughtSyscalls", ListCaughtSyscallsIn{}, &out)
+	return out.Syscalls, err
+}
+
+func (c *RPCClient) CreateCatchpoint(kind, pattern string) ([]*api.Breakpoint, error) {
+	var out CreateCatchpointOut
+	err := c.call("CreateCatchpoint", CreateCatchpointIn{Kind: kind, Pattern: pattern}, &out)
+	return out.Breakpoints, err
+}
+
+func (c *RPCClient) CreateHTTPBreakpoint(filter api.HTTPRequestFilter) ([]*api.Breakpoint, error) {
+	var out CreateHTTPBreakpointOut
+	err := c.call("CreateHTTPBreakpoint", CreateHTTPBreakpointIn{Filter: filter}, &out)
+	return out.Breakpoints, err
+}
+
+func (c *RPCClient) CreateGRPCBreakpoint(filter api.GRPCRequestFilter) ([]*api.Breakpoint, error) {
+	var out CreateGRPCBreakpointOut
+	err := c.call("CreateGRPCBreakpoint", CreateGRPCBreakpointIn{Filter: filter}, &out)
+	return out.Breakpoints, err
+}
+
+func (c *RPCClient) CreateFinalizerBreakpoint(typ string) ([]*api.Breakpoint, error) {
+	var out CreateFinalizerBreakpointOut
+	err := c.call("CreateFinalizerBreakpoint", CreateFinalizerBreakpointIn{Type: typ}, &out)
+	return out.Breakpoints, err
+}
+
+func (c *RPCClient) ExamineContext(scope api.EvalScope, expr string, cfg api.LoadConfig) ([]api.Context, error) {
+	var out ExamineContextOut
+	err := c.call("ExamineContext", ExamineContextIn{Scope: scope, Expr: expr, Cfg: &cfg}, &out)
+	return out.Contexts, err
+}
+
+func (c *RPCClient) ListWorkers(scope api.EvalScope, expr string, cfg api.LoadConfig) (*api.WorkerGroup, error) {
+	var out ListWorkersOut
+	err := c.call("ListWorkers", ListWorkersIn{Scope: scope, Expr: expr, Cfg: &cfg}, &out)
+	return out.Group, err
+}
+
+func (c *RPCClient) ListTimers() ([]api.Timer, int64, error) {
+	var out ListTimersOut
+	err := c.call("ListTimers", ListTimersIn{}, &out)
+	return out.Timers, out.Now, err
+}
+
+func (c *RPCClient) ListFinalizers() (*api.FinalizerState, error) {
+	var out ListFinalizersOut
+	err := c.call("ListFinalizers", ListFinalizersIn{}, &out)
+	return out.State, err
+}
+
+func (c *RPCClient) ListTargets() ([]api.Target, error) {
+	var out ListTargetsOut
+	err := c.call("ListTargets", ListTargetsIn{}, &out)
+	return out.Targets, err
+}
+
 func (c *RPCClient) StopRecording() error {
 	return c.call("StopRecording", StopRecordingIn{}, &StopRecordingOut{})
 }
 
 func (c *RPCClient) call(method string, args, reply interface{}) error {
-	return c.client.Call("RPCServer."+method, args, reply)
+	ca := &rpccodec.CodeArgs{Args: args}
+	err := c.client.Call("RPCServer."+method, ca, reply)
+	if serr, ok := err.(rpc.ServerError); ok && ca.Code != "" {
+		// the errors the server sent a code for become *api.Error, wrapping
+		// the rpc.ServerError
+		return &api.Error{Code: api.ErrorCode(ca.Code), Message: string(serr), Err: serr}
+	}
+	return err
 }
 
 func (c *RPCClient) CallAPI(method string, args, reply interface{}) error {
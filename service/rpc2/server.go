@@ -3,8 +3,11 @@ package rpc2
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/go-delve/delve/pkg/logflags"
+	"github.com/go-delve/delve/pkg/proc"
 	"github.com/go-delve/delve/service"
 	"github.com/go-delve/delve/service/api"
 	"github.com/go-delve/delve/service/debugger"
@@ -15,10 +18,15 @@ type RPCServer struct {
 	config *service.Config
 	// debugger is a debugger service.
 	debugger *debugger.Debugger
+
+	// cancels maps the cancellation tokens of the requests in progress to
+	// the channels cancelling them, see Cancel.
+	cancelsMu sync.Mutex
+	cancels   map[string]chan struct{}
 }
 
 func NewServer(config *service.Config, debugger *debugger.Debugger) *RPCServer {
-	return &RPCServer{config, debugger}
+	return &RPCServer{config: config, debugger: debugger, cancels: make(map[string]chan struct{})}
 }
 
 type ProcessPidIn struct {
@@ -151,12 +159,12 @@ func (s *RPCServer) GetBreakpoint(arg GetBreakpointIn, out *GetBreakpointOut) er
 	if arg.Name != "" {
 		bp = s.debugger.FindBreakpointByName(arg.Name)
 		if bp == nil {
-			return fmt.Errorf("no breakpoint with name %s", arg.Name)
+			return api.Errorf(api.ErrCodeNoSuchBreakpoint, "no breakpoint with name %s", arg.Name)
 		}
 	} else {
 		bp = s.debugger.FindBreakpoint(arg.Id)
 		if bp == nil {
-			return fmt.Errorf("no breakpoint with id %d", arg.Id)
+			return api.Errorf(api.ErrCodeNoSuchBreakpoint, "no breakpoint with id %d", arg.Id)
 		}
 	}
 	out.Breakpoint = *bp
@@ -170,6 +178,8 @@ type StacktraceIn struct {
 	Defers bool // read deferred functions (equivalent to passing StacktraceReadDefers in Opts)
 	Opts   api.StacktraceOptions
 	Cfg    *api.LoadConfig
+
+	CancelToken string // see Cancel
 }
 
 type StacktraceOut struct {
@@ -180,7 +190,7 @@ type StacktraceOut struct {
 //
 // If Full is set it will also the variable of all local variables
 // and function arguments of all stack frames.
-func (s *RPCServer) Stacktrace(arg StacktraceIn, out *StacktraceOut) error {
+func (s *RPCServer) Stacktrace(arg StacktraceIn, cb service.RPCCallback) {
 	cfg := arg.Cfg
 	if cfg == nil && arg.Full {
 		cfg = &api.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1}
@@ -188,8 +198,43 @@ func (s *RPCServer) Stacktrace(arg StacktraceIn, out *StacktraceOut) error {
 	if arg.Defers {
 		arg.Opts |= api.StacktraceReadDefers
 	}
+	pcfg := api.LoadConfigToProc(cfg)
+	if pcfg != nil {
+		defer s.cancellable(arg.CancelToken, pcfg)()
+	}
+	var out StacktraceOut
 	var err error
-	out.Locations, err = s.debugger.Stacktrace(arg.Id, arg.Depth, arg.Opts, api.LoadConfigToProc(cfg))
+	out.Locations, err = s.debugger.Stacktrace(arg.Id, arg.Depth, arg.Opts, pcfg)
+	if cfg != nil && cfg.MaxResponseBytes > 0 {
+		var lists [][]api.Variable
+		for i := range out.Locations {
+			lists = append(lists, out.Locations[i].Arguments, out.Locations[i].Locals)
+		}
+		api.TruncateVariables(cfg.MaxResponseBytes, lists...)
+	}
+	cb.Return(out, err)
+}
+
+type ListDeferredCallsIn struct {
+	Id    int
+	Depth int
+	Cfg   *api.LoadConfig
+}
+
+type ListDeferredCallsOut struct {
+	DeferredCalls []api.DeferredCall
+}
+
+// ListDeferredCalls returns the pending deferred calls of the first Depth
+// frames of goroutine Id, in the order they will be executed.
+//
+// If Cfg is not nil the arguments of the deferred calls, or the variables
+// captured by the deferred closures, are loaded.
+// If the goroutine is panicking the deferred call that will recover the
+// panic, if any, is marked.
+func (s *RPCServer) ListDeferredCalls(arg ListDeferredCallsIn, out *ListDeferredCallsOut) error {
+	var err error
+	out.DeferredCalls, err = s.debugger.DeferredCalls(arg.Id, arg.Depth, api.LoadConfigToProc(arg.Cfg))
 	return err
 }
 
@@ -269,12 +314,12 @@ func (s *RPCServer) ClearBreakpoint(arg ClearBreakpointIn, out *ClearBreakpointO
 	if arg.Name != "" {
 		bp = s.debugger.FindBreakpointByName(arg.Name)
 		if bp == nil {
-			return fmt.Errorf("no breakpoint with name %s", arg.Name)
+			return api.Errorf(api.ErrCodeNoSuchBreakpoint, "no breakpoint with name %s", arg.Name)
 		}
 	} else {
 		bp = s.debugger.FindBreakpoint(arg.Id)
 		if bp == nil {
-			return fmt.Errorf("no breakpoint with id %d", arg.Id)
+			return api.Errorf(api.ErrCodeNoSuchBreakpoint, "no breakpoint with id %d", arg.Id)
 		}
 	}
 	deleted, err := s.debugger.ClearBreakpoint(bp)
@@ -348,6 +393,8 @@ func (s *RPCServer) GetThread(arg GetThreadIn, out *GetThreadOut) error {
 type ListPackageVarsIn struct {
 	Filter string
 	Cfg    api.LoadConfig
+
+	CancelToken string // see Cancel
 }
 
 type ListPackageVarsOut struct {
@@ -355,23 +402,28 @@ type ListPackageVarsOut struct {
 }
 
 // ListPackageVars lists all package variables in the context of the current thread.
-func (s *RPCServer) ListPackageVars(arg ListPackageVarsIn, out *ListPackageVarsOut) error {
+func (s *RPCServer) ListPackageVars(arg ListPackageVarsIn, cb service.RPCCallback) {
 	state, err := s.debugger.State(false)
 	if err != nil {
-		return err
+		cb.Return(nil, err)
+		return
 	}
 
 	current := state.CurrentThread
 	if current == nil {
-		return fmt.Errorf("no current thread")
+		cb.Return(nil, fmt.Errorf("no current thread"))
+		return
 	}
 
-	vars, err := s.debugger.PackageVariables(current.ID, arg.Filter, *api.LoadConfigToProc(&arg.Cfg))
+	cfg := api.LoadConfigToProc(&arg.Cfg)
+	defer s.cancellable(arg.CancelToken, cfg)()
+	vars, err := s.debugger.PackageVariables(current.ID, arg.Filter, *cfg)
 	if err != nil {
-		return err
+		cb.Return(nil, err)
+		return
 	}
-	out.Variables = vars
-	return nil
+	api.TruncateVariables(arg.Cfg.MaxResponseBytes, vars)
+	cb.Return(ListPackageVarsOut{Variables: vars}, nil)
 }
 
 type ListRegistersIn struct {
@@ -407,9 +459,29 @@ func (s *RPCServer) ListRegisters(arg ListRegistersIn, out *ListRegistersOut) er
 	return nil
 }
 
+type ListReturnValuesIn struct {
+	Cfg api.LoadConfig
+}
+
+type ListReturnValuesOut struct {
+	ReturnValues []api.Variable
+	Function     *api.Function
+}
+
+// ListReturnValues returns the values returned by the last function that
+// the current thread stepped out of, or over with next, and the function
+// that returned them. The values are discarded when execution is resumed.
+func (s *RPCServer) ListReturnValues(arg ListReturnValuesIn, out *ListReturnValuesOut) error {
+	var err error
+	out.ReturnValues, out.Function, err = s.debugger.ReturnValues(*api.LoadConfigToProc(&arg.Cfg))
+	return err
+}
+
 type ListLocalVarsIn struct {
 	Scope api.EvalScope
 	Cfg   api.LoadConfig
+
+	CancelToken string // see Cancel
 }
 
 type ListLocalVarsOut struct {
@@ -417,18 +489,23 @@ type ListLocalVarsOut struct {
 }
 
 // ListLocalVars lists all local variables in scope.
-func (s *RPCServer) ListLocalVars(arg ListLocalVarsIn, out *ListLocalVarsOut) error {
-	vars, err := s.debugger.LocalVariables(arg.Scope, *api.LoadConfigToProc(&arg.Cfg))
+func (s *RPCServer) ListLocalVars(arg ListLocalVarsIn, cb service.RPCCallback) {
+	cfg := api.LoadConfigToProc(&arg.Cfg)
+	defer s.cancellable(arg.CancelToken, cfg)()
+	vars, err := s.debugger.LocalVariables(arg.Scope, *cfg)
 	if err != nil {
-		return err
+		cb.Return(nil, err)
+		return
 	}
-	out.Variables = vars
-	return nil
+	api.TruncateVariables(arg.Cfg.MaxResponseBytes, vars)
+	cb.Return(ListLocalVarsOut{Variables: vars}, nil)
 }
 
 type ListFunctionArgsIn struct {
 	Scope api.EvalScope
 	Cfg   api.LoadConfig
+
+	CancelToken string // see Cancel
 }
 
 type ListFunctionArgsOut struct {
@@ -436,19 +513,24 @@ type ListFunctionArgsOut struct {
 }
 
 // ListFunctionArgs lists all arguments to the current function
-func (s *RPCServer) ListFunctionArgs(arg ListFunctionArgsIn, out *ListFunctionArgsOut) error {
-	vars, err := s.debugger.FunctionArguments(arg.Scope, *api.LoadConfigToProc(&arg.Cfg))
+func (s *RPCServer) ListFunctionArgs(arg ListFunctionArgsIn, cb service.RPCCallback) {
+	cfg := api.LoadConfigToProc(&arg.Cfg)
+	defer s.cancellable(arg.CancelToken, cfg)()
+	vars, err := s.debugger.FunctionArguments(arg.Scope, *cfg)
 	if err != nil {
-		return err
+		cb.Return(nil, err)
+		return
 	}
-	out.Args = vars
-	return nil
+	api.TruncateVariables(arg.Cfg.MaxResponseBytes, vars)
+	cb.Return(ListFunctionArgsOut{Args: vars}, nil)
 }
 
 type EvalIn struct {
 	Scope api.EvalScope
 	Expr  string
 	Cfg   *api.LoadConfig
+
+	CancelToken string // see Cancel
 }
 
 type EvalOut struct {
@@ -459,19 +541,194 @@ type EvalOut struct {
 //
 // See https://github.com/go-delve/delve/wiki/Expressions for
 // a description of acceptable values of arg.Expr.
-func (s *RPCServer) Eval(arg EvalIn, out *EvalOut) error {
+func (s *RPCServer) Eval(arg EvalIn, cb service.RPCCallback) {
 	cfg := arg.Cfg
 	if cfg == nil {
 		cfg = &api.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1}
 	}
-	v, err := s.debugger.EvalVariableInScope(arg.Scope, arg.Expr, *api.LoadConfigToProc(cfg))
+	pcfg := api.LoadConfigToProc(cfg)
+	defer s.cancellable(arg.CancelToken, pcfg)()
+	v, err := s.debugger.EvalVariableInScope(arg.Scope, arg.Expr, *pcfg)
+	if err != nil {
+		cb.Return(nil, err)
+		return
+	}
+	if cfg.MaxResponseBytes > 0 {
+		vars := []api.Variable{*v}
+		api.TruncateVariables(cfg.MaxResponseBytes, vars)
+		v = &vars[0]
+	}
+	cb.Return(EvalOut{Variable: v}, nil)
+}
+
+// ExamineContextIn holds the arguments of ExamineContext
+type ExamineContextIn struct {
+	Scope api.EvalScope
+	Expr  string
+	Cfg   *api.LoadConfig
+}
+
+// ExamineContextOut holds the return values of ExamineContext
+type ExamineContextOut struct {
+	Contexts []api.Context
+}
+
+// ExamineContext returns the chain of parents of the context.Context
+// resulting from evaluating arg.Expr in arg.Scope, starting with the
+// context itself: the values attached to it, with their keys, its
+// deadlines, which of its parents can be canceled, the contexts already
+// canceled and the goroutines blocked on their Done channels.
+// Only the parents of the contexts of package context are known, the chain
+// ends with the first context of another type.
+// The keys, values and errors are loaded with arg.Cfg, or the default
+// configuration of Eval.
+func (s *RPCServer) ExamineContext(arg ExamineContextIn, out *ExamineContextOut) error {
+	cfg := arg.Cfg
+	if cfg == nil {
+		cfg = &api.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1}
+	}
+	contexts, err := s.debugger.ExamineContext(arg.Scope, arg.Expr, *api.LoadConfigToProc(cfg))
 	if err != nil {
 		return err
 	}
-	out.Variable = v
+	out.Contexts = contexts
 	return nil
 }
 
+// ListWorkersIn holds the arguments of ListWorkers
+type ListWorkersIn struct {
+	Scope api.EvalScope
+	Expr  string
+	Cfg   *api.LoadConfig
+}
+
+// ListWorkersOut holds the return values of ListWorkers
+type ListWorkersOut struct {
+	Group *api.WorkerGroup
+}
+
+// ListWorkers returns the goroutines working for the value of arg.Expr,
+// evaluated in arg.Scope, which can be:
+//
+// - an errgroup.Group of golang.org/x/sync/errgroup: the goroutines
+// running the functions passed to its Go and TryGo methods, with the first
+// error returned by them
+//
+// - a semaphore.Weighted of golang.org/x/sync/semaphore: the goroutines
+// waiting to acquire it
+//
+// - a channel, for example the queue of a pool of workers: the goroutines
+// blocked receiving from it and sending to it
+//
+// The error is loaded with arg.Cfg, or the default configuration of Eval.
+func (s *RPCServer) ListWorkers(arg ListWorkersIn, out *ListWorkersOut) error {
+	cfg := arg.Cfg
+	if cfg == nil {
+		cfg = &api.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1}
+	}
+	wg, err := s.debugger.ListWorkers(arg.Scope, arg.Expr, *api.LoadConfigToProc(cfg))
+	if err != nil {
+		return err
+	}
+	out.Group = wg
+	return nil
+}
+
+// ListTimersIn holds the arguments of ListTimers
+type ListTimersIn struct {
+}
+
+// ListTimersOut holds the return values of ListTimers
+type ListTimersOut struct {
+	Timers []api.Timer
+	// Now is the current time of the monotonic clock of the target, in the
+	// unit of Timer.When, 0 if it is not known.
+	Now int64
+}
+
+// ListTimers returns the pending timers of the runtime, sorted by the time
+// they fire: the timers and tickers of package time, with the goroutines
+// receiving from their channel, the functions passed to time.AfterFunc,
+// the goroutines sleeping in time.Sleep and the timers internal to the
+// runtime. Now is only known for local live targets on linux, the time
+// the timers fire relative to it tells which ones are overdue.
+func (s *RPCServer) ListTimers(arg ListTimersIn, out *ListTimersOut) error {
+	timers, now, err := s.debugger.ListTimers()
+	if err != nil {
+		return err
+	}
+	out.Timers, out.Now = timers, now
+	return nil
+}
+
+// ListFinalizersIn holds the arguments of ListFinalizers
+type ListFinalizersIn struct {
+}
+
+// ListFinalizersOut holds the return values of ListFinalizers
+type ListFinalizersOut struct {
+	State *api.FinalizerState
+}
+
+// ListFinalizers returns the finalizers of the target: the ones queued to
+// run, whose objects are unreachable, followed by the finalizers and
+// cleanups of the objects still reachable, and the goroutine running the
+// finalizers, with whether it is running one.
+func (s *RPCServer) ListFinalizers(arg ListFinalizersIn, out *ListFinalizersOut) error {
+	fs, err := s.debugger.ListFinalizers()
+	if err != nil {
+		return err
+	}
+	out.State = fs
+	return nil
+}
+
+type CancelIn struct {
+	CancelToken string
+}
+
+type CancelOut struct {
+	// Cancelled is false if no request with CancelToken was in progress.
+	Cancelled bool
+}
+
+// Cancel cancels the requests in progress with the specified CancelToken.
+//
+// Stacktrace, ListPackageVars, ListLocalVars, ListFunctionArgs and Eval
+// accept a CancelToken chosen by the client. These requests are handled
+// asynchronously, when they are cancelled the server stops loading
+// variables and they return an error.
+func (s *RPCServer) Cancel(arg CancelIn, out *CancelOut) error {
+	s.cancelsMu.Lock()
+	defer s.cancelsMu.Unlock()
+	if cancel, ok := s.cancels[arg.CancelToken]; ok {
+		close(cancel)
+		delete(s.cancels, arg.CancelToken)
+		out.Cancelled = true
+	}
+	return nil
+}
+
+// cancellable makes a request with the specified token cancellable, by
+// setting cfg.Cancel, and returns a function to call once it is done.
+func (s *RPCServer) cancellable(token string, cfg *proc.LoadConfig) func() {
+	if token == "" {
+		return func() {}
+	}
+	cancel := make(chan struct{})
+	cfg.Cancel = cancel
+	s.cancelsMu.Lock()
+	s.cancels[token] = cancel
+	s.cancelsMu.Unlock()
+	return func() {
+		s.cancelsMu.Lock()
+		if s.cancels[token] == cancel {
+			delete(s.cancels, token)
+		}
+		s.cancelsMu.Unlock()
+	}
+}
+
 type SetIn struct {
 	Scope  api.EvalScope
 	Symbol string
@@ -541,6 +798,36 @@ func (s *RPCServer) ListTypes(arg ListTypesIn, out *ListTypesOut) error {
 	return nil
 }
 
+type SearchSymbolsIn struct {
+	Query string
+	// Kinds selects the kinds of symbols to search, all of them if it is 0.
+	Kinds api.SymbolKind
+	// Limit is the maximum number of symbols returned, if it is greater
+	// than zero.
+	Limit int
+}
+
+type SearchSymbolsOut struct {
+	Symbols []api.Symbol
+}
+
+// SearchSymbols returns the functions, types and package variables whose
+// name matches Query, the best matches first.
+//
+// A name matches if the characters of the query appear in it in the same
+// order, ignoring case. Exact matches are ranked first, followed by
+// matches of the function, type or variable name without the package path
+// or receiver, substrings starting at a component of the name and other
+// substrings and sequences of characters.
+func (s *RPCServer) SearchSymbols(arg SearchSymbolsIn, out *SearchSymbolsOut) error {
+	syms, err := s.debugger.SearchSymbols(arg.Query, arg.Kinds, arg.Limit)
+	if err != nil {
+		return err
+	}
+	out.Symbols = syms
+	return nil
+}
+
 type ListGoroutinesIn struct {
 	Start int
 	Count int
@@ -685,6 +972,61 @@ func (s *RPCServer) ClearCheckpoint(arg ClearCheckpointIn, out *ClearCheckpointO
 	return s.debugger.ClearCheckpoint(arg.ID)
 }
 
+type SnapshotIn struct {
+	Note string
+}
+
+type SnapshotOut struct {
+	ID int
+}
+
+// Snapshot captures the state of the stopped target into an in-memory
+// snapshot that can be inspected after the target resumes or exits.
+func (s *RPCServer) Snapshot(arg SnapshotIn, out *SnapshotOut) error {
+	var err error
+	out.ID, err = s.debugger.Snapshot(arg.Note)
+	return err
+}
+
+type ListSnapshotsIn struct {
+}
+
+type ListSnapshotsOut struct {
+	Snapshots []api.Snapshot
+}
+
+// ListSnapshots returns the list of snapshots.
+func (s *RPCServer) ListSnapshots(arg ListSnapshotsIn, out *ListSnapshotsOut) error {
+	out.Snapshots = s.debugger.Snapshots()
+	return nil
+}
+
+type SwitchSnapshotIn struct {
+	// ID of the snapshot to select, 0 selects the process.
+	ID int
+}
+
+type SwitchSnapshotOut struct {
+}
+
+// SwitchSnapshot selects a snapshot, the requests that inspect the target
+// read the selected snapshot until the process is selected again.
+func (s *RPCServer) SwitchSnapshot(arg SwitchSnapshotIn, out *SwitchSnapshotOut) error {
+	return s.debugger.SwitchSnapshot(arg.ID)
+}
+
+type ClearSnapshotIn struct {
+	ID int
+}
+
+type ClearSnapshotOut struct {
+}
+
+// ClearSnapshot releases a snapshot.
+func (s *RPCServer) ClearSnapshot(arg ClearSnapshotIn, out *ClearSnapshotOut) error {
+	return s.debugger.ClearSnapshot(arg.ID)
+}
+
 type IsMulticlientIn struct {
 }
 
@@ -744,6 +1086,74 @@ func (s *RPCServer) ListDynamicLibraries(in ListDynamicLibrariesIn, out *ListDyn
 	return nil
 }
 
+// ListCapabilitiesIn holds the arguments of ListCapabilities.
+type ListCapabilitiesIn struct {
+}
+
+// ListCapabilitiesOut holds the return values of ListCapabilities.
+type ListCapabilitiesOut struct {
+	Capabilities []api.Capability
+}
+
+// ListCapabilities returns the features that depend on the debug
+// information of the runtime of the target program (goroutines, function
+// calls...) and, for the ones that are not available, the reason why.
+func (s *RPCServer) ListCapabilities(in ListCapabilitiesIn, out *ListCapabilitiesOut) error {
+	out.Capabilities = s.debugger.ListCapabilities()
+	return nil
+}
+
+// GetLogLevelsIn holds the arguments of GetLogLevels.
+type GetLogLevelsIn struct {
+}
+
+// GetLogLevelsOut holds the return values of GetLogLevels.
+type GetLogLevelsOut struct {
+	Levels []api.LogLevel
+}
+
+// GetLogLevels returns the log level of each component of Delve.
+func (s *RPCServer) GetLogLevels(in GetLogLevelsIn, out *GetLogLevelsOut) error {
+	levels := logflags.Levels()
+	out.Levels = make([]api.LogLevel, len(levels))
+	for i := range levels {
+		out.Levels[i] = api.LogLevel(levels[i])
+	}
+	return nil
+}
+
+// SetLogLevelIn holds the arguments of SetLogLevel.
+type SetLogLevelIn struct {
+	Subsystem string
+	Level     string
+}
+
+// SetLogLevelOut holds the return values of SetLogLevel.
+type SetLogLevelOut struct {
+}
+
+// SetLogLevel changes the log level of a component of Delve, see 'dlv
+// help log' for the list of components and levels.
+func (s *RPCServer) SetLogLevel(in SetLogLevelIn, out *SetLogLevelOut) error {
+	return logflags.SetLevel(in.Subsystem, in.Level)
+}
+
+// DumpLogIn holds the arguments of DumpLog.
+type DumpLogIn struct {
+}
+
+// DumpLogOut holds the return values of DumpLog.
+type DumpLogOut struct {
+	Entries []string
+}
+
+// DumpLog returns the last entries logged by Delve, oldest first, in the
+// format selected by --log-format.
+func (s *RPCServer) DumpLog(in DumpLogIn, out *DumpLogOut) error {
+	out.Entries = logflags.Buffered()
+	return nil
+}
+
 // ListPackagesBuildInfoIn holds the arguments of ListPackages.
 type ListPackagesBuildInfoIn struct {
 	IncludeFiles bool
@@ -788,6 +1198,564 @@ func (s *RPCServer) ExamineMemory(arg ExamineMemoryIn, out *ExaminedMemoryOut) e
 	return nil
 }
 
+// GetSamplesIn holds the arguments of GetSamples
+type GetSamplesIn struct {
+	// Clear empties the sample buffer after returning its contents.
+	Clear bool
+}
+
+// GetSamplesOut holds the return values of GetSamples
+type GetSamplesOut struct {
+	Samples []api.Sample
+	// Dropped is the number of samples that were discarded because the
+	// sample buffer was full.
+	Dropped uint64
+}
+
+// GetSamples returns the values collected by sample breakpoints, oldest
+// first. Can be called while the target is running.
+func (s *RPCServer) GetSamples(arg GetSamplesIn, out *GetSamplesOut) error {
+	out.Samples, out.Dropped = s.debugger.Samples(arg.Clear)
+	return nil
+}
+
+// AddCoverageIn holds the arguments of AddCoverage
+type AddCoverageIn struct {
+	// Specs are locations, all the functions they resolve to are tracked,
+	// or paths of source files, ending in .go, all their functions are
+	// tracked.
+	Specs []string
+}
+
+// AddCoverageOut holds the return values of AddCoverage
+type AddCoverageOut struct {
+	// Lines is the number of lines added.
+	Lines int
+}
+
+// AddCoverage starts recording which lines of the specified functions are
+// executed, until ClearCoverage is called. See GetCoverage.
+func (s *RPCServer) AddCoverage(arg AddCoverageIn, out *AddCoverageOut) error {
+	var err error
+	out.Lines, err = s.debugger.AddCoverage(arg.Specs)
+	return err
+}
+
+// GetCoverageIn holds the arguments of GetCoverage
+type GetCoverageIn struct {
+}
+
+// GetCoverageOut holds the return values of GetCoverage
+type GetCoverageOut struct {
+	Lines []api.CoverageLine
+}
+
+// GetCoverage returns the lines tracked by line coverage, sorted by file
+// and line, and whether they were executed.
+func (s *RPCServer) GetCoverage(arg GetCoverageIn, out *GetCoverageOut) error {
+	out.Lines = s.debugger.Coverage()
+	return nil
+}
+
+// ClearCoverageIn holds the arguments of ClearCoverage
+type ClearCoverageIn struct {
+}
+
+// ClearCoverageOut holds the return values of ClearCoverage
+type ClearCoverageOut struct {
+}
+
+// ClearCoverage stops recording line coverage and discards the lines
+// tracked.
+func (s *RPCServer) ClearCoverage(arg ClearCoverageIn, out *ClearCoverageOut) error {
+	return s.debugger.ClearCoverage()
+}
+
+// GetStopTimeIn holds the arguments of GetStopTime
+type GetStopTimeIn struct {
+}
+
+// GetStopTimeOut holds the return values of GetStopTime
+type GetStopTimeOut struct {
+	StopTime api.StopTime
+}
+
+// GetStopTime returns how long the target was stopped by the debugger, in
+// total and by the command that stopped it. Can be called while the target
+// is running.
+func (s *RPCServer) GetStopTime(arg GetStopTimeIn, out *GetStopTimeOut) error {
+	out.StopTime = *s.debugger.StopTime()
+	return nil
+}
+
+// GetTimelineIn holds the arguments of GetTimeline
+type GetTimelineIn struct {
+}
+
+// GetTimelineOut holds the return values of GetTimeline
+type GetTimelineOut struct {
+	Stops []api.TimelineStop
+	// Exprs are the expressions evaluated at every stop.
+	Exprs []string
+}
+
+// GetTimeline returns the stops of the target recorded during the
+// debugging session, with the values of the expressions set by
+// SetTimelineExprs at each stop.
+func (s *RPCServer) GetTimeline(arg GetTimelineIn, out *GetTimelineOut) error {
+	out.Stops = s.debugger.Timeline()
+	out.Exprs = s.debugger.TimelineExprs()
+	return nil
+}
+
+// SetTimelineExprsIn holds the arguments of SetTimelineExprs
+type SetTimelineExprsIn struct {
+	Exprs []string
+}
+
+// SetTimelineExprsOut holds the return values of SetTimelineExprs
+type SetTimelineExprsOut struct {
+}
+
+// SetTimelineExprs sets the expressions evaluated on the current goroutine
+// at every stop recorded in the timeline.
+func (s *RPCServer) SetTimelineExprs(arg SetTimelineExprsIn, out *SetTimelineExprsOut) error {
+	s.debugger.SetTimelineExprs(arg.Exprs)
+	return nil
+}
+
+// GetOutputIn holds the arguments of GetOutput
+type GetOutputIn struct {
+	// Since is the sequence number of the last chunk received by the
+	// client, 0 for the first call.
+	Since uint64
+	// Wait makes GetOutput wait, up to maxOutputWait, for the target to
+	// write something if there is no output after Since.
+	Wait bool
+}
+
+// GetOutputOut holds the return values of GetOutput
+type GetOutputOut struct {
+	Chunks []api.OutputChunk
+	// Closed is true when the target will not write more output, because
+	// its output is not streamed or the debugger detached from it.
+	Closed bool
+}
+
+// maxOutputWait is how long GetOutput waits for output.
+const maxOutputWait = 30 * time.Second
+
+// GetOutput returns the output of the target streamed to clients, see
+// the --stream-output and --pty options of dlv, newer than arg.Since,
+// oldest first. Can be called while the target is running.
+func (s *RPCServer) GetOutput(arg GetOutputIn, cb service.RPCCallback) {
+	var cancel chan struct{}
+	if arg.Wait {
+		cancel = make(chan struct{})
+		t := time.AfterFunc(maxOutputWait, func() { close(cancel) })
+		defer t.Stop()
+	}
+	var out GetOutputOut
+	out.Chunks, out.Closed = s.debugger.Output(arg.Since, cancel)
+	cb.Return(out, nil)
+}
+
+// RuntimeStatsIn holds the arguments of RuntimeStats
+type RuntimeStatsIn struct {
+}
+
+// RuntimeStatsOut holds the return values of RuntimeStats
+type RuntimeStatsOut struct {
+	Stats api.RuntimeStats
+}
+
+// RuntimeStats returns memory and scheduler statistics read from the
+// runtime of the target process. Works with core files.
+func (s *RPCServer) RuntimeStats(arg RuntimeStatsIn, out *RuntimeStatsOut) error {
+	stats, err := s.debugger.RuntimeStats()
+	if err != nil {
+		return err
+	}
+	out.Stats = *stats
+	return nil
+}
+
+// ProfileIn holds the arguments of Profile
+type ProfileIn struct {
+	// Kind is the kind of profile to collect, either "cpu", "heap" or
+	// "cmalloc".
+	Kind string
+	// Duration is the amount of time the target will be resumed for while
+	// collecting a CPU or cmalloc profile, it is ignored for heap profiles.
+	Duration time.Duration
+	// MallocGC also traces the allocations of Go in cmalloc profiles.
+	MallocGC bool
+}
+
+// ProfileOut holds the return values of Profile
+type ProfileOut struct {
+	// Profile in pprof format.
+	Data []byte
+}
+
+// Profile collects a CPU or heap profile of the target.
+// CPU profiles are collected by resuming the target for the requested
+// duration and periodically sampling the stacks of running goroutines, heap
+// profiles are read from the memory profile maintained by the runtime.
+// Cmalloc profiles are heap profiles of the memory allocated by the C
+// library, collected by resuming the target for the requested duration and
+// tracing the calls to malloc and free, see Debugger.ProfileCMalloc.
+func (s *RPCServer) Profile(arg ProfileIn, cb service.RPCCallback) {
+	var out ProfileOut
+	var err error
+	switch arg.Kind {
+	case "cpu":
+		out.Data, err = s.debugger.ProfileCPU(arg.Duration)
+	case "heap":
+		out.Data, err = s.debugger.ProfileHeap()
+	case "cmalloc":
+		out.Data, err = s.debugger.ProfileCMalloc(arg.Duration, arg.MallocGC)
+	default:
+		err = fmt.Errorf("unknown profile kind %q", arg.Kind)
+	}
+	if err != nil {
+		cb.Return(nil, err)
+		return
+	}
+	cb.Return(out, nil)
+}
+
+// StartRuntimeTraceIn holds the arguments of StartRuntimeTrace
+type StartRuntimeTraceIn struct {
+	// Path is the path of the trace file, relative to the working directory
+	// of the debugger if the target runs on the same machine.
+	Path string
+}
+
+// StartRuntimeTraceOut holds the return values of StartRuntimeTrace
+type StartRuntimeTraceOut struct {
+	Trace api.RuntimeTrace
+}
+
+// StartRuntimeTrace starts a runtime execution trace of the target, like
+// runtime/trace.Start, calling functions of the target on the selected
+// goroutine. The stops at breakpoints are logged in the trace until it is
+// stopped with StopRuntimeTrace, if runtime/trace.Log is linked in the
+// target.
+func (s *RPCServer) StartRuntimeTrace(arg StartRuntimeTraceIn, cb service.RPCCallback) {
+	var out StartRuntimeTraceOut
+	trace, err := s.debugger.StartRuntimeTrace(arg.Path)
+	if err != nil {
+		cb.Return(nil, err)
+		return
+	}
+	out.Trace = *trace
+	cb.Return(out, nil)
+}
+
+// StopRuntimeTraceIn holds the arguments of StopRuntimeTrace
+type StopRuntimeTraceIn struct {
+}
+
+// StopRuntimeTraceOut holds the return values of StopRuntimeTrace
+type StopRuntimeTraceOut struct {
+	Trace api.RuntimeTrace
+}
+
+// StopRuntimeTrace stops the runtime execution trace started by
+// StartRuntimeTrace and closes its file.
+func (s *RPCServer) StopRuntimeTrace(arg StopRuntimeTraceIn, cb service.RPCCallback) {
+	var out StopRuntimeTraceOut
+	trace, err := s.debugger.StopRuntimeTrace()
+	if err != nil {
+		cb.Return(nil, err)
+		return
+	}
+	out.Trace = *trace
+	cb.Return(out, nil)
+}
+
+// RecordCallersIn holds the arguments of RecordCallers
+type RecordCallersIn struct {
+	// Function is the name of the function whose callers are recorded.
+	Function string
+	// Duration is the amount of time the target will be resumed for.
+	Duration time.Duration
+}
+
+// RecordCallersOut holds the return values of RecordCallers
+type RecordCallersOut struct {
+	// Stacks are the unique stacks of callers recorded, most frequent
+	// first.
+	Stacks []api.CallerStack
+}
+
+// RecordCallers resumes the target for the requested duration, recording
+// the stack of callers of every call to the requested function.
+// Recording ends early if the target stops at a breakpoint or exits.
+func (s *RPCServer) RecordCallers(arg RecordCallersIn, cb service.RPCCallback) {
+	var out RecordCallersOut
+	var err error
+	out.Stacks, err = s.debugger.RecordCallers(arg.Function, arg.Duration)
+	if err != nil {
+		cb.Return(nil, err)
+		return
+	}
+	cb.Return(out, nil)
+}
+
+// BisectIn holds the arguments of Bisect
+type BisectIn struct {
+	// Predicate is a boolean expression, false at the first iteration and
+	// true at End.
+	Predicate string
+	// Start is the location where every iteration starts.
+	Start string
+	// End is the location where the search ends.
+	End string
+}
+
+// BisectOut holds the return values of Bisect
+type BisectOut struct {
+	Result api.BisectResult
+}
+
+// Bisect finds the statement that makes Predicate true, with a binary
+// search over the iterations executed from Start to End followed by
+// stepping through the iteration found. The target is restarted, or the
+// recording replayed, for every iteration evaluated, it is left stopped
+// after the statement.
+func (s *RPCServer) Bisect(arg BisectIn, cb service.RPCCallback) {
+	var out BisectOut
+	r, err := s.debugger.Bisect(arg.Predicate, arg.Start, arg.End)
+	if err != nil {
+		cb.Return(nil, err)
+		return
+	}
+	out.Result = *r
+	cb.Return(out, nil)
+}
+
+// CreateExprWatchIn holds the arguments of CreateExprWatch
+type CreateExprWatchIn struct {
+	// Expr is the expression watched.
+	Expr string
+	// Locations are the locations where Expr is evaluated, if empty it is
+	// evaluated every time the target stops.
+	Locations []string
+}
+
+// CreateExprWatchOut holds the return values of CreateExprWatch
+type CreateExprWatchOut struct {
+	Watch api.ExprWatch
+}
+
+// CreateExprWatch starts watching the value of an expression, the target
+// stops when it differs from the previous evaluation. The changes are
+// reported in DebuggerState.ExprWatchChanges.
+// The expression is evaluated every time the target stops, including at
+// tracepoints and sample breakpoints, or, if locations are specified, by
+// breakpoints named "watch<ID>" on them that do not stop the target unless
+// the value changed.
+func (s *RPCServer) CreateExprWatch(arg CreateExprWatchIn, out *CreateExprWatchOut) error {
+	w, err := s.debugger.CreateExprWatch(arg.Expr, arg.Locations)
+	if err != nil {
+		return err
+	}
+	out.Watch = *w
+	return nil
+}
+
+// ListExprWatchesIn holds the arguments of ListExprWatches
+type ListExprWatchesIn struct {
+}
+
+// ListExprWatchesOut holds the return values of ListExprWatches
+type ListExprWatchesOut struct {
+	Watches []api.ExprWatch
+}
+
+// ListExprWatches returns the watched expressions.
+func (s *RPCServer) ListExprWatches(arg ListExprWatchesIn, out *ListExprWatchesOut) error {
+	out.Watches = s.debugger.ExprWatches()
+	return nil
+}
+
+// ClearExprWatchIn holds the arguments of ClearExprWatch
+type ClearExprWatchIn struct {
+	ID int
+}
+
+// ClearExprWatchOut holds the return values of ClearExprWatch
+type ClearExprWatchOut struct {
+}
+
+// ClearExprWatch stops watching the expression with the specified ID,
+// clearing its breakpoints.
+func (s *RPCServer) ClearExprWatch(arg ClearExprWatchIn, out *ClearExprWatchOut) error {
+	return s.debugger.ClearExprWatch(arg.ID)
+}
+
+// CatchSyscallsIn holds the arguments of CatchSyscalls
+type CatchSyscallsIn struct {
+	Syscalls []string
+}
+
+// CatchSyscallsOut holds the return values of CatchSyscalls
+type CatchSyscallsOut struct {
+	Syscalls []string
+}
+
+// CatchSyscalls makes the target stop every time one of its threads
+// enters or returns from one of the system calls in arg.Syscalls,
+// replacing the system calls caught before. An empty list stops catching
+// system calls. The thread that stopped is the current thread, the system
+// call is in the Syscall field of the thread in the state returned by
+// Command.
+// Only supported by the native backend on linux, every system call made by
+// the target is traced while any is caught.
+func (s *RPCServer) CatchSyscalls(arg CatchSyscallsIn, out *CatchSyscallsOut) error {
+	syscalls, err := s.debugger.CatchSyscalls(arg.Syscalls)
+	if err != nil {
+		return err
+	}
+	out.Syscalls = syscalls
+	return nil
+}
+
+// ListCaughtSyscallsIn holds the arguments of ListCaughtSyscalls
+type ListCaughtSyscallsIn struct {
+}
+
+// ListCaughtSyscallsOut holds the return values of ListCaughtSyscalls
+type ListCaughtSyscallsOut struct {
+	Syscalls []string
+}
+
+// ListCaughtSyscalls returns the system calls caught, see CatchSyscalls.
+func (s *RPCServer) ListCaughtSyscalls(arg ListCaughtSyscallsIn, out *ListCaughtSyscallsOut) error {
+	out.Syscalls = s.debugger.CaughtSyscalls()
+	return nil
+}
+
+// CreateCatchpointIn holds the arguments of CreateCatchpoint
+type CreateCatchpointIn struct {
+	Kind    string
+	Pattern string
+}
+
+// CreateCatchpointOut holds the return values of CreateCatchpoint
+type CreateCatchpointOut struct {
+	Breakpoints []*api.Breakpoint
+}
+
+// CreateCatchpoint creates the breakpoints stopping the target when it
+// opens a file whose name matches arg.Pattern (Kind "open"), dials a
+// network address matching it (Kind "dial"), or sends an HTTP request to a
+// URL matching it, without its query (Kind "http").
+// The pattern is matched by the glob builtin of expressions, where '*'
+// matches any sequence of characters, including '/', and '?' any
+// character. The breakpoints are on the functions of the standard library
+// that perform the activity in the version of Go used to build the target
+// and are deleted like any other breakpoint.
+func (s *RPCServer) CreateCatchpoint(arg CreateCatchpointIn, out *CreateCatchpointOut) error {
+	bps, err := s.debugger.CreateCatchpoint(arg.Kind, arg.Pattern)
+	if err != nil {
+		return err
+	}
+	out.Breakpoints = bps
+	return nil
+}
+
+// CreateHTTPBreakpointIn holds the arguments of CreateHTTPBreakpoint
+type CreateHTTPBreakpointIn struct {
+	Filter api.HTTPRequestFilter
+}
+
+// CreateHTTPBreakpointOut holds the return values of CreateHTTPBreakpoint
+type CreateHTTPBreakpointOut struct {
+	Breakpoints []*api.Breakpoint
+}
+
+// CreateHTTPBreakpoint creates the breakpoints stopping the target when it
+// starts serving an HTTP request matching arg.Filter with a net/http
+// server, whatever the router. The target stops in net/http before the
+// handlers of the program are called, the request is the variable req.
+func (s *RPCServer) CreateHTTPBreakpoint(arg CreateHTTPBreakpointIn, out *CreateHTTPBreakpointOut) error {
+	bps, err := s.debugger.CreateHTTPBreakpoint(arg.Filter)
+	if err != nil {
+		return err
+	}
+	out.Breakpoints = bps
+	return nil
+}
+
+// CreateGRPCBreakpointIn holds the arguments of CreateGRPCBreakpoint
+type CreateGRPCBreakpointIn struct {
+	Filter api.GRPCRequestFilter
+}
+
+// CreateGRPCBreakpointOut holds the return values of CreateGRPCBreakpoint
+type CreateGRPCBreakpointOut struct {
+	Breakpoints []*api.Breakpoint
+}
+
+// CreateGRPCBreakpoint creates the breakpoints stopping the target when it
+// starts serving a gRPC call matching arg.Filter with a server of
+// google.golang.org/grpc. The target stops in the grpc package before the
+// interceptors and the handlers of the program are called, the stream of
+// the call is the variable stream.
+func (s *RPCServer) CreateGRPCBreakpoint(arg CreateGRPCBreakpointIn, out *CreateGRPCBreakpointOut) error {
+	bps, err := s.debugger.CreateGRPCBreakpoint(arg.Filter)
+	if err != nil {
+		return err
+	}
+	out.Breakpoints = bps
+	return nil
+}
+
+// CreateFinalizerBreakpointIn holds the arguments of
+// CreateFinalizerBreakpoint
+type CreateFinalizerBreakpointIn struct {
+	Type string
+}
+
+// CreateFinalizerBreakpointOut holds the return values of
+// CreateFinalizerBreakpoint
+type CreateFinalizerBreakpointOut struct {
+	Breakpoints []*api.Breakpoint
+}
+
+// CreateFinalizerBreakpoint creates the breakpoints stopping the target
+// when the finalizer goroutine runs a finalizer of an object of type
+// arg.Type, a breakpoint on each of the functions already set as the
+// finalizer of such an object.
+func (s *RPCServer) CreateFinalizerBreakpoint(arg CreateFinalizerBreakpointIn, out *CreateFinalizerBreakpointOut) error {
+	bps, err := s.debugger.CreateFinalizerBreakpoint(arg.Type)
+	if err != nil {
+		return err
+	}
+	out.Breakpoints = bps
+	return nil
+}
+
+// ListTargetsIn holds the arguments of ListTargets
+type ListTargetsIn struct {
+}
+
+// ListTargetsOut holds the return values of ListTargets
+type ListTargetsOut struct {
+	Targets []api.Target
+}
+
+// ListTargets returns the target of the debugger followed by its child
+// processes debugged by other instances of Delve, started when child
+// processes are followed.
+func (s *RPCServer) ListTargets(arg ListTargetsIn, out *ListTargetsOut) error {
+	out.Targets = s.debugger.Targets()
+	return nil
+}
+
 type StopRecordingIn struct {
 }
 
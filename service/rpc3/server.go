@@ -0,0 +1,419 @@
+// Package rpc3 implements a draft of version 3 of the JSON-RPC API.
+//
+// APIv3 addresses limitations of APIv2 that can not be fixed without
+// changing its types: list endpoints return a cursor to continue from,
+// state changes are pushed to clients through Events, the load
+// configuration used when a request does not specify one can be read with
+// APIInfo and changed with SetDefaultLoadConfig, and the API itself has a
+// semantic version.
+//
+// RPCServer embeds the APIv2 server, so that all APIv2 methods are also
+// served by APIv3. Methods redefined by APIv3 accept the arguments of
+// their APIv2 counterparts and return a superset of their results, an
+// APIv2 client can therefore select APIv3 without changes.
+//
+// This API is a draft, its types may still change in incompatible ways
+// until Version loses its pre-release suffix.
+package rpc3
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-delve/delve/service"
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/debugger"
+	"github.com/go-delve/delve/service/rpc2"
+)
+
+// Version is the semantic version of APIv3. The major version changes
+// when a type or method changes incompatibly, the minor version when
+// methods or fields are added.
+const Version = "3.0.0-draft"
+
+// maxEvents is the number of events kept for clients that call Events.
+const maxEvents = 256
+
+// maxEventsWait is the maximum time Events waits for an event, so that the
+// calls of clients that disconnected do not wait forever.
+const maxEventsWait = time.Minute
+
+type RPCServer struct {
+	*rpc2.RPCServer
+
+	// config is all the information necessary to start the debugger and server.
+	config *service.Config
+	// debugger is a debugger service.
+	debugger *debugger.Debugger
+
+	cfgMu sync.Mutex
+	// defaultCfg is the load configuration of requests without one.
+	defaultCfg api.LoadConfig
+
+	events eventLog
+}
+
+func NewServer(config *service.Config, debugger *debugger.Debugger, s2 *rpc2.RPCServer) *RPCServer {
+	return &RPCServer{
+		RPCServer:  s2,
+		config:     config,
+		debugger:   debugger,
+		defaultCfg: api.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1},
+		events:     eventLog{changed: make(chan struct{})},
+	}
+}
+
+type APIInfoIn struct {
+}
+
+type APIInfoOut struct {
+	// Version is the semantic version of the API, see Version.
+	Version             string
+	Major, Minor, Patch int
+	// Draft is true while the API can still change incompatibly.
+	Draft bool
+	// DefaultLoadConfig is the load configuration used by Eval and by
+	// Stacktrace with Full set when they do not specify one.
+	DefaultLoadConfig api.LoadConfig
+}
+
+// APIInfo returns the version of the API and the defaults used by the server.
+func (s *RPCServer) APIInfo(arg APIInfoIn, out *APIInfoOut) error {
+	out.Version = Version
+	out.Major, out.Minor, out.Patch = 3, 0, 0
+	out.Draft = true
+	out.DefaultLoadConfig = s.loadConfig(nil)
+	return nil
+}
+
+type SetDefaultLoadConfigIn struct {
+	Cfg api.LoadConfig
+}
+
+type SetDefaultLoadConfigOut struct {
+}
+
+// SetDefaultLoadConfig changes the load configuration used by requests
+// that do not specify one, for all clients.
+func (s *RPCServer) SetDefaultLoadConfig(arg SetDefaultLoadConfigIn, out *SetDefaultLoadConfigOut) error {
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	s.defaultCfg = arg.Cfg
+	return nil
+}
+
+// loadConfig returns cfg, or the default load configuration if cfg is nil.
+func (s *RPCServer) loadConfig(cfg *api.LoadConfig) api.LoadConfig {
+	if cfg != nil {
+		return *cfg
+	}
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	return s.defaultCfg
+}
+
+// Eval is rpc2.RPCServer.Eval using the default load configuration when
+// arg.Cfg is nil.
+func (s *RPCServer) Eval(arg rpc2.EvalIn, cb service.RPCCallback) {
+	cfg := s.loadConfig(arg.Cfg)
+	arg.Cfg = &cfg
+	s.RPCServer.Eval(arg, cb)
+}
+
+// Stacktrace is rpc2.RPCServer.Stacktrace using the default load
+// configuration when arg.Full is set and arg.Cfg is nil.
+func (s *RPCServer) Stacktrace(arg rpc2.StacktraceIn, cb service.RPCCallback) {
+	if arg.Full && arg.Cfg == nil {
+		cfg := s.loadConfig(nil)
+		arg.Cfg = &cfg
+	}
+	s.RPCServer.Stacktrace(arg, cb)
+}
+
+// Pagination
+//
+// List methods accept a Cursor and a Limit. A call without a Cursor
+// starts from the beginning of the list and a call with a Limit returns
+// at most Limit items, and in Next a cursor to pass to the following
+// call, or the empty string if there are no more items. Cursors are
+// opaque to clients. A call without a Limit returns all the remaining
+// items, like the APIv2 method.
+
+// decodeCursor returns the position encoded in cursor.
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(cursor)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return n, nil
+}
+
+// page returns the items of a list of length n selected by cursor and limit,
+// as a range of indexes, and the cursor of the next page.
+func page(n int, cursor string, limit int) (start, end int, next string, err error) {
+	start, err = decodeCursor(cursor)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if start > n {
+		start = n
+	}
+	end = n
+	if limit > 0 && start+limit < n {
+		end = start + limit
+		next = strconv.Itoa(end)
+	}
+	return start, end, next, nil
+}
+
+type ListSourcesIn struct {
+	Filter string
+	Cursor string
+	Limit  int
+}
+
+type ListSourcesOut struct {
+	Sources []string
+	Next    string
+}
+
+// ListSources lists the source files in the process matching filter.
+func (s *RPCServer) ListSources(arg ListSourcesIn, out *ListSourcesOut) error {
+	ss, err := s.debugger.Sources(arg.Filter)
+	if err != nil {
+		return err
+	}
+	start, end, next, err := page(len(ss), arg.Cursor, arg.Limit)
+	if err != nil {
+		return err
+	}
+	out.Sources, out.Next = ss[start:end], next
+	return nil
+}
+
+type ListFunctionsIn struct {
+	Filter string
+	Cursor string
+	Limit  int
+}
+
+type ListFunctionsOut struct {
+	Funcs []string
+	Next  string
+}
+
+// ListFunctions lists the functions in the process matching filter.
+func (s *RPCServer) ListFunctions(arg ListFunctionsIn, out *ListFunctionsOut) error {
+	fns, err := s.debugger.Functions(arg.Filter)
+	if err != nil {
+		return err
+	}
+	start, end, next, err := page(len(fns), arg.Cursor, arg.Limit)
+	if err != nil {
+		return err
+	}
+	out.Funcs, out.Next = fns[start:end], next
+	return nil
+}
+
+type ListTypesIn struct {
+	Filter string
+	Cursor string
+	Limit  int
+}
+
+type ListTypesOut struct {
+	Types []string
+	Next  string
+}
+
+// ListTypes lists the types in the process matching filter.
+func (s *RPCServer) ListTypes(arg ListTypesIn, out *ListTypesOut) error {
+	tps, err := s.debugger.Types(arg.Filter)
+	if err != nil {
+		return err
+	}
+	start, end, next, err := page(len(tps), arg.Cursor, arg.Limit)
+	if err != nil {
+		return err
+	}
+	out.Types, out.Next = tps[start:end], next
+	return nil
+}
+
+type ListGoroutinesIn struct {
+	// Start and Count are the APIv2 arguments, Cursor and Limit take
+	// precedence when they are set.
+	Start int
+	Count int
+
+	Cursor string
+	Limit  int
+}
+
+type ListGoroutinesOut struct {
+	Goroutines []*api.Goroutine
+	Nextg      int
+	Next       string
+}
+
+// ListGoroutines lists the goroutines of the process.
+//
+// Goroutines that start or exit between two calls may be listed twice or
+// not at all.
+func (s *RPCServer) ListGoroutines(arg ListGoroutinesIn, out *ListGoroutinesOut) error {
+	start, count := arg.Start, arg.Count
+	if arg.Cursor != "" {
+		var err error
+		if start, err = decodeCursor(arg.Cursor); err != nil {
+			return err
+		}
+	}
+	if arg.Limit > 0 {
+		count = arg.Limit
+	}
+	gs, nextg, err := s.debugger.Goroutines(start, count)
+	if err != nil {
+		return err
+	}
+	out.Goroutines, out.Nextg = gs, nextg
+	if nextg > 0 {
+		out.Next = strconv.Itoa(nextg)
+	}
+	return nil
+}
+
+// Events
+//
+// Instead of waiting for the response to Command, clients can follow the
+// state of the target by calling Events repeatedly, each time with the
+// sequence number of the last event received. Every client sees every
+// event, including the ones caused by other clients.
+
+// Event kinds.
+const (
+	EventRunning = "running"
+	EventStopped = "stopped"
+	EventExited  = "exited"
+)
+
+// Event is a change of the state of the target.
+type Event struct {
+	// Seq is the sequence number of the event, starting at 1.
+	Seq  uint64
+	Kind string
+	// Command is the name of the command that caused the event.
+	Command string
+	// State is the state of the target after a stopped or exited event.
+	State *api.DebuggerState `json:",omitempty"`
+	// Err is the error returned by the command, if any.
+	Err string `json:",omitempty"`
+}
+
+// eventLog keeps the last maxEvents events.
+type eventLog struct {
+	mu     sync.Mutex
+	seq    uint64
+	events []Event
+	// changed is closed and replaced when an event is published.
+	changed chan struct{}
+}
+
+func (l *eventLog) publish(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	e.Seq = l.seq
+	l.events = append(l.events, e)
+	if len(l.events) > maxEvents {
+		l.events = l.events[len(l.events)-maxEvents:]
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// since returns the events after seq, whether events after seq were
+// discarded, and a channel closed when a new event is published.
+func (l *eventLog) since(seq uint64) (events []Event, dropped bool, changed <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.events {
+		if e.Seq > seq {
+			events = append(events, e)
+		}
+	}
+	dropped = len(l.events) > 0 && l.events[0].Seq > seq+1
+	return events, dropped, l.changed
+}
+
+type EventsIn struct {
+	// After is the sequence number of the last event received, zero for
+	// the first call.
+	After uint64
+	// Timeout is the maximum number of milliseconds to wait for an event.
+	// The server waits at most a minute, also if Timeout is zero or larger:
+	// clients waiting for longer call Events again.
+	Timeout int
+}
+
+type EventsOut struct {
+	Events []Event
+	// Dropped is true if some events after After were discarded because
+	// the client did not call Events in time.
+	Dropped bool
+}
+
+// Events returns the events published after arg.After, waiting until
+// there is at least one or arg.Timeout expires. No events are returned
+// if the timeout expires.
+func (s *RPCServer) Events(arg EventsIn, cb service.RPCCallback) {
+	wait := maxEventsWait
+	if arg.Timeout > 0 && time.Duration(arg.Timeout) < maxEventsWait/time.Millisecond {
+		wait = time.Duration(arg.Timeout) * time.Millisecond
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		events, dropped, changed := s.events.since(arg.After)
+		if len(events) > 0 || dropped {
+			cb.Return(EventsOut{Events: events, Dropped: dropped}, nil)
+			return
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			cb.Return(EventsOut{}, nil)
+			return
+		}
+	}
+}
+
+// Command is rpc2.RPCServer.Command, it also publishes the resulting
+// changes of state, see Events. Halt publishes nothing, the command it
+// interrupts publishes the stopped event.
+func (s *RPCServer) Command(command api.DebuggerCommand, cb service.RPCCallback) {
+	if command.Name == api.Halt {
+		s.RPCServer.Command(command, cb)
+		return
+	}
+	s.events.publish(Event{Kind: EventRunning, Command: command.Name})
+	st, err := s.debugger.Command(&command)
+	e := Event{Kind: EventStopped, Command: command.Name, State: st}
+	if err != nil {
+		e.Err = err.Error()
+	}
+	if st != nil && st.Exited {
+		e.Kind = EventExited
+	}
+	s.events.publish(e)
+	if err != nil {
+		cb.Return(nil, err)
+		return
+	}
+	cb.Return(rpc2.CommandOut{State: *st}, nil)
+}
@@ -0,0 +1,258 @@
+// Package rpccodec implements the encodings and the compression of the
+// messages between the JSON-RPC server and its clients, negotiated with
+// RPCServer.SetEncoding (see api.SetEncodingIn).
+//
+// The codecs of this package send the code of errors (see api.ErrorCode)
+// in a separate field of the responses, next to their message. Clients
+// receive it by calling with CodeArgs.
+package rpccodec
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/rpc"
+	"sync"
+)
+
+// SetEncodingMethod is the method switching the encoding of a connection.
+const SetEncodingMethod = "RPCServer.SetEncoding"
+
+// Encodings of the messages.
+const (
+	EncodingJSON = "json"
+	EncodingGob  = "gob"
+)
+
+// Compressions of the messages.
+const (
+	CompressionNone  = ""
+	CompressionFlate = "flate"
+)
+
+// Check returns an error if encoding or compression are not supported.
+func Check(encoding, compression string) error {
+	switch encoding {
+	case "", EncodingJSON, EncodingGob:
+	default:
+		return fmt.Errorf("unknown encoding %q", encoding)
+	}
+	switch compression {
+	case CompressionNone, CompressionFlate:
+	default:
+		return fmt.Errorf("unknown compression %q", compression)
+	}
+	return nil
+}
+
+// NewServerCodec returns the server codec for conn using encoding and
+// compression.
+func NewServerCodec(conn io.ReadWriteCloser, encoding, compression string) (rpc.ServerCodec, error) {
+	if err := Check(encoding, compression); err != nil {
+		return nil, err
+	}
+	conn = compress(conn, compression)
+	if encoding == EncodingGob {
+		buf := bufio.NewWriter(conn)
+		return &gobServerCodec{rwc: conn, dec: gob.NewDecoder(conn), enc: gob.NewEncoder(buf), encBuf: buf}, nil
+	}
+	return newJSONServerCodec(conn), nil
+}
+
+// NewClientCodec returns the client codec for conn using encoding and
+// compression.
+func NewClientCodec(conn io.ReadWriteCloser, encoding, compression string) (rpc.ClientCodec, error) {
+	if err := Check(encoding, compression); err != nil {
+		return nil, err
+	}
+	conn = compress(conn, compression)
+	if encoding == EncodingGob {
+		buf := bufio.NewWriter(conn)
+		return &gobClientCodec{rwc: conn, dec: gob.NewDecoder(conn), enc: gob.NewEncoder(buf), encBuf: buf}, nil
+	}
+	return newJSONClientCodec(conn), nil
+}
+
+// ErrorCodeWriter is implemented by the server codecs of this package.
+type ErrorCodeWriter interface {
+	// WriteResponseCode is like WriteResponse, also sending the code of
+	// the error of r.
+	WriteResponseCode(r *rpc.Response, code string, body interface{}) error
+}
+
+// CodeArgs wraps the arguments of a call made by an rpc.Client using one
+// of the client codecs of this package, to receive the code of the error
+// of the response. The request is sent with Args as its arguments.
+type CodeArgs struct {
+	Args interface{}
+	// Code is set to the code of the error of the response before the call
+	// returns, it is empty if the server did not send one.
+	Code string
+}
+
+// codeArgsMap are the CodeArgs of the requests waiting for a response.
+type codeArgsMap struct {
+	mu sync.Mutex
+	m  map[uint64]*CodeArgs
+}
+
+// unwrap returns the arguments to send for the request seq, remembering
+// them if they are CodeArgs.
+func (cm *codeArgsMap) unwrap(seq uint64, args interface{}) interface{} {
+	ca, ok := args.(*CodeArgs)
+	if !ok {
+		return args
+	}
+	cm.mu.Lock()
+	if cm.m == nil {
+		cm.m = make(map[uint64]*CodeArgs)
+	}
+	cm.m[seq] = ca
+	cm.mu.Unlock()
+	return ca.Args
+}
+
+// setCode sets the code of the CodeArgs of the request seq, which received
+// its response.
+func (cm *codeArgsMap) setCode(seq uint64, code string) {
+	cm.mu.Lock()
+	ca := cm.m[seq]
+	delete(cm.m, seq)
+	cm.mu.Unlock()
+	if ca != nil {
+		ca.Code = code
+	}
+}
+
+func compress(conn io.ReadWriteCloser, compression string) io.ReadWriteCloser {
+	if compression != CompressionFlate {
+		return conn
+	}
+	w, _ := flate.NewWriter(conn, flate.DefaultCompression)
+	return &flateConn{conn: conn, r: flate.NewReader(conn), w: w}
+}
+
+// flateConn compresses the data written to conn and decompresses the data
+// read from it. Every write is flushed, so that each message can be
+// decoded as soon as it is received.
+type flateConn struct {
+	conn io.ReadWriteCloser
+	r    io.ReadCloser
+	w    *flate.Writer
+}
+
+func (c *flateConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *flateConn) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
+
+func (c *flateConn) Close() error {
+	c.r.Close()
+	return c.conn.Close()
+}
+
+// gobServerCodec and gobClientCodec are the codecs of net/rpc, writing
+// each message with a single write and sending gobResponse instead of
+// rpc.Response.
+
+type gobResponse struct {
+	ServiceMethod string
+	Seq           uint64
+	Error         string
+	Code          string
+}
+
+type gobServerCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+}
+
+func (c *gobServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+func (c *gobServerCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *gobServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	return c.WriteResponseCode(r, "", body)
+}
+
+func (c *gobServerCodec) WriteResponseCode(r *rpc.Response, code string, body interface{}) (err error) {
+	if err = c.enc.Encode(&gobResponse{ServiceMethod: r.ServiceMethod, Seq: r.Seq, Error: r.Error, Code: code}); err != nil {
+		if c.encBuf.Flush() == nil {
+			// gob couldn't encode the header, which should not happen, close
+			// the connection to signal that it is broken
+			c.Close()
+		}
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			// the header was written but not the body, the connection is
+			// broken
+			c.Close()
+		}
+		return
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobServerCodec) Close() error {
+	if c.closed {
+		// Only call c.rwc.Close once; otherwise the semantics are undefined.
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
+
+type gobClientCodec struct {
+	rwc      io.ReadWriteCloser
+	dec      *gob.Decoder
+	enc      *gob.Encoder
+	encBuf   *bufio.Writer
+	codeArgs codeArgsMap
+}
+
+func (c *gobClientCodec) WriteRequest(r *rpc.Request, body interface{}) (err error) {
+	body = c.codeArgs.unwrap(r.Seq, body)
+	if err = c.enc.Encode(r); err != nil {
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		return
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	var resp gobResponse
+	if err := c.dec.Decode(&resp); err != nil {
+		return err
+	}
+	*r = rpc.Response{ServiceMethod: resp.ServiceMethod, Seq: resp.Seq, Error: resp.Error}
+	c.codeArgs.setCode(resp.Seq, resp.Code)
+	return nil
+}
+
+func (c *gobClientCodec) ReadResponseBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *gobClientCodec) Close() error {
+	return c.rwc.Close()
+}
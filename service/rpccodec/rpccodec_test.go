@@ -0,0 +1,113 @@
+package rpccodec
+
+import (
+	"net"
+	"net/rpc"
+	"strings"
+	"testing"
+)
+
+type echoService struct{}
+
+type EchoIn struct {
+	Text  string
+	Count int
+}
+
+type EchoOut struct {
+	Texts []string
+}
+
+func (echoService) Echo(in EchoIn, out *EchoOut) error {
+	for i := 0; i < in.Count; i++ {
+		out.Texts = append(out.Texts, in.Text)
+	}
+	return nil
+}
+
+func TestCodecs(t *testing.T) {
+	for _, encoding := range []string{EncodingJSON, EncodingGob} {
+		for _, compression := range []string{CompressionNone, CompressionFlate} {
+			name := encoding + "/" + compression
+			if compression == CompressionNone {
+				name += "none"
+			}
+			t.Run(name, func(t *testing.T) {
+				server := rpc.NewServer()
+				server.RegisterName("Echo", echoService{})
+				conn0, conn1 := net.Pipe()
+				scodec, err := NewServerCodec(conn0, encoding, compression)
+				if err != nil {
+					t.Fatal(err)
+				}
+				go server.ServeCodec(scodec)
+				ccodec, err := NewClientCodec(conn1, encoding, compression)
+				if err != nil {
+					t.Fatal(err)
+				}
+				client := rpc.NewClientWithCodec(ccodec)
+				defer client.Close()
+
+				// every message must be received without waiting for the next one
+				for i := 1; i <= 3; i++ {
+					var out EchoOut
+					if err := client.Call("Echo.Echo", EchoIn{Text: strings.Repeat("x", 100*i), Count: i}, &out); err != nil {
+						t.Fatal(err)
+					}
+					if len(out.Texts) != i || out.Texts[0] != strings.Repeat("x", 100*i) {
+						t.Fatalf("wrong reply %d: %v", i, out)
+					}
+				}
+				args := &CodeArgs{Args: EchoIn{}}
+				if err := client.Call("Echo.Missing", args, &EchoOut{}); err == nil {
+					t.Fatal("expected an error calling a missing method")
+				}
+				if args.Code != "" {
+					t.Errorf("unexpected code %q", args.Code)
+				}
+			})
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check("", ""); err != nil {
+		t.Error(err)
+	}
+	if err := Check("xml", ""); err == nil {
+		t.Error("expected an error for an unknown encoding")
+	}
+	if err := Check(EncodingGob, "zstd"); err == nil {
+		t.Error("expected an error for an unknown compression")
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	for _, encoding := range []string{EncodingJSON, EncodingGob} {
+		t.Run(encoding, func(t *testing.T) {
+			conn0, conn1 := net.Pipe()
+			scodec, _ := NewServerCodec(conn0, encoding, CompressionNone)
+			go func() {
+				var req rpc.Request
+				if err := scodec.ReadRequestHeader(&req); err != nil {
+					return
+				}
+				scodec.ReadRequestBody(&EchoIn{})
+				resp := &rpc.Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq, Error: "nothing to echo"}
+				scodec.(ErrorCodeWriter).WriteResponseCode(resp, "NothingToEcho", struct{}{})
+			}()
+			ccodec, _ := NewClientCodec(conn1, encoding, CompressionNone)
+			client := rpc.NewClientWithCodec(ccodec)
+			defer client.Close()
+
+			args := &CodeArgs{Args: EchoIn{}}
+			err := client.Call("Echo.Echo", args, &EchoOut{})
+			if err != rpc.ServerError("nothing to echo") {
+				t.Fatalf("wrong error %#v", err)
+			}
+			if args.Code != "NothingToEcho" {
+				t.Errorf("wrong code %q", args.Code)
+			}
+		})
+	}
+}
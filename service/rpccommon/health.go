@@ -0,0 +1,134 @@
+package rpccommon
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-delve/delve/pkg/version"
+	"github.com/go-delve/delve/service/metrics"
+)
+
+// This file implements the HTTP endpoint enabled by Config.MetricsAddr,
+// which allows monitoring long-lived headless servers:
+//
+//	/healthz  responds "ok" while the server is alive
+//	/status   describes the target and the connected clients, as JSON
+//	/metrics  exposes the metrics of the server to Prometheus
+//
+// Like the connections to the API, with Config.CheckLocalConnUser the
+// requests to /status from a loopback address are only served to the
+// user that started the server. /healthz and /metrics do not describe the
+// target and are served to everybody.
+
+// client is a connected client of the API.
+type client struct {
+	RemoteAddr  string
+	ConnectedAt time.Time
+}
+
+// healthStatus is the response to /status.
+type healthStatus struct {
+	DelveVersion string
+	APIVersion   int
+	Target       targetStatus
+	Clients      []client
+}
+
+type targetStatus struct {
+	Running    bool
+	Recording  bool
+	Exited     bool
+	ExitStatus int
+	Err        string `json:",omitempty"`
+}
+
+// addClient registers a client connection with conn, it returns a
+// function to call when the connection is closed.
+func (s *ServerImpl) addClient(conn io.ReadWriteCloser) func() {
+	c := &client{RemoteAddr: remoteAddr(conn), ConnectedAt: time.Now()}
+	s.clientsMu.Lock()
+	s.clients[c] = struct{}{}
+	s.clientsMu.Unlock()
+	return func() {
+		s.clientsMu.Lock()
+		delete(s.clients, c)
+		s.clientsMu.Unlock()
+	}
+}
+
+// remoteAddr returns the address of the client connected to conn, if known.
+func remoteAddr(conn io.ReadWriteCloser) string {
+	if netconn, ok := conn.(net.Conn); ok {
+		return netconn.RemoteAddr().String()
+	}
+	return ""
+}
+
+func (s *ServerImpl) connectedClients() []client {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	r := make([]client, 0, len(s.clients))
+	for c := range s.clients {
+		r = append(r, *c)
+	}
+	return r
+}
+
+// serveHealth serves the health endpoint until Stop closes its listener.
+func (s *ServerImpl) serveHealth() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if !s.canAcceptStatus(r) {
+			http.Error(w, "status requests to localhost are only accepted from the same UNIX user", http.StatusForbidden)
+			return
+		}
+		st := healthStatus{
+			DelveVersion: version.DelveVersion.String(),
+			APIVersion:   s.config.APIVersion,
+			Clients:      s.connectedClients(),
+		}
+		// does not wait for the target to stop if it is running
+		state, err := s.debugger.State(true)
+		if err != nil {
+			st.Target.Err = err.Error()
+		} else {
+			st.Target = targetStatus{Running: state.Running, Recording: state.Recording, Exited: state.Exited, ExitStatus: state.ExitStatus}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(st)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.WriteTo(w,
+			metrics.NewGauge("dlv_connected_clients", "Number of connected clients.", func() float64 {
+				s.clientsMu.Lock()
+				defer s.clientsMu.Unlock()
+				return float64(len(s.clients))
+			}),
+			metrics.NewGauge("dlv_uptime_seconds", "Time since the server started.", func() float64 {
+				return time.Since(s.started).Seconds()
+			}))
+	})
+	s.log.Infof("health endpoint listening at: %s", s.healthListener.Addr())
+	err := http.Serve(s.healthListener, mux)
+	s.log.Debugf("health endpoint stopped: %v", err)
+}
+
+// canAcceptStatus returns false if r is a request from a different user
+// that must not be served, see CheckLocalConnUser.
+func (s *ServerImpl) canAcceptStatus(r *http.Request) bool {
+	if !s.config.CheckLocalConnUser {
+		return true
+	}
+	raddr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	return canAccept(s.healthListener.Addr(), raddr)
+}
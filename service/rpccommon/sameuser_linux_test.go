@@ -4,7 +4,10 @@ package rpccommon
 
 import (
 	"net"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/go-delve/delve/service"
 )
 
 func TestSameUserForRemoteAddr(t *testing.T) {
@@ -62,3 +65,36 @@ func TestSameUserForRemoteAddr(t *testing.T) {
 		})
 	}
 }
+
+func TestCanAcceptStatus(t *testing.T) {
+	uid = 149098
+	readFile = func(string) ([]byte, error) {
+		return []byte(`  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+  21: 0100007F:E682 0100007F:0FC8 01 00000000:00000000 00:00000000 00000000 149098        0 8420541 2 0000000000000000 20 0 0 10 -1                  `), nil
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	s := &ServerImpl{config: &service.Config{CheckLocalConnUser: true}, healthListener: listener}
+	for _, tt := range []struct {
+		remoteAddr string
+		want       bool
+	}{
+		{"127.0.0.1:59010", true},
+		{"127.0.0.1:2342", false},
+	} {
+		r := httptest.NewRequest("GET", "/status", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if got := s.canAcceptStatus(r); got != tt.want {
+			t.Errorf("canAcceptStatus(%s) = %v, want %v", tt.remoteAddr, got, tt.want)
+		}
+	}
+	s.config.CheckLocalConnUser = false
+	r := httptest.NewRequest("GET", "/status", nil)
+	r.RemoteAddr = "127.0.0.1:2342"
+	if !s.canAcceptStatus(r) {
+		t.Errorf("canAcceptStatus(%s) = false without CheckLocalConnUser", r.RemoteAddr)
+	}
+}
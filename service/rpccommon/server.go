@@ -7,21 +7,27 @@ import (
 	"io"
 	"net"
 	"net/rpc"
-	"net/rpc/jsonrpc"
 	"os"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/go-delve/delve/pkg/logflags"
+	"github.com/go-delve/delve/pkg/proc"
 	"github.com/go-delve/delve/pkg/version"
 	"github.com/go-delve/delve/service"
 	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/audit"
 	"github.com/go-delve/delve/service/debugger"
+	"github.com/go-delve/delve/service/metrics"
 	"github.com/go-delve/delve/service/rpc1"
 	"github.com/go-delve/delve/service/rpc2"
+	"github.com/go-delve/delve/service/rpc3"
+	"github.com/go-delve/delve/service/rpccodec"
 	"github.com/sirupsen/logrus"
 )
 
@@ -40,9 +46,19 @@ type ServerImpl struct {
 	s1 *rpc1.RPCServer
 	// s2 is APIv2 server.
 	s2 *rpc2.RPCServer
+	// s3 is the draft APIv3 server.
+	s3 *rpc3.RPCServer
 	// maps of served methods, one for each supported API.
 	methodMaps []map[string]*methodType
 	log        *logrus.Entry
+
+	// started is when Run was called.
+	started time.Time
+	// healthListener serves the health endpoint, see Config.MetricsAddr.
+	healthListener net.Listener
+	// clients is the set of connected clients.
+	clientsMu sync.Mutex
+	clients   map[*client]struct{}
 }
 
 type RPCCallback struct {
@@ -50,6 +66,7 @@ type RPCCallback struct {
 	sending *sync.Mutex
 	codec   rpc.ServerCodec
 	req     rpc.Request
+	start   time.Time
 }
 
 // RPCServer implements the RPC method calls common to all versions of the API.
@@ -81,6 +98,7 @@ func NewServer(config *service.Config) *ServerImpl {
 		listener: config.Listener,
 		stopChan: make(chan struct{}),
 		log:      logger,
+		clients:  make(map[*client]struct{}),
 	}
 }
 
@@ -90,6 +108,9 @@ func (s *ServerImpl) Stop() error {
 		close(s.stopChan)
 		s.listener.Close()
 	}
+	if s.healthListener != nil {
+		s.healthListener.Close()
+	}
 	kill := s.config.Debugger.AttachPid == 0
 	return s.debugger.Detach(kill)
 }
@@ -103,29 +124,47 @@ func (s *ServerImpl) Run() error {
 	if s.config.APIVersion < 2 {
 		s.config.APIVersion = 1
 	}
-	if s.config.APIVersion > 2 {
+	if s.config.APIVersion > 3 {
 		return fmt.Errorf("unknown API version")
 	}
+	s.started = time.Now()
+
+	if s.config.MetricsAddr != "" {
+		if s.healthListener, err = net.Listen("tcp", s.config.MetricsAddr); err != nil {
+			return err
+		}
+	}
 
 	// Create and start the debugger
 	config := s.config.Debugger
 	if s.debugger, err = debugger.New(&config, s.config.ProcessArgs); err != nil {
+		if s.healthListener != nil {
+			s.healthListener.Close()
+		}
 		return err
 	}
 
 	s.s1 = rpc1.NewServer(s.config, s.debugger)
 	s.s2 = rpc2.NewServer(s.config, s.debugger)
+	s.s3 = rpc3.NewServer(s.config, s.debugger, s.s2)
 
 	rpcServer := &RPCServer{s}
 
-	s.methodMaps = make([]map[string]*methodType, 2)
+	s.methodMaps = make([]map[string]*methodType, 3)
 
 	s.methodMaps[0] = map[string]*methodType{}
 	s.methodMaps[1] = map[string]*methodType{}
+	s.methodMaps[2] = map[string]*methodType{}
 	suitableMethods(s.s1, s.methodMaps[0], s.log)
 	suitableMethods(rpcServer, s.methodMaps[0], s.log)
 	suitableMethods(s.s2, s.methodMaps[1], s.log)
 	suitableMethods(rpcServer, s.methodMaps[1], s.log)
+	suitableMethods(s.s3, s.methodMaps[2], s.log)
+	suitableMethods(rpcServer, s.methodMaps[2], s.log)
+
+	if s.healthListener != nil {
+		go s.serveHealth()
+	}
 
 	go func() {
 		defer s.listener.Close()
@@ -254,24 +293,59 @@ func (s *ServerImpl) serveJSONCodec(conn io.ReadWriteCloser) {
 		}
 	}()
 
+	lost := false
+	defer func() {
+		if lost {
+			s.connectionLost()
+		}
+	}()
+	defer s.addClient(conn)()
+	clientAddr := remoteAddr(conn)
+
 	sending := new(sync.Mutex)
-	codec := jsonrpc.NewServerCodec(conn)
+	codec, _ := rpccodec.NewServerCodec(conn, rpccodec.EncodingJSON, rpccodec.CompressionNone)
 	var req rpc.Request
 	var resp rpc.Response
-	for {
+	for first := true; ; first = false {
 		req = rpc.Request{}
 		err := codec.ReadRequestHeader(&req)
 		if err != nil {
 			if err != io.EOF {
 				s.log.Error("rpc:", err)
+				lost = true
 			}
 			break
 		}
 
-		mtype, ok := s.methodMaps[s.config.APIVersion-1][req.ServiceMethod]
+		if req.ServiceMethod == rpccodec.SetEncodingMethod {
+			// SetEncoding changes the codec, it is handled here instead of
+			// being a method of RPCServer.
+			var in api.SetEncodingIn
+			if err = codec.ReadRequestBody(&in); err != nil {
+				lost = err != io.EOF
+				return
+			}
+			errmsg := ""
+			if !first {
+				errmsg = "SetEncoding must be the first request"
+			} else if err := rpccodec.Check(in.Encoding, in.Compression); err != nil {
+				errmsg = err.Error()
+			}
+			s.sendResponse(sending, &req, &rpc.Response{}, &api.SetEncodingOut{}, codec, errmsg, "")
+			if errmsg == "" {
+				s.log.Debugf("switching to encoding %q compression %q", in.Encoding, in.Compression)
+				codec, _ = rpccodec.NewServerCodec(conn, in.Encoding, in.Compression)
+			}
+			continue
+		}
+
+		// SetApiVersion, called by any client, can change the version while
+		// the request is being served.
+		apiVersion := s.config.APIVersion
+		mtype, ok := s.methodMaps[apiVersion-1][req.ServiceMethod]
 		if !ok {
 			s.log.Errorf("rpc: can't find method %s", req.ServiceMethod)
-			s.sendResponse(sending, &req, &rpc.Response{}, nil, codec, fmt.Sprintf("unknown method: %s", req.ServiceMethod))
+			s.sendResponse(sending, &req, &rpc.Response{}, nil, codec, fmt.Sprintf("unknown method: %s", req.ServiceMethod), "")
 			continue
 		}
 
@@ -287,13 +361,25 @@ func (s *ServerImpl) serveJSONCodec(conn io.ReadWriteCloser) {
 		}
 		// argv guaranteed to be a pointer now.
 		if err = codec.ReadRequestBody(argv.Interface()); err != nil {
+			lost = err != io.EOF
 			return
 		}
 		if argIsValue {
 			argv = argv.Elem()
 		}
+		if name := strings.TrimPrefix(req.ServiceMethod, "RPCServer."); auditedMethods[name] {
+			s.config.AuditLog.Record(audit.Entry{
+				Client:    clientAddr,
+				API:       fmt.Sprintf("rpc%d", apiVersion),
+				Operation: name,
+				Args:      argv.Interface(),
+			})
+		}
+		s.debugger.RecordRequest(req.ServiceMethod + requestSummary(argv))
 
+		metrics.RequestsTotal.Inc(req.ServiceMethod)
 		if mtype.Synchronous {
+			start := time.Now()
 			if logflags.RPC() {
 				argvbytes, _ := json.Marshal(argv.Interface())
 				s.log.Debugf("<- %s(%T%s)", req.ServiceMethod, argv.Interface(), argvbytes)
@@ -313,22 +399,24 @@ func (s *ServerImpl) serveJSONCodec(conn io.ReadWriteCloser) {
 			}()
 
 			errmsg := ""
+			var code api.ErrorCode
 			if errInter != nil {
-				errmsg = errInter.(error).Error()
+				errmsg, code = s.errorMessage(errInter.(error))
 			}
+			observeRequest(req.ServiceMethod, start, errmsg)
 			resp = rpc.Response{}
 			if logflags.RPC() {
 				replyvbytes, _ := json.Marshal(replyv.Interface())
 				s.log.Debugf("-> %T%s error: %q", replyv.Interface(), replyvbytes, errmsg)
 			}
-			s.sendResponse(sending, &req, &resp, replyv.Interface(), codec, errmsg)
+			s.sendResponse(sending, &req, &resp, replyv.Interface(), codec, errmsg, code)
 		} else {
 			if logflags.RPC() {
 				argvbytes, _ := json.Marshal(argv.Interface())
 				s.log.Debugf("(async %d) <- %s(%T%s)", req.Seq, req.ServiceMethod, argv.Interface(), argvbytes)
 			}
 			function := mtype.method.Func
-			ctl := &RPCCallback{s, sending, codec, req}
+			ctl := &RPCCallback{s, sending, codec, req, time.Now()}
 			go func() {
 				defer func() {
 					if ierr := recover(); ierr != nil {
@@ -342,12 +430,143 @@ func (s *ServerImpl) serveJSONCodec(conn io.ReadWriteCloser) {
 	codec.Close()
 }
 
+// connectionLost applies config.OnDisconnect after the connection to a
+// client was lost, if no other client is connected.
+func (s *ServerImpl) connectionLost() {
+	select {
+	case <-s.stopChan:
+		return
+	default:
+	}
+	if s.config.OnDisconnect == "" || len(s.connectedClients()) > 0 {
+		return
+	}
+	state, err := s.debugger.State(true)
+	if err != nil {
+		return
+	}
+	switch s.config.OnDisconnect {
+	case "stop":
+		if state.Running {
+			s.log.Info("connection lost, halting the target")
+			s.debugger.Command(&api.DebuggerCommand{Name: api.Halt})
+		}
+	case "continue":
+		if !state.Running {
+			s.log.Info("connection lost, continuing the target")
+			s.debugger.Command(&api.DebuggerCommand{Name: api.Continue})
+		}
+	}
+}
+
+// auditedMethods are the methods, of all versions of the API, recorded in
+// the audit log because they change the state of the target.
+// maxSummaryLen is the length after which requestSummary stops
+// describing the arguments of a request, RecordRequest truncates the
+// requests recorded at about the same length.
+const maxSummaryLen = 256
+
+// requestSummary describes the arguments of a request, for the reports of
+// internal errors. Unlike their JSON encoding the description is bounded:
+// long strings are truncated, long slices and maps are only described by
+// their length, and the description ends after maxSummaryLen bytes.
+func requestSummary(v reflect.Value) string {
+	var buf strings.Builder
+	writeSummary(&buf, v, 0)
+	return buf.String()
+}
+
+func writeSummary(buf *strings.Builder, v reflect.Value, depth int) {
+	if buf.Len() > maxSummaryLen {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		buf.WriteString("nil")
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("nil")
+			return
+		}
+		writeSummary(buf, v.Elem(), depth)
+	case reflect.Struct:
+		if depth > 2 {
+			buf.WriteString("{...}")
+			return
+		}
+		buf.WriteString("{")
+		for i, sep := 0, ""; i < v.NumField() && buf.Len() <= maxSummaryLen; i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			fmt.Fprintf(buf, "%s%s:", sep, f.Name)
+			writeSummary(buf, v.Field(i), depth+1)
+			sep = " "
+		}
+		buf.WriteString("}")
+	case reflect.String:
+		str := v.String()
+		if len(str) > 64 {
+			str = str[:64] + "..."
+		}
+		fmt.Fprintf(buf, "%q", str)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if v.Len() > 4 || v.Kind() == reflect.Map || v.Type().Elem().Kind() == reflect.Uint8 {
+			fmt.Fprintf(buf, "[len %d]", v.Len())
+			return
+		}
+		buf.WriteString("[")
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteString(" ")
+			}
+			writeSummary(buf, v.Index(i), depth+1)
+		}
+		buf.WriteString("]")
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		buf.WriteString(v.Type().String())
+	default:
+		fmt.Fprint(buf, v.Interface())
+	}
+}
+
+var auditedMethods = map[string]bool{
+	"AddCoverage":               true,
+	"AmendBreakpoint":           true,
+	"Bisect":                    true,
+	"CancelNext":                true,
+	"CatchSyscalls":             true,
+	"Checkpoint":                true,
+	"ClearBreakpoint":           true,
+	"ClearBreakpointByName":     true,
+	"ClearCheckpoint":           true,
+	"ClearCoverage":             true,
+	"ClearExprWatch":            true,
+	"Command":                   true,
+	"CreateBreakpoint":          true,
+	"CreateCatchpoint":          true,
+	"CreateExprWatch":           true,
+	"CreateFinalizerBreakpoint": true,
+	"CreateGRPCBreakpoint":      true,
+	"CreateHTTPBreakpoint":      true,
+	"Detach":                    true,
+	"Profile":                   true,
+	"RecordCallers":             true,
+	"Restart":                   true,
+	"Set":                       true,
+	"SetSymbol":                 true,
+	"StartRuntimeTrace":         true,
+	"StopRecording":             true,
+	"StopRuntimeTrace":          true,
+}
+
 // A value sent as a placeholder for the server's response value when the server
 // receives an invalid request. It is never decoded by the client since the Response
 // contains an error when it is used.
 var invalidRequest = struct{}{}
 
-func (s *ServerImpl) sendResponse(sending *sync.Mutex, req *rpc.Request, resp *rpc.Response, reply interface{}, codec rpc.ServerCodec, errmsg string) {
+func (s *ServerImpl) sendResponse(sending *sync.Mutex, req *rpc.Request, resp *rpc.Response, reply interface{}, codec rpc.ServerCodec, errmsg string, code api.ErrorCode) {
 	resp.ServiceMethod = req.ServiceMethod
 	if errmsg != "" {
 		resp.Error = errmsg
@@ -356,7 +575,12 @@ func (s *ServerImpl) sendResponse(sending *sync.Mutex, req *rpc.Request, resp *r
 	resp.Seq = req.Seq
 	sending.Lock()
 	defer sending.Unlock()
-	err := codec.WriteResponse(resp, reply)
+	var err error
+	if cw, ok := codec.(rpccodec.ErrorCodeWriter); ok && code != "" {
+		err = cw.WriteResponseCode(resp, string(code), reply)
+	} else {
+		err = codec.WriteResponse(resp, reply)
+	}
 	if err != nil {
 		s.log.Error("writing response:", err)
 	}
@@ -364,15 +588,25 @@ func (s *ServerImpl) sendResponse(sending *sync.Mutex, req *rpc.Request, resp *r
 
 func (cb *RPCCallback) Return(out interface{}, err error) {
 	errmsg := ""
+	var code api.ErrorCode
 	if err != nil {
-		errmsg = err.Error()
+		errmsg, code = cb.s.errorMessage(err)
 	}
 	var resp rpc.Response
 	if logflags.RPC() {
 		outbytes, _ := json.Marshal(out)
 		cb.s.log.Debugf("(async %d) -> %T%s error: %q", cb.req.Seq, out, outbytes, errmsg)
 	}
-	cb.s.sendResponse(cb.sending, &cb.req, &resp, out, cb.codec, errmsg)
+	observeRequest(cb.req.ServiceMethod, cb.start, errmsg)
+	cb.s.sendResponse(cb.sending, &cb.req, &resp, out, cb.codec, errmsg, code)
+}
+
+// observeRequest records the duration and the outcome of a request to method.
+func observeRequest(method string, start time.Time, errmsg string) {
+	metrics.RequestDuration.Observe(time.Since(start), method)
+	if errmsg != "" {
+		metrics.RequestErrorsTotal.Inc(method)
+	}
 }
 
 // GetVersion returns the version of delve as well as the API version
@@ -388,7 +622,7 @@ func (s *RPCServer) SetApiVersion(args api.SetAPIVersionIn, out *api.SetAPIVersi
 	if args.APIVersion < 2 {
 		args.APIVersion = 1
 	}
-	if args.APIVersion > 2 {
+	if args.APIVersion > 3 {
 		return fmt.Errorf("unknown API version")
 	}
 	s.s.config.APIVersion = args.APIVersion
@@ -425,10 +659,37 @@ func newInternalError(ierr interface{}, skip int) *internalError {
 }
 
 func (err *internalError) Error() string {
+	return fmt.Sprintf("Internal debugger error: %v\n", err.Err) + err.stack()
+}
+
+func (err *internalError) stack() string {
 	var out bytes.Buffer
-	fmt.Fprintf(&out, "Internal debugger error: %v\n", err.Err)
 	for _, frame := range err.Stack {
 		fmt.Fprintf(&out, "%s (%#x)\n\t%s:%d\n", frame.Func, frame.Pc, frame.File, frame.Line)
 	}
 	return out.String()
 }
+
+// errorMessage returns the message and the code of err, returned by a
+// method. Internal errors of the debugger are reported with
+// Debugger.ReportInternalError and the path of the report is appended to
+// their message.
+func (s *ServerImpl) errorMessage(err error) (string, api.ErrorCode) {
+	errmsg, code := err.Error(), api.ErrorCodeOf(err)
+	var reason, stack string
+	switch err := err.(type) {
+	case *internalError:
+		reason, stack, code = fmt.Sprint(err.Err), err.stack(), api.ErrCodeInternal
+	case *proc.ErrInternal:
+		reason, stack = err.Msg, err.Stack
+	default:
+		return errmsg, code
+	}
+	path, rerr := s.debugger.ReportInternalError(reason, stack)
+	if rerr != nil {
+		s.log.Errorf("could not write the report of an internal error: %v", rerr)
+		return errmsg, code
+	}
+	fmt.Fprintf(os.Stderr, "Delve internal error, report written to %s\n", path)
+	return errmsg + "\nA report of the internal error was written to " + path, code
+}
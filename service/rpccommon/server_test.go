@@ -0,0 +1,30 @@
+package rpccommon
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/rpc2"
+)
+
+func TestRequestSummary(t *testing.T) {
+	for _, tt := range []struct {
+		args interface{}
+		want string
+	}{
+		{rpc2.StateIn{NonBlocking: true}, "{NonBlocking:true}"},
+		{&rpc2.CreateBreakpointIn{Breakpoint: api.Breakpoint{File: "main.go", Line: 10, Variables: []string{"a", "b"}}}, `{Breakpoint:{ID:0 Name:"" Addr:0 Addrs:[] File:"main.go" Line:10 FunctionName:"" Cond:"" Tracepoint:false TraceReturn:false Goroutine:false Stacktrace:0 Variables:["a" "b"] `},
+		{rpc2.EvalIn{Expr: strings.Repeat("x", 100)}, `{Scope:{GoroutineID:0 Frame:0 DeferredCall:0} Expr:"` + strings.Repeat("x", 64) + `..." Cfg:nil CancelToken:""}`},
+		{struct {
+			Addr uint64
+			Data []byte
+		}{1, make([]byte, 1<<20)}, "{Addr:1 Data:[len 1048576]}"},
+	} {
+		got := requestSummary(reflect.ValueOf(tt.args))
+		if !strings.HasPrefix(got, tt.want) || len(got) > 2*maxSummaryLen {
+			t.Errorf("requestSummary(%T) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
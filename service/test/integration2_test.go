@@ -1,6 +1,7 @@
 package service_test
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -25,6 +26,7 @@ import (
 	"github.com/go-delve/delve/service"
 	"github.com/go-delve/delve/service/api"
 	"github.com/go-delve/delve/service/rpc2"
+	"github.com/go-delve/delve/service/rpc3"
 	"github.com/go-delve/delve/service/rpccommon"
 )
 
@@ -49,7 +51,7 @@ func TestMain(m *testing.M) {
 		fmt.Fprintf(os.Stderr, "unknown build mode %q", buildMode)
 		os.Exit(1)
 	}
-	logflags.Setup(logOutput != "", logOutput, "")
+	logflags.Setup(logOutput != "", logOutput, "", "")
 	os.Exit(protest.RunTestsWithFixtures(m))
 }
 
@@ -271,6 +273,61 @@ func TestRestart_rebuild(t *testing.T) {
 	})
 }
 
+func TestRestart_rebuildFailure(t *testing.T) {
+	// A rebuild that fails to compile leaves the current process alone.
+	withTestClient2Extended("testenv", t, 0, [3]string{}, func(c service.Client, f protest.Fixture) {
+		pid := c.ProcessPid()
+
+		fi, err := os.Stat(f.Source)
+		assertNoError(err, t, "Stat fixture.Source")
+		originalSource, err := ioutil.ReadFile(f.Source)
+		assertNoError(err, t, "Reading original source")
+		defer ioutil.WriteFile(f.Source, originalSource, fi.Mode())
+		err = ioutil.WriteFile(f.Source, []byte("package main\n\nfunc main() {\n"), fi.Mode())
+		assertNoError(err, t, "Writing modified source")
+
+		if _, err := c.Restart(true); err == nil {
+			t.Fatal("rebuild of broken source succeeded")
+		}
+		if c.ProcessPid() != pid {
+			t.Fatalf("process restarted, pid %d instead of %d", c.ProcessPid(), pid)
+		}
+		if _, err := os.Stat(f.Path + ".rebuild"); err == nil {
+			t.Fatal("rebuilt executable not removed")
+		}
+		state := <-c.Continue()
+		assertNoError(state.Err, t, "Continue")
+	})
+}
+
+func TestRestart_rebuildRemap(t *testing.T) {
+	// Breakpoints follow their function when the lines above it change.
+	withTestClient2Extended("testenv", t, 0, [3]string{}, func(c service.Client, f protest.Fixture) {
+		bp, err := c.CreateBreakpoint(&api.Breakpoint{File: f.Source, Line: 10})
+		assertNoError(err, t, "CreateBreakpoint")
+
+		fi, err := os.Stat(f.Source)
+		assertNoError(err, t, "Stat fixture.Source")
+		originalSource, err := ioutil.ReadFile(f.Source)
+		assertNoError(err, t, "Reading original source")
+		defer ioutil.WriteFile(f.Source, originalSource, fi.Mode())
+		modified := strings.Replace(string(originalSource), "func main() {", "// Three more lines\n// above\n// main.\nfunc main() {", 1)
+		err = ioutil.WriteFile(f.Source, []byte(modified), fi.Mode())
+		assertNoError(err, t, "Writing modified source")
+
+		discarded, err := c.Restart(true)
+		assertNoError(err, t, "Restart(true)")
+		if len(discarded) != 0 {
+			t.Fatalf("breakpoints discarded: %v", discarded)
+		}
+		bp, err = c.GetBreakpoint(bp.ID)
+		assertNoError(err, t, "GetBreakpoint")
+		if bp.Line != 13 {
+			t.Fatalf("breakpoint at line %d instead of 13", bp.Line)
+		}
+	})
+}
+
 func TestClientServer_exit(t *testing.T) {
 	protest.AllowRecording(t)
 	withTestClient2("continuetestprog", t, func(c service.Client) {
@@ -1312,6 +1369,37 @@ func TestTypesCommand(t *testing.T) {
 	})
 }
 
+func TestSearchSymbols(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("testvariables2", t, func(c service.Client) {
+		syms, err := c.SearchSymbols("astruct", 0, 0)
+		assertNoError(err, t, "SearchSymbols(astruct)")
+		if len(syms) == 0 || syms[0].Name != "main.astruct" || syms[0].Kind != api.SymbolType {
+			t.Fatalf("main.astruct not the first result: %v", syms)
+		}
+
+		syms, err = c.SearchSymbols("main", api.SymbolFunction, 3)
+		assertNoError(err, t, "SearchSymbols(main)")
+		if len(syms) != 3 || syms[0].Name != "main.main" || syms[0].File == "" || syms[0].PC == 0 {
+			t.Fatalf("wrong functions matching main: %v", syms)
+		}
+		for i := range syms {
+			if syms[i].Kind != api.SymbolFunction {
+				t.Errorf("symbol %s is not a function", syms[i].Name)
+			}
+			if i > 0 && syms[i].Score > syms[i-1].Score {
+				t.Errorf("symbols not ranked: %v", syms)
+			}
+		}
+
+		syms, err = c.SearchSymbols("allglen", api.SymbolVariable, 0)
+		assertNoError(err, t, "SearchSymbols(allglen)")
+		if len(syms) == 0 || syms[0].Name != "runtime.allglen" {
+			t.Fatalf("runtime.allglen not the first result: %v", syms)
+		}
+	})
+}
+
 func TestIssue406(t *testing.T) {
 	protest.AllowRecording(t)
 	withTestClient2("issue406", t, func(c service.Client) {
@@ -1722,6 +1810,144 @@ func TestAcceptMulticlient(t *testing.T) {
 	<-serverDone
 }
 
+func TestOnDisconnectStop(t *testing.T) {
+	if testBackend == "rr" {
+		t.Skip("recording not allowed for TestOnDisconnectStop")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("couldn't start listener: %s\n", err)
+	}
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		defer listener.Close()
+		disconnectChan := make(chan struct{})
+		server := rpccommon.NewServer(&service.Config{
+			Listener:       listener,
+			ProcessArgs:    []string{protest.BuildFixture("loopprog", 0).Path},
+			AcceptMulti:    true,
+			OnDisconnect:   "stop",
+			DisconnectChan: disconnectChan,
+			Debugger: debugger.Config{
+				Backend:     testBackend,
+				ExecuteKind: debugger.ExecutingGeneratedTest,
+			},
+		})
+		if err := server.Run(); err != nil {
+			t.Error(err)
+			return
+		}
+		<-disconnectChan
+		server.Stop()
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assertNoError(err, t, "Dial")
+	client1 := rpc2.NewClientFromConn(conn)
+	bp, err := client1.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.main"})
+	assertNoError(err, t, "CreateBreakpoint")
+	state := <-client1.Continue()
+	assertNoError(state.Err, t, "Continue")
+	client1.Continue()
+	time.Sleep(200 * time.Millisecond)
+	// lose the connection with a reset, instead of closing it
+	conn.(*net.TCPConn).SetLinger(0)
+	conn.Close()
+	// the target is only halted if no other client is connected
+	time.Sleep(500 * time.Millisecond)
+
+	client2 := rpc2.NewClient(listener.Addr().String())
+	defer func() {
+		client2.Detach(true)
+		<-serverDone
+	}()
+	for i := 0; ; i++ {
+		state, err := client2.GetStateNonBlocking()
+		assertNoError(err, t, "GetStateNonBlocking")
+		if !state.Running {
+			break
+		}
+		if i >= 50 {
+			t.Fatal("target not halted after the connection was lost")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	bp2, err := client2.GetBreakpoint(bp.ID)
+	assertNoError(err, t, "GetBreakpoint")
+	if bp2.FunctionName != "main.main" {
+		t.Errorf("wrong breakpoint after reconnecting: %#v", bp2)
+	}
+}
+
+func TestClientServerEncoding(t *testing.T) {
+	clientConn, _ := startServer("testvariables2", 0, t, [3]string{})
+	c, err := rpc2.NewClientFromConnEncoding(clientConn, "gob", "flate")
+	assertNoError(err, t, "NewClientFromConnEncoding")
+	defer c.Detach(true)
+
+	state := <-c.Continue()
+	assertNoError(state.Err, t, "Continue")
+	_, err = c.Stacktrace(-1, 10, 0, nil)
+	assertNoError(err, t, "Stacktrace")
+	_, _, err = c.ListGoroutines(0, 0)
+	assertNoError(err, t, "ListGoroutines")
+	for _, expr := range []string{"c1", "s2", "p1", "upnil", "str1"} {
+		_, err := c.EvalVariable(api.EvalScope{GoroutineID: -1}, expr, normalLoadConfig)
+		assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", expr))
+	}
+	v, err := c.EvalVariable(api.EvalScope{GoroutineID: -1}, "str1", normalLoadConfig)
+	assertNoError(err, t, "EvalVariable(str1)")
+	if v.Value != "01234567890" {
+		t.Errorf("wrong value of str1: %q", v.Value)
+	}
+	_, err = c.EvalVariable(api.EvalScope{GoroutineID: -1}, "str1 +", normalLoadConfig)
+	if code := api.ErrorCodeOf(err); code != api.ErrCodeExpressionParse {
+		t.Errorf("wrong code of parse error %q: %v", code, err)
+	}
+}
+
+func TestClientServerErrorCodes(t *testing.T) {
+	withTestClient2("continuetestprog", t, func(c service.Client) {
+		assertCode := func(err error, code api.ErrorCode, what string) {
+			t.Helper()
+			if got := api.ErrorCodeOf(err); got != code {
+				t.Errorf("%s: wrong error code %q, expected %q (%v)", what, got, code, err)
+			}
+		}
+
+		_, err := c.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.sayhi"})
+		assertNoError(err, t, "CreateBreakpoint")
+		_, err = c.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.sayhi"})
+		assertCode(err, api.ErrCodeBreakpointExists, "CreateBreakpoint")
+		_, err = c.ClearBreakpoint(1000)
+		assertCode(err, api.ErrCodeNoSuchBreakpoint, "ClearBreakpoint")
+		var serr rpc.ServerError
+		if !errors.As(err, &serr) || string(serr) != err.Error() {
+			t.Errorf("ClearBreakpoint: error %#v does not wrap an rpc.ServerError", err)
+		}
+		err = c.AmendBreakpoint(&api.Breakpoint{ID: 1000})
+		assertCode(err, api.ErrCodeNoSuchBreakpoint, "AmendBreakpoint")
+		_, err = c.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.main", Cond: "1 +"})
+		assertCode(err, api.ErrCodeExpressionParse, "CreateBreakpoint with condition")
+
+		state := <-c.Continue()
+		assertNoError(state.Err, t, "Continue")
+		bps, err := c.ListBreakpoints()
+		assertNoError(err, t, "ListBreakpoints")
+		for _, bp := range bps {
+			if bp.ID > 0 {
+				_, err := c.ClearBreakpoint(bp.ID)
+				assertNoError(err, t, "ClearBreakpoint")
+			}
+		}
+		state = <-c.Continue()
+		assertCode(state.Err, api.ErrCodeProcessExited, "Continue")
+		_, _, err = c.ListGoroutines(0, 0)
+		assertCode(err, api.ErrCodeProcessExited, "ListGoroutines")
+	})
+}
+
 func mustHaveDebugCalls(t *testing.T, c service.Client) {
 	locs, err := c.FindLocation(api.EvalScope{GoroutineID: -1}, "runtime.debugCallV1", false)
 	if len(locs) == 0 || err != nil {
@@ -2098,3 +2324,491 @@ func TestRedirects(t *testing.T) {
 		}
 	})
 }
+
+func TestClientServer_sampleBreakpoint(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("integrationprog", t, func(c service.Client) {
+		fp := testProgPath(t, "integrationprog")
+		bp, err := c.CreateBreakpoint(&api.Breakpoint{File: fp, Line: 15, Sample: true, Variables: []string{"i"}})
+		assertNoError(err, t, "CreateBreakpoint")
+		state := <-c.Continue()
+		if !state.Exited {
+			t.Fatalf("target stopped at sample breakpoint: %#v", state.CurrentThread)
+		}
+		samples, dropped, err := c.GetSamples(true)
+		assertNoError(err, t, "GetSamples")
+		if dropped != 0 {
+			t.Fatalf("unexpected dropped samples %d", dropped)
+		}
+		if len(samples) != 3 {
+			t.Fatalf("wrong number of samples %d", len(samples))
+		}
+		for i, sample := range samples {
+			if sample.BreakpointID != bp.ID {
+				t.Errorf("wrong breakpoint ID for sample %d: %d", i, sample.BreakpointID)
+			}
+			if len(sample.Variables) != 1 || sample.Variables[0].Value != strconv.Itoa(i) {
+				t.Errorf("wrong values for sample %d: %#v", i, sample.Variables)
+			}
+		}
+		samples, _, err = c.GetSamples(false)
+		assertNoError(err, t, "GetSamples")
+		if len(samples) != 0 {
+			t.Fatalf("sample buffer not cleared")
+		}
+	})
+}
+
+func TestClientServer_lineCoverage(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("linecoverage", t, func(c service.Client) {
+		_, err := c.AddCoverage([]string{"nonexistent.go"})
+		if err == nil {
+			t.Fatal("AddCoverage of a nonexistent file succeeded")
+		}
+		n, err := c.AddCoverage([]string{"main.classify", "linecoverage.go"})
+		assertNoError(err, t, "AddCoverage")
+		lines, err := c.GetCoverage()
+		assertNoError(err, t, "GetCoverage")
+		if len(lines) != n {
+			t.Fatalf("tracking %d lines, %d expected", len(lines), n)
+		}
+		state := <-c.Continue()
+		if !state.Exited {
+			t.Fatalf("target stopped because of line coverage: %#v", state.CurrentThread)
+		}
+		lines, err = c.GetCoverage()
+		assertNoError(err, t, "GetCoverage")
+		executed := map[string]bool{}
+		for _, l := range lines {
+			executed[fmt.Sprintf("%s:%d", l.Function, l.Line)] = l.Executed
+		}
+		for line, exec := range map[string]bool{"main.classify:7": true, "main.classify:10": false, "main.unused:16": false, "main.main:21": true, "main.main:24": false} {
+			if e, tracked := executed[line]; !tracked || e != exec {
+				t.Errorf("%s: executed %v tracked %v, expected executed %v", line, e, tracked, exec)
+			}
+		}
+		assertNoError(c.ClearCoverage(), t, "ClearCoverage")
+		lines, err = c.GetCoverage()
+		assertNoError(err, t, "GetCoverage")
+		if len(lines) != 0 {
+			t.Fatalf("lines still tracked after ClearCoverage: %v", lines)
+		}
+	})
+}
+
+func TestClientServer_recordCallers(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("callers", t, func(c service.Client) {
+		stacks, err := c.RecordCallers("main.record", time.Minute)
+		assertNoError(err, t, "RecordCallers")
+		counts := map[string]int{}
+		dynamic := false
+		for _, stack := range stacks {
+			if len(stack.Frames) == 0 {
+				t.Fatalf("empty stack of callers: %#v", stack)
+			}
+			counts[fmt.Sprintf("%s:%d", stack.Frames[0].Function, stack.Frames[0].Line)] += stack.Count
+			for _, frame := range stack.Frames {
+				if frame.Function == "main.main" && frame.Line == 31 {
+					dynamic = true
+				}
+			}
+		}
+		expected := map[string]int{"main.single.add:18": 2, "main.double.add:24": 1, "main.double.add:25": 1, "main.main:33": 1}
+		if !reflect.DeepEqual(counts, expected) {
+			t.Errorf("callers mismatch, got %v expected %v", counts, expected)
+		}
+		if !dynamic {
+			t.Errorf("calls through the interface not recorded: %#v", stacks)
+		}
+		bps, err := c.ListBreakpoints()
+		assertNoError(err, t, "ListBreakpoints")
+		for _, bp := range bps {
+			if bp.ID > 0 {
+				t.Errorf("recording breakpoint not cleared: %#v", bp)
+			}
+		}
+	})
+}
+
+func TestClientServer_bisect(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("bisect", t, func(c service.Client) {
+		_, err := c.Bisect("total >= 0", "bisect.go:8", "bisect.go:13")
+		if err == nil {
+			t.Fatal("Bisect succeeded with a predicate true at the first iteration")
+		}
+		r, err := c.Bisect("total > 100", "bisect.go:8", "bisect.go:13")
+		assertNoError(err, t, "Bisect")
+		if r.Iteration != 10 || r.Iterations != 20 || r.Statement.Line != 10 || r.Steps != 3 {
+			t.Fatalf("wrong result %#v", r)
+		}
+		total, err := c.EvalVariable(api.EvalScope{GoroutineID: -1}, "total", normalLoadConfig)
+		assertNoError(err, t, "EvalVariable")
+		if total.Value != "156" {
+			t.Errorf("target not stopped after the statement, total = %s", total.Value)
+		}
+		bps, err := c.ListBreakpoints()
+		assertNoError(err, t, "ListBreakpoints")
+		for _, bp := range bps {
+			if bp.ID > 0 {
+				t.Errorf("bisect breakpoint not cleared: %#v", bp)
+			}
+		}
+	})
+}
+
+func TestClientServer_exprWatch(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("exprwatch", t, func(c service.Client) {
+		w, err := c.CreateExprWatch("p.x + p.y", []string{"exprwatch.go:22"})
+		assertNoError(err, t, "CreateExprWatch")
+		for i, value := range []string{"1", "2", "3"} {
+			state := <-c.Continue()
+			assertNoError(state.Err, t, "Continue")
+			if state.CurrentThread.Line != 22 || len(state.ExprWatchChanges) != 1 {
+				t.Fatalf("%d: wrong stop at line %d with changes %#v", i, state.CurrentThread.Line, state.ExprWatchChanges)
+			}
+			if c := state.ExprWatchChanges[0]; c.ID != w.ID || c.New != value {
+				t.Fatalf("%d: wrong change %#v, expected new value %s", i, c, value)
+			}
+		}
+		assertNoError(c.ClearExprWatch(w.ID), t, "ClearExprWatch")
+		watches, err := c.ListExprWatches()
+		assertNoError(err, t, "ListExprWatches")
+		if len(watches) != 0 {
+			t.Fatalf("watches not cleared: %#v", watches)
+		}
+		bps, err := c.ListBreakpoints()
+		assertNoError(err, t, "ListBreakpoints")
+		for _, bp := range bps {
+			if bp.ID > 0 {
+				t.Errorf("watch breakpoint not cleared: %#v", bp)
+			}
+		}
+	})
+
+	// evaluated at every stop, tracepoints stop when the value changes
+	withTestClient2Extended("exprwatch", t, 0, [3]string{}, func(c service.Client, fixture protest.Fixture) {
+		_, err := c.CreateBreakpoint(&api.Breakpoint{File: fixture.Source, Line: 22, Tracepoint: true})
+		assertNoError(err, t, "CreateBreakpoint")
+		_, err = c.CreateExprWatch("p.x + p.y", nil)
+		assertNoError(err, t, "CreateExprWatch")
+		var changes []string
+		for state := range c.Continue() {
+			for _, c := range state.ExprWatchChanges {
+				changes = append(changes, c.Old+"->"+c.New)
+			}
+		}
+		if fmt.Sprint(changes) != "[0->1]" {
+			t.Errorf("wrong changes %v", changes)
+		}
+	})
+}
+
+func TestClientServer_errorReturnBreakpoint(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("errorreturn", t, func(c service.Client) {
+		_, err := c.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.check", ErrorReturn: true})
+		assertNoError(err, t, "CreateBreakpoint")
+		for _, tgt := range []string{"2", "5"} {
+			state := <-c.Continue()
+			assertNoError(state.Err, t, "Continue")
+			if state.CurrentThread.Breakpoint == nil || !state.CurrentThread.Breakpoint.ErrorReturn {
+				t.Fatalf("not stopped on error return breakpoint: %#v", state.CurrentThread)
+			}
+			n, err := c.EvalVariable(api.EvalScope{GoroutineID: -1}, "n", normalLoadConfig)
+			assertNoError(err, t, "EvalVariable")
+			if n.Value != tgt {
+				t.Fatalf("wrong value of n: expected %s got %s", tgt, n.Value)
+			}
+		}
+		state := <-c.Continue()
+		if !state.Exited {
+			t.Fatalf("expected process to exit, stopped at %#v", state.CurrentThread)
+		}
+	})
+}
+
+func TestClientServer_runtimeEventBreakpoints(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("gcevents", t, func(c service.Client) {
+		for _, event := range []string{"goroutine-create", "goroutine-exit", "gc-start"} {
+			_, err := c.CreateBreakpoint(&api.Breakpoint{FunctionName: api.RuntimeEvents[event]})
+			assertNoError(err, t, fmt.Sprintf("CreateBreakpoint(%s)", event))
+		}
+		seen := map[string]bool{}
+		for {
+			state := <-c.Continue()
+			if state.Exited {
+				break
+			}
+			assertNoError(state.Err, t, "Continue")
+			if state.GC == nil {
+				t.Fatalf("no GC state")
+			}
+			fn := state.CurrentThread.Function.Name()
+			seen[fn] = true
+			if fn == api.RuntimeEvents["gc-start"] {
+				break
+			}
+		}
+		for _, event := range []string{"goroutine-create", "goroutine-exit", "gc-start"} {
+			if !seen[api.RuntimeEvents[event]] {
+				t.Errorf("did not stop on %s", event)
+			}
+		}
+	})
+}
+
+func TestClientServer_RuntimeStats(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("gcevents", t, func(c service.Client) {
+		fp := testProgPath(t, "gcevents")
+		_, err := c.CreateBreakpoint(&api.Breakpoint{File: fp, Line: 15})
+		assertNoError(err, t, "CreateBreakpoint")
+		state := <-c.Continue()
+		assertNoError(state.Err, t, "Continue")
+		stats, err := c.RuntimeStats()
+		assertNoError(err, t, "RuntimeStats")
+		t.Logf("%#v", stats)
+		if stats.Goroutines <= 0 {
+			t.Errorf("wrong number of goroutines %d", stats.Goroutines)
+		}
+		for _, name := range stats.Unavailable {
+			if name == "NumGC" {
+				t.Fatalf("NumGC unavailable")
+			}
+		}
+		if stats.NumGC == 0 || len(stats.PauseNs) == 0 {
+			t.Errorf("GC cycle not recorded: %d %v", stats.NumGC, stats.PauseNs)
+		}
+	})
+}
+
+func TestClientServer_CancelToken(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("testvariables2", t, func(c service.Client) {
+		state := <-c.Continue()
+		assertNoError(state.Err, t, "Continue")
+		rpcClient := c.(*rpc2.RPCClient)
+
+		var out rpc2.EvalOut
+		err := rpcClient.CallAPI("Eval", rpc2.EvalIn{Scope: api.EvalScope{GoroutineID: -1}, Expr: "m1", CancelToken: "eval1"}, &out)
+		assertNoError(err, t, "Eval")
+		if out.Variable == nil || out.Variable.Name != "m1" {
+			t.Errorf("wrong variable %#v", out.Variable)
+		}
+
+		// the request is done, there is nothing left to cancel
+		var cancelOut rpc2.CancelOut
+		err = rpcClient.CallAPI("Cancel", rpc2.CancelIn{CancelToken: "eval1"}, &cancelOut)
+		assertNoError(err, t, "Cancel")
+		if cancelOut.Cancelled {
+			t.Errorf("finished request cancelled")
+		}
+	})
+}
+
+func TestClientServer_APIv3(t *testing.T) {
+	protest.AllowRecording(t)
+	clientConn, _ := startServer("continuetestprog", 0, t, [3]string{})
+	client := jsonrpc.NewClient(clientConn)
+	defer client.Call("RPCServer.Detach", rpc2.DetachIn{Kill: true}, &rpc2.DetachOut{})
+
+	err := client.Call("RPCServer.SetApiVersion", api.SetAPIVersionIn{APIVersion: 3}, &api.SetAPIVersionOut{})
+	assertNoError(err, t, "SetApiVersion")
+
+	var info rpc3.APIInfoOut
+	assertNoError(client.Call("RPCServer.APIInfo", rpc3.APIInfoIn{}, &info), t, "APIInfo")
+	if info.Version != rpc3.Version || info.Major != 3 || info.DefaultLoadConfig != normalLoadConfig {
+		t.Errorf("wrong APIInfo %#v", info)
+	}
+
+	// APIv2 arguments return all the functions, pages of one function
+	// return the same functions.
+	var all rpc3.ListFunctionsOut
+	err = client.Call("RPCServer.ListFunctions", rpc2.ListFunctionsIn{Filter: "^main\\."}, &all)
+	assertNoError(err, t, "ListFunctions")
+	if len(all.Funcs) < 2 || all.Next != "" {
+		t.Fatalf("wrong functions %#v", all)
+	}
+	var paged []string
+	for in := (rpc3.ListFunctionsIn{Filter: "^main\\.", Limit: 1}); ; {
+		var out rpc3.ListFunctionsOut
+		assertNoError(client.Call("RPCServer.ListFunctions", in, &out), t, "ListFunctions")
+		if len(out.Funcs) != 1 {
+			t.Fatalf("wrong page %#v", out)
+		}
+		paged = append(paged, out.Funcs...)
+		if out.Next == "" {
+			break
+		}
+		in.Cursor = out.Next
+	}
+	if !reflect.DeepEqual(paged, all.Funcs) {
+		t.Errorf("paged functions %v, want %v", paged, all.Funcs)
+	}
+
+	var cmdOut rpc2.CommandOut
+	assertNoError(client.Call("RPCServer.Command", api.DebuggerCommand{Name: api.Continue}, &cmdOut), t, "Continue")
+	var events rpc3.EventsOut
+	assertNoError(client.Call("RPCServer.Events", rpc3.EventsIn{}, &events), t, "Events")
+	if len(events.Events) != 2 || events.Events[0].Kind != rpc3.EventRunning || events.Events[1].Kind != rpc3.EventExited {
+		t.Fatalf("wrong events %#v", events)
+	}
+	last := events.Events[1].Seq
+	assertNoError(client.Call("RPCServer.Events", rpc3.EventsIn{After: last, Timeout: 10}, &events), t, "Events")
+	if len(events.Events) != 0 {
+		t.Errorf("unexpected events %#v", events)
+	}
+}
+
+func TestClientServer_ReadOnly(t *testing.T) {
+	protest.AllowRecording(t)
+	listener, clientConn := service.ListenerPipe()
+	defer listener.Close()
+	fixture := protest.BuildFixture("testvariables2", 0)
+	server := rpccommon.NewServer(&service.Config{
+		Listener:    listener,
+		ProcessArgs: []string{fixture.Path},
+		APIVersion:  2,
+		Debugger: debugger.Config{
+			Backend:          testBackend,
+			ExecuteKind:      debugger.ExecutingExistingFile,
+			ReadOnly:         true,
+			AllowTracepoints: true,
+		},
+	})
+	if err := server.Run(); err != nil {
+		t.Fatal(err)
+	}
+	c := rpc2.NewClientFromConn(clientConn)
+	defer c.Detach(true)
+
+	assertReadOnly := func(err error, what string) {
+		t.Helper()
+		if err == nil || err.Error() != debugger.ErrReadOnly.Error() {
+			t.Errorf("%s: got error %v, want %q", what, err, debugger.ErrReadOnly)
+		}
+	}
+
+	_, err := c.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.main", Line: -1})
+	assertReadOnly(err, "CreateBreakpoint")
+	bp, err := c.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.main", Line: -1, Tracepoint: true})
+	assertNoError(err, t, "CreateBreakpoint(tracepoint)")
+	bp.Tracepoint = false
+	assertReadOnly(c.AmendBreakpoint(bp), "AmendBreakpoint")
+
+	state := <-c.Continue()
+	assertNoError(state.Err, t, "Continue")
+	assertReadOnly(c.SetVariable(api.EvalScope{GoroutineID: -1}, "a2", "7"), "SetVariable")
+	_, err = c.Call(-1, "fn2()", false)
+	assertReadOnly(err, "Call")
+	_, err = c.Restart(false)
+	assertReadOnly(err, "Restart")
+	_, err = c.Bisect("a2 == 6", "main.main", "main.main")
+	assertReadOnly(err, "Bisect")
+}
+
+func TestClientServer_Snapshot(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("snapshots are only supported on linux")
+	}
+	protest.AllowRecording(t)
+	withTestClient2("testnextprog", t, func(c service.Client) {
+		_, err := c.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.helloworld", Line: -1})
+		assertNoError(err, t, "CreateBreakpoint")
+		state := <-c.Continue()
+		assertNoError(state.Err, t, "Continue")
+
+		id, err := c.Snapshot("at helloworld")
+		if c.Recorded() {
+			if err == nil {
+				t.Fatal("Snapshot of a recorded target succeeded")
+			}
+			return
+		}
+		assertNoError(err, t, "Snapshot")
+
+		// continue to the end, the snapshot must stay inspectable
+		for !state.Exited {
+			state = <-c.Continue()
+		}
+
+		assertNoError(c.SwitchSnapshot(id), t, "SwitchSnapshot")
+		state, err = c.GetState()
+		assertNoError(err, t, "GetState")
+		if state.CurrentThread == nil || state.CurrentThread.Function == nil || state.CurrentThread.Function.Name() != "main.helloworld" {
+			t.Fatalf("wrong snapshot location: %#v", state.CurrentThread)
+		}
+		if _, err := c.Stacktrace(-1, 10, 0, nil); err != nil {
+			t.Fatalf("Stacktrace: %v", err)
+		}
+		if state := <-c.Continue(); state.Err == nil || state.Err.Error() != debugger.ErrSnapshotSelected.Error() {
+			t.Fatalf("Continue with a snapshot selected: got error %v", state.Err)
+		}
+
+		snaps, err := c.ListSnapshots()
+		assertNoError(err, t, "ListSnapshots")
+		if len(snaps) != 1 || snaps[0].ID != id || !snaps[0].Selected || snaps[0].Note != "at helloworld" {
+			t.Fatalf("wrong snapshots: %#v", snaps)
+		}
+		assertNoError(c.ClearSnapshot(id), t, "ClearSnapshot")
+		snaps, err = c.ListSnapshots()
+		assertNoError(err, t, "ListSnapshots")
+		if len(snaps) != 0 {
+			t.Fatalf("snapshot not cleared: %#v", snaps)
+		}
+	})
+}
+
+func TestClientServerLogLevels(t *testing.T) {
+	withTestClient2("continuetestprog", t, func(c service.Client) {
+		levelOf := func(subsystem string) string {
+			levels, err := c.GetLogLevels()
+			assertNoError(err, t, "GetLogLevels")
+			for _, lvl := range levels {
+				if lvl.Subsystem == subsystem {
+					return lvl.Level
+				}
+			}
+			t.Fatalf("subsystem %s not found in %v", subsystem, levels)
+			return ""
+		}
+
+		old := levelOf("minidump")
+		assertNoError(c.SetLogLevel("minidump", "warning"), t, "SetLogLevel")
+		defer c.SetLogLevel("minidump", old)
+		if lvl := levelOf("minidump"); lvl != "warning" {
+			t.Errorf("wrong level after SetLogLevel: %s", lvl)
+		}
+		if err := c.SetLogLevel("nothing", "debug"); err == nil {
+			t.Error("no error setting the level of an unknown subsystem")
+		}
+		_, err := c.DumpLog()
+		assertNoError(err, t, "DumpLog")
+	})
+}
+
+func TestClientServer_ProfileCPUHalt(t *testing.T) {
+	// A halt while a CPU profile is collected ends the profile, instead of
+	// being taken for one of the stops sampling the stacks.
+	withTestClient2("loopprog", t, func(c service.Client) {
+		done := make(chan error, 1)
+		start := time.Now()
+		go func() {
+			_, err := c.Profile("cpu", time.Minute)
+			done <- err
+		}()
+		time.Sleep(500 * time.Millisecond)
+		// Halt returns once the profile ended
+		_, err := c.Halt()
+		assertNoError(err, t, "Halt()")
+		assertNoError(<-done, t, "Profile()")
+		if d := time.Since(start); d > 30*time.Second {
+			t.Errorf("profile ended %v after it started, it was not ended by the halt", d)
+		}
+	})
+}
@@ -131,7 +131,7 @@ func withTestProcessArgs(name string, t *testing.T, wd string, args []string, bu
 	var tracedir string
 	switch testBackend {
 	case "native":
-		p, err = native.Launch(append([]string{fixture.Path}, args...), wd, false, []string{}, "", [3]string{})
+		p, err = native.Launch(append([]string{fixture.Path}, args...), wd, false, []string{}, "", [3]string{}, nil)
 	case "lldb":
 		p, err = gdbserial.LLDBLaunch(append([]string{fixture.Path}, args...), wd, false, []string{}, "", [3]string{})
 	case "rr":
@@ -255,6 +255,12 @@ func TestSetVariable(t *testing.T) {
 
 		{"s3", "[]int", `[]int len: 0, cap: 6, []`, "s4[2:5]", "[]int len: 3, cap: 3, [3,4,5]"},
 		{"s3", "[]int", "[]int len: 3, cap: 3, [3,4,5]", "arr1[:]", "[]int len: 4, cap: 4, [0,1,2,3]"},
+
+		{"as1", "main.astruct", "main.astruct {A: 2, B: 3}", "{B: 5}", "main.astruct {A: 0, B: 5}"},
+		{"as1", "main.astruct", "main.astruct {A: 0, B: 5}", "main.astruct{7, 8}", "main.astruct {A: 7, B: 8}"},
+		{"s3", "[]int", "[]int len: 4, cap: 4, [0,1,2,3]", "{9, 8}", "[]int len: 2, cap: 4, [9,8]"},
+		{"arr1", "[4]int", "[4]int [9,8,2,3]", "{3: 1}", "[4]int [0,0,0,1]"},
+		{"err1", "error", "error nil", "c1.sa[0]", "error(*main.astruct) *{A: 1, B: 2}"},
 	}
 
 	withTestProcess("testvariables2", t, func(p *proc.Target, fixture protest.Fixture) {
@@ -277,6 +283,11 @@ func TestSetVariable(t *testing.T) {
 			assertNoError(err, t, "EvalVariable()")
 			assertVariable(t, variable, varTest{tc.name, true, tc.finalVal, "", tc.typ, nil})
 		}
+
+		// map literals can only be assigned with function calls
+		if err := setVariable(p, "m2", "{1: nil}"); err == nil || err.Error() != "literal can not be allocated because function calls are not allowed without using 'call'" {
+			t.Fatalf("unexpected error assigning map literal: %v", err)
+		}
 	})
 }
 
@@ -629,6 +640,23 @@ func TestEvalExpression(t *testing.T) {
 		{"err1.(*main.astruct)", false, "*main.astruct {A: 1, B: 2}", "(*main.astruct)(0x…", "*main.astruct", nil},
 		{"err1.(*main.bstruct)", false, "", "", "", fmt.Errorf("interface conversion: error is *main.astruct, not *main.bstruct")},
 		{"errnil.(*main.astruct)", false, "", "", "", fmt.Errorf("interface conversion: error is nil, not *main.astruct")},
+		{"iface(err1, *main.astruct)", false, "*main.astruct {A: 1, B: 2}", "(*main.astruct)(0x…", "*main.astruct", nil},
+		{"iface(err1, *main.astruct).B", false, "2", "2", "int", nil},
+		{"iface(iface2, string)", false, `"test"`, `"test"`, "string", nil},
+		{"iface(errnil, *main.astruct)", false, "", "", "", fmt.Errorf("interface conversion: errnil is nil, not *main.astruct")},
+		{"iface(c1, *main.astruct)", false, "", "", "", fmt.Errorf("invalid argument c1 (type main.cstruct) for iface")},
+
+		// glob builtin
+		{`glob("0123*", str1)`, false, "true", "true", "", nil},
+		{`glob("*89?", str1)`, false, "true", "true", "", nil},
+		{`glob("*9", str1)`, false, "false", "false", "", nil},
+		{`glob("a*/0*0", "a/b", "/", str1)`, false, "true", "true", "", nil},
+		{`glob("*", i1)`, false, "", "", "", fmt.Errorf("invalid argument i1 (type int) for glob")},
+		{`haskey(m1, "Malone")`, false, "true", "true", "", nil},
+		{`haskey(m1, "Bianchi")`, false, "false", "false", "", nil},
+		{`haskey(mnil, "Malone")`, false, "false", "false", "", nil},
+		{`haskey(m2, 1) && m2[1].A == 10`, false, "true", "true", "", nil},
+		{`haskey(str1, "a")`, false, "", "", "", fmt.Errorf("invalid argument str1 (type string) for haskey")},
 		{"const1", true, "go/constant.Value(go/constant.int64Val) 3", "go/constant.Value(go/constant.int64Val) 3", "go/constant.Value", nil},
 
 		// combined expressions
@@ -1240,6 +1268,11 @@ func TestCallFunction(t *testing.T) {
 		{`strings.LastIndexByte(stringslice[1], 'o')`, []string{":int:2"}, nil},
 		{`d.Base.Method()`, []string{`:int:4`}, nil},
 		{`d.Method()`, []string{`:int:4`}, nil},
+
+		// assignment of composite literals
+		{`intslice = {4, 5, 6, 7}; intslice`, []string{`intslice:[]int:[]int len: 4, cap: 4, [4,5,6,7]`}, nil},
+		{`pa2 = &main.astruct{X: 9}; pa2`, []string{`pa2:*main.astruct:*main.astruct {X: 9}`}, nil},
+		{`vable_a = main.astruct{X: 10}; vable_a`, []string{`vable_a:main.VRcvrable:main.VRcvrable(main.astruct) {X: 10}`}, nil},
 	}
 
 	var testcases113 = []testCaseCallFunction{
@@ -1562,3 +1595,26 @@ func TestCgoEval(t *testing.T) {
 		}
 	})
 }
+
+func TestCtxValueBuiltin(t *testing.T) {
+	testcases := []varTest{
+		{`ctxvalue(ctx, "main.userKey")`, false, `"gopher"`, `"gopher"`, "string", nil},
+		{`ctxvalue(ctx, "main.requestID")`, false, "42", "42", "int", nil},
+		{`ctxvalue(ctx, "main.userKey") == "gopher"`, false, "true", "true", "", nil},
+		{`ctxvalue(ctx, "main.missingKey")`, false, "", "", "", errors.New("no value with a key of type main.missingKey in ctx")},
+		{`ctxvalue(n, "main.userKey")`, false, "", "", "", errors.New("invalid argument n (type int) for ctxvalue")},
+	}
+	protest.AllowRecording(t)
+	withTestProcess("ctxvalue", t, func(p *proc.Target, fixture protest.Fixture) {
+		assertNoError(p.Continue(), t, "Continue")
+		for _, tc := range testcases {
+			variable, err := evalVariable(p, tc.name, pnormalLoadConfig)
+			if tc.err == nil {
+				assertNoError(err, t, fmt.Sprintf("EvalExpression(%s)", tc.name))
+				assertVariable(t, variable, tc)
+			} else if err == nil || err.Error() != tc.err.Error() {
+				t.Errorf("EvalExpression(%s): expected error %q, got %v", tc.name, tc.err, err)
+			}
+		}
+	})
+}